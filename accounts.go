@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The account name used when none is given (short enough for Windows' 20 character limit)
+const DefaultAccountName = "noisemaker"
+
+// Any other account names have to start with this, so only throwaway accounts can be created or deleted (never real ones)
+const AccountNamePrefix = DefaultAccountName + "-"
+
+// Gets the native command (and args) for the given account action (useradd, userdel, groupadd, groupdel) on the given OS.
+// Also returns the command line to log, with any password redacted.
+func getAccountCommand(goos string, action string, name string) (string, []string, string, error) {
+	var cmd string
+	var args []string
+	redacted := ""
+	switch goos + "/" + action {
+	case "windows/useradd":
+		// Give the account a random password, rather than leaving it blank
+		password, err := generateAccountPassword()
+		if err != nil {
+			return "", nil, "", err
+		}
+		cmd, args = "net", []string{"user", name, password, "/add"}
+		redacted = strings.Join([]string{cmd, "user", name, "********", "/add"}, " ")
+	case "windows/userdel":
+		cmd, args = "net", []string{"user", name, "/delete"}
+	case "windows/groupadd":
+		cmd, args = "net", []string{"localgroup", name, "/add"}
+	case "windows/groupdel":
+		cmd, args = "net", []string{"localgroup", name, "/delete"}
+	case "darwin/useradd":
+		cmd, args = "sysadminctl", []string{"-addUser", name}
+	case "darwin/userdel":
+		cmd, args = "sysadminctl", []string{"-deleteUser", name}
+	case "darwin/groupadd":
+		cmd, args = "dseditgroup", []string{"-o", "create", name}
+	case "darwin/groupdel":
+		cmd, args = "dseditgroup", []string{"-o", "delete", name}
+	case "linux/useradd":
+		// No home directory, and no login shell
+		cmd, args = "useradd", []string{"-M", "-s", "/usr/sbin/nologin", name}
+	case "linux/userdel", "linux/groupadd", "linux/groupdel":
+		cmd, args = action, []string{name}
+	default:
+		return "", nil, "", fmt.Errorf("%s is not supported on %s", action, goos)
+	}
+
+	if redacted == "" {
+		redacted = strings.Join(append([]string{cmd}, args...), " ")
+	}
+	return cmd, args, redacted, nil
+}
+
+// Checks that the name is one of ours (noisemaker, or noisemaker-...)
+func isThrowawayAccountName(name string) bool {
+	return name == DefaultAccountName || (strings.HasPrefix(name, AccountNamePrefix) && len(name) > len(AccountNamePrefix))
+}
+
+// Runs the given account action (useradd, userdel, groupadd, groupdel) against a throwaway local account or group
+func manageAccount(goos string, action string, name string) (string, string, error) {
+	if !isThrowawayAccountName(name) {
+		return "invalid_name", "", fmt.Errorf("invalid account name '%s' (must be %s, or start with %s)", name, DefaultAccountName, AccountNamePrefix)
+	}
+	cmd, args, redacted, err := getAccountCommand(goos, action, name)
+	if err != nil {
+		return "unsupported", "", err
+	}
+
+	fmt.Printf("Running %s...\n", redacted)
+	output, err := exec.CommandContext(runContext, cmd, args...).CombinedOutput()
+	fmt.Printf("%s\n", strings.TrimSpace(string(output)))
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return "not_found", redacted, err
+		}
+		return "error", redacted, err
+	}
+
+	switch action {
+	case "useradd", "groupadd":
+		return "created", redacted, nil
+	default:
+		return "deleted", redacted, nil
+	}
+}
+
+// Generates a random password that satisfies the default Windows complexity requirements
+func generateAccountPassword() (string, error) {
+	randomBytes := make([]byte, 8)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return "Nm!" + hex.EncodeToString(randomBytes) + "Z", nil
+}
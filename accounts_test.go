@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_UserAdd_Disabled(t *testing.T) {
+	args := []string{"./noisemaker", "useradd", "nmtest"}
+	output := callMain(args)
+	assert.Contains(t, output, "Command useradd changes local accounts, and is disabled without -allow-privileged!")
+	assert.Equal(t, activityLogEntry.activity, "useradd")
+	assert.Equal(t, activityLogEntry.path, "nmtest")
+	assert.Equal(t, activityLogEntry.status, "disabled")
+}
+
+func TestMain_GroupDel_DefaultName(t *testing.T) {
+	args := []string{"./noisemaker", "groupdel"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.path, DefaultAccountName)
+	assert.Equal(t, activityLogEntry.status, "disabled")
+}
+
+func TestMain_UserDel_NotThrowaway(t *testing.T) {
+	// Only accounts named like ours can be touched, even when privileged commands are allowed
+	args := []string{"./noisemaker", "-allow-privileged", "userdel", "root"}
+	output := callMain(args)
+	assert.Contains(t, output, "Error: invalid account name 'root' (must be noisemaker, or start with noisemaker-)")
+	assert.Equal(t, activityLogEntry.status, "invalid_name")
+	assert.Equal(t, activityLogEntry.details, "")
+}
+
+func TestIsThrowawayAccountName(t *testing.T) {
+	assert.True(t, isThrowawayAccountName("noisemaker"))
+	assert.True(t, isThrowawayAccountName("noisemaker-svc"))
+	assert.False(t, isThrowawayAccountName("noisemaker-"))
+	assert.False(t, isThrowawayAccountName("noisemakers"))
+	assert.False(t, isThrowawayAccountName("Administrator"))
+}
+
+func TestGetAccountCommand(t *testing.T) {
+	for _, goos := range []string{"windows", "linux", "darwin"} {
+		for _, action := range []string{"useradd", "userdel", "groupadd", "groupdel"} {
+			cmd, args, redacted, err := getAccountCommand(goos, action, "nmtest")
+			assert.Nil(t, err)
+			assert.NotEmpty(t, cmd)
+			assert.Contains(t, args, "nmtest")
+			assert.True(t, strings.HasPrefix(redacted, cmd+" "))
+		}
+	}
+
+	_, _, _, err := getAccountCommand("plan9", "useradd", "nmtest")
+	assert.ErrorContains(t, err, "useradd is not supported on plan9")
+}
+
+func TestGetAccountCommand_RedactsPassword(t *testing.T) {
+	_, args, redacted, err := getAccountCommand("windows", "useradd", "nmtest")
+	assert.Nil(t, err)
+	assert.Equal(t, "net user nmtest ******** /add", redacted)
+	assert.True(t, strings.HasPrefix(args[2], "Nm!"))
+	assert.NotContains(t, redacted, args[2])
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A custom action, added without forking noisemaker (ie. a team's own technique): given its args, it does whatever it does, and
+// reports what it did as the columns of its activity log entry (see ActionResultColumns), with any entries of its own under "entries".
+// Only built-in types are used, so a Go plugin can implement it without importing noisemaker.
+type Action interface {
+	Name() string
+	Run(request map[string]any) (map[string]any, error)
+}
+
+// The columns an action's result can set (the rest, ie. who ran it and when, are filled in the way they are for every command)
+var ActionResultColumns = []string{"status", "path", "method", "sourceAddr", "sourcePort", "destAddr", "destPort", "bytesSent", "protocol", "bytesReceived", "details"}
+
+// How long an external action's binary can run before it's killed, unless its declaration says otherwise
+const DefaultActionTimeout = 5 * time.Minute
+
+// The -actions file, declaring the custom actions (in YAML)
+type ActionsFile struct {
+	Actions				[]*ActionDeclaration	`yaml:"actions"`
+}
+
+// A custom action, declared as either an external binary (path, with its args) or a Go plugin (plugin)
+type ActionDeclaration struct {
+	Name				string			`yaml:"name"`
+	Description			string			`yaml:"description"`
+	Path				string			`yaml:"path"`		// the binary to run, speaking the JSON contract on stdin and stdout
+	Args				[]string		`yaml:"args"`		// the args it's always run with (before the action's own, which are sent in the request)
+	Timeout				time.Duration	`yaml:"timeout"`
+	Plugin				string			`yaml:"plugin"`		// the Go plugin (.so) whose exported Action is run
+}
+
+// An action that runs an external binary: the request's written to its stdin as a JSON object, and it writes its result to stdout as
+// one (anything it writes to stderr is passed along, as its console output)
+type ExternalAction struct {
+	declaration			*ActionDeclaration
+}
+
+// Response data from action action
+type ActionResponse struct {
+	entries				int			// how many entries of its own the action logged
+	status				string
+}
+
+func (action *ExternalAction) Name() string {
+	return action.declaration.Name
+}
+
+func (action *ExternalAction) Run(request map[string]any) (map[string]any, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	timeout := action.declaration.Timeout
+	if timeout == 0 {
+		timeout = DefaultActionTimeout
+	}
+	ctx, cancel := context.WithTimeout(runContext, timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, action.declaration.Path, action.declaration.Args...)
+	cmd.Stdin = bytes.NewReader(encoded)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stdout
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return map[string]any{"status": "timeout"}, fmt.Errorf("action %s timed out after %v", action.declaration.Name, timeout)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return map[string]any{"status": exitErr.ProcessState.String()}, fmt.Errorf("action %s failed: %v", action.declaration.Name, err)
+	} else if err != nil {
+		return map[string]any{"status": "unable_to_run"}, err
+	}
+
+	result := map[string]any{}
+	if err = json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return map[string]any{"status": "error"}, fmt.Errorf("action %s wrote an invalid result (must be a JSON object): %v", action.declaration.Name, err)
+	}
+	return result, nil
+}
+
+// Loads the custom actions declared in the -actions file ("" for none), by name
+func loadActions(path string) (map[string]Action, error) {
+	actions := map[string]Action{}
+	if path == "" {
+		return actions, nil
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	actionsFile := new(ActionsFile)
+	if err = yaml.Unmarshal(contents, actionsFile); err != nil {
+		return nil, fmt.Errorf("invalid -actions file %s: %v", path, err)
+	}
+	for i, declaration := range actionsFile.Actions {
+		if declaration.Name == "" || declaration.Name == "list" {
+			return nil, fmt.Errorf("invalid -actions file %s: action %d needs a name (besides list)", path, i + 1)
+		}
+		if _, found := actions[declaration.Name]; found {
+			return nil, fmt.Errorf("invalid -actions file %s: action %s is declared more than once", path, declaration.Name)
+		}
+		if (declaration.Path == "") == (declaration.Plugin == "") {
+			return nil, fmt.Errorf("invalid -actions file %s: action %s needs either a path or a plugin", path, declaration.Name)
+		}
+		if declaration.Plugin != "" {
+			action, err := loadPluginAction(declaration.Plugin)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load action %s: %v", declaration.Name, err)
+			}
+			actions[declaration.Name] = action
+			continue
+		}
+		actions[declaration.Name] = &ExternalAction{declaration: declaration}
+	}
+	return actions, nil
+}
+
+// Prints each of the custom actions, by name
+func listActions(output io.Writer, actions map[string]Action) int {
+	names := []string{}
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if external, ok := actions[name].(*ExternalAction); ok {
+			fmt.Fprintf(output, "%s: %s (runs %s)\n", name, external.declaration.Description, external.declaration.Path)
+		} else {
+			fmt.Fprintf(output, "%s (Go plugin)\n", name)
+		}
+	}
+	return len(names)
+}
+
+// Gets the request an action's run with: its args, and what it needs to know about the run (ie. to tag whatever it does with it)
+func getActionRequest(entry *ActivityLogEntry, name string, args []string) map[string]any {
+	return map[string]any{
+		"action": name,
+		"args": args,
+		"os": entry.os,
+		"runId": unescapeRawText(entry.runId),
+		"correlationId": entry.correlationId,
+		"elevated": entry.elevated == "true",
+	}
+}
+
+// Runs the custom action, recording its result in its entry (with its name as the method), and logging each of the entries it reports under "entries" as its own
+// activity, sharing its correlation ID
+func runAction(activityLog Sink, parent *ActivityLogEntry, action Action, args []string) *ActionResponse {
+	response := new(ActionResponse)
+	result, err := action.Run(getActionRequest(parent, action.Name(), args))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		parent.details = escapeRawText(err.Error())
+	}
+	if result == nil {
+		result = map[string]any{"status": "error"}
+	}
+	if _, found := result["status"]; !found {
+		result["status"] = "completed"
+	}
+
+	// (a Go plugin's entries can be typed, where the JSON from a binary's aren't)
+	entries, _ := result["entries"].([]any)
+	if typed, ok := result["entries"].([]map[string]any); ok {
+		for _, object := range typed {
+			entries = append(entries, object)
+		}
+	}
+	delete(result, "entries")
+	for i, child := range entries {
+		object, ok := child.(map[string]any)
+		activity, _ := object["activity"].(string)
+		if !ok || !containsString(KnownActivities, activity) {
+			fmt.Printf("Error: entry %d of action %s has an unknown activity '%v'\n", i + 1, action.Name(), object["activity"])
+			continue
+		}
+		delete(object, "activity")
+		entry := newChildLogEntry(parent, activity)
+		if err := applyActionResult(entry, object); err != nil {
+			fmt.Printf("Error: entry %d of action %s: %v\n", i + 1, action.Name(), err)
+			continue
+		}
+		writeLogEntry(activityLog, entry)
+		response.entries++
+	}
+
+	if err := applyActionResult(parent, result); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		parent.status = "error"
+		parent.details = escapeRawText(err.Error())
+	}
+	parent.method = escapeRawText(action.Name())
+	response.status = parent.status
+	return response
+}
+
+// Sets the columns of the entry from an action's result, which can only set the ActionResultColumns (and only to statuses that are
+// logged, so the log still verifies)
+func applyActionResult(entry *ActivityLogEntry, result map[string]any) error {
+	for column, value := range result {
+		if !containsString(ActionResultColumns, column) {
+			return fmt.Errorf("invalid action result: unknown column '%s' (must be one of %v)", column, ActionResultColumns)
+		}
+		text, number := "", 0
+		switch value := value.(type) {
+		case string:
+			text = value
+			number, _ = strconv.Atoi(value)
+		case float64:
+			text, number = strconv.Itoa(int(value)), int(value)
+		case int:
+			text, number = strconv.Itoa(value), value
+		case nil:
+		default:
+			return fmt.Errorf("invalid action result: column '%s' must be a string or a number", column)
+		}
+		if containsString(NumericColumns, column) && text != "" && strconv.Itoa(number) != strings.TrimSpace(text) {
+			return fmt.Errorf("invalid action result: column '%s' must be a whole number", column)
+		}
+
+		switch column {
+		case "status":
+			if !containsString(KnownStatuses, text) && !processStatePattern.MatchString(text) {
+				return fmt.Errorf("invalid action result: unknown status '%s'", text)
+			}
+			entry.status = text
+		case "path":
+			entry.path = escapeRawText(text)
+		case "method":
+			entry.method = escapeRawText(text)
+		case "sourceAddr":
+			entry.sourceAddr = escapeRawText(text)
+		case "sourcePort":
+			entry.sourcePort = number
+		case "destAddr":
+			entry.destAddr = escapeRawText(text)
+		case "destPort":
+			entry.destPort = number
+		case "bytesSent":
+			entry.bytesSent = number
+		case "protocol":
+			entry.protocol = escapeRawText(text)
+		case "bytesReceived":
+			entry.bytesReceived = number
+		case "details":
+			entry.details = escapeRawText(text)
+		}
+	}
+	return nil
+}
+
+// Parses action's arguments: (name|list) [args...], where the args are passed to the action as they are
+func parseActionArgs(args []string) (string, []string, error) {
+	if len(args) < 1 {
+		return "", nil, fmt.Errorf("not enough arguments for action! Args: %v", args)
+	}
+	return args[0], args[1:], nil
+}
@@ -0,0 +1,28 @@
+//go:build (linux || darwin) && cgo
+
+package main
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// Whether custom actions can be loaded from Go plugins (only on Linux and Mac, built with cgo)
+const PluginActionsSupported = true
+
+// Loads the Action a Go plugin exports (as a variable named Action, whose type has Action's methods)
+func loadPluginAction(path string) (Action, error) {
+	loaded, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := loaded.Lookup("Action")
+	if err != nil {
+		return nil, err
+	}
+	action, ok := symbol.(Action)
+	if !ok {
+		return nil, fmt.Errorf("the plugin %s's Action is a %T, which doesn't have the methods of an Action (Name and Run)", path, symbol)
+	}
+	return action, nil
+}
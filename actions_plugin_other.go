@@ -0,0 +1,16 @@
+//go:build !(linux || darwin) || !cgo
+
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Whether custom actions can be loaded from Go plugins (only on Linux and Mac, built with cgo)
+const PluginActionsSupported = false
+
+// Go plugins are only supported on Linux and Mac, in builds with cgo
+func loadPluginAction(path string) (Action, error) {
+	return nil, fmt.Errorf("%w: Go plugins need noisemaker to be built with cgo, on linux or darwin (declare the action's path to a binary instead)", errors.ErrUnsupported)
+}
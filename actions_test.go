@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes an -actions file declaring shell script actions (by name) in a temp dir, returning its path
+func writeTestActions(t *testing.T, scripts map[string]string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test actions are shell scripts")
+	}
+	dir := t.TempDir()
+	declarations := "actions:\n"
+	for name, script := range scripts {
+		path := dir + "/" + name + ".sh"
+		assert.Nil(t, os.WriteFile(path, []byte("#!/bin/sh\n" + script), 0755))
+		declarations += "  - name: " + name + "\n    description: the " + name + " action\n    path: " + path + "\n    args: [\"--quiet\"]\n"
+	}
+	actionsFilePath := dir + "/actions.yaml"
+	assert.Nil(t, os.WriteFile(actionsFilePath, []byte(declarations), 0644))
+	return actionsFilePath
+}
+
+func TestMain_Action(t *testing.T) {
+	actionsFilePath := writeTestActions(t, map[string]string{
+		"checkin": "echo \"args: $1 request: $(cat)\" >&2\n" +
+			"echo '{\"status\": \"sent\", \"destAddr\": \"10.0.0.5\", \"details\": \"checked in\", \"entries\": [{\"activity\": \"send\", \"status\": \"sent\", \"destAddr\": \"10.0.0.5\", \"destPort\": 443, \"bytesSent\": 120}]}'\n",
+		"broken": "echo 'oops' >&2\nexit 3\n",
+		"badcolumn": "echo '{\"color\": \"red\"}'\n",
+		"defaults": "echo '{}'\n",
+	})
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-actions=" + actionsFilePath, "action", "checkin", "fast"})
+	assert.Contains(t, output, "args: --quiet request: {")
+	assert.Contains(t, output, "\"action\":\"checkin\",\"args\":[\"fast\"]")
+	assert.Contains(t, output, "\"correlationId\":\"" + activityLogEntry.correlationId + "\"")
+	assert.Equal(t, "action", activityLogEntry.activity)
+	assert.Equal(t, "checkin", activityLogEntry.method)
+	assert.Equal(t, "sent", activityLogEntry.status)
+	assert.Equal(t, "10.0.0.5", activityLogEntry.destAddr)
+	assert.Equal(t, "checked in", activityLogEntry.details)
+	assertLogFileContains(t, logFilePath, ",send,")
+	assertLogFileContains(t, logFilePath, ",10.0.0.5,443,120,")
+	assertLogFileContains(t, logFilePath, ",action,")
+
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-actions=" + actionsFilePath, "action", "broken"})
+	assert.Contains(t, output, "oops")
+	assert.Equal(t, "exit status 3", activityLogEntry.status)
+	assert.Equal(t, "broken", activityLogEntry.method)
+
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-actions=" + actionsFilePath, "action", "badcolumn"})
+	assert.Equal(t, "error", activityLogEntry.status)
+	assert.Contains(t, activityLogEntry.details, "unknown column 'color'")
+
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-actions=" + actionsFilePath, "action", "defaults"})
+	assert.Equal(t, "completed", activityLogEntry.status)
+
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-actions=" + actionsFilePath, "action", "list"})
+	assert.Contains(t, output, "checkin: the checkin action (runs ")
+	assert.Equal(t, "list", activityLogEntry.method)
+	assert.Equal(t, "4 actions", activityLogEntry.details)
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "-actions=" + actionsFilePath, "action", "missing"}, "unknown action 'missing' (declare it in the -actions file)")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "action"}, "not enough arguments for action!")
+}
+
+func TestLoadActions(t *testing.T) {
+	actions, err := loadActions("")
+	assert.Nil(t, err)
+	assert.Empty(t, actions)
+
+	dir := t.TempDir()
+	for contents, message := range map[string]string{
+		"actions:\n  - description: nameless\n    path: /bin/true\n": "action 1 needs a name (besides list)",
+		"actions:\n  - name: list\n    path: /bin/true\n": "action 1 needs a name (besides list)",
+		"actions:\n  - name: twice\n    path: /bin/true\n  - name: twice\n    path: /bin/true\n": "action twice is declared more than once",
+		"actions:\n  - name: neither\n": "action neither needs either a path or a plugin",
+		"actions:\n  - name: both\n    path: /bin/true\n    plugin: both.so\n": "action both needs either a path or a plugin",
+		"actions: [": "invalid -actions file",
+	} {
+		path := dir + "/actions.yaml"
+		assert.Nil(t, os.WriteFile(path, []byte(contents), 0644))
+		_, err := loadActions(path)
+		assert.ErrorContains(t, err, message)
+	}
+
+	if !PluginActionsSupported {
+		assert.Nil(t, os.WriteFile(dir + "/actions.yaml", []byte("actions:\n  - name: plugin\n    plugin: plugin.so\n"), 0644))
+		_, err := loadActions(dir + "/actions.yaml")
+		assert.ErrorContains(t, err, "unable to load action plugin")
+	}
+}
+
+func TestApplyActionResult(t *testing.T) {
+	entry := new(ActivityLogEntry)
+	assert.Nil(t, applyActionResult(entry, map[string]any{"status": "exit status 1", "destPort": 8080.0, "bytesSent": "42", "path": "a,b"}))
+	assert.Equal(t, "exit status 1", entry.status)
+	assert.Equal(t, 8080, entry.destPort)
+	assert.Equal(t, 42, entry.bytesSent)
+	assert.Equal(t, "a\\,b", entry.path)
+
+	assert.ErrorContains(t, applyActionResult(entry, map[string]any{"status": "pwned"}), "unknown status 'pwned'")
+	assert.ErrorContains(t, applyActionResult(entry, map[string]any{"runId": "other"}), "unknown column 'runId'")
+	assert.ErrorContains(t, applyActionResult(entry, map[string]any{"destPort": "https"}), "column 'destPort' must be a whole number")
+	assert.ErrorContains(t, applyActionResult(entry, map[string]any{"details": []any{"a"}}), "column 'details' must be a string or a number")
+}
@@ -0,0 +1,529 @@
+// The activity log, as protobuf (for typed interop with collectors written in other languages).
+// Regenerate activity_log.pb.go and activity_log_grpc.pb.go with `go generate` after changing this file.
+//
+// Fields map one-to-one onto the columns of the CSV activity log (see HeaderStr), with their raw (unescaped) values.
+// New columns get new field numbers at the end; never renumber or reuse a field.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: activitylogpb/activity_log.proto
+
+package activitylogpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// A single activity log entry
+type ActivityLogEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Activity      string                 `protobuf:"bytes,2,opt,name=activity,proto3" json:"activity,omitempty"`
+	Os            string                 `protobuf:"bytes,3,opt,name=os,proto3" json:"os,omitempty"`
+	Username      string                 `protobuf:"bytes,4,opt,name=username,proto3" json:"username,omitempty"`
+	ProcessName   string                 `protobuf:"bytes,5,opt,name=process_name,json=processName,proto3" json:"process_name,omitempty"`
+	ProcessCmd    string                 `protobuf:"bytes,6,opt,name=process_cmd,json=processCmd,proto3" json:"process_cmd,omitempty"`
+	Pid           int64                  `protobuf:"varint,7,opt,name=pid,proto3" json:"pid,omitempty"`
+	Path          string                 `protobuf:"bytes,8,opt,name=path,proto3" json:"path,omitempty"`
+	Status        string                 `protobuf:"bytes,9,opt,name=status,proto3" json:"status,omitempty"`
+	Method        string                 `protobuf:"bytes,10,opt,name=method,proto3" json:"method,omitempty"`
+	SourceAddr    string                 `protobuf:"bytes,11,opt,name=source_addr,json=sourceAddr,proto3" json:"source_addr,omitempty"`
+	SourcePort    int64                  `protobuf:"varint,12,opt,name=source_port,json=sourcePort,proto3" json:"source_port,omitempty"`
+	DestAddr      string                 `protobuf:"bytes,13,opt,name=dest_addr,json=destAddr,proto3" json:"dest_addr,omitempty"`
+	DestPort      int64                  `protobuf:"varint,14,opt,name=dest_port,json=destPort,proto3" json:"dest_port,omitempty"`
+	BytesSent     int64                  `protobuf:"varint,15,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"`
+	Protocol      string                 `protobuf:"bytes,16,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	Attempt       int64                  `protobuf:"varint,17,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	BytesReceived int64                  `protobuf:"varint,18,opt,name=bytes_received,json=bytesReceived,proto3" json:"bytes_received,omitempty"`
+	Details       string                 `protobuf:"bytes,19,opt,name=details,proto3" json:"details,omitempty"`
+	CorrelationId string                 `protobuf:"bytes,20,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	RunId         string                 `protobuf:"bytes,21,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	Seq           int64                  `protobuf:"varint,22,opt,name=seq,proto3" json:"seq,omitempty"`
+	Hostname      string                 `protobuf:"bytes,23,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	HostIps       []string               `protobuf:"bytes,24,rep,name=host_ips,json=hostIps,proto3" json:"host_ips,omitempty"` // IPv4 first
+	MachineId     string                 `protobuf:"bytes,25,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"`
+	Note          string                 `protobuf:"bytes,26,opt,name=note,proto3" json:"note,omitempty"`
+	Labels        []*Label               `protobuf:"bytes,27,rep,name=labels,proto3" json:"labels,omitempty"`       // in the order they were given
+	Signature     string                 `protobuf:"bytes,28,opt,name=signature,proto3" json:"signature,omitempty"` // with -sign-key, as <algorithm>:<schema version>:<base64>
+	Elevated      string                 `protobuf:"bytes,29,opt,name=elevated,proto3" json:"elevated,omitempty"`   // "true" or "false" (or empty, in entries from before it was recorded)
+	DnsTime       int64                  `protobuf:"varint,30,opt,name=dns_time,json=dnsTime,proto3" json:"dns_time,omitempty"`          // http and https sends only, in milliseconds
+	TlsVersion    string                 `protobuf:"bytes,31,opt,name=tls_version,json=tlsVersion,proto3" json:"tls_version,omitempty"` // https sends only, ie. "TLS 1.3"
+	TlsCipher     string                 `protobuf:"bytes,32,opt,name=tls_cipher,json=tlsCipher,proto3" json:"tls_cipher,omitempty"`    // https sends only, ie. "TLS_AES_128_GCM_SHA256"
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ActivityLogEntry) Reset() {
+	*x = ActivityLogEntry{}
+	mi := &file_activitylogpb_activity_log_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ActivityLogEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ActivityLogEntry) ProtoMessage() {}
+
+func (x *ActivityLogEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_activitylogpb_activity_log_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ActivityLogEntry.ProtoReflect.Descriptor instead.
+func (*ActivityLogEntry) Descriptor() ([]byte, []int) {
+	return file_activitylogpb_activity_log_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ActivityLogEntry) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *ActivityLogEntry) GetActivity() string {
+	if x != nil {
+		return x.Activity
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetProcessName() string {
+	if x != nil {
+		return x.ProcessName
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetProcessCmd() string {
+	if x != nil {
+		return x.ProcessCmd
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetPid() int64 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *ActivityLogEntry) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetSourceAddr() string {
+	if x != nil {
+		return x.SourceAddr
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetSourcePort() int64 {
+	if x != nil {
+		return x.SourcePort
+	}
+	return 0
+}
+
+func (x *ActivityLogEntry) GetDestAddr() string {
+	if x != nil {
+		return x.DestAddr
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetDestPort() int64 {
+	if x != nil {
+		return x.DestPort
+	}
+	return 0
+}
+
+func (x *ActivityLogEntry) GetBytesSent() int64 {
+	if x != nil {
+		return x.BytesSent
+	}
+	return 0
+}
+
+func (x *ActivityLogEntry) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetAttempt() int64 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *ActivityLogEntry) GetBytesReceived() int64 {
+	if x != nil {
+		return x.BytesReceived
+	}
+	return 0
+}
+
+func (x *ActivityLogEntry) GetDetails() string {
+	if x != nil {
+		return x.Details
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetRunId() string {
+	if x != nil {
+		return x.RunId
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ActivityLogEntry) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetHostIps() []string {
+	if x != nil {
+		return x.HostIps
+	}
+	return nil
+}
+
+func (x *ActivityLogEntry) GetMachineId() string {
+	if x != nil {
+		return x.MachineId
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetNote() string {
+	if x != nil {
+		return x.Note
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetLabels() []*Label {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *ActivityLogEntry) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetElevated() string {
+	if x != nil {
+		return x.Elevated
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetDnsTime() int64 {
+	if x != nil {
+		return x.DnsTime
+	}
+	return 0
+}
+
+func (x *ActivityLogEntry) GetTlsVersion() string {
+	if x != nil {
+		return x.TlsVersion
+	}
+	return ""
+}
+
+func (x *ActivityLogEntry) GetTlsCipher() string {
+	if x != nil {
+		return x.TlsCipher
+	}
+	return ""
+}
+
+// One of the operator's key=value labels for a run
+type Label struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Label) Reset() {
+	*x = Label{}
+	mi := &file_activitylogpb_activity_log_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Label) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Label) ProtoMessage() {}
+
+func (x *Label) ProtoReflect() protoreflect.Message {
+	mi := &file_activitylogpb_activity_log_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Label.ProtoReflect.Descriptor instead.
+func (*Label) Descriptor() ([]byte, []int) {
+	return file_activitylogpb_activity_log_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Label) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Label) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+// The collector's reply, once a stream of entries is finished
+type StreamEntriesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Received      int64                  `protobuf:"varint,1,opt,name=received,proto3" json:"received,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEntriesResponse) Reset() {
+	*x = StreamEntriesResponse{}
+	mi := &file_activitylogpb_activity_log_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEntriesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEntriesResponse) ProtoMessage() {}
+
+func (x *StreamEntriesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_activitylogpb_activity_log_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEntriesResponse.ProtoReflect.Descriptor instead.
+func (*StreamEntriesResponse) Descriptor() ([]byte, []int) {
+	return file_activitylogpb_activity_log_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StreamEntriesResponse) GetReceived() int64 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+var File_activitylogpb_activity_log_proto protoreflect.FileDescriptor
+
+const file_activitylogpb_activity_log_proto_rawDesc = "" +
+	"\n" +
+	" activitylogpb/activity_log.proto\x12\rnoisemaker.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xbd\x07\n" +
+	"\x10ActivityLogEntry\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1a\n" +
+	"\bactivity\x18\x02 \x01(\tR\bactivity\x12\x0e\n" +
+	"\x02os\x18\x03 \x01(\tR\x02os\x12\x1a\n" +
+	"\busername\x18\x04 \x01(\tR\busername\x12!\n" +
+	"\fprocess_name\x18\x05 \x01(\tR\vprocessName\x12\x1f\n" +
+	"\vprocess_cmd\x18\x06 \x01(\tR\n" +
+	"processCmd\x12\x10\n" +
+	"\x03pid\x18\a \x01(\x03R\x03pid\x12\x12\n" +
+	"\x04path\x18\b \x01(\tR\x04path\x12\x16\n" +
+	"\x06status\x18\t \x01(\tR\x06status\x12\x16\n" +
+	"\x06method\x18\n" +
+	" \x01(\tR\x06method\x12\x1f\n" +
+	"\vsource_addr\x18\v \x01(\tR\n" +
+	"sourceAddr\x12\x1f\n" +
+	"\vsource_port\x18\f \x01(\x03R\n" +
+	"sourcePort\x12\x1b\n" +
+	"\tdest_addr\x18\r \x01(\tR\bdestAddr\x12\x1b\n" +
+	"\tdest_port\x18\x0e \x01(\x03R\bdestPort\x12\x1d\n" +
+	"\n" +
+	"bytes_sent\x18\x0f \x01(\x03R\tbytesSent\x12\x1a\n" +
+	"\bprotocol\x18\x10 \x01(\tR\bprotocol\x12\x18\n" +
+	"\aattempt\x18\x11 \x01(\x03R\aattempt\x12%\n" +
+	"\x0ebytes_received\x18\x12 \x01(\x03R\rbytesReceived\x12\x18\n" +
+	"\adetails\x18\x13 \x01(\tR\adetails\x12%\n" +
+	"\x0ecorrelation_id\x18\x14 \x01(\tR\rcorrelationId\x12\x15\n" +
+	"\x06run_id\x18\x15 \x01(\tR\x05runId\x12\x10\n" +
+	"\x03seq\x18\x16 \x01(\x03R\x03seq\x12\x1a\n" +
+	"\bhostname\x18\x17 \x01(\tR\bhostname\x12\x19\n" +
+	"\bhost_ips\x18\x18 \x03(\tR\ahostIps\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x19 \x01(\tR\tmachineId\x12\x12\n" +
+	"\x04note\x18\x1a \x01(\tR\x04note\x12,\n" +
+	"\x06labels\x18\x1b \x03(\v2\x14.noisemaker.v1.LabelR\x06labels\x12\x1c\n" +
+	"\tsignature\x18\x1c \x01(\tR\tsignature\x12\x1a\n" +
+	"\belevated\x18\x1d \x01(\tR\belevated\x12\x19\n" +
+	"\bdns_time\x18\x1e \x01(\x03R\adnsTime\x12\x1f\n" +
+	"\vtls_version\x18\x1f \x01(\tR\n" +
+	"tlsVersion\x12\x1d\n" +
+	"\n" +
+	"tls_cipher\x18  \x01(\tR\ttlsCipher\"/\n" +
+	"\x05Label\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"3\n" +
+	"\x15StreamEntriesResponse\x12\x1a\n" +
+	"\breceived\x18\x01 \x01(\x03R\breceived2n\n" +
+	"\x12ActivityLogService\x12X\n" +
+	"\rStreamEntries\x12\x1f.noisemaker.v1.ActivityLogEntry\x1a$.noisemaker.v1.StreamEntriesResponse(\x01B\x1fZ\x1dnoisemaker/main/activitylogpbb\x06proto3"
+
+var (
+	file_activitylogpb_activity_log_proto_rawDescOnce sync.Once
+	file_activitylogpb_activity_log_proto_rawDescData []byte
+)
+
+func file_activitylogpb_activity_log_proto_rawDescGZIP() []byte {
+	file_activitylogpb_activity_log_proto_rawDescOnce.Do(func() {
+		file_activitylogpb_activity_log_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_activitylogpb_activity_log_proto_rawDesc), len(file_activitylogpb_activity_log_proto_rawDesc)))
+	})
+	return file_activitylogpb_activity_log_proto_rawDescData
+}
+
+var file_activitylogpb_activity_log_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_activitylogpb_activity_log_proto_goTypes = []any{
+	(*ActivityLogEntry)(nil),      // 0: noisemaker.v1.ActivityLogEntry
+	(*Label)(nil),                 // 1: noisemaker.v1.Label
+	(*StreamEntriesResponse)(nil), // 2: noisemaker.v1.StreamEntriesResponse
+	(*timestamppb.Timestamp)(nil), // 3: google.protobuf.Timestamp
+}
+var file_activitylogpb_activity_log_proto_depIdxs = []int32{
+	3, // 0: noisemaker.v1.ActivityLogEntry.timestamp:type_name -> google.protobuf.Timestamp
+	1, // 1: noisemaker.v1.ActivityLogEntry.labels:type_name -> noisemaker.v1.Label
+	0, // 2: noisemaker.v1.ActivityLogService.StreamEntries:input_type -> noisemaker.v1.ActivityLogEntry
+	2, // 3: noisemaker.v1.ActivityLogService.StreamEntries:output_type -> noisemaker.v1.StreamEntriesResponse
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_activitylogpb_activity_log_proto_init() }
+func file_activitylogpb_activity_log_proto_init() {
+	if File_activitylogpb_activity_log_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_activitylogpb_activity_log_proto_rawDesc), len(file_activitylogpb_activity_log_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_activitylogpb_activity_log_proto_goTypes,
+		DependencyIndexes: file_activitylogpb_activity_log_proto_depIdxs,
+		MessageInfos:      file_activitylogpb_activity_log_proto_msgTypes,
+	}.Build()
+	File_activitylogpb_activity_log_proto = out.File
+	file_activitylogpb_activity_log_proto_goTypes = nil
+	file_activitylogpb_activity_log_proto_depIdxs = nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Something a run left on the system (a file it created, or an account it added), and the command that removes it. It's recorded in
+// the artifact manifest when it's made, and recorded again (as removed) once it's gone.
+type Artifact struct {
+	Timestamp			string			`json:"timestamp"`
+	RunId				string			`json:"run_id"`
+	Kind				string			`json:"kind"`				// file, user, or group
+	Target				string			`json:"target"`				// the file's path, or the account's name
+	Undo				[]string		`json:"undo"`				// the command that removes it, ie. ["delete", "/tmp/dropped.txt"]
+	Removed				bool			`json:"removed,omitempty"`
+}
+
+// Response data from undoing artifacts (by cleanup, or a shutdown with -cleanup)
+type ArtifactsResponse struct {
+	artifacts			int
+	removed				int
+	failed				int
+	status				string
+}
+
+// Guards the artifacts and the manifest, since commands can be run from several goroutines
+var artifactsMutex sync.Mutex
+
+// The artifacts made so far in this run that are still there, in the order they were made
+var runArtifacts = []*Artifact{}
+
+// The artifact manifest every artifact's recorded in (by default, next to the activity log), or none, if it's empty
+var artifactManifestPath = ""
+
+// The statuses an undo command can finish with for its artifact to be gone
+var ArtifactRemovedStatuses = []string{"deleted", "not_found", "removed"}
+
+// Records that the entry's command made an artifact, which the undo command removes
+func trackArtifact(entry *ActivityLogEntry, kind string, target string, undo ...string) {
+	artifactsMutex.Lock()
+	defer artifactsMutex.Unlock()
+	artifact := &Artifact{Timestamp: time.Now().Format(time.RFC3339), RunId: unescapeRawText(entry.runId), Kind: kind, Target: target, Undo: undo}
+	runArtifacts = append(runArtifacts, artifact)
+	appendArtifactManifest(artifact)
+}
+
+// Records that an artifact made earlier in this run is gone, once the run's run its undo command itself (ie. deleted the file it created)
+func untrackArtifact(undo ...string) {
+	artifactsMutex.Lock()
+	defer artifactsMutex.Unlock()
+	for i := len(runArtifacts) - 1; i >= 0; i-- {
+		if slices.Equal(runArtifacts[i].Undo, undo) {
+			removed := *runArtifacts[i]
+			removed.Timestamp = time.Now().Format(time.RFC3339)
+			removed.Removed = true
+			appendArtifactManifest(&removed)
+			runArtifacts = append(runArtifacts[:i], runArtifacts[i + 1:]...)
+			return
+		}
+	}
+}
+
+// Appends the artifact to the manifest (a failure to is reported, but doesn't stop the command that made it)
+func appendArtifactManifest(artifact *Artifact) {
+	if artifactManifestPath == "" {
+		return
+	}
+	contents, err := json.Marshal(artifact)
+	if err == nil {
+		var manifest *os.File
+		manifest, err = os.OpenFile(artifactManifestPath, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = manifest.Write(append(contents, '\n'))
+			manifest.Close()
+		}
+	}
+	if err != nil {
+		fmt.Printf("Couldn't record artifact %s in manifest %s: %v\n", artifact.Target, artifactManifestPath, err)
+	}
+}
+
+// Reads the artifacts in the manifest that are still there (made, and not since removed), from the run with runId (or every run, if
+// it's empty), in the order they were made
+func readArtifactManifest(path string, runId string) ([]*Artifact, error) {
+	manifest, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer manifest.Close()
+
+	artifacts := []*Artifact{}
+	scanner := bufio.NewScanner(manifest)
+	scanner.Buffer(make([]byte, 64 * 1024), 16 * 1024 * 1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		artifact := new(Artifact)
+		err = json.Unmarshal(scanner.Bytes(), artifact)
+		if err != nil || len(artifact.Undo) == 0 {
+			return nil, fmt.Errorf("invalid artifact manifest %s: line %d isn't an artifact", path, line)
+		}
+		if runId != "" && artifact.RunId != runId {
+			continue
+		}
+		if !artifact.Removed {
+			artifacts = append(artifacts, artifact)
+			continue
+		}
+		for i := len(artifacts) - 1; i >= 0; i-- {
+			if artifacts[i].RunId == artifact.RunId && slices.Equal(artifacts[i].Undo, artifact.Undo) {
+				artifacts = append(artifacts[:i], artifacts[i + 1:]...)
+				break
+			}
+		}
+	}
+	return artifacts, scanner.Err()
+}
+
+// Gets the artifacts made in the run with runId that are still there: from the manifest (so ones made before the run was resumed are
+// included), or from the ones made since this process started, if there's no manifest
+func getRunArtifacts(runId string) ([]*Artifact, error) {
+	if artifactManifestPath == "" {
+		artifactsMutex.Lock()
+		defer artifactsMutex.Unlock()
+		artifacts := []*Artifact{}
+		for _, artifact := range runArtifacts {
+			if artifact.RunId == runId {
+				artifacts = append(artifacts, artifact)
+			}
+		}
+		return artifacts, nil
+	}
+	artifacts, err := readArtifactManifest(artifactManifestPath, runId)
+	if os.IsNotExist(err) {
+		return []*Artifact{}, nil
+	}
+	return artifacts, err
+}
+
+// Removes each of the artifacts (most recent first) with its undo command, as part of the parent's run, logging each as its own entry
+// (with a <label>=true label, ie. cleanup=true), and recording in the manifest each one that's gone
+func undoArtifacts(activityLog Sink, parent *ActivityLogEntry, artifacts []*Artifact, label string) *ArtifactsResponse {
+	response := &ArtifactsResponse{artifacts: len(artifacts)}
+	for i := len(artifacts) - 1; i >= 0; i-- {
+		artifact := artifacts[i]
+		command, args := artifact.Undo[0], artifact.Undo[1:]
+		fmt.Printf("Cleaning up %s %s (from run %s): %s\n", artifact.Kind, artifact.Target, artifact.RunId, strings.Join(artifact.Undo, " "))
+		entry := newChildLogEntry(parent, command)
+		entry.processCmd = escapeCommandString(command, args)
+		entry.labels = addLabel(entry.labels, label, "true")
+		err := runCommandSafely(activityLog, entry, command, args)
+		if err != nil || !containsString(ArtifactRemovedStatuses, entry.status) {
+			fmt.Printf("Couldn't clean up %s %s: %s\n", artifact.Kind, artifact.Target, entry.status)
+			response.failed++
+			continue
+		}
+		removed := *artifact
+		removed.Timestamp = time.Now().Format(time.RFC3339)
+		removed.Removed = true
+		artifactsMutex.Lock()
+		appendArtifactManifest(&removed)
+		runArtifacts = slices.DeleteFunc(runArtifacts, func(made *Artifact) bool {
+			return made.RunId == artifact.RunId && slices.Equal(made.Undo, artifact.Undo)
+		})
+		artifactsMutex.Unlock()
+		response.removed++
+	}
+
+	if response.failed == 0 {
+		response.status = "completed"
+	} else if response.removed > 0 {
+		response.status = "partial"
+	} else {
+		response.status = "error"
+	}
+	return response
+}
+
+// Options for the cleanup command
+type CleanupOptions struct {
+	path				string
+	runId				string
+}
+
+// Parses cleanup's arguments: [--run-id=id] [manifest] (by default, the -manifest path)
+func parseCleanupOptions(args []string) (*CleanupOptions, error) {
+	flags := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	runId := flags.String("run-id", "", "only removes the artifacts made in the run with this ID (default every run)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cleanup: %v", err)
+	}
+	options := &CleanupOptions{path: artifactManifestPath, runId: *runId}
+	if flags.NArg() > 0 {
+		options.path = flags.Arg(0)
+	}
+	return options, nil
+}
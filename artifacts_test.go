@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Cleanup(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: leftovers
+steps:
+  - command: create
+    foreach: [a, b, c]
+    args: ["` + dir + `/${item}.txt"]
+  - command: delete
+    args: ["` + dir + `/c.txt"]
+`), 0644)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=run-a", "playbook", playbookPath})
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=run-b", "create", dir + "/d.txt"})
+
+	// Every artifact's recorded in the manifest next to the log (and the one the run deleted itself, as removed)
+	artifacts, err := readArtifactManifest(dir + "/noisemaker-artifacts.jsonl", "")
+	assert.Nil(t, err)
+	assert.Len(t, artifacts, 3)
+	assert.Equal(t, "run-a", artifacts[0].RunId)
+	assert.Equal(t, "file", artifacts[0].Kind)
+	assert.Equal(t, dir + "/a.txt", artifacts[0].Target)
+	assert.Equal(t, []string{"delete", dir + "/a.txt"}, artifacts[0].Undo)
+
+	// Only the run's artifacts are removed, and one that's already gone counts as removed
+	os.Remove(dir + "/b.txt")
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=cleanup-run", "cleanup", "--run-id=run-a"})
+	assert.Contains(t, output, "Cleaning up file " + dir + "/b.txt (from run run-a): delete " + dir + "/b.txt")
+	assert.Equal(t, activityLogEntry.activity, "cleanup")
+	assert.Equal(t, activityLogEntry.path, dir + "/noisemaker-artifacts.jsonl")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "2 of 2 artifacts removed\\, 0 failed")
+	assert.False(t, fileExists(dir + "/a.txt"))
+	assert.True(t, fileExists(dir + "/d.txt"))
+	assertLogFileContains(t, logFilePath, ",delete,")
+	assertLogFileContains(t, logFilePath, ",cleanup=true,")
+
+	// Then everything else, and then there's nothing left
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "cleanup"})
+	assert.Equal(t, activityLogEntry.details, "1 of 1 artifacts removed\\, 0 failed")
+	assert.False(t, fileExists(dir + "/d.txt"))
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "cleanup"})
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "0 of 0 artifacts removed\\, 0 failed")
+}
+
+func TestMain_Cleanup_Manifest(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := dir + "/artifacts.jsonl"
+	callMain([]string{"./noisemaker", "-sink=stdout", "-manifest=" + manifestPath, "create", dir + "/dropped.txt"})
+	assert.True(t, fileExists(manifestPath))
+
+	// The manifest can be given instead, and there's nothing to do without one
+	callMain([]string{"./noisemaker", "-sink=stdout", "cleanup", dir + "/missing.jsonl"})
+	assert.Equal(t, activityLogEntry.details, "0 of 0 artifacts removed\\, 0 failed")
+	callMain([]string{"./noisemaker", "-sink=stdout", "cleanup", manifestPath})
+	assert.Equal(t, activityLogEntry.details, "1 of 1 artifacts removed\\, 0 failed")
+	assert.False(t, fileExists(dir + "/dropped.txt"))
+
+	os.WriteFile(manifestPath, []byte("{\"kind\": \"file\"}\n"), 0600)
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "cleanup", manifestPath}, "invalid artifact manifest " + manifestPath + ": line 1 isn't an artifact")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "cleanup", "--since=1h"}, "invalid cleanup: flag provided but not defined: -since")
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// The schemes sends can authenticate with
+var AuthSchemes = []string{"basic", "digest", "ntlm"}
+
+// With -auth, the credentials sends authenticate with (nil, without it)
+var sendAuth *SendAuth = nil
+
+// The credentials to authenticate sends with, and the scheme to use
+type SendAuth struct {
+	scheme				string
+	domain				string		// ntlm only (from DOMAIN\user)
+	username			string
+	password			string
+}
+
+// Parses -auth's (scheme):(user):(password) (the password can have colons in it, and an ntlm user can be given as DOMAIN\user), or
+// returns nil without it
+func parseSendAuth(text string) (*SendAuth, error) {
+	if text == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(text, ":", 3)
+	if len(parts) != 3 || !containsString(AuthSchemes, strings.ToLower(parts[0])) || parts[1] == "" {
+		return nil, fmt.Errorf("invalid -auth (must be (scheme):(user):(password), where the scheme is one of %v)", AuthSchemes)
+	}
+	auth := &SendAuth{scheme: strings.ToLower(parts[0]), username: parts[1], password: parts[2]}
+	if domain, username, found := strings.Cut(auth.username, `\`); found && auth.scheme == "ntlm" {
+		auth.domain, auth.username = domain, username
+	}
+	return auth, nil
+}
+
+// Describes the scheme and user (never the password), ie. "ntlm as CORP\alice"
+func (auth *SendAuth) String() string {
+	if auth.domain != "" {
+		return auth.scheme + " as " + auth.domain + `\` + auth.username
+	}
+	return auth.scheme + " as " + auth.username
+}
+
+// Makes the request with the credentials: basic sends them with it, and digest and ntlm first make the request without a body to be
+// challenged (which, for ntlm, negotiates over the same connection), then make it again with the body, answering the challenge. A
+// server that doesn't challenge is sent the body without credentials. Returns the last request and response, and what was done.
+func doAuthenticatedRequest(client *http.Client, auth *SendAuth, newRequest func(body string) (*http.Request, error), body string) (*http.Request, *http.Response, string, error) {
+	if auth.scheme == "basic" {
+		req, err := newRequest(body)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		req.SetBasicAuth(auth.username, auth.password)
+		resp, err := client.Do(req)
+		return req, resp, "auth " + auth.String(), err
+	}
+
+	// Be challenged...
+	req, err := newRequest("")
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if auth.scheme == "ntlm" {
+		req.Header.Set("Authorization", "NTLM " + base64.StdEncoding.EncodeToString(newNTLMNegotiateMessage()))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return req, nil, "", err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	challenge := getAuthChallenge(resp, auth.scheme)
+	req, err = newRequest(body)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if resp.StatusCode != http.StatusUnauthorized || challenge == "" {
+		fmt.Printf("Not challenged for %s auth (got %s), sending without it\n", auth.scheme, resp.Status)
+		resp, err = client.Do(req)
+		return req, resp, "auth " + auth.String() + ", not challenged", err
+	}
+
+	// ...and answer it
+	var authorization string
+	if auth.scheme == "digest" {
+		authorization, err = getDigestAuthorization(auth, req.Method, req.URL.RequestURI(), challenge)
+	} else {
+		authorization, err = getNTLMAuthorization(auth, challenge)
+	}
+	if err != nil {
+		return req, nil, "", err
+	}
+	req.Header.Set("Authorization", authorization)
+	fmt.Printf("Answering the %s challenge as %s...\n", auth.scheme, auth.username)
+	resp, err = client.Do(req)
+	return req, resp, "auth " + auth.String(), err
+}
+
+// Gets the scheme's challenge from the response's WWW-Authenticate headers (without the scheme), or nothing if it wasn't offered
+func getAuthChallenge(resp *http.Response, scheme string) string {
+	for _, header := range resp.Header.Values("WWW-Authenticate") {
+		name, challenge, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if strings.EqualFold(name, scheme) {
+			// (a bare "NTLM" only says it's supported, and carries no challenge)
+			return strings.TrimSpace(challenge)
+		}
+	}
+	return ""
+}
+
+// Parses a challenge's comma-separated name=value (or name="value") parameters
+func parseAuthParams(challenge string) map[string]string {
+	params := map[string]string{}
+	for challenge != "" {
+		var name, value string
+		name, challenge, _ = strings.Cut(challenge, "=")
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), ",")))
+		challenge = strings.TrimSpace(challenge)
+		if strings.HasPrefix(challenge, `"`) {
+			end := strings.Index(challenge[1:], `"`)
+			if end < 0 {
+				value, challenge = challenge[1:], ""
+			} else {
+				value, challenge = challenge[1:end + 1], challenge[end + 2:]
+			}
+		} else {
+			value, challenge, _ = strings.Cut(challenge, ",")
+			value = strings.TrimSpace(value)
+		}
+		if name != "" {
+			params[name] = value
+		}
+	}
+	return params
+}
+
+// Gets the Authorization header answering a digest challenge (RFC 7616), with MD5 or SHA-256 (and their -sess variants), and qop=auth
+// if the server offers it
+func getDigestAuthorization(auth *SendAuth, method string, uri string, challenge string) (string, error) {
+	params := parseAuthParams(challenge)
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %s", algorithm)
+	}
+	digest := func(text string) string {
+		h := newHash()
+		h.Write([]byte(text))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	cnonce := make([]byte, 8)
+	rand.Read(cnonce)
+	clientNonce := hex.EncodeToString(cnonce)
+	nonceCount := "00000001"
+	ha1 := digest(auth.username + ":" + params["realm"] + ":" + auth.password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = digest(ha1 + ":" + params["nonce"] + ":" + clientNonce)
+	}
+	ha2 := digest(method + ":" + uri)
+	qop := ""
+	for _, offered := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(offered) == "auth" {
+			qop = "auth"
+		}
+	}
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, auth.username),
+		fmt.Sprintf(`realm="%s"`, params["realm"]),
+		fmt.Sprintf(`nonce="%s"`, params["nonce"]),
+		fmt.Sprintf(`uri="%s"`, uri),
+		"algorithm=" + algorithm,
+	}
+	if qop != "" {
+		fields = append(fields, `response="` + digest(ha1 + ":" + params["nonce"] + ":" + nonceCount + ":" + clientNonce + ":" + qop + ":" + ha2) + `"`, "qop=" + qop, "nc=" + nonceCount, `cnonce="` + clientNonce + `"`)
+	} else {
+		fields = append(fields, `response="` + digest(ha1 + ":" + params["nonce"] + ":" + ha2) + `"`)
+	}
+	if opaque, found := params["opaque"]; found {
+		fields = append(fields, `opaque="` + opaque + `"`)
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+// The NTLM negotiate flags sent: Unicode, OEM, request target, NTLM, always sign, extended session security, target info, 128-bit, and 56-bit
+const NTLMNegotiateFlags = 0xa0888207
+
+// Gets an NTLM negotiate (type 1) message, without a domain or workstation
+func newNTLMNegotiateMessage() []byte {
+	message := make([]byte, 32)
+	copy(message, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(message[8:], 1)
+	binary.LittleEndian.PutUint32(message[12:], NTLMNegotiateFlags)
+	return message
+}
+
+// Gets the Authorization header answering an NTLM challenge (type 2) message with an NTLMv2 authenticate (type 3) message
+func getNTLMAuthorization(auth *SendAuth, challenge string) (string, error) {
+	message, err := base64.StdEncoding.DecodeString(challenge)
+	if err != nil || len(message) < 48 || !bytes.HasPrefix(message, []byte("NTLMSSP\x00")) || binary.LittleEndian.Uint32(message[8:]) != 2 {
+		return "", fmt.Errorf("invalid NTLM challenge")
+	}
+	serverChallenge := message[24:32]
+	targetInfo, err := getNTLMSecurityBuffer(message, 40)
+	if err != nil {
+		return "", err
+	}
+	clientChallenge := make([]byte, 8)
+	rand.Read(clientChallenge)
+	lmResponse, ntResponse := getNTLMv2Responses(auth, serverChallenge, clientChallenge, time.Now(), targetInfo)
+	return "NTLM " + base64.StdEncoding.EncodeToString(newNTLMAuthenticateMessage(auth, lmResponse, ntResponse, binary.LittleEndian.Uint32(message[20:]))), nil
+}
+
+// Reads the NTLM security buffer (its length, and its offset in the message) at the offset
+func getNTLMSecurityBuffer(message []byte, offset int) ([]byte, error) {
+	length := int(binary.LittleEndian.Uint16(message[offset:]))
+	start := int(binary.LittleEndian.Uint32(message[offset + 4:]))
+	if start + length > len(message) {
+		return nil, fmt.Errorf("invalid NTLM challenge")
+	}
+	return message[start:start + length], nil
+}
+
+// Encodes the text as UTF-16 (little-endian), as NTLM does
+func encodeUTF16LE(text string) []byte {
+	encoded := []byte{}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		encoded = append(encoded, byte(unit), byte(unit >> 8))
+	}
+	return encoded
+}
+
+// Gets NTOWFv2, the key NTLMv2's responses are made with, from the password's NT hash, and the uppercased user and the domain
+func getNTOWFv2(password string, username string, domain string) []byte {
+	ntHash := md4.New()
+	ntHash.Write(encodeUTF16LE(password))
+	mac := hmac.New(md5.New, ntHash.Sum(nil))
+	mac.Write(encodeUTF16LE(strings.ToUpper(username) + domain))
+	return mac.Sum(nil)
+}
+
+// Gets the LMv2 and NTLMv2 responses to the server's challenge (MS-NLMP 3.3.2)
+func getNTLMv2Responses(auth *SendAuth, serverChallenge []byte, clientChallenge []byte, timestamp time.Time, targetInfo []byte) ([]byte, []byte) {
+	key := getNTOWFv2(auth.password, auth.username, auth.domain)
+	hmacMD5 := func(parts ...[]byte) []byte {
+		mac := hmac.New(md5.New, key)
+		for _, part := range parts {
+			mac.Write(part)
+		}
+		return mac.Sum(nil)
+	}
+
+	// (the timestamp's in 100ns intervals since 1601, as a Windows FILETIME is)
+	temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	temp = binary.LittleEndian.AppendUint64(temp, uint64(timestamp.UnixNano() / 100 + 116444736000000000))
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+	ntProof := hmacMD5(serverChallenge, temp)
+	return append(hmacMD5(serverChallenge, clientChallenge), clientChallenge...), append(ntProof, temp...)
+}
+
+// Gets an NTLM authenticate (type 3) message with the responses, for the user and domain (without a workstation or session key)
+func newNTLMAuthenticateMessage(auth *SendAuth, lmResponse []byte, ntResponse []byte, flags uint32) []byte {
+	message := make([]byte, 64)
+	copy(message, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(message[8:], 3)
+	// (the LM and NT responses, domain, user, workstation, and session key's security buffers, each pointing into the payload after them)
+	for i, field := range [][]byte{lmResponse, ntResponse, encodeUTF16LE(auth.domain), encodeUTF16LE(auth.username), {}, {}} {
+		offset := 12 + i * 8
+		binary.LittleEndian.PutUint16(message[offset:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(message[offset + 2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(message[offset + 4:], uint32(len(message)))
+		message = append(message, field...)
+	}
+	binary.LittleEndian.PutUint32(message[60:], flags & NTLMNegotiateFlags)
+	return message
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Send_Auth_Basic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "alice" || password != "pa:ss" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	// The scheme and user are logged, but never the password
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "-auth=basic:alice:pa:ss", "send", "GET", host, port})
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.details, "auth basic as alice (200 OK)")
+	assert.NotContains(t, output, "pa:ss")
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "-auth=basic:alice:wrong", "send", "GET", host, port})
+	assert.Equal(t, activityLogEntry.details, "auth basic as alice (401 Unauthorized)")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-auth=kerberos:alice:pass", "send", "GET", host, port}, "invalid -auth (must be (scheme):(user):(password), where the scheme is one of [basic digest ntlm])")
+}
+
+func TestMain_Send_Auth_Digest(t *testing.T) {
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Digest ") {
+			w.Header().Set("WWW-Authenticate", `Digest realm="noisemaker", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", qop="auth,auth-int", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// (checked the way the server would, from the password it knows)
+		params := parseAuthParams(strings.TrimPrefix(authorization, "Digest "))
+		md5Hex := func(text string) string {
+			sum := md5.Sum([]byte(text))
+			return hex.EncodeToString(sum[:])
+		}
+		ha1 := md5Hex("alice:noisemaker:Circle Of Life")
+		ha2 := md5Hex(r.Method + ":" + r.URL.RequestURI())
+		expected := md5Hex(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" + params["cnonce"] + ":" + params["qop"] + ":" + ha2)
+		if params["response"] != expected || params["opaque"] != "5ccc069c403ebaf9f0171e9517f40e41" || params["uri"] != "/upload" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	// It's challenged without the body, then sends it with the answer
+	callMain([]string{"./noisemaker", "-sink=stdout", "-auth=digest:alice:Circle Of Life", "send", "POST", host + "/upload", port, "http", "payload"})
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.details, "auth digest as alice (200 OK)")
+	// (both requests count, the one that was challenged as well as the answer)
+	assert.Greater(t, activityLogEntry.bytesSent, len("payload"))
+	assert.Equal(t, []string{"", "payload"}, bodies)
+}
+
+func TestMain_Send_Auth_NTLM(t *testing.T) {
+	serverChallenge := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	targetInfo := append(append([]byte{2, 0, 8, 0}, encodeUTF16LE("CORP")...), 0, 0, 0, 0)
+	remoteAddrs := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddrs = append(remoteAddrs, r.RemoteAddr)
+		message, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(r.Header.Get("Authorization"), "NTLM "))
+		switch {
+		case len(message) >= 12 && binary.LittleEndian.Uint32(message[8:]) == 1:
+			// Challenge the negotiate message
+			challenge := make([]byte, 48)
+			copy(challenge, "NTLMSSP\x00")
+			binary.LittleEndian.PutUint32(challenge[8:], 2)
+			binary.LittleEndian.PutUint32(challenge[20:], NTLMNegotiateFlags)
+			copy(challenge[24:], serverChallenge)
+			binary.LittleEndian.PutUint16(challenge[40:], uint16(len(targetInfo)))
+			binary.LittleEndian.PutUint16(challenge[42:], uint16(len(targetInfo)))
+			binary.LittleEndian.PutUint32(challenge[44:], 48)
+			w.Header().Set("WWW-Authenticate", "NTLM " + base64.StdEncoding.EncodeToString(append(challenge, targetInfo...)))
+			w.WriteHeader(http.StatusUnauthorized)
+		case len(message) >= 64 && binary.LittleEndian.Uint32(message[8:]) == 3:
+			// Check the authenticate message's NTLMv2 response, from the password the server knows
+			ntResponse, _ := getNTLMSecurityBuffer(message, 20)
+			domain, _ := getNTLMSecurityBuffer(message, 28)
+			user, _ := getNTLMSecurityBuffer(message, 36)
+			mac := hmac.New(md5.New, getNTOWFv2("Passw0rd", "alice", "CORP"))
+			mac.Write(serverChallenge)
+			mac.Write(ntResponse[16:])
+			if !bytes.Equal(domain, encodeUTF16LE("CORP")) || !bytes.Equal(user, encodeUTF16LE("alice")) || !hmac.Equal(mac.Sum(nil), ntResponse[:16]) || !bytes.Contains(ntResponse, targetInfo) {
+				w.WriteHeader(http.StatusForbidden)
+			}
+		default:
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	// The handshake's made over a single connection
+	callMain([]string{"./noisemaker", "-sink=stdout", `-auth=ntlm:CORP\alice:Passw0rd`, "send", "GET", host, port})
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.details, "auth ntlm as CORP\\\\alice (200 OK)")
+	assert.Len(t, remoteAddrs, 2)
+	assert.Equal(t, remoteAddrs[0], remoteAddrs[1])
+
+	callMain([]string{"./noisemaker", "-sink=stdout", `-auth=ntlm:CORP\alice:wrong`, "send", "GET", host, port})
+	assert.Equal(t, activityLogEntry.details, "auth ntlm as CORP\\\\alice (403 Forbidden)")
+}
+
+func TestMain_Send_Auth_NotChallenged(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "-auth=digest:alice:pass", "send", "GET", host, port})
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.details, "auth digest as alice\\, not challenged (200 OK)")
+}
+
+func TestGetNTOWFv2(t *testing.T) {
+	// (MS-NLMP 4.2.4.1.1)
+	assert.Equal(t, "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(getNTOWFv2("Password", "User", "Domain")))
+}
+
+func TestParseAuthParams(t *testing.T) {
+	assert.Equal(t, map[string]string{"realm": "a, b", "nonce": "n", "algorithm": "SHA-256", "qop": "auth"}, parseAuthParams(`realm="a, b", nonce="n",algorithm=SHA-256, qop="auth"`))
+}
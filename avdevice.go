@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+)
+
+// The devices avdevice can open
+var AVDevices = []string{"microphone", "camera"}
+
+// Response data from avdevice action
+type AVDeviceResponse struct {
+	device				string		// the device that was opened (its name, or its path)
+	api					string		// what it was opened with
+	status				string
+}
+
+// Parses avdevice's arguments: (microphone|camera)
+func parseAVDeviceArgs(args []string) (string, error) {
+	if len(args) < 1 {
+		return "", fmt.Errorf("not enough arguments for avdevice! Args: %v", args)
+	}
+	if !containsString(AVDevices, args[0]) {
+		return "", fmt.Errorf("invalid avdevice: invalid device %s (must be one of %v)", args[0], AVDevices)
+	}
+	return args[0], nil
+}
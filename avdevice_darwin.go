@@ -0,0 +1,68 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework AVFoundation -framework Foundation
+#import <AVFoundation/AVFoundation.h>
+
+// Opens the default device for the media type as a capture session's input, and stops the session again at once, getting the
+// device's name: 0 if it was opened, 1 if there's none, 2 if access to it isn't allowed, and 3 for anything else
+static int noisemakerOpenDevice(int camera, char *name, int size) {
+	@autoreleasepool {
+		AVCaptureDevice *device = [AVCaptureDevice defaultDeviceWithMediaType:(camera ? AVMediaTypeVideo : AVMediaTypeAudio)];
+		if (device == nil) {
+			return 1;
+		}
+		strlcpy(name, [[device localizedName] UTF8String], size);
+		NSError *error = nil;
+		AVCaptureDeviceInput *input = [AVCaptureDeviceInput deviceInputWithDevice:device error:&error];
+		if (input == nil) {
+			return error.code == AVErrorApplicationIsNotAuthorizedToUseDevice ? 2 : 3;
+		}
+		AVCaptureSession *session = [[AVCaptureSession alloc] init];
+		if ([session canAddInput:input]) {
+			[session addInput:input];
+		}
+		[session startRunning];
+		[session stopRunning];
+		[session release];
+		return 0;
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// Opens (and immediately closes) the default device with AVFoundation, as a capture session's input, which is started and stopped
+// again without anything being read from it
+func openAVDevice(kind string) (*AVDeviceResponse, error) {
+	response := &AVDeviceResponse{api: "AVCaptureDeviceInput"}
+	camera := C.int(0)
+	if kind == "camera" {
+		camera = 1
+	}
+	name := make([]byte, 256)
+	fmt.Printf("Opening the default %s...\n", kind)
+	result := C.noisemakerOpenDevice(camera, (*C.char)(unsafe.Pointer(&name[0])), C.int(len(name)))
+	response.device = C.GoString((*C.char)(unsafe.Pointer(&name[0])))
+	switch result {
+	case 0:
+		response.status = "opened"
+		return response, nil
+	case 1:
+		response.status = "not_found"
+		return response, fmt.Errorf("no %s found", kind)
+	case 2:
+		response.status = "no_access"
+		return response, fmt.Errorf("AVCaptureDeviceInput: %w (noisemaker needs %s access)", os.ErrPermission, kind)
+	}
+	response.status = "error"
+	return response, fmt.Errorf("AVCaptureDeviceInput: unable to open %s", response.device)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// The device files for each device, the first of which is opened: ALSA's capture devices, and Video4Linux's
+var AVDevicePatterns = map[string]string{
+	"microphone": "/dev/snd/pcmC*D*c",
+	"camera": "/dev/video*",
+}
+
+// Opens (and immediately closes) the first device file for the device, read-only and without blocking, so nothing's captured
+func openAVDevice(kind string) (*AVDeviceResponse, error) {
+	response := &AVDeviceResponse{api: "open"}
+	paths, _ := filepath.Glob(AVDevicePatterns[kind])
+	if len(paths) == 0 {
+		response.status = "not_found"
+		return response, fmt.Errorf("no %s device found (%s)", kind, AVDevicePatterns[kind])
+	}
+	response.device = paths[0]
+	fmt.Printf("Opening %s device %s...\n", kind, response.device)
+	f, err := os.OpenFile(response.device, os.O_RDONLY | syscall.O_NONBLOCK, 0)
+	if err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	f.Close()
+	response.status = "opened"
+	return response, nil
+}
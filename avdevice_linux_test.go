@@ -0,0 +1,21 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAVDevice_Linux(t *testing.T) {
+	for _, kind := range AVDevices {
+		callMain([]string{"./noisemaker", "-sink=stdout", "avdevice", kind})
+		paths, _ := filepath.Glob(AVDevicePatterns[kind])
+		if len(paths) == 0 {
+			assert.Equal(t, activityLogEntry.status, "not_found")
+		} else {
+			assert.Equal(t, activityLogEntry.path, paths[0])
+		}
+		assert.Equal(t, activityLogEntry.details, "opened with open")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows && !linux && (!darwin || !cgo)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// Devices are opened with waveIn and Video for Windows on Windows, AVFoundation on Mac (which needs cgo), and their device files on Linux
+func openAVDevice(kind string) (*AVDeviceResponse, error) {
+	if runtime.GOOS == "darwin" {
+		return &AVDeviceResponse{status: "unsupported"}, fmt.Errorf("%w: avdevice needs noisemaker to be built with cgo (CGO_ENABLED=1)", errors.ErrUnsupported)
+	}
+	return &AVDeviceResponse{status: "unsupported"}, fmt.Errorf("%w: avdevice on %s", errors.ErrUnsupported, runtime.GOOS)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_AVDevice(t *testing.T) {
+	for _, kind := range AVDevices {
+		callMain([]string{"./noisemaker", "-sink=stdout", "avdevice", kind})
+		assert.Equal(t, activityLogEntry.activity, "avdevice")
+		assert.Equal(t, activityLogEntry.method, kind)
+		// (whether there's a device, and whether it can be opened, depends on the host)
+		assert.Contains(t, []string{"opened", "not_found", "no_access", "unsupported", "error"}, activityLogEntry.status)
+	}
+}
+
+func TestParseAVDeviceArgs(t *testing.T) {
+	kind, err := parseAVDeviceArgs([]string{"camera"})
+	assert.Nil(t, err)
+	assert.Equal(t, "camera", kind)
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "avdevice", "speaker"}, "invalid avdevice: invalid device speaker (must be one of [microphone camera])")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "avdevice"}, "not enough arguments for avdevice! Args: []")
+}
@@ -0,0 +1,99 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// (waveIn and Video for Windows' capture window aren't wrapped by x/sys/windows)
+var winmm = windows.NewLazySystemDLL("winmm.dll")
+var procWaveInOpen = winmm.NewProc("waveInOpen")
+var procWaveInClose = winmm.NewProc("waveInClose")
+var avicap32 = windows.NewLazySystemDLL("avicap32.dll")
+var procCapCreateCaptureWindowW = avicap32.NewProc("capCreateCaptureWindowW")
+var procCapGetDriverDescriptionW = avicap32.NewProc("capGetDriverDescriptionW")
+var procSendMessageW = user32.NewProc("SendMessageW")
+var procDestroyWindow = user32.NewProc("DestroyWindow")
+
+const (
+	waveMapper				= 0xFFFFFFFF
+	mmsyserrBadDeviceID		= 2
+	mmsyserrNoDriver		= 6
+	wmCapDriverConnect		= 0x400 + 10
+	wmCapDriverDisconnect	= 0x400 + 11
+)
+
+// The WAVEFORMATEX waveInOpen takes
+type waveFormatEx struct {
+	wFormatTag			uint16
+	nChannels			uint16
+	nSamplesPerSec		uint32
+	nAvgBytesPerSec		uint32
+	nBlockAlign			uint16
+	wBitsPerSample		uint16
+	cbSize				uint16
+}
+
+// Opens (and immediately closes) the default device: the microphone with waveInOpen (through the wave mapper), and the camera by
+// connecting a Video for Windows capture window to its driver, neither of which captures anything until it's started
+func openAVDevice(kind string) (*AVDeviceResponse, error) {
+	if kind == "microphone" {
+		return openMicrophone()
+	}
+	return openCamera()
+}
+
+func openMicrophone() (*AVDeviceResponse, error) {
+	response := &AVDeviceResponse{device: "default (wave mapper)", api: "waveInOpen"}
+	format := &waveFormatEx{wFormatTag: 1, nChannels: 1, nSamplesPerSec: 44100, nAvgBytesPerSec: 88200, nBlockAlign: 2, wBitsPerSample: 16}
+	var handle uintptr
+	fmt.Printf("Opening the default microphone...\n")
+	result, _, _ := procWaveInOpen.Call(uintptr(unsafe.Pointer(&handle)), waveMapper, uintptr(unsafe.Pointer(format)), 0, 0, 0)
+	switch result {
+	case 0:
+		procWaveInClose.Call(handle)
+		response.status = "opened"
+		return response, nil
+	case mmsyserrBadDeviceID, mmsyserrNoDriver:
+		response.status = "not_found"
+		return response, fmt.Errorf("waveInOpen: no microphone found (MMRESULT %d)", result)
+	}
+	response.status = "error"
+	return response, fmt.Errorf("waveInOpen: MMRESULT %d", result)
+}
+
+func openCamera() (*AVDeviceResponse, error) {
+	response := &AVDeviceResponse{api: "capDriverConnect"}
+	name := make([]uint16, 80)
+	version := make([]uint16, 80)
+	found, _, _ := procCapGetDriverDescriptionW.Call(0, uintptr(unsafe.Pointer(&name[0])), uintptr(len(name)), uintptr(unsafe.Pointer(&version[0])), uintptr(len(version)))
+	if found == 0 {
+		response.status = "not_found"
+		return response, fmt.Errorf("no camera driver found")
+	}
+	response.device = windows.UTF16ToString(name)
+
+	// (the capture window's never shown)
+	title, _ := windows.UTF16PtrFromString("noisemaker")
+	window, _, err := procCapCreateCaptureWindowW.Call(uintptr(unsafe.Pointer(title)), 0, 0, 0, 0, 0, 0, 0)
+	if window == 0 {
+		response.status = "error"
+		return response, fmt.Errorf("capCreateCaptureWindow: %v", err)
+	}
+	defer procDestroyWindow.Call(window)
+	fmt.Printf("Opening camera %s...\n", response.device)
+	connected, _, _ := procSendMessageW.Call(window, wmCapDriverConnect, 0, 0)
+	if connected == 0 {
+		// (it's refused when the camera's in use, or camera access is turned off in the privacy settings)
+		response.status = "no_access"
+		return response, fmt.Errorf("capDriverConnect: %w", os.ErrPermission)
+	}
+	procSendMessageW.Call(window, wmCapDriverDisconnect, 0, 0)
+	response.status = "opened"
+	return response, nil
+}
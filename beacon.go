@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The characters beacon pads payloads with (so the padding looks like the encoded data real beacons carry)
+const BeaconPaddingChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// Options for the beacon command
+type BeaconOptions struct {
+	count				int
+	sleep				time.Duration	// how long to sleep between transmissions, on average
+	jitter				float64			// how far each sleep can vary from it, as a fraction of it (0 to 1)
+	pad					int				// the size to pad each payload to (a multiple of it, if it's bigger), or 0 not to
+	seed				int64
+	method				string
+	destAddrs			[]string		// rotated through, one per transmission
+	destPort			int
+	protocol			string
+	data				string
+}
+
+// Response data from beacon action
+type BeaconResponse struct {
+	sent				int
+	failed				int
+	bytesSent			int
+	bytesReceived		int
+	status				string
+}
+
+// Parses beacon's arguments: [-count=n] [-sleep=duration] [-jitter=fraction] [-pad=bytes] [-seed=n] (method) (destaddrs) [destport]
+// [protocol] [body], where (destaddrs) is a comma-separated list of hosts
+func parseBeaconOptions(args []string) (*BeaconOptions, error) {
+	flags := flag.NewFlagSet("beacon", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	count := flags.Int("count", 3, "how many transmissions to make")
+	sleep := flags.Duration("sleep", 10 * time.Second, "how long to sleep between transmissions, on average")
+	jitter := flags.Float64("jitter", 0, "how far each sleep can vary, as a fraction of -sleep")
+	pad := flags.Int("pad", 0, "the size to pad each payload to")
+	seed := flags.Int64("seed", 0, "the random seed, for the same sleeps and padding again (default random)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid beacon: %v", err)
+	}
+	if flags.NArg() < 2 {
+		return nil, fmt.Errorf("not enough arguments for beacon! Args: %v", args)
+	}
+	if *count < 1 {
+		return nil, fmt.Errorf("invalid beacon: invalid -count %d (must be at least 1)", *count)
+	}
+	if *sleep < 0 {
+		return nil, fmt.Errorf("invalid beacon: invalid -sleep %v", *sleep)
+	}
+	if *jitter < 0 || *jitter > 1 {
+		return nil, fmt.Errorf("invalid beacon: invalid -jitter %v (must be between 0.0 and 1.0)", *jitter)
+	}
+	if *pad < 0 {
+		return nil, fmt.Errorf("invalid beacon: invalid -pad %d", *pad)
+	}
+
+	options := &BeaconOptions{count: *count, sleep: *sleep, jitter: *jitter, pad: *pad, seed: *seed, method: flags.Arg(0), destPort: 80, protocol: "http"}
+	if options.seed == 0 {
+		options.seed = time.Now().UnixNano()
+	}
+	for _, destAddr := range strings.Split(flags.Arg(1), ",") {
+		if destAddr = strings.TrimSpace(destAddr); destAddr != "" {
+			options.destAddrs = append(options.destAddrs, destAddr)
+		}
+	}
+	if len(options.destAddrs) == 0 {
+		return nil, fmt.Errorf("invalid beacon: no destaddrs in '%s'", flags.Arg(1))
+	}
+	if flags.NArg() > 2 {
+		options.destPort, err = strconv.Atoi(flags.Arg(2))
+		if err != nil {
+			return nil, fmt.Errorf("invalid beacon: invalid destport %s", flags.Arg(2))
+		}
+	}
+	if flags.NArg() > 3 {
+		options.protocol = flags.Arg(3)
+	}
+	if flags.NArg() > 4 {
+		options.data = flags.Arg(4)
+	}
+	return options, nil
+}
+
+// Gets how long to sleep before the next transmission: the sleep, varied by up to the jitter (as a fraction of it) either way
+func getBeaconSleep(random *rand.Rand, sleep time.Duration, jitter float64) time.Duration {
+	return sleep + time.Duration((random.Float64() * 2 - 1) * jitter * float64(sleep))
+}
+
+// Gets the padding that brings a payload of the given length up to the pad size (or the next multiple of it, if it's already bigger)
+func getBeaconPadding(random *rand.Rand, length int, pad int) string {
+	if pad <= 0 {
+		return ""
+	}
+	size := pad
+	if length > pad {
+		size = (length + pad - 1) / pad * pad
+	}
+	padding := make([]byte, size - length)
+	for i := range padding {
+		padding[i] = BeaconPaddingChars[random.Intn(len(BeaconPaddingChars))]
+	}
+	return string(padding)
+}
+
+// Makes each of the beacon's transmissions, to each of its hosts in turn, sleeping (with jitter) in between, and padding each payload.
+// Each transmission is logged as its own send activity, sharing the parent's correlation ID, with what it slept and was padded to.
+func runBeacon(activityLog Sink, parent *ActivityLogEntry, options *BeaconOptions, failRate float64) *BeaconResponse {
+	response := new(BeaconResponse)
+	random := rand.New(rand.NewSource(options.seed))
+	var lastStatus string
+	for i := 0; i < options.count; i++ {
+		var slept time.Duration
+		if i > 0 {
+			slept = getBeaconSleep(random, options.sleep, options.jitter)
+			fmt.Printf("Sleeping %v...\n", slept)
+			scheduleSleep(slept)
+		}
+		if isRunCancelled() {
+			break
+		}
+		destAddr := options.destAddrs[i % len(options.destAddrs)]
+		data := options.data + getBeaconPadding(random, len(options.data), options.pad)
+
+		entry := newChildLogEntry(parent, "send")
+		entry.method = options.method
+		entry.destAddr = destAddr
+		entry.destPort = options.destPort
+		entry.protocol = options.protocol
+		fmt.Printf("Beacon %d of %d: sending %d bytes of data to %s %s (port %d) using protocol %s...\n", i + 1, options.count, len(data), options.method, destAddr, options.destPort, options.protocol)
+		messageResponse, err := sendMessageWithFailureRate(options.method, destAddr, options.destPort, options.protocol, nil, data, failRate)
+		if err != nil {
+			fmt.Printf("Beacon %d failed: %v\n", i + 1, err)
+			entry.status = messageResponse.status
+			response.failed++
+		} else {
+			entry.status = "sent"
+			response.sent++
+		}
+		lastStatus = entry.status
+		entry.path = escapeRawText(messageResponse.path)
+		entry.sourceAddr = messageResponse.sourceAddr
+		entry.sourcePort = messageResponse.sourcePort
+		recordSendConnection(entry, messageResponse)
+		entry.bytesSent = messageResponse.bytesSent
+		entry.bytesReceived = messageResponse.bytesReceived
+		details := fmt.Sprintf("beacon %d of %d, slept %v, payload %d bytes (%d padding)", i + 1, options.count, slept.Round(time.Millisecond), len(data), len(data) - len(options.data))
+		if sendDetails := getSendDetails(messageResponse); sendDetails != "" {
+			details += ", " + sendDetails
+		}
+		entry.details = escapeRawText(details)
+		writeLogEntry(activityLog, entry)
+		response.bytesSent += messageResponse.bytesSent
+		response.bytesReceived += messageResponse.bytesReceived
+	}
+
+	switch {
+	case response.failed == 0:
+		response.status = "sent"
+	case response.sent == 0:
+		response.status = lastStatus
+	default:
+		response.status = "partial"
+	}
+	return response
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Beacon(t *testing.T) {
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+	_, port := getTestServerHostAndPort(t, server)
+	useTestScheduleClock(t, time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC))
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Each transmission goes to the next host in turn, padded to the same size
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "beacon", "-count=3", "-sleep=10m", "-jitter=0.5", "-pad=64", "-seed=7", "POST", "127.0.0.1,localhost", port, "http", "checkin"})
+	assert.Equal(t, activityLogEntry.activity, "beacon")
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.destAddr, "127.0.0.1\\,localhost")
+	assert.Equal(t, activityLogEntry.details, "3 of 3 sent\\, sleep 10m0s\\, jitter 0.5\\, pad 64\\, seed 7")
+	assert.Len(t, bodies, 3)
+	for _, body := range bodies {
+		assert.Len(t, body, 64)
+		assert.True(t, strings.HasPrefix(body, "checkin"))
+	}
+
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 4)
+	for i, destAddr := range []string{"127.0.0.1", "localhost", "127.0.0.1"} {
+		send := parsedLog.entries[i]
+		assert.Equal(t, "send", send.activity)
+		assert.Equal(t, "sent", send.status)
+		// (the host it was given is kept in the path, with the address it resolved to as the destAddr)
+		assert.Equal(t, "http://" + destAddr + ":" + port, send.path)
+		assert.Equal(t, "127.0.0.1", send.destAddr)
+		assert.Equal(t, activityLogEntry.correlationId, send.correlationId)
+		assert.Contains(t, send.details, "payload 64 bytes (57 padding)")
+	}
+	assert.True(t, strings.HasPrefix(parsedLog.entries[0].details, "beacon 1 of 3\\, slept 0s\\, "))
+	assert.NotContains(t, parsedLog.entries[1].details, "slept 0s")
+}
+
+func TestGetBeaconSleep(t *testing.T) {
+	// Sleeps vary by up to the jitter either way (and not at all without it)
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		sleep := getBeaconSleep(random, time.Hour, 0.25)
+		assert.GreaterOrEqual(t, sleep, 45 * time.Minute)
+		assert.LessOrEqual(t, sleep, 75 * time.Minute)
+	}
+	assert.Equal(t, time.Hour, getBeaconSleep(random, time.Hour, 0))
+}
+
+func TestGetBeaconPadding(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	assert.Len(t, getBeaconPadding(random, 10, 256), 246)
+	assert.Len(t, getBeaconPadding(random, 300, 256), 212)
+	assert.Len(t, getBeaconPadding(random, 256, 256), 0)
+	assert.Equal(t, "", getBeaconPadding(random, 10, 0))
+}
+
+func TestParseBeaconOptions(t *testing.T) {
+	options, err := parseBeaconOptions([]string{"-seed=3", "GET", "a.example.com, b.example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, &BeaconOptions{count: 3, sleep: 10 * time.Second, seed: 3, method: "GET", destAddrs: []string{"a.example.com", "b.example.com"}, destPort: 80, protocol: "http"}, options)
+
+	_, err = parseBeaconOptions([]string{"-jitter=1.5", "GET", "a.example.com"})
+	assert.ErrorContains(t, err, "invalid beacon: invalid -jitter 1.5 (must be between 0.0 and 1.0)")
+	_, err = parseBeaconOptions([]string{"GET", ","})
+	assert.ErrorContains(t, err, "invalid beacon: no destaddrs in ','")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "beacon", "GET"}, "not enough arguments for beacon! Args: [GET]")
+}
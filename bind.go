@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The IP versions the network commands can connect over, by -ip-version ("auto" for whichever the destination resolves to)
+var IPVersions = []string{"4", "6", "auto"}
+
+// The local address the network commands' outbound connections are bound to, by -source-ip or -interface (nil for whichever the
+// OS picks)
+var sourceIP net.IP
+
+// The IP version the network commands' outbound connections are made over, by -ip-version
+var ipVersion = "auto"
+
+// Gets the network to dial (or look up) for the IP version, ie. tcp as tcp6 with -ip-version=6 (and as itself with auto)
+func getIPNetwork(network string) string {
+	if ipVersion == "auto" {
+		return network
+	}
+	return strings.TrimRight(network, "46") + ipVersion
+}
+
+// Determines whether the address is of the IP version
+func isIPVersion(ip net.IP, version string) bool {
+	switch version {
+	case "4":
+		return ip.To4() != nil
+	case "6":
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// Works out the address to bind outbound connections to: the -source-ip (which has to be one of this host's, and of the IP version),
+// or the first address of the -interface of the IP version (IPv4 before IPv6, with auto), or nil for neither
+func resolveSourceIP(address string, interfaceName string, version string) (net.IP, error) {
+	if !containsString(IPVersions, version) {
+		return nil, fmt.Errorf("invalid -ip-version %s (must be one of %s)", version, strings.Join(IPVersions, ", "))
+	}
+	if address != "" && interfaceName != "" {
+		return nil, fmt.Errorf("invalid -source-ip and -interface: only one can be given")
+	}
+	if interfaceName != "" {
+		netInterface, err := net.InterfaceByName(interfaceName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -interface %s: %v", interfaceName, err)
+		}
+		addrs, err := netInterface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("invalid -interface %s: %v", interfaceName, err)
+		}
+		var found net.IP
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() || !isIPVersion(ipNet.IP, version) {
+				continue
+			}
+			if ipNet.IP.To4() != nil {
+				return ipNet.IP, nil
+			} else if found == nil {
+				found = ipNet.IP
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("invalid -interface %s: it has no addresses to bind to (with -ip-version=%s)", interfaceName, version)
+		}
+		return found, nil
+	}
+	if address == "" {
+		return nil, nil
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid -source-ip %s", address)
+	} else if !isIPVersion(ip, version) {
+		return nil, fmt.Errorf("invalid -source-ip %s: it isn't an IPv%s address", address, version)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid -source-ip %s: it isn't one of this host's addresses", address)
+}
+
+// Gets a dialer whose connections are bound to the source address (if there is one)
+func newSourceDialer(timeout time.Duration) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if sourceIP != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: sourceIP}
+	}
+	return dialer
+}
+
+// Gets an HTTP transport (with the TLS config, if there is one) whose connections are bound to the source address, over the IP version,
+// and made and reused the way the HTTP client options say
+func newSourceTransport(tlsConfig *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	httpClientOptions.apply(transport)
+	dialer := newSourceDialer(httpClientOptions.dialTimeout)
+	transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, getIPNetwork(network), address)
+		if err != nil {
+			return nil, err
+		}
+		return &countingConn{Conn: conn}, nil
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport
+}
+
+// Gets the HTTP client the network commands' requests are made with, shared by the whole run (see newSourceTransport)
+func getSourceHTTPClient() *http.Client {
+	sourceHTTPClientMutex.Lock()
+	defer sourceHTTPClientMutex.Unlock()
+	if sourceHTTPClient == nil {
+		sourceHTTPClient = &http.Client{Transport: newSourceTransport(nil)}
+	}
+	return sourceHTTPClient
+}
+
+// Gets the resolver the network commands' lookups are made with, whose queries are sent from the source address (if there is one)
+func getSourceResolver() *net.Resolver {
+	if sourceIP == nil {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			dialer := &net.Dialer{}
+			if network == "udp" || network == "udp4" || network == "udp6" {
+				dialer.LocalAddr = &net.UDPAddr{IP: sourceIP}
+			} else {
+				dialer.LocalAddr = &net.TCPAddr{IP: sourceIP}
+			}
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
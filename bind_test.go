@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Gets the name of the loopback interface
+func getTestLoopbackInterface(t *testing.T) string {
+	interfaces, err := net.Interfaces()
+	assert.Nil(t, err)
+	for _, netInterface := range interfaces {
+		if netInterface.Flags & net.FlagLoopback != 0 {
+			return netInterface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestMain_Send_SourceIP(t *testing.T) {
+	clientAddr := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientAddr, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}))
+	defer server.Close()
+	_, port := getTestServerHostAndPort(t, server)
+
+	// The connection's made from the source address, and it's recorded
+	callMain([]string{"./noisemaker", "-sink=stdout", "-source-ip=127.0.0.1", "-labels=phase=1", "send", "GET", "127.0.0.1", port})
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.sourceAddr, "127.0.0.1")
+	assert.Equal(t, activityLogEntry.labels, "phase=1;source-ip=127.0.0.1")
+	assert.Equal(t, "127.0.0.1", clientAddr)
+
+	// (and nothing's bound by the next run)
+	callMain([]string{"./noisemaker", "-sink=stdout", "send", "GET", "127.0.0.1", port})
+	assert.Nil(t, sourceIP)
+	assert.Equal(t, activityLogEntry.labels, "")
+}
+
+func TestMain_Scan_Interface(t *testing.T) {
+	loopback := getTestLoopbackInterface(t)
+	callMain([]string{"./noisemaker", "-sink=stdout", "-interface=" + loopback, "scan", "127.0.0.1", "1"})
+	assert.Equal(t, activityLogEntry.labels, "interface=" + loopback + ";source-ip=127.0.0.1")
+}
+
+func TestResolveSourceIP(t *testing.T) {
+	ip, err := resolveSourceIP("", "", "auto")
+	assert.Nil(t, err)
+	assert.Nil(t, ip)
+	ip, err = resolveSourceIP("127.0.0.1", "", "auto")
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1", ip.String())
+
+	_, err = resolveSourceIP("192.0.2.123", "", "auto")
+	assert.ErrorContains(t, err, "invalid -source-ip 192.0.2.123: it isn't one of this host's addresses")
+	_, err = resolveSourceIP("not-an-ip", "", "auto")
+	assert.ErrorContains(t, err, "invalid -source-ip not-an-ip")
+	_, err = resolveSourceIP("", "noisemaker-missing0", "auto")
+	assert.ErrorContains(t, err, "invalid -interface noisemaker-missing0")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-source-ip=127.0.0.1", "-interface=lo", "netenum"}, "invalid -source-ip and -interface: only one can be given")
+}
+
+func TestMain_Send_IPv6(t *testing.T) {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback isn't available")
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+	_, port := getTestServerHostAndPort(t, server)
+
+	// An IPv6 literal can be given with or without its brackets
+	for _, destAddr := range []string{"::1", "[::1]"} {
+		callMain([]string{"./noisemaker", "-sink=stdout", "-ip-version=6", "send", "GET", destAddr, port})
+		assert.Equal(t, activityLogEntry.status, "sent")
+		assert.Equal(t, activityLogEntry.path, "http://[::1]:" + port)
+		assert.Equal(t, activityLogEntry.sourceAddr, "[::1]")
+		assert.Equal(t, activityLogEntry.labels, "ip-version=6")
+	}
+
+	// Over IPv4 only, an IPv6 destination can't be reached
+	callMain([]string{"./noisemaker", "-sink=stdout", "-ip-version=4", "send", "GET", "::1", port})
+	assert.Equal(t, activityLogEntry.status, "error")
+}
+
+func TestInjectPortIntoAddress(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"example.com": "example.com:8080",
+		"example.com/index.html?q=1": "example.com:8080/index.html?q=1",
+		"example.com:80/index.html": "example.com:8080/index.html",
+		"10.0.0.5": "10.0.0.5:8080",
+		"fe80::1": "[fe80::1]:8080",
+		"[fe80::1]": "[fe80::1]:8080",
+		"[fe80::1]:80/index.html": "[fe80::1]:8080/index.html",
+	} {
+		newAddress, err := injectPortIntoAddress(addr, 8080, "http")
+		assert.Nil(t, err)
+		assert.Equal(t, expected, newAddress, addr)
+	}
+	_, err := injectPortIntoAddress("/index.html", 8080, "http")
+	assert.ErrorContains(t, err, "unable to parse address /index.html")
+}
+
+func TestResolveSourceIP_IPVersion(t *testing.T) {
+	_, err := resolveSourceIP("127.0.0.1", "", "6")
+	assert.ErrorContains(t, err, "invalid -source-ip 127.0.0.1: it isn't an IPv6 address")
+	_, err = resolveSourceIP("", "", "5")
+	assert.ErrorContains(t, err, "invalid -ip-version 5 (must be one of 4, 6, auto)")
+	assert.Equal(t, "tcp6", func() string {
+		ipVersion = "6"
+		defer func() { ipVersion = "auto" }()
+		return getIPNetwork("tcp")
+	}())
+	assert.Equal(t, "ip", getIPNetwork("ip"))
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// The browsers the browser command writes throwaway history databases for, and the schema each one's databases use
+var BrowserSchemas = map[string]string{"chrome": "chromium", "edge": "chromium", "firefox": "firefox"}
+
+// The browsers written by default, in order
+var Browsers = []string{"chrome", "edge", "firefox"}
+
+// The file each schema's history (and downloads) database is named, in a profile directory
+var BrowserHistoryFiles = map[string]string{"chromium": "History", "firefox": "places.sqlite"}
+
+// The files in a real profile directory that browser -probe opens (read-only, reading nothing), for each schema
+var BrowserProfileFiles = map[string][]string{
+	"chromium": {"History", "Login Data", "Cookies", "Network/Cookies", "Web Data"},
+	"firefox": {"places.sqlite", "logins.json", "key4.db", "cookies.sqlite", "formhistory.sqlite"},
+}
+
+// A page in the history written to the throwaway databases
+type BrowserVisit struct {
+	url					string
+	title				string
+	ago					time.Duration		// how long before now it was visited
+}
+
+// A download in the history written to the throwaway databases
+type BrowserDownload struct {
+	url					string
+	name				string				// the file's name, in the download directory
+	mimeType			string
+	size				int64
+	ago					time.Duration
+}
+
+// The history written to each throwaway database (under example domains, so nothing in it is real)
+var BrowserHistory = []BrowserVisit{
+	{"https://mail.example.com/inbox", "Inbox - Example Mail", 3 * time.Hour},
+	{"https://intranet.example.com/hr/payroll", "Payroll - Example Intranet", 2 * time.Hour},
+	{"https://login.example.net/oauth2/authorize?client_id=noisemaker", "Sign in to your account", 90 * time.Minute},
+	{"https://files.example.org/share/q3-report", "Q3 report - Example Files", 45 * time.Minute},
+	{"https://pastebin.example.com/raw/7f3a9c0e", "", 20 * time.Minute},
+}
+
+// The downloads written to each throwaway database
+var BrowserDownloads = []BrowserDownload{
+	{"https://updates.example.net/download/setup-update.exe", "setup-update.exe", "application/x-msdownload", 1482752, 30 * time.Minute},
+	{"https://files.example.org/share/q3-report/invoice-2024.zip", "invoice-2024.zip", "application/zip", 58213, 10 * time.Minute},
+}
+
+// A real browser profile directory that browser -probe touches
+type BrowserProfile struct {
+	browser				string
+	path				string		// the profile directory (may be a glob, ie. for Firefox's profiles)
+}
+
+// Options for the browser command
+type BrowserOptions struct {
+	dir					string
+	browsers			[]string
+	probe				bool
+}
+
+// Response data from browser action
+type BrowserResponse struct {
+	written				int
+	visits				int
+	downloads			int
+	accessed			int
+	denied				int
+	missing				int
+	status				string
+}
+
+// Parses browser's arguments: [-probe] (dir) [browsers...]
+func parseBrowserOptions(args []string) (*BrowserOptions, error) {
+	flags := flag.NewFlagSet("browser", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	probe := flags.Bool("probe", false, "whether to open the files in the real profile directories too (read-only)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid browser: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for browser! Args: %v", args)
+	}
+	options := &BrowserOptions{dir: flags.Arg(0), browsers: flags.Args()[1:], probe: *probe}
+	if len(options.browsers) == 0 {
+		options.browsers = Browsers
+	}
+	for _, browser := range options.browsers {
+		if _, found := BrowserSchemas[browser]; !found {
+			return nil, fmt.Errorf("invalid browser '%s' (must be one of %v)", browser, Browsers)
+		}
+	}
+	return options, nil
+}
+
+// Gets the real profile directories of the browsers for the given OS, relative to the given home directory
+func getBrowserProfiles(goos string, homeDir string, browsers []string) []BrowserProfile {
+	var paths map[string]string
+	switch goos {
+	case "windows":
+		localAppData := os.Getenv("LOCALAPPDATA")
+		appData := os.Getenv("APPDATA")
+		paths = map[string]string{
+			"chrome": filepath.Join(localAppData, "Google", "Chrome", "User Data", "Default"),
+			"edge": filepath.Join(localAppData, "Microsoft", "Edge", "User Data", "Default"),
+			"firefox": filepath.Join(appData, "Mozilla", "Firefox", "Profiles", "*"),
+		}
+	case "darwin":
+		paths = map[string]string{
+			"chrome": filepath.Join(homeDir, "Library", "Application Support", "Google", "Chrome", "Default"),
+			"edge": filepath.Join(homeDir, "Library", "Application Support", "Microsoft Edge", "Default"),
+			"firefox": filepath.Join(homeDir, "Library", "Application Support", "Firefox", "Profiles", "*"),
+		}
+	default:
+		// linux, freebsd, etc.
+		paths = map[string]string{
+			"chrome": filepath.Join(homeDir, ".config", "google-chrome", "Default"),
+			"edge": filepath.Join(homeDir, ".config", "microsoft-edge", "Default"),
+			"firefox": filepath.Join(homeDir, ".mozilla", "firefox", "*"),
+		}
+	}
+	profiles := []BrowserProfile{}
+	for _, browser := range browsers {
+		profiles = append(profiles, BrowserProfile{browser, paths[browser]})
+	}
+	return profiles
+}
+
+// Writes a throwaway history (and downloads) database for each browser, in a directory of its own in dir, logging each as a create
+// activity (with its schema as its method), then (with -probe) opens the files in each browser's real profile directories read-only,
+// logging each attempt as an access activity
+func simulateBrowserArtifacts(activityLog Sink, parent *ActivityLogEntry, options *BrowserOptions, profiles []BrowserProfile) *BrowserResponse {
+	response := new(BrowserResponse)
+	failed := 0
+	for _, browser := range options.browsers {
+		schema := BrowserSchemas[browser]
+		profileDir := filepath.Join(options.dir, browser)
+		path := filepath.Join(profileDir, BrowserHistoryFiles[schema])
+		entry := newChildLogEntry(parent, "create")
+		entry.path = escapeRawText(path)
+		entry.method = schema
+
+		createdDir := !fileExists(profileDir)
+		err := os.MkdirAll(profileDir, 0700)
+		if err == nil && createdDir {
+			trackArtifact(entry, "file", profileDir, "delete", profileDir)
+		}
+		if err != nil {
+			entry.status = getFileErrorStatus(err)
+		} else if fileExists(path) {
+			fmt.Printf("File %s already exists, unable to write!\n", path)
+			entry.status = "exists"
+			err = fmt.Errorf("file_already_exists: %s", path)
+		} else {
+			entry.status, err = writeBrowserDatabase(path, schema)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			failed += 1
+		} else {
+			trackArtifact(entry, "file", path, "delete", path)
+			response.written += 1
+			response.visits += len(BrowserHistory)
+			response.downloads += len(BrowserDownloads)
+			fmt.Printf("Wrote %d history entries and %d downloads to %s (%s)\n", len(BrowserHistory), len(BrowserDownloads), path, browser)
+			entry.details = escapeRawText(fmt.Sprintf("%s history, %d history entries, %d downloads", browser, len(BrowserHistory), len(BrowserDownloads)))
+		}
+		writeLogEntry(activityLog, entry)
+	}
+
+	if options.probe {
+		probeBrowserProfiles(activityLog, parent, profiles, response)
+	}
+
+	if failed == 0 {
+		response.status = "completed"
+	} else if response.written > 0 {
+		response.status = "partial"
+	} else {
+		response.status = "error"
+	}
+	return response
+}
+
+// Creates the database at path with the schema's history tables (the ones history and download detections look at, with the columns
+// the browser itself uses), and fills them with BrowserHistory and BrowserDownloads
+func writeBrowserDatabase(path string, schema string) (string, error) {
+	db, err := sql.Open("sqlite", "file:" + (&url.URL{Path: filepath.ToSlash(path)}).EscapedPath())
+	if err != nil {
+		return "error", err
+	}
+	defer db.Close()
+
+	var statements []string
+	now := time.Now()
+	downloadDir := filepath.Join(filepath.Dir(filepath.Dir(path)), "Downloads")
+	switch schema {
+	case "chromium":
+		// (timestamps are microseconds since 1601)
+		chromeTime := func(ago time.Duration) int64 { return now.Add(-ago).UnixMicro() + 11644473600000000 }
+		statements = []string{
+			"CREATE TABLE meta(key LONGVARCHAR NOT NULL UNIQUE PRIMARY KEY, value LONGVARCHAR)",
+			"CREATE TABLE urls(id INTEGER PRIMARY KEY AUTOINCREMENT, url LONGVARCHAR, title LONGVARCHAR, visit_count INTEGER DEFAULT 0 NOT NULL, typed_count INTEGER DEFAULT 0 NOT NULL, last_visit_time INTEGER NOT NULL, hidden INTEGER DEFAULT 0 NOT NULL)",
+			"CREATE TABLE visits(id INTEGER PRIMARY KEY AUTOINCREMENT, url INTEGER NOT NULL, visit_time INTEGER NOT NULL, from_visit INTEGER, transition INTEGER DEFAULT 0 NOT NULL, segment_id INTEGER, visit_duration INTEGER DEFAULT 0 NOT NULL)",
+			"CREATE TABLE downloads(id INTEGER PRIMARY KEY, guid VARCHAR NOT NULL, current_path LONGVARCHAR NOT NULL, target_path LONGVARCHAR NOT NULL, start_time INTEGER NOT NULL, received_bytes INTEGER NOT NULL, total_bytes INTEGER NOT NULL, state INTEGER NOT NULL, danger_type INTEGER NOT NULL, interrupt_reason INTEGER NOT NULL, end_time INTEGER NOT NULL, opened INTEGER NOT NULL, referrer VARCHAR NOT NULL, tab_url VARCHAR NOT NULL, mime_type VARCHAR(255) NOT NULL)",
+			"CREATE TABLE downloads_url_chains(id INTEGER NOT NULL, chain_index INTEGER NOT NULL, url LONGVARCHAR NOT NULL, PRIMARY KEY (id, chain_index))",
+			"INSERT INTO meta VALUES ('version', '66'), ('last_compatible_version', '16')",
+		}
+		for i, visit := range BrowserHistory {
+			statements = append(statements,
+				fmt.Sprintf("INSERT INTO urls VALUES (%d, %s, %s, 1, 0, %d, 0)", i + 1, quoteSQL(visit.url), quoteSQL(visit.title), chromeTime(visit.ago)),
+				fmt.Sprintf("INSERT INTO visits VALUES (%d, %d, %d, 0, 805306368, 0, 0)", i + 1, i + 1, chromeTime(visit.ago)))
+		}
+		for i, download := range BrowserDownloads {
+			target := filepath.Join(downloadDir, download.name)
+			statements = append(statements,
+				fmt.Sprintf("INSERT INTO downloads VALUES (%d, %s, %s, %s, %d, %d, %d, 1, 0, 0, %d, 0, '', '', %s)", i + 1, quoteSQL(newUUID()), quoteSQL(target), quoteSQL(target), chromeTime(download.ago), download.size, download.size, chromeTime(download.ago - time.Second), quoteSQL(download.mimeType)),
+				fmt.Sprintf("INSERT INTO downloads_url_chains VALUES (%d, 0, %s)", i + 1, quoteSQL(download.url)))
+		}
+	case "firefox":
+		// (timestamps are microseconds since 1970, and downloads are pages with annotations for where they were saved)
+		firefoxTime := func(ago time.Duration) int64 { return now.Add(-ago).UnixMicro() }
+		statements = []string{
+			"CREATE TABLE moz_places (id INTEGER PRIMARY KEY, url LONGVARCHAR, title LONGVARCHAR, rev_host LONGVARCHAR, visit_count INTEGER DEFAULT 0, hidden INTEGER DEFAULT 0 NOT NULL, typed INTEGER DEFAULT 0 NOT NULL, frecency INTEGER DEFAULT -1 NOT NULL, last_visit_date INTEGER, guid TEXT)",
+			"CREATE TABLE moz_historyvisits (id INTEGER PRIMARY KEY, from_visit INTEGER, place_id INTEGER, visit_date INTEGER, visit_type INTEGER, session INTEGER)",
+			"CREATE TABLE moz_anno_attributes (id INTEGER PRIMARY KEY, name VARCHAR(32) UNIQUE NOT NULL)",
+			"CREATE TABLE moz_annos (id INTEGER PRIMARY KEY, place_id INTEGER NOT NULL, anno_attribute_id INTEGER, content LONGVARCHAR, flags INTEGER DEFAULT 0, expiration INTEGER DEFAULT 0, type INTEGER DEFAULT 0, dateAdded INTEGER DEFAULT 0, lastModified INTEGER DEFAULT 0)",
+			"INSERT INTO moz_anno_attributes VALUES (1, 'downloads/destinationFileURI')",
+			"PRAGMA user_version = 74",
+		}
+		addPlace := func(id int, pageURL string, title string, ago time.Duration, visitType int) {
+			statements = append(statements,
+				fmt.Sprintf("INSERT INTO moz_places VALUES (%d, %s, %s, %s, 1, 0, 0, 100, %d, %s)", id, quoteSQL(pageURL), quoteSQL(title), quoteSQL(getReversedHost(pageURL)), firefoxTime(ago), quoteSQL(strings.ReplaceAll(newUUID(), "-", "")[:12])),
+				fmt.Sprintf("INSERT INTO moz_historyvisits VALUES (%d, 0, %d, %d, %d, 0)", id, id, firefoxTime(ago), visitType))
+		}
+		for i, visit := range BrowserHistory {
+			addPlace(i + 1, visit.url, visit.title, visit.ago, 1)
+		}
+		for i, download := range BrowserDownloads {
+			id := len(BrowserHistory) + i + 1
+			addPlace(id, download.url, download.name, download.ago, 7)
+			target := (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(downloadDir, download.name))}).String()
+			statements = append(statements, fmt.Sprintf("INSERT INTO moz_annos VALUES (%d, %d, 1, %s, 0, 4, 3, %d, %d)", i + 1, id, quoteSQL(target), firefoxTime(download.ago), firefoxTime(download.ago)))
+		}
+	}
+
+	for _, statement := range statements {
+		if _, err = db.Exec(statement); err != nil {
+			return "error", fmt.Errorf("unable to write browser history %s: %v", path, err)
+		}
+	}
+	return "created", nil
+}
+
+// Opens each of the files in the browsers' real profile directories read-only (reading nothing), logging each attempt as an access
+// activity, and counting them in the response
+func probeBrowserProfiles(activityLog Sink, parent *ActivityLogEntry, profiles []BrowserProfile, response *BrowserResponse) {
+	for _, profile := range profiles {
+		// Expand any globs, and probe the pattern itself if nothing matched (so the attempt still gets logged)
+		dirs := []string{profile.path}
+		if strings.ContainsAny(profile.path, "*?[") {
+			matches, err := filepath.Glob(profile.path)
+			if err == nil && len(matches) > 0 {
+				dirs = matches
+			}
+		}
+
+		for _, dir := range dirs {
+			for _, name := range BrowserProfileFiles[BrowserSchemas[profile.browser]] {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				entry := newChildLogEntry(parent, "access")
+				entry.path = escapeRawText(path)
+				entry.method = "probe"
+				entry.details = escapeRawText(profile.browser + " profile")
+				entry.status = probeCredentialPath(path)
+
+				switch entry.status {
+				case "accessed":
+					response.accessed += 1
+					fmt.Printf("Opened %s (%s profile)\n", path, profile.browser)
+				case "no_access":
+					response.denied += 1
+					fmt.Printf("Access denied to %s (%s profile)\n", path, profile.browser)
+				default:
+					response.missing += 1
+				}
+				writeLogEntry(activityLog, entry)
+			}
+		}
+	}
+}
+
+// Quotes the text as a SQL string literal
+func quoteSQL(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+}
+
+// Gets the URL's host reversed, with a trailing dot, as Firefox records it (ie. "moc.elpmaxe.liam.")
+func getReversedHost(pageURL string) string {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	host := []rune(parsed.Hostname())
+	for i, j := 0, len(host) - 1; i < j; i, j = i + 1, j - 1 {
+		host[i], host[j] = host[j], host[i]
+	}
+	return string(host) + "."
+}
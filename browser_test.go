@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Browser(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=browser-run", "browser", dir + "/profiles"})
+	assert.Equal(t, activityLogEntry.activity, "browser")
+	assert.Equal(t, activityLogEntry.path, dir + "/profiles")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "3 databases written\\, 15 history entries\\, 6 downloads")
+
+	// Each browser gets a database with its own schema, logged as it's created
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	created := map[string]string{}
+	for _, entry := range parsedLog.entries {
+		if entry.activity == "create" {
+			assert.Equal(t, "created", entry.status)
+			created[entry.path] = entry.method
+		}
+	}
+	assert.Equal(t, map[string]string{dir + "/profiles/chrome/History": "chromium", dir + "/profiles/edge/History": "chromium", dir + "/profiles/firefox/places.sqlite": "firefox"}, created)
+
+	db, err := sql.Open("sqlite", dir + "/profiles/chrome/History")
+	assert.Nil(t, err)
+	var count int
+	assert.Nil(t, db.QueryRow("SELECT COUNT(*) FROM urls JOIN visits ON visits.url = urls.id").Scan(&count))
+	assert.Equal(t, len(BrowserHistory), count)
+	var target string
+	assert.Nil(t, db.QueryRow("SELECT target_path FROM downloads WHERE id = 1").Scan(&target))
+	assert.Equal(t, filepath.Join(dir, "profiles", "Downloads", "setup-update.exe"), target)
+	db.Close()
+	db, err = sql.Open("sqlite", dir + "/profiles/firefox/places.sqlite")
+	assert.Nil(t, err)
+	var revHost string
+	assert.Nil(t, db.QueryRow("SELECT rev_host FROM moz_places WHERE id = 1").Scan(&revHost))
+	assert.Equal(t, "moc.elpmaxe.liam.", revHost)
+	assert.Nil(t, db.QueryRow("SELECT COUNT(*) FROM moz_annos").Scan(&count))
+	assert.Equal(t, len(BrowserDownloads), count)
+	db.Close()
+
+	// A database that's already there isn't overwritten, and cleanup removes the databases (and their directories)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "browser", dir + "/profiles", "edge"})
+	assert.Equal(t, activityLogEntry.status, "error")
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "cleanup", "--run-id=browser-run"})
+	assert.Equal(t, activityLogEntry.details, "6 of 6 artifacts removed\\, 0 failed")
+	assert.False(t, fileExists(dir + "/profiles/chrome"))
+}
+
+func TestMain_Browser_Probe(t *testing.T) {
+	// Only the real profile's files are opened (and nothing in them changed)
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	profileDir := filepath.Join(homeDir, ".config", "google-chrome", "Default")
+	os.MkdirAll(profileDir, 0700)
+	os.WriteFile(filepath.Join(profileDir, "Login Data"), []byte("not really"), 0600)
+
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "browser", "-probe", dir, "chrome"})
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "1 databases written\\, 5 history entries\\, 2 downloads\\, 1 profile files accessed\\, 0 denied\\, 4 not found or errored")
+	assertLogFileContains(t, logFilePath, ",access,")
+	assertLogFileContains(t, logFilePath, "," + escapeRawText(filepath.Join(profileDir, "Login Data")) + ",accessed,probe,")
+	contents, _ := os.ReadFile(filepath.Join(profileDir, "Login Data"))
+	assert.Equal(t, "not really", string(contents))
+	assert.False(t, fileExists(filepath.Join(profileDir, "History")))
+}
+
+func TestParseBrowserOptions(t *testing.T) {
+	options, err := parseBrowserOptions([]string{"/tmp/profiles"})
+	assert.Nil(t, err)
+	assert.Equal(t, &BrowserOptions{dir: "/tmp/profiles", browsers: Browsers, probe: false}, options)
+	options, err = parseBrowserOptions([]string{"-probe", "/tmp/profiles", "firefox"})
+	assert.Nil(t, err)
+	assert.Equal(t, &BrowserOptions{dir: "/tmp/profiles", browsers: []string{"firefox"}, probe: true}, options)
+
+	_, err = parseBrowserOptions([]string{"/tmp/profiles", "netscape"})
+	assert.ErrorContains(t, err, "invalid browser 'netscape' (must be one of [chrome edge firefox])")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "browser"}, "not enough arguments for browser! Args: []")
+}
+
+func TestGetBrowserProfiles(t *testing.T) {
+	for _, goos := range []string{"windows", "linux", "darwin"} {
+		profiles := getBrowserProfiles(goos, "/home/nm", Browsers)
+		assert.Len(t, profiles, len(Browsers))
+		for _, profile := range profiles {
+			assert.NotEmpty(t, profile.path)
+		}
+	}
+	assert.Equal(t, []BrowserProfile{{"firefox", "/home/nm/.mozilla/firefox/*"}}, getBrowserProfiles("linux", "/home/nm", []string{"firefox"}))
+}
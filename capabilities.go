@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+)
+
+// Every command noisemaker runs (the top-level ones, not the activities they log along the way)
+var Commands = []string{"execute", "dropper", "download", "lolbin", "fileless", "create", "update", "delete", "shred", "read", "send", "beacon", "traffic", "dga", "listen", "scan", "netenum", "discover", "credprobe", "containerprobe", "browser", "k8sprobe", "procaccess", "inject", "pipe", "ssh", "remote-exec", "useradd", "userdel", "groupadd", "groupdel", "hosts", "inputhook", "avdevice", "screenshot", "stage", "exfil", "action", "playbook", "scenario", "script", "cleanup", "replay", "generate", "fuzz", "watch", "decoy", "edgenames", "compare", "daemon", "control", "collect", "migrate-log", "verify", "verify-signatures", "decrypt-log", "log", "doctor", "capabilities"}
+
+// The protocols send and listen speak
+var SendProtocols = []string{"http", "https", "unix"}
+var ListenProtocols = []string{"http", "tcp", "udp"}
+
+// The sink types -sink writes the activity log to
+var SinkTypes = []string{"csv", "jsonl", "stdout", "syslog", "webhook", "otlp", "grpc", "eventlog", "oslog", "journald", "s3", "amqp"}
+
+// The formats the capabilities can be printed in
+var CapabilitiesFormats = []string{"text", "json"}
+
+// Whether one of noisemaker's commands, protocols, methods, or sinks works on this OS and build
+type Capability struct {
+	Name				string		`json:"name"`			// ie. "inject", or "sink:oslog"
+	Kind				string		`json:"kind"`			// [command, protocol, method, sink]
+	Supported			bool		`json:"supported"`
+	Reason				string		`json:"reason,omitempty"`	// why it isn't supported (or what else it needs)
+}
+
+// The capabilities of this OS and build, as they're printed
+type CapabilitiesReport struct {
+	OS					string			`json:"os"`
+	Arch				string			`json:"arch"`
+	Cgo					bool			`json:"cgo"`
+	Capabilities		[]*Capability	`json:"capabilities"`
+}
+
+// Response data from capabilities action
+type CapabilitiesResponse struct {
+	supported			int
+	total				int
+	status				string
+}
+
+// Parses capabilities's arguments: [-output=text|json]
+func parseCapabilitiesFormat(args []string) (string, error) {
+	flags := flag.NewFlagSet("capabilities", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	output := flags.String("output", "text", "how to print the capabilities: text, or json")
+	err := flags.Parse(args)
+	if err != nil {
+		return "", fmt.Errorf("invalid capabilities: %v", err)
+	}
+	if !containsString(CapabilitiesFormats, *output) {
+		return "", fmt.Errorf("invalid capabilities: invalid -output '%s' (must be one of %v)", *output, CapabilitiesFormats)
+	}
+	return *output, nil
+}
+
+// Works out which of the commands, protocols, methods, and sinks are supported on the OS, by a build with (or without) cgo
+func getCapabilities(goos string, cgo bool) []*Capability {
+	capabilities := []*Capability{}
+	add := func(name string, kind string, reason string) {
+		capabilities = append(capabilities, &Capability{Name: name, Kind: kind, Supported: reason == "", Reason: reason})
+	}
+	only := func(feature string, platforms ...string) string {
+		if containsString(platforms, goos) {
+			return ""
+		}
+		return fmt.Sprintf("%s is %s-only", feature, strings.Join(platforms, "/"))
+	}
+	needsCgo := func(feature string) string {
+		if cgo {
+			return ""
+		}
+		return fmt.Sprintf("%s on darwin needs noisemaker to be built with cgo (CGO_ENABLED=1)", feature)
+	}
+
+	for _, command := range Commands {
+		reason := ""
+		switch command {
+		case "procaccess", "inject":
+			reason = only(command, "windows")
+		case "inputhook":
+			reason = only(command, "windows", "darwin")
+			if goos == "darwin" {
+				reason = needsCgo(command)
+			}
+		case "avdevice":
+			reason = only(command, "windows", "linux", "darwin")
+			if goos == "darwin" {
+				reason = needsCgo(command)
+			}
+		case "useradd", "userdel", "groupadd", "groupdel":
+			if _, _, _, err := getAccountCommand(goos, command, "noisemaker-capabilities"); err != nil {
+				reason = err.Error()
+			}
+		}
+		add(command, "command", reason)
+	}
+
+	for _, protocol := range SendProtocols {
+		add("send:" + protocol, "protocol", "")
+	}
+	for _, protocol := range ListenProtocols {
+		add("listen:" + protocol, "protocol", "")
+	}
+	for _, method := range []string{"winrm", "smb"} {
+		add("remote-exec:" + method, "protocol", only("remote-exec over " + method, RemoteExecPlatforms[method]...))
+	}
+	for _, method := range FilelessMethods {
+		reason := ""
+		if method == "memfd" {
+			reason = only("-method=memfd", "linux")
+		}
+		add("fileless:" + method, "method", reason)
+	}
+	add("action:exec", "method", "")
+	pluginReason := only("-actions plugins", "linux", "darwin")
+	if pluginReason == "" && !cgo {
+		pluginReason = "-actions plugins need noisemaker to be built with cgo (CGO_ENABLED=1)"
+	}
+	add("action:plugin", "method", pluginReason)
+	for _, mode := range IOModes {
+		reason := ""
+		if mode == "direct" {
+			reason = only("-io-mode=direct", "windows", "linux", "darwin")
+		}
+		add("io-mode:" + mode, "method", reason)
+	}
+	for _, sinkType := range SinkTypes {
+		reason := ""
+		switch sinkType {
+		case "eventlog":
+			reason = only("the eventlog sink", "windows")
+		case "journald":
+			reason = only("the journald sink", "linux")
+		case "oslog":
+			reason = only("the oslog sink", "darwin")
+			if goos == "darwin" {
+				reason = needsCgo("the oslog sink")
+			}
+		}
+		add("sink:" + sinkType, "sink", reason)
+	}
+	return capabilities
+}
+
+// Prints the capabilities of this OS and build, as a table (what isn't supported, with why) or as a JSON object
+func printCapabilities(output io.Writer, format string, goos string, cgo bool) (*CapabilitiesResponse, error) {
+	report := &CapabilitiesReport{OS: goos, Arch: runtime.GOARCH, Cgo: cgo, Capabilities: getCapabilities(goos, cgo)}
+	response := &CapabilitiesResponse{total: len(report.Capabilities), status: "completed"}
+	for _, capability := range report.Capabilities {
+		if capability.Supported {
+			response.supported++
+		}
+	}
+
+	if format == "json" {
+		encoded, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			response.status = "error"
+			return response, err
+		}
+		_, err = output.Write(append(encoded, '\n'))
+		return response, err
+	}
+	fmt.Fprintf(output, "noisemaker on %s/%s (cgo %t):\n", report.OS, report.Arch, report.Cgo)
+	for _, capability := range report.Capabilities {
+		if capability.Supported {
+			fmt.Fprintf(output, "  %-8s %-24s supported\n", capability.Kind, capability.Name)
+		} else {
+			fmt.Fprintf(output, "  %-8s %-24s unsupported: %s\n", capability.Kind, capability.Name, capability.Reason)
+		}
+	}
+	return response, nil
+}
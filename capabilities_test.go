@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Gets the capability with the given name
+func findCapability(capabilities []*Capability, name string) *Capability {
+	for _, capability := range capabilities {
+		if capability.Name == name {
+			return capability
+		}
+	}
+	return nil
+}
+
+func TestMain_Capabilities(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "capabilities", "-output=json"})
+	var report CapabilitiesReport
+	assert.Nil(t, json.Unmarshal([]byte(output), &report))
+	assert.Equal(t, runtime.GOOS, report.OS)
+	assert.Equal(t, CgoEnabled, report.Cgo)
+	assert.True(t, findCapability(report.Capabilities, "send").Supported)
+	assert.Equal(t, activityLogEntry.method, "json")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Regexp(t, `^[0-9]+ of [0-9]+ capabilities supported on ` + runtime.GOOS + "/" + runtime.GOARCH + "$", activityLogEntry.details)
+
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "capabilities"})
+	assert.Contains(t, output, "  command  send                     supported\n")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "capabilities", "-output=yaml"}, "invalid capabilities: invalid -output 'yaml' (must be one of [text json])")
+}
+
+func TestGetCapabilities(t *testing.T) {
+	// Windows-only commands, and sinks
+	linux := getCapabilities("linux", false)
+	assert.Equal(t, &Capability{Name: "inject", Kind: "command", Supported: false, Reason: "inject is windows-only"}, findCapability(linux, "inject"))
+	assert.False(t, findCapability(linux, "sink:eventlog").Supported)
+	assert.True(t, findCapability(linux, "sink:journald").Supported)
+	assert.True(t, findCapability(linux, "fileless:memfd").Supported)
+	assert.Equal(t, "remote-exec over winrm is windows-only", findCapability(linux, "remote-exec:winrm").Reason)
+	assert.True(t, findCapability(getCapabilities("windows", false), "inject").Supported)
+
+	// The Mac's hooks need cgo
+	assert.Equal(t, "inputhook on darwin needs noisemaker to be built with cgo (CGO_ENABLED=1)", findCapability(getCapabilities("darwin", false), "inputhook").Reason)
+	assert.True(t, findCapability(getCapabilities("darwin", true), "inputhook").Supported)
+	assert.True(t, findCapability(getCapabilities("darwin", true), "sink:oslog").Supported)
+
+	// Accounts are managed on each of the OSes noisemaker knows how to manage them on
+	assert.Equal(t, "useradd is not supported on freebsd", findCapability(getCapabilities("freebsd", false), "useradd").Reason)
+	assert.False(t, findCapability(getCapabilities("freebsd", false), "io-mode:direct").Supported)
+
+	// Every command is listed, once
+	assert.Len(t, linux, len(Commands) + len(SendProtocols) + len(ListenProtocols) + 2 + len(FilelessMethods) + 2 + len(IOModes) + len(SinkTypes))
+	for _, command := range Commands {
+		assert.Contains(t, KnownActivities, command)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !cgo
+
+package main
+
+// Whether noisemaker was built with cgo, which the Mac's inputhook, avdevice, and oslog sink need
+const CgoEnabled = false
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The progress of a playbook run with -state-file, saved after every run of a step, so an interrupted run can be resumed from the last
+// one that finished (in the same run, with the same variables)
+type PlaybookCheckpoint struct {
+	Playbook			string						`json:"playbook"`
+	Fingerprint			string						`json:"fingerprint"`			// a hash of the playbook (besides its variables), so a different one isn't resumed
+	Vars				map[string]PlaybookValue	`json:"vars,omitempty"`			// the variables it was started with (ie. a scenario's temporary workdir)
+	RunId				string						`json:"run_id"`
+	Seq					int							`json:"seq"`					// the sequence number of the last entry written in the run
+	Signature			string						`json:"signature,omitempty"`	// with -sign-key, the signature of that entry
+	Done				[]string					`json:"done"`					// the runs of the current pass that finished, as <step>.<iteration> (from 0)
+	Statuses			map[string]string			`json:"statuses"`
+	Previous			string						`json:"previous"`
+	Extracted			map[string]string			`json:"extracted,omitempty"`		// the values the steps that finished extracted from their responses
+	Completed			int							`json:"completed"`				// the runs of the current pass that completed, and were skipped
+	Skipped				int							`json:"skipped"`
+	Continued			int							`json:"continued,omitempty"`		// the runs of the current pass that failed, and were continued past
+	End					string						`json:"end,omitempty"`			// on a cron schedule, when it stops (RFC 3339)
+	Scheduled			PlaybookCheckpointTotals	`json:"scheduled"`				// on a cron schedule, the passes that finished before this one
+	Resumed				int							`json:"resumed"`				// how many times it's been resumed
+	path				string
+	done				map[string]bool
+	removed				bool
+}
+
+// The totals of a scheduled playbook's finished passes
+type PlaybookCheckpointTotals struct {
+	Runs				int							`json:"runs"`
+	Completed			int							`json:"completed"`
+	Skipped				int							`json:"skipped"`
+	Total				int							`json:"total"`
+}
+
+// Hashes the playbook as it was loaded, leaving out its variables (which are restored from the state file when it's resumed)
+func getPlaybookFingerprint(playbook *Playbook) (string, error) {
+	copied := *playbook
+	copied.Vars = nil
+	contents, err := json.Marshal(copied)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(contents)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Opens the state file at path for the playbook (or returns nil, without one). If it already exists, the playbook is resumed from it:
+// its variables and run (and the run's sequence numbers and signatures) are restored to where they were, and a resume entry is logged.
+// Otherwise, a new state file is started.
+func openPlaybookCheckpoint(path string, activityLog Sink, parent *ActivityLogEntry, playbook *Playbook) (*PlaybookCheckpoint, error) {
+	if path == "" {
+		return nil, nil
+	}
+	fingerprint, err := getPlaybookFingerprint(playbook)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		checkpoint := &PlaybookCheckpoint{Playbook: playbook.Name, Fingerprint: fingerprint, Vars: playbook.Vars, RunId: parent.runId, Statuses: map[string]string{}, path: path, done: map[string]bool{}}
+		return checkpoint, checkpoint.save()
+	} else if err != nil {
+		return nil, err
+	}
+	checkpoint := new(PlaybookCheckpoint)
+	err = json.Unmarshal(contents, checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	if checkpoint.Fingerprint != fingerprint {
+		return nil, fmt.Errorf("state file %s is for a different playbook (remove it to start over)", path)
+	}
+	checkpoint.path = path
+	checkpoint.done = map[string]bool{}
+	for _, key := range checkpoint.Done {
+		checkpoint.done[key] = true
+	}
+	if checkpoint.Statuses == nil {
+		checkpoint.Statuses = map[string]string{}
+	}
+
+	// Pick up where it left off: with the same variables, in the same run
+	playbook.Vars = checkpoint.Vars
+	err = checkPlaybook(playbook)
+	if err != nil {
+		return nil, err
+	}
+	parent.runId = checkpoint.RunId
+	logFileMutex.Lock()
+	logSequences[checkpoint.RunId] = checkpoint.Seq
+	lastLogSignatures[checkpoint.RunId] = checkpoint.Signature
+	logFileMutex.Unlock()
+
+	checkpoint.Resumed++
+	progress := fmt.Sprintf("%d runs of its steps done", len(checkpoint.Done))
+	if checkpoint.Scheduled.Runs > 0 {
+		progress = fmt.Sprintf("%d scheduled runs and %s", checkpoint.Scheduled.Runs, progress)
+	}
+	fmt.Printf("Resuming playbook %s from state file %s (%s)...\n", playbook.Name, path, progress)
+	entry := newChildLogEntry(parent, "resume")
+	entry.path = escapeRawText(path)
+	entry.status = "resumed"
+	entry.details = escapeRawText(fmt.Sprintf("resumed playbook %s with %s", playbook.Name, progress))
+	writeLogEntry(activityLog, entry)
+	return checkpoint, checkpoint.save()
+}
+
+func getPlaybookRunKey(i int, n int) string {
+	return strconv.Itoa(i) + "." + strconv.Itoa(n)
+}
+
+func (checkpoint *PlaybookCheckpoint) isDone(i int, n int) bool {
+	return checkpoint.done[getPlaybookRunKey(i, n)]
+}
+
+func (checkpoint *PlaybookCheckpoint) markDone(i int, n int) {
+	key := getPlaybookRunKey(i, n)
+	if !checkpoint.done[key] {
+		checkpoint.done[key] = true
+		checkpoint.Done = append(checkpoint.Done, key)
+	}
+}
+
+// Whether a pass of the playbook was interrupted partway through
+func (checkpoint *PlaybookCheckpoint) inPass() bool {
+	return len(checkpoint.Done) > 0
+}
+
+// Gets when a scheduled playbook stops: the end it was first started with, if it's been resumed, or else end (which is saved)
+func (checkpoint *PlaybookCheckpoint) getEnd(end time.Time) (time.Time, error) {
+	if checkpoint.End != "" {
+		return time.Parse(time.RFC3339, checkpoint.End)
+	}
+	checkpoint.End = end.Format(time.RFC3339)
+	return end, checkpoint.save()
+}
+
+// Adds a scheduled playbook's finished pass to the totals, and starts the next pass from scratch
+func (checkpoint *PlaybookCheckpoint) finishPass(response *PlaybookResponse) error {
+	checkpoint.Scheduled.Runs++
+	checkpoint.Scheduled.Completed += response.completed
+	checkpoint.Scheduled.Skipped += response.skipped
+	checkpoint.Scheduled.Total += response.total
+	checkpoint.Done = nil
+	checkpoint.done = map[string]bool{}
+	checkpoint.Statuses = map[string]string{}
+	checkpoint.Previous = ""
+	checkpoint.Extracted = nil
+	checkpoint.Completed = 0
+	checkpoint.Skipped = 0
+	checkpoint.Continued = 0
+	return checkpoint.save()
+}
+
+// Writes the state file (to a temporary file first, so an interruption never leaves half of one), with the run's sequence number and
+// signature as they are now
+func (checkpoint *PlaybookCheckpoint) save() error {
+	logFileMutex.Lock()
+	checkpoint.Seq = logSequences[checkpoint.RunId]
+	checkpoint.Signature = lastLogSignatures[checkpoint.RunId]
+	logFileMutex.Unlock()
+
+	contents, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(checkpoint.path + ".tmp", contents, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(checkpoint.path + ".tmp", checkpoint.path)
+}
+
+// Saves the state file again once the playbook's own entry has been written (unless it's finished, and the file's been removed), so a
+// resumed run's entries follow on from it
+func (checkpoint *PlaybookCheckpoint) saveAfter() {
+	if checkpoint != nil && !checkpoint.removed {
+		check(checkpoint.save())
+	}
+}
+
+// Removes the state file, once the playbook's finished (so the next run starts over)
+func (checkpoint *PlaybookCheckpoint) remove() error {
+	checkpoint.removed = true
+	return os.Remove(checkpoint.path)
+}
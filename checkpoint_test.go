@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a state file for the playbook at playbookPath, as if a run of it had been interrupted at the checkpoint
+func writeTestCheckpoint(t *testing.T, statePath string, playbookPath string, checkpoint *PlaybookCheckpoint) {
+	playbook, err := loadPlaybook(playbookPath)
+	assert.Nil(t, err)
+	if checkpoint.Fingerprint == "" {
+		checkpoint.Fingerprint, err = getPlaybookFingerprint(playbook)
+		assert.Nil(t, err)
+	}
+	checkpoint.Playbook = playbook.Name
+	contents, err := json.Marshal(checkpoint)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(statePath, contents, 0600))
+}
+
+func TestMain_Playbook_Resume(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	statePath := dir + "/state.json"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: drop-three
+steps:
+  - name: first
+    command: create
+    args: ["` + dir + `/a.txt"]
+  - command: create
+    args: ["` + dir + `/b.txt"]
+    when: first == created
+  - command: create
+    foreach: [c, d]
+    args: ["` + dir + `/${item}.txt"]
+`), 0644)
+
+	// Precondition: the run was interrupted after the first step, and the first run of the loop
+	writeTestCheckpoint(t, statePath, playbookPath, &PlaybookCheckpoint{RunId: "campaign", Seq: 1, Done: []string{"0.0", "2.0"}, Statuses: map[string]string{"first": "created"}, Completed: 2})
+
+	// It carries on in the same run, with only the runs that hadn't finished
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=another-run", "-state-file=" + statePath, "playbook", playbookPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Resuming playbook drop-three from state file " + statePath + " (2 runs of its steps done)...")
+	assert.NotContains(t, output, "Running step 1 of 3")
+	assert.Contains(t, output, "Running step 3 of 3 (create, 2 of 2)...")
+	assert.NotContains(t, output, "Running step 3 of 3 (create, 1 of 2)...")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "4 of 4 steps completed")
+	assert.False(t, fileExists(dir + "/a.txt"))
+	assert.False(t, fileExists(dir + "/c.txt"))
+	assert.True(t, fileExists(dir + "/b.txt"))
+	assert.True(t, fileExists(dir + "/d.txt"))
+	assert.Equal(t, []string{"campaign,2", "campaign,3", "campaign,4", "campaign,5"}, readTestRunIdsAndSeqs(t, logFilePath))
+	assertLogFileContains(t, logFilePath, ",resume,")
+	assertLogFileContains(t, logFilePath, ",resumed,")
+
+	// The state file's removed once it's completed
+	_, err := os.Stat(statePath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMain_Playbook_StateFileKeptOnError(t *testing.T) {
+	dir := t.TempDir()
+	statePath := dir + "/state.json"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: broken
+steps:
+  - name: drop
+    command: create
+    args: ["` + dir + `/dropped.txt"]
+  - command: create
+`), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "-run-id=broken-run", "-state-file=" + statePath, "playbook", playbookPath}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "error")
+	contents, err := readTestFile(statePath)
+	assert.Nil(t, err)
+	checkpoint := new(PlaybookCheckpoint)
+	assert.Nil(t, json.Unmarshal([]byte(contents), checkpoint))
+	assert.Equal(t, "broken", checkpoint.Playbook)
+	assert.Equal(t, "broken-run", checkpoint.RunId)
+	assert.Equal(t, []string{"0.0"}, checkpoint.Done)
+	assert.Equal(t, map[string]string{"drop": "created"}, checkpoint.Statuses)
+	assert.Equal(t, 1, checkpoint.Completed)
+	assert.Equal(t, 3, checkpoint.Seq)
+}
+
+func TestMain_Playbook_ResumeDifferentPlaybook(t *testing.T) {
+	dir := t.TempDir()
+	statePath := dir + "/state.json"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte("name: changed\nsteps:\n  - command: delete\n    args: [\"" + dir + "/missing.txt\"]\n"), 0644)
+	writeTestCheckpoint(t, statePath, playbookPath, &PlaybookCheckpoint{Fingerprint: "0123", RunId: "campaign"})
+
+	args := []string{"./noisemaker", "-sink=stdout", "-state-file=" + statePath, "playbook", playbookPath}
+	assertMainPanicsWithMessage(t, args, "state file " + statePath + " is for a different playbook (remove it to start over)")
+	assert.True(t, fileExists(statePath))
+}
+
+func TestMain_Playbook_ResumeSchedule(t *testing.T) {
+	// Precondition: the campaign was started before midnight, and interrupted in its second run
+	useTestScheduleClock(t, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+	statePath := dir + "/state.json"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: hourly
+schedule:
+  cron: "0 * * * *"
+  duration: 72h
+steps:
+  - command: delete
+    args: ["` + dir + `/missing.txt"]
+  - command: delete
+    args: ["` + dir + `/missing.txt"]
+`), 0644)
+	writeTestCheckpoint(t, statePath, playbookPath, &PlaybookCheckpoint{RunId: "campaign", Seq: 3, Done: []string{"0.0"}, Completed: 1, End: "2024-11-01T02:30:00Z", Scheduled: PlaybookCheckpointTotals{Runs: 1, Completed: 2, Total: 2}})
+
+	// The interrupted run's finished, then it runs until the end it was started with (not 72 hours from now)
+	args := []string{"./noisemaker", "-sink=stdout", "-state-file=" + statePath, "playbook", playbookPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Resuming playbook hourly from state file " + statePath + " (1 scheduled runs and 1 runs of its steps done)...")
+	assert.Contains(t, output, "Finishing the scheduled run that was interrupted...")
+	assert.Contains(t, output, "until 2024-11-01T02:30:00Z...")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "8 of 8 steps completed\\, over 4 scheduled runs")
+	assert.Equal(t, time.Date(2024, 11, 1, 2, 0, 0, 0, time.UTC), scheduleNow())
+	assert.False(t, fileExists(statePath))
+}
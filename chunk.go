@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Response data from a chunked send
+type ChunkedSendResponse struct {
+	chunks				int
+	sent				int
+	bytesSent			int
+	bytesReceived		int
+	status				string
+}
+
+// Splits the payload into chunks of no more than chunkSize bytes (an empty payload is still sent, as one empty chunk)
+func splitPayload(data string, chunkSize int) []string {
+	chunks := []string{}
+	for len(data) > chunkSize {
+		chunks = append(chunks, data[:chunkSize])
+		data = data[chunkSize:]
+	}
+	return append(chunks, data)
+}
+
+// Sends the payload in chunks, one request after another, to each of the hosts in turn (retrying each failed chunk, as send does),
+// stopping at the first chunk that can't be sent. Every attempt is logged as its own send activity, sharing the parent's correlation
+// ID (the transfer's ID), with the chunk's index in its details.
+func sendChunks(activityLog Sink, parent *ActivityLogEntry, method string, destAddrs []string, destPort int, protocol string, data string, chunkSize int, failRate float64, retries int, backoff time.Duration) *ChunkedSendResponse {
+	chunks := splitPayload(data, chunkSize)
+	response := &ChunkedSendResponse{chunks: len(chunks)}
+	var lastStatus string
+	for i, chunk := range chunks {
+		destAddr := destAddrs[i % len(destAddrs)]
+		chunkBackoff := backoff
+		for attempt := 1; ; attempt++ {
+			entry := newChildLogEntry(parent, "send")
+			entry.method = method
+			entry.destAddr = destAddr
+			entry.destPort = destPort
+			entry.protocol = protocol
+			entry.attempt = attempt
+			if retries > 0 {
+				fmt.Printf("Attempt %d of %d:\n", attempt, retries + 1)
+			}
+			fmt.Printf("Chunk %d of %d: sending %d bytes of data to %s %s (port %d) using protocol %s...\n", i + 1, len(chunks), len(chunk), method, destAddr, destPort, protocol)
+			messageResponse, err := sendMessageWithFailureRate(method, destAddr, destPort, protocol, nil, chunk, failRate)
+			if err != nil {
+				fmt.Printf("Chunk %d attempt %d failed: %v\n", i + 1, attempt, err)
+				entry.status = messageResponse.status
+			} else {
+				entry.status = "sent"
+			}
+			lastStatus = entry.status
+			entry.path = escapeRawText(messageResponse.path)
+			entry.sourceAddr = messageResponse.sourceAddr
+			entry.sourcePort = messageResponse.sourcePort
+			recordSendConnection(entry, messageResponse)
+			entry.bytesSent = messageResponse.bytesSent
+			entry.bytesReceived = messageResponse.bytesReceived
+			details := fmt.Sprintf("chunk %d of %d, transfer %s", i + 1, len(chunks), parent.correlationId)
+			if sendDetails := getSendDetails(messageResponse); sendDetails != "" {
+				details += ", " + sendDetails
+			}
+			entry.details = escapeRawText(details)
+			writeLogEntry(activityLog, entry)
+			response.bytesSent += messageResponse.bytesSent
+			response.bytesReceived += messageResponse.bytesReceived
+			if err == nil || attempt > retries || isRunCancelled() {
+				break
+			}
+
+			// Back off before retrying
+			fmt.Printf("Retrying in %v...\n", chunkBackoff)
+			sleepContext(chunkBackoff)
+			chunkBackoff *= 2
+		}
+		if lastStatus != "sent" {
+			fmt.Printf("Chunk %d of %d couldn't be sent, stopping\n", i + 1, len(chunks))
+			break
+		}
+		response.sent++
+	}
+
+	switch {
+	case response.sent == response.chunks:
+		response.status = "sent"
+	case response.sent == 0:
+		response.status = lastStatus
+	default:
+		response.status = "partial"
+	}
+	return response
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Send_Chunked(t *testing.T) {
+	var mutex sync.Mutex
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		received = append(received, string(body))
+		mutex.Unlock()
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// 2.5KB in 1KB chunks is three requests, rotating between the hosts, sharing a transfer ID
+	payload := strings.Repeat("a", 1024) + strings.Repeat("b", 1024) + strings.Repeat("c", 512)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-chunk-size=1KB", "send", "POST", host + ",localhost", port, "http", payload})
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.destAddr, host + "\\,localhost")
+	assert.Greater(t, activityLogEntry.bytesSent, len(payload))
+	assert.Equal(t, activityLogEntry.details, "3 of 3 chunks sent\\, chunk size 1KB\\, transfer " + activityLogEntry.correlationId)
+	assert.Equal(t, []string{strings.Repeat("a", 1024), strings.Repeat("b", 1024), strings.Repeat("c", 512)}, received)
+
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 4)
+	for i, destAddr := range []string{host, "localhost", host} {
+		chunk := parsedLog.entries[i]
+		assert.Equal(t, "send", chunk.activity)
+		assert.Equal(t, "sent", chunk.status)
+		assert.Equal(t, "http://" + destAddr + ":" + port, chunk.path)
+		assert.Equal(t, host, chunk.destAddr)
+		assert.Equal(t, activityLogEntry.correlationId, chunk.correlationId)
+		assert.True(t, strings.HasPrefix(chunk.details, []string{"chunk 1 of 3", "chunk 2 of 3", "chunk 3 of 3"}[i] + "\\, transfer "))
+	}
+	steps, err := loadReplaySteps(&ReplayOptions{path: logFilePath, speed: 1})
+	assert.Nil(t, err)
+	assert.Len(t, steps, 1)
+
+	// A chunk that fails stops the transfer
+	callMain([]string{"./noisemaker", "-sink=stdout", "-chunk-size=1KB", "-fail-rate=1", "send", "POST", host, port, "http", payload})
+	assert.Equal(t, activityLogEntry.status, "injected_failure")
+	assert.True(t, strings.HasPrefix(activityLogEntry.details, "0 of 3 chunks sent\\, "))
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-chunk-size=big", "send", "POST", host, port}, "invalid chunk-size for send: 'big'")
+}
+
+func TestSplitPayload(t *testing.T) {
+	assert.Equal(t, []string{"abc", "def", "g"}, splitPayload("abcdefg", 3))
+	assert.Equal(t, []string{"abc", "def"}, splitPayload("abcdef", 3))
+	assert.Equal(t, []string{""}, splitPayload("", 3))
+}
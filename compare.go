@@ -0,0 +1,619 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// What kind of sensor event each activity should show up as (activities that aren't here aren't compared)
+var CompareCategories = map[string]string{
+	"execute": "process",
+	"discovery": "process",
+	"create": "file",
+	"modify": "file",
+	"update": "file",
+	"delete": "file",
+	"stage": "file",
+	"send": "network",
+	"connect": "network",
+}
+
+// The formats sensor exports can be read from
+var SensorExportFormats = []string{"sysmon", "osquery", "ecs"}
+
+const DefaultCompareWindow = 5 * time.Second
+
+// How many missed entries are listed in the text report (the JSON report lists them all)
+const MaxReportedMisses = 50
+
+// An event from a sensor's export, reduced to what's needed to match it to an activity log entry
+type SensorEvent struct {
+	timestamp			time.Time
+	category			string				// process, file, or network
+	processName			string				// the executable's path (or just its name)
+	commandLine			string
+	path				string				// the file's path
+	destAddr			string				// the remote IP address
+	destHost			string				// the remote hostname, if the sensor resolved it
+	destPort			int
+	matched				bool
+}
+
+// Reads a sensor's export into events (one for each format in SensorExportFormats)
+type SensorExportParser interface {
+	ParseEvents(contents []byte) ([]*SensorEvent, error)
+}
+
+// Which entries to compare, and how to match them to the sensor's events
+type CompareOptions struct {
+	LogFilter
+	logPath				string
+	exportPath			string
+	format				string				// empty to detect it from the export
+	window				time.Duration
+	outputFormat		string
+}
+
+// How many of an activity's entries the sensor saw
+type CoverageStats struct {
+	Category			string				`json:"category"`
+	Activity			string				`json:"activity"`
+	Generated			int					`json:"generated"`
+	Detected			int					`json:"detected"`
+	Coverage			float64				`json:"coverage"`
+}
+
+// An entry the sensor didn't see
+type MissedEntry struct {
+	Timestamp			string				`json:"timestamp"`
+	Activity			string				`json:"activity"`
+	Category			string				`json:"category"`
+	Target				string				`json:"target"`		// what it was matched on (the command, path, or destination)
+	RunId				string				`json:"runId"`
+	Seq					int					`json:"seq"`
+}
+
+// The detection coverage of an activity log, by a sensor's export
+type CompareReport struct {
+	LogPath				string				`json:"logPath"`
+	ExportPath			string				`json:"exportPath"`
+	Format				string				`json:"format"`
+	Window				string				`json:"window"`
+	Events				int					`json:"events"`
+	Generated			int					`json:"generated"`
+	Detected			int					`json:"detected"`
+	Coverage			float64				`json:"coverage"`
+	NotCompared			int					`json:"notCompared"`
+	Activities			[]*CoverageStats	`json:"activities"`
+	Missed				[]*MissedEntry		`json:"missed"`
+}
+
+// Response data from compare action
+type CompareResponse struct {
+	report				*CompareReport
+	status				string
+}
+
+// Parses the filters (the same as log query's) and matching options of a compare (ie. --format=sysmon --window=10s),
+// followed by the activity log and the sensor's export
+func parseCompareOptions(args []string) (*CompareOptions, error) {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	filterFlags := addLogFilterFlags(flags)
+	format := flags.String("format", "", "the sensor export's format, sysmon, osquery, or ecs (default detected from the export)")
+	window := flags.Duration("window", DefaultCompareWindow, "how far apart an entry and a sensor event can be logged and still match (default 5s)")
+	outputFormat := flags.String("output-format", "text", "the format to print the report in, text or json (default text)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compare: %v", err)
+	}
+	if flags.NArg() < 2 {
+		return nil, fmt.Errorf("not enough arguments for compare! Args: %v", args)
+	}
+
+	options := &CompareOptions{logPath: flags.Arg(0), exportPath: flags.Arg(1), format: *format, window: *window, outputFormat: *outputFormat}
+	options.LogFilter, err = filterFlags.parse(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if options.format != "" && !containsString(SensorExportFormats, options.format) {
+		return nil, fmt.Errorf("invalid format '%s' (must be %s)", options.format, strings.Join(SensorExportFormats, ", "))
+	}
+	if options.window < 0 {
+		return nil, fmt.Errorf("invalid window %v (must be 0 or more)", options.window)
+	}
+	if options.outputFormat != "text" && options.outputFormat != "json" {
+		return nil, fmt.Errorf("invalid output-format '%s' (must be text or json)", options.outputFormat)
+	}
+	return options, nil
+}
+
+// Gets the parser for a sensor export format
+func newSensorExportParser(format string) (SensorExportParser, error) {
+	switch format {
+	case "sysmon":
+		return new(SysmonParser), nil
+	case "osquery":
+		return new(OsqueryParser), nil
+	case "ecs":
+		return new(ECSParser), nil
+	default:
+		return nil, fmt.Errorf("invalid format '%s' (must be %s)", format, strings.Join(SensorExportFormats, ", "))
+	}
+}
+
+// Works out an export's format from its first event's keys
+func detectSensorExportFormat(contents []byte) (string, error) {
+	objects, err := decodeJSONObjects(contents)
+	if err != nil {
+		return "", err
+	}
+	if len(objects) > 0 {
+		object := objects[0]
+		if _, ok := object["Event"]; ok {
+			return "sysmon", nil
+		}
+		if _, ok := object["columns"]; ok {
+			return "osquery", nil
+		}
+		if _, ok := object["snapshot"]; ok {
+			return "osquery", nil
+		}
+		if lookupJSONValue(object, "@timestamp") != nil || lookupJSONValue(object, "_source.@timestamp") != nil {
+			return "ecs", nil
+		}
+	}
+	return "", fmt.Errorf("unable to detect the sensor export's format (give it with --format=%s)", strings.Join(SensorExportFormats, "|"))
+}
+
+// Reads the activity log and the sensor export, matches each entry to an event, and prints the report to out
+func runCompare(options *CompareOptions, out io.Writer) (*CompareResponse, error) {
+	response := &CompareResponse{status: "error"}
+	parsedLog, err := readLog(options.logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			response.status = "not_found"
+		}
+		return response, err
+	}
+	contents, err := os.ReadFile(options.exportPath)
+	if err != nil {
+		response.status = "not_found"
+		return response, err
+	}
+
+	format := options.format
+	if format == "" {
+		format, err = detectSensorExportFormat(contents)
+		if err != nil {
+			return response, err
+		}
+	}
+	parser, err := newSensorExportParser(format)
+	if err != nil {
+		return response, err
+	}
+	events, err := parser.ParseEvents(contents)
+	if err != nil {
+		return response, fmt.Errorf("invalid %s export: %v", format, err)
+	}
+
+	entries := []*ActivityLogEntry{}
+	for _, entry := range parsedLog.entries {
+		if options.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	report := compareEntries(entries, events, options.window)
+	report.LogPath = options.logPath
+	report.ExportPath = options.exportPath
+	report.Format = format
+	response.report = report
+
+	if options.outputFormat == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = writeCompareText(report, out)
+	}
+	if err != nil {
+		return response, err
+	}
+	response.status = "completed"
+	return response, nil
+}
+
+// Matches each entry (in order) to the first unmatched event of the same category, logged within window of it, with the same
+// attributes. Each event can only be matched once, so two of the same command need two events.
+func compareEntries(entries []*ActivityLogEntry, events []*SensorEvent, window time.Duration) *CompareReport {
+	report := &CompareReport{Window: window.String(), Events: len(events), Activities: []*CoverageStats{}, Missed: []*MissedEntry{}}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].timestamp.Before(events[j].timestamp)
+	})
+	activities := map[string]*CoverageStats{}
+	for _, entry := range entries {
+		activity := unescapeRawText(entry.activity)
+		category, ok := CompareCategories[activity]
+		if !ok {
+			report.NotCompared += 1
+			continue
+		}
+		if activities[activity] == nil {
+			activities[activity] = &CoverageStats{Category: category, Activity: activity}
+			report.Activities = append(report.Activities, activities[activity])
+		}
+		stats := activities[activity]
+		stats.Generated += 1
+		report.Generated += 1
+
+		timestamp, err := time.Parse(time.RFC3339, entry.timestamp)
+		detected := false
+		if err == nil {
+			// Entries are only logged to the second, so the window's from the start to the end of it
+			first := sort.Search(len(events), func(i int) bool {
+				return !events[i].timestamp.Before(timestamp.Add(-window))
+			})
+			for _, event := range events[first:] {
+				if event.timestamp.After(timestamp.Add(time.Second + window)) {
+					break
+				}
+				if !event.matched && event.category == category && matchesSensorEvent(entry, event) {
+					event.matched = true
+					detected = true
+					break
+				}
+			}
+		}
+		if detected {
+			stats.Detected += 1
+			report.Detected += 1
+			continue
+		}
+		report.Missed = append(report.Missed, &MissedEntry{
+			Timestamp: entry.timestamp,
+			Activity: activity,
+			Category: category,
+			Target: getCompareTarget(entry),
+			RunId: unescapeRawText(entry.runId),
+			Seq: entry.seq,
+		})
+	}
+
+	report.Coverage = getRate(report.Detected, report.Generated)
+	for _, stats := range report.Activities {
+		stats.Coverage = getRate(stats.Detected, stats.Generated)
+	}
+	sort.SliceStable(report.Activities, func(i, j int) bool {
+		if report.Activities[i].Category != report.Activities[j].Category {
+			return report.Activities[i].Category < report.Activities[j].Category
+		}
+		return report.Activities[i].Activity < report.Activities[j].Activity
+	})
+	return report
+}
+
+// Whether the event is what the entry's activity would look like to a sensor: the same program (for processes), the same path
+// (for files), or the same destination (for network connections; by port, and by address when it's an IP or the sensor resolved the host)
+func matchesSensorEvent(entry *ActivityLogEntry, event *SensorEvent) bool {
+	switch event.category {
+	case "process":
+		program, _, _ := strings.Cut(unescapeRawText(entry.processCmd), " ")
+		if program == "" {
+			return false
+		}
+		eventProgram := event.processName
+		if eventProgram == "" {
+			eventProgram, _, _ = strings.Cut(strings.TrimPrefix(event.commandLine, "\""), " ")
+			eventProgram = strings.TrimSuffix(eventProgram, "\"")
+		}
+		return strings.EqualFold(getProgramName(program), getProgramName(eventProgram))
+	case "file":
+		return matchesSensorPath(unescapeRawText(entry.path), event.path)
+	case "network":
+		if entry.destPort != 0 && event.destPort != 0 && entry.destPort != event.destPort {
+			return false
+		}
+		host := getCompareHost(unescapeRawText(entry.destAddr))
+		if host == "" {
+			return true
+		}
+		if net.ParseIP(host) != nil {
+			return net.ParseIP(host).Equal(net.ParseIP(event.destAddr))
+		}
+		return event.destHost == "" || strings.EqualFold(strings.TrimSuffix(event.destHost, "."), host)
+	}
+	return false
+}
+
+// Gets a program's name without its directory or extension (ie. "cmd" for both "C:\Windows\System32\cmd.exe" and "cmd")
+func getProgramName(program string) string {
+	name := path.Base(strings.ReplaceAll(program, "\\", "/"))
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// Whether the paths are the same file (ignoring case and slashes, for Windows sensors), or the entry's relative path is the end of the event's
+func matchesSensorPath(entryPath string, eventPath string) bool {
+	if entryPath == "" || eventPath == "" {
+		return false
+	}
+	entryPath = strings.TrimPrefix(strings.ReplaceAll(entryPath, "\\", "/"), "./")
+	eventPath = strings.ReplaceAll(eventPath, "\\", "/")
+	if strings.EqualFold(entryPath, eventPath) {
+		return true
+	}
+	return !strings.HasPrefix(entryPath, "/") && !strings.Contains(entryPath, ":") && strings.HasSuffix(strings.ToLower(eventPath), "/" + strings.ToLower(entryPath))
+}
+
+// Gets the host out of a logged destination (ie. "www.postman-echo.com" out of "www.postman-echo.com/post", or "::1" out of the
+// resolved "[::1]")
+func getCompareHost(destAddr string) string {
+	if _, rest, found := strings.Cut(destAddr, "://"); found {
+		destAddr = rest
+	}
+	host, _, _ := strings.Cut(destAddr, "/")
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1:len(host) - 1]
+	}
+	return host
+}
+
+// Describes what an entry was matched on, for the report
+func getCompareTarget(entry *ActivityLogEntry) string {
+	switch CompareCategories[unescapeRawText(entry.activity)] {
+	case "process":
+		return unescapeRawText(entry.processCmd)
+	case "file":
+		return unescapeRawText(entry.path)
+	default:
+		return fmt.Sprintf("%s:%d", getCompareHost(unescapeRawText(entry.destAddr)), entry.destPort)
+	}
+}
+
+// Writes the report as aligned tables: the coverage of each activity, then the entries that were missed
+func writeCompareText(report *CompareReport, out io.Writer) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "Compared %d entries in %s with %d %s events in %s (within %s)\n\n", report.Generated, report.LogPath, report.Events, report.Format, report.ExportPath, report.Window)
+	fmt.Fprintf(writer, "CATEGORY\tACTIVITY\tGENERATED\tDETECTED\tCOVERAGE\n")
+	for _, stats := range report.Activities {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%.1f%%\n", stats.Category, stats.Activity, stats.Generated, stats.Detected, stats.Coverage * 100)
+	}
+	fmt.Fprintf(writer, "TOTAL\t\t%d\t%d\t%.1f%%\n", report.Generated, report.Detected, report.Coverage * 100)
+
+	if len(report.Missed) > 0 {
+		fmt.Fprintf(writer, "\nMISSED (%d)\tACTIVITY\tTARGET\tRUN\n", len(report.Missed))
+		for i, missed := range report.Missed {
+			if i == MaxReportedMisses {
+				fmt.Fprintf(writer, "(and %d more)\t\t\t\n", len(report.Missed) - MaxReportedMisses)
+				break
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s #%d\n", missed.Timestamp, missed.Activity, missed.Target, missed.RunId, missed.Seq)
+		}
+	}
+	if report.NotCompared > 0 {
+		fmt.Fprintf(writer, "\n%d entries weren't compared (their activities aren't ones a sensor records)\n", report.NotCompared)
+	}
+	return writer.Flush()
+}
+
+// Decodes a JSON array of objects, or a stream of them (ie. JSON lines, or pretty-printed objects one after another)
+func decodeJSONObjects(contents []byte) ([]map[string]any, error) {
+	objects := []map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+	if bytes.HasPrefix(bytes.TrimSpace(contents), []byte("[")) {
+		err := decoder.Decode(&objects)
+		return objects, err
+	}
+	for decoder.More() {
+		object := map[string]any{}
+		err := decoder.Decode(&object)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// Looks up a value by its dotted key (ie. "process.command_line"), whether the objects are nested, flattened, or a mix of both
+func lookupJSONValue(object map[string]any, key string) any {
+	if value, ok := object[key]; ok {
+		return value
+	}
+	for i := len(key) - 1; i > 0; i-- {
+		if key[i] != '.' {
+			continue
+		}
+		if child, ok := object[key[:i]].(map[string]any); ok {
+			if value := lookupJSONValue(child, key[i + 1:]); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// Gets the first of the keys that has a value, as a string (or an empty string, if none do)
+func lookupJSONString(object map[string]any, keys ...string) string {
+	for _, key := range keys {
+		switch value := lookupJSONValue(object, key).(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case json.Number:
+			return value.String()
+		case []any:
+			// ie. ECS's event.category, which can be a list
+			if len(value) > 0 {
+				return fmt.Sprintf("%v", value[0])
+			}
+		case map[string]any:
+			// ie. an EVTX element with attributes, with its value as #text
+			if text, ok := value["#text"]; ok {
+				return fmt.Sprintf("%v", text)
+			}
+		}
+	}
+	return ""
+}
+
+// Gets the first of the keys that has a value, as a number (or 0, if none do)
+func lookupJSONInt(object map[string]any, keys ...string) int {
+	number, _ := strconv.Atoi(lookupJSONString(object, keys...))
+	return number
+}
+
+// Reads Sysmon events converted from EVTX to JSON (ie. by evtx_dump), with each event's fields under Event.System and Event.EventData
+type SysmonParser struct {
+}
+
+// The Sysmon event IDs that are compared, and their categories
+var SysmonEventCategories = map[int]string{
+	1: "process",		// process creation
+	3: "network",		// network connection
+	11: "file",			// file created
+	23: "file",			// file deleted (and archived)
+	26: "file",			// file deleted
+}
+
+func (parser *SysmonParser) ParseEvents(contents []byte) ([]*SensorEvent, error) {
+	objects, err := decodeJSONObjects(contents)
+	if err != nil {
+		return nil, err
+	}
+	events := []*SensorEvent{}
+	for _, object := range objects {
+		category, ok := SysmonEventCategories[lookupJSONInt(object, "Event.System.EventID")]
+		if !ok {
+			continue
+		}
+		// UtcTime is when it happened (and TimeCreated is when it was logged)
+		timestamp, err := time.Parse("2006-01-02 15:04:05.999", lookupJSONString(object, "Event.EventData.UtcTime"))
+		if err != nil {
+			timestamp, err = time.Parse(time.RFC3339Nano, lookupJSONString(object, "Event.System.TimeCreated.#attributes.SystemTime", "Event.System.TimeCreated.SystemTime"))
+			if err != nil {
+				continue
+			}
+		}
+		events = append(events, &SensorEvent{
+			timestamp: timestamp,
+			category: category,
+			processName: lookupJSONString(object, "Event.EventData.Image"),
+			commandLine: lookupJSONString(object, "Event.EventData.CommandLine"),
+			path: lookupJSONString(object, "Event.EventData.TargetFilename"),
+			destAddr: lookupJSONString(object, "Event.EventData.DestinationIp"),
+			destHost: lookupJSONString(object, "Event.EventData.DestinationHostname"),
+			destPort: lookupJSONInt(object, "Event.EventData.DestinationPort"),
+		})
+	}
+	return events, nil
+}
+
+// Reads osquery's logged results (differential, with each row under columns, or snapshots), from the *_events tables (ie.
+// process_events, file_events, socket_events, and es_process_events)
+type OsqueryParser struct {
+}
+
+func (parser *OsqueryParser) ParseEvents(contents []byte) ([]*SensorEvent, error) {
+	objects, err := decodeJSONObjects(contents)
+	if err != nil {
+		return nil, err
+	}
+	events := []*SensorEvent{}
+	for _, object := range objects {
+		name := lookupJSONString(object, "name")
+		category := ""
+		switch {
+		case strings.Contains(name, "process"):
+			category = "process"
+		case strings.Contains(name, "file"):
+			category = "file"
+		case strings.Contains(name, "socket"):
+			category = "network"
+		default:
+			continue
+		}
+
+		rows := []map[string]any{}
+		if columns, ok := object["columns"].(map[string]any); ok {
+			rows = append(rows, columns)
+		}
+		if snapshot, ok := object["snapshot"].([]any); ok {
+			for _, row := range snapshot {
+				if columns, ok := row.(map[string]any); ok {
+					rows = append(rows, columns)
+				}
+			}
+		}
+		for _, row := range rows {
+			// The row's own time is when it happened (and unixTime is when the query ran)
+			unixTime := lookupJSONInt(row, "time")
+			if unixTime == 0 {
+				unixTime = lookupJSONInt(object, "unixTime")
+			}
+			if unixTime == 0 {
+				continue
+			}
+			events = append(events, &SensorEvent{
+				timestamp: time.Unix(int64(unixTime), 0),
+				category: category,
+				processName: lookupJSONString(row, "path"),
+				commandLine: lookupJSONString(row, "cmdline"),
+				path: lookupJSONString(row, "target_path", "path"),
+				destAddr: lookupJSONString(row, "remote_address"),
+				destPort: lookupJSONInt(row, "remote_port"),
+			})
+		}
+	}
+	return events, nil
+}
+
+// Reads Elastic Common Schema events (ie. from Elastic Defend, or exported by Winlogbeat or Auditbeat), categorized by event.category
+type ECSParser struct {
+}
+
+func (parser *ECSParser) ParseEvents(contents []byte) ([]*SensorEvent, error) {
+	objects, err := decodeJSONObjects(contents)
+	if err != nil {
+		return nil, err
+	}
+	events := []*SensorEvent{}
+	for _, object := range objects {
+		// Documents exported from Elasticsearch have the event under _source
+		if source, ok := object["_source"].(map[string]any); ok {
+			object = source
+		}
+		category := lookupJSONString(object, "event.category")
+		if category != "process" && category != "file" && category != "network" {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, lookupJSONString(object, "@timestamp"))
+		if err != nil {
+			continue
+		}
+		events = append(events, &SensorEvent{
+			timestamp: timestamp,
+			category: category,
+			processName: lookupJSONString(object, "process.executable", "process.name"),
+			commandLine: lookupJSONString(object, "process.command_line"),
+			path: lookupJSONString(object, "file.path"),
+			destAddr: lookupJSONString(object, "destination.ip"),
+			destHost: lookupJSONString(object, "destination.domain", "url.domain", "dns.question.name"),
+			destPort: lookupJSONInt(object, "destination.port"),
+		})
+	}
+	return events, nil
+}
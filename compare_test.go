@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a log of an execute, a create, a send, and a delete a few seconds apart (and a listen, which isn't compared)
+func writeTestCompareLog(t *testing.T, path string) {
+	entries := []*ActivityLogEntry{
+		{timestamp: "2024-11-05T12:00:00Z", activity: "execute", processCmd: "whoami /all", status: "exit status 0", runId: "run-1", seq: 1},
+		{timestamp: "2024-11-05T12:00:05Z", activity: "create", processCmd: "create C:\\Users\\Nick\\dropped.txt payload", path: "C:\\Users\\Nick\\dropped.txt", status: "created", runId: "run-1", seq: 2},
+		{timestamp: "2024-11-05T12:00:10Z", activity: "send", processCmd: "send GET 10.0.0.5 443 https", destAddr: "10.0.0.5", destPort: 443, status: "sent", runId: "run-1", seq: 3},
+		{timestamp: "2024-11-05T12:00:15Z", activity: "delete", processCmd: "delete C:\\Users\\Nick\\dropped.txt", path: "C:\\Users\\Nick\\dropped.txt", status: "deleted", runId: "run-1", seq: 4},
+		{timestamp: "2024-11-05T12:00:20Z", activity: "listen", processCmd: "listen 8080 tcp", destPort: 8080, status: "stopped", runId: "run-1", seq: 5},
+	}
+	contents := getCSVFileHeader()
+	for _, entry := range entries {
+		contents += strings.Join(serializeToCSV(entry), ",") + "\n"
+	}
+	os.WriteFile(path, []byte(contents), 0644)
+}
+
+// Sysmon saw the execute (event 1), the create (event 11), and the send (event 3), but not the delete
+const TestSysmonExport = `[
+	{"Event": {"System": {"EventID": 1, "TimeCreated": {"#attributes": {"SystemTime": "2024-11-05T12:00:01.5Z"}}}, "EventData": {"UtcTime": "2024-11-05 12:00:01.250", "Image": "C:\\Windows\\System32\\whoami.exe", "CommandLine": "whoami /all"}}},
+	{"Event": {"System": {"EventID": 11}, "EventData": {"UtcTime": "2024-11-05 12:00:05.100", "TargetFilename": "C:\\Users\\nick\\dropped.txt"}}},
+	{"Event": {"System": {"EventID": 3}, "EventData": {"UtcTime": "2024-11-05 12:00:10.900", "DestinationIp": "10.0.0.5", "DestinationPort": "443"}}},
+	{"Event": {"System": {"EventID": 3}, "EventData": {"UtcTime": "2024-11-05 12:00:16.000", "DestinationIp": "10.0.0.9", "DestinationPort": "443"}}}
+]`
+
+func TestMain_Compare(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCompareLog(t, dir + "/campaign-log.csv")
+	os.WriteFile(dir + "/sysmon.json", []byte(TestSysmonExport), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "compare", dir + "/campaign-log.csv", dir + "/sysmon.json"}
+	output := callMain(args)
+	assert.Contains(t, output, "Compared 4 entries in " + dir + "/campaign-log.csv with 4 sysmon events in " + dir + "/sysmon.json (within 5s)\n")
+	assert.Contains(t, output, "file      delete    1          0         0.0%\n")
+	assert.Contains(t, output, "TOTAL               4          3         75.0%\n")
+	assert.Contains(t, output, "2024-11-05T12:00:15Z  delete    C:\\Users\\Nick\\dropped.txt  run-1 #4\n")
+	assert.Contains(t, output, "1 entries weren't compared")
+	assert.Equal(t, activityLogEntry.activity, "compare")
+	assert.Equal(t, activityLogEntry.method, "sysmon")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "3 of 4 entries detected (75.0% coverage) in " + dir + "/sysmon.json")
+}
+
+func TestMain_Compare_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCompareLog(t, dir + "/campaign-log.csv")
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "compare", dir + "/campaign-log.csv", dir + "/nonexistent.json"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "not_found")
+}
+
+func TestMain_Compare_NotEnoughArguments(t *testing.T) {
+	args := []string{"./noisemaker", "compare", "activity-log.csv"}
+	assertMainPanicsWithMessage(t, args, "not enough arguments for compare! Args: [activity-log.csv]")
+}
+
+func TestRunCompare_Osquery(t *testing.T) {
+	// Differential results (one row each) and a snapshot, as JSON lines
+	dir := t.TempDir()
+	writeTestCompareLog(t, dir + "/campaign-log.csv")
+	export := `{"name":"process_events","unixTime":1730808010,"columns":{"path":"/usr/bin/whoami","cmdline":"whoami /all","time":"1730808000"},"action":"added"}
+{"name":"file_events","unixTime":1730808020,"columns":{"target_path":"C:\\Users\\Nick\\dropped.txt","action":"CREATED","time":"1730808006"},"action":"added"}
+{"name":"socket_events","unixTime":1730808020,"snapshot":[{"remote_address":"10.0.0.5","remote_port":"443","time":"1730808011"}]}
+{"name":"file_events","unixTime":1730808020,"columns":{"target_path":"C:\\Users\\Nick\\dropped.txt","action":"DELETED","time":"1730808015"},"action":"added"}
+`
+	os.WriteFile(dir + "/osquery.log", []byte(export), 0644)
+	options, err := parseCompareOptions([]string{"--run-id=run-1", dir + "/campaign-log.csv", dir + "/osquery.log"})
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	response, err := runCompare(options, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, "osquery", response.report.Format)
+	assert.Equal(t, 4, response.report.Detected)
+	assert.Empty(t, response.report.Missed)
+}
+
+func TestRunCompare_ECS(t *testing.T) {
+	// Exported from Elasticsearch (under _source), with flattened and nested fields, and outside the window for the send
+	dir := t.TempDir()
+	writeTestCompareLog(t, dir + "/campaign-log.csv")
+	export := `{"_source":{"@timestamp":"2024-11-05T12:00:00.300Z","event":{"category":["process"]},"process.name":"whoami","process.command_line":"whoami /all"}}
+{"_source":{"@timestamp":"2024-11-05T12:00:05.300Z","event.category":"file","file":{"path":"c:\\users\\nick\\dropped.txt"}}}
+{"_source":{"@timestamp":"2024-11-05T12:00:30.000Z","event.category":"network","destination":{"ip":"10.0.0.5","port":443}}}
+`
+	os.WriteFile(dir + "/ecs.json", []byte(export), 0644)
+	options, err := parseCompareOptions([]string{"--window=2s", "--output-format=json", dir + "/campaign-log.csv", dir + "/ecs.json"})
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	response, err := runCompare(options, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, "ecs", response.report.Format)
+	assert.Equal(t, 2, response.report.Detected)
+	assert.Equal(t, []string{"send", "delete"}, []string{response.report.Missed[0].Activity, response.report.Missed[1].Activity})
+	assert.Contains(t, out.String(), `"target": "10.0.0.5:443"`)
+}
+
+func TestMatchesSensorEvent(t *testing.T) {
+	// Hostnames only match when the sensor resolved the host (otherwise, just the port has to)
+	entry := &ActivityLogEntry{destAddr: "www.postman-echo.com/post", destPort: 443}
+	assert.True(t, matchesSensorEvent(entry, &SensorEvent{category: "network", destAddr: "3.210.94.60", destPort: 443}))
+	assert.True(t, matchesSensorEvent(entry, &SensorEvent{category: "network", destAddr: "3.210.94.60", destHost: "WWW.postman-echo.com.", destPort: 443}))
+	assert.False(t, matchesSensorEvent(entry, &SensorEvent{category: "network", destAddr: "3.210.94.60", destHost: "example.com", destPort: 443}))
+	assert.False(t, matchesSensorEvent(entry, &SensorEvent{category: "network", destAddr: "3.210.94.60", destPort: 80}))
+	entry = &ActivityLogEntry{destAddr: "[2600:1f18::5]", destPort: 443}
+	assert.True(t, matchesSensorEvent(entry, &SensorEvent{category: "network", destAddr: "2600:1f18::5", destPort: 443}))
+
+	// Relative paths match the end of the sensor's
+	entry = &ActivityLogEntry{path: "./test.txt"}
+	assert.True(t, matchesSensorEvent(entry, &SensorEvent{category: "file", path: "/home/nick/test.txt"}))
+	assert.False(t, matchesSensorEvent(entry, &SensorEvent{category: "file", path: "/home/nick/other-test.txt"}))
+
+	// Programs match by name, from the image or the command line
+	entry = &ActivityLogEntry{processCmd: "cmd /c dir"}
+	assert.True(t, matchesSensorEvent(entry, &SensorEvent{category: "process", commandLine: "\"C:\\Windows\\System32\\cmd.exe\" /c dir"}))
+	assert.False(t, matchesSensorEvent(entry, &SensorEvent{category: "process", processName: "C:\\Windows\\System32\\whoami.exe"}))
+}
+
+func TestDetectSensorExportFormat(t *testing.T) {
+	format, err := detectSensorExportFormat([]byte(TestSysmonExport))
+	assert.Nil(t, err)
+	assert.Equal(t, "sysmon", format)
+	format, err = detectSensorExportFormat([]byte(`{"@timestamp":"2024-11-05T12:00:00Z"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "ecs", format)
+	_, err = detectSensorExportFormat([]byte(`{"timestamp":"2024-11-05T12:00:00Z"}`))
+	assert.ErrorContains(t, err, "unable to detect the sensor export's format (give it with --format=sysmon|osquery|ecs)")
+	_, err = parseCompareOptions([]string{"--format=splunk", "activity-log.csv", "export.json"})
+	assert.ErrorContains(t, err, "invalid format 'splunk' (must be sysmon, osquery, ecs)")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// A well-known container escape indicator to probe, and how: connecting to a runtime's socket (then closing it without any request),
+// reading a file, or looking up a binary on the PATH
+type ContainerProbe struct {
+	kind				string		// connect, open, read, or lookup
+	path				string		// the socket, pipe, or file (or the binary's name, for lookup)
+	description			string		// what an escape would use it for
+}
+
+// Response data from containerprobe action
+type ContainerProbeResponse struct {
+	accessed			int
+	denied				int
+	missing				int
+	status				string
+}
+
+// Gets the well-known container escape indicators for the given OS, relative to the given home directory
+func getContainerProbes(goos string, homeDir string) []ContainerProbe {
+	switch goos {
+	case "windows":
+		return []ContainerProbe{
+			{"open", `\\.\pipe\docker_engine`, "Docker daemon pipe"},
+			{"open", `\\.\pipe\containerd-containerd`, "containerd pipe"},
+			{"lookup", "docker", "Docker CLI"},
+		}
+	case "darwin":
+		return []ContainerProbe{
+			{"connect", "/var/run/docker.sock", "Docker daemon socket"},
+			{"connect", filepath.Join(homeDir, ".docker", "run", "docker.sock"), "Docker Desktop socket"},
+			{"lookup", "docker", "Docker CLI"},
+		}
+	default:
+		// linux, freebsd, etc.
+		return []ContainerProbe{
+			{"connect", "/var/run/docker.sock", "Docker daemon socket"},
+			{"connect", "/run/containerd/containerd.sock", "containerd socket"},
+			{"connect", "/run/crio/crio.sock", "CRI-O socket"},
+			{"connect", "/run/podman/podman.sock", "Podman socket"},
+			{"read", "/proc/1/cgroup", "init process's cgroups"},
+			{"read", "/proc/self/cgroup", "own cgroups"},
+			{"read", "/proc/self/mountinfo", "own mounts"},
+			{"read", "/.dockerenv", "Docker container marker"},
+			{"lookup", "nsenter", "namespace entry tool"},
+			{"lookup", "unshare", "namespace creation tool"},
+		}
+	}
+}
+
+// Probes each of the container escape indicators (read-only), logging each attempt as an access activity (with how it was probed as
+// its method)
+func probeContainerIndicators(activityLog Sink, parent *ActivityLogEntry, probes []ContainerProbe) *ContainerProbeResponse {
+	response := new(ContainerProbeResponse)
+	for _, probe := range probes {
+		entry := newChildLogEntry(parent, "access")
+		entry.path = escapeRawText(probe.path)
+		entry.method = probe.kind
+		details := probe.description
+		var found string
+		entry.status, found = probeContainerIndicator(probe)
+		if found != "" {
+			details += ", " + found
+		}
+		entry.details = escapeRawText(details)
+
+		switch entry.status {
+		case "accessed", "discovered":
+			response.accessed += 1
+			fmt.Printf("Probed %s (%s): %s\n", probe.path, probe.description, entry.status)
+		case "no_access":
+			response.denied += 1
+			fmt.Printf("Access denied to %s (%s)\n", probe.path, probe.description)
+		default:
+			response.missing += 1
+		}
+		writeLogEntry(activityLog, entry)
+	}
+
+	fmt.Printf("Probed %d container escape indicators: %d accessed, %d denied, %d not found or errored\n", len(probes), response.accessed, response.denied, response.missing)
+	response.status = "completed"
+	return response
+}
+
+// Probes the indicator, and returns the result (and what was found: how much was read, or where a binary is)
+func probeContainerIndicator(probe ContainerProbe) (string, string) {
+	var err error
+	switch probe.kind {
+	case "connect":
+		var conn net.Conn
+		conn, err = net.DialTimeout("unix", probe.path, time.Second)
+		if err == nil {
+			conn.Close()
+			return "accessed", ""
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			// (the socket's there, but nothing's listening on it)
+			return "closed", ""
+		}
+	case "open":
+		var f *os.File
+		f, err = os.Open(probe.path)
+		if err == nil {
+			f.Close()
+			return "accessed", ""
+		}
+	case "read":
+		var contents []byte
+		contents, err = os.ReadFile(probe.path)
+		if err == nil {
+			return "accessed", fmt.Sprintf("%d bytes read", len(contents))
+		}
+	case "lookup":
+		var path string
+		path, err = exec.LookPath(probe.path)
+		if err == nil {
+			return "discovered", "at " + path
+		}
+		return "not_found", ""
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return "not_found", ""
+	} else if errors.Is(err, fs.ErrPermission) {
+		return "no_access", ""
+	}
+	return "error", ""
+}
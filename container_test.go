@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeContainerIndicators(t *testing.T) {
+	// Precondition: a socket that's listening, one that isn't, and a file to read
+	dir := t.TempDir()
+	listener, err := net.Listen("unix", dir + "/docker.sock")
+	assert.Nil(t, err)
+	defer listener.Close()
+	stale, err := net.Listen("unix", dir + "/containerd.sock")
+	assert.Nil(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	assert.Nil(t, os.WriteFile(dir + "/cgroup", []byte("0::/system.slice/docker-1a2b3c.scope\n"), 0644))
+
+	recorder := newRunRecorderSink()
+	parent := newActivityLogEntry("containerprobe", nil)
+	parent.runId = "container-run"
+	response := probeContainerIndicators(recorder, parent, []ContainerProbe{
+		{"connect", dir + "/docker.sock", "Docker daemon socket"},
+		{"connect", dir + "/containerd.sock", "containerd socket"},
+		{"connect", dir + "/crio.sock", "CRI-O socket"},
+		{"read", dir + "/cgroup", "init process's cgroups"},
+		{"lookup", "go", "Go toolchain"},
+		{"lookup", "no-such-nsenter", "namespace entry tool"},
+	})
+	assert.Equal(t, "completed", response.status)
+	assert.Equal(t, 3, response.accessed)
+	assert.Equal(t, 3, response.missing)
+
+	// Each probe's logged with how it was probed, and what it found
+	entries := recorder.getEntries("container-run")
+	assert.Len(t, entries, 6)
+	assert.Equal(t, "access", entries[0].activity)
+	assert.Equal(t, "connect", entries[0].method)
+	assert.Equal(t, "accessed", entries[0].status)
+	assert.Equal(t, "closed", entries[1].status)
+	assert.Equal(t, "not_found", entries[2].status)
+	assert.Equal(t, "accessed", entries[3].status)
+	assert.Equal(t, "init process's cgroups\\, 37 bytes read", entries[3].details)
+	assert.Equal(t, "discovered", entries[4].status)
+	assert.Contains(t, entries[4].details, "Go toolchain\\, at ")
+	assert.Equal(t, "not_found", entries[5].status)
+}
+
+func TestMain_ContainerProbe(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "containerprobe"})
+	assert.Contains(t, output, "container escape indicators: ")
+	assert.Equal(t, activityLogEntry.activity, "containerprobe")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assertLogFileContains(t, logFilePath, ",access,")
+}
+
+func TestGetContainerProbes(t *testing.T) {
+	for _, goos := range []string{"windows", "linux", "darwin"} {
+		probes := getContainerProbes(goos, "/home/nick")
+		assert.NotEmpty(t, probes)
+		for _, probe := range probes {
+			assert.Contains(t, []string{"connect", "open", "read", "lookup"}, probe.kind)
+			assert.NotEmpty(t, probe.description)
+		}
+	}
+}
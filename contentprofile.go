@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The content profiles create and update can generate a file's contents with (what it starts with, and how random the rest is)
+var ContentProfiles = []string{"text", "random", "pe", "elf", "pdf", "zip", "png", "jpeg"}
+
+// The entropy (in bits per byte) each profile's filler is generated at, without an -entropy (text is words, rather than random)
+var DefaultProfileEntropies = map[string]float64{"random": 8, "pe": 6, "elf": 6, "pdf": 7.5, "zip": 8, "png": 7.9, "jpeg": 7.9}
+
+// The types files with each extension are declared to be (the ones their magic bytes would say, if they weren't masquerading)
+var ExtensionTypes = map[string]string{
+	"exe": "pe", "dll": "pe", "scr": "pe", "sys": "pe", "cpl": "pe", "elf": "elf", "so": "elf", "pdf": "pdf", "zip": "zip", "docx": "zip",
+	"xlsx": "zip", "pptx": "zip", "jar": "zip", "apk": "zip", "gz": "gzip", "tgz": "gzip", "png": "png", "jpg": "jpeg", "jpeg": "jpeg",
+	"txt": "text", "csv": "text", "log": "text", "md": "text", "ini": "text", "json": "text", "xml": "text", "html": "text", "ps1": "text",
+	"bat": "text", "cmd": "text", "sh": "text", "js": "text", "vbs": "text", "hta": "text",
+}
+
+// The extensions that make a file run when it's opened (the real extension of a double-extension file, ie. invoice.pdf.exe)
+var ExecutableExtensions = []string{"exe", "scr", "com", "pif", "cpl", "msi", "bat", "cmd", "ps1", "vbs", "js", "hta", "lnk"}
+
+// The size generated contents are, without a -size (or for update, a file to overwrite)
+const DefaultGeneratedFileSize = 4 << 10
+
+// The characters text filler (at a given -entropy) is made of, the most common first
+const ContentProfileTextChars = " etaoinshrdlucmfwypvbgkqjxzETAOINSHRDLUCMFWYPVBGKQJXZ0123456789.,;:!?'\"-()\n"
+
+// The words text filler (without an -entropy) is made of
+var ContentProfileWords = strings.Fields("the of and to in is that for it as with was on be by this are from at or an have not which but they all has were their one been more when will there can would who other into some could them time these only then also than its new after first two may any over such our most where those about")
+
+// The largest entropy text filler can be generated at (with every one of the text characters equally likely)
+var MaxTextEntropy = math.Log2(float64(len(ContentProfileTextChars)))
+
+// A profile (and entropy) to generate a file's contents with, to look like the files a sensor's detections key on (ie. ransomware's
+// high-entropy output), or the types they check the magic bytes of
+type ContentProfile struct {
+	name				string
+	entropy				float64		// the filler's entropy, in bits per byte (-1 for the profile's own)
+}
+
+// Adds the -profile and -entropy flags to a command's flags, returning a function that gets the profile they give (nil without either)
+func addContentProfileFlags(flags *flag.FlagSet) func() (*ContentProfile, error) {
+	name := flags.String("profile", "", "generates the contents with a profile: text, random, pe, pdf, or zip (default the contents given)")
+	entropy := flags.Float64("entropy", -1, "the entropy (in bits per byte, from 0 to 8) of the generated contents (default the profile's)")
+	return func() (*ContentProfile, error) {
+		if *name == "" && *entropy < 0 {
+			return nil, nil
+		}
+		profile := &ContentProfile{name: *name, entropy: *entropy}
+		if profile.name == "" {
+			profile.name = "random"
+		}
+		if !containsString(ContentProfiles, profile.name) {
+			return nil, fmt.Errorf("invalid -profile %s (must be one of %v)", profile.name, ContentProfiles)
+		}
+		if *entropy != -1 && (*entropy < 0 || *entropy > 8) {
+			return nil, fmt.Errorf("invalid -entropy %v (must be from 0 to 8)", *entropy)
+		}
+		if profile.name == "text" && profile.entropy > MaxTextEntropy {
+			return nil, fmt.Errorf("invalid -entropy %v (text must be at most %.2f)", *entropy, MaxTextEntropy)
+		}
+		return profile, nil
+	}
+}
+
+// Gets the formatted flags the profile was given with, to pass it on to another command (ie. update, for each file a glob matches)
+func (profile *ContentProfile) getArgs() []string {
+	if profile == nil {
+		return []string{}
+	}
+	args := []string{"-profile=" + profile.name}
+	if profile.entropy >= 0 {
+		args = append(args, fmt.Sprintf("-entropy=%v", profile.entropy))
+	}
+	return args
+}
+
+// Gets the magic bytes (and header) files of the profile start with
+func (profile *ContentProfile) getHeader() []byte {
+	switch profile.name {
+	case "pe":
+		// (a DOS header pointing at a PE header for x64, after the DOS stub)
+		header := make([]byte, 0x86)
+		copy(header, "MZ")
+		binary.LittleEndian.PutUint32(header[0x3c:], 0x80)
+		copy(header[0x40:], "\x0e\x1f\xba\x0e\x00\xb4\x09\xcd\x21\xb8\x01\x4c\xcd\x21This program cannot be run in DOS mode.\r\r\n$")
+		copy(header[0x80:], "PE\x00\x00\x64\x86")
+		return header
+	case "elf":
+		// (an ELF header for a 64-bit little-endian x86-64 executable)
+		return []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00\x01\x00\x00\x00")
+	case "pdf":
+		return []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	case "png":
+		// (the signature, and an image header chunk)
+		return []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR\x00\x00\x04\x00\x00\x00\x03\x00\x08\x02\x00\x00\x00")
+	case "jpeg":
+		// (a start of image marker, and a JFIF header)
+		return []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")
+	case "zip":
+		// (a local file header, for a deflated entry)
+		return []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00\x00\x00\x21\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0c\x00\x00\x00document.xml")
+	}
+	return []byte{}
+}
+
+// Generates size bytes of filler at the profile's entropy (up to a chunk of them, since a large file's filler is repeated to fill it)
+func (profile *ContentProfile) getFiller(size int64, random *rand.Rand) []byte {
+	filler := make([]byte, min(size, sizedFileChunkSize))
+	entropy := profile.entropy
+	if entropy < 0 && profile.name == "text" {
+		// (words, as a document would have)
+		for i := 0; i < len(filler); {
+			i += copy(filler[i:], ContentProfileWords[random.Intn(len(ContentProfileWords))] + " ")
+		}
+		return filler
+	} else if entropy < 0 {
+		entropy = DefaultProfileEntropies[profile.name]
+	}
+
+	symbols := ContentProfileTextChars
+	if profile.name != "text" {
+		symbols = string(getByteValues(random))
+	}
+	count, first := getEntropyWeights(entropy)
+	for i := range filler {
+		filler[i] = symbols[pickWeighted(count, first, random.Float64())]
+	}
+	return filler
+}
+
+// Generates the header, and filler (repeated to fill the rest), of a file's contents of the size
+func (profile *ContentProfile) generateSized(size int64, random *rand.Rand) (string, string) {
+	header := profile.getHeader()
+	if int64(len(header)) >= size {
+		return string(header[:size]), ""
+	}
+	return string(header), string(profile.getFiller(size - int64(len(header)), random))
+}
+
+// Generates the whole of a file's contents of the size: the profile's header, then its filler
+func (profile *ContentProfile) generate(size int64, random *rand.Rand) string {
+	header, filler := profile.generateSized(size, random)
+	contents := new(strings.Builder)
+	contents.WriteString(header)
+	for int64(contents.Len()) < size {
+		contents.WriteString(filler[:min(int64(len(filler)), size - int64(contents.Len()))])
+	}
+	return contents.String()
+}
+
+// Gets a new random number generator for generating contents
+func newContentRandom() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// Gets every byte value, in a random order
+func getByteValues(random *rand.Rand) []byte {
+	values := make([]byte, 256)
+	for i, value := range random.Perm(256) {
+		values[i] = byte(value)
+	}
+	return values
+}
+
+// Gets the fewest symbols that can have the entropy (in bits per symbol), and the probability of the first (the rest share what's left
+// equally), found by bisection (since the entropy falls as the first's probability rises)
+func getEntropyWeights(entropy float64) (int, float64) {
+	count := max(1, int(math.Ceil(math.Pow(2, entropy) - 1e-9)))
+	if count == 1 {
+		return 1, 1
+	}
+	low, high := 1 / float64(count), 1.0
+	for i := 0; i < 50; i++ {
+		first := (low + high) / 2
+		if getWeightsEntropy(first, count) > entropy {
+			low = first
+		} else {
+			high = first
+		}
+	}
+	return count, (low + high) / 2
+}
+
+// Gets the entropy of count symbols, the first with the probability, and the rest sharing what's left equally
+func getWeightsEntropy(first float64, count int) float64 {
+	rest := (1 - first) / float64(count - 1)
+	entropy := -first * math.Log2(first)
+	if rest > 0 {
+		entropy -= float64(count - 1) * rest * math.Log2(rest)
+	}
+	return entropy
+}
+
+// Picks one of count symbols, the first with the probability (and the rest sharing what's left equally), given a random number from 0
+// to 1
+func pickWeighted(count int, first float64, value float64) int {
+	if value < first || count == 1 {
+		return 0
+	}
+	return min(count - 1, 1 + int((value - first) / ((1 - first) / float64(count - 1))))
+}
+
+// Counts each byte value in the contents
+func countBytes(counts *[256]int64, contents string, times int64) {
+	for i := 0; i < len(contents); i++ {
+		counts[contents[i]] += times
+	}
+}
+
+// Gets the Shannon entropy (in bits per byte) of the byte values counted
+func getEntropy(counts *[256]int64) float64 {
+	total := int64(0)
+	for _, count := range counts {
+		total += count
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(total)
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// Gets the entropy of a file of the size made of the header, then the contents repeated to fill it (or zeros, without any, or if it's
+// sparse), without reading it back
+func getSizedFileEntropy(header string, contents string, size int64, sparse bool) float64 {
+	var counts [256]int64
+	countBytes(&counts, header, 1)
+	rest := size - int64(len(header))
+	if sparse {
+		countBytes(&counts, contents, 1)
+		counts[0] += rest - int64(len(contents))
+	} else if contents == "" {
+		counts[0] += rest
+	} else {
+		countBytes(&counts, contents, rest / int64(len(contents)))
+		countBytes(&counts, contents[:rest % int64(len(contents))], 1)
+	}
+	return getEntropy(&counts)
+}
+
+// Gets the type a file's magic bytes say it is: pe, elf, macho, pdf, zip, gzip, png, jpeg, or else text (if it's valid UTF-8, without
+// control characters besides whitespace), or data
+func getMagicType(contents string) string {
+	for _, magic := range [][2]string{{"MZ", "pe"}, {"\x7fELF", "elf"}, {"\xcf\xfa\xed\xfe", "macho"}, {"%PDF-", "pdf"}, {"PK\x03\x04", "zip"}, {"\x1f\x8b", "gzip"}, {"\x89PNG", "png"}, {"\xff\xd8\xff", "jpeg"}} {
+		if strings.HasPrefix(contents, magic[0]) {
+			return magic[1]
+		}
+	}
+	if !utf8.ValidString(contents) {
+		return "data"
+	}
+	for _, char := range contents {
+		if char < 0x20 && !strings.ContainsRune("\t\n\r", char) {
+			return "data"
+		}
+	}
+	return "text"
+}
+
+// Gets a path's extensions: its last, and before it, the one a double extension hides the last behind (ie. "pdf" and "exe" for
+// invoice.pdf.exe), or "" if it doesn't have a double extension
+func getPathExtensions(path string) (string, string) {
+	name := strings.ToLower(filepath.Base(path))
+	extension := strings.TrimPrefix(filepath.Ext(name), ".")
+	if !containsString(ExecutableExtensions, extension) {
+		return extension, ""
+	}
+	inner := strings.TrimPrefix(filepath.Ext(strings.TrimRight(strings.TrimSuffix(name, "." + extension), " ")), ".")
+	if ExtensionTypes[inner] == "" || containsString(ExecutableExtensions, inner) {
+		// (ie. setup.x86.exe)
+		return extension, ""
+	}
+	return extension, inner
+}
+
+// Describes the type a file's extension declares it to be, and whether its magic bytes say it's that, for an entry's details (ie.
+// "declared jpeg (.jpg), mismatched"), returning whether it has a mismatched extension, or a double one, too
+func getDeclaredTypeDetails(path string, magicType string) (string, bool, bool) {
+	extension, inner := getPathExtensions(path)
+	declared := ExtensionTypes[extension]
+	details := "declared none"
+	if extension != "" && declared == "" {
+		details = fmt.Sprintf("declared unknown (.%s)", extension)
+	} else if inner != "" {
+		details = fmt.Sprintf("declared %s (.%s.%s, a double extension, looks like %s)", declared, inner, extension, getExtensionType(inner))
+	} else if extension != "" {
+		details = fmt.Sprintf("declared %s (.%s)", declared, extension)
+	}
+	mismatched := declared != "" && declared != magicType
+	if mismatched {
+		details += ", mismatched"
+	}
+	return details, mismatched, inner != ""
+}
+
+// Gets the type an extension declares a file to be, or unknown
+func getExtensionType(extension string) string {
+	if declared, found := ExtensionTypes[extension]; found {
+		return declared
+	}
+	return "unknown"
+}
+
+// Describes generated contents for an entry's details, ie. "entropy 7.99 bits/byte, magic pdf"
+func getContentDetails(entropy float64, magicType string) string {
+	return fmt.Sprintf("entropy %.2f bits/byte, magic %s", entropy, magicType)
+}
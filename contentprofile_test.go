@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Create_Profile(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// The file starts with the profile's magic bytes, and the entry records what it's measured at
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-profile=pdf", dir + "/invoice.pdf"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.Regexp(t, "^4096 bytes\\\\, entropy 7\\.[0-9]+ bits/byte\\\\, magic pdf\\\\, declared pdf \\(.pdf\\)$", activityLogEntry.details)
+	contents, err := os.ReadFile(dir + "/invoice.pdf")
+	assert.Nil(t, err)
+	assert.Len(t, contents, DefaultGeneratedFileSize)
+	assert.True(t, strings.HasPrefix(string(contents), "%PDF-1.7\n"))
+
+	// A large file, at the highest entropy (as encrypted output would be)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-size=3MB", "-entropy=8", dir + "/locked.bin"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.Contains(t, activityLogEntry.details, "3145728 bytes logical")
+	assert.Contains(t, activityLogEntry.details, "entropy 8.00 bits/byte\\, magic data\\, declared unknown (.bin)")
+	info, err := os.Stat(dir + "/locked.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3 << 20), info.Size())
+
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-profile=text", dir + "/notes.txt"})
+	assert.Regexp(t, "entropy [34]\\.[0-9]+ bits/byte\\\\, magic text\\\\, declared text \\(.txt\\)$", activityLogEntry.details)
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "create", "-profile=pe", dir + "/setup.exe", "hello"}, "can't be given contents too")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "create", "-profile=docx", dir + "/report.docx"}, "invalid -profile docx (must be one of [text random pe elf pdf zip png jpeg])")
+}
+
+func TestMain_Create_Masquerading(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// An executable's magic bytes, behind a picture's extension
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-profile=pe", dir + "/holiday.jpg"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.Regexp(t, "magic pe\\\\, declared jpeg \\(.jpg\\)\\\\, mismatched$", activityLogEntry.details)
+	assert.Equal(t, "extension-mismatch=true", activityLogEntry.labels)
+
+	// A double extension is added to the path, and the contents are what the real extension says they are
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-double-extension=exe", dir + "/invoice.pdf"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.Equal(t, dir + "/invoice.pdf.exe", activityLogEntry.path)
+	assert.Regexp(t, "magic pe\\\\, declared pe \\(.pdf.exe\\\\, a double extension\\\\, looks like pdf\\)$", activityLogEntry.details)
+	assert.Equal(t, "double-extension=true", activityLogEntry.labels)
+	contents, err := os.ReadFile(dir + "/invoice.pdf.exe")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(contents), "MZ"))
+
+	// (or both at once: a PDF's bytes behind a double extension)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-double-extension=scr", "-profile=pdf", dir + "/report.pdf"})
+	assert.Equal(t, "extension-mismatch=true;double-extension=true", activityLogEntry.labels)
+
+	// The contents given are kept
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-double-extension=.bat", dir + "/readme.txt", "@echo off"})
+	assert.Regexp(t, "magic text\\\\, declared text \\(.txt.bat\\\\, a double extension\\\\, looks like text\\)$", activityLogEntry.details)
+	assert.FileExists(t, dir + "/readme.txt.bat")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "create", "-double-extension=pdf", dir + "/invoice"}, "invalid -double-extension pdf (must be one of")
+}
+
+func TestMain_Update_Profile(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	assert.Nil(t, os.WriteFile(dir + "/report.txt", []byte(strings.Repeat("quarterly numbers\n", 1000)), 0644))
+
+	// The file's overwritten in place, at the same size
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "update", "-entropy=7.5", dir + "/report.txt"})
+	assert.Equal(t, "updated", activityLogEntry.status)
+	assert.Regexp(t, "^18000 bytes\\\\, entropy 7\\.[45][0-9] bits/byte\\\\, magic data\\\\, declared text \\(.txt\\)\\\\, mismatched$", activityLogEntry.details)
+	assert.Equal(t, "extension-mismatch=true", activityLogEntry.labels)
+	contents, err := os.ReadFile(dir + "/report.txt")
+	assert.Nil(t, err)
+	assert.Len(t, contents, 18000)
+	assert.NotContains(t, string(contents), "quarterly")
+}
+
+func TestGetEntropyWeights(t *testing.T) {
+	for _, entropy := range []float64{0, 0.5, 1, 3.3, 6, 7.5, 8} {
+		count, first := getEntropyWeights(entropy)
+		if count == 1 {
+			assert.Equal(t, 0.0, entropy)
+			continue
+		}
+		assert.InDelta(t, entropy, getWeightsEntropy(first, count), 0.0001)
+	}
+
+	// Generated filler comes out close to its entropy
+	random := rand.New(rand.NewSource(1))
+	for _, entropy := range []float64{2, 5.5, 7.9} {
+		filler := (&ContentProfile{name: "random", entropy: entropy}).getFiller(1 << 20, random)
+		assert.InDelta(t, entropy, getSizedFileEntropy("", string(filler), int64(len(filler)), false), 0.05)
+	}
+	filler := (&ContentProfile{name: "text", entropy: 4}).getFiller(4096, random)
+	assert.Equal(t, "text", getMagicType(string(filler)))
+}
+
+func TestGetSizedFileEntropy(t *testing.T) {
+	assert.Equal(t, 0.0, getSizedFileEntropy("", "", 100, false))
+	assert.Equal(t, 1.0, getSizedFileEntropy("", "ab", 1000, false))
+	// (half a's and b's, and half zeros)
+	assert.InDelta(t, 1.5, getSizedFileEntropy("ab", "", 4, false), 0.0001)
+	assert.InDelta(t, 1.5, getSizedFileEntropy("", "ab", 4, true), 0.0001)
+}
+
+func TestGetMagicType(t *testing.T) {
+	for _, profile := range []string{"pe", "elf", "pdf", "zip", "png", "jpeg"} {
+		assert.Equal(t, profile, getMagicType(string((&ContentProfile{name: profile}).getHeader())))
+	}
+	assert.Equal(t, "elf", getMagicType("\x7fELF\x02\x01"))
+	assert.Equal(t, "text", getMagicType("hello, world\r\n"))
+	assert.Equal(t, "data", getMagicType("hello\x00world"))
+}
+
+func TestGetDeclaredTypeDetails(t *testing.T) {
+	details, mismatched, double := getDeclaredTypeDetails("/tmp/Invoice.PDF", "pdf")
+	assert.Equal(t, "declared pdf (.pdf)", details)
+	assert.False(t, mismatched)
+	assert.False(t, double)
+
+	// (padded out, so the real extension's off the edge of the window)
+	details, mismatched, double = getDeclaredTypeDetails("/tmp/invoice.pdf          .exe", "pe")
+	assert.Equal(t, "declared pe (.pdf.exe, a double extension, looks like pdf)", details)
+	assert.False(t, mismatched)
+	assert.True(t, double)
+
+	// An archive's extensions aren't a double extension
+	_, _, double = getDeclaredTypeDetails("/tmp/backup.tar.gz", "gzip")
+	assert.False(t, double)
+	details, mismatched, _ = getDeclaredTypeDetails("/tmp/notes.txt", "data")
+	assert.Equal(t, "declared text (.txt), mismatched", details)
+	assert.True(t, mismatched)
+	details, _, _ = getDeclaredTypeDetails("/tmp/payload.xyz", "elf")
+	assert.Equal(t, "declared unknown (.xyz)", details)
+	details, _, _ = getDeclaredTypeDetails("/tmp/payload", "elf")
+	assert.Equal(t, "declared none", details)
+}
+
+func TestAddContentProfileFlags(t *testing.T) {
+	parse := func(args ...string) (*ContentProfile, error) {
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		getProfile := addContentProfileFlags(flags)
+		assert.Nil(t, flags.Parse(args))
+		return getProfile()
+	}
+	profile, err := parse()
+	assert.Nil(t, err)
+	assert.Nil(t, profile)
+
+	// An -entropy on its own is random filler
+	profile, err = parse("-entropy=7")
+	assert.Nil(t, err)
+	assert.Equal(t, &ContentProfile{name: "random", entropy: 7}, profile)
+	assert.Equal(t, []string{"-profile=random", "-entropy=7"}, profile.getArgs())
+
+	_, err = parse("-entropy=9")
+	assert.ErrorContains(t, err, "invalid -entropy 9 (must be from 0 to 8)")
+	_, err = parse("-profile=text", "-entropy=7")
+	assert.ErrorContains(t, err, "invalid -entropy 7 (text must be at most 6.")
+}
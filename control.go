@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often to check on a dispatched playbook
+const ControlPollInterval = 500 * time.Millisecond
+
+// Response data from control action
+type ControlResponse struct {
+	succeeded			int
+	failed				int
+	collected			int
+	status				string
+}
+
+// The outcome of dispatching a playbook to a single agent
+type AgentResult struct {
+	agentUrl			string
+	runId				string
+	entries				[]*ActivityLogEntry
+	status				string
+	err					error
+}
+
+// Dispatches the playbook to every agent at once (each as its own run, derived from the parent's), waits for each to finish (up to
+// the timeout), and collects their entries into the activity log, followed by a dispatch entry for each agent. Each agent's sent the
+// token it's given with (or else the default token).
+func controlAgents(activityLog Sink, parent *ActivityLogEntry, playbookContents []byte, agents []string, client *http.Client, defaultScheme string, defaultToken string, timeout time.Duration) *ControlResponse {
+	response := new(ControlResponse)
+	results := make([]*AgentResult, len(agents))
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agentUrl, token := normalizeAgentUrl(agent, defaultScheme)
+			if token == "" {
+				token = defaultToken
+			}
+			results[i] = dispatchPlaybook(client, agentUrl, token, playbookContents, getAgentRunId(unescapeRawText(parent.runId), i), timeout)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		// The agents' entries keep their own sequence numbers (and host details), so they're written as-is (each agent numbers its own run)
+		for _, entry := range result.entries {
+			writeRemoteLogEntry(activityLog, entry)
+		}
+		response.collected += len(result.entries)
+
+		entry := newChildLogEntry(parent, "dispatch")
+		entry.path = escapeRawText(result.agentUrl)
+		entry.status = result.status
+		agentUrl, err := url.Parse(result.agentUrl)
+		if err == nil {
+			entry.protocol = agentUrl.Scheme
+			entry.destAddr = agentUrl.Hostname()
+			entry.destPort, _ = strconv.Atoi(agentUrl.Port())
+		}
+		details := fmt.Sprintf("%d entries collected from run %s", len(result.entries), result.runId)
+		if result.err != nil {
+			details += fmt.Sprintf(" (%v)", result.err)
+			fmt.Printf("Agent %s failed: %v\n", result.agentUrl, result.err)
+		} else {
+			fmt.Printf("Agent %s %s, %d entries collected\n", result.agentUrl, result.status, len(result.entries))
+		}
+		entry.details = escapeRawText(details)
+		if result.status == "completed" {
+			response.succeeded += 1
+		} else {
+			response.failed += 1
+		}
+		writeLogEntry(activityLog, entry)
+	}
+
+	if response.failed == 0 {
+		response.status = "completed"
+	} else if response.succeeded > 0 {
+		response.status = "partial"
+	} else {
+		response.status = "error"
+	}
+	return response
+}
+
+// Each agent runs the playbook as its own run (ie. campaign.1, campaign.2, ...), since they each number their entries from 1
+func getAgentRunId(runId string, index int) string {
+	return runId + "." + strconv.Itoa(index + 1)
+}
+
+// Adds a scheme (and the daemon's default port) to an agent given as just a host, and splits off the token it's given with, if any
+// (as its user, ie. <token>@10.0.0.5), so it's never part of the URL that's logged
+func normalizeAgentUrl(agent string, defaultScheme string) (string, string) {
+	if !strings.Contains(agent, "://") {
+		agent = defaultScheme + "://" + agent
+	}
+	agentUrl, err := url.Parse(agent)
+	if err != nil {
+		return agent, ""
+	}
+	token := agentUrl.User.Username()
+	agentUrl.User = nil
+	if agentUrl.Port() == "" {
+		_, defaultPort := splitAddrAndPort(DefaultDaemonAddr)
+		agentUrl.Host = agentUrl.Host + ":" + strconv.Itoa(defaultPort)
+	}
+	return strings.TrimSuffix(agentUrl.String(), "/"), token
+}
+
+// Submits the playbook to a single agent's daemon, waits for it to finish, and collects the run's entries
+func dispatchPlaybook(client *http.Client, agentUrl string, token string, playbookContents []byte, runId string, timeout time.Duration) *AgentResult {
+	result := &AgentResult{agentUrl: agentUrl, runId: runId, status: "error"}
+
+	// Submit it
+	job := map[string]any{}
+	submitUrl := agentUrl + "/playbooks?" + url.Values{"runId": {runId}}.Encode()
+	statusCode, err := callAgent(client, http.MethodPost, submitUrl, token, playbookContents, &job)
+	if err != nil {
+		result.status = "unreachable"
+		result.err = err
+		return result
+	}
+	if statusCode != http.StatusAccepted {
+		result.err = fmt.Errorf("playbook rejected: %v", job["error"])
+		return result
+	}
+	jobId, _ := job["id"].(string)
+
+	// Wait for it
+	deadline := time.Now().Add(timeout)
+	for job["status"] == "queued" || job["status"] == "running" {
+		if time.Now().After(deadline) {
+			result.status = "timeout"
+			result.err = fmt.Errorf("playbook still %v after %v", job["status"], timeout)
+			break
+		}
+		if sleepContext(ControlPollInterval) != nil {
+			result.status = "cancelled"
+			result.err = fmt.Errorf("cancelled while playbook was still %v", job["status"])
+			break
+		}
+		_, err = callAgent(client, http.MethodGet, agentUrl + "/jobs/" + url.PathEscape(jobId), token, nil, &job)
+		if err != nil {
+			result.status = "unreachable"
+			result.err = err
+			return result
+		}
+	}
+	if result.err == nil {
+		result.status, _ = job["status"].(string)
+		if jobError, ok := job["error"].(string); ok && jobError != "" {
+			result.err = fmt.Errorf("%s", jobError)
+		}
+	}
+
+	// Collect whatever it logged (even if it failed, or is still running)
+	result.entries, err = collectAgentLog(client, agentUrl + "/jobs/" + url.PathEscape(jobId) + "/log")
+	if err != nil && result.err == nil {
+		result.err = err
+	}
+	return result
+}
+
+// Calls the agent's API with its token (and any body as a YAML playbook), decoding the JSON response into result
+func callAgent(client *http.Client, method string, agentUrl string, token string, body []byte, result *map[string]any) (int, error) {
+	request, err := http.NewRequestWithContext(runContext, method, agentUrl, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/yaml")
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer " + token)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	err = json.NewDecoder(io.LimitReader(response.Body, MaxDaemonRequestBytes)).Decode(result)
+	if err != nil {
+		return response.StatusCode, fmt.Errorf("invalid response from agent (%s): %v", response.Status, err)
+	}
+	return response.StatusCode, nil
+}
+
+// Downloads a run's CSV activity log from the agent, and parses its entries
+func collectAgentLog(client *http.Client, logUrl string) ([]*ActivityLogEntry, error) {
+	response, err := client.Get(logUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to collect log: %s", response.Status)
+	}
+	contents, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*ActivityLogEntry{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line == "" || isSchemaVersionStr(line) || isCSVHeaderStr(line) {
+			continue
+		}
+		row, err := splitCSVRow(line)
+		if err != nil {
+			continue
+		}
+		entry, err := deserializeFromCSV(row)
+		if err == nil && entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Writes an entry collected from somewhere else as-is, keeping its sequence number
+func writeRemoteLogEntry(activityLog Sink, activityLogEntry *ActivityLogEntry) {
+	logFileMutex.Lock()
+	defer logFileMutex.Unlock()
+	err := activityLog.WriteEntry(activityLogEntry)
+	check(err)
+}
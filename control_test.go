@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Control_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certs := createTestCertificates(t, dir)
+
+	// Precondition: an agent is running, and only accepts clients signed by our CA
+	agentAddr, tokenPath := startTestAgent(t, certs)
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte("name: remote-drop\nsteps:\n  - command: create\n    args: [\"" + dir + "/remote.txt\", \"payload\"]\n"), 0644)
+	logFilePath := dir + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=campaign", "-tls-cert=" + certs["client.pem"], "-tls-key=" + certs["client-key.pem"], "-tls-ca=" + certs["ca.pem"], "-daemon-token-file=" + tokenPath, "control", playbookPath, agentAddr}
+	output := callMain(args)
+	assert.Contains(t, output, "Dispatching playbook remote-drop to 1 agents...")
+	assert.Equal(t, activityLogEntry.activity, "control")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "1 of 1 agents completed\\, 2 entries collected")
+	assert.True(t, fileExists(dir + "/remote.txt"))
+
+	// The agent's entries should be collected into our log, as their own run
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Contains(t, contents, ",create,")
+	assert.Contains(t, contents, ",created,")
+	assert.Contains(t, contents, ",playbook,")
+	assert.Contains(t, contents, ",dispatch,")
+	assert.Contains(t, contents, "https://" + agentAddr + ",completed,")
+	assert.Contains(t, contents, "2 entries collected from run campaign.1")
+	assert.Equal(t, []string{"campaign.1,1", "campaign.1,2", "campaign,1", "campaign,2"}, readTestRunIdsAndSeqs(t, logFilePath))
+}
+
+func TestMain_Control_SeveralAgents(t *testing.T) {
+	dir := t.TempDir()
+	certs := createTestCertificates(t, dir)
+	agentAddrs := []string{}
+	for i := 0; i < 2; i++ {
+		// (each with its own token, given as the agent's user)
+		agentAddr, tokenPath := startTestAgent(t, certs)
+		agentAddrs = append(agentAddrs, readTestDaemonToken(t, tokenPath) + "@" + agentAddr)
+	}
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte("steps:\n  - command: create\n    args: [\"" + dir + "/remote.txt\"]\n"), 0644)
+	logFilePath := dir + "/activity-log.csv"
+
+	// Each agent's entries are numbered as their own run, so no two entries share a runId and seq
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=campaign", "-tls-cert=" + certs["client.pem"], "-tls-key=" + certs["client-key.pem"], "-tls-ca=" + certs["ca.pem"], "control", playbookPath, agentAddrs[0] + "," + agentAddrs[1]}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "completed")
+	runIdsAndSeqs := readTestRunIdsAndSeqs(t, logFilePath)
+	seen := map[string]bool{}
+	for _, runIdAndSeq := range runIdsAndSeqs {
+		assert.False(t, seen[runIdAndSeq], runIdAndSeq)
+		seen[runIdAndSeq] = true
+	}
+	// (each agent's create and playbook, then a dispatch for each agent and the control entry)
+	assert.Len(t, runIdsAndSeqs, 7)
+	for _, runIdAndSeq := range []string{"campaign.1,1", "campaign.1,2", "campaign.2,1", "campaign.2,2", "campaign,1", "campaign,2", "campaign,3"} {
+		assert.True(t, seen[runIdAndSeq], runIdAndSeq)
+	}
+}
+
+func TestMain_Control_WithoutClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certs := createTestCertificates(t, dir)
+	agentAddr, tokenPath := startTestAgent(t, certs)
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte("steps:\n  - command: create\n    args: [\"" + dir + "/remote.txt\"]\n"), 0644)
+
+	// Trusting the agent isn't enough, it has to trust us too
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "-tls-ca=" + certs["ca.pem"], "-daemon-token-file=" + tokenPath, "control", playbookPath, agentAddr}
+	output := callMain(args)
+	assert.Contains(t, output, "Agent https://" + agentAddr + " failed")
+	assert.Equal(t, activityLogEntry.status, "error")
+	assert.False(t, fileExists(dir + "/remote.txt"))
+	assertLogFileContains(t, dir + "/activity-log.csv", ",unreachable,")
+}
+
+func TestMain_Control_WithoutToken(t *testing.T) {
+	dir := t.TempDir()
+	certs := createTestCertificates(t, dir)
+	agentAddr, _ := startTestAgent(t, certs)
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte("steps:\n  - command: create\n    args: [\"" + dir + "/remote.txt\"]\n"), 0644)
+
+	// A client certificate isn't enough either, without the agent's token
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "-tls-cert=" + certs["client.pem"], "-tls-key=" + certs["client-key.pem"], "-tls-ca=" + certs["ca.pem"], "control", playbookPath, "not-the-token@" + agentAddr}
+	output := callMain(args)
+	assert.Contains(t, output, "Agent https://" + agentAddr + " failed: playbook rejected: missing or invalid bearer token")
+	assert.Equal(t, activityLogEntry.status, "error")
+	assert.False(t, fileExists(dir + "/remote.txt"))
+	assertLogFileContains(t, dir + "/activity-log.csv", ",https://" + agentAddr + ",error,")
+}
+
+func TestMain_Control_NotEnoughArguments(t *testing.T) {
+	args := []string{"./noisemaker", "control", "./playbook.yaml"}
+	assertMainPanicsWithMessage(t, args, "not enough arguments for control! Args: [./playbook.yaml]")
+}
+
+func TestNormalizeAgentUrl(t *testing.T) {
+	for _, test := range []struct{ agent, scheme, url, token string }{
+		{"10.0.0.5", "https", "https://10.0.0.5:7070", ""},
+		{"agent:8080", "http", "http://agent:8080", ""},
+		{"https://agent:9000/", "http", "https://agent:9000", ""},
+		{"abc123@10.0.0.5", "https", "https://10.0.0.5:7070", "abc123"},
+		{"https://abc123@agent:9000", "http", "https://agent:9000", "abc123"},
+	} {
+		agentUrl, token := normalizeAgentUrl(test.agent, test.scheme)
+		assert.Equal(t, test.url, agentUrl, test.agent)
+		assert.Equal(t, test.token, token, test.agent)
+	}
+}
+
+// Starts a daemon requiring client certificates, directly (since main() can't run twice at once), and stops it when the test's done,
+// returning its address and the path to its token
+func startTestAgent(t *testing.T, certs map[string]string) (string, string) {
+	addr := "127.0.0.1:" + strconv.Itoa(getFreeTestPort(t, "tcp"))
+	tlsConfig, err := getDaemonTLSConfig(certs["server.pem"], certs["server-key.pem"], certs["ca.pem"])
+	assert.Nil(t, err)
+	agentDir := t.TempDir()
+	tokenPath := agentDir + "/agent.token"
+	activityLog, err := newCSVFileSink(agentDir + "/agent-log.csv", false)
+	assert.Nil(t, err)
+	entry := newActivityLogEntry("daemon", nil)
+	entry.runId = "agent"
+
+	done := make(chan struct{})
+	go func() {
+		runDaemon(activityLog, entry, addr, tlsConfig, tokenPath)
+		activityLog.Close()
+		close(done)
+	}()
+
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Stop it with a properly authenticated client
+	clientTLSConfig, err := getControlTLSConfig(certs["client.pem"], certs["client-key.pem"], certs["ca.pem"])
+	assert.Nil(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLSConfig}}
+	request := newTestDaemonRequest(t, "https://" + addr + "/stop", "application/json", readTestDaemonToken(t, tokenPath), "")
+	t.Cleanup(func() {
+		response, err := client.Do(request)
+		if err == nil {
+			response.Body.Close()
+		}
+		<-done
+	})
+	return addr, tokenPath
+}
+
+// Creates a CA, and a server (for 127.0.0.1) and client certificate signed by it, returning the paths to each PEM file
+func createTestCertificates(t *testing.T, dir string) map[string]string {
+	paths := map[string]string{}
+	writePEM := func(name string, blockType string, contents []byte) {
+		paths[name] = dir + "/" + name
+		err := os.WriteFile(paths[name], pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: contents}), 0600)
+		assert.Nil(t, err)
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: "noisemaker test CA"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		IsCA: true,
+		BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.Nil(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	assert.Nil(t, err)
+	writePEM("ca.pem", "CERTIFICATE", caDER)
+
+	for i, name := range []string{"server", "client"} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.Nil(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject: pkix.Name{CommonName: "noisemaker test " + name},
+			NotBefore: time.Now().Add(-time.Hour),
+			NotAfter: time.Now().Add(time.Hour),
+			KeyUsage: x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		if name == "client" {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		assert.Nil(t, err)
+		writePEM(name + ".pem", "CERTIFICATE", der)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		assert.Nil(t, err)
+		writePEM(name + "-key.pem", "EC PRIVATE KEY", keyDER)
+	}
+
+	// Make sure they load
+	_, err = tls.LoadX509KeyPair(paths["client.pem"], paths["client-key.pem"])
+	assert.Nil(t, err)
+	return paths
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"sort"
+	"strings"
+)
+
+// With -cookie-jar, the cookies kept for the rest of the run, so each send (or download) carries the session the ones before it were
+// given (nil, without it)
+var cookieJar http.CookieJar = nil
+
+// Starts a new, empty cookie jar for the run (or none, if it's not enabled)
+func newCookieJar(enabled bool) (http.CookieJar, error) {
+	if !enabled {
+		return nil, nil
+	}
+	return cookiejar.New(nil)
+}
+
+// Gets the HTTP client sends and downloads are made with: the source-bound one (see getSourceHTTPClient), keeping cookies in the run's
+// cookie jar, if there is one
+func getSessionHTTPClient() *http.Client {
+	client := getSourceHTTPClient()
+	if cookieJar == nil {
+		return client
+	}
+	copied := *client
+	copied.Jar = cookieJar
+	return &copied
+}
+
+// Gets the names of the cookies, sorted and without repeats (their values are never logged)
+func getCookieNames(cookies []*http.Cookie) []string {
+	names := []string{}
+	for _, cookie := range cookies {
+		if !containsString(names, cookie.Name) {
+			names = append(names, cookie.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Gets the names of the cookies the send carried and was set, for its details (or nothing, without -cookie-jar)
+func getCookieDetails(response *MessageResponse) string {
+	if cookieJar == nil {
+		return ""
+	}
+	sent, set := "none", "none"
+	if len(response.cookiesSent) > 0 {
+		sent = strings.Join(response.cookiesSent, " ")
+	}
+	if len(response.cookiesSet) > 0 {
+		set = strings.Join(response.cookiesSet, " ")
+	}
+	return "cookies sent: " + sent + ", cookies set: " + set
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts an HTTP server that logs the client in on its first request (setting a session cookie), and records the cookies each request carried
+func startTestSessionServer(t *testing.T) (*httptest.Server, *[]string) {
+	carried := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names := getCookieNames(r.Cookies())
+		carried = append(carried, strings.Join(names, " "))
+		if len(names) == 0 {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t-session-id", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "csrf", Value: "s3cr3t-csrf-token", Path: "/"})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &carried
+}
+
+func TestMain_Send_CookieJar(t *testing.T) {
+	server, carried := startTestSessionServer(t)
+	host, port := getTestServerHostAndPort(t, server)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Each request after the first carries the session it was given, and only the cookies' names are logged
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-cookie-jar", "-chunk-size=4", "send", "POST", host, port, "http", "abcdefghijkl"})
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, []string{"", "csrf session", "csrf session"}, *carried)
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 4)
+	assert.Equal(t, "chunk 1 of 3\\, transfer " + activityLogEntry.correlationId + "\\, cookies sent: none\\, cookies set: csrf session", parsedLog.entries[0].details)
+	assert.Equal(t, "chunk 2 of 3\\, transfer " + activityLogEntry.correlationId + "\\, cookies sent: csrf session\\, cookies set: none", parsedLog.entries[1].details)
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	assert.NotContains(t, contents, "s3cr3t")
+
+	// Without it, every request is on its own
+	*carried = nil
+	callMain([]string{"./noisemaker", "-sink=stdout", "-chunk-size=4", "send", "POST", host, port, "http", "abcdefgh"})
+	assert.Equal(t, []string{"", ""}, *carried)
+}
+
+func TestMain_Playbook_CookieJar(t *testing.T) {
+	server, carried := startTestSessionServer(t)
+	host, port := getTestServerHostAndPort(t, server)
+	dir := t.TempDir()
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: session
+steps:
+  - command: send
+    args: ["POST", "` + host + `", "` + port + `", "http", "user=alice"]
+  - command: send
+    args: ["GET", "` + host + `", "` + port + `"]
+`), 0644)
+
+	// The session lasts across the playbook's steps
+	callMain([]string{"./noisemaker", "-sink=stdout", "-cookie-jar", "playbook", playbookPath})
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, []string{"", "csrf session"}, *carried)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A well-known credential store path to probe
+type CredentialPath struct {
+	path				string		// the path to open (may be a glob, ie. for browser profiles)
+	description			string		// what kind of credentials live there
+}
+
+// Response data from credprobe action
+type CredentialProbeResponse struct {
+	accessed			int
+	denied				int
+	missing				int
+	status				string
+}
+
+// Gets the well-known credential store paths for the given OS, relative to the given home directory
+func getCredentialPaths(goos string, homeDir string) []CredentialPath {
+	switch goos {
+	case "windows":
+		systemRoot := os.Getenv("SYSTEMROOT")
+		localAppData := os.Getenv("LOCALAPPDATA")
+		appData := os.Getenv("APPDATA")
+		return []CredentialPath{
+			{filepath.Join(systemRoot, "System32", "config", "SAM"), "SAM registry hive"},
+			{filepath.Join(systemRoot, "System32", "config", "SECURITY"), "SECURITY registry hive"},
+			{filepath.Join(systemRoot, "System32", "config", "SYSTEM"), "SYSTEM registry hive"},
+			{filepath.Join(appData, "Microsoft", "Credentials", "*"), "Credential Manager store"},
+			{filepath.Join(localAppData, "Google", "Chrome", "User Data", "Default", "Login Data"), "Chrome saved logins"},
+			{filepath.Join(localAppData, "Microsoft", "Edge", "User Data", "Default", "Login Data"), "Edge saved logins"},
+			{filepath.Join(appData, "Mozilla", "Firefox", "Profiles", "*", "logins.json"), "Firefox saved logins"},
+			{filepath.Join(homeDir, ".ssh", "id_rsa"), "SSH private key"},
+			{filepath.Join(homeDir, ".ssh", "id_ed25519"), "SSH private key"},
+		}
+	case "darwin":
+		return []CredentialPath{
+			{"/etc/master.passwd", "password hashes"},
+			{filepath.Join(homeDir, "Library", "Keychains", "login.keychain-db"), "login keychain"},
+			{filepath.Join(homeDir, "Library", "Application Support", "Google", "Chrome", "Default", "Login Data"), "Chrome saved logins"},
+			{filepath.Join(homeDir, "Library", "Application Support", "Firefox", "Profiles", "*", "logins.json"), "Firefox saved logins"},
+			{filepath.Join(homeDir, ".ssh", "id_rsa"), "SSH private key"},
+			{filepath.Join(homeDir, ".ssh", "id_ed25519"), "SSH private key"},
+			{filepath.Join(homeDir, ".aws", "credentials"), "AWS credentials"},
+		}
+	default:
+		// linux, freebsd, etc.
+		return []CredentialPath{
+			{"/etc/shadow", "password hashes"},
+			{"/etc/gshadow", "group password hashes"},
+			{filepath.Join(homeDir, ".config", "google-chrome", "Default", "Login Data"), "Chrome saved logins"},
+			{filepath.Join(homeDir, ".mozilla", "firefox", "*", "logins.json"), "Firefox saved logins"},
+			{filepath.Join(homeDir, ".ssh", "id_rsa"), "SSH private key"},
+			{filepath.Join(homeDir, ".ssh", "id_ed25519"), "SSH private key"},
+			{filepath.Join(homeDir, ".aws", "credentials"), "AWS credentials"},
+		}
+	}
+}
+
+// Attempts a read-only open of each credential path (reading nothing), logging each attempt as an access activity
+func probeCredentialPaths(activityLog Sink, parent *ActivityLogEntry, credentialPaths []CredentialPath) *CredentialProbeResponse {
+	response := new(CredentialProbeResponse)
+	for _, credentialPath := range credentialPaths {
+		// Expand any globs, and probe the pattern itself if nothing matched (so the attempt still gets logged)
+		paths := []string{credentialPath.path}
+		if strings.ContainsAny(credentialPath.path, "*?[") {
+			matches, err := filepath.Glob(credentialPath.path)
+			if err == nil && len(matches) > 0 {
+				paths = matches
+			}
+		}
+
+		for _, path := range paths {
+			entry := newChildLogEntry(parent, "access")
+			entry.path = escapeRawText(path)
+			entry.details = escapeRawText(credentialPath.description)
+			entry.status = probeCredentialPath(path)
+
+			switch entry.status {
+			case "accessed":
+				response.accessed += 1
+				fmt.Printf("Opened %s (%s)\n", path, credentialPath.description)
+			case "no_access":
+				response.denied += 1
+				fmt.Printf("Access denied to %s (%s)\n", path, credentialPath.description)
+			default:
+				response.missing += 1
+			}
+			writeLogEntry(activityLog, entry)
+		}
+	}
+
+	fmt.Printf("Probed %d credential paths: %d accessed, %d denied, %d not found or errored\n", response.accessed + response.denied + response.missing, response.accessed, response.denied, response.missing)
+	response.status = "completed"
+	return response
+}
+
+// Opens the given path read-only, then closes it without reading anything, and returns the access result
+func probeCredentialPath(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "not_found"
+		} else if os.IsPermission(err) {
+			return "no_access"
+		}
+		return "error"
+	}
+	f.Close()
+	return "accessed"
+}
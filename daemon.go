@@ -0,0 +1,591 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default address for the daemon's control API (loopback only, since anything that can reach it can run commands)
+const DefaultDaemonAddr = "127.0.0.1:7070"
+
+// What the daemon's token file is named, next to the activity log (unless -daemon-token-file says otherwise)
+const DefaultDaemonTokenName = "noisemaker-daemon-token"
+
+// Where the daemon writes its bearer token (and control reads it from), set from -daemon-token-file (or next to the activity log)
+var daemonTokenPath = ""
+
+// The content types POST /playbooks accepts (none of which a browser can send cross-origin without asking first)
+var DaemonPlaybookContentTypes = []string{"application/json", "application/yaml", "application/x-yaml", "text/yaml"}
+
+// Most bytes accepted in a single API request (ie. a playbook)
+const MaxDaemonRequestBytes = 1 << 20
+
+// Most runs (and entries per run) the daemon keeps in memory for GET /jobs/{id}/log, dropping the oldest runs first
+const MaxRecordedRuns = 100
+const MaxRecordedEntriesPerRun = 10000
+
+// Commands that wait on inbound connections, or for changes (and would hold up every job queued after them until something happens)
+var DaemonBlockingCommands = []string{"listen", "pipe create", "watch"}
+
+// A command or playbook submitted to the daemon
+type DaemonJob struct {
+	Id					string			`json:"id"`
+	Kind				string			`json:"kind"`					// action or playbook
+	Command				string			`json:"command,omitempty"`
+	Args				[]string		`json:"args,omitempty"`
+	Playbook			string			`json:"playbook,omitempty"`		// the playbook's name
+	RunId				string			`json:"runId"`
+	Status				string			`json:"status"`					// queued, running, completed, error, or cancelled
+	Result				string			`json:"result,omitempty"`		// the status the command (or playbook) logged
+	Error				string			`json:"error,omitempty"`
+	SubmittedAt			string			`json:"submittedAt"`
+	StartedAt			string			`json:"startedAt,omitempty"`
+	FinishedAt			string			`json:"finishedAt,omitempty"`
+	note				string
+	labels				string
+	playbook			*Playbook
+}
+
+// The body of an action submitted to the daemon (the run ID, note, and labels are optional)
+type DaemonActionRequest struct {
+	Command				string			`json:"command"`
+	Args				[]string		`json:"args"`
+	RunId				string			`json:"runId"`
+	Note				string			`json:"note"`
+	Labels				string			`json:"labels"`
+}
+
+// Response data from daemon action
+type DaemonResponse struct {
+	addr				string
+	completed			int
+	failed				int
+	cancelled			int
+	status				string
+}
+
+// Runs submitted jobs one at a time, in the order they're submitted, logging them all to the same activity log
+type Daemon struct {
+	activityLog			Sink
+	recorder			*RunRecorderSink
+	parent				*ActivityLogEntry
+	startedAt			string
+	token				string			// the bearer token every POST has to present (new each time it's started)
+	loopbackOnly		bool			// whether it's listening on loopback only (so every request's Host has to be loopback too)
+	anyHost				bool			// whether any Host is accepted (on a Unix socket, or when clients need certificates)
+	mutex				sync.Mutex
+	jobs				[]*DaemonJob
+	queue				chan *DaemonJob
+	stopping			bool
+	stop				chan struct{}
+	stopOnce			sync.Once
+}
+
+// Serves the control API on addr (ie. 127.0.0.1:7070, or unix:///tmp/noisemaker.sock) until it's told to stop (or interrupted, or
+// its -timeout is up).
+// If tlsConfig is given, the API is served over HTTPS (and clients must present a certificate, if it says so). A new bearer token is
+// written to tokenPath (readable by the current user only) for clients to present, and removed again once it's stopped.
+func runDaemon(activityLog Sink, parent *ActivityLogEntry, addr string, tlsConfig *tls.Config, tokenPath string) (*DaemonResponse, error) {
+	response := &DaemonResponse{status: "error"}
+	token, err := writeDaemonToken(tokenPath)
+	if err != nil {
+		return response, err
+	}
+	defer os.Remove(tokenPath)
+	listener, err := listenDaemon(addr)
+	if err != nil {
+		return response, err
+	}
+	clientCertsRequired := tlsConfig != nil && tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert
+	loopbackOnly := false
+	response.addr = listener.Addr().String()
+	if listener.Addr().Network() == "unix" {
+		response.addr = "unix://" + response.addr
+	} else if tcpAddr, ok := listener.Addr().(*net.TCPAddr); ok && tcpAddr.IP.IsLoopback() {
+		loopbackOnly = true
+	} else if !clientCertsRequired {
+		slog.Warn("The daemon is reachable from other hosts without client certificates, so anyone who can reach it (with the token) can run commands", "addr", response.addr)
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		response.addr = "https://" + response.addr
+	}
+
+	// Record each run's entries as they're logged, so controllers can collect them
+	recorder := newRunRecorderSink()
+	daemon := &Daemon{
+		activityLog: &MultiSink{sinks: []Sink{activityLog, recorder}},
+		recorder: recorder,
+		parent: parent,
+		startedAt: time.Now().Format(time.RFC3339),
+		token: token,
+		loopbackOnly: loopbackOnly,
+		anyHost: listener.Addr().Network() == "unix" || clientCertsRequired,
+		queue: make(chan *DaemonJob, 1000),
+		stop: make(chan struct{}),
+	}
+	server := &http.Server{Handler: daemon.newHandler()}
+	go server.Serve(listener)
+	fmt.Printf("Daemon listening for commands on %s (with the token in %s)...\n", response.addr, tokenPath)
+
+	// Run jobs until we're told to stop
+	workerDone := make(chan struct{})
+	go daemon.runJobs(workerDone)
+	signals, stopSignals := notifyShutdown()
+	defer stopSignals()
+	var received os.Signal
+	select {
+	case <-daemon.stop:
+	case received = <-signals:
+		fmt.Println("Interrupted, stopping...")
+		daemon.requestStop()
+	case <-runContext.Done():
+		fmt.Println("Timed out, stopping...")
+		daemon.requestStop()
+	}
+	<-workerDone
+	if received != nil {
+		shutdown(activityLog, parent, received)
+	}
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancelShutdown()
+	server.Shutdown(ctx)
+
+	for _, job := range daemon.jobs {
+		switch job.Status {
+		case "completed":
+			response.completed += 1
+		case "cancelled":
+			response.cancelled += 1
+		default:
+			response.failed += 1
+		}
+	}
+	fmt.Printf("Daemon stopped: %d jobs completed, %d failed, %d cancelled\n", response.completed, response.failed, response.cancelled)
+	response.status = "stopped"
+	return response, nil
+}
+
+// Listens on a TCP address, or a Unix domain socket (given as unix:///path/to/socket), which only the current user can use
+func listenDaemon(addr string) (net.Listener, error) {
+	socketPath, isUnix := strings.CutPrefix(addr, "unix://")
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+
+	// Clear out any stale socket left behind by an earlier daemon
+	if info, err := os.Stat(socketPath); err == nil && info.Mode() & os.ModeSocket != 0 {
+		os.Remove(socketPath)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(socketPath, 0600)
+	return listener, nil
+}
+
+// Generates a new random bearer token, and writes it to the path (replacing any earlier daemon's), readable by the current user only
+func writeDaemonToken(path string) (string, error) {
+	contents := make([]byte, 32)
+	_, err := rand.Read(contents)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(contents)
+	os.Remove(path)
+	err = os.WriteFile(path, []byte(token + "\n"), 0600)
+	if err != nil {
+		return "", fmt.Errorf("unable to write daemon token: %v", err)
+	}
+	return token, nil
+}
+
+// Reads the bearer token a daemon wrote to the path
+func readDaemonToken(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read daemon token: %v", err)
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+func (daemon *Daemon) newHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /actions", daemon.handleSubmitAction)
+	mux.HandleFunc("POST /playbooks", daemon.handleSubmitPlaybook)
+	mux.HandleFunc("GET /status", daemon.handleStatus)
+	mux.HandleFunc("GET /jobs", daemon.handleListJobs)
+	mux.HandleFunc("GET /jobs/{id}", daemon.handleGetJob)
+	mux.HandleFunc("GET /jobs/{id}/log", daemon.handleGetJobLog)
+	mux.HandleFunc("POST /stop", daemon.handleStop)
+	return daemon.checkRequests(mux)
+}
+
+// Rejects requests that didn't come from a client of ours: from a browser (with an Origin), to a Host that isn't ours (ie. a name a
+// page rebound to us), or, for anything that changes something (every POST), without the daemon's bearer token
+func (daemon *Daemon) checkRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeDaemonError(w, http.StatusForbidden, fmt.Errorf("requests from browsers aren't accepted (Origin %s)", r.Header.Get("Origin")))
+			return
+		}
+		if !daemon.isAllowedHost(r.Host) {
+			writeDaemonError(w, http.StatusForbidden, fmt.Errorf("invalid Host %s (must be loopback)", r.Host))
+			return
+		}
+		if r.Method == http.MethodPost {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(token), []byte(daemon.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeDaemonError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid bearer token"))
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Whether a request to the Host is accepted: loopback (ie. localhost:7070, or 127.0.0.1), or, when it's listening on other addresses,
+// an IP address too (never another name, unless clients need certificates, since a name can be rebound to us)
+func (daemon *Daemon) isAllowedHost(host string) bool {
+	if daemon.anyHost {
+		return true
+	}
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	if strings.EqualFold(hostname, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || !daemon.loopbackOnly
+}
+
+// Checks that a request's body is one of the content types (so a browser can't send it as a "simple" request, ie. text/plain)
+func checkDaemonContentType(r *http.Request, contentTypes ...string) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !containsString(contentTypes, mediaType) {
+		return fmt.Errorf("invalid Content-Type '%s' (must be one of %v)", r.Header.Get("Content-Type"), contentTypes)
+	}
+	return nil
+}
+
+// POST /actions with a DaemonActionRequest (as application/json); responds with the queued job
+func (daemon *Daemon) handleSubmitAction(w http.ResponseWriter, r *http.Request) {
+	err := checkDaemonContentType(r, "application/json")
+	if err != nil {
+		writeDaemonError(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	request := new(DaemonActionRequest)
+	err = json.NewDecoder(io.LimitReader(r.Body, MaxDaemonRequestBytes)).Decode(request)
+	if err != nil {
+		writeDaemonError(w, http.StatusBadRequest, fmt.Errorf("invalid action: %v", err))
+		return
+	}
+	if request.Command == "" {
+		writeDaemonError(w, http.StatusBadRequest, fmt.Errorf("invalid action: no command"))
+		return
+	}
+	err = checkDaemonCommand(request.Command, request.Args)
+	if err != nil {
+		writeDaemonError(w, http.StatusBadRequest, fmt.Errorf("invalid action: %v", err))
+		return
+	}
+	labels, err := parseLabels(request.Labels)
+	if err != nil {
+		writeDaemonError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job := &DaemonJob{Kind: "action", Command: request.Command, Args: request.Args, RunId: request.RunId, note: request.Note, labels: labels}
+	daemon.submit(w, job)
+}
+
+// POST /playbooks with a YAML (or JSON) playbook, optionally with runId, note, and labels query parameters; responds with the queued job
+func (daemon *Daemon) handleSubmitPlaybook(w http.ResponseWriter, r *http.Request) {
+	err := checkDaemonContentType(r, DaemonPlaybookContentTypes...)
+	if err != nil {
+		writeDaemonError(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	contents, err := io.ReadAll(io.LimitReader(r.Body, MaxDaemonRequestBytes))
+	if err != nil {
+		writeDaemonError(w, http.StatusBadRequest, err)
+		return
+	}
+	playbook, err := parsePlaybook(contents)
+	if err != nil {
+		writeDaemonError(w, http.StatusBadRequest, err)
+		return
+	}
+	for i, runs := range expandPlaybook(playbook) {
+		for _, run := range runs {
+			err = checkDaemonCommand(run.command, run.args)
+			if err != nil {
+				writeDaemonError(w, http.StatusBadRequest, fmt.Errorf("invalid playbook: step %d %v", i + 1, err))
+				return
+			}
+		}
+	}
+	labels, err := parseLabels(r.URL.Query().Get("labels"))
+	if err != nil {
+		writeDaemonError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job := &DaemonJob{Kind: "playbook", Playbook: playbook.Name, RunId: r.URL.Query().Get("runId"), note: r.URL.Query().Get("note"), labels: labels, playbook: playbook}
+	daemon.submit(w, job)
+}
+
+// Checks that the command can be run by the daemon: not one that playbooks can't run either (playbooks go to POST /playbooks
+// instead), or one that waits on inbound connections (or changes)
+func checkDaemonCommand(command string, args []string) error {
+	if containsString(NonPlaybookCommands, command) {
+		return fmt.Errorf("can't run %s from the daemon", command)
+	}
+	commandLine := command
+	if len(args) > 0 {
+		commandLine += " " + args[0]
+	}
+	if containsString(DaemonBlockingCommands, command) || containsString(DaemonBlockingCommands, commandLine) {
+		return fmt.Errorf("can't run %s from the daemon (it waits for inbound connections, or changes)", commandLine)
+	}
+	return nil
+}
+
+// Queues the job, unless we're stopping
+func (daemon *Daemon) submit(w http.ResponseWriter, job *DaemonJob) {
+	daemon.mutex.Lock()
+	if daemon.stopping {
+		daemon.mutex.Unlock()
+		writeDaemonError(w, http.StatusServiceUnavailable, fmt.Errorf("daemon is stopping"))
+		return
+	}
+	job.Id = newUUID()
+	if job.RunId == "" {
+		job.RunId = newUUID()
+	}
+	job.Status = "queued"
+	job.SubmittedAt = time.Now().Format(time.RFC3339)
+	daemon.jobs = append(daemon.jobs, job)
+	select {
+	case daemon.queue <- job:
+	default:
+		job.Status = "cancelled"
+		job.Error = "queue is full"
+	}
+	snapshot := *job
+	daemon.mutex.Unlock()
+
+	fmt.Printf("Queued %s job %s\n", job.Kind, job.Id)
+	writeDaemonJSON(w, http.StatusAccepted, snapshot)
+}
+
+// GET /status; responds with how many jobs are in each state
+func (daemon *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	daemon.mutex.Lock()
+	counts := map[string]int{"queued": 0, "running": 0, "completed": 0, "error": 0, "cancelled": 0}
+	for _, job := range daemon.jobs {
+		counts[job.Status] += 1
+	}
+	status := "running"
+	if daemon.stopping {
+		status = "stopping"
+	}
+	daemon.mutex.Unlock()
+
+	writeDaemonJSON(w, http.StatusOK, map[string]any{"status": status, "startedAt": daemon.startedAt, "runId": daemon.parent.runId, "jobs": counts})
+}
+
+// GET /jobs; responds with every job submitted, in order
+func (daemon *Daemon) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	daemon.mutex.Lock()
+	jobs := []DaemonJob{}
+	for _, job := range daemon.jobs {
+		jobs = append(jobs, *job)
+	}
+	daemon.mutex.Unlock()
+	writeDaemonJSON(w, http.StatusOK, jobs)
+}
+
+// GET /jobs/{id}
+func (daemon *Daemon) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	for _, job := range daemon.jobs {
+		if job.Id == r.PathValue("id") {
+			writeDaemonJSON(w, http.StatusOK, *job)
+			return
+		}
+	}
+	writeDaemonError(w, http.StatusNotFound, fmt.Errorf("no such job: %s", r.PathValue("id")))
+}
+
+// GET /jobs/{id}/log; responds with the entries the job's run logged so far, as a CSV activity log
+func (daemon *Daemon) handleGetJobLog(w http.ResponseWriter, r *http.Request) {
+	runId := ""
+	daemon.mutex.Lock()
+	for _, job := range daemon.jobs {
+		if job.Id == r.PathValue("id") {
+			runId = job.RunId
+		}
+	}
+	daemon.mutex.Unlock()
+	if runId == "" {
+		writeDaemonError(w, http.StatusNotFound, fmt.Errorf("no such job: %s", r.PathValue("id")))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	io.WriteString(w, getCSVFileHeader())
+	for _, entry := range daemon.recorder.getEntries(escapeRawText(runId)) {
+		io.WriteString(w, strings.Join(serializeToCSV(entry), ",") + "\n")
+	}
+}
+
+// POST /stop; cancels any queued jobs, and stops once the running one (if any) finishes
+func (daemon *Daemon) handleStop(w http.ResponseWriter, r *http.Request) {
+	daemon.requestStop()
+	writeDaemonJSON(w, http.StatusAccepted, map[string]any{"status": "stopping"})
+}
+
+func (daemon *Daemon) requestStop() {
+	daemon.stopOnce.Do(func() {
+		daemon.mutex.Lock()
+		daemon.stopping = true
+		close(daemon.queue)
+		daemon.mutex.Unlock()
+		close(daemon.stop)
+	})
+}
+
+// Runs queued jobs until the queue's closed, skipping (and cancelling) the rest once we're stopping
+func (daemon *Daemon) runJobs(done chan struct{}) {
+	defer close(done)
+	for job := range daemon.queue {
+		daemon.mutex.Lock()
+		if daemon.stopping {
+			job.Status = "cancelled"
+			daemon.mutex.Unlock()
+			continue
+		}
+		job.Status = "running"
+		job.StartedAt = time.Now().Format(time.RFC3339)
+		daemon.mutex.Unlock()
+
+		result, err := daemon.runJob(job)
+
+		daemon.mutex.Lock()
+		job.Result = result
+		job.Status = "completed"
+		if err != nil {
+			job.Status = "error"
+			job.Error = err.Error()
+		}
+		job.FinishedAt = time.Now().Format(time.RFC3339)
+		daemon.mutex.Unlock()
+		fmt.Printf("Finished %s job %s: %s\n", job.Kind, job.Id, job.Status)
+	}
+}
+
+// Runs a single job as its own run, with the daemon's note and labels unless the job has its own
+func (daemon *Daemon) runJob(job *DaemonJob) (string, error) {
+	command := job.Command
+	if job.Kind == "playbook" {
+		command = "playbook"
+	}
+	entry := newActivityLogEntry(command, job.Args)
+	entry.runId = escapeRawText(job.RunId)
+	entry.note = daemon.parent.note
+	if job.note != "" {
+		entry.note = escapeRawText(job.note)
+	}
+	entry.labels = daemon.parent.labels
+	if job.labels != "" {
+		entry.labels = job.labels
+	}
+
+	if job.Kind == "playbook" {
+		entry.path = escapeRawText(job.playbook.Name)
+		playbookResponse := runPlaybookActivity(daemon.activityLog, entry, job.playbook, nil)
+		writeLogEntry(daemon.activityLog, entry)
+		if playbookResponse.failed > 0 {
+			return entry.status, fmt.Errorf("%d steps failed", playbookResponse.failed)
+		}
+		return entry.status, nil
+	}
+
+	err := runCommandSafely(daemon.activityLog, entry, job.Command, job.Args)
+	return entry.status, err
+}
+
+func writeDaemonJSON(w http.ResponseWriter, statusCode int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeDaemonError(w http.ResponseWriter, statusCode int, err error) {
+	writeDaemonJSON(w, statusCode, map[string]any{"error": err.Error()})
+}
+
+// Keeps a copy of every entry logged in memory, by run ID (up to MaxRecordedRuns runs)
+type RunRecorderSink struct {
+	mutex				sync.Mutex
+	runIds				[]string
+	entries				map[string][]*ActivityLogEntry
+}
+
+func newRunRecorderSink() *RunRecorderSink {
+	return &RunRecorderSink{entries: map[string][]*ActivityLogEntry{}}
+}
+
+func (sink *RunRecorderSink) WriteEntry(entry *ActivityLogEntry) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	entries, found := sink.entries[entry.runId]
+	if !found {
+		sink.runIds = append(sink.runIds, entry.runId)
+		if len(sink.runIds) > MaxRecordedRuns {
+			delete(sink.entries, sink.runIds[0])
+			sink.runIds = sink.runIds[1:]
+		}
+	}
+	if len(entries) < MaxRecordedEntriesPerRun {
+		// Copy it, since entries can be changed and logged again (ie. retried sends)
+		copied := *entry
+		sink.entries[entry.runId] = append(entries, &copied)
+	}
+	return nil
+}
+
+func (sink *RunRecorderSink) Close() error {
+	return nil
+}
+
+func (sink *RunRecorderSink) getEntries(runId string) []*ActivityLogEntry {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return append([]*ActivityLogEntry{}, sink.entries[runId]...)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Daemon(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	port := getFreeTestPort(t, "tcp")
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+	baseUrl := "http://" + addr
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "daemon", addr}
+	done := callMainInBackground(args)
+	client := waitForTestDaemon(t, "tcp", addr)
+	token := readTestDaemonToken(t, dir + "/noisemaker-daemon-token")
+
+	// Submit an action, and a playbook
+	job := postTestDaemon(t, client, baseUrl + "/actions", "application/json", token, `{"command": "create", "args": ["` + dir + `/daemon.txt", "hello"], "runId": "action-run", "note": "from the controller"}`)
+	assert.Equal(t, "action", job["kind"])
+	assert.Equal(t, "action-run", job["runId"])
+	playbookJob := postTestDaemon(t, client, baseUrl + "/playbooks?runId=playbook-run", "application/yaml", token, "name: cleanup\nsteps:\n  - command: delete\n    args: [\"" + dir + "/daemon.txt\"]\n")
+	assert.Equal(t, "playbook", playbookJob["kind"])
+
+	// Wait for them both to finish
+	finished := map[string]any{}
+	for i := 0; i < 100 && finished["status"] != "completed"; i++ {
+		time.Sleep(20 * time.Millisecond)
+		finished = getTestDaemon(t, client, baseUrl + "/jobs/" + playbookJob["id"].(string))
+	}
+	assert.Equal(t, "completed", finished["status"])
+	assert.Equal(t, "completed", getTestDaemon(t, client, baseUrl + "/jobs/" + job["id"].(string))["status"])
+	status := getTestDaemon(t, client, baseUrl + "/status")
+	assert.Equal(t, "running", status["status"])
+	assert.Equal(t, float64(2), status["jobs"].(map[string]any)["completed"])
+
+	// Invalid submissions are rejected (including ones that would hold up the queue)
+	for _, body := range []string{`{"command": "daemon"}`, `{"command": "control", "args": ["playbook.yaml", "10.0.0.5"]}`, `{"command": "listen", "args": ["8080"]}`, `{"command": "pipe", "args": ["create", "noisemaker"]}`} {
+		response, err := client.Do(newTestDaemonRequest(t, baseUrl + "/actions", "application/json", token, body))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, body)
+		response.Body.Close()
+	}
+	for _, body := range []string{"steps:\n  - command: listen\n    args: [\"8080\"]\n", "vars:\n  action: create\nsteps:\n  - command: pipe\n    args: [\"${action}\", \"noisemaker\"]\n"} {
+		response, err := client.Do(newTestDaemonRequest(t, baseUrl + "/playbooks", "application/yaml", token, body))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, body)
+		response.Body.Close()
+	}
+
+	// And stop it (which removes its token)
+	postTestDaemon(t, client, baseUrl + "/stop", "application/json", token, "")
+	<-done
+	assert.False(t, fileExists(dir + "/noisemaker-daemon-token"))
+	assert.Equal(t, activityLogEntry.activity, "daemon")
+	assert.Equal(t, activityLogEntry.status, "stopped")
+	assert.Equal(t, activityLogEntry.details, "2 jobs completed\\, 0 failed\\, 0 cancelled")
+	assert.False(t, fileExists(dir + "/daemon.txt"))
+	assertLogFileContains(t, logFilePath, ",created,")
+	assertLogFileContains(t, logFilePath, ",from the controller,")
+	assertLogFileContains(t, logFilePath, ",action-run,1,")
+	assertLogFileContains(t, logFilePath, ",playbook-run,2,")
+}
+
+func TestMain_Daemon_Rejected(t *testing.T) {
+	dir := t.TempDir()
+	port := strconv.Itoa(getFreeTestPort(t, "tcp"))
+	addr := "127.0.0.1:" + port
+	baseUrl := "http://" + addr
+	tokenPath := dir + "/daemon.token"
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "-daemon-token-file=" + tokenPath, "daemon", addr}
+	done := callMainInBackground(args)
+	client := waitForTestDaemon(t, "tcp", addr)
+	token := readTestDaemonToken(t, tokenPath)
+	info, err := os.Stat(tokenPath)
+	assert.Nil(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	action := `{"command": "create", "args": ["` + dir + `/rejected.txt"]}`
+
+	// Without the token (or with the wrong one), nothing that changes anything is accepted
+	for _, wrongToken := range []string{"", "not-the-token", token + "0"} {
+		for _, path := range []string{"/actions", "/playbooks", "/stop"} {
+			response, err := client.Do(newTestDaemonRequest(t, baseUrl + path, "application/json", wrongToken, action))
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusUnauthorized, response.StatusCode, path)
+			response.Body.Close()
+		}
+	}
+
+	// Nor is anything a browser could send without asking first (or a request's body in the wrong format)
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded", "multipart/form-data; boundary=x", "application/yaml"} {
+		response, err := client.Do(newTestDaemonRequest(t, baseUrl + "/actions", contentType, token, action))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, response.StatusCode, contentType)
+		response.Body.Close()
+	}
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		response, err := client.Do(newTestDaemonRequest(t, baseUrl + "/playbooks", contentType, token, "steps:\n  - command: create\n    args: [\"" + dir + "/rejected.txt\"]\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, response.StatusCode, contentType)
+		response.Body.Close()
+	}
+
+	// Nor is anything from a browser, or to a name that isn't loopback (ie. one rebound to us), even reading
+	for _, header := range [][]string{{"Origin", "http://evil.example"}, {"Origin", "null"}, {"Host", "evil.example:" + port}, {"Host", "10.0.0.5"}} {
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			request := newTestDaemonRequest(t, baseUrl + "/actions", "application/json", token, action)
+			if method == http.MethodGet {
+				request, err = http.NewRequest(method, baseUrl + "/status", nil)
+				assert.Nil(t, err)
+			}
+			if header[0] == "Host" {
+				request.Host = header[1]
+			} else {
+				request.Header.Set(header[0], header[1])
+			}
+			response, err := client.Do(request)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusForbidden, response.StatusCode, header)
+			response.Body.Close()
+		}
+	}
+
+	// (loopback's accepted however it's named)
+	for _, host := range []string{"localhost", "LOCALHOST:" + port, "127.0.0.1", "[::1]:7070"} {
+		request, err := http.NewRequest(http.MethodGet, baseUrl + "/status", nil)
+		assert.Nil(t, err)
+		request.Host = host
+		response, err := client.Do(request)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode, host)
+		response.Body.Close()
+	}
+
+	postTestDaemon(t, client, baseUrl + "/stop", "", token, "")
+	<-done
+	assert.Equal(t, activityLogEntry.details, "0 jobs completed\\, 0 failed\\, 0 cancelled")
+	assert.False(t, fileExists(dir + "/rejected.txt"))
+}
+
+func TestDaemon_IsAllowedHost(t *testing.T) {
+	loopback := &Daemon{loopbackOnly: true}
+	assert.True(t, loopback.isAllowedHost("localhost:7070"))
+	assert.True(t, loopback.isAllowedHost("127.0.0.1"))
+	assert.True(t, loopback.isAllowedHost("[::1]:7070"))
+	assert.False(t, loopback.isAllowedHost("10.0.0.5:7070"))
+	assert.False(t, loopback.isAllowedHost("agent.example:7070"))
+	assert.False(t, loopback.isAllowedHost(""))
+
+	// Listening on other addresses, those can be used too (but never a name, which could be rebound to us)
+	remote := &Daemon{}
+	assert.True(t, remote.isAllowedHost("10.0.0.5:7070"))
+	assert.True(t, remote.isAllowedHost("[fe80::1]:7070"))
+	assert.False(t, remote.isAllowedHost("agent.example:7070"))
+
+	// (unless clients need certificates, which a browser doesn't have)
+	assert.True(t, (&Daemon{anyHost: true}).isAllowedHost("agent.example:7070"))
+}
+
+func TestMain_Daemon_UnixSocket(t *testing.T) {
+	socketPath := t.TempDir() + "/noisemaker.sock"
+	logDir := t.TempDir()
+
+	args := []string{"./noisemaker", "-logfile=" + logDir + "/activity-log.csv", "daemon", "unix://" + socketPath}
+	done := callMainInBackground(args)
+	client := waitForTestDaemon(t, "unix", socketPath)
+
+	status := getTestDaemon(t, client, "http://daemon/status")
+	assert.Equal(t, "running", status["status"])
+	postTestDaemon(t, client, "http://daemon/stop", "", readTestDaemonToken(t, logDir + "/noisemaker-daemon-token"), "")
+	<-done
+	assert.Equal(t, activityLogEntry.status, "stopped")
+	assert.Equal(t, activityLogEntry.path, "unix://" + socketPath)
+}
+
+// Waits for the daemon to start listening, and gets a client for talking to it
+func waitForTestDaemon(t *testing.T, network string, addr string) *http.Client {
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return net.Dial(network, addr)
+	}
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial(network, addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return &http.Client{Transport: &http.Transport{DialContext: dial}, Timeout: 5 * time.Second}
+}
+
+func getTestDaemon(t *testing.T, client *http.Client, url string) map[string]any {
+	response, err := client.Get(url)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	result := map[string]any{}
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&result))
+	return result
+}
+
+// Reads the token a daemon wrote (which it's written before it's listening)
+func readTestDaemonToken(t *testing.T, path string) string {
+	token, err := readDaemonToken(path)
+	assert.Nil(t, err)
+	assert.Len(t, token, 64)
+	return token
+}
+
+// Makes a POST with the content type and bearer token, if given
+func newTestDaemonRequest(t *testing.T, url string, contentType string, token string, body string) *http.Request {
+	request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	assert.Nil(t, err)
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer " + token)
+	}
+	return request
+}
+
+func postTestDaemon(t *testing.T, client *http.Client, url string, contentType string, token string, body string) map[string]any {
+	response, err := client.Do(newTestDaemonRequest(t, url, contentType, token, body))
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	result := map[string]any{}
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&result))
+	return result
+}
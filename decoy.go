@@ -0,0 +1,514 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The kinds of decoy document decoy plant can write
+var DecoyKinds = []string{"docx", "xlsx", "pem"}
+
+// The decoy manifest's file name (next to the activity log, by default)
+const DefaultDecoyManifestName = "noisemaker-decoys.jsonl"
+
+// How far back a decoy's times are set, so it looks like it's been there a while (rather than planted just now)
+const MaxDecoyAge = 90 * 24 * time.Hour
+
+// The names decoys of each kind are given (the sort of thing an intruder goes looking for)
+var DecoyNames = map[string][]string{
+	"docx": {"Passwords.docx", "Board Minutes - Confidential.docx", "Merger Plan Draft.docx", "Network Credentials.docx", "Employee Reviews.docx", "Offer Letter - Final.docx"},
+	"xlsx": {"Payroll.xlsx", "Salaries 2024.xlsx", "Customer Accounts.xlsx", "Bank Details.xlsx", "Budget Forecast.xlsx", "Admin Passwords.xlsx"},
+	"pem": {"id_ed25519.pem", "prod-db.pem", "vpn-client.key", "aws-deploy.pem", "backup-server.pem", "jenkins.key"},
+}
+
+// The templates decoy documents' text is filled in from: {name}, {name2}, {amount}, {date}, {year}, {quarter}, {user}, {password},
+// and {host} are replaced with made-up values
+var DecoyDocumentTemplates = [][]string{
+	{"CONFIDENTIAL - Board Meeting Minutes, Q{quarter} {year}", "Attendees: {name}, {name2}", "The board approved the acquisition at a price of {amount}, to close by {date}.", "Do not forward outside the executive team."},
+	{"IT Credentials (do not share)", "Domain admin: {user} / {password}", "Backup server: {host}", "Updated by {name} on {date}."},
+	{"Performance Review - {name}", "Reviewer: {name2}", "Proposed salary: {amount}, effective {date}.", "Strictly private and confidential."},
+}
+
+// The columns of decoy spreadsheets, one row of made-up values each
+var DecoySpreadsheetColumns = []string{"Name", "Username", "Password", "Account", "Salary"}
+
+// The made-up people decoys are filled in with
+var DecoyPeople = []string{"Sarah Mitchell", "James O'Connor", "Priya Raman", "David Chen", "Maria Gonzalez", "Tom Fischer", "Aisha Bello", "Kevin Walsh"}
+
+// A planted decoy, as it was when it was planted. It's recorded in the decoy manifest, and recorded again (as removed) once it's gone.
+type Decoy struct {
+	Timestamp			string			`json:"timestamp"`
+	RunId				string			`json:"run_id"`
+	Kind				string			`json:"kind"`
+	Path				string			`json:"path"`
+	SHA256				string			`json:"sha256"`
+	Size				int64			`json:"size"`
+	ModTime				time.Time		`json:"mod_time"`
+	AccessTime			time.Time		`json:"access_time"`
+	Removed				bool			`json:"removed,omitempty"`
+}
+
+// Options for the decoy command
+type DecoyOptions struct {
+	mode				string			// plant, check, or remove
+	manifest			string			// the decoy manifest the decoys are recorded in
+	dirs				[]string		// the directories to plant decoys in
+	kinds				[]string
+	count				int				// how many decoys to plant in each directory
+	seed				int64
+}
+
+// Response data from decoy action
+type DecoyResponse struct {
+	decoys				int
+	planted				int
+	untouched			int
+	accessed			int
+	modified			int
+	deleted				int
+	removed				int
+	failed				int
+	status				string
+}
+
+// Parses decoy's arguments: plant [-kinds=docx,xlsx,pem] [-count=(n)] [-seed=(n)] [-decoys=(path)] (dir...), or (check|remove)
+// [-decoys=(path)] (by default, the decoy manifest's at manifestPath)
+func parseDecoyOptions(args []string, manifestPath string) (*DecoyOptions, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("not enough arguments for decoy! Args: %v", args)
+	}
+	options := &DecoyOptions{mode: args[0]}
+	if !containsString([]string{"plant", "check", "remove"}, options.mode) {
+		return nil, fmt.Errorf("invalid mode for decoy: %s (must be plant, check, or remove)", options.mode)
+	}
+	flags := flag.NewFlagSet("decoy", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	manifest := flags.String("decoys", manifestPath, "the decoy manifest the decoys are recorded in (default noisemaker-decoys.jsonl, next to the activity log)")
+	kinds := flags.String("kinds", strings.Join(DecoyKinds, ","), "the kinds of decoy to plant (default docx,xlsx,pem)")
+	count := flags.Int("count", 0, "how many decoys to plant in each directory (default one of each kind)")
+	seed := flags.Int64("seed", 0, "the random seed, to plant the same decoys again (default random)")
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid decoy: %v", err)
+	}
+	options.manifest = *manifest
+	options.dirs = flags.Args()
+	if options.mode != "plant" {
+		if len(options.dirs) > 0 {
+			return nil, fmt.Errorf("invalid decoy: unexpected arguments %v", options.dirs)
+		}
+		return options, nil
+	}
+
+	if len(options.dirs) == 0 {
+		return nil, fmt.Errorf("not enough arguments for decoy plant! Args: %v", args)
+	}
+	for _, kind := range strings.Split(*kinds, ",") {
+		if !containsString(DecoyKinds, kind) {
+			return nil, fmt.Errorf("invalid decoy kind '%s' (must be one of %v)", kind, DecoyKinds)
+		}
+		options.kinds = append(options.kinds, kind)
+	}
+	options.count = *count
+	if options.count == 0 {
+		options.count = len(options.kinds)
+	} else if options.count < 0 {
+		return nil, fmt.Errorf("invalid -count %d (must be at least 1)", options.count)
+	}
+	options.seed = *seed
+	if options.seed == 0 {
+		options.seed = time.Now().UnixNano()
+	}
+	return options, nil
+}
+
+// Plants -count decoys (taking turns through the kinds) in each of the directories, logging each as a create activity (with its kind
+// as its method), and recording each in the decoy manifest (and as an artifact, for cleanup)
+func plantDecoys(activityLog Sink, parent *ActivityLogEntry, options *DecoyOptions) *DecoyResponse {
+	response := new(DecoyResponse)
+	random := rand.New(rand.NewSource(options.seed))
+	for _, dir := range options.dirs {
+		for i := 0; i < options.count; i++ {
+			kind := options.kinds[i % len(options.kinds)]
+			path := getDecoyPath(dir, kind, random)
+			entry := newChildLogEntry(parent, "create")
+			entry.path = escapeRawText(path)
+			entry.method = kind
+			entry.labels = addLabel(entry.labels, "decoy", "true")
+
+			decoy, err := plantDecoy(path, kind, random)
+			if err != nil {
+				fmt.Printf("Couldn't plant decoy %s: %v\n", path, err)
+				entry.status = getWriteFileStatus(err)
+				entry.details = escapeRawText(err.Error())
+				response.failed++
+			} else {
+				decoy.Timestamp = time.Now().Format(time.RFC3339)
+				decoy.RunId = unescapeRawText(parent.runId)
+				err = appendDecoyManifest(options.manifest, decoy)
+				if err != nil {
+					fmt.Printf("Couldn't record decoy %s in %s: %v\n", path, options.manifest, err)
+				}
+				trackArtifact(entry, "file", path, "delete", path)
+				fmt.Printf("Planted %s decoy %s (%d bytes)\n", kind, path, decoy.Size)
+				entry.status = "created"
+				entry.details = escapeRawText(fmt.Sprintf("%s decoy, %d bytes, sha256 %s", kind, decoy.Size, decoy.SHA256))
+				response.planted++
+			}
+			writeLogEntry(activityLog, entry)
+		}
+	}
+	response.decoys = response.planted + response.failed
+	response.status = getDecoyStatus(response.planted, response.failed)
+	return response
+}
+
+// Gets a path in dir for a decoy of the kind that isn't taken: one of its names, or if they all are, one of them numbered (ie.
+// "Payroll (2).xlsx")
+func getDecoyPath(dir string, kind string, random *rand.Rand) string {
+	names := DecoyNames[kind]
+	start := random.Intn(len(names))
+	for number := 1; ; number++ {
+		for i := range names {
+			name := names[(start + i) % len(names)]
+			if number > 1 {
+				extension := filepath.Ext(name)
+				name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, extension), number, extension)
+			}
+			path := filepath.Join(dir, name)
+			if !fileExists(path) {
+				return path
+			}
+		}
+	}
+}
+
+// Writes a decoy of the kind at path, with its times set back to some time in the last MaxDecoyAge (its access time the same as its
+// modified time, so an access after it's planted moves it on, even where access times are only kept relatively), and gets it as it is
+func plantDecoy(path string, kind string, random *rand.Rand) (*Decoy, error) {
+	modTime := time.Now().Add(-time.Duration(random.Int63n(int64(MaxDecoyAge)))).Truncate(time.Second)
+	contents, err := renderDecoy(kind, modTime, random)
+	if err != nil {
+		return nil, err
+	}
+	perm := os.FileMode(0644)
+	if kind == "pem" {
+		perm = 0600
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY | os.O_CREATE | os.O_EXCL, perm)
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Write(contents)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(path, modTime, modTime)
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	accessTime, err := getAccessTime(path)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(contents)
+	return &Decoy{Kind: kind, Path: path, SHA256: hex.EncodeToString(hash[:]), Size: info.Size(), ModTime: info.ModTime(), AccessTime: accessTime}, nil
+}
+
+// Generates the contents of a decoy of the kind: a Word document or Excel spreadsheet filled in from the templates, or a private key
+func renderDecoy(kind string, modTime time.Time, random *rand.Rand) ([]byte, error) {
+	switch kind {
+	case "docx":
+		// (the whole document's filled in at once, so it's about the same people throughout)
+		template := DecoyDocumentTemplates[random.Intn(len(DecoyDocumentTemplates))]
+		paragraphs := ""
+		for _, text := range strings.Split(fillDecoyTemplate(strings.Join(template, "\n"), modTime, random), "\n") {
+			paragraphs += "<w:p><w:r><w:t xml:space=\"preserve\">" + escapeDecoyXML(text) + "</w:t></w:r></w:p>"
+		}
+		return writeDecoyArchive(modTime, map[string]string{
+			"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`,
+			"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/></Relationships>`,
+			"word/document.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + paragraphs + `</w:body></w:document>`,
+		})
+	case "xlsx":
+		rows := "<row r=\"1\">"
+		for i, column := range DecoySpreadsheetColumns {
+			rows += getDecoyCell(i, 1, column)
+		}
+		rows += "</row>"
+		for row := 2; row < 2 + 8 + random.Intn(8); row++ {
+			rows += fmt.Sprintf("<row r=\"%d\">", row)
+			for i, value := range strings.Split(fillDecoyTemplate("{name}\t{user}\t{password}\t{account}", modTime, random), "\t") {
+				rows += getDecoyCell(i, row, value)
+			}
+			rows += fmt.Sprintf("<c r=\"E%d\"><v>%d</v></c></row>", row, 45000 + random.Intn(120) * 1000)
+		}
+		return writeDecoyArchive(modTime, map[string]string{
+			"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`,
+			"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`,
+			"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+			"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+			"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + rows + `</sheetData></worksheet>`,
+		})
+	case "pem":
+		// (a real key, so it parses, though it's never used for anything)
+		seed := make([]byte, ed25519.SeedSize)
+		random.Read(seed)
+		key, err := x509.MarshalPKCS8PrivateKey(ed25519.NewKeyFromSeed(seed))
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), nil
+	}
+	return nil, fmt.Errorf("unknown decoy kind %s", kind)
+}
+
+// Fills in a decoy template's placeholders with made-up values (the same ones throughout the text, ie. {user} is {name}'s username)
+func fillDecoyTemplate(text string, modTime time.Time, random *rand.Rand) string {
+	name := DecoyPeople[random.Intn(len(DecoyPeople))]
+	user := strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(name, " ", "."), "'", ""))
+	password := fmt.Sprintf("%s%d!", []string{"Summer", "Winter", "Welcome", "Passw0rd", "Company"}[random.Intn(5)], 2000 + random.Intn(25))
+	return strings.NewReplacer(
+		"{name}", name,
+		"{name2}", DecoyPeople[random.Intn(len(DecoyPeople))],
+		"{amount}", fmt.Sprintf("$%d,%03d,000", 1 + random.Intn(900), random.Intn(1000)),
+		"{date}", modTime.AddDate(0, 1 + random.Intn(6), random.Intn(28)).Format("January 2, 2006"),
+		"{year}", fmt.Sprint(modTime.Year()),
+		"{quarter}", fmt.Sprint((int(modTime.Month()) + 2) / 3),
+		"{user}", user,
+		"{password}", password,
+		"{account}", fmt.Sprintf("%08d", random.Intn(100000000)),
+		"{host}", fmt.Sprintf("10.%d.%d.%d", random.Intn(256), random.Intn(256), 1 + random.Intn(254)),
+	).Replace(text)
+}
+
+// Gets a spreadsheet cell with the text in it, in the column (from 0) and row (from 1)
+func getDecoyCell(column int, row int, text string) string {
+	return fmt.Sprintf("<c r=\"%c%d\" t=\"inlineStr\"><is><t>%s</t></is></c>", 'A' + column, row, escapeDecoyXML(text))
+}
+
+// Escapes text for a decoy document's XML
+func escapeDecoyXML(text string) string {
+	escaped := new(bytes.Buffer)
+	xml.EscapeText(escaped, []byte(text))
+	return escaped.String()
+}
+
+// Writes the parts of an Office document into a zip archive (the container .docx and .xlsx files are), dated the modified time
+func writeDecoyArchive(modTime time.Time, parts map[string]string) ([]byte, error) {
+	archive := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(archive)
+	// ([Content_Types].xml goes first, as Office writes it)
+	names := []string{"[Content_Types].xml"}
+	for name := range parts {
+		if name != names[0] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	for _, name := range names {
+		partWriter, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+		if err != nil {
+			return nil, err
+		}
+		_, err = partWriter.Write([]byte(parts[name]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := zipWriter.Close()
+	return archive.Bytes(), err
+}
+
+// Checks each of the decoys in the manifest for whether it's been touched since it was planted, logging each as a decoy activity
+// (with check as its method) whose status is deleted, modified, accessed (its access time's moved on), or untouched. The check puts
+// each decoy's access time back after reading it, so it isn't counted as an access itself.
+func checkDecoys(activityLog Sink, parent *ActivityLogEntry, options *DecoyOptions) (*DecoyResponse, error) {
+	response := &DecoyResponse{status: "error"}
+	decoys, err := readDecoyManifest(options.manifest)
+	if err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	response.decoys = len(decoys)
+	for _, decoy := range decoys {
+		entry := newChildLogEntry(parent, "decoy")
+		entry.path = escapeRawText(decoy.Path)
+		entry.method = "check"
+		entry.labels = addLabel(entry.labels, "decoy-run-id", decoy.RunId)
+		status, details, err := checkDecoy(decoy)
+		if err != nil {
+			fmt.Printf("Couldn't check decoy %s: %v\n", decoy.Path, err)
+			entry.status = getFileErrorStatus(err)
+			entry.details = escapeRawText(err.Error())
+			response.failed++
+			writeLogEntry(activityLog, entry)
+			continue
+		}
+		fmt.Printf("Decoy %s: %s\n", decoy.Path, details)
+		entry.status = status
+		entry.details = escapeRawText(details)
+		writeLogEntry(activityLog, entry)
+		switch status {
+		case "deleted":
+			response.deleted++
+		case "modified":
+			response.modified++
+		case "accessed":
+			response.accessed++
+		default:
+			response.untouched++
+		}
+	}
+	response.status = getDecoyStatus(response.decoys - response.failed, response.failed)
+	return response, nil
+}
+
+// Gets what's happened to the decoy since it was planted ([deleted, modified, accessed, untouched]), and the details of it
+func checkDecoy(decoy *Decoy) (string, string, error) {
+	info, err := os.Stat(decoy.Path)
+	if os.IsNotExist(err) {
+		return "deleted", "deleted", nil
+	} else if err != nil {
+		return "", "", err
+	}
+	accessTime, err := getAccessTime(decoy.Path)
+	if err != nil {
+		return "", "", err
+	}
+	contents, err := os.ReadFile(decoy.Path)
+	if err != nil {
+		return "", "", err
+	}
+	os.Chtimes(decoy.Path, accessTime, info.ModTime())
+
+	hash := sha256.Sum256(contents)
+	sha := hex.EncodeToString(hash[:])
+	switch {
+	case sha != decoy.SHA256:
+		return "modified", fmt.Sprintf("modified at %s, %d bytes (was %d), sha256 %s", info.ModTime().Format(time.RFC3339), info.Size(), decoy.Size, sha), nil
+	case !info.ModTime().Equal(decoy.ModTime):
+		return "modified", fmt.Sprintf("modified at %s (with the same contents)", info.ModTime().Format(time.RFC3339)), nil
+	case accessTime.After(decoy.AccessTime):
+		return "accessed", fmt.Sprintf("accessed at %s", accessTime.Format(time.RFC3339)), nil
+	}
+	return "untouched", fmt.Sprintf("untouched since it was planted at %s", decoy.Timestamp), nil
+}
+
+// Removes each of the decoys in the manifest with delete, as part of the parent's run, logging each as its own entry (with a decoy=true
+// label), and recording in the manifest each one that's gone
+func removeDecoys(activityLog Sink, parent *ActivityLogEntry, options *DecoyOptions) (*DecoyResponse, error) {
+	response := &DecoyResponse{status: "error"}
+	decoys, err := readDecoyManifest(options.manifest)
+	if err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	response.decoys = len(decoys)
+	for _, decoy := range decoys {
+		args := []string{decoy.Path}
+		entry := newChildLogEntry(parent, "delete")
+		entry.processCmd = escapeCommandString("delete", args)
+		entry.labels = addLabel(entry.labels, "decoy", "true")
+		err := runCommandSafely(activityLog, entry, "delete", args)
+		if err != nil || !containsString(ArtifactRemovedStatuses, entry.status) {
+			fmt.Printf("Couldn't remove decoy %s: %s\n", decoy.Path, entry.status)
+			response.failed++
+			continue
+		}
+		removed := *decoy
+		removed.Timestamp = time.Now().Format(time.RFC3339)
+		removed.Removed = true
+		err = appendDecoyManifest(options.manifest, &removed)
+		if err != nil {
+			fmt.Printf("Couldn't record decoy %s as removed in %s: %v\n", decoy.Path, options.manifest, err)
+		}
+		response.removed++
+	}
+	response.status = getDecoyStatus(response.removed, response.failed)
+	return response, nil
+}
+
+// Gets the status of planting, checking, or removing decoys, from how many were and weren't ([completed, partial, error])
+func getDecoyStatus(succeeded int, failed int) string {
+	if failed == 0 {
+		return "completed"
+	} else if succeeded > 0 {
+		return "partial"
+	}
+	return "error"
+}
+
+// Appends the decoy to the manifest
+func appendDecoyManifest(path string, decoy *Decoy) error {
+	contents, err := json.Marshal(decoy)
+	if err != nil {
+		return err
+	}
+	manifest, err := os.OpenFile(path, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+	_, err = manifest.Write(append(contents, '\n'))
+	return err
+}
+
+// Reads the decoys in the manifest that are still there (planted, and not since removed), in the order they were planted
+func readDecoyManifest(path string) ([]*Decoy, error) {
+	manifest, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer manifest.Close()
+
+	decoys := []*Decoy{}
+	scanner := bufio.NewScanner(manifest)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		decoy := new(Decoy)
+		err = json.Unmarshal(scanner.Bytes(), decoy)
+		if err != nil || decoy.Path == "" || decoy.SHA256 == "" {
+			return nil, fmt.Errorf("invalid decoy manifest %s: line %d isn't a decoy", path, line)
+		}
+		if !decoy.Removed {
+			decoys = append(decoys, decoy)
+			continue
+		}
+		for i := len(decoys) - 1; i >= 0; i-- {
+			if decoys[i].Path == decoy.Path {
+				decoys = append(decoys[:i], decoys[i + 1:]...)
+				break
+			}
+		}
+	}
+	return decoys, scanner.Err()
+}
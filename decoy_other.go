@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Gets when the file was last accessed (as the filesystem keeps it: a filesystem mounted noatime never moves it on)
+func getAccessTime(path string) (time.Time, error) {
+	var stat unix.Stat_t
+	err := unix.Stat(path, &stat)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(stat.Atim.Unix()), nil
+}
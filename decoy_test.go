@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Decoy(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	manifestPath := dir + "/" + DefaultDecoyManifestName
+	firstDir, secondDir := dir + "/first", dir + "/second"
+	assert.Nil(t, os.Mkdir(firstDir, 0755))
+	assert.Nil(t, os.Mkdir(secondDir, 0755))
+
+	// One of each kind is planted in each directory, and recorded (next to the activity log)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "decoy", "plant", "-seed=42", firstDir, secondDir})
+	assert.Equal(t, "decoy", activityLogEntry.activity)
+	assert.Equal(t, "plant", activityLogEntry.method)
+	assert.Equal(t, "completed", activityLogEntry.status)
+	assert.Equal(t, "6 decoys planted in 2 directories\\, 0 failed (seed 42)", activityLogEntry.details)
+	decoys, err := readDecoyManifest(manifestPath)
+	assert.Nil(t, err)
+	assert.Len(t, decoys, 6)
+	kinds := []string{}
+	for _, decoy := range decoys {
+		assert.FileExists(t, decoy.Path)
+		assert.Less(t, decoy.ModTime, time.Now().Add(-time.Minute))
+		kinds = append(kinds, decoy.Kind)
+	}
+	assert.Equal(t, []string{"docx", "xlsx", "pem", "docx", "xlsx", "pem"}, kinds)
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "create", parsedLog.entries[0].activity)
+	assert.Equal(t, "created", parsedLog.entries[0].status)
+	assert.Equal(t, "decoy=true", parsedLog.entries[0].labels)
+
+	// Until something touches them, they're untouched (checking them doesn't count)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "decoy", "check"})
+	assert.Equal(t, "6 decoys: 0 accessed\\, 0 modified\\, 0 deleted\\, 6 untouched\\, 0 failed", activityLogEntry.details)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "decoy", "check"})
+	assert.Equal(t, "6 decoys: 0 accessed\\, 0 modified\\, 0 deleted\\, 6 untouched\\, 0 failed", activityLogEntry.details)
+
+	// (moving the access time on, as reading it would where the filesystem keeps access times)
+	info, err := os.Stat(decoys[0].Path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chtimes(decoys[0].Path, time.Now(), info.ModTime()))
+	assert.Nil(t, os.WriteFile(decoys[1].Path, []byte("encrypted"), 0644))
+	assert.Nil(t, os.Remove(decoys[2].Path))
+	os.Remove(logFilePath)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "decoy", "check"})
+	assert.Equal(t, "check", activityLogEntry.method)
+	assert.Equal(t, "completed", activityLogEntry.status)
+	assert.Equal(t, "6 decoys: 1 accessed\\, 1 modified\\, 1 deleted\\, 3 untouched\\, 0 failed", activityLogEntry.details)
+	parsedLog, err = readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 7)
+	statuses := []string{}
+	for _, entry := range parsedLog.entries[:6] {
+		assert.Equal(t, "decoy", entry.activity)
+		assert.Equal(t, "check", entry.method)
+		statuses = append(statuses, entry.status)
+	}
+	assert.Equal(t, []string{"accessed", "modified", "deleted", "untouched", "untouched", "untouched"}, statuses)
+
+	// The rest are removed (and the deleted one's already gone)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "decoy", "remove"})
+	assert.Equal(t, "remove", activityLogEntry.method)
+	assert.Equal(t, "completed", activityLogEntry.status)
+	assert.Equal(t, "6 of 6 decoys removed\\, 0 failed", activityLogEntry.details)
+	for _, decoy := range decoys {
+		assert.NoFileExists(t, decoy.Path)
+	}
+	decoys, err = readDecoyManifest(manifestPath)
+	assert.Nil(t, err)
+	assert.Empty(t, decoys)
+
+	// Without a manifest, there's nothing to check
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "decoy", "check", "-decoys=" + dir + "/missing.jsonl"})
+	assert.Equal(t, "not_found", activityLogEntry.status)
+}
+
+func TestMain_Decoy_Plant_Names(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// Once every name's taken, they're numbered
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "decoy", "plant", "-kinds=pem", "-count=8", dir})
+	assert.Equal(t, "completed", activityLogEntry.status)
+	matches, err := filepath.Glob(dir + "/*(2).*")
+	assert.Nil(t, err)
+	assert.Len(t, matches, 2)
+
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "decoy", "plant", dir + "/missing"})
+	assert.Equal(t, "error", activityLogEntry.status)
+	assert.Contains(t, activityLogEntry.details, "0 decoys planted in 1 directories\\, 3 failed")
+}
+
+func TestRenderDecoy(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+
+	// Documents are real Office archives, filled in from the templates
+	for _, kind := range []string{"docx", "xlsx"} {
+		contents, err := renderDecoy(kind, modTime, rand.New(rand.NewSource(1)))
+		assert.Nil(t, err)
+		archive, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+		assert.Nil(t, err)
+		assert.Equal(t, "[Content_Types].xml", archive.File[0].Name)
+		assert.Equal(t, modTime, archive.File[0].Modified.UTC())
+		for _, file := range archive.File {
+			reader, err := file.Open()
+			assert.Nil(t, err)
+			part := new(bytes.Buffer)
+			part.ReadFrom(reader)
+			assert.NotContains(t, part.String(), "{")
+		}
+	}
+
+	// Keys parse
+	contents, err := renderDecoy("pem", modTime, rand.New(rand.NewSource(1)))
+	assert.Nil(t, err)
+	block, _ := pem.Decode(contents)
+	assert.Equal(t, "PRIVATE KEY", block.Type)
+	_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	assert.Nil(t, err)
+
+	// The same seed makes the same decoy
+	again, err := renderDecoy("pem", modTime, rand.New(rand.NewSource(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, contents, again)
+
+	// A template's filled in with the same person throughout
+	filled := strings.Split(fillDecoyTemplate("{name}|{user}|{name}", modTime, rand.New(rand.NewSource(3))), "|")
+	assert.Equal(t, filled[0], filled[2])
+	assert.Equal(t, strings.ToLower(strings.ReplaceAll(filled[0], " ", ".")), filled[1])
+}
+
+func TestParseDecoyOptions(t *testing.T) {
+	options, err := parseDecoyOptions([]string{"plant", "-kinds=docx,pem", "-seed=7", "/tmp/a", "/tmp/b"}, "decoys.jsonl")
+	assert.Nil(t, err)
+	assert.Equal(t, &DecoyOptions{mode: "plant", manifest: "decoys.jsonl", dirs: []string{"/tmp/a", "/tmp/b"}, kinds: []string{"docx", "pem"}, count: 2, seed: 7}, options)
+	options, err = parseDecoyOptions([]string{"check", "-decoys=/tmp/decoys.jsonl"}, "decoys.jsonl")
+	assert.Nil(t, err)
+	assert.Equal(t, "/tmp/decoys.jsonl", options.manifest)
+
+	_, err = parseDecoyOptions([]string{}, "decoys.jsonl")
+	assert.ErrorContains(t, err, "not enough arguments for decoy!")
+	_, err = parseDecoyOptions([]string{"hide"}, "decoys.jsonl")
+	assert.ErrorContains(t, err, "invalid mode for decoy: hide (must be plant, check, or remove)")
+	_, err = parseDecoyOptions([]string{"plant"}, "decoys.jsonl")
+	assert.ErrorContains(t, err, "not enough arguments for decoy plant!")
+	_, err = parseDecoyOptions([]string{"plant", "-kinds=pdf", "/tmp"}, "decoys.jsonl")
+	assert.ErrorContains(t, err, "invalid decoy kind 'pdf'")
+	_, err = parseDecoyOptions([]string{"remove", "/tmp"}, "decoys.jsonl")
+	assert.ErrorContains(t, err, "unexpected arguments [/tmp]")
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Gets when the file was last accessed (as NTFS keeps it: where last access updates are disabled, it never moves on)
+func getAccessTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return info.ModTime(), nil
+	}
+	return time.Unix(0, data.LastAccessTime.Nanoseconds()), nil
+}
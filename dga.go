@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The top-level domains dga's domains end in, by default
+var DefaultDGATLDs = []string{"com", "net", "org", "info", "biz"}
+
+// How long dga's domains' names are (before the TLD), at the shortest and longest
+const DGAMinLength = 8
+const DGAMaxLength = 16
+
+// How dga looks up a domain (replaced in tests, so they don't depend on the network's DNS)
+var dgaLookupHost = func(ctx context.Context, host string) ([]string, error) {
+	ips, err := getSourceResolver().LookupIP(ctx, getIPNetwork("ip"), host)
+	addrs := []string{}
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	return addrs, err
+}
+
+// Gets the DNS record types dga's lookups are for, by the IP version
+func getDNSQueryType() string {
+	switch ipVersion {
+	case "4":
+		return "A"
+	case "6":
+		return "AAAA"
+	}
+	return "A+AAAA"
+}
+
+// Options for the dga command
+type DGAOptions struct {
+	count				int
+	seed				int64
+	tlds				[]string
+	http				bool			// whether to make an HTTP request to each domain too
+	timeout				time.Duration	// how long to wait on each lookup
+}
+
+// Response data from dga action
+type DGAResponse struct {
+	resolved			int
+	notFound			int
+	failed				int
+}
+
+// Parses dga's arguments: [-count=n] [-seed=n] [-tlds=com,net,...] [-http] [-timeout=duration], where the seed defaults to today's
+// date (as YYYYMMDD), as date-seeded DGAs do, so a day's domains are the same all day
+func parseDGAOptions(args []string, now time.Time) (*DGAOptions, error) {
+	flags := flag.NewFlagSet("dga", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	count := flags.Int("count", 10, "how many domains to generate")
+	defaultSeed, _ := strconv.ParseInt(now.Format("20060102"), 10, 64)
+	seed := flags.Int64("seed", defaultSeed, "the seed the domains are generated from")
+	tlds := flags.String("tlds", strings.Join(DefaultDGATLDs, ","), "the top-level domains the domains end in")
+	http := flags.Bool("http", false, "whether to make an HTTP request to each domain too")
+	timeout := flags.Duration("timeout", 2 * time.Second, "how long to wait on each lookup")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dga: %v", err)
+	}
+	if *count < 1 {
+		return nil, fmt.Errorf("invalid dga: invalid -count %d (must be at least 1)", *count)
+	}
+	options := &DGAOptions{count: *count, seed: *seed, http: *http, timeout: *timeout}
+	for _, tld := range strings.Split(*tlds, ",") {
+		if tld = strings.Trim(strings.TrimSpace(tld), "."); tld != "" {
+			options.tlds = append(options.tlds, tld)
+		}
+	}
+	if len(options.tlds) == 0 {
+		return nil, fmt.Errorf("invalid dga: no TLDs in '%s'", *tlds)
+	}
+	return options, nil
+}
+
+// Generates the domains for the seed: each one's a random run of lowercase letters, between DGAMinLength and DGAMaxLength long, with
+// one of the TLDs, all drawn from a generator seeded with the seed (so the same seed always gives the same domains)
+func generateDGADomains(seed int64, count int, tlds []string) []string {
+	random := rand.New(rand.NewSource(seed))
+	domains := []string{}
+	for i := 0; i < count; i++ {
+		name := make([]byte, DGAMinLength + random.Intn(DGAMaxLength - DGAMinLength + 1))
+		for j := range name {
+			name[j] = byte('a' + random.Intn(26))
+		}
+		domains = append(domains, string(name) + "." + tlds[random.Intn(len(tlds))])
+	}
+	return domains
+}
+
+// Gets the status a lookup's error stands for (NXDOMAIN, which most of a DGA's domains get, is not_found)
+func getDNSErrorStatus(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return "not_found"
+		} else if dnsErr.IsTimeout {
+			return "timeout"
+		}
+	}
+	return "error"
+}
+
+// Looks up each of the domains (and with -http, makes an HTTP request to each), logging each lookup and request as its own send
+// activity, sharing the parent's correlation ID
+func runDGA(activityLog Sink, parent *ActivityLogEntry, options *DGAOptions, domains []string) *DGAResponse {
+	response := new(DGAResponse)
+	for i, domain := range domains {
+		if isRunCancelled() {
+			break
+		}
+		entry := newChildLogEntry(parent, "send")
+		entry.method = getDNSQueryType()
+		entry.destAddr = domain
+		entry.destPort = 53
+		entry.protocol = "dns"
+		fmt.Printf("Looking up %s (%d of %d)...\n", domain, i + 1, len(domains))
+		ctx, cancel := context.WithTimeout(runContext, options.timeout)
+		addrs, err := dgaLookupHost(ctx, domain)
+		cancel()
+		if err != nil {
+			fmt.Printf("Lookup of %s failed: %v\n", domain, err)
+			entry.status = getDNSErrorStatus(err)
+			entry.details = escapeRawText(err.Error())
+		} else {
+			entry.status = "resolved"
+			entry.details = escapeRawText(strings.Join(addrs, " "))
+		}
+		switch entry.status {
+		case "resolved":
+			response.resolved++
+		case "not_found":
+			response.notFound++
+		default:
+			response.failed++
+		}
+		writeLogEntry(activityLog, entry)
+
+		if options.http {
+			requestEntry := newChildLogEntry(parent, "send")
+			requestEntry.method = "GET"
+			requestEntry.destAddr = domain
+			requestEntry.destPort = 80
+			requestEntry.protocol = "http"
+			messageResponse, err := sendMessage("GET", domain, 80, "http", nil, "")
+			if err != nil {
+				fmt.Printf("Request to %s failed: %v\n", domain, err)
+				requestEntry.status = messageResponse.status
+			} else {
+				requestEntry.status = "sent"
+			}
+			requestEntry.path = escapeRawText(messageResponse.path)
+			requestEntry.sourceAddr = messageResponse.sourceAddr
+			requestEntry.sourcePort = messageResponse.sourcePort
+			recordSendConnection(requestEntry, messageResponse)
+			requestEntry.bytesSent = messageResponse.bytesSent
+			requestEntry.bytesReceived = messageResponse.bytesReceived
+			writeLogEntry(activityLog, requestEntry)
+		}
+	}
+	return response
+}
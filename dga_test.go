@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Replaces dga's lookups with ones that resolve only the given domains, and get NXDOMAIN for everything else
+func useTestDGALookups(t *testing.T, resolved map[string]string) {
+	lookupHost := dgaLookupHost
+	dgaLookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if addr, ok := resolved[host]; ok {
+			return []string{addr}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	t.Cleanup(func() {
+		dgaLookupHost = lookupHost
+	})
+}
+
+func TestMain_DGA(t *testing.T) {
+	domains := generateDGADomains(42, 5, DefaultDGATLDs)
+	useTestDGALookups(t, map[string]string{domains[2]: "10.0.0.7"})
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "dga", "-count=5", "-seed=42"})
+	assert.Equal(t, activityLogEntry.activity, "dga")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "5 domains\\, 1 resolved\\, 4 not found\\, 0 failed\\, seed 42")
+
+	// Every lookup's logged, with its domain
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 6)
+	for i, domain := range domains {
+		lookup := parsedLog.entries[i]
+		assert.Equal(t, "send", lookup.activity)
+		assert.Equal(t, "dns", lookup.protocol)
+		assert.Equal(t, domain, lookup.destAddr)
+		assert.Equal(t, activityLogEntry.correlationId, lookup.correlationId)
+		if i == 2 {
+			assert.Equal(t, "resolved", lookup.status)
+			assert.Equal(t, "10.0.0.7", lookup.details)
+		} else {
+			assert.Equal(t, "not_found", lookup.status)
+		}
+	}
+}
+
+func TestGenerateDGADomains(t *testing.T) {
+	// The same seed always gives the same domains, and a different one different domains
+	domains := generateDGADomains(20261014, 50, []string{"com", "net"})
+	assert.Equal(t, domains, generateDGADomains(20261014, 50, []string{"com", "net"}))
+	assert.NotEqual(t, domains, generateDGADomains(20261015, 50, []string{"com", "net"}))
+	pattern := regexp.MustCompile(`^[a-z]{8,16}\.(com|net)$`)
+	for _, domain := range domains {
+		assert.Regexp(t, pattern, domain)
+	}
+}
+
+func TestParseDGAOptions(t *testing.T) {
+	options, err := parseDGAOptions([]string{"-tlds=.xyz, top", "-http"}, time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, &DGAOptions{count: 10, seed: 20261014, tlds: []string{"xyz", "top"}, http: true, timeout: 2 * time.Second}, options)
+
+	_, err = parseDGAOptions([]string{"-count=0"}, time.Now())
+	assert.ErrorContains(t, err, "invalid dga: invalid -count 0 (must be at least 1)")
+	_, err = parseDGAOptions([]string{"-tlds=,"}, time.Now())
+	assert.ErrorContains(t, err, "invalid dga: no TLDs in ','")
+}
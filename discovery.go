@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// A single native query run to discover something about the host
+type DiscoveryQuery struct {
+	name				string		// what's being discovered (ie. "interfaces", "neighbors", "routes")
+	cmd					string		// the native command to run
+	args				[]string	// the args to the native command
+	fallbackPath		string		// a file to read instead, if the command isn't available (ie. /proc/net/arp)
+}
+
+// Response data from a set of discovery queries
+type DiscoveryResponse struct {
+	completed			int
+	failed				int
+	status				string
+}
+
+// Gets the native queries for discovering the host's network interfaces, ARP/neighbor table, and routes
+func getNetworkDiscoveryQueries(goos string) []DiscoveryQuery {
+	switch goos {
+	case "windows":
+		return []DiscoveryQuery{
+			{name: "interfaces", cmd: "ipconfig", args: []string{"/all"}},
+			{name: "neighbors", cmd: "arp", args: []string{"-a"}},
+			{name: "routes", cmd: "route", args: []string{"print"}},
+		}
+	case "linux":
+		return []DiscoveryQuery{
+			{name: "interfaces", cmd: "ip", args: []string{"addr", "show"}, fallbackPath: "/proc/net/dev"},
+			{name: "neighbors", cmd: "ip", args: []string{"neigh", "show"}, fallbackPath: "/proc/net/arp"},
+			{name: "routes", cmd: "ip", args: []string{"route", "show"}, fallbackPath: "/proc/net/route"},
+		}
+	default:
+		// darwin, freebsd, etc.
+		return []DiscoveryQuery{
+			{name: "interfaces", cmd: "ifconfig", args: []string{"-a"}},
+			{name: "neighbors", cmd: "arp", args: []string{"-a"}},
+			{name: "routes", cmd: "netstat", args: []string{"-rn"}},
+		}
+	}
+}
+
+// The sub-modes of the discover command, in the order they're run
+var SystemDiscoveryModes = []string{"users", "processes", "services", "installed-software", "domain"}
+
+// Gets the native queries for discovering the given system details (users, processes, services, installed-software, domain)
+func getSystemDiscoveryQueries(goos string, modes []string) ([]DiscoveryQuery, error) {
+	queries := []DiscoveryQuery{}
+	for _, mode := range modes {
+		query, err := getSystemDiscoveryQuery(goos, mode)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
+
+// Gets the native query for discovering a single system detail
+func getSystemDiscoveryQuery(goos string, mode string) (DiscoveryQuery, error) {
+	query := DiscoveryQuery{name: mode}
+	switch goos + "/" + mode {
+	case "windows/users":
+		query.cmd, query.args = "net", []string{"user"}
+	case "windows/processes":
+		query.cmd, query.args = "tasklist", []string{"/v"}
+	case "windows/services":
+		query.cmd, query.args = "sc", []string{"query", "state=", "all"}
+	case "windows/installed-software":
+		query.cmd, query.args = "reg", []string{"query", "HKLM\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall", "/s", "/v", "DisplayName"}
+	case "windows/domain":
+		query.cmd, query.args = "net", []string{"config", "workstation"}
+	case "linux/users":
+		query.cmd, query.args, query.fallbackPath = "getent", []string{"passwd"}, "/etc/passwd"
+	case "linux/processes", "darwin/processes":
+		query.cmd, query.args = "ps", []string{"-ef"}
+	case "linux/services":
+		query.cmd, query.args = "systemctl", []string{"list-units", "--type=service", "--all", "--no-pager"}
+	case "linux/installed-software":
+		query.cmd, query.args = firstAvailableCommand([]string{"dpkg-query", "-W"}, []string{"rpm", "-qa"}, []string{"apk", "info"}, []string{"pacman", "-Q"})
+	case "linux/domain":
+		query.cmd, query.args, query.fallbackPath = "realm", []string{"list"}, "/etc/resolv.conf"
+	case "darwin/users":
+		query.cmd, query.args = "dscl", []string{".", "list", "/Users"}
+	case "darwin/services":
+		query.cmd, query.args = "launchctl", []string{"list"}
+	case "darwin/installed-software":
+		query.cmd, query.args = "system_profiler", []string{"SPApplicationsDataType"}
+	case "darwin/domain":
+		query.cmd, query.args = "dsconfigad", []string{"-show"}
+	default:
+		if !containsString(SystemDiscoveryModes, mode) {
+			return query, fmt.Errorf("invalid discovery mode: %s (must be one of %s)", mode, strings.Join(SystemDiscoveryModes, ", "))
+		}
+		return query, fmt.Errorf("discovery mode %s is not supported on %s", mode, goos)
+	}
+	return query, nil
+}
+
+// Gets the first of the given commands (with args) that's installed, or the first one if none are
+func firstAvailableCommand(candidates ...[]string) (string, []string) {
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate[0]); err == nil {
+			return candidate[0], candidate[1:]
+		}
+	}
+	return candidates[0][0], candidates[0][1:]
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Runs each discovery query, logging each as a discovery activity with a summary of what was found
+func runDiscoveryQueries(activityLog Sink, parent *ActivityLogEntry, queries []DiscoveryQuery) *DiscoveryResponse {
+	response := new(DiscoveryResponse)
+	for _, query := range queries {
+		entry := newChildLogEntry(parent, "discovery")
+		entry.path = query.name
+
+		output, err := runDiscoveryQuery(query, entry)
+		if err != nil {
+			fmt.Printf("Unable to discover %s: %v\n", query.name, err)
+			response.failed += 1
+			writeLogEntry(activityLog, entry)
+			continue
+		}
+
+		summary := summarizeDiscoveryOutput(query.name, output)
+		fmt.Printf("Discovered %s: %s\n", query.name, summary)
+		entry.status = "discovered"
+		entry.details = escapeRawText(summary)
+		response.completed += 1
+		writeLogEntry(activityLog, entry)
+	}
+
+	if response.failed == 0 {
+		response.status = "completed"
+	} else if response.completed > 0 {
+		response.status = "partial"
+	} else {
+		response.status = "error"
+	}
+	return response
+}
+
+// Runs a single discovery query, recording the command (or fallback file) used to the entry, and returns its output
+func runDiscoveryQuery(query DiscoveryQuery, entry *ActivityLogEntry) (string, error) {
+	if _, err := exec.LookPath(query.cmd); err != nil && query.fallbackPath != "" {
+		// Read the fallback file instead
+		entry.processCmd = escapeCommandString("read", []string{query.fallbackPath})
+		contents, err := os.ReadFile(query.fallbackPath)
+		if err != nil {
+			entry.status = "error"
+			return "", err
+		}
+		return string(contents), nil
+	}
+
+	entry.processCmd = escapeCommandString(query.cmd, query.args)
+	cmd := exec.CommandContext(runContext, query.cmd, query.args...)
+	var output strings.Builder
+	cmd.Stdout = &output
+	err := cmd.Start()
+	if err != nil {
+		entry.status = "not_found"
+		return "", err
+	}
+	entry.processId = cmd.Process.Pid
+	err = cmd.Wait()
+	if err != nil {
+		entry.status = "error"
+		return "", err
+	}
+	return output.String(), nil
+}
+
+// Summarizes what a discovery query found
+func summarizeDiscoveryOutput(name string, output string) string {
+	lines := 0
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines += 1
+		}
+	}
+	summary := fmt.Sprintf("%d lines of output", lines)
+
+	// For interfaces, we can do better than counting lines
+	if name == "interfaces" {
+		interfaces, err := net.Interfaces()
+		if err == nil {
+			names := []string{}
+			for _, iface := range interfaces {
+				names = append(names, iface.Name)
+			}
+			summary = fmt.Sprintf("%d interfaces (%s)", len(names), strings.Join(names, " "))
+		}
+	}
+	return summary
+}
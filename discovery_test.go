@@ -0,0 +1,80 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_NetEnum(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "netenum"}
+	output := callMain(args)
+	assert.Contains(t, output, "Discovered interfaces: ")
+	assert.Equal(t, activityLogEntry.activity, "netenum")
+	assert.Contains(t, []string{"completed", "partial"}, activityLogEntry.status)
+
+	// Each query should be logged separately
+	assertLogFileContains(t, logFilePath, ",discovery,")
+	assertLogFileContains(t, logFilePath, ",interfaces,discovered,")
+}
+
+func TestGetNetworkDiscoveryQueries(t *testing.T) {
+	for _, goos := range []string{"windows", "linux", "darwin", runtime.GOOS} {
+		queries := getNetworkDiscoveryQueries(goos)
+		names := []string{}
+		for _, query := range queries {
+			names = append(names, query.name)
+		}
+		assert.Equal(t, []string{"interfaces", "neighbors", "routes"}, names)
+	}
+}
+
+func TestRunDiscoveryQueries_Fallback(t *testing.T) {
+	// Precondition: the command doesn't exist, but the fallback file does
+	fallbackPath := t.TempDir() + "/arp"
+	err := createTestFileUnlessExists(fallbackPath, "IP address\n10.0.0.1\n10.0.0.2\n")
+	assert.Nil(t, err)
+
+	entry := new(ActivityLogEntry)
+	output, err := runDiscoveryQuery(DiscoveryQuery{name: "neighbors", cmd: "nonexistent-program", fallbackPath: fallbackPath}, entry)
+	assert.Nil(t, err)
+	assert.Equal(t, "read "+fallbackPath, entry.processCmd)
+	assert.Equal(t, "3 lines of output", summarizeDiscoveryOutput("neighbors", output))
+}
+
+func TestRunDiscoveryQueries_NotFound(t *testing.T) {
+	entry := new(ActivityLogEntry)
+	_, err := runDiscoveryQuery(DiscoveryQuery{name: "neighbors", cmd: "nonexistent-program"}, entry)
+	assert.NotNil(t, err)
+	assert.Equal(t, "not_found", entry.status)
+}
+
+func TestMain_Discover_Processes(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "discover", "processes"}
+	output := callMain(args)
+	assert.Contains(t, output, "Discovered processes: ")
+	assert.Equal(t, activityLogEntry.activity, "discover")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assertLogFileContains(t, logFilePath, ",processes,discovered,")
+}
+
+func TestMain_Discover_InvalidMode(t *testing.T) {
+	args := []string{"./noisemaker", "discover", "passwords"}
+	assertMainPanicsWithMessage(t, args, "invalid discovery mode: passwords")
+}
+
+func TestGetSystemDiscoveryQueries(t *testing.T) {
+	for _, goos := range []string{"windows", "linux", "darwin"} {
+		queries, err := getSystemDiscoveryQueries(goos, SystemDiscoveryModes)
+		assert.Nil(t, err)
+		assert.Len(t, queries, len(SystemDiscoveryModes))
+	}
+
+	_, err := getSystemDiscoveryQueries("plan9", []string{"users"})
+	assert.ErrorContains(t, err, "discovery mode users is not supported on plan9")
+}
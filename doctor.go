@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The commands that change the system, and need both -allow-privileged and to run elevated
+var PrivilegedCommands = []string{"useradd", "userdel", "groupadd", "groupdel", "hosts"}
+
+// Options for the doctor command
+type DoctorOptions struct {
+	target				string		// the host:port to check outbound connectivity to
+	timeout				time.Duration
+	logFilePath			string
+}
+
+// The outcome of one of doctor's checks, and the commands that depend on it
+type DoctorCheck struct {
+	name				string
+	status				string		// [ok, warn, fail]: warn if the commands may not work (or only with other options), fail if they won't
+	details				string
+	commands			string		// the commands that need it, ie. "send, beacon" (or "all commands")
+}
+
+// Response data from doctor action
+type DoctorResponse struct {
+	checks				[]*DoctorCheck
+	passed				int
+	warnings			int
+	failed				int
+	status				string
+}
+
+// Parses doctor's arguments: [-target=host:port] [-timeout=duration]
+func parseDoctorOptions(args []string, logFilePath string) (*DoctorOptions, error) {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	target := flags.String("target", "example.com:443", "the host:port to check outbound connectivity (and name resolution) to")
+	timeout := flags.Duration("timeout", 5 * time.Second, "how long to wait to resolve and connect to the target")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid doctor: %v", err)
+	}
+	if _, _, err := net.SplitHostPort(*target); err != nil {
+		return nil, fmt.Errorf("invalid doctor: invalid -target '%s' (must be host:port)", *target)
+	}
+	return &DoctorOptions{target: *target, timeout: *timeout, logFilePath: logFilePath}, nil
+}
+
+// Checks each of the commands' prerequisites without changing anything (beyond a throwaway file next to the activity log), printing
+// a report of which are met. Nothing's run that could fail midway: every check's outcome is reported, whichever fail.
+func runDoctor(options *DoctorOptions, goos string, output io.Writer) *DoctorResponse {
+	response := new(DoctorResponse)
+	response.checks = append(response.checks,
+		checkWritable("log", options.logFilePath, "all commands"),
+		checkWritable("manifest", artifactManifestPath, "create, dropper, download, browser, useradd, groupadd, hosts, cleanup"),
+		checkWritable("temp-dir", os.TempDir(), "exfil, lolbin, generate, scenario, pipe"),
+	)
+	host, _, _ := net.SplitHostPort(options.target)
+	response.checks = append(response.checks,
+		checkResolve(host, options.timeout),
+		checkConnect(options.target, options.timeout),
+		checkPrivileges(),
+	)
+	response.checks = append(response.checks, checkInterpreters(goos)...)
+
+	for _, check := range response.checks {
+		fmt.Fprintf(output, "[%-4s] %-24s %s (needed by %s)\n", check.status, check.name, check.details, check.commands)
+		switch check.status {
+		case "ok":
+			response.passed++
+		case "warn":
+			response.warnings++
+		default:
+			response.failed++
+		}
+	}
+
+	switch {
+	case response.failed > 0:
+		response.status = "unhealthy"
+	case response.warnings > 0:
+		response.status = "degraded"
+	default:
+		response.status = "healthy"
+	}
+	return response
+}
+
+// Checks that a file can be written at the path: appending to it if it exists, or creating (and removing) it if it doesn't (or in it,
+// if it's a directory)
+func checkWritable(name string, path string, commands string) *DoctorCheck {
+	check := &DoctorCheck{name: name, commands: commands}
+	info, err := os.Stat(path)
+	if err == nil && !info.IsDir() {
+		file, err := os.OpenFile(path, os.O_WRONLY | os.O_APPEND, 0)
+		if err != nil {
+			check.status, check.details = "fail", fmt.Sprintf("can't write to %s: %v", path, err)
+			return check
+		}
+		file.Close()
+		check.status, check.details = "ok", fmt.Sprintf("%s is writable", path)
+		return check
+	}
+
+	dir, probePath := filepath.Dir(path), path + ".doctor"
+	if err == nil {
+		dir, probePath = path, filepath.Join(path, ".noisemaker-doctor")
+	}
+	file, err := os.OpenFile(probePath, os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0644)
+	if err != nil {
+		check.status, check.details = "fail", fmt.Sprintf("can't create files in %s: %v", dir, err)
+		return check
+	}
+	file.Close()
+	os.Remove(probePath)
+	check.status, check.details = "ok", fmt.Sprintf("files can be created in %s", dir)
+	return check
+}
+
+// Checks that the host name resolves (with the resolver the network commands use)
+func checkResolve(host string, timeout time.Duration) *DoctorCheck {
+	check := &DoctorCheck{name: "dns", commands: "send, beacon, dga, traffic, download, exfil, scan"}
+	if net.ParseIP(host) != nil {
+		check.status, check.details = "ok", fmt.Sprintf("%s is an address, so nothing to resolve", host)
+		return check
+	}
+	ctx, cancel := context.WithTimeout(runContext, timeout)
+	defer cancel()
+	addrs, err := getSourceResolver().LookupHost(ctx, host)
+	if err != nil {
+		check.status, check.details = "fail", fmt.Sprintf("can't resolve %s: %v", host, err)
+		return check
+	}
+	check.status, check.details = "ok", fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, " "))
+	return check
+}
+
+// Checks that an outbound TCP connection can be made to the target (bound to the source address, over the IP version)
+func checkConnect(target string, timeout time.Duration) *DoctorCheck {
+	check := &DoctorCheck{name: "outbound", commands: "send, beacon, traffic, download, exfil, scan, ssh, remote-exec"}
+	conn, err := newSourceDialer(timeout).DialContext(runContext, getIPNetwork("tcp"), target)
+	if err != nil {
+		check.status, check.details = "fail", fmt.Sprintf("can't connect to %s: %v", target, err)
+		return check
+	}
+	conn.Close()
+	check.status, check.details = "ok", fmt.Sprintf("connected to %s from %s", target, conn.LocalAddr().String())
+	return check
+}
+
+// Checks that the privileged commands can run: that noisemaker's running elevated, and with -allow-privileged
+func checkPrivileges() *DoctorCheck {
+	check := &DoctorCheck{name: "privileges", commands: strings.Join(PrivilegedCommands, ", ") + ", and playbook steps with requires_privilege"}
+	switch {
+	case !isElevated():
+		check.status, check.details = "warn", "not running elevated (run as root, or as an administrator)"
+	case !*allowPrivilegedPtr:
+		check.status, check.details = "warn", "running elevated, but without -allow-privileged"
+	default:
+		check.status, check.details = "ok", "running elevated, with -allow-privileged"
+	}
+	return check
+}
+
+// Checks which of the interpreters (for the OS) are installed
+func checkInterpreters(goos string) []*DoctorCheck {
+	checks := []*DoctorCheck{}
+	for _, interpreter := range Interpreters {
+		if (interpreter == "cmd" && goos != "windows") || ((interpreter == "sh" || interpreter == "bash") && goos == "windows") {
+			continue
+		}
+		command, _, _ := getInterpreterCommand(goos, interpreter, "", false)
+		check := &DoctorCheck{name: "interpreter:" + interpreter, commands: "execute -interpreter=" + interpreter + ", dropper, fileless"}
+		path, err := exec.LookPath(command)
+		if err != nil {
+			check.status, check.details = "warn", fmt.Sprintf("%s isn't installed (or isn't on the PATH)", command)
+		} else {
+			check.status, check.details = "ok", fmt.Sprintf("%s is at %s", command, path)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Doctor(t *testing.T) {
+	defer func() { isElevated = isProcessElevated }()
+	isElevated = func() bool { return true }
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-allow-privileged", "doctor", "-target=" + net.JoinHostPort(host, port)})
+	assert.Contains(t, output, "[ok  ] log                      " + logFilePath + " is writable (needed by all commands)")
+	assert.Contains(t, output, "[ok  ] outbound                 connected to " + net.JoinHostPort(host, port))
+	assert.Contains(t, output, "[ok  ] privileges               running elevated, with -allow-privileged")
+	assert.Equal(t, activityLogEntry.activity, "doctor")
+	assertLogFileContains(t, logFilePath, ",doctor,")
+
+	// Failures don't stop the rest of the checks
+	isElevated = func() bool { return false }
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "doctor", "-target=127.0.0.1:1", "-timeout=1s"})
+	assert.Contains(t, output, "[fail] outbound                 can't connect to 127.0.0.1:1")
+	assert.Contains(t, output, "[warn] privileges               not running elevated")
+	assert.Contains(t, output, "interpreter:sh")
+	assert.Equal(t, activityLogEntry.status, "unhealthy")
+	assert.Regexp(t, `^[0-9]+ of [0-9]+ checks passed\\, [0-9]+ warnings\\, 1 failed$`, activityLogEntry.details)
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "doctor", "-target=example.com"}, "invalid doctor: invalid -target 'example.com' (must be host:port)")
+}
+
+func TestMain_Doctor_LogUnwritable(t *testing.T) {
+	// The log's in a directory that doesn't exist, so it can't be opened, but the doctor still reports why
+	dir := t.TempDir() + "/missing"
+	logFilePath := dir + "/activity-log.csv"
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "doctor", "-target=127.0.0.1:1", "-timeout=1s"})
+	assert.Contains(t, output, "[fail] log                      can't create files in " + dir)
+	assert.Equal(t, activityLogEntry.status, "unhealthy")
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	check := checkWritable("temp-dir", dir, "exfil")
+	assert.Equal(t, "ok", check.status)
+	assert.Equal(t, "files can be created in " + dir, check.details)
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+
+	check = checkWritable("log", dir + "/new.csv", "all commands")
+	assert.Equal(t, "ok", check.status)
+	assert.False(t, fileExists(dir + "/new.csv.doctor"))
+}
+
+func TestRunDoctor(t *testing.T) {
+	var output bytes.Buffer
+	response := runDoctor(&DoctorOptions{target: "127.0.0.1:1", timeout: time.Second, logFilePath: t.TempDir() + "/log.csv"}, "windows", &output)
+	names := []string{}
+	for _, check := range response.checks {
+		names = append(names, check.name)
+	}
+	assert.Equal(t, []string{"log", "manifest", "temp-dir", "dns", "outbound", "privileges", "interpreter:powershell", "interpreter:cmd"}, names)
+	assert.Equal(t, len(response.checks), response.passed + response.warnings + response.failed)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Options for the download command
+type DownloadOptions struct {
+	url					string
+	path				string
+	thenExecute			bool		// whether to run the file once it's downloaded
+}
+
+// Response data from download action
+type DownloadResponse struct {
+	bytesReceived		int
+	sha256				string
+	processId			int
+	status				string
+}
+
+// Parses download's arguments: [-then-execute] (url) (path)
+func parseDownloadOptions(args []string) (*DownloadOptions, error) {
+	flags := flag.NewFlagSet("download", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	thenExecute := flags.Bool("then-execute", false, "whether to run the file once it's downloaded")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download: %v", err)
+	}
+	if flags.NArg() < 2 {
+		return nil, fmt.Errorf("not enough arguments for download! Args: %v", args)
+	}
+	parsed, err := url.Parse(flags.Arg(0))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid download: invalid url '%s' (must be http:// or https://)", flags.Arg(0))
+	}
+	return &DownloadOptions{url: flags.Arg(0), path: flags.Arg(1), thenExecute: *thenExecute}, nil
+}
+
+// Gets the status a download's HTTP response code stands for
+func getDownloadStatus(code int) string {
+	switch {
+	case code >= 200 && code < 300:
+		return "received"
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return "no_access"
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return "not_found"
+	}
+	return "error"
+}
+
+// Downloads the URL to the file with a GET (as a download cradle does), hashing it as it's written, then (with -then-execute) runs
+// it. Each step is logged as its own entry (send, create, and execute), all sharing the parent's correlation ID.
+func downloadFile(activityLog Sink, parent *ActivityLogEntry, options *DownloadOptions, runAs *RunAsUser) *DownloadResponse {
+	response := new(DownloadResponse)
+
+	// Request it...
+	parsed, _ := url.Parse(options.url)
+	sendEntry := newChildLogEntry(parent, "send")
+	sendEntry.path = escapeRawText(options.url)
+	sendEntry.method = "GET"
+	sendEntry.protocol = parsed.Scheme
+	sendEntry.destAddr = parsed.Hostname()
+	sendEntry.destPort, _ = strconv.Atoi(parsed.Port())
+	if sendEntry.destPort == 0 {
+		sendEntry.destPort = map[string]int{"http": 80, "https": 443}[parsed.Scheme]
+	}
+
+	// (logged with what it put on the wire, and got back, so far)
+	var wire wireCounter
+	writeSendEntry := func() {
+		sendEntry.bytesSent, sendEntry.bytesReceived = wire.counts()
+		writeLogEntry(activityLog, sendEntry)
+	}
+
+	var httpResponse *http.Response
+	req, err := http.NewRequestWithContext(runContext, "GET", options.url, nil)
+	if err == nil {
+		var dnsStarted time.Time
+		trace := &httptrace.ClientTrace{
+			DNSStart: func(info httptrace.DNSStartInfo) {
+				dnsStarted = time.Now()
+			},
+			DNSDone: func(info httptrace.DNSDoneInfo) {
+				sendEntry.dnsTime = int(time.Since(dnsStarted).Milliseconds())
+			},
+			GotConn: func(connInfo httptrace.GotConnInfo) {
+				sendEntry.sourceAddr, sendEntry.sourcePort = splitAddrAndPort(connInfo.Conn.LocalAddr().String())
+				sendEntry.destAddr, _ = splitAddrAndPort(connInfo.Conn.RemoteAddr().String())
+				wire.track(connInfo.Conn, connInfo.Reused)
+			},
+		}
+		fmt.Printf("Downloading %s to %s...\n", options.url, options.path)
+		httpResponse, err = getSessionHTTPClient().Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		sendEntry.status = "error"
+		writeSendEntry()
+		response.status = sendEntry.status
+		return response
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.TLS != nil {
+		sendEntry.tlsVersion = escapeRawText(tls.VersionName(httpResponse.TLS.Version))
+		sendEntry.tlsCipher = escapeRawText(tls.CipherSuiteName(httpResponse.TLS.CipherSuite))
+	}
+	sendEntry.details = escapeRawText(httpResponse.Status)
+	sendEntry.status = getDownloadStatus(httpResponse.StatusCode)
+	if sendEntry.status != "received" {
+		fmt.Printf("Download of %s failed: %s\n", options.url, httpResponse.Status)
+		writeSendEntry()
+		response.status = sendEntry.status
+		return response
+	}
+
+	// ...save it (hashing it on the way)...
+	createEntry := newChildLogEntry(parent, "create")
+	createEntry.path = escapeRawText(options.path)
+	var f *os.File
+	if fileExists(options.path) {
+		fmt.Printf("File %s already exists, unable to write!\n", options.path)
+		createEntry.status = "exists"
+		err = fmt.Errorf("file_already_exists: %s", options.path)
+	} else if f, err = os.OpenFile(options.path, os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0644); err != nil {
+		createEntry.status = getFileErrorStatus(err)
+	} else {
+		hash := sha256.New()
+		var written int64
+		written, err = io.Copy(io.MultiWriter(f, hash), httpResponse.Body)
+		f.Close()
+		response.bytesReceived = int(written)
+		response.sha256 = hex.EncodeToString(hash.Sum(nil))
+		trackArtifact(createEntry, "file", options.path, "delete", options.path)
+		if err != nil {
+			createEntry.status = "error"
+		} else {
+			createEntry.status = "created"
+		}
+		createEntry.details = escapeRawText(fmt.Sprintf("%d bytes written, sha256 %s", response.bytesReceived, response.sha256))
+	}
+	writeSendEntry()
+	writeLogEntry(activityLog, createEntry)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = createEntry.status
+		return response
+	}
+	fmt.Printf("%d bytes downloaded to %s (sha256 %s)\n", response.bytesReceived, options.path, response.sha256)
+	response.status = "received"
+
+	// ...and run it
+	if options.thenExecute {
+		executeEntry := executeDroppedFile(activityLog, parent, options.path, runAs)
+		response.processId = executeEntry.processId
+		response.status = executeEntry.status
+	}
+	return response
+}
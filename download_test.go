@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDownloadPayload = "#!/bin/sh\nexit 5\n"
+
+// Starts an HTTP server that serves testDownloadPayload at /stager (and nothing else)
+func startTestDownloadServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stager" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testDownloadPayload))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMain_Download(t *testing.T) {
+	server := startTestDownloadServer(t)
+	host, port := getTestServerHostAndPort(t, server)
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	hash := sha256.Sum256([]byte(testDownloadPayload))
+	sum := hex.EncodeToString(hash[:])
+
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "download", server.URL + "/stager", dir + "/stager"})
+	assert.Equal(t, activityLogEntry.activity, "download")
+	assert.Equal(t, activityLogEntry.path, dir + "/stager")
+	assert.Equal(t, activityLogEntry.status, "received")
+	assert.Equal(t, activityLogEntry.bytesReceived, len(testDownloadPayload))
+	assert.Equal(t, activityLogEntry.details, fmt.Sprintf("%s/stager\\, %d bytes\\, sha256 %s", server.URL, len(testDownloadPayload), sum))
+	contents, _ := os.ReadFile(dir + "/stager")
+	assert.Equal(t, testDownloadPayload, string(contents))
+
+	// The request and the file it's saved to are linked to the download by its correlation ID
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 3)
+	send, create := parsedLog.entries[0], parsedLog.entries[1]
+	assert.Equal(t, "send", send.activity)
+	assert.Equal(t, "received", send.status)
+	assert.Equal(t, "GET", send.method)
+	assert.Equal(t, server.URL + "/stager", send.path)
+	assert.Equal(t, host, send.destAddr)
+	assert.Equal(t, port, fmt.Sprint(send.destPort))
+	assert.Equal(t, "http", send.protocol)
+	assert.Equal(t, "127.0.0.1", send.sourceAddr)
+	// (what came back on the wire, the response's headers as well as the file)
+	assert.Greater(t, send.bytesReceived, len(testDownloadPayload))
+	assert.NotZero(t, send.bytesSent)
+	assert.Equal(t, "create", create.activity)
+	assert.Equal(t, "created", create.status)
+	assert.Equal(t, fmt.Sprintf("%d bytes written\\, sha256 %s", len(testDownloadPayload), sum), create.details)
+	assert.Equal(t, activityLogEntry.correlationId, send.correlationId)
+	assert.Equal(t, activityLogEntry.correlationId, create.correlationId)
+
+	// A file that's already there isn't overwritten
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "download", server.URL + "/stager", dir + "/stager"})
+	assert.Equal(t, activityLogEntry.status, "exists")
+}
+
+func TestMain_Download_ThenExecute(t *testing.T) {
+	server := startTestDownloadServer(t)
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// The file's made executable and run itself, and its exit status is the download's
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "download", "-then-execute", server.URL + "/stager", dir + "/stager"})
+	assert.Equal(t, activityLogEntry.status, "exit status 5")
+	assert.NotZero(t, activityLogEntry.processId)
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 4)
+	assert.Equal(t, "execute", parsedLog.entries[2].activity)
+	assert.Equal(t, dir + "/stager ", parsedLog.entries[2].processCmd)
+	assert.Equal(t, activityLogEntry.correlationId, parsedLog.entries[2].correlationId)
+
+	// A missing file isn't saved (or run)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "download", "-then-execute", server.URL + "/missing", dir + "/missing"})
+	assert.Equal(t, activityLogEntry.status, "not_found")
+	assert.False(t, fileExists(dir + "/missing"))
+}
+
+func TestParseDownloadOptions(t *testing.T) {
+	options, err := parseDownloadOptions([]string{"-then-execute", "https://updates.example.net/setup.exe", "setup.exe"})
+	assert.Nil(t, err)
+	assert.Equal(t, &DownloadOptions{url: "https://updates.example.net/setup.exe", path: "setup.exe", thenExecute: true}, options)
+
+	_, err = parseDownloadOptions([]string{"ftp://updates.example.net/setup.exe", "setup.exe"})
+	assert.ErrorContains(t, err, "invalid download: invalid url 'ftp://updates.example.net/setup.exe' (must be http:// or https://)")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "download", "https://updates.example.net/setup.exe"}, "not enough arguments for download! Args: [https://updates.example.net/setup.exe]")
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The kinds of script dropper can drop, by extension, and the contents each is dropped with by default (harmless: it just says who
+// it's running as)
+var DropperScripts = map[string]string{
+	".ps1": "Write-Output \"noisemaker dropper\"\r\nwhoami\r\n",
+	".sh": "#!/bin/sh\necho noisemaker dropper\nid\n",
+	".bat": "@echo off\r\necho noisemaker dropper\r\nwhoami\r\n",
+	".cmd": "@echo off\r\necho noisemaker dropper\r\nwhoami\r\n",
+	".py": "import getpass\nprint(\"noisemaker dropper\", getpass.getuser())\n",
+}
+
+// Options for the dropper command
+type DropperOptions struct {
+	path				string
+	contents			string
+	keep				bool		// whether to leave the script behind, rather than deleting it once it's run
+}
+
+// Response data from dropper action
+type DropperResponse struct {
+	processId			int
+	status				string
+}
+
+// Parses dropper's arguments: [-keep] (path) [contents]
+func parseDropperOptions(args []string) (*DropperOptions, error) {
+	flags := flag.NewFlagSet("dropper", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	keep := flags.Bool("keep", false, "whether to leave the script behind once it's run")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dropper: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for dropper! Args: %v", args)
+	}
+	options := &DropperOptions{path: flags.Arg(0), keep: *keep}
+	extension := strings.ToLower(filepath.Ext(options.path))
+	contents, found := DropperScripts[extension]
+	if !found {
+		return nil, fmt.Errorf("invalid dropper: unsupported script '%s' (must end in one of .ps1, .sh, .bat, .cmd, or .py)", options.path)
+	}
+	options.contents = contents
+	if flags.NArg() > 1 {
+		options.contents = strings.Join(flags.Args()[1:], " ")
+	}
+	return options, nil
+}
+
+// Gets the command line that runs the script on the given OS, by its extension (or, for any other file, that runs the file itself)
+func getDropperCommand(goos string, path string) (string, []string) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ps1":
+		cmd, args := getPowerShellCommand(goos)
+		return cmd, append(args, "-File", path)
+	case ".bat", ".cmd":
+		return "cmd.exe", []string{"/c", path}
+	case ".py":
+		if goos == "windows" {
+			return "python.exe", []string{path}
+		}
+		return "python3", []string{path}
+	case ".sh":
+		return "sh", []string{path}
+	default:
+		return path, []string{}
+	}
+}
+
+// Writes the script to disk, runs it, and (unless it's kept) deletes it again. Each step is logged as its own entry (create, execute,
+// and delete), all sharing the parent's correlation ID.
+func dropAndExecute(activityLog Sink, parent *ActivityLogEntry, options *DropperOptions, runAs *RunAsUser) *DropperResponse {
+	response := new(DropperResponse)
+
+	// Drop it...
+	createEntry := newChildLogEntry(parent, "create")
+	createEntry.path = escapeRawText(options.path)
+	status, err := createFile(options.path, options.contents, "buffered")
+	createEntry.status = status
+	createEntry.details = escapeRawText(fmt.Sprintf("%d bytes written", len(options.contents)))
+	writeLogEntry(activityLog, createEntry)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = status
+		return response
+	}
+	trackArtifact(createEntry, "file", options.path, "delete", options.path)
+
+	// ...run it...
+	executeEntry := executeDroppedFile(activityLog, parent, options.path, runAs)
+	response.processId = executeEntry.processId
+	response.status = executeEntry.status
+
+	// ...and clean up after ourselves
+	if !options.keep {
+		deleteEntry := newChildLogEntry(parent, "delete")
+		deleteEntry.path = escapeRawText(options.path)
+		deleteEntry.status, err = deleteFile(options.path)
+		if err == nil {
+			untrackArtifact("delete", options.path)
+		}
+		writeLogEntry(activityLog, deleteEntry)
+	}
+	return response
+}
+
+// Runs a file that was just written (as a script, by its extension, or made executable and run itself), logging it as an execute
+// activity sharing the parent's correlation ID
+func executeDroppedFile(activityLog Sink, parent *ActivityLogEntry, path string, runAs *RunAsUser) *ActivityLogEntry {
+	if absPath, err := filepath.Abs(path); err == nil {
+		// (so a file in the current directory isn't looked up on the PATH instead)
+		path = absPath
+	}
+	cmd, args := getDropperCommand(parent.os, path)
+	if cmd == path && parent.os != "windows" {
+		os.Chmod(path, 0700)
+	}
+	entry := newChildLogEntry(parent, "execute")
+	entry.processCmd = escapeCommandString(cmd, args)
+	entry.path = escapeRawText(path)
+	fmt.Printf("Running command %s with args %v\n", cmd, args)
+	process, cancelFunc, processState, err := startProcess(cmd, args, nil, runAs)
+	if cancelFunc != nil {
+		defer cancelFunc()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		entry.status = "unable_to_run"
+	} else if processState != nil {
+		entry.processId = processState.Pid()
+		entry.status = processState.String()
+	} else {
+		entry.processId = process.Pid
+		entry.status = "unable_to_run"
+	}
+	writeLogEntry(activityLog, entry)
+	return entry
+}
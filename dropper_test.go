@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Dropper(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	scriptPath := dir + "/update.sh"
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "dropper", scriptPath, "exit 4"})
+	assert.Equal(t, activityLogEntry.activity, "dropper")
+	assert.Equal(t, activityLogEntry.path, scriptPath)
+	assert.Equal(t, activityLogEntry.method, "sh")
+	assert.Equal(t, activityLogEntry.status, "exit status 4")
+	assert.Equal(t, activityLogEntry.details, "6 bytes dropped")
+	assert.NotZero(t, activityLogEntry.processId)
+	assert.False(t, fileExists(scriptPath))
+
+	// The create, execute, and delete are linked to the dropper by its correlation ID
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 4)
+	activities := []string{}
+	for _, entry := range parsedLog.entries {
+		assert.Equal(t, activityLogEntry.correlationId, entry.correlationId)
+		activities = append(activities, entry.activity)
+	}
+	assert.Equal(t, []string{"create", "execute", "delete", "dropper"}, activities)
+	assert.Equal(t, "created", parsedLog.entries[0].status)
+	assert.Equal(t, "sh " + scriptPath, parsedLog.entries[1].processCmd)
+	assert.Equal(t, "exit status 4", parsedLog.entries[1].status)
+	assert.Equal(t, "deleted", parsedLog.entries[2].status)
+
+	// Replaying it runs the dropper again, but not the script it ran on its own
+	steps, err := loadReplaySteps(&ReplayOptions{path: logFilePath, speed: 1})
+	assert.Nil(t, err)
+	assert.Len(t, steps, 1)
+	assert.Equal(t, "dropper", steps[0].command)
+}
+
+func TestMain_Dropper_Keep(t *testing.T) {
+	// A kept script's left behind (as an artifact), and a script that's already there isn't run
+	dir := t.TempDir()
+	scriptPath := dir + "/update.sh"
+	callMain([]string{"./noisemaker", "-sink=stdout", "-manifest=" + dir + "/artifacts.jsonl", "dropper", "-keep", scriptPath})
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	contents, _ := os.ReadFile(scriptPath)
+	assert.Equal(t, DropperScripts[".sh"], string(contents))
+	artifacts, err := readArtifactManifest(dir + "/artifacts.jsonl", "")
+	assert.Nil(t, err)
+	assert.Len(t, artifacts, 1)
+	assert.False(t, artifacts[0].Removed)
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "dropper", scriptPath})
+	assert.Equal(t, activityLogEntry.status, "exists")
+	assert.Zero(t, activityLogEntry.processId)
+}
+
+func TestParseDropperOptions(t *testing.T) {
+	options, err := parseDropperOptions([]string{"C:\\Users\\Public\\stage.PS1"})
+	assert.Nil(t, err)
+	assert.Equal(t, &DropperOptions{path: "C:\\Users\\Public\\stage.PS1", contents: DropperScripts[".ps1"]}, options)
+	options, err = parseDropperOptions([]string{"-keep", "/tmp/run.py", "print(1)"})
+	assert.Nil(t, err)
+	assert.Equal(t, &DropperOptions{path: "/tmp/run.py", contents: "print(1)", keep: true}, options)
+
+	_, err = parseDropperOptions([]string{"/tmp/run.exe"})
+	assert.ErrorContains(t, err, "invalid dropper: unsupported script '/tmp/run.exe' (must end in one of .ps1, .sh, .bat, .cmd, or .py)")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "dropper"}, "not enough arguments for dropper! Args: []")
+}
+
+func TestGetDropperCommand(t *testing.T) {
+	cmd, args := getDropperCommand("windows", `C:\Users\Public\stage.ps1`)
+	assert.Equal(t, "powershell.exe", cmd)
+	assert.Equal(t, []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", `C:\Users\Public\stage.ps1`}, args)
+	cmd, args = getDropperCommand("windows", `C:\Users\Public\stage.bat`)
+	assert.Equal(t, "cmd.exe", cmd)
+	assert.Equal(t, []string{"/c", `C:\Users\Public\stage.bat`}, args)
+	cmd, _ = getDropperCommand("linux", "/tmp/run.py")
+	assert.Equal(t, "python3", cmd)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The sets of names edgenames can try
+var EdgeNameSets = []string{"reserved", "trailing", "case"}
+
+// The names in each set, tried in order (so a name that collides with an earlier one, or is another form of it, comes after it)
+var EdgeNames = map[string][]string{
+	// (Windows' device names, which are devices in any directory, with any extension)
+	"reserved": {"CON", "PRN", "AUX", "NUL", "COM1", "COM9", "LPT1", "LPT9", "CONIN$", "CONOUT$", "COM¹", "con.txt", "Nul.log", "aux.tar.gz", "COM1 .txt"},
+	// (which Windows strips, so they're another name on disk, or the same name as the file without them)
+	"trailing": {"trailing-dot.", "trailing-dots...", "trailing-space ", "trailing-both. .", "notes.txt", "notes.txt.", "notes.txt ", "notes.txt. . "},
+	// (which are the same file as each other on a case-insensitive filesystem, as Windows' and macOS's are by default)
+	"case": {"Report.txt", "report.txt", "REPORT.TXT", "rEpOrT.tXt", "Ärger.txt", "ärger.txt", "straße.txt", "STRASSE.txt"},
+}
+
+// What each edge case file is written with
+const EdgeNameContents = "noisemaker edge case\n"
+
+// Options for the edgenames command
+type EdgeNamesOptions struct {
+	dir					string
+	sets				[]string
+	verbatim			bool		// whether to create each name as it is, past Windows' normalizing it (with a \\?\ path)
+}
+
+// Response data from edgenames action
+type EdgeNamesResponse struct {
+	dir					string		// the directory the names were tried in
+	attempts			int
+	created				int			// created on disk as they are
+	renamed				int			// created on disk as another name (ie. without a trailing dot)
+	missing				int			// accepted, but not on disk (ie. opened a device)
+	collided			int			// already taken, by another form of the name
+	rejected			int			// refused by the OS (or failed)
+	status				string
+}
+
+// Parses edgenames' arguments: [-sets=reserved,trailing,case] [-verbatim] (dir)
+func parseEdgeNamesOptions(args []string) (*EdgeNamesOptions, error) {
+	flags := flag.NewFlagSet("edgenames", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	sets := flags.String("sets", strings.Join(EdgeNameSets, ","), "the sets of names to try, ie. reserved,case (default all of them)")
+	verbatim := flags.Bool("verbatim", false, "creates each name as it is on Windows, rather than as Windows normalizes it (default false)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid edgenames: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for edgenames! Args: %v", args)
+	}
+	if flags.NArg() > 1 {
+		return nil, fmt.Errorf("invalid edgenames: unexpected arguments %v", flags.Args()[1:])
+	}
+
+	options := &EdgeNamesOptions{dir: flags.Arg(0), verbatim: *verbatim}
+	for _, set := range strings.Split(*sets, ",") {
+		if !containsString(EdgeNameSets, set) {
+			return nil, fmt.Errorf("invalid edgenames set '%s' (must be one of %v)", set, EdgeNameSets)
+		}
+		options.sets = append(options.sets, set)
+	}
+	return options, nil
+}
+
+// Tries creating each of the sets' names in a directory of their own (in the dir), logging each as a create activity (with its set as
+// its method), and recording what the OS made of it: whether it's on disk as it is, as another name, or not at all, or whether it
+// collided with another form of it, or was refused. What's created is kept (tracked as artifacts, for cleanup).
+func tryEdgeNames(activityLog Sink, parent *ActivityLogEntry, options *EdgeNamesOptions) (*EdgeNamesResponse, error) {
+	response := &EdgeNamesResponse{status: "error"}
+	// (a fresh directory, so case collisions are with the names tried, and nothing else)
+	dir, err := os.MkdirTemp(options.dir, "noisemaker-edgenames-")
+	if err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	response.dir = dir
+	trackArtifact(parent, "file", dir, "delete", dir)
+
+	for _, set := range options.sets {
+		for _, name := range EdgeNames[set] {
+			if isRunCancelled() {
+				break
+			}
+			entry := newChildLogEntry(parent, "create")
+			entry.path = escapeRawText(filepath.Join(dir, name))
+			entry.method = set
+			entry.labels = addLabel(entry.labels, "edge-case", set)
+			result, err := tryEdgeName(entry, dir, name, options.verbatim)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				result += ": " + err.Error()
+			}
+			switch {
+			case entry.status == "exists":
+				response.collided++
+			case err != nil:
+				response.rejected++
+			case result == "on disk as given":
+				response.created++
+			case result == "not on disk":
+				response.missing++
+			default:
+				response.renamed++
+			}
+			response.attempts++
+			entry.details = escapeRawText(getFileNameDetails(name) + ", " + result)
+			writeLogEntry(activityLog, entry)
+		}
+	}
+	response.status = "completed"
+	fmt.Printf("Tried %d names in %s: %d created as given, %d renamed, %d not on disk, %d collided, %d rejected\n", response.attempts, dir, response.created, response.renamed, response.missing, response.collided, response.rejected)
+	return response, nil
+}
+
+// Tries creating the name in the directory, setting the entry's status, and returning what's on disk for it: "on disk as given", on
+// disk as another name, "not on disk", or which name it collided with
+func tryEdgeName(entry *ActivityLogEntry, dir string, name string, verbatim bool) (string, error) {
+	before, err := listDirNames(dir)
+	if err != nil {
+		entry.status = getFileErrorStatus(err)
+		return "couldn't list the directory", err
+	}
+	path := filepath.Join(dir, name)
+	if verbatim {
+		path = getVerbatimPath(path)
+	}
+	entry.status, err = createFile(path, EdgeNameContents, "buffered")
+	if entry.status == "exists" {
+		for _, existing := range before {
+			if strings.EqualFold(existing, name) || strings.EqualFold(existing, strings.TrimRight(name, ". ")) {
+				return "collides with " + strconv.QuoteToASCII(existing), nil
+			}
+		}
+		return "collides with an existing file", nil
+	}
+	if err != nil {
+		if isInvalidName(err) {
+			entry.status = "invalid_name"
+		} else if isPathTooLong(err) {
+			entry.status = "too_long"
+		}
+		return "refused", err
+	}
+
+	// (what it's on disk as is whatever's new in the directory)
+	after, err := listDirNames(dir)
+	if err != nil {
+		return "couldn't list the directory", err
+	}
+	for _, created := range after {
+		if !containsString(before, created) {
+			createdPath := filepath.Join(dir, created)
+			if verbatim {
+				// (a name Windows would normalize can only be deleted as it is, too)
+				createdPath = getVerbatimPath(createdPath)
+			}
+			trackArtifact(entry, "file", createdPath, "delete", createdPath)
+			if created == name {
+				return "on disk as given", nil
+			}
+			entry.path = escapeRawText(filepath.Join(dir, created))
+			return "on disk as " + strconv.QuoteToASCII(created), nil
+		}
+	}
+	return "not on disk", nil
+}
+
+// Gets the names of what's in the directory
+func listDirNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Whether the OS refused a name itself (as some filesystems do names that aren't valid UTF-8, or in their normalization)
+func isInvalidName(err error) bool {
+	return errors.Is(err, syscall.EILSEQ) || errors.Is(err, syscall.EINVAL)
+}
+
+// Gets the path to create a name as it is (which it already is, off Windows)
+func getVerbatimPath(path string) string {
+	return path
+}
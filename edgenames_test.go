@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_EdgeNames(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// Each name's tried in a directory of its own, and logged with what the OS made of it
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "edgenames", "-sets=reserved,case", dir})
+	assert.Equal(t, "edgenames", activityLogEntry.activity)
+	assert.Equal(t, "completed", activityLogEntry.status)
+	assert.Equal(t, "reserved,case", activityLogEntry.method)
+	assert.True(t, strings.HasPrefix(activityLogEntry.path, dir + "/noisemaker-edgenames-"))
+	names := len(EdgeNames["reserved"]) + len(EdgeNames["case"])
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, names + 1)
+	first := parsedLog.entries[0]
+	assert.Equal(t, "create", first.activity)
+	assert.Equal(t, "reserved", first.method)
+	assert.Equal(t, "edge-case=reserved", first.labels)
+	assert.Equal(t, activityLogEntry.correlationId, first.correlationId)
+	if runtime.GOOS == "linux" {
+		// (where none of them are special, on a case-sensitive filesystem)
+		assert.Equal(t, "created", first.status)
+		assert.Equal(t, "name \"CON\"\\, 3 bytes\\, 3 characters\\, on disk as given", first.details)
+		assert.FileExists(t, activityLogEntry.path + "/CON")
+		assert.FileExists(t, activityLogEntry.path + "/report.txt")
+		assert.FileExists(t, activityLogEntry.path + "/REPORT.TXT")
+		assert.Equal(t, fmt.Sprintf("%d names: %d created as given\\, 0 renamed\\, 0 not on disk\\, 0 collided\\, 0 rejected", names, names), activityLogEntry.details)
+	}
+
+	// What's created is cleaned up, directory and all
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "cleanup"})
+	matches, err := filepath.Glob(dir + "/noisemaker-edgenames-*")
+	assert.Nil(t, err)
+	assert.Empty(t, matches)
+
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "edgenames", dir + "/missing"})
+	assert.Equal(t, "not_found", activityLogEntry.status)
+	assert.Equal(t, dir + "/missing", activityLogEntry.path)
+}
+
+func TestTryEdgeName(t *testing.T) {
+	dir := t.TempDir()
+	entry := &ActivityLogEntry{}
+	result, err := tryEdgeName(entry, dir, "notes.txt", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "created", entry.status)
+	assert.Equal(t, "on disk as given", result)
+
+	// Another form of a name that's taken collides with it
+	result, err = tryEdgeName(entry, dir, "notes.txt", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "exists", entry.status)
+	assert.Equal(t, "collides with \"notes.txt\"", result)
+
+	// (or is refused)
+	_, err = tryEdgeName(entry, dir, strings.Repeat("a", 300), false)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, "created", entry.status)
+	_, err = tryEdgeName(entry, dir + "/missing", "notes.txt", false)
+	assert.NotNil(t, err)
+	assert.Equal(t, "not_found", entry.status)
+}
+
+func TestParseEdgeNamesOptions(t *testing.T) {
+	options, err := parseEdgeNamesOptions([]string{"/tmp"})
+	assert.Nil(t, err)
+	assert.Equal(t, &EdgeNamesOptions{dir: "/tmp", sets: []string{"reserved", "trailing", "case"}}, options)
+	options, err = parseEdgeNamesOptions([]string{"-sets=case", "-verbatim", "/tmp"})
+	assert.Nil(t, err)
+	assert.Equal(t, &EdgeNamesOptions{dir: "/tmp", sets: []string{"case"}, verbatim: true}, options)
+
+	_, err = parseEdgeNamesOptions([]string{})
+	assert.ErrorContains(t, err, "not enough arguments for edgenames!")
+	_, err = parseEdgeNamesOptions([]string{"-sets=unicode", "/tmp"})
+	assert.ErrorContains(t, err, "invalid edgenames set 'unicode' (must be one of [reserved trailing case])")
+	_, err = parseEdgeNamesOptions([]string{"/tmp", "/var"})
+	assert.ErrorContains(t, err, "unexpected arguments [/var]")
+}
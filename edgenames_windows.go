@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// The error Windows gives for a name it doesn't allow (ERROR_INVALID_NAME)
+const errorInvalidName = syscall.Errno(123)
+
+// Whether the OS refused a name itself (ie. with a character Windows doesn't allow)
+func isInvalidName(err error) bool {
+	return errors.Is(err, errorInvalidName)
+}
+
+// Gets the path to create a name as it is, past Windows' normalizing it (stripping trailing dots and spaces, and opening device names
+// as devices): as a \\?\ path, which is used as it's given
+func getVerbatimPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return `\\?\` + absolute
+}
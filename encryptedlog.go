@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The first line of every encrypted activity log. Each line after it is a line of the log, encrypted on its own (so the log can still
+// be appended to), as base64(nonce + AES-256-GCM ciphertext).
+const EncryptedLogHeader = "#noisemaker-encrypted=aes-256-gcm"
+
+// The cipher for -log-encrypt, if it's set
+var logCipher cipher.AEAD
+
+// Response data from decrypt-log action
+type DecryptResponse struct {
+	lines				int
+	status				string
+}
+
+// Loads the AES-256 key at path, as 64 hex digits (ie. from `openssl rand -hex 32`) or 32 raw bytes
+func loadLogCipher(path string) (cipher.AEAD, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := contents
+	if trimmed := bytes.TrimSpace(contents); len(trimmed) == 64 {
+		key, err = hex.DecodeString(string(trimmed))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log encryption key in %s: %v", path, err)
+		}
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid log encryption key in %s (must be 64 hex digits, or 32 bytes)", path)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isEncryptedLog(contents []byte) bool {
+	return bytes.HasPrefix(contents, []byte(EncryptedLogHeader + "\n")) || bytes.HasPrefix(contents, []byte(EncryptedLogHeader + "\r\n"))
+}
+
+// Encrypts a single line of a log (without its line break)
+func encryptLogLine(aead cipher.AEAD, line string) string {
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	check(err)
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(line), nil))
+}
+
+// Encrypts a whole log, line by line
+func encryptLog(aead cipher.AEAD, contents []byte) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(EncryptedLogHeader + "\n")
+	for _, line := range strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n") {
+		buffer.WriteString(encryptLogLine(aead, line) + "\n")
+	}
+	return buffer.Bytes()
+}
+
+// Decrypts an encrypted log back into the lines it was written as
+func decryptLog(aead cipher.AEAD, contents []byte) ([]byte, int, error) {
+	var buffer bytes.Buffer
+	lines := strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n")
+	count := 0
+	for i, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(sealed) < aead.NonceSize() {
+			return nil, count, fmt.Errorf("line %d of the log isn't encrypted", i + 2)
+		}
+		plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+		if err != nil {
+			return nil, count, fmt.Errorf("unable to decrypt line %d of the log (the key's wrong, or the line's been changed)", i + 2)
+		}
+		buffer.Write(plaintext)
+		buffer.WriteByte('\n')
+		count++
+	}
+	return buffer.Bytes(), count, nil
+}
+
+// Reads the activity log at path, decrypting it (with the -log-encrypt key) if it's encrypted
+func readLogFile(path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decryptLogIfEncrypted(path, contents)
+}
+
+// Decrypts the contents of the activity log at path (with the -log-encrypt key), if it's encrypted
+func decryptLogIfEncrypted(path string, contents []byte) ([]byte, error) {
+	if !isEncryptedLog(contents) {
+		return contents, nil
+	}
+	if logCipher == nil {
+		return nil, fmt.Errorf("log %s is encrypted (set -log-encrypt to its key to read it)", path)
+	}
+	plaintext, _, err := decryptLog(logCipher, contents)
+	return plaintext, err
+}
+
+// Writes the lines of a log file, encrypting each one first if the log's encrypted
+type LogFile struct {
+	file				*os.File
+	aead				cipher.AEAD
+}
+
+// Opens the log file at path with the given flags, encrypted with the -log-encrypt key if it's set. A log that's being appended to
+// has to be encrypted the same way already, so encrypted and plaintext lines never end up mixed in the same file.
+func openLogFile(path string, flags int, appending bool) (*LogFile, error) {
+	if appending {
+		encrypted, empty, err := isEncryptedLogFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if empty {
+			appending = false
+		} else if encrypted && logCipher == nil {
+			return nil, fmt.Errorf("log file %s is encrypted (set -log-encrypt to its key to append to it)", path)
+		} else if !encrypted && logCipher != nil {
+			return nil, fmt.Errorf("log file %s isn't encrypted, so it can't be appended to with -log-encrypt (use another log file, or -overwrite it)", path)
+		}
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	logFile := &LogFile{file: file, aead: logCipher}
+	if logCipher != nil && !appending {
+		_, err = file.WriteString(EncryptedLogHeader + "\n")
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return logFile, nil
+}
+
+// Whether the (existing) log file at path is encrypted, by its first line, and whether it's empty (so it can be either)
+func isEncryptedLogFile(path string) (bool, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, false, err
+	}
+	defer file.Close()
+	start := make([]byte, len(EncryptedLogHeader) + 2)
+	n, err := io.ReadFull(file, start)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, false, err
+	}
+	return isEncryptedLog(start[:n]), n == 0, nil
+}
+
+// Writes the text (one or more whole lines), encrypting each line if the log's encrypted
+func (logFile *LogFile) WriteString(text string) (int, error) {
+	if logFile.aead == nil {
+		return logFile.file.WriteString(text)
+	}
+	var buffer strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line != "" {
+			buffer.WriteString(encryptLogLine(logFile.aead, strings.TrimSuffix(line, "\n")) + "\n")
+		}
+	}
+	_, err := logFile.file.WriteString(buffer.String())
+	if err != nil {
+		return 0, err
+	}
+	return len(text), nil
+}
+
+func (logFile *LogFile) Close() error {
+	return logFile.file.Close()
+}
+
+// Decrypts the encrypted log at path (with the -log-encrypt key) to outputPath, or prints it if there's no outputPath
+func decryptLogFile(path string, outputPath string) (*DecryptResponse, error) {
+	response := &DecryptResponse{status: "error"}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		response.status = "not_found"
+		return response, err
+	}
+	if !isEncryptedLog(contents) {
+		response.status = "unsupported"
+		return response, fmt.Errorf("log %s isn't encrypted", path)
+	}
+
+	plaintext, lines, err := decryptLog(logCipher, contents)
+	response.lines = lines
+	if err != nil {
+		return response, err
+	}
+	if outputPath == "" {
+		fmt.Print(string(plaintext))
+	} else {
+		// (readable only by the current user, since it's what the encryption was keeping safe)
+		err = os.WriteFile(outputPath, plaintext, 0600)
+		if err != nil {
+			return response, err
+		}
+	}
+	response.status = "decrypted"
+	return response, nil
+}
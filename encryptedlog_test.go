@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const TestLogKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+// Writes the test key (and another one) to key files, returning their paths
+func writeTestLogKeys(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	os.WriteFile(dir + "/log.key", []byte(TestLogKey + "\n"), 0600)
+	os.WriteFile(dir + "/other.key", []byte(strings.Repeat("ff", 32)), 0600)
+	return dir + "/log.key", dir + "/other.key"
+}
+
+func TestMain_LogEncrypt(t *testing.T) {
+	keyPath, otherKeyPath := writeTestLogKeys(t)
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-log-encrypt=" + keyPath, "create", dir + "/secret-project.txt"}
+	callMain(args)
+	args = []string{"./noisemaker", "-logfile=" + logFilePath, "-log-encrypt=" + keyPath, "delete", dir + "/secret-project.txt"}
+	callMain(args)
+
+	// Nothing's in plaintext, but every line's there
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(contents, EncryptedLogHeader + "\n"))
+	assert.NotContains(t, contents, "secret-project")
+	assert.NotContains(t, contents, HeaderStr)
+	assert.Equal(t, 5, strings.Count(contents, "\n"))
+
+	// It can be read with the key...
+	args = []string{"./noisemaker", "-sink=stdout", "-log-encrypt=" + keyPath, "log", "query", "--columns=activity,status", logFilePath}
+	output := callMain(args)
+	assert.Contains(t, output, "activity,status\ncreate,created\ndelete,deleted\n")
+
+	// ...but not without it, or with the wrong one
+	args = []string{"./noisemaker", "-logfile=" + logFilePath, "create", dir + "/other.txt"}
+	assertMainPanicsWithMessage(t, args, "log file " + logFilePath + " is encrypted (set -log-encrypt to its key to append to it)")
+	args = []string{"./noisemaker", "-sink=stdout", "-log-encrypt=" + otherKeyPath, "log", "query", logFilePath}
+	output = callMain(args)
+	assert.Contains(t, output, "unable to decrypt line 2 of the log (the key's wrong, or the line's been changed)")
+	assert.Equal(t, activityLogEntry.status, "error")
+}
+
+func TestMain_LogEncrypt_PlaintextLog(t *testing.T) {
+	keyPath, _ := writeTestLogKeys(t)
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", dir + "/test.txt"})
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-log-encrypt=" + keyPath, "create", dir + "/other.txt"}
+	assertMainPanicsWithMessage(t, args, "log file " + logFilePath + " isn't encrypted, so it can't be appended to with -log-encrypt (use another log file, or -overwrite it)")
+}
+
+func TestMain_LogEncrypt_JSONL(t *testing.T) {
+	keyPath, _ := writeTestLogKeys(t)
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.jsonl"
+
+	args := []string{"./noisemaker", "-sink=jsonl:" + logFilePath, "-log-encrypt=" + keyPath, "create", dir + "/test.txt"}
+	callMain(args)
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(contents, EncryptedLogHeader + "\n"))
+
+	logCipher, err = loadLogCipher(keyPath)
+	assert.Nil(t, err)
+	defer func() { logCipher = nil }()
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.True(t, parsedLog.jsonl)
+	assert.Len(t, parsedLog.entries, 1)
+	assert.Equal(t, "created", parsedLog.entries[0].status)
+}
+
+func TestMain_DecryptLog(t *testing.T) {
+	keyPath, otherKeyPath := writeTestLogKeys(t)
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-log-encrypt=" + keyPath, "create", dir + "/test.txt"})
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-log-encrypt=" + keyPath, "decrypt-log", logFilePath, dir + "/plain.csv"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.activity, "decrypt-log")
+	assert.Equal(t, activityLogEntry.status, "decrypted")
+	assert.Equal(t, activityLogEntry.details, "3 lines decrypted to " + dir + "/plain.csv")
+	contents, err := readTestFile(dir + "/plain.csv")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(contents, getCSVFileHeader()))
+	assert.Contains(t, contents, ",create,")
+
+	// Without an output, it's printed
+	args = []string{"./noisemaker", "-sink=stdout", "-log-encrypt=" + keyPath, "decrypt-log", logFilePath}
+	output := callMain(args)
+	assert.Contains(t, output, getCSVFileHeader())
+	assert.Equal(t, activityLogEntry.status, "decrypted")
+
+	args = []string{"./noisemaker", "-sink=stdout", "-log-encrypt=" + otherKeyPath, "decrypt-log", logFilePath}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "error")
+	args = []string{"./noisemaker", "-sink=stdout", "-log-encrypt=" + keyPath, "decrypt-log", dir + "/plain.csv"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "unsupported")
+	assert.Equal(t, activityLogEntry.details, "log " + dir + "/plain.csv isn't encrypted")
+}
+
+func TestMain_DecryptLog_WithoutKey(t *testing.T) {
+	args := []string{"./noisemaker", "-sink=stdout", "decrypt-log", "./activity-log.csv"}
+	assertMainPanicsWithMessage(t, args, "decrypt-log needs -log-encrypt (the log's key)")
+}
+
+func TestMain_MigrateLog_Encrypted(t *testing.T) {
+	keyPath, _ := writeTestLogKeys(t)
+	dir := t.TempDir()
+	aead, err := loadLogCipher(keyPath)
+	assert.Nil(t, err)
+	oldLogPath := dir + "/old-log.csv"
+	os.WriteFile(oldLogPath, encryptLog(aead, []byte(TestV1Row + "\n")), 0644)
+
+	args := []string{"./noisemaker", "-sink=stdout", "-log-encrypt=" + keyPath, "migrate-log", oldLogPath}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "migrated")
+
+	// It stays encrypted
+	contents, err := os.ReadFile(oldLogPath)
+	assert.Nil(t, err)
+	assert.True(t, isEncryptedLog(contents))
+	plaintext, lines, err := decryptLog(aead, contents)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, lines)
+	assert.True(t, strings.HasPrefix(string(plaintext), getCSVFileHeader() + TestV1Row + ","))
+}
+
+func TestLoadLogCipher(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir + "/raw.key", []byte("0123456789abcdef0123456789abcdef"), 0600)
+	_, err := loadLogCipher(dir + "/raw.key")
+	assert.Nil(t, err)
+
+	os.WriteFile(dir + "/short.key", []byte("deadbeef\n"), 0600)
+	_, err = loadLogCipher(dir + "/short.key")
+	assert.ErrorContains(t, err, "invalid log encryption key in " + dir + "/short.key (must be 64 hex digits, or 32 bytes)")
+	os.WriteFile(dir + "/bad.key", []byte(strings.Repeat("zz", 32)), 0600)
+	_, err = loadLogCipher(dir + "/bad.key")
+	assert.ErrorContains(t, err, "invalid log encryption key in " + dir + "/bad.key: ")
+}
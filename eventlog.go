@@ -0,0 +1,21 @@
+package main
+
+import (
+	"slices"
+)
+
+// The event source activities are written to the Windows Event Log as, and the (custom) channel it's registered to by default
+const EventLogSource = "noisemaker"
+const DefaultEventLogChannel = "noisemaker"
+
+// The event ID for activities that aren't in KnownActivities (EventCreate.exe, the message file, takes IDs from 1 to 1000)
+const UnknownActivityEventId = 1000
+
+// Gets the Windows event ID for an entry's activity: its position in KnownActivities (from 1), so each activity can be collected by ID
+func getEventLogEventId(entry *ActivityLogEntry) uint32 {
+	index := slices.Index(KnownActivities, unescapeRawText(entry.activity))
+	if index < 0 {
+		return UnknownActivityEventId
+	}
+	return uint32(index + 1)
+}
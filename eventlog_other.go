@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The Event Log is Windows-only
+func newEventLogSink(channel string) (Sink, error) {
+	return nil, fmt.Errorf("the eventlog sink is not supported on %s", runtime.GOOS)
+}
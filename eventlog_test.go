@@ -0,0 +1,25 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEventLogEventId(t *testing.T) {
+	assert.Equal(t, uint32(1), getEventLogEventId(&ActivityLogEntry{activity: "execute"}))
+	assert.Equal(t, uint32(6), getEventLogEventId(&ActivityLogEntry{activity: "send"}))
+	assert.Equal(t, uint32(UnknownActivityEventId), getEventLogEventId(&ActivityLogEntry{activity: "teleport"}))
+
+	// Every activity needs an ID that EventCreate.exe accepts
+	assert.Less(t, len(KnownActivities), UnknownActivityEventId)
+}
+
+func TestMain_Sink_EventLogUnsupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the event log is supported on windows")
+	}
+	_, err := openSinks([]string{"eventlog"}, "", false)
+	assert.ErrorContains(t, err, "the eventlog sink is not supported on " + runtime.GOOS)
+}
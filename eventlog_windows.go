@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Writes each entry to a Windows Event Log channel as JSON (errors as Error events, and everything else as Information events)
+type EventLogSink struct {
+	channel				string
+	log					*eventlog.Log
+}
+
+// Opens the event source in the channel, registering it first if it isn't already (which takes an administrator, once)
+func newEventLogSink(channel string) (Sink, error) {
+	if channel == "" {
+		channel = DefaultEventLogChannel
+	}
+	err := registerEventSource(channel, EventLogSource)
+	if err != nil {
+		return nil, fmt.Errorf("unable to register event source %s in the %s channel (run once as an administrator): %v", EventLogSource, channel, err)
+	}
+	log, err := eventlog.Open(EventLogSource)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLogSink{channel: channel, log: log}, nil
+}
+
+// Adds the event source under the channel's registry key (creating the channel, if it's new), with EventCreate.exe as its message file.
+// If the source is already registered to another channel, it's left there.
+func registerEventSource(channel string, source string) error {
+	eventLogKey, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\EventLog`, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return err
+	}
+	defer eventLogKey.Close()
+	channels, err := eventLogKey.ReadSubKeyNames(-1)
+	if err != nil {
+		return err
+	}
+	for _, existingChannel := range channels {
+		sourceKey, err := registry.OpenKey(eventLogKey, existingChannel + `\` + source, registry.QUERY_VALUE)
+		if err == nil {
+			sourceKey.Close()
+			return nil
+		}
+	}
+
+	sourceKey, _, err := registry.CreateKey(eventLogKey, channel + `\` + source, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer sourceKey.Close()
+	err = sourceKey.SetExpandStringValue("EventMessageFile", `%SystemRoot%\System32\EventCreate.exe`)
+	if err != nil {
+		return err
+	}
+	err = sourceKey.SetDWordValue("TypesSupported", eventlog.Error | eventlog.Warning | eventlog.Info)
+	if err != nil {
+		return err
+	}
+	return sourceKey.SetDWordValue("CustomSource", 1)
+}
+
+// Best-effort, like the forwarding sinks: a failed write is reported, but doesn't stop the run
+func (sink *EventLogSink) WriteEntry(entry *ActivityLogEntry) error {
+	message := string(serializeToJSON(entry))
+	var err error
+	if isFailureStatus(entry.status) {
+		err = sink.log.Error(getEventLogEventId(entry), message)
+	} else {
+		err = sink.log.Info(getEventLogEventId(entry), message)
+	}
+	if err != nil {
+		slog.Warn("Unable to forward log entry to the event log", "channel", sink.channel, "error", err)
+	}
+	return nil
+}
+
+func (sink *EventLogSink) Close() error {
+	return sink.log.Close()
+}
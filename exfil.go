@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Response data from exfil action
+type ExfilResponse struct {
+	archivePath			string
+	bytesSent			int
+	bytesReceived		int
+	status				string
+}
+
+// Stages the directory into a temporary zip archive, sends it to the destination as the body of a single request (retrying a failed
+// send like the send action does), and deletes the archive. Each step is logged as its own entry (stage, each send attempt, and
+// delete), all sharing the parent's correlation ID.
+func exfilDirectory(activityLog Sink, parent *ActivityLogEntry, dir string, method string, destAddr string, destPort int, protocol string, password string, failRate float64, retries int, backoff time.Duration) *ExfilResponse {
+	response := new(ExfilResponse)
+	response.archivePath = filepath.Join(os.TempDir(), "noisemaker-exfil-" + parent.correlationId + ".zip")
+
+	// Stage it...
+	stageEntry := newChildLogEntry(parent, "stage")
+	stageEntry.path = escapeRawText(response.archivePath)
+	stageResponse, err := stageFiles(response.archivePath, []string{dir}, password)
+	defer os.Remove(response.archivePath) // Don't leave a partial archive behind if staging (or anything after it) fails
+	stageEntry.status = stageResponse.status
+	stageEntry.details = escapeRawText(fmt.Sprintf("%d source files, %d source bytes, %d archive bytes (%s)", stageResponse.sourceCount, stageResponse.sourceBytes, stageResponse.archiveBytes, stageResponse.format))
+	writeLogEntry(activityLog, stageEntry)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = "stage_failed"
+		return response
+	}
+
+	// ...send it, retrying on failure (every attempt is logged)...
+	var sendEntry *ActivityLogEntry
+	contents, err := os.ReadFile(response.archivePath)
+	for attempt := 1; ; attempt++ {
+		sendEntry = newChildLogEntry(parent, "send")
+		sendEntry.method = method
+		sendEntry.destAddr = destAddr
+		sendEntry.destPort = destPort
+		sendEntry.protocol = protocol
+		sendEntry.attempt = attempt
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			sendEntry.status = "error"
+			writeLogEntry(activityLog, sendEntry)
+			break
+		}
+		if retries > 0 {
+			fmt.Printf("Attempt %d of %d:\n", attempt, retries + 1)
+		}
+		fmt.Printf("Sending %d bytes of data to %s %s (port %d) using protocol %s...\n", len(contents), method, destAddr, destPort, protocol)
+		messageResponse, sendErr := sendMessageWithFailureRate(method, destAddr, destPort, protocol, nil, string(contents), failRate)
+		if sendErr != nil {
+			fmt.Printf("Send attempt %d failed: %v\n", attempt, sendErr)
+			sendEntry.status = messageResponse.status
+		} else {
+			sendEntry.status = "sent"
+		}
+		sendEntry.path = escapeRawText(messageResponse.path)
+		sendEntry.sourceAddr = messageResponse.sourceAddr
+		sendEntry.sourcePort = messageResponse.sourcePort
+		recordSendConnection(sendEntry, messageResponse)
+		sendEntry.bytesSent = messageResponse.bytesSent
+		sendEntry.bytesReceived = messageResponse.bytesReceived
+		sendEntry.details = escapeRawText(getSendDetails(messageResponse))
+		response.bytesSent = messageResponse.bytesSent
+		response.bytesReceived = messageResponse.bytesReceived
+		writeLogEntry(activityLog, sendEntry)
+		if sendErr == nil || attempt > retries || isRunCancelled() {
+			break
+		}
+
+		// Back off before retrying
+		fmt.Printf("Retrying in %v...\n", backoff)
+		sleepContext(backoff)
+		backoff *= 2
+	}
+
+	// ...and clean up after ourselves
+	deleteEntry := newChildLogEntry(parent, "delete")
+	deleteEntry.path = escapeRawText(response.archivePath)
+	deleteEntry.status, _ = deleteFile(response.archivePath)
+	writeLogEntry(activityLog, deleteEntry)
+
+	if sendEntry.status == "sent" {
+		response.status = "exfiltrated"
+	} else {
+		response.status = "send_failed"
+	}
+	return response
+}
+
+// Generates a random (version 4) UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	check(err)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
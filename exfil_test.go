@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Exfil(t *testing.T) {
+	dir := createTestStagingDir(t)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Precondition: something is listening for the upload
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "exfil", dir, "POST", host + "/upload", port}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.activity, "exfil")
+	assert.Equal(t, activityLogEntry.status, "exfiltrated")
+	assert.Equal(t, activityLogEntry.path, dir)
+	assert.Greater(t, activityLogEntry.bytesSent, len(received))
+
+	// The upload should be the staged archive
+	reader, err := zip.NewReader(bytes.NewReader(received), int64(len(received)))
+	assert.Nil(t, err)
+	assert.Len(t, reader.File, 3)
+
+	// Every step should be logged, sharing the correlation ID
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	correlationId := activityLogEntry.correlationId
+	assert.Regexp(t, regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$"), correlationId)
+	assert.Equal(t, 4, strings.Count(contents, "," + correlationId + ","))
+	assert.Contains(t, contents, ",stage,")
+	assert.Contains(t, contents, ",send,")
+	assert.Contains(t, contents, ",delete,")
+	assert.Contains(t, contents, ",deleted,")
+}
+
+func TestMain_Exfil_SendFailed(t *testing.T) {
+	dir := createTestStagingDir(t)
+
+	args := []string{"./noisemaker", "-fail-rate=1", "exfil", dir, "POST", "127.0.0.1", "1"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "send_failed")
+	assert.Equal(t, activityLogEntry.bytesSent, 0)
+}
+
+func TestMain_Exfil_Retries(t *testing.T) {
+	dir := createTestStagingDir(t)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-fail-rate=1", "-retries=2", "-retry-backoff=1ms", "exfil", dir, "POST", "127.0.0.1", "1"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "send_failed")
+
+	// Every attempt should be logged, and the archive cleaned up afterwards
+	entries, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	attempts := []int{}
+	for _, entry := range entries.entries {
+		if entry.activity == "send" {
+			attempts = append(attempts, entry.attempt)
+			assert.Equal(t, "injected_failure", entry.status)
+		}
+	}
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+	assert.NoFileExists(t, filepath.Join(os.TempDir(), "noisemaker-exfil-" + activityLogEntry.correlationId + ".zip"))
+}
+
+func TestMain_Exfil_InvalidRetries(t *testing.T) {
+	args := []string{"./noisemaker", "-retries=-1", "exfil", "./staging", "POST", "127.0.0.1"}
+	assertMainPanicsWithMessage(t, args, "invalid retries for exfil: -1")
+}
+
+func TestMain_Exfil_NotEnoughArguments(t *testing.T) {
+	args := []string{"./noisemaker", "exfil", "./staging", "POST"}
+	assertMainPanicsWithMessage(t, args, "not enough arguments for exfil! Args: [./staging POST]")
+}
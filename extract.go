@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Where a value can be extracted from a send's response: its status code, its whole body, a header (header:<name>), or a field of its
+// JSON body (json:<path>, ie. json:task.args.0, with array elements by index, and an array's values joined with commas)
+var ExtractSources = []string{"status", "body", "header:<name>", "json:<path>"}
+
+// Checks that the expression says where to extract a value from (in one of the ways ExtractSources lists)
+func checkExtractExpression(expression string) error {
+	source, argument, found := strings.Cut(expression, ":")
+	switch {
+	case !found && (source == "status" || source == "body"):
+		return nil
+	case found && (source == "header" || source == "json") && argument != "":
+		return nil
+	}
+	return fmt.Errorf("invalid extract '%s' (must be one of %s)", expression, strings.Join(ExtractSources, ", "))
+}
+
+// Extracts the value the expression refers to from the response (which checkExtractExpression has already checked)
+func extractResponseValue(response *MessageResponse, expression string) (string, error) {
+	source, argument, _ := strings.Cut(expression, ":")
+	switch source {
+	case "status":
+		if response.statusCode == 0 {
+			return "", fmt.Errorf("the response has no status code")
+		}
+		return strconv.Itoa(response.statusCode), nil
+	case "body":
+		return strings.TrimSpace(response.body), nil
+	case "header":
+		values := response.headers.Values(argument)
+		if len(values) == 0 {
+			return "", fmt.Errorf("the response has no %s header", argument)
+		}
+		return strings.Join(values, ","), nil
+	}
+
+	// json:<path>
+	var value any
+	err := json.Unmarshal([]byte(response.body), &value)
+	if err != nil {
+		return "", fmt.Errorf("the response body isn't JSON: %v", err)
+	}
+	for _, key := range strings.Split(argument, ".") {
+		switch container := value.(type) {
+		case map[string]any:
+			field, found := container[key]
+			if !found {
+				return "", fmt.Errorf("the response has no %s field", argument)
+			}
+			value = field
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(container) {
+				return "", fmt.Errorf("the response has no %s field", argument)
+			}
+			value = container[index]
+		default:
+			return "", fmt.Errorf("the response has no %s field", argument)
+		}
+	}
+
+	// (a list of values is joined with commas, as a list variable's are, so a later step can loop over it)
+	if list, ok := value.([]any); ok {
+		items := []string{}
+		for _, item := range list {
+			text, err := formatExtractedValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return formatExtractedValue(value)
+}
+
+// Formats a value from a JSON body: a string as it is, and anything else as its JSON
+func formatExtractedValue(value any) (string, error) {
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	contents, err := json.Marshal(value)
+	return string(contents), err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Playbook_Extract(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+
+	// The server tasks the client with dropping each of a list of files, and it does
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Task-Id", "42")
+		fmt.Fprintf(w, `{"task": {"files": ["%s/a.txt", "%s/b.txt"], "contents": "tasked"}}`, dir, dir)
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	os.WriteFile(playbookPath, []byte(`
+name: tasking
+steps:
+  - name: checkin
+    command: send
+    args: ["GET", "` + host + `", "` + port + `"]
+    extract:
+      code: status
+      task_id: header:X-Task-Id
+      files: json:task.files
+      contents: json:task.contents
+      first: json:task.files.0
+  - command: create
+    foreach: "${files}"
+    as: file
+    args: ["${file}", "${contents} ${task_id} ${code}"]
+`), 0644)
+
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "playbook", playbookPath})
+	assert.Contains(t, output, "Extracted task_id = 42\n")
+	assert.Contains(t, output, "Extracted first = " + dir + "/a.txt\n")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "3 of 3 steps completed")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		contents, err := os.ReadFile(dir + "/" + name)
+		assert.Nil(t, err)
+		assert.Equal(t, "tasked 42 200", string(contents))
+	}
+}
+
+func TestMain_Playbook_Extract_Missing(t *testing.T) {
+	dir := t.TempDir()
+	playbookPath := dir + "/playbook.yaml"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sleep": 60}`)
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	// A value that isn't in the response fails the step, so nothing's run with it
+	os.WriteFile(playbookPath, []byte(`
+name: tasking
+steps:
+  - command: send
+    args: ["GET", "` + host + `", "` + port + `"]
+    extract:
+      task: json:task.command
+  - command: create
+    args: ["` + dir + `/never.txt", "${task}"]
+`), 0644)
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "playbook", playbookPath})
+	assert.Contains(t, output, "couldn't extract task (json:task.command): the response has no task.command field")
+	assert.Equal(t, activityLogEntry.status, "error")
+	assert.False(t, fileExists(dir + "/never.txt"))
+}
+
+func TestParsePlaybook_Extract(t *testing.T) {
+	_, err := parsePlaybook([]byte("name: x\nsteps:\n  - command: create\n    args: [a]\n    extract:\n      task: body\n"))
+	assert.ErrorContains(t, err, "invalid playbook: step 1 has extract, but only send steps can extract values")
+	_, err = parsePlaybook([]byte("name: x\nsteps:\n  - command: send\n    args: [GET, example.com]\n    extract:\n      task: cookie:session\n"))
+	assert.ErrorContains(t, err, "invalid playbook: step 1 invalid extract 'cookie:session' (must be one of status, body, header:<name>, json:<path>)")
+
+	// An extracted variable can only be used after the step that extracts it
+	_, err = parsePlaybook([]byte("name: x\nsteps:\n  - command: create\n    args: [\"${task}\"]\n  - command: send\n    args: [GET, example.com]\n    extract:\n      task: body\n"))
+	assert.ErrorContains(t, err, "invalid playbook: step 1 uses undefined variable 'task'")
+	_, err = parsePlaybook([]byte("name: x\nsteps:\n  - command: send\n    args: [GET, example.com]\n    extract:\n      task: body\n  - command: create\n    args: [\"${task}\"]\n"))
+	assert.Nil(t, err)
+}
+
+func TestExtractResponseValue(t *testing.T) {
+	response := &MessageResponse{statusCode: 202, headers: http.Header{"X-Task": []string{"run"}}, body: ` {"tasks": [{"cmd": "whoami", "args": ["-a"], "sleep": 30, "ok": true}]} `}
+	for expression, expected := range map[string]string{
+		"status": "202",
+		"header:x-task": "run",
+		"json:tasks.0.cmd": "whoami",
+		"json:tasks.0.sleep": "30",
+		"json:tasks.0.ok": "true",
+		"json:tasks.0.args": "-a",
+		"body": `{"tasks": [{"cmd": "whoami", "args": ["-a"], "sleep": 30, "ok": true}]}`,
+	} {
+		value, err := extractResponseValue(response, expression)
+		assert.Nil(t, err, expression)
+		assert.Equal(t, expected, value, expression)
+	}
+	for _, expression := range []string{"header:X-Missing", "json:tasks.1.cmd", "json:tasks.0.cmd.name", "json:sleep"} {
+		_, err := extractResponseValue(response, expression)
+		assert.NotNil(t, err, expression)
+	}
+	_, err := extractResponseValue(&MessageResponse{body: "not json"}, "json:task")
+	assert.ErrorContains(t, err, "the response body isn't JSON")
+}
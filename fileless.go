@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The ways fileless can hand a script to an interpreter without writing it to disk: piped to its stdin (as curl | sh does), as a
+// /dev/fd path to a pipe (as bash's process substitution, <(...), does), or as an anonymous in-memory file that's run itself (Linux's
+// memfd_create, as in-memory loaders do)
+var FilelessMethods = []string{"stdin", "fd", "memfd"}
+
+// The interpreters fileless can run a script with
+var FilelessInterpreters = []string{"sh", "bash", "powershell", "python"}
+
+// The script each interpreter is given by default (harmless: it just says who it's running as)
+var FilelessScripts = map[string]string{
+	"sh": "echo noisemaker fileless; id",
+	"bash": "echo noisemaker fileless; id",
+	"powershell": "Write-Output 'noisemaker fileless'; whoami",
+	"python": "import getpass; print('noisemaker fileless', getpass.getuser())",
+}
+
+// Options for the fileless command
+type FilelessOptions struct {
+	interpreter			string
+	method				string
+	script				string
+}
+
+// Response data from fileless action
+type FilelessResponse struct {
+	commandLine			string
+	processId			int
+	bytesSent			int
+	bytesReceived		int
+	status				string
+}
+
+// Parses fileless's arguments: [-interpreter=name] [-method=stdin|fd|memfd] [script...], where the script's words are joined with spaces
+// (default: a harmless script, for the interpreter), and the interpreter defaults to powershell on Windows and sh elsewhere
+func parseFilelessOptions(goos string, args []string) (*FilelessOptions, error) {
+	defaultInterpreter := "sh"
+	if goos == "windows" {
+		defaultInterpreter = "powershell"
+	}
+	flags := flag.NewFlagSet("fileless", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	interpreter := flags.String("interpreter", defaultInterpreter, "the interpreter to run the script with")
+	method := flags.String("method", "stdin", "how to hand the script to the interpreter")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fileless: %v", err)
+	}
+	if !containsString(FilelessInterpreters, *interpreter) {
+		return nil, fmt.Errorf("invalid fileless: invalid -interpreter %s (must be one of %v)", *interpreter, FilelessInterpreters)
+	}
+	if !containsString(FilelessMethods, *method) {
+		return nil, fmt.Errorf("invalid fileless: invalid -method %s (must be one of %v)", *method, FilelessMethods)
+	}
+	options := &FilelessOptions{interpreter: *interpreter, method: *method, script: FilelessScripts[*interpreter]}
+	if flags.NArg() > 0 {
+		options.script = strings.Join(flags.Args(), " ")
+	}
+	return options, nil
+}
+
+// Gets the interpreter's command, and the args that have it read its script from stdin (or, given a path, from that file)
+func getFilelessCommand(goos string, interpreter string, path string) (string, []string) {
+	switch interpreter {
+	case "powershell":
+		cmd, args := getPowerShellCommand(goos)
+		if path != "" {
+			return cmd, append(args, "-File", path)
+		}
+		return cmd, append(args, "-Command", "-")
+	case "python":
+		cmd := "python3"
+		if goos == "windows" {
+			cmd = "python.exe"
+		}
+		if path != "" {
+			return cmd, []string{path}
+		}
+		return cmd, []string{"-"}
+	default:
+		// sh, bash
+		if path != "" {
+			return interpreter, []string{path}
+		}
+		return interpreter, []string{"-s"}
+	}
+}
+
+// Gets the line a script has to start with for the OS to run it with the interpreter itself (as an in-memory file is)
+func getFilelessShebang(interpreter string) string {
+	binaries := map[string]string{"sh": "sh", "bash": "bash", "powershell": "pwsh", "python": "python3"}
+	return "#!/usr/bin/env " + binaries[interpreter] + "\n"
+}
+
+// Runs the script with the interpreter without writing it to disk, handing it over with the method, and gets the interpreter's exact
+// command line and exit status
+func runFileless(goos string, options *FilelessOptions) *FilelessResponse {
+	response := new(FilelessResponse)
+	var cmd *exec.Cmd
+	var err error
+	switch options.method {
+	case "stdin":
+		name, args := getFilelessCommand(goos, options.interpreter, "")
+		cmd = exec.CommandContext(runContext, name, args...)
+		cmd.Stdin = strings.NewReader(options.script)
+	case "fd":
+		// (the child gets the pipe's read end as fd 3, the first after stdin, stdout, and stderr)
+		if goos == "windows" || options.interpreter == "powershell" {
+			err = fmt.Errorf("%w: -method=fd with %s on %s", errors.ErrUnsupported, options.interpreter, goos)
+			break
+		}
+		var r, w *os.File
+		r, w, err = os.Pipe()
+		if err != nil {
+			break
+		}
+		defer r.Close()
+		go func() {
+			w.WriteString(options.script + "\n")
+			w.Close()
+		}()
+		name, args := getFilelessCommand(goos, options.interpreter, "/dev/fd/3")
+		cmd = exec.CommandContext(runContext, name, args...)
+		cmd.ExtraFiles = []*os.File{r}
+	case "memfd":
+		var f *os.File
+		var path string
+		f, path, err = createMemoryFile("noisemaker-fileless", getFilelessShebang(options.interpreter) + options.script + "\n")
+		if err != nil {
+			break
+		}
+		defer f.Close()
+		cmd = exec.CommandContext(runContext, path)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = "error"
+		if errors.Is(err, errors.ErrUnsupported) {
+			response.status = "unsupported"
+		}
+		return response
+	}
+
+	response.commandLine = strings.Join(cmd.Args, " ")
+	response.bytesSent = len(options.script)
+	fmt.Printf("Running %s (%s script, over %s)...\n", response.commandLine, options.interpreter, options.method)
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		fmt.Printf("%s\n", strings.TrimSpace(string(output)))
+	}
+	if cmd.ProcessState != nil {
+		response.processId = cmd.ProcessState.Pid()
+	}
+	response.bytesReceived = len(output)
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		response.status = exitErr.ProcessState.String()
+	} else if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = "unable_to_run"
+	} else {
+		response.status = "exit status 0"
+	}
+	return response
+}
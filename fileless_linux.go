@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Creates an anonymous in-memory file (with memfd_create) with the contents, and gets the path it can be run from (through this
+// process's /proc entry, for as long as the file's kept open)
+func createMemoryFile(name string, contents string) (*os.File, string, error) {
+	fd, err := unix.MemfdCreate(name, unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, "", err
+	}
+	f := os.NewFile(uintptr(fd), name)
+	if _, err = f.WriteString(contents); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	return f, fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), fd), nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// In-memory files (memfd_create) are Linux-only
+func createMemoryFile(name string, contents string) (*os.File, string, error) {
+	return nil, "", fmt.Errorf("%w: -method=memfd is Linux-only", errors.ErrUnsupported)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Fileless(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh isn't available on Windows")
+	}
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// Piped to the interpreter's stdin
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "fileless", "echo", "fileless-stdin;", "exit", "3"})
+	assert.Contains(t, output, "fileless-stdin")
+	assert.Equal(t, activityLogEntry.activity, "fileless")
+	assert.Equal(t, activityLogEntry.method, "stdin")
+	assert.Equal(t, activityLogEntry.status, "exit status 3")
+	assert.Equal(t, activityLogEntry.details, "sh script over stdin: echo fileless-stdin; exit 3\\, command sh -s")
+	assert.Equal(t, activityLogEntry.bytesSent, len("echo fileless-stdin; exit 3"))
+	assert.Equal(t, activityLogEntry.bytesReceived, len("fileless-stdin\n"))
+	assert.NotZero(t, activityLogEntry.processId)
+
+	// As a /dev/fd pipe
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "fileless", "-method=fd", "echo fileless-fd"})
+	assert.Contains(t, output, "fileless-fd")
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	assert.True(t, strings.HasSuffix(activityLogEntry.details, "command sh /dev/fd/3"))
+
+	// Nothing's written to disk
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 2)
+	assert.False(t, fileExists(dir + "/noisemaker-artifacts.jsonl"))
+}
+
+func TestMain_Fileless_Memfd(t *testing.T) {
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "fileless", "-method=memfd", "-interpreter=sh", "echo fileless-memfd"})
+	if runtime.GOOS != "linux" {
+		assert.Equal(t, activityLogEntry.status, "unsupported")
+		return
+	}
+	assert.Contains(t, output, "fileless-memfd")
+	assert.Equal(t, activityLogEntry.method, "memfd")
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	assert.Regexp(t, `command /proc/\d+/fd/\d+$`, activityLogEntry.details)
+}
+
+func TestParseFilelessOptions(t *testing.T) {
+	options, err := parseFilelessOptions("windows", []string{})
+	assert.Nil(t, err)
+	assert.Equal(t, &FilelessOptions{interpreter: "powershell", method: "stdin", script: FilelessScripts["powershell"]}, options)
+	options, err = parseFilelessOptions("linux", []string{"-interpreter=python", "-method=fd", "print(1)"})
+	assert.Nil(t, err)
+	assert.Equal(t, &FilelessOptions{interpreter: "python", method: "fd", script: "print(1)"}, options)
+
+	_, err = parseFilelessOptions("linux", []string{"-interpreter=perl"})
+	assert.ErrorContains(t, err, "invalid fileless: invalid -interpreter perl (must be one of [sh bash powershell python])")
+	_, err = parseFilelessOptions("linux", []string{"-method=pipe"})
+	assert.ErrorContains(t, err, "invalid fileless: invalid -method pipe (must be one of [stdin fd memfd])")
+
+	// PowerShell can't read its script from a /dev/fd path
+	response := runFileless("linux", &FilelessOptions{interpreter: "powershell", method: "fd", script: "whoami"})
+	assert.Equal(t, "unsupported", response.status)
+	name, args := getFilelessCommand("windows", "powershell", "")
+	assert.Equal(t, "powershell.exe", name)
+	assert.Equal(t, []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", "-"}, args)
+}
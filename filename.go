@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The character that makes what follows it display right-to-left (so invoice<RLO>fdp.exe displays as invoiceexe.pdf)
+const RightToLeftOverride = '\u202e'
+
+// The Cyrillic letters that look like Latin ones, for -homoglyphs
+var Homoglyphs = map[rune]rune{
+	'a': 'а', 'c': 'с', 'e': 'е', 'i': 'і', 'j': 'ј', 'o': 'о', 'p': 'р', 's': 'ѕ', 'x': 'х', 'y': 'у',
+	'A': 'А', 'B': 'В', 'C': 'С', 'E': 'Е', 'H': 'Н', 'I': 'І', 'K': 'К', 'M': 'М', 'O': 'О', 'P': 'Р', 'T': 'Т', 'X': 'Х',
+}
+
+// The characters a -long-name is padded out with (accented, CJK, and astral ones, so its length in bytes, UTF-16 units, and characters
+// all differ)
+const LongNameChars = "éü日本語文件😀𝔘ñø"
+
+// Tricks to play with the name of a file (as filename-trickery detections look for, and sensors' Unicode handling trips over)
+type FileNameOptions struct {
+	rtlo				string		// the extension to display the name as ending with, hiding its real one with a right-to-left override
+	homoglyphs			bool		// whether to swap the name's Latin letters for Cyrillic ones that look the same
+	longName			int			// the length (in characters) to pad the name out to with Unicode characters (or 0)
+}
+
+// Adds the -rtlo, -homoglyphs, and -long-name flags to a command's flags, returning a function that gets the options they give (nil
+// without any)
+func addFileNameFlags(flags *flag.FlagSet) func() (*FileNameOptions, error) {
+	rtlo := flags.String("rtlo", "", "the extension to display the file's name as ending with, with a right-to-left override, ie. pdf (default none)")
+	homoglyphs := flags.Bool("homoglyphs", false, "swaps the file name's Latin letters for Cyrillic ones that look the same (default false)")
+	longName := flags.Int("long-name", 0, "pads the file's name out to this many characters with Unicode ones (default 0, none)")
+	return func() (*FileNameOptions, error) {
+		if *rtlo == "" && !*homoglyphs && *longName == 0 {
+			return nil, nil
+		}
+		options := &FileNameOptions{rtlo: strings.TrimPrefix(*rtlo, "."), homoglyphs: *homoglyphs, longName: *longName}
+		if *rtlo != "" && (options.rtlo == "" || strings.ContainsAny(options.rtlo, "./\\")) {
+			return nil, fmt.Errorf("invalid -rtlo %s (must be an extension, ie. pdf)", *rtlo)
+		}
+		if options.longName < 0 {
+			return nil, fmt.Errorf("invalid -long-name %d (must be 0 or more)", options.longName)
+		}
+		return options, nil
+	}
+}
+
+// Plays the tricks on the name at the end of the path (leaving its extension, so the OS still treats it as what it is): its letters
+// swapped for homoglyphs, then padded out, then with a right-to-left override hiding its extension behind the -rtlo one
+func (options *FileNameOptions) apply(path string) (string, error) {
+	dir, name := filepath.Split(path)
+	extension := filepath.Ext(name)
+	base := strings.TrimSuffix(name, extension)
+	if options.homoglyphs {
+		base = strings.Map(func(char rune) rune {
+			if homoglyph, found := Homoglyphs[char]; found {
+				return homoglyph
+			}
+			return char
+		}, base)
+	}
+	override := ""
+	if options.rtlo != "" {
+		if extension == "" {
+			return path, fmt.Errorf("%s needs an extension for -rtlo to hide", path)
+		}
+		// (what's after the override displays reversed, so the -rtlo extension's written backwards, and the real one ends up in the middle)
+		override = string(RightToLeftOverride) + reverseString(options.rtlo)
+	}
+	padding := []rune(LongNameChars)
+	for i := 0; utf8.RuneCountInString(base + override + extension) < options.longName; i++ {
+		base += string(padding[i % len(padding)])
+	}
+	base += override
+	return dir + base + extension, nil
+}
+
+// Gets the labels the tricks played on a name are recorded with, ie. rtlo=true
+func (options *FileNameOptions) getLabels(labels string) string {
+	if options.rtlo != "" {
+		labels = addLabel(labels, "rtlo", "true")
+	}
+	if options.homoglyphs {
+		labels = addLabel(labels, "homoglyphs", "true")
+	}
+	if options.longName > 0 {
+		labels = addLabel(labels, "long-name", "true")
+	}
+	return labels
+}
+
+// Reverses a string, a character at a time
+func reverseString(text string) string {
+	chars := []rune(text)
+	for i, j := 0, len(chars) - 1; i < j; i, j = i + 1, j - 1 {
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return string(chars)
+}
+
+// Gets what a file name looks like to someone reading it: what's after a right-to-left override reversed, and homoglyphs as the Latin
+// letters they look like
+func getDisplayedFileName(name string) string {
+	if i := strings.IndexRune(name, RightToLeftOverride); i >= 0 {
+		name = name[:i] + reverseString(name[i + utf8.RuneLen(RightToLeftOverride):])
+	}
+	latin := map[rune]rune{}
+	for char, homoglyph := range Homoglyphs {
+		latin[homoglyph] = char
+	}
+	return strings.Map(func(char rune) rune {
+		if letter, found := latin[char]; found {
+			return letter
+		}
+		return char
+	}, name)
+}
+
+// Describes a file name for an entry's details, with its raw bytes escaped (so nothing in it can disguise the log itself, as it does
+// the file), its lengths, and what it looks like, ie. `name "invoice\u202efdp.exe", 17 bytes, 15 characters, looks like invoiceexe.pdf`
+func getFileNameDetails(path string) string {
+	name := filepath.Base(path)
+	details := fmt.Sprintf("name %s, %d bytes, %d characters", strconv.QuoteToASCII(name), len(name), utf8.RuneCountInString(name))
+	if displayed := getDisplayedFileName(name); displayed != name {
+		details += fmt.Sprintf(", looks like %s", strconv.QuoteToASCII(displayed))
+	}
+	return details
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Create_FileNameTricks(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// The real extension is hidden behind the one it looks like, and the name's logged with its raw bytes escaped
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-rtlo=pdf", dir + "/invoice.exe", "MZ"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.Equal(t, dir + "/invoice\u202efdp.exe", activityLogEntry.path)
+	assert.Equal(t, "rtlo=true", activityLogEntry.labels)
+	assert.Equal(t, "name \"invoice\\\\u202efdp.exe\"\\, 17 bytes\\, 15 characters\\, looks like \"invoiceexe.pdf\"", activityLogEntry.details)
+	assert.FileExists(t, dir + "/invoice\u202efdp.exe")
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, dir + "/invoice\u202efdp.exe", parsedLog.entries[0].path)
+
+	// (after what a profile's contents measure at)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-homoglyphs", "-profile=text", dir + "/passwords.txt"})
+	assert.Equal(t, "homoglyphs=true", activityLogEntry.labels)
+	assert.Regexp(t, "declared text \\(.txt\\)\\\\, name \"\\\\\\\\u0440\\\\\\\\u0430\\\\\\\\u0455\\\\\\\\u0455w\\\\\\\\u043erd\\\\\\\\u0455.txt\"\\\\, 19 bytes\\\\, 13 characters\\\\, looks like \"passwords.txt\"$", activityLogEntry.details)
+
+	// A name too long for the filesystem isn't created, but is still recorded
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-long-name=200", dir + "/report.txt"})
+	assert.NotEqual(t, "created", activityLogEntry.status)
+	assert.Equal(t, "long-name=true", activityLogEntry.labels)
+	assert.Contains(t, activityLogEntry.details, "200 characters")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "create", "-rtlo=pdf", dir + "/invoice"}, "needs an extension for -rtlo to hide")
+}
+
+func TestFileNameOptions_Apply(t *testing.T) {
+	path, err := (&FileNameOptions{rtlo: "jpg", homoglyphs: true}).apply("/tmp/photo.scr")
+	assert.Nil(t, err)
+	assert.Equal(t, "/tmp/\u0440h\u043et\u043e\u202egpj.scr", path)
+	assert.Equal(t, "photorcs.jpg", getDisplayedFileName("\u0440h\u043et\u043e\u202egpj.scr"))
+
+	// A long name's padded out to its length, keeping its extension (and its lengths in bytes and characters differ)
+	path, err = (&FileNameOptions{longName: 64}).apply("/tmp/notes.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, 64, utf8.RuneCountInString(path[len("/tmp/"):]))
+	assert.Greater(t, len(path[len("/tmp/"):]), 64)
+	assert.Equal(t, ".txt", path[len(path) - 4:])
+	path, err = (&FileNameOptions{longName: 4}).apply("/tmp/notes.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "/tmp/notes.txt", path)
+
+	_, err = (&FileNameOptions{rtlo: "pdf"}).apply("/tmp/invoice")
+	assert.ErrorContains(t, err, "/tmp/invoice needs an extension for -rtlo to hide")
+}
+
+func TestAddFileNameFlags(t *testing.T) {
+	parse := func(args ...string) (*FileNameOptions, error) {
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		getFileName := addFileNameFlags(flags)
+		assert.Nil(t, flags.Parse(args))
+		return getFileName()
+	}
+	options, err := parse()
+	assert.Nil(t, err)
+	assert.Nil(t, options)
+	options, err = parse("-rtlo=.pdf", "-long-name=100")
+	assert.Nil(t, err)
+	assert.Equal(t, &FileNameOptions{rtlo: "pdf", longName: 100}, options)
+
+	_, err = parse("-rtlo=tar.gz")
+	assert.ErrorContains(t, err, "invalid -rtlo tar.gz (must be an extension, ie. pdf)")
+	_, err = parse("-long-name=-1")
+	assert.ErrorContains(t, err, "invalid -long-name -1 (must be 0 or more)")
+}
+
+func TestGetFileNameDetails(t *testing.T) {
+	assert.Equal(t, "name \"report.txt\", 10 bytes, 10 characters", getFileNameDetails("/tmp/report.txt"))
+
+	// (control characters are escaped, as well as Unicode ones)
+	assert.Equal(t, "name \"a\\nb.txt\", 7 bytes, 7 characters", getFileNameDetails("/tmp/a\nb.txt"))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Response data from acting on a set of files (every file a glob matches, or several paths), one entry for each
+type FileSetResponse struct {
+	files				int
+	succeeded			int
+	failed				int
+	unmatched			[]string	// the patterns that didn't match any files
+	status				string
+}
+
+// Whether the path's a glob to match files with (ie. "./staging/*.bin"), rather than a file's path: it has a wildcard, and isn't
+// a file that exists as it is (a file's name can have a wildcard in it), or a network share's path
+func isFilePattern(path string) bool {
+	if !strings.ContainsAny(path, "*?[") {
+		return false
+	}
+	if _, found := parseSMBPath(path); found {
+		return false
+	}
+	_, err := os.Lstat(path)
+	return err != nil
+}
+
+// Gets the files the paths are (each pattern's matches, in order, and every other path as it is), and the patterns that didn't match
+// any (a pattern that isn't valid is taken as a path)
+func expandFilePatterns(paths []string) ([]string, []string) {
+	files := []string{}
+	unmatched := []string{}
+	for _, path := range paths {
+		if !isFilePattern(path) {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			files = append(files, path)
+			continue
+		}
+		found := false
+		for _, match := range matches {
+			// (only files, not the directories it matches)
+			if fileExists(match) {
+				if strings.HasPrefix(match, "-") {
+					// (so it isn't taken as an option)
+					match = "." + string(filepath.Separator) + match
+				}
+				files = append(files, match)
+				found = true
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, path)
+		}
+	}
+	return files, unmatched
+}
+
+// Runs the command on each of the files the paths are (with the arguments getArgs gives for it), as part of the parent's run, each
+// logged as its own entry; the parent's status is done if every one succeeded, partial if some did, or else the last one's status
+// (or not_found, or skipped with ignoreMissing, if nothing matched)
+func runFileSet(activityLog Sink, parent *ActivityLogEntry, command string, paths []string, getArgs func(path string) []string, done string, ignoreMissing bool) *FileSetResponse {
+	files, unmatched := expandFilePatterns(paths)
+	response := &FileSetResponse{files: len(files), unmatched: unmatched}
+	for _, pattern := range unmatched {
+		fmt.Printf("No files match %s\n", pattern)
+	}
+
+	lastStatus := ""
+	for n, path := range files {
+		if isRunCancelled() {
+			break
+		}
+		fmt.Printf("File %d of %d (%s):\n", n + 1, len(files), path)
+		args := getArgs(path)
+		entry := newChildLogEntry(parent, command)
+		entry.processCmd = escapeCommandString(command, args)
+		err := runCommandSafely(activityLog, entry, command, args)
+		if err != nil || isFailureStatus(unescapeRawText(entry.status)) || entry.status == "cancelled" {
+			response.failed++
+			lastStatus = entry.status
+		} else {
+			response.succeeded++
+		}
+	}
+
+	switch {
+	case len(files) == 0 && ignoreMissing:
+		response.status = "skipped"
+	case len(files) == 0:
+		response.status = "not_found"
+	case response.failed == 0 && (len(unmatched) == 0 || ignoreMissing):
+		response.status = done
+	case response.succeeded == 0:
+		response.status = lastStatus
+	default:
+		response.status = "partial"
+	}
+	return response
+}
+
+// Describes the files the command acted on, for the parent's entry, ie. "3 of 4 files deleted, 1 failed"
+func getFileSetDetails(response *FileSetResponse, done string) string {
+	details := fmt.Sprintf("%d of %d files %s", response.succeeded, response.files, done)
+	if response.failed > 0 {
+		details += fmt.Sprintf(", %d failed", response.failed)
+	}
+	if len(response.unmatched) > 0 {
+		details += ", no files match " + strings.Join(response.unmatched, ", ")
+	}
+	return details
+}
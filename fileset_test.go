@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Delete_Glob(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	assert.Nil(t, os.Mkdir(dir + "/staging", 0755))
+	for _, name := range []string{"a.bin", "b.bin", "keep.txt"} {
+		assert.Nil(t, os.WriteFile(dir + "/staging/" + name, []byte("data"), 0644))
+	}
+
+	// Every file it matches is deleted, each with its own entry, and then the summary
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "delete", dir + "/staging/*.bin"})
+	assert.Equal(t, "deleted", activityLogEntry.status)
+	assert.Equal(t, "2 of 2 files deleted", activityLogEntry.details)
+	assert.NoFileExists(t, dir + "/staging/a.bin")
+	assert.NoFileExists(t, dir + "/staging/b.bin")
+	assert.FileExists(t, dir + "/staging/keep.txt")
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 3)
+	assert.Equal(t, "delete " + dir + "/staging/a.bin", unescapeRawText(parsedLog.entries[0].processCmd))
+	assert.Equal(t, "deleted", parsedLog.entries[1].status)
+
+	// Several paths, one of which doesn't exist
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "delete", dir + "/staging/keep.txt", dir + "/staging/missing.txt"})
+	assert.Equal(t, "partial", activityLogEntry.status)
+	assert.Equal(t, "1 of 2 files deleted\\, 1 failed", activityLogEntry.details)
+
+	// Nothing matches
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "delete", dir + "/staging/*.bin"})
+	assert.Equal(t, "not_found", activityLogEntry.status)
+	assert.Equal(t, "0 of 0 files deleted\\, no files match " + dir + "/staging/*.bin", activityLogEntry.details)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "delete", "-ignore-missing", dir + "/staging/*.bin"})
+	assert.Equal(t, "skipped", activityLogEntry.status)
+}
+
+func TestMain_Update_Glob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"one.log", "two.log"} {
+		assert.Nil(t, os.WriteFile(dir + "/" + name, []byte("before"), 0644))
+	}
+	// (a file whose name has a wildcard in it is just that file)
+	assert.Nil(t, os.WriteFile(dir + "/star*.txt", []byte("before"), 0644))
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "update", dir + "/*.log", "after!"})
+	assert.Equal(t, "updated", activityLogEntry.status)
+	assert.Equal(t, "2 of 2 files updated", activityLogEntry.details)
+	for _, name := range []string{"one.log", "two.log"} {
+		contents, err := os.ReadFile(dir + "/" + name)
+		assert.Nil(t, err)
+		assert.Equal(t, "after!", string(contents))
+	}
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "update", dir + "/star*.txt", "after"})
+	assert.Equal(t, "updated", activityLogEntry.status)
+	assert.Empty(t, activityLogEntry.details)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The kinds of case fuzz can generate
+var FuzzKinds = []string{"file", "send"}
+
+// The pools fuzz draws each case's parameters from; a -pools file replaces the pools it gives, and keeps the rest
+type FuzzPools struct {
+	Names				[]string			`yaml:"names"`			// file names, in the working directory
+	Chars				[]string			`yaml:"chars"`			// characters random file names are made of
+	Extensions			[]string			`yaml:"extensions"`		// extensions random file names end with
+	Sizes				[]string			`yaml:"sizes"`			// sizes files are created at (ie. 4KB), besides their contents'
+	Contents			[]string			`yaml:"contents"`		// file contents, and request bodies
+	Hosts				[]string			`yaml:"hosts"`			// the addresses requests are sent to (there are none by default)
+	Ports				[]int				`yaml:"ports"`			// ports requests are sent to, besides random ones
+	Methods				[]string			`yaml:"methods"`		// request methods
+	Paths				[]string			`yaml:"paths"`			// request paths (and queries)
+	Protocols			[]string			`yaml:"protocols"`		// http or https
+}
+
+// The built-in pools, picked to probe the edge cases sensors tend to get wrong (names that are long, unicode, hidden, look like flags
+// or have misleading extensions; sizes around page and buffer boundaries; bodies that look like injections)
+var DefaultFuzzPools = FuzzPools{
+	Names: []string{"report.docx", "invoice.pdf.exe", "IMG_0001.JPG", "file with spaces.txt", " leading-space.txt", "-leading-dash.txt", ".hidden", "no_extension", "très-été.txt", "日本語.txt", "emoji-😀.txt", "rtl-\u202egpj.exe", "zero\u200bwidth.txt", strings.Repeat("a", 200) + ".txt", "semi;colon.txt", "comma,name.csv", "percent%20name.txt", "brackets[1](2){3}.txt", "quote'single.txt", "ampersand&name.txt", "dollar$HOME.txt", "trailing-dot.", "back\\slash.txt", "colon:name.txt", "tab\tname.txt", "new\nline.txt", "CON", "nul.txt"},
+	Chars: []string{"a", "Z", "0", "_", "-", " ", ".", "é", "日", "😀", "\u202e", "\u200b", "%", "'", "&", "$", "~", "#", "!", ":", "|", "?", "*"},
+	Extensions: []string{"", ".txt", ".exe", ".dll", ".ps1", ".bat", ".sh", ".docx", ".pdf.exe", ".tar.gz", ".lnk", ".tmp", ".TXT"},
+	Sizes: []string{"0", "1", "511", "512", "4095", "4096", "4097", "65535", "65536", "65537", "1MB"},
+	Contents: []string{"", "hello", "MZ This program cannot be run in DOS mode.", "#!/bin/sh\necho hello\n", "=cmd|' /C calc'!A0", "<script>alert(1)</script>", "' OR '1'='1", "${jndi:ldap://127.0.0.1/a}", "line1\r\nline2\r\n", "üñíçødé 日本語 😀", "\u202eevil", "{\"json\": true}", "%s%n%x", strings.Repeat("A", 4096)},
+	Ports: []int{80, 443, 8080, 8443, 1, 65535},
+	Methods: []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS", "TRACE", "PROPFIND", "get"},
+	Paths: []string{"/", "/index.html", "/api/v1/items?id=1", "/%2e%2e/%2e%2e/etc/passwd", "/..;/admin", "/search?q=%27%20OR%201%3D1--", "/a/" + strings.Repeat("b", 2000), "/%E2%80%AEtxt.exe", "/?" + strings.Repeat("x=1&", 100), "/file.php%00.jpg", "/UPPER/Case", "/%F0%9F%98%80"},
+	Protocols: []string{"http", "https"},
+}
+
+// A request method must be an HTTP token
+var fuzzMethodPattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// Names Windows reserves for devices (with any extension)
+var windowsReservedNames = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[1-9]|lpt[1-9])(\..*)?$`)
+
+// Options for the fuzz command
+type FuzzOptions struct {
+	count				int
+	seed				int64
+	caseNumber			int					// the one case to run again, if it's given
+	kinds				[]string
+	pools				*FuzzPools
+	dir					string
+}
+
+// A case fuzz generated: the commands it's run with
+type FuzzCase struct {
+	number				int
+	kind				string
+	commands			[][]string			// each command, then its args
+}
+
+// Response data from fuzz action
+type FuzzResponse struct {
+	cases				int
+	commands			int
+	failed				int					// commands that failed (or panicked), which are often what's being looked for
+	status				string
+}
+
+// Parses fuzz's arguments: [-count=n] [-seed=n] [-case=n] [-kinds=file,send] [-pools=path] [-hosts=a,b] [-dir=path]
+func parseFuzzOptions(args []string, goos string) (*FuzzOptions, error) {
+	flags := flag.NewFlagSet("fuzz", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	count := flags.Int("count", 10, "how many cases to generate (default 10)")
+	seed := flags.Int64("seed", 0, "the random seed, to generate the same cases again (default random)")
+	caseNumber := flags.Int("case", 0, "just the one case (by number) to run again, with the seed it was generated with (default all of them)")
+	kinds := flags.String("kinds", "", "the kinds of case to generate, ie. file,send (default file, and send if there are hosts)")
+	poolsPath := flags.String("pools", "", "the path to a YAML file of the value pools parameters are drawn from (default the built-in pools)")
+	hosts := flags.String("hosts", "", "the addresses requests are sent to, ie. 10.0.0.5,example.com (default the pools')")
+	dir := flags.String("dir", "", "the directory the cases' temporary directory (removed afterwards) is made in (default the system's)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fuzz: %v", err)
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("invalid fuzz: unexpected arguments %v", flags.Args())
+	}
+
+	options := &FuzzOptions{count: *count, seed: *seed, caseNumber: *caseNumber, dir: *dir}
+	if options.count < 1 {
+		return nil, fmt.Errorf("invalid count %d (must be at least 1)", options.count)
+	}
+	if options.caseNumber < 0 || options.caseNumber > options.count {
+		return nil, fmt.Errorf("invalid case %d (must be from 1 to the count, %d)", options.caseNumber, options.count)
+	}
+	if options.seed == 0 {
+		if options.caseNumber != 0 {
+			return nil, fmt.Errorf("invalid fuzz: -case needs the -seed it was generated with")
+		}
+		options.seed = time.Now().UnixNano()
+	}
+	options.pools, err = loadFuzzPools(*poolsPath, goos)
+	if err != nil {
+		return nil, err
+	}
+	if *hosts != "" {
+		options.pools.Hosts = strings.Split(*hosts, ",")
+	}
+	for _, host := range options.pools.Hosts {
+		if host == "" || strings.ContainsAny(host, "/?# ") {
+			return nil, fmt.Errorf("invalid fuzz host '%s' (must be an address, without a path)", host)
+		}
+	}
+
+	if *kinds == "" {
+		options.kinds = []string{"file"}
+		if len(options.pools.Hosts) > 0 {
+			options.kinds = append(options.kinds, "send")
+		}
+	} else {
+		options.kinds = strings.Split(*kinds, ",")
+	}
+	for _, kind := range options.kinds {
+		if !containsString(FuzzKinds, kind) {
+			return nil, fmt.Errorf("invalid fuzz kind '%s' (must be %s)", kind, strings.Join(FuzzKinds, ", "))
+		}
+		if kind == "send" && len(options.pools.Hosts) == 0 {
+			return nil, fmt.Errorf("invalid fuzz: send cases need hosts (with -hosts, or in the pools)")
+		}
+	}
+	return options, nil
+}
+
+// Gets a copy of the built-in pools, with the pools in the YAML file at the path (if there is one) in place of them, and checks them;
+// names (and the characters of random ones) that aren't valid on the OS are left out of the built-in pools, but are an error in a file
+func loadFuzzPools(path string, goos string) (*FuzzPools, error) {
+	pools := new(FuzzPools)
+	*pools = DefaultFuzzPools
+	pools.Names = filterFuzzNames(pools.Names, goos)
+	pools.Chars = filterFuzzNames(pools.Chars, goos)
+	if path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		given := new(FuzzPools)
+		err = yaml.Unmarshal(contents, given)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fuzz pools: %v", err)
+		}
+		for _, pool := range []struct{ given *[]string; pool *[]string }{{&given.Names, &pools.Names}, {&given.Chars, &pools.Chars}, {&given.Extensions, &pools.Extensions}, {&given.Sizes, &pools.Sizes}, {&given.Contents, &pools.Contents}, {&given.Hosts, &pools.Hosts}, {&given.Methods, &pools.Methods}, {&given.Paths, &pools.Paths}, {&given.Protocols, &pools.Protocols}} {
+			if *pool.given != nil {
+				*pool.pool = *pool.given
+			}
+		}
+		if given.Ports != nil {
+			pools.Ports = given.Ports
+		}
+	}
+
+	for name, pool := range map[string][]string{"names": pools.Names, "chars": pools.Chars, "extensions": pools.Extensions, "sizes": pools.Sizes, "contents": pools.Contents, "methods": pools.Methods, "paths": pools.Paths, "protocols": pools.Protocols} {
+		if len(pool) == 0 {
+			return nil, fmt.Errorf("invalid fuzz pools: %s is empty", name)
+		}
+	}
+	for _, name := range append(append([]string{}, pools.Names...), pools.Chars...) {
+		if !isValidFuzzName(name, goos) {
+			return nil, fmt.Errorf("invalid fuzz pools: '%s' isn't a valid file name on %s", name, goos)
+		}
+	}
+	for _, extension := range pools.Extensions {
+		if strings.ContainsAny(extension, "/\\\x00") {
+			return nil, fmt.Errorf("invalid fuzz pools: extension '%s' can't contain a path separator", extension)
+		}
+	}
+	for _, size := range pools.Sizes {
+		if _, err := parseSize(size); err != nil {
+			return nil, fmt.Errorf("invalid fuzz pools: %v", err)
+		}
+	}
+	for _, port := range pools.Ports {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid fuzz pools: port %d (must be from 1 to 65535)", port)
+		}
+	}
+	for _, method := range pools.Methods {
+		if !fuzzMethodPattern.MatchString(method) {
+			return nil, fmt.Errorf("invalid fuzz pools: method '%s' (must be an HTTP token)", method)
+		}
+	}
+	for _, path := range pools.Paths {
+		if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "?") {
+			return nil, fmt.Errorf("invalid fuzz pools: path '%s' (must start with / or ?)", path)
+		}
+	}
+	for _, protocol := range pools.Protocols {
+		if protocol != "http" && protocol != "https" {
+			return nil, fmt.Errorf("invalid fuzz pools: protocol '%s' (must be http or https)", protocol)
+		}
+	}
+	return pools, nil
+}
+
+// Whether the name can be created in a directory on the OS: never empty, . or .., or with a path separator (or NUL), and on Windows
+// without the characters it doesn't allow, a trailing dot or space, or a reserved device name
+func isValidFuzzName(name string, goos string) bool {
+	if name == "" || name == "." || name == ".." || len(name) > 255 || !utf8.ValidString(name) || strings.ContainsAny(name, "/\x00") {
+		return false
+	}
+	if goos == "windows" {
+		if strings.ContainsAny(name, "<>:\"\\|?*") || strings.ContainsFunc(name, func(r rune) bool { return r < 32 }) {
+			return false
+		}
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") || windowsReservedNames.MatchString(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Gets the names that are valid on the OS
+func filterFuzzNames(names []string, goos string) []string {
+	valid := []string{}
+	for _, name := range names {
+		if isValidFuzzName(name, goos) {
+			valid = append(valid, name)
+		}
+	}
+	return valid
+}
+
+// Gets the seed a case is generated from, so any one case can be generated again on its own
+func getFuzzCaseSeed(seed int64, number int) int64 {
+	return seed + int64(number)
+}
+
+// Generates the case with the number: a file's created (at one of the sizes, or with contents), maybe updated and read, then deleted,
+// in a directory of its own; or a request's sent to one of the hosts
+func getFuzzCase(number int, options *FuzzOptions, dir string, goos string) *FuzzCase {
+	random := rand.New(rand.NewSource(getFuzzCaseSeed(options.seed, number)))
+	pools := options.pools
+	pick := func(pool []string) string {
+		return pool[random.Intn(len(pool))]
+	}
+	fuzzCase := &FuzzCase{number: number, kind: options.kinds[random.Intn(len(options.kinds))]}
+
+	switch fuzzCase.kind {
+	case "file":
+		path := dir + string(os.PathSeparator) + strconv.Itoa(number) + string(os.PathSeparator) + getFuzzName(random, pools, goos)
+		if random.Intn(2) == 0 {
+			fuzzCase.commands = append(fuzzCase.commands, []string{"create", "-size=" + pick(pools.Sizes), path, pick(pools.Contents)})
+		} else {
+			fuzzCase.commands = append(fuzzCase.commands, []string{"create", path, pick(pools.Contents)})
+		}
+		if random.Intn(2) == 0 {
+			fuzzCase.commands = append(fuzzCase.commands, []string{"update", path, pick(pools.Contents)})
+		}
+		if random.Intn(2) == 0 {
+			fuzzCase.commands = append(fuzzCase.commands, []string{"read", path})
+		}
+		fuzzCase.commands = append(fuzzCase.commands, []string{"delete", path})
+	case "send":
+		// (mostly one of the ports, and sometimes any port at all)
+		port := 1 + random.Intn(65535)
+		if len(pools.Ports) > 0 && random.Intn(4) != 0 {
+			port = pools.Ports[random.Intn(len(pools.Ports))]
+		}
+		fuzzCase.commands = append(fuzzCase.commands, []string{"send", pick(pools.Methods), pick(pools.Hosts) + pick(pools.Paths), strconv.Itoa(port), pick(pools.Protocols), pick(pools.Contents)})
+	}
+	return fuzzCase
+}
+
+// Gets a file name: half the time one of the names, and otherwise made up of random characters and an extension (or one of the
+// names again, if that isn't a valid name on the OS, ie. it ends with a space on Windows)
+func getFuzzName(random *rand.Rand, pools *FuzzPools, goos string) string {
+	if random.Intn(2) == 0 {
+		return pools.Names[random.Intn(len(pools.Names))]
+	}
+	var name strings.Builder
+	for length := 1 + random.Intn(32); name.Len() < length; {
+		name.WriteString(pools.Chars[random.Intn(len(pools.Chars))])
+	}
+	name.WriteString(pools.Extensions[random.Intn(len(pools.Extensions))])
+	if !isValidFuzzName(name.String(), goos) {
+		return pools.Names[random.Intn(len(pools.Names))]
+	}
+	return name.String()
+}
+
+// Generates and runs the cases (or just the one, with -case), as part of the parent's run, logging each command as its own entry
+// labeled with the seed and case number it was generated from, so it can be run again
+func runFuzz(activityLog Sink, parent *ActivityLogEntry, options *FuzzOptions, goos string) (*FuzzResponse, error) {
+	response := &FuzzResponse{status: "error"}
+	// (the cases' files are always in a directory of their own, so removing it afterwards can't remove anything else)
+	dir, err := os.MkdirTemp(options.dir, "noisemaker-fuzz-")
+	if err != nil {
+		return response, err
+	}
+	defer os.RemoveAll(dir)
+
+	for number := 1; number <= options.count && !isRunCancelled(); number++ {
+		if options.caseNumber != 0 && number != options.caseNumber {
+			continue
+		}
+		fuzzCase := getFuzzCase(number, options, dir, goos)
+		if fuzzCase.kind == "file" {
+			err := os.Mkdir(dir + string(os.PathSeparator) + strconv.Itoa(number), 0755)
+			if err != nil {
+				return response, err
+			}
+		}
+		response.cases++
+
+		for _, command := range fuzzCase.commands {
+			fmt.Printf("Fuzz case %d: %s %q\n", number, command[0], command[1:])
+			entry := newChildLogEntry(parent, command[0])
+			entry.processCmd = escapeCommandString(command[0], command[1:])
+			entry.labels = addLabel(addLabel(entry.labels, "fuzz-seed", strconv.FormatInt(options.seed, 10)), "fuzz-case", strconv.Itoa(number))
+			err := runCommandSafely(activityLog, entry, command[0], command[1:])
+			response.commands++
+			if err != nil {
+				fmt.Printf("Fuzz case %d failed: %v\n", number, err)
+			}
+			if err != nil || isFailureStatus(entry.status) {
+				response.failed++
+			}
+		}
+	}
+
+	response.status = "completed"
+	fmt.Printf("Ran %d fuzz cases (%d commands, %d failed) with seed %d\n", response.cases, response.commands, response.failed, options.seed)
+	return response, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Fuzz(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	poolsPath := dir + "/pools.yaml"
+	assert.Nil(t, os.WriteFile(poolsPath, []byte("ports: [" + port + "]\nprotocols: [http]\nsizes: [\"0\", \"4097\"]\n"), 0644))
+
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "fuzz", "-seed=42", "-count=12", "-pools=" + poolsPath, "-hosts=" + host, "-dir=" + dir})
+	assert.Contains(t, output, "Fuzz case 1: ")
+	assert.Contains(t, output, "Ran 12 fuzz cases (")
+	assert.Equal(t, "fuzz", activityLogEntry.activity)
+	assert.Equal(t, "completed", activityLogEntry.status)
+	assert.Contains(t, activityLogEntry.details, "12 cases (")
+	assert.Contains(t, activityLogEntry.details, "with seed 42")
+	contents, err := os.ReadFile(logFilePath)
+	assert.Nil(t, err)
+	for _, text := range []string{",create,", ",delete,", ",send,", "fuzz-seed=42;fuzz-case=1", "fuzz-seed=42;fuzz-case=12"} {
+		assert.Contains(t, string(contents), text)
+	}
+	// (the cases' directory is removed afterwards)
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), "noisemaker-fuzz-"), entry.Name())
+	}
+
+	// Just the one case runs again
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "fuzz", "-seed=42", "-count=12", "-case=5", "-pools=" + poolsPath, "-hosts=" + host})
+	assert.Contains(t, output, "Fuzz case 5: ")
+	assert.NotContains(t, output, "Fuzz case 4: ")
+	assert.Contains(t, activityLogEntry.details, "1 cases (")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "fuzz", "-case=5"}, "-case needs the -seed it was generated with")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "fuzz", "-kinds=send"}, "send cases need hosts")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "fuzz", "-kinds=process"}, "invalid fuzz kind 'process' (must be file, send)")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "fuzz", "-count=0"}, "invalid count 0")
+}
+
+func TestGetFuzzCase(t *testing.T) {
+	options, err := parseFuzzOptions([]string{"-seed=7", "-count=50", "-hosts=10.0.0.5"}, "linux")
+	assert.Nil(t, err)
+	kinds := map[string]int{}
+	for number := 1; number <= options.count; number++ {
+		fuzzCase := getFuzzCase(number, options, "/tmp/fuzz", "linux")
+		kinds[fuzzCase.kind]++
+		// (a case is the same every time it's generated, whatever's generated before it)
+		assert.Equal(t, fuzzCase, getFuzzCase(number, options, "/tmp/fuzz", "linux"))
+
+		switch fuzzCase.kind {
+		case "file":
+			assert.Equal(t, "create", fuzzCase.commands[0][0])
+			assert.Equal(t, "delete", fuzzCase.commands[len(fuzzCase.commands) - 1][0])
+			path := fuzzCase.commands[len(fuzzCase.commands) - 1][1]
+			assert.True(t, isValidFuzzName(strings.TrimPrefix(path, "/tmp/fuzz/" + strconv.Itoa(number) + "/"), "linux"), path)
+		case "send":
+			assert.Len(t, fuzzCase.commands, 1)
+			assert.True(t, strings.HasPrefix(fuzzCase.commands[0][2], "10.0.0.5/") || strings.HasPrefix(fuzzCase.commands[0][2], "10.0.0.5?"))
+		}
+	}
+	assert.Greater(t, kinds["file"], 0)
+	assert.Greater(t, kinds["send"], 0)
+	assert.NotEqual(t, getFuzzCase(1, options, "/tmp/fuzz", "linux"), getFuzzCase(2, options, "/tmp/fuzz", "linux"))
+}
+
+func TestLoadFuzzPools(t *testing.T) {
+	pools, err := loadFuzzPools("", "windows")
+	assert.Nil(t, err)
+	assert.NotContains(t, pools.Names, "CON")
+	assert.NotContains(t, pools.Names, "colon:name.txt")
+	assert.NotContains(t, pools.Chars, "?")
+	assert.Contains(t, pools.Names, "invoice.pdf.exe")
+	pools, err = loadFuzzPools("", "linux")
+	assert.Nil(t, err)
+	assert.Contains(t, pools.Names, "colon:name.txt")
+	assert.Empty(t, pools.Hosts)
+
+	dir := t.TempDir()
+	for contents, message := range map[string]string{
+		"names: [\"a/b\"]\n": "'a/b' isn't a valid file name on linux",
+		"names: []\n": "names is empty",
+		"sizes: [\"lots\"]\n": "invalid fuzz pools: invalid size",
+		"ports: [0]\n": "port 0 (must be from 1 to 65535)",
+		"methods: [\"GET /\"]\n": "method 'GET /' (must be an HTTP token)",
+		"paths: [\"index.html\"]\n": "path 'index.html' (must start with / or ?)",
+		"protocols: [\"ftp\"]\n": "protocol 'ftp' (must be http or https)",
+		"names: [": "invalid fuzz pools",
+	} {
+		path := dir + "/pools.yaml"
+		assert.Nil(t, os.WriteFile(path, []byte(contents), 0644))
+		_, err := loadFuzzPools(path, "linux")
+		assert.ErrorContains(t, err, message, contents)
+	}
+}
+
+func TestIsValidFuzzName(t *testing.T) {
+	for name, valid := range map[string][2]bool{
+		"report.docx": {true, true},
+		"-leading-dash.txt": {true, true},
+		"tab\tname.txt": {true, false},
+		"trailing-dot.": {true, false},
+		"nul.txt": {true, false},
+		"back\\slash.txt": {true, false},
+		"a/b": {false, false},
+		"..": {false, false},
+		"": {false, false},
+		strings.Repeat("a", 256): {false, false},
+	} {
+		assert.Equal(t, valid[0], isValidFuzzName(name, "linux"), name)
+		assert.Equal(t, valid[1], isValidFuzzName(name, "windows"), name)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The kinds of benign activity a profile can mix together
+var GenerateActivityKinds = []string{"file", "web", "process"}
+
+// A mix of benign activity to generate: how often activities happen, and how likely each kind is
+type GenerateProfile struct {
+	Name				string				`yaml:"name"`
+	Rate				float64				`yaml:"rate"`			// activities per minute, on average
+	Interval			string				`yaml:"interval"`		// how the time between activities varies: exponential (the default), uniform, or fixed
+	Activities			[]GenerateActivity	`yaml:"activities"`
+}
+
+// A kind of benign activity in a profile, and what it's done with
+type GenerateActivity struct {
+	Kind				string				`yaml:"kind"`			// file (edits), web (requests), or process (launches)
+	Weight				float64				`yaml:"weight"`			// how likely it is, relative to the profile's other activities
+	Files				[]string			`yaml:"files"`			// file: names of the files edited, in the working directory
+	Targets				[]string			`yaml:"targets"`		// web: URLs requested (ie. https://www.wikipedia.org)
+	Commands			[][]string			`yaml:"commands"`		// process: commands launched, with their arguments
+}
+
+// The built-in profiles, by name
+var GenerateProfiles = map[string]*GenerateProfile{
+	"workstation": {
+		Name: "workstation",
+		Rate: 3,
+		Interval: "exponential",
+		Activities: []GenerateActivity{
+			{Kind: "file", Weight: 5, Files: []string{"notes.txt", "report-draft.docx", "budget.xlsx", "todo.md", "meeting-minutes.txt"}},
+			{Kind: "web", Weight: 4, Targets: []string{"https://www.google.com", "https://www.wikipedia.org", "https://github.com", "https://www.bing.com", "https://outlook.office.com"}},
+			{Kind: "process", Weight: 1, Commands: [][]string{{"hostname"}, {"whoami"}}},
+		},
+	},
+	"server": {
+		Name: "server",
+		Rate: 6,
+		Interval: "exponential",
+		Activities: []GenerateActivity{
+			{Kind: "web", Weight: 5, Targets: []string{"https://deb.debian.org", "https://registry.npmjs.org", "https://pypi.org", "http://169.254.169.254"}},
+			{Kind: "file", Weight: 4, Files: []string{"app.log", "access.log", "cache.tmp", "app.pid"}},
+			{Kind: "process", Weight: 1, Commands: [][]string{{"hostname"}, {"whoami"}}},
+		},
+	},
+}
+
+// Which profile to generate activity from, and for how long
+type GenerateOptions struct {
+	profile				*GenerateProfile
+	duration			time.Duration
+	count				int
+	seed				int64
+	dir					string
+	schedule			*Schedule			// the hours, days, and weekend rate activity's generated on, if any are given
+}
+
+// Response data from generate action
+type GenerateResponse struct {
+	completed			int
+	failed				int
+	kinds				map[string]int
+	status				string
+}
+
+// Parses the options of a generate (ie. --profile=server --duration=1h); the profile is a built-in one, or the path to a YAML profile
+func parseGenerateOptions(args []string) (*GenerateOptions, error) {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	profileName := flags.String("profile", "workstation", "the built-in profile (workstation or server), or the path to a YAML profile (default workstation)")
+	duration := flags.Duration("duration", time.Hour, "how long to generate activity for (default 1h)")
+	rate := flags.Float64("rate", 0, "activities per minute, on average (default the profile's)")
+	count := flags.Int("count", 0, "the most activities to generate (default no limit)")
+	seed := flags.Int64("seed", 0, "the random seed, to generate the same activity again (default random)")
+	dir := flags.String("dir", "", "the directory files are edited in (default a temporary directory, removed afterwards)")
+	hours := flags.String("hours", "", "the hours activity's generated in, ie. 09:00-12:00,13:00-17:30 (default all day)")
+	days := flags.String("days", "", "the days activity's generated on, ie. mon-fri (default every day)")
+	weekendRate := flags.Float64("weekend-rate", 1, "the fraction of activity that's still generated on weekends (default 1)")
+	timezone := flags.String("timezone", "", "the timezone the hours and days are in, ie. America/Chicago (default local time)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generate: %v", err)
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("invalid generate: unexpected arguments %v", flags.Args())
+	}
+
+	options := &GenerateOptions{duration: *duration, count: *count, seed: *seed, dir: *dir}
+	options.profile, err = loadGenerateProfile(*profileName)
+	if err != nil {
+		return nil, err
+	}
+	if *rate != 0 {
+		options.profile.Rate = *rate
+	}
+	if options.profile.Rate <= 0 || math.IsInf(options.profile.Rate, 0) || math.IsNaN(options.profile.Rate) {
+		return nil, fmt.Errorf("invalid rate %v (must be more than 0)", options.profile.Rate)
+	}
+	if options.duration <= 0 {
+		return nil, fmt.Errorf("invalid duration %v (must be more than 0)", options.duration)
+	}
+	if options.count < 0 {
+		return nil, fmt.Errorf("invalid count %d", options.count)
+	}
+	if options.seed == 0 {
+		options.seed = time.Now().UnixNano()
+	}
+	if *hours != "" || *days != "" || *weekendRate != 1 || *timezone != "" {
+		options.schedule = &Schedule{Hours: *hours, Days: *days, WeekendRate: weekendRate, Timezone: *timezone}
+		err = options.schedule.parse()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+// Gets a copy of the built-in profile with the name, or else reads the profile at the path, and checks it
+func loadGenerateProfile(nameOrPath string) (*GenerateProfile, error) {
+	profile := new(GenerateProfile)
+	if builtIn, found := GenerateProfiles[nameOrPath]; found {
+		*profile = *builtIn
+	} else {
+		contents, err := os.ReadFile(nameOrPath)
+		if os.IsNotExist(err) && !strings.ContainsAny(nameOrPath, "/\\.") {
+			return nil, fmt.Errorf("unknown profile '%s' (must be workstation, server, or the path to a YAML profile)", nameOrPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = yaml.Unmarshal(contents, profile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile: %v", err)
+		}
+		if profile.Name == "" {
+			profile.Name = nameOrPath
+		}
+	}
+
+	if profile.Interval == "" {
+		profile.Interval = "exponential"
+	}
+	if !containsString([]string{"exponential", "uniform", "fixed"}, profile.Interval) {
+		return nil, fmt.Errorf("invalid profile: unknown interval '%s' (must be exponential, uniform, or fixed)", profile.Interval)
+	}
+	if len(profile.Activities) == 0 {
+		return nil, fmt.Errorf("invalid profile: no activities")
+	}
+	for i, activity := range profile.Activities {
+		if !containsString(GenerateActivityKinds, activity.Kind) {
+			return nil, fmt.Errorf("invalid profile: activity %d has unknown kind '%s' (must be %s)", i + 1, activity.Kind, strings.Join(GenerateActivityKinds, ", "))
+		}
+		if activity.Weight <= 0 {
+			return nil, fmt.Errorf("invalid profile: activity %d has no weight", i + 1)
+		}
+		if (activity.Kind == "file" && len(activity.Files) == 0) || (activity.Kind == "web" && len(activity.Targets) == 0) || (activity.Kind == "process" && len(activity.Commands) == 0) {
+			return nil, fmt.Errorf("invalid profile: activity %d has nothing to do (a %s activity needs %s)", i + 1, activity.Kind, map[string]string{"file": "files", "web": "targets", "process": "commands"}[activity.Kind])
+		}
+		for _, target := range activity.Targets {
+			_, _, _, err := parseGenerateTarget(target)
+			if err != nil {
+				return nil, fmt.Errorf("invalid profile: activity %d %v", i + 1, err)
+			}
+		}
+		for _, file := range activity.Files {
+			if file == "" || strings.ContainsAny(file, "/\\") || file == "." || file == ".." {
+				return nil, fmt.Errorf("invalid profile: activity %d has an invalid file '%s' (must be a name in the working directory)", i + 1, file)
+			}
+		}
+		if slices.ContainsFunc(activity.Commands, func(command []string) bool { return len(command) == 0 }) {
+			return nil, fmt.Errorf("invalid profile: activity %d has an empty command", i + 1)
+		}
+	}
+	return profile, nil
+}
+
+// Splits a target URL into the destination address, port, and protocol send takes
+func parseGenerateTarget(target string) (string, int, string, error) {
+	parsedUrl, err := url.Parse(target)
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Hostname() == "" {
+		return "", 0, "", fmt.Errorf("has an invalid target '%s' (must be an http or https URL)", target)
+	}
+	port := 80
+	if parsedUrl.Scheme == "https" {
+		port = 443
+	}
+	if parsedUrl.Port() != "" {
+		port, err = strconv.Atoi(parsedUrl.Port())
+		if err != nil {
+			return "", 0, "", fmt.Errorf("has an invalid target '%s' (must be an http or https URL)", target)
+		}
+	}
+	return parsedUrl.Hostname(), port, parsedUrl.Scheme, nil
+}
+
+// Generates the profile's mix of activity until the duration's up (or the count's reached), as part of the parent's run, waiting a
+// random interval before each activity (so they arrive at the profile's rate, on average, within the schedule's hours and days, if
+// it has any) and logging each as its own entry
+func runGenerate(activityLog Sink, parent *ActivityLogEntry, options *GenerateOptions) (*GenerateResponse, error) {
+	response := &GenerateResponse{kinds: map[string]int{}, status: "error"}
+	dir := options.dir
+	if dir == "" {
+		var err error
+		dir, err = os.MkdirTemp("", "noisemaker-generate-")
+		if err != nil {
+			return response, err
+		}
+		defer os.RemoveAll(dir)
+	}
+
+	random := rand.New(rand.NewSource(options.seed))
+	schedule := options.schedule
+	deadline := scheduleNow().Add(options.duration)
+	for (options.count == 0 || response.completed + response.failed < options.count) && !isRunCancelled() {
+		wait := getGenerateInterval(random, options.profile)
+		now := scheduleNow()
+		at := now.Add(wait)
+		if schedule != nil && !schedule.isActive(at) {
+			// (outside of the schedule's hours, so start waiting again from when activity can next happen)
+			next := schedule.nextActive(at)
+			if next.IsZero() || next.After(deadline) {
+				scheduleSleep(deadline.Sub(now))
+				break
+			}
+			fmt.Printf("Waiting until %s (outside of the schedule's hours)...\n", next.In(schedule.location).Format(time.RFC3339))
+			scheduleSleep(next.Sub(now))
+			continue
+		}
+		if at.After(deadline) {
+			scheduleSleep(deadline.Sub(now))
+			break
+		}
+		scheduleSleep(wait)
+		if isRunCancelled() {
+			break
+		}
+
+		// On weekends, only some of the activity happens (leaving the rest out keeps the same random arrivals, just fewer of them)
+		if schedule != nil && schedule.isWeekend(at) && random.Float64() >= schedule.weekendRate {
+			continue
+		}
+
+		activity := pickGenerateActivity(random, options.profile)
+		command, args := getGenerateCommand(random, activity, dir)
+		fmt.Printf("Generating %s activity (%s)...\n", activity.Kind, strings.TrimSpace(command + " " + strings.Join(args, " ")))
+
+		entry := newChildLogEntry(parent, command)
+		entry.processCmd = escapeCommandString(command, args)
+		err := runCommandSafely(activityLog, entry, command, args)
+		if err != nil {
+			fmt.Printf("Generated %s activity failed: %v\n", activity.Kind, err)
+			response.failed += 1
+			continue
+		}
+		response.completed += 1
+		response.kinds[activity.Kind] += 1
+	}
+
+	if response.failed == 0 {
+		response.status = "completed"
+	} else if response.completed > 0 {
+		response.status = "partial"
+	}
+	fmt.Printf("Generated %d activities (%d failed)\n", response.completed, response.failed)
+	return response, nil
+}
+
+// Gets a random wait before the next activity, averaging 1/rate minutes: exponentially distributed (so activities arrive as a Poisson
+// process, the way independent events do), uniformly distributed up to twice the average, or always the average
+func getGenerateInterval(random *rand.Rand, profile *GenerateProfile) time.Duration {
+	mean := float64(time.Minute) / profile.Rate
+	switch profile.Interval {
+	case "uniform":
+		return time.Duration(random.Float64() * 2 * mean)
+	case "fixed":
+		return time.Duration(mean)
+	default:
+		return time.Duration(random.ExpFloat64() * mean)
+	}
+}
+
+// Picks one of the profile's activities at random, by weight
+func pickGenerateActivity(random *rand.Rand, profile *GenerateProfile) *GenerateActivity {
+	total := 0.0
+	for _, activity := range profile.Activities {
+		total += activity.Weight
+	}
+	pick := random.Float64() * total
+	for i := range profile.Activities {
+		pick -= profile.Activities[i].Weight
+		if pick < 0 {
+			return &profile.Activities[i]
+		}
+	}
+	return &profile.Activities[len(profile.Activities) - 1]
+}
+
+// Words edited into files, so they read like a person's notes
+var GenerateWords = []string{"agenda", "budget", "review", "draft", "quarterly", "meeting", "follow", "up", "action", "items", "project", "status", "update", "notes", "customer", "deadline", "team", "plan", "report", "summary"}
+
+// Gets the command the activity's done with: a file's created if it isn't there yet (and otherwise mostly updated, and sometimes
+// deleted), a target gets a GET request, or a command's launched
+func getGenerateCommand(random *rand.Rand, activity *GenerateActivity, dir string) (string, []string) {
+	switch activity.Kind {
+	case "file":
+		path := dir + string(os.PathSeparator) + activity.Files[random.Intn(len(activity.Files))]
+		words := make([]string, 5 + random.Intn(20))
+		for i := range words {
+			words[i] = GenerateWords[random.Intn(len(GenerateWords))]
+		}
+		if !fileExists(path) {
+			return "create", []string{path, strings.Join(words, " ")}
+		}
+		if random.Float64() < 0.2 {
+			return "delete", []string{path}
+		}
+		return "update", []string{path, strings.Join(words, " ")}
+	case "web":
+		destAddr, destPort, protocol, _ := parseGenerateTarget(activity.Targets[random.Intn(len(activity.Targets))])
+		return "send", []string{"GET", destAddr, strconv.Itoa(destPort), protocol}
+	default:
+		command := activity.Commands[random.Intn(len(activity.Commands))]
+		return "execute", command
+	}
+}
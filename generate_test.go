@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Generate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "pong")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	profilePath := dir + "/profile.yaml"
+	os.WriteFile(profilePath, []byte(`
+name: test-profile
+rate: 60000
+interval: fixed
+activities:
+  - kind: file
+    weight: 2
+    files: [notes.txt]
+  - kind: web
+    weight: 1
+    targets: ["` + server.URL + `"]
+`), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=generate-run", "generate", "--profile=" + profilePath, "--count=6", "--seed=42", "--dir=" + dir}
+	output := callMain(args)
+	assert.Contains(t, output, "Generating test-profile activity for 1h0m0s (60000 per minute, on average)...")
+	assert.Equal(t, activityLogEntry.activity, "generate")
+	assert.Equal(t, activityLogEntry.path, "test-profile")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.seq, 7)
+	assert.True(t, strings.HasPrefix(activityLogEntry.details, "6 activities generated ("))
+	assert.True(t, strings.HasSuffix(activityLogEntry.details, "0 process)\\, 0 failed\\, with seed 42"))
+
+	// Every activity is logged as part of the same run, and the same seed generates the same activity
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	activities := []string{}
+	for _, entry := range parsedLog.entries {
+		assert.Equal(t, "generate-run", entry.runId)
+		activities = append(activities, entry.activity)
+	}
+	assert.Contains(t, activities, "create")
+	assert.Contains(t, activities, "send")
+	details := activityLogEntry.details
+	os.Remove(dir + "/notes.txt")
+	callMain(args)
+	assert.Equal(t, details, activityLogEntry.details)
+}
+
+func TestMain_Generate_Duration(t *testing.T) {
+	// (at one a minute, nothing's likely to happen in the time)
+	args := []string{"./noisemaker", "-sink=stdout", "generate", "--profile=server", "--rate=0.001", "--duration=50ms", "--seed=7"}
+	start := time.Now()
+	callMain(args)
+	assert.GreaterOrEqual(t, time.Since(start), 50 * time.Millisecond)
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "0 activities generated (0 file\\, 0 web\\, 0 process)\\, 0 failed\\, with seed 7")
+}
+
+func TestMain_Generate_InvalidOptions(t *testing.T) {
+	args := []string{"./noisemaker", "-sink=stdout", "generate", "--profile=laptop"}
+	assertMainPanicsWithMessage(t, args, "unknown profile 'laptop' (must be workstation, server, or the path to a YAML profile)")
+	args = []string{"./noisemaker", "-sink=stdout", "generate", "--rate=-1"}
+	assertMainPanicsWithMessage(t, args, "invalid rate -1 (must be more than 0)")
+	args = []string{"./noisemaker", "-sink=stdout", "generate", "--duration=0s"}
+	assertMainPanicsWithMessage(t, args, "invalid duration 0s (must be more than 0)")
+	args = []string{"./noisemaker", "-sink=stdout", "generate", "--speed=2"}
+	assertMainPanicsWithMessage(t, args, "invalid generate: flag provided but not defined: -speed")
+}
+
+func TestLoadGenerateProfile(t *testing.T) {
+	profile, err := loadGenerateProfile("workstation")
+	assert.Nil(t, err)
+	assert.Equal(t, "workstation", profile.Name)
+	profile.Rate = 100
+	assert.Equal(t, 3.0, GenerateProfiles["workstation"].Rate)
+
+	dir := t.TempDir()
+	for contents, message := range map[string]string{
+		"rate: 1\n": "invalid profile: no activities",
+		"activities:\n  - kind: email\n    weight: 1\n": "activity 1 has unknown kind 'email' (must be file, web, process)",
+		"activities:\n  - kind: file\n    files: [a.txt]\n": "activity 1 has no weight",
+		"activities:\n  - kind: web\n    weight: 1\n": "activity 1 has nothing to do (a web activity needs targets)",
+		"activities:\n  - kind: web\n    weight: 1\n    targets: [ftp://example.com]\n": "activity 1 has an invalid target 'ftp://example.com' (must be an http or https URL)",
+		"activities:\n  - kind: file\n    weight: 1\n    files: [../escape.txt]\n": "activity 1 has an invalid file '../escape.txt' (must be a name in the working directory)",
+		"interval: bursty\nactivities:\n  - kind: process\n    weight: 1\n    commands: [[hostname]]\n": "unknown interval 'bursty' (must be exponential, uniform, or fixed)",
+	} {
+		os.WriteFile(dir + "/profile.yaml", []byte(contents), 0644)
+		_, err = loadGenerateProfile(dir + "/profile.yaml")
+		assert.ErrorContains(t, err, message, contents)
+	}
+}
+
+func TestGetGenerateInterval(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	profile := &GenerateProfile{Rate: 60, Interval: "fixed"}
+	assert.Equal(t, time.Second, getGenerateInterval(random, profile))
+
+	// The random intervals average out to the rate
+	for _, interval := range []string{"exponential", "uniform"} {
+		profile.Interval = interval
+		var total time.Duration
+		for i := 0; i < 10000; i++ {
+			total += getGenerateInterval(random, profile)
+		}
+		assert.InDelta(t, float64(time.Second), float64(total / 10000), float64(50 * time.Millisecond), interval)
+	}
+}
+
+func TestPickGenerateActivity(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	profile := &GenerateProfile{Activities: []GenerateActivity{{Kind: "file", Weight: 3}, {Kind: "web", Weight: 1}}}
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		counts[pickGenerateActivity(random, profile).Kind] += 1
+	}
+	assert.InDelta(t, 7500, counts["file"], 300)
+	assert.InDelta(t, 2500, counts["web"], 300)
+}
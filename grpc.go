@@ -0,0 +1,284 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative activitylogpb/activity_log.proto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"noisemaker/main/activitylogpb"
+)
+
+// Default address for the collector to listen on, if the command doesn't name one
+const DefaultCollectAddr = "127.0.0.1:7071"
+
+// Response data from collect action
+type CollectResponse struct {
+	addr				string
+	streams				int
+	received			int
+	status				string
+}
+
+// =====================================================================
+// Emitting
+// =====================================================================
+
+// Forwards entries to a gRPC collector (ie. another noisemaker running collect), streaming them over a single call for the whole run
+type GRPCSink struct {
+	target				string
+	conn				*grpc.ClientConn
+	client				activitylogpb.ActivityLogServiceClient
+	stream				grpc.ClientStreamingClient[activitylogpb.ActivityLogEntry, activitylogpb.StreamEntriesResponse]
+}
+
+// Sets up a sink for the collector at target (ie. collector:7071); nothing's sent until the first entry is written
+func newGRPCSink(target string) (*GRPCSink, error) {
+	if target == "" {
+		return nil, fmt.Errorf("invalid sink 'grpc' (must be grpc:<addr>)")
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCSink{target: target, conn: conn, client: activitylogpb.NewActivityLogServiceClient(conn)}, nil
+}
+
+func (sink *GRPCSink) WriteEntry(entry *ActivityLogEntry) error {
+	// (Re)open the stream, if this is the first entry or the last stream failed
+	if sink.stream == nil {
+		stream, err := sink.client.StreamEntries(context.Background())
+		if err != nil {
+			slog.Warn("Unable to forward log entry to gRPC collector", "error", err)
+			return nil
+		}
+		sink.stream = stream
+	}
+
+	err := sink.stream.Send(entryToProto(entry))
+	if err != nil {
+		// The stream's real error only comes back once it's closed
+		if err == io.EOF {
+			_, err = sink.stream.CloseAndRecv()
+		}
+		slog.Warn("Unable to forward log entry to gRPC collector", "error", err)
+		sink.stream = nil
+	}
+	return nil
+}
+
+func (sink *GRPCSink) Close() error {
+	if sink.stream != nil {
+		_, err := sink.stream.CloseAndRecv()
+		if err != nil {
+			slog.Warn("Unable to forward log entries to gRPC collector", "error", err)
+		}
+		sink.stream = nil
+	}
+	return sink.conn.Close()
+}
+
+// =====================================================================
+// Collecting
+// =====================================================================
+
+// Receives streams of entries from gRPC sinks, and writes them to the activity log as-is
+type LogCollector struct {
+	activitylogpb.UnimplementedActivityLogServiceServer
+	activityLog			Sink
+	maxStreams			int
+	mutex				sync.Mutex
+	response			*CollectResponse
+	done				chan struct{}
+	doneOnce			sync.Once
+}
+
+// Serves the collector on addr (ie. 0.0.0.0:7071) until it's been sent maxStreams streams (or forever, if maxStreams is 0), or it's
+// interrupted (when the parent's run is shut down)
+func runCollector(activityLog Sink, parent *ActivityLogEntry, addr string, maxStreams int) (*CollectResponse, error) {
+	collector := &LogCollector{
+		activityLog: activityLog,
+		maxStreams: maxStreams,
+		response: &CollectResponse{addr: addr, status: "error"},
+		done: make(chan struct{}),
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return collector.response, err
+	}
+	collector.response.addr = listener.Addr().String()
+
+	server := grpc.NewServer()
+	activitylogpb.RegisterActivityLogServiceServer(server, collector)
+	go server.Serve(listener)
+	fmt.Printf("Collecting activity log entries on %s...\n", collector.response.addr)
+
+	signals, stopSignals := notifyShutdown()
+	defer stopSignals()
+	var received os.Signal
+	select {
+	case <-collector.done:
+	case received = <-signals:
+		fmt.Println("Interrupted, stopping...")
+	case <-runContext.Done():
+		fmt.Println("Timed out, stopping...")
+	}
+
+	// Let any streams still open finish (for a little while)
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		server.Stop()
+	}
+
+	if received != nil {
+		shutdown(activityLog, parent, received)
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	fmt.Printf("Collector stopped: %d entries received over %d streams\n", collector.response.received, collector.response.streams)
+	collector.response.status = "stopped"
+	return collector.response, nil
+}
+
+// Writes each entry in the stream to the activity log as it arrives, keeping its sequence number (and host details)
+func (collector *LogCollector) StreamEntries(stream grpc.ClientStreamingServer[activitylogpb.ActivityLogEntry, activitylogpb.StreamEntriesResponse]) error {
+	received := 0
+	defer collector.finishStream()
+	for {
+		message, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&activitylogpb.StreamEntriesResponse{Received: int64(received)})
+		}
+		if err != nil {
+			return err
+		}
+		writeRemoteLogEntry(collector.activityLog, entryFromProto(message))
+		received += 1
+		collector.mutex.Lock()
+		collector.response.received += 1
+		collector.mutex.Unlock()
+	}
+}
+
+// Counts a finished stream, and signals when the collector's been sent enough
+func (collector *LogCollector) finishStream() {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.response.streams += 1
+	if collector.maxStreams > 0 && collector.response.streams >= collector.maxStreams {
+		collector.doneOnce.Do(func() { close(collector.done) })
+	}
+}
+
+// =====================================================================
+// Conversion
+// =====================================================================
+
+// Converts an entry to its protobuf message, with the escaping undone
+func entryToProto(entry *ActivityLogEntry) *activitylogpb.ActivityLogEntry {
+	message := &activitylogpb.ActivityLogEntry{
+		Activity: unescapeRawText(entry.activity),
+		Os: unescapeRawText(entry.os),
+		Username: unescapeRawText(entry.username),
+		ProcessName: unescapeRawText(entry.processName),
+		ProcessCmd: unescapeRawText(entry.processCmd),
+		Pid: int64(entry.processId),
+		Path: unescapeRawText(entry.path),
+		Status: unescapeRawText(entry.status),
+		Method: unescapeRawText(entry.method),
+		SourceAddr: unescapeRawText(entry.sourceAddr),
+		SourcePort: int64(entry.sourcePort),
+		DestAddr: unescapeRawText(entry.destAddr),
+		DestPort: int64(entry.destPort),
+		BytesSent: int64(entry.bytesSent),
+		Protocol: unescapeRawText(entry.protocol),
+		Attempt: int64(entry.attempt),
+		BytesReceived: int64(entry.bytesReceived),
+		Details: unescapeRawText(entry.details),
+		CorrelationId: unescapeRawText(entry.correlationId),
+		RunId: unescapeRawText(entry.runId),
+		Seq: int64(entry.seq),
+		Hostname: unescapeRawText(entry.hostname),
+		HostIps: strings.Fields(entry.hostIPs),
+		MachineId: unescapeRawText(entry.machineId),
+		Note: unescapeRawText(entry.note),
+		Signature: unescapeRawText(entry.signature),
+		Elevated: entry.elevated,
+		DnsTime: int64(entry.dnsTime),
+		TlsVersion: unescapeRawText(entry.tlsVersion),
+		TlsCipher: unescapeRawText(entry.tlsCipher),
+	}
+	timestamp, err := time.Parse(time.RFC3339, entry.timestamp)
+	if err == nil {
+		message.Timestamp = timestamppb.New(timestamp)
+	}
+	for _, label := range strings.Split(unescapeRawText(entry.labels), ";") {
+		key, value, found := strings.Cut(label, "=")
+		if found {
+			message.Labels = append(message.Labels, &activitylogpb.Label{Key: key, Value: value})
+		}
+	}
+	return message
+}
+
+// Converts a protobuf message back to an entry, escaping it for the CSV activity log
+func entryFromProto(message *activitylogpb.ActivityLogEntry) *ActivityLogEntry {
+	entry := new(ActivityLogEntry)
+	if message.Timestamp != nil {
+		entry.timestamp = message.Timestamp.AsTime().Local().Format(time.RFC3339)
+	}
+	entry.activity = escapeRawText(message.Activity)
+	entry.os = escapeRawText(message.Os)
+	entry.username = escapeRawText(message.Username)
+	entry.processName = escapeRawText(message.ProcessName)
+	entry.processCmd = escapeRawText(message.ProcessCmd)
+	entry.processId = int(message.Pid)
+	entry.path = escapeRawText(message.Path)
+	entry.status = escapeRawText(message.Status)
+	entry.method = escapeRawText(message.Method)
+	entry.sourceAddr = escapeRawText(message.SourceAddr)
+	entry.sourcePort = int(message.SourcePort)
+	entry.destAddr = escapeRawText(message.DestAddr)
+	entry.destPort = int(message.DestPort)
+	entry.bytesSent = int(message.BytesSent)
+	entry.protocol = escapeRawText(message.Protocol)
+	entry.attempt = int(message.Attempt)
+	entry.bytesReceived = int(message.BytesReceived)
+	entry.details = escapeRawText(message.Details)
+	entry.correlationId = escapeRawText(message.CorrelationId)
+	entry.runId = escapeRawText(message.RunId)
+	entry.seq = int(message.Seq)
+	entry.hostname = escapeRawText(message.Hostname)
+	entry.hostIPs = escapeRawText(strings.Join(message.HostIps, " "))
+	entry.machineId = escapeRawText(message.MachineId)
+	entry.note = escapeRawText(message.Note)
+	labels := []string{}
+	for _, label := range message.Labels {
+		// Semicolons separate the labels, so they can't be in them
+		labels = append(labels, strings.ReplaceAll(label.Key, ";", "") + "=" + strings.ReplaceAll(label.Value, ";", ""))
+	}
+	entry.labels = escapeRawText(strings.Join(labels, ";"))
+	entry.signature = escapeRawText(message.Signature)
+	entry.elevated = escapeRawText(message.Elevated)
+	entry.dnsTime = int(message.DnsTime)
+	entry.tlsVersion = escapeRawText(message.TlsVersion)
+	entry.tlsCipher = escapeRawText(message.TlsCipher)
+	return entry
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Sink_GRPC(t *testing.T) {
+	// Precondition: a collector is running, writing to its own log, and stops after one stream
+	collectorLogPath := t.TempDir() + "/collector-log.csv"
+	collectorLog, err := newCSVFileSink(collectorLogPath, false)
+	assert.Nil(t, err)
+	port := getFreeTestPort(t, "tcp")
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+	done := make(chan *CollectResponse)
+	go func() {
+		response, _ := runCollector(collectorLog, newActivityLogEntry("collect", nil), addr, 1)
+		collectorLog.Close()
+		done <- response
+	}()
+	dialTestListener(t, "tcp", port).Close()
+
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-sink=csv", "-sink=grpc:" + addr, "-run-id=streamed", "-labels=phase=2", "create", t.TempDir() + "/test.txt"}
+	callMain(args)
+	assertLogFileContains(t, logFilePath, ",created,")
+
+	// The entry should arrive as it was logged
+	response := <-done
+	assert.Equal(t, "stopped", response.status)
+	assert.Equal(t, 1, response.streams)
+	assert.Equal(t, 1, response.received)
+	assertLogFileContains(t, collectorLogPath, ",created,")
+	assertLogFileContains(t, collectorLogPath, ",streamed,1,")
+	assertLogFileContains(t, collectorLogPath, ",phase=2")
+}
+
+func TestMain_Sink_GRPCUnreachable(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	port := getFreeTestPort(t, "tcp")
+
+	// Forwarding is best-effort, so the run still completes
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-sink=csv", "-sink=grpc:127.0.0.1:" + strconv.Itoa(port), "create", t.TempDir() + "/test.txt"}
+	_, diagnostics := callMainWithDiagnostics(args)
+	assert.Contains(t, diagnostics, "level=WARN msg=\"Unable to forward log entry to gRPC collector\"")
+	assertLogFileContains(t, logFilePath, ",created,")
+}
+
+func TestMain_Sink_GRPCWithoutAddr(t *testing.T) {
+	args := []string{"./noisemaker", "-sink=grpc", "create", t.TempDir() + "/test.txt"}
+	assertMainPanicsWithMessage(t, args, "invalid sink 'grpc' (must be grpc:<addr>)")
+}
+
+func TestEntryToProto_RoundTrip(t *testing.T) {
+	entry := &ActivityLogEntry{
+		timestamp: "2024-11-05T16:20:14Z",
+		activity: "send",
+		processCmd: "send POST a\\,b",
+		processId: 4242,
+		status: "sent",
+		destPort: 443,
+		bytesSent: 1024,
+		details: "line one\\nline two",
+		runId: "run-1",
+		seq: 7,
+		hostIPs: "10.0.0.5 fe80::1",
+		labels: "phase=2;team=red",
+		signature: "hmac-sha256:10:AAAA",
+		elevated: "true",
+		dnsTime: 12,
+		tlsVersion: "TLS 1.3",
+		tlsCipher: "TLS_AES_128_GCM_SHA256",
+	}
+	message := entryToProto(entry)
+	assert.Equal(t, "send POST a,b", message.ProcessCmd)
+	assert.Equal(t, "line one\nline two", message.Details)
+	assert.Equal(t, []string{"10.0.0.5", "fe80::1"}, message.HostIps)
+	assert.Len(t, message.Labels, 2)
+	assert.Equal(t, "team", message.Labels[1].Key)
+	assert.Equal(t, int64(1730823614), message.Timestamp.Seconds)
+
+	roundTripped := entryFromProto(message)
+	assert.Equal(t, serializeToCSV(entry)[1:], serializeToCSV(roundTripped)[1:])
+	assert.Equal(t, int64(1730823614), entryToProto(roundTripped).Timestamp.Seconds)
+
+	// The signature still covers it, even with the timestamp in the collector's time zone
+	assert.Equal(t, getSignedText(entry, SchemaVersion, ""), getSignedText(roundTripped, SchemaVersion, ""))
+}
+
+func TestMain_Collect_InvalidMaxReceives(t *testing.T) {
+	args := []string{"./noisemaker", "-max-receives=-1", "collect"}
+	assertMainPanicsWithMessage(t, args, "invalid max-receives for collect: -1")
+}
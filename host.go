@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// Identifying details of the host we're running on, recorded on every log entry
+type HostInfo struct {
+	hostname			string
+	hostIPs				string		// space-separated, since there may be several
+	machineId			string
+	elevated			bool		// running as root, or as an elevated administrator on Windows
+}
+
+// Determines the host's name, primary IP addresses, and stable machine identifier (any of which may be blank, if unavailable), and
+// whether we're running elevated
+func getHostInfo() *HostInfo {
+	info := new(HostInfo)
+	hostname, err := os.Hostname()
+	if err == nil {
+		info.hostname = hostname
+	}
+	info.hostIPs = strings.Join(getHostIPs(), " ")
+	info.machineId = strings.TrimSpace(getMachineId())
+	info.elevated = isElevated()
+	return info
+}
+
+// Whether the process is running elevated (replaced in tests, so privileged steps can be run, or refused, whoever runs them)
+var isElevated = isProcessElevated
+
+// Gets the host's IP addresses, skipping loopback and link-local ones (and the IPv4 ones first)
+func getHostIPs() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	ipv4s := []string{}
+	ipv6s := []string{}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() || ipNet.IP.IsLinkLocalMulticast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			ipv4s = append(ipv4s, ipNet.IP.String())
+		} else {
+			ipv6s = append(ipv6s, ipNet.IP.String())
+		}
+	}
+	return append(ipv4s, ipv6s...)
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+)
+
+// Gets the systemd/D-Bus machine ID on Linux (and the BSDs), or the hardware UUID on Mac
+func getMachineId() string {
+	if runtime.GOOS == "darwin" {
+		output, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err != nil {
+			return ""
+		}
+		match := regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`).FindSubmatch(output)
+		if match == nil {
+			return ""
+		}
+		return string(match[1])
+	}
+
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id", "/etc/hostid"} {
+		contents, err := os.ReadFile(path)
+		if err == nil && len(contents) > 0 {
+			return string(contents)
+		}
+	}
+	return ""
+}
+
+// Whether the process is running as root (or setuid root)
+func isProcessElevated() bool {
+	return os.Geteuid() == 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_HostInfo(t *testing.T) {
+	dir := createTestStagingDir(t)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	hostname, err := os.Hostname()
+	assert.Nil(t, err)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=hosts", "exfil", dir, "POST", "127.0.0.1", "1"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.hostname, hostname)
+
+	// Every entry should be stamped with the same host details
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	for seq := 1; seq <= 4; seq++ {
+		assert.Contains(t, contents, fmt.Sprintf(",hosts,%d,%s,%s,%s,", seq, hostname, activityLogEntry.hostIPs, activityLogEntry.machineId))
+	}
+}
+
+func TestMain_HostInfo_Elevated(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	defer func() { isElevated = isProcessElevated }()
+
+	// Every entry records whether the process was elevated (the last column)
+	isElevated = func() bool { return true }
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "delete", "/tmp/noisemaker-missing.txt"})
+	assert.Equal(t, activityLogEntry.elevated, "true")
+	assertLogFileContains(t, logFilePath, ",true,0,,\n")
+	isElevated = func() bool { return false }
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "delete", "/tmp/noisemaker-missing.txt"})
+	assert.Equal(t, activityLogEntry.elevated, "false")
+	assertLogFileContains(t, logFilePath, ",false,0,,\n")
+}
+
+func TestGetHostIPs(t *testing.T) {
+	for _, ip := range getHostIPs() {
+		parsed := net.ParseIP(ip)
+		assert.NotNil(t, parsed)
+		assert.False(t, parsed.IsLoopback())
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// Gets the machine GUID Windows generates at install time
+func getMachineId() string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE | registry.WOW64_64KEY)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	machineGuid, _, err := key.GetStringValue("MachineGuid")
+	if err != nil {
+		return ""
+	}
+	return machineGuid
+}
+
+// Whether the process's token is elevated (run as administrator, past UAC), rather than just owned by a member of the Administrators group
+func isProcessElevated() bool {
+	return windows.GetCurrentProcessToken().IsElevated()
+}
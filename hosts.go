@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// The hosts file the hosts command adds entries to (replaced in tests)
+var hostsFilePath = getHostsFilePath(runtime.GOOS)
+
+// The address and hostname the hosts command adds an entry for, by default
+const DefaultHostsEntryIP = "127.0.0.1"
+const DefaultHostsEntryName = "noisemaker-hoststamper.example"
+
+// The comment marking the lines the hosts command adds, so a line it didn't add is never removed
+const HostsEntryComment = "# added by noisemaker"
+
+// Response data from hosts action
+type HostsResponse struct {
+	line				string		// the line added (or removed), without its line ending
+	status				string
+}
+
+// Gets the path of the OS's hosts file
+func getHostsFilePath(goos string) string {
+	if goos == "windows" {
+		systemRoot := os.Getenv("SystemRoot")
+		if systemRoot == "" {
+			systemRoot = `C:\Windows`
+		}
+		return systemRoot + `\System32\drivers\etc\hosts`
+	}
+	return "/etc/hosts"
+}
+
+// The longest hostname a hosts entry can be added for, and the longest of its labels (as RFC 1123 has them)
+const MaxHostsEntryName = 253
+const MaxHostsEntryLabel = 63
+
+// Checks that the hostname is a single RFC 1123 name (dot-separated labels of letters, digits, and hyphens, none starting or ending
+// with a hyphen), so it can't add a second name, a comment, or another line to the hosts file
+func checkHostsEntryName(hostname string) error {
+	if hostname == "" || len(hostname) > MaxHostsEntryName {
+		return fmt.Errorf("invalid hostname %q (must be 1 to %d characters)", hostname, MaxHostsEntryName)
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if label == "" || len(label) > MaxHostsEntryLabel {
+			return fmt.Errorf("invalid hostname %q (each label must be 1 to %d characters)", hostname, MaxHostsEntryLabel)
+		}
+		if label[0] == '-' || label[len(label) - 1] == '-' {
+			return fmt.Errorf("invalid hostname %q (a label can't start or end with a hyphen)", hostname)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid hostname %q (must be only letters, digits, hyphens, and dots)", hostname)
+			}
+		}
+	}
+	return nil
+}
+
+// Gets the line that points the hostname at the address
+func getHostsEntry(ip string, hostname string) string {
+	return ip + "\t" + hostname + " " + HostsEntryComment
+}
+
+// Appends a line to the hosts file pointing the hostname at the address (as DNS redirection through the hosts file does), unless the
+// same line's already there
+func addHostsEntry(path string, ip string, hostname string) (*HostsResponse, error) {
+	response := &HostsResponse{line: getHostsEntry(ip, hostname), status: "error"}
+	if err := checkHostsEntryName(hostname); err != nil {
+		return response, err
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	lines, newline := splitHostsFile(string(contents))
+	if containsString(lines, response.line) {
+		fmt.Printf("Hosts file %s already has the line: %s\n", path, response.line)
+		response.status = "exists"
+		return response, fmt.Errorf("hosts_entry_exists: %s", response.line)
+	}
+
+	appended := response.line + newline
+	if len(contents) > 0 && !strings.HasSuffix(string(contents), "\n") {
+		appended = newline + appended
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY | os.O_APPEND, 0)
+	if err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	defer f.Close()
+	if _, err = f.WriteString(appended); err != nil {
+		response.status = "error"
+		return response, err
+	}
+	fmt.Printf("Added line to hosts file %s: %s\n", path, response.line)
+	response.status = "added"
+	return response, nil
+}
+
+// Removes the line added by addHostsEntry for the hostname and address from the hosts file, leaving the rest of the file as it was
+func removeHostsEntry(path string, ip string, hostname string) (*HostsResponse, error) {
+	response := &HostsResponse{line: getHostsEntry(ip, hostname)}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	lines, newline := splitHostsFile(string(contents))
+	kept := []string{}
+	for _, line := range lines {
+		if line != response.line {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == len(lines) {
+		fmt.Printf("Hosts file %s doesn't have the line: %s\n", path, response.line)
+		response.status = "not_found"
+		return response, fmt.Errorf("hosts_entry_not_found: %s", response.line)
+	}
+
+	// (rewritten in place, so the file keeps its owner and permissions)
+	updated := strings.Join(kept, newline)
+	if len(kept) > 0 {
+		updated += newline
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	if err = os.WriteFile(path, []byte(updated), info.Mode().Perm()); err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	fmt.Printf("Removed line from hosts file %s: %s\n", path, response.line)
+	response.status = "removed"
+	return response, nil
+}
+
+// Splits the hosts file's contents into lines, and gets the line ending it uses (\r\n on Windows, usually)
+func splitHostsFile(contents string) ([]string, string) {
+	newline := "\n"
+	if strings.Contains(contents, "\r\n") {
+		newline = "\r\n"
+	}
+	contents = strings.TrimSuffix(contents, "\n")
+	if contents == "" {
+		return []string{}, newline
+	}
+	lines := strings.Split(contents, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, newline
+}
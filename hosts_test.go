@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Points the hosts command at a temporary hosts file with the given contents, returning its path
+func useTestHostsFile(t *testing.T, contents string) string {
+	path := t.TempDir() + "/hosts"
+	assert.Nil(t, os.WriteFile(path, []byte(contents), 0644))
+	defaultPath := hostsFilePath
+	hostsFilePath = path
+	t.Cleanup(func() { hostsFilePath = defaultPath })
+	return path
+}
+
+func TestMain_Hosts(t *testing.T) {
+	path := useTestHostsFile(t, "127.0.0.1\tlocalhost\n::1\tlocalhost")
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	line := "10.66.0.1\tlogin.example.com # added by noisemaker"
+
+	// The line's appended (after a newline, since the file didn't end with one), and recorded as an artifact
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-allow-privileged", "hosts", "add", "10.66.0.1", "login.example.com"})
+	assert.Equal(t, activityLogEntry.activity, "hosts")
+	assert.Equal(t, activityLogEntry.path, path)
+	assert.Equal(t, activityLogEntry.method, "add")
+	assert.Equal(t, activityLogEntry.status, "added")
+	assert.Equal(t, activityLogEntry.details, line)
+	contents, _ := os.ReadFile(path)
+	assert.Equal(t, "127.0.0.1\tlocalhost\n::1\tlocalhost\n" + line + "\n", string(contents))
+	artifacts, err := readArtifactManifest(dir + "/noisemaker-artifacts.jsonl", "")
+	assert.Nil(t, err)
+	assert.Len(t, artifacts, 1)
+	assert.Equal(t, "hosts-entry", artifacts[0].Kind)
+	assert.Equal(t, []string{"hosts", "remove", "10.66.0.1", "login.example.com"}, artifacts[0].Undo)
+
+	// It's only added once
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-allow-privileged", "hosts", "add", "10.66.0.1", "login.example.com"})
+	assert.Equal(t, activityLogEntry.status, "exists")
+
+	// Removing it leaves the rest of the file as it was, and then there's nothing left to remove
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-allow-privileged", "hosts", "remove", "10.66.0.1", "login.example.com"})
+	assert.Equal(t, activityLogEntry.status, "removed")
+	assert.Equal(t, activityLogEntry.details, line)
+	contents, _ = os.ReadFile(path)
+	assert.Equal(t, "127.0.0.1\tlocalhost\n::1\tlocalhost\n", string(contents))
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-allow-privileged", "hosts", "remove", "10.66.0.1", "login.example.com"})
+	assert.Equal(t, activityLogEntry.status, "not_found")
+}
+
+func TestMain_Hosts_Disabled(t *testing.T) {
+	path := useTestHostsFile(t, "127.0.0.1\tlocalhost\n")
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "hosts", "add"})
+	assert.Contains(t, output, "Command hosts changes the hosts file, and is disabled without -allow-privileged!")
+	assert.Equal(t, activityLogEntry.status, "disabled")
+	contents, _ := os.ReadFile(path)
+	assert.Equal(t, "127.0.0.1\tlocalhost\n", string(contents))
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "hosts", "list"}, "invalid hosts: must be hosts (add|remove) [ip] [hostname]! Args: [list]")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "hosts", "add", "example.com"}, "invalid hosts: invalid ip 'example.com'")
+
+	// A hostname that isn't a single name is refused before anything's written (even with -allow-privileged)
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-allow-privileged", "hosts", "add", "10.66.0.1", "login.example.com\n10.66.0.2 bank.example.com"}, "invalid hosts: invalid hostname \"login.example.com\\n10.66.0.2 bank.example.com\" (must be only letters, digits, hyphens, and dots)")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-allow-privileged", "hosts", "add", "10.66.0.1", "login.example.com #"}, "invalid hosts: invalid hostname")
+	contents, _ = os.ReadFile(path)
+	assert.Equal(t, "127.0.0.1\tlocalhost\n", string(contents))
+}
+
+func TestCheckHostsEntryName(t *testing.T) {
+	for _, hostname := range []string{"login.example.com", "localhost", "a", "xn--bcher-kva.example", "10-66-0-1.example", "A1.B2", strings.Repeat("a", 63) + ".example"} {
+		assert.Nil(t, checkHostsEntryName(hostname), hostname)
+	}
+	for hostname, message := range map[string]string{
+		"": "(must be 1 to 253 characters)",
+		strings.Repeat("a.", 127) + "a": "(must be 1 to 253 characters)",
+		strings.Repeat("a", 64) + ".example": "(each label must be 1 to 63 characters)",
+		"login..example.com": "(each label must be 1 to 63 characters)",
+		".example.com": "(each label must be 1 to 63 characters)",
+		"example.com.": "(each label must be 1 to 63 characters)",
+		"-login.example.com": "(a label can't start or end with a hyphen)",
+		"login-.example.com": "(a label can't start or end with a hyphen)",
+		"login.example.com bank.example.com": "(must be only letters, digits, hyphens, and dots)",
+		"login\texample": "(must be only letters, digits, hyphens, and dots)",
+		"login.example.com\r\n10.66.0.2\tbank.example.com": "(must be only letters, digits, hyphens, and dots)",
+		"login#comment": "(must be only letters, digits, hyphens, and dots)",
+		"login\x00.example": "(must be only letters, digits, hyphens, and dots)",
+		"under_score.example": "(must be only letters, digits, hyphens, and dots)",
+		"bücher.example": "(must be only letters, digits, hyphens, and dots)",
+	} {
+		assert.ErrorContains(t, checkHostsEntryName(hostname), message, hostname)
+	}
+
+	// (and the line's never written for one, whoever calls for it)
+	path := t.TempDir() + "/hosts"
+	os.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0644)
+	response, err := addHostsEntry(path, "10.66.0.1", "a\nb")
+	assert.ErrorContains(t, err, "invalid hostname")
+	assert.Equal(t, "error", response.status)
+	contents, _ := os.ReadFile(path)
+	assert.Equal(t, "127.0.0.1 localhost\n", string(contents))
+}
+
+func TestMain_Scenario_RunHoststamper(t *testing.T) {
+	path := useTestHostsFile(t, "127.0.0.1\tlocalhost\r\n")
+	isElevated = func() bool { return true }
+	defer func() { isElevated = isProcessElevated }()
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-allow-privileged", "scenario", "run", "hoststamper"})
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "2 of 2 steps completed")
+	assertLogFileContains(t, logFilePath, ",added,")
+	assertLogFileContains(t, logFilePath, ",removed,")
+	contents, _ := os.ReadFile(path)
+	assert.Equal(t, "127.0.0.1\tlocalhost\r\n", string(contents))
+}
+
+func TestRemoveHostsEntry_KeepsOtherLines(t *testing.T) {
+	// Only the exact line that was added is removed (not a real entry for the same name), with the file's line endings kept
+	path := t.TempDir() + "/hosts"
+	os.WriteFile(path, []byte("127.0.0.1 localhost\r\n10.66.0.1 login.example.com\r\n10.66.0.1\tlogin.example.com # added by noisemaker\r\n"), 0644)
+	response, err := removeHostsEntry(path, "10.66.0.1", "login.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "removed", response.status)
+	contents, _ := os.ReadFile(path)
+	assert.Equal(t, "127.0.0.1 localhost\r\n10.66.0.1 login.example.com\r\n", string(contents))
+
+	response, err = addHostsEntry(t.TempDir() + "/missing", "10.66.0.1", "login.example.com")
+	assert.Equal(t, "not_found", response.status)
+	assert.NotNil(t, err)
+}
+
+func TestGetHostsFilePath(t *testing.T) {
+	t.Setenv("SystemRoot", `D:\Windows`)
+	assert.Equal(t, `D:\Windows\System32\drivers\etc\hosts`, getHostsFilePath("windows"))
+	assert.Equal(t, "/etc/hosts", getHostsFilePath("linux"))
+	assert.Equal(t, "/etc/hosts", getHostsFilePath("darwin"))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How the network commands' HTTP connections are made and reused, by the HTTP client options (network sensors see the difference
+// between one connection carrying many requests and a new connection for each)
+type HTTPClientOptions struct {
+	dialTimeout			time.Duration
+	tlsHandshakeTimeout	time.Duration
+	responseTimeout		time.Duration		// how long to wait for a response's headers once the request's written (0 for no limit)
+	disableKeepAlives	bool				// whether every request gets a new connection
+	maxIdleConns		int					// the most idle connections kept open to each host, for later requests to reuse
+}
+
+// The HTTP client options' defaults (the same as Go's default transport)
+var DefaultHTTPClientOptions = HTTPClientOptions{dialTimeout: 30 * time.Second, tlsHandshakeTimeout: 10 * time.Second, maxIdleConns: 2}
+
+// The run's HTTP client options
+var httpClientOptions = DefaultHTTPClientOptions
+
+// The HTTP client the run's sends and downloads share, so their connections can be reused (made when it's first needed)
+var sourceHTTPClient *http.Client
+var sourceHTTPClientMutex sync.Mutex
+
+// Checks the HTTP client options
+func parseHTTPClientOptions(dialTimeout time.Duration, tlsHandshakeTimeout time.Duration, responseTimeout time.Duration, disableKeepAlives bool, maxIdleConns int) (HTTPClientOptions, error) {
+	options := HTTPClientOptions{dialTimeout, tlsHandshakeTimeout, responseTimeout, disableKeepAlives, maxIdleConns}
+	for name, timeout := range map[string]time.Duration{"dial-timeout": dialTimeout, "tls-handshake-timeout": tlsHandshakeTimeout, "response-timeout": responseTimeout} {
+		if timeout < 0 {
+			return options, fmt.Errorf("invalid -%s %v (must be 0 or more)", name, timeout)
+		}
+	}
+	if maxIdleConns < 0 {
+		return options, fmt.Errorf("invalid -max-idle-conns %d (must be 0 or more)", maxIdleConns)
+	}
+	return options, nil
+}
+
+// Sets up the transport's connections the way the options say
+func (options HTTPClientOptions) apply(transport *http.Transport) {
+	transport.TLSHandshakeTimeout = options.tlsHandshakeTimeout
+	transport.ResponseHeaderTimeout = options.responseTimeout
+	transport.DisableKeepAlives = options.disableKeepAlives
+	transport.MaxIdleConnsPerHost = options.maxIdleConns
+	if options.maxIdleConns == 0 {
+		// (0 means the default to the transport, and less than 0 none)
+		transport.MaxIdleConnsPerHost = -1
+	}
+	if transport.MaxIdleConns < options.maxIdleConns {
+		transport.MaxIdleConns = options.maxIdleConns
+	}
+}
+
+// Gets the labels the options are recorded with on every entry, where they're changed from the defaults
+func (options HTTPClientOptions) getLabels(labels string) string {
+	if options.disableKeepAlives {
+		labels = addLabel(labels, "keepalives", "disabled")
+	}
+	if options.maxIdleConns != DefaultHTTPClientOptions.maxIdleConns {
+		labels = addLabel(labels, "max-idle-conns", fmt.Sprint(options.maxIdleConns))
+	}
+	return labels
+}
+
+// Starts the run's HTTP client over (so it's made again with the run's options, and source address)
+func resetSourceHTTPClient() {
+	sourceHTTPClientMutex.Lock()
+	defer sourceHTTPClientMutex.Unlock()
+	if sourceHTTPClient != nil {
+		sourceHTTPClient.CloseIdleConnections()
+	}
+	sourceHTTPClient = nil
+}
+
+// Gets the details of how a send's connection was made, with any of the HTTP client options changed from the defaults
+func getConnectionDetails(response *MessageResponse) string {
+	if httpClientOptions == DefaultHTTPClientOptions || response.statusCode == 0 {
+		return ""
+	}
+	if response.reusedConnection {
+		return "reused connection"
+	}
+	return "new connection"
+}
+
+// Records what a send's connection actually did on its entry: the address its destination resolved to (in place of the one it was
+// given, which the path keeps), how long that took, and the TLS it negotiated
+func recordSendConnection(entry *ActivityLogEntry, response *MessageResponse) {
+	if response.destAddr != "" {
+		entry.destAddr = response.destAddr
+	}
+	entry.dnsTime = int(response.dnsDuration.Milliseconds())
+	entry.tlsVersion = escapeRawText(response.tlsVersion)
+	entry.tlsCipher = escapeRawText(response.tlsCipher)
+}
+
+// A connection that counts the bytes written to and read from it, so a send can record what it actually put on the wire (its request
+// line, headers, and body, and for https, the TLS records they went in), rather than the size of its body
+type countingConn struct {
+	net.Conn
+	written				atomic.Int64
+	read				atomic.Int64
+}
+
+func (conn *countingConn) Write(b []byte) (int, error) {
+	n, err := conn.Conn.Write(b)
+	conn.written.Add(int64(n))
+	return n, err
+}
+
+func (conn *countingConn) Read(b []byte) (int, error) {
+	n, err := conn.Conn.Read(b)
+	conn.read.Add(int64(n))
+	return n, err
+}
+
+// Counts the bytes a send's requests put on the wire, and got back, over each of the connections they were made on (ie. a digest
+// challenge's and its answer's), from where each was when the send first got it
+type wireCounter struct {
+	mutex				sync.Mutex
+	conns				map[*countingConn][2]int64
+}
+
+// Starts counting the connection a request got (from when it was opened, if it's new, since its TLS handshake was for this send too)
+func (counter *wireCounter) track(conn net.Conn, reused bool) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	counted, ok := conn.(*countingConn)
+	if !ok {
+		return
+	}
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	if counter.conns == nil {
+		counter.conns = map[*countingConn][2]int64{}
+	}
+	if _, found := counter.conns[counted]; found {
+		return
+	}
+	if reused {
+		counter.conns[counted] = [2]int64{counted.written.Load(), counted.read.Load()}
+	} else {
+		counter.conns[counted] = [2]int64{}
+	}
+}
+
+// Gets how many bytes have been sent and received over the send's connections so far
+func (counter *wireCounter) counts() (int, int) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	var sent, received int64
+	for conn, start := range counter.conns {
+		sent += conn.written.Load() - start[0]
+		received += conn.read.Load() - start[1]
+	}
+	return int(sent), int(received)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts a server that counts the connections its requests come in on
+func newConnectionCountingServer(t *testing.T) (*httptest.Server, func() int) {
+	var mutex sync.Mutex
+	connections := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		connections[r.RemoteAddr] = true
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(connections)
+	}
+}
+
+func TestMain_Send_ConnectionReuse(t *testing.T) {
+	server, countConnections := newConnectionCountingServer(t)
+	_, port := getTestServerHostAndPort(t, server)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// The run's sends share one connection
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-max-idle-conns=4", "beacon", "-count=3", "-sleep=1ms", "GET", "127.0.0.1", port})
+	assert.Equal(t, 1, countConnections())
+	assert.Equal(t, "max-idle-conns=4", activityLogEntry.labels)
+	contents, err := os.ReadFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(string(contents), "new connection"))
+	assert.Equal(t, 2, strings.Count(string(contents), "reused connection"))
+}
+
+func TestMain_Send_DisableKeepAlives(t *testing.T) {
+	server, countConnections := newConnectionCountingServer(t)
+	_, port := getTestServerHostAndPort(t, server)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Every send gets a connection of its own
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-disable-keepalives", "beacon", "-count=3", "-sleep=1ms", "GET", "127.0.0.1", port})
+	assert.Equal(t, 3, countConnections())
+	assert.Equal(t, "keepalives=disabled", activityLogEntry.labels)
+	contents, err := os.ReadFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, strings.Count(string(contents), "new connection"))
+	assert.NotContains(t, string(contents), "reused connection")
+}
+
+func TestMain_Send_ResponseTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	started := time.Now()
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-response-timeout=100ms", "send", "GET", host, port})
+	assert.Less(t, time.Since(started), 3 * time.Second)
+	assert.Equal(t, "error", activityLogEntry.status)
+}
+
+func TestParseHTTPClientOptions(t *testing.T) {
+	options, err := parseHTTPClientOptions(time.Second, 2 * time.Second, 0, true, 0)
+	assert.Nil(t, err)
+	transport := new(http.Transport)
+	options.apply(transport)
+	assert.Equal(t, 2 * time.Second, transport.TLSHandshakeTimeout)
+	assert.True(t, transport.DisableKeepAlives)
+	assert.Equal(t, -1, transport.MaxIdleConnsPerHost)
+
+	_, err = parseHTTPClientOptions(-time.Second, 0, 0, false, 2)
+	assert.ErrorContains(t, err, "invalid -dial-timeout -1s (must be 0 or more)")
+	_, err = parseHTTPClientOptions(0, 0, 0, false, -1)
+	assert.ErrorContains(t, err, "invalid -max-idle-conns -1 (must be 0 or more)")
+}
+
+func TestSendMessage_RecordsConnection(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	_, port := getTestServerHostAndPort(t, server)
+	destPort, err := strconv.Atoi(port)
+	assert.Nil(t, err)
+	resetSourceHTTPClient()
+	defer resetSourceHTTPClient()
+	// (trusting the test server's certificate)
+	sourceHTTPClient = &http.Client{Transport: newSourceTransport(server.Client().Transport.(*http.Transport).TLSClientConfig)}
+
+	response, err := sendMessage("GET", "127.0.0.1", destPort, "https", nil, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "TLS 1.3", response.tlsVersion)
+	assert.NotEmpty(t, response.tlsCipher)
+
+	// The entry records the address that was connected to, in place of the one it was given
+	entry := &ActivityLogEntry{destAddr: "test.example.com"}
+	recordSendConnection(entry, response)
+	assert.Equal(t, "127.0.0.1", entry.destAddr)
+	assert.Equal(t, "TLS 1.3", entry.tlsVersion)
+	assert.Equal(t, response.tlsCipher, entry.tlsCipher)
+
+	// A reused connection still records the TLS it negotiated
+	response, err = sendMessage("GET", "127.0.0.1", destPort, "https", nil, "")
+	assert.Nil(t, err)
+	assert.True(t, response.reusedConnection)
+	assert.Equal(t, "TLS 1.3", response.tlsVersion)
+	assert.Zero(t, response.dnsDuration)
+}
+
+func TestMain_Send_WireBytes(t *testing.T) {
+	// A server that counts the bytes its requests come in as, and answers with a response of a known size
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	responseText := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok"
+	requestSizes := make(chan int, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			req, err := http.ReadRequest(reader)
+			if err == nil {
+				io.Copy(io.Discard, req.Body)
+				dump, _ := httputil.DumpRequest(req, false)
+				requestSizes <- len(dump) + int(req.ContentLength)
+			}
+			conn.Write([]byte(responseText))
+			conn.Close()
+		}
+	}()
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	// A GET counts its request line and headers, though it has no body
+	callMain([]string{"./noisemaker", "-sink=stdout", "send", "GET", "127.0.0.1", port})
+	assert.Equal(t, "sent", activityLogEntry.status)
+	assert.Equal(t, <-requestSizes, activityLogEntry.bytesSent)
+	assert.Equal(t, len(responseText), activityLogEntry.bytesReceived)
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "send", "POST", "127.0.0.1", port, "http", "hello"})
+	assert.Equal(t, <-requestSizes, activityLogEntry.bytesSent)
+	assert.Equal(t, len(responseText), activityLogEntry.bytesReceived)
+}
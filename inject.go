@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The injection APIs inject can use: a thread started in the target (CreateRemoteThread), or a call queued on its main thread before
+// it's resumed (QueueUserAPC, the "early bird" variant)
+var InjectMethods = []string{"CreateRemoteThread", "QueueUserAPC"}
+
+// What's written into the target: a harmless string, which the injected call (strlen) just measures, so nothing executable's written
+const InjectMarker = "noisemaker inject"
+
+// How long to wait for the injected call to run (and the target to exit), before it's terminated
+const InjectTimeout = 10 * time.Second
+
+// Options for the inject command
+type InjectOptions struct {
+	method				string
+}
+
+// Response data from inject action
+type InjectResponse struct {
+	path				string		// the target's executable
+	sourcePid			int
+	targetPid			int
+	address				uintptr		// where the marker was written, in the target
+	bytesWritten		int
+	exitCode			int			// what the injected call returned (the marker's length), with CreateRemoteThread
+	status				string
+}
+
+// Parses inject's arguments: [-method=CreateRemoteThread|QueueUserAPC]
+func parseInjectOptions(args []string) (*InjectOptions, error) {
+	flags := flag.NewFlagSet("inject", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	method := flags.String("method", "CreateRemoteThread", "the injection API to use")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inject: %v", err)
+	}
+	if !containsString(InjectMethods, *method) {
+		return nil, fmt.Errorf("invalid inject: invalid -method %s (must be one of %v)", *method, InjectMethods)
+	}
+	return &InjectOptions{method: *method}, nil
+}
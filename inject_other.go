@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// Process injection (with CreateRemoteThread or QueueUserAPC) is Windows-only
+func injectIntoChild(method string) (*InjectResponse, error) {
+	return &InjectResponse{sourcePid: os.Getpid()}, fmt.Errorf("%w: inject on %s", errors.ErrUnsupported, runtime.GOOS)
+}
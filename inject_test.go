@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Inject(t *testing.T) {
+	callMain([]string{"./noisemaker", "-sink=stdout", "inject"})
+	assert.Equal(t, activityLogEntry.activity, "inject")
+	assert.Equal(t, activityLogEntry.method, "CreateRemoteThread")
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, activityLogEntry.status, "unsupported")
+		assert.Equal(t, activityLogEntry.details, fmt.Sprintf("source pid %d\\, target pid 0\\, 0 bytes written at 0x0\\, strlen returned 0", os.Getpid()))
+		return
+	}
+
+	// The child runs strlen on the marker, on the thread started in it
+	assert.Equal(t, activityLogEntry.status, "injected")
+	assert.NotZero(t, activityLogEntry.processId)
+	assert.Equal(t, activityLogEntry.bytesSent, len(InjectMarker) + 1)
+	assert.Contains(t, activityLogEntry.details, fmt.Sprintf("strlen returned %d", len(InjectMarker)))
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "inject", "-method=QueueUserAPC"})
+	assert.Equal(t, activityLogEntry.method, "QueueUserAPC")
+	assert.Equal(t, activityLogEntry.status, "queued")
+}
+
+func TestParseInjectOptions(t *testing.T) {
+	options, err := parseInjectOptions([]string{"-method=QueueUserAPC"})
+	assert.Nil(t, err)
+	assert.Equal(t, &InjectOptions{method: "QueueUserAPC"}, options)
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "inject", "-method=SetWindowsHookEx"}, "invalid inject: invalid -method SetWindowsHookEx (must be one of [CreateRemoteThread QueueUserAPC])")
+}
@@ -0,0 +1,96 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// (VirtualAllocEx, VirtualFreeEx, CreateRemoteThread, GetExitCodeThread, and QueueUserAPC aren't wrapped by x/sys/windows; strlen's
+// the injected call, as ntdll's mapped at the same address in every process, from the moment it's created)
+var procVirtualAllocEx = kernel32.NewProc("VirtualAllocEx")
+var procVirtualFreeEx = kernel32.NewProc("VirtualFreeEx")
+var procCreateRemoteThread = kernel32.NewProc("CreateRemoteThread")
+var procGetExitCodeThread = kernel32.NewProc("GetExitCodeThread")
+var procQueueUserAPC = kernel32.NewProc("QueueUserAPC")
+var ntdll = windows.NewLazySystemDLL("ntdll.dll")
+var procStrlen = ntdll.NewProc("strlen")
+
+// Starts a cooperating child (noisemaker itself, suspended, so none of its own code runs first), writes the marker into it, and has
+// it run strlen on the marker with the injection API: a thread started at it (whose exit code is checked), or a call queued on its
+// main thread, which runs as it's resumed. Only ever the child's injected into, and it's terminated afterwards.
+func injectIntoChild(method string) (*InjectResponse, error) {
+	response := &InjectResponse{sourcePid: os.Getpid()}
+	path, err := os.Executable()
+	if err != nil {
+		return response, err
+	}
+	response.path = path
+	if err = procStrlen.Find(); err != nil {
+		return response, err
+	}
+
+	// Start the child...
+	commandLine, err := windows.UTF16PtrFromString(windows.ComposeCommandLine([]string{path, "-sink=stdout", "help"}))
+	if err != nil {
+		return response, err
+	}
+	startup := &windows.StartupInfo{Cb: uint32(unsafe.Sizeof(windows.StartupInfo{}))}
+	info := new(windows.ProcessInformation)
+	err = windows.CreateProcess(nil, commandLine, nil, nil, false, windows.CREATE_SUSPENDED | windows.CREATE_NO_WINDOW, nil, nil, startup, info)
+	if err != nil {
+		return response, err
+	}
+	defer windows.CloseHandle(info.Process)
+	defer windows.CloseHandle(info.Thread)
+	defer windows.TerminateProcess(info.Process, 0)
+	response.targetPid = int(info.ProcessId)
+	fmt.Printf("Started %s (pid %d), suspended, to inject into...\n", path, response.targetPid)
+
+	// ...write the marker into it...
+	marker := append([]byte(InjectMarker), 0)
+	address, _, err := procVirtualAllocEx.Call(uintptr(info.Process), 0, uintptr(len(marker)), windows.MEM_COMMIT | windows.MEM_RESERVE, windows.PAGE_READWRITE)
+	if address == 0 {
+		return response, fmt.Errorf("VirtualAllocEx: %w", err)
+	}
+	defer procVirtualFreeEx.Call(uintptr(info.Process), address, 0, windows.MEM_RELEASE)
+	var written uintptr
+	if err = windows.WriteProcessMemory(info.Process, address, &marker[0], uintptr(len(marker)), &written); err != nil {
+		return response, fmt.Errorf("WriteProcessMemory: %w", err)
+	}
+	response.address = address
+	response.bytesWritten = int(written)
+
+	// ...and have it run strlen on it
+	switch method {
+	case "CreateRemoteThread":
+		thread, _, err := procCreateRemoteThread.Call(uintptr(info.Process), 0, 0, procStrlen.Addr(), address, 0, 0)
+		if thread == 0 {
+			return response, fmt.Errorf("CreateRemoteThread: %w", err)
+		}
+		defer windows.CloseHandle(windows.Handle(thread))
+		if event, err := windows.WaitForSingleObject(windows.Handle(thread), uint32(InjectTimeout.Milliseconds())); event != windows.WAIT_OBJECT_0 {
+			response.status = "timeout"
+			return response, fmt.Errorf("the remote thread didn't finish in %v: %v", InjectTimeout, err)
+		}
+		var exitCode uint32
+		procGetExitCodeThread.Call(thread, uintptr(unsafe.Pointer(&exitCode)))
+		response.exitCode = int(exitCode)
+		response.status = "injected"
+	case "QueueUserAPC":
+		result, _, err := procQueueUserAPC.Call(procStrlen.Addr(), uintptr(info.Thread), address)
+		if result == 0 {
+			return response, fmt.Errorf("QueueUserAPC: %w", err)
+		}
+		if _, err := windows.ResumeThread(info.Thread); err != nil {
+			return response, fmt.Errorf("ResumeThread: %w", err)
+		}
+		windows.WaitForSingleObject(info.Process, uint32(InjectTimeout.Milliseconds()))
+		response.status = "queued"
+	}
+	return response, nil
+}
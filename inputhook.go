@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+// How long inputhook keeps its hook registered, by default
+const DefaultInputHookDuration = 2 * time.Second
+
+// Options for the inputhook command
+type InputHookOptions struct {
+	duration			time.Duration
+}
+
+// Response data from inputhook action
+type InputHookResponse struct {
+	api					string		// the input-monitoring API the hook was registered with
+	duration			time.Duration	// how long it was actually registered for
+	status				string
+}
+
+// Parses inputhook's arguments: [-duration=(duration)]
+func parseInputHookOptions(args []string) (*InputHookOptions, error) {
+	flags := flag.NewFlagSet("inputhook", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	duration := flags.Duration("duration", DefaultInputHookDuration, "how long to keep the hook registered")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inputhook: %v", err)
+	}
+	if *duration <= 0 || *duration > time.Minute {
+		return nil, fmt.Errorf("invalid inputhook: invalid -duration %v (must be more than 0, and at most 1m)", *duration)
+	}
+	return &InputHookOptions{duration: *duration}, nil
+}
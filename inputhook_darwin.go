@@ -0,0 +1,47 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -framework ApplicationServices
+#include <ApplicationServices/ApplicationServices.h>
+
+// Passes every event straight on without looking at it
+static CGEventRef noisemakerTapCallback(CGEventTapProxy proxy, CGEventType type, CGEventRef event, void *info) {
+	return event;
+}
+
+// Creates a listen-only tap on the session's key presses (it's NULL without Input Monitoring access)
+static CFMachPortRef noisemakerCreateKeyTap(void) {
+	return CGEventTapCreate(kCGSessionEventTap, kCGHeadInsertEventTap, kCGEventTapOptionListenOnly, CGEventMaskBit(kCGEventKeyDown), noisemakerTapCallback, NULL);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Creates and enables a listen-only event tap on key presses (CGEventTapCreate, as keyloggers do) for the duration, then disables and
+// releases it. It's never added to a run loop, so no events are ever delivered to it, and nothing's recorded.
+func hookInput(duration time.Duration) (*InputHookResponse, error) {
+	response := &InputHookResponse{api: "CGEventTapCreate(kCGEventKeyDown)"}
+	fmt.Printf("Creating a key press event tap for %v...\n", duration)
+	tap := C.noisemakerCreateKeyTap()
+	if tap == 0 {
+		response.status = "no_access"
+		return response, fmt.Errorf("CGEventTapCreate: %w (noisemaker needs Input Monitoring access)", os.ErrPermission)
+	}
+
+	start := time.Now()
+	C.CGEventTapEnable(tap, true)
+	time.Sleep(duration)
+	C.CGEventTapEnable(tap, false)
+	C.CFMachPortInvalidate(tap)
+	C.CFRelease(C.CFTypeRef(tap))
+	response.duration = time.Since(start)
+	response.status = "hooked"
+	return response, nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows && (!darwin || !cgo)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// Input-monitoring hooks are registered with SetWindowsHookEx on Windows and CGEventTapCreate on Mac (which needs cgo)
+func hookInput(duration time.Duration) (*InputHookResponse, error) {
+	if runtime.GOOS == "darwin" {
+		return &InputHookResponse{status: "unsupported"}, fmt.Errorf("%w: inputhook needs noisemaker to be built with cgo (CGO_ENABLED=1)", errors.ErrUnsupported)
+	}
+	return &InputHookResponse{status: "unsupported"}, fmt.Errorf("%w: inputhook on %s", errors.ErrUnsupported, runtime.GOOS)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_InputHook(t *testing.T) {
+	callMain([]string{"./noisemaker", "-sink=stdout", "inputhook", "-duration=50ms"})
+	assert.Equal(t, activityLogEntry.activity, "inputhook")
+	switch runtime.GOOS {
+	case "windows":
+		assert.Equal(t, activityLogEntry.method, "SetWindowsHookEx(WH_KEYBOARD_LL)")
+		assert.Equal(t, activityLogEntry.status, "hooked")
+	case "darwin":
+		// (without Input Monitoring access, or cgo, the tap isn't created)
+		assert.Contains(t, []string{"hooked", "no_access", "unsupported"}, activityLogEntry.status)
+	default:
+		assert.Equal(t, activityLogEntry.status, "unsupported")
+		assert.Equal(t, activityLogEntry.details, "registered for 0ms")
+	}
+}
+
+func TestParseInputHookOptions(t *testing.T) {
+	options, err := parseInputHookOptions([]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, &InputHookOptions{duration: DefaultInputHookDuration}, options)
+	options, err = parseInputHookOptions([]string{"-duration=500ms"})
+	assert.Nil(t, err)
+	assert.Equal(t, 500 * time.Millisecond, options.duration)
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "inputhook", "-duration=1h"}, "invalid inputhook: invalid -duration 1h0m0s (must be more than 0, and at most 1m)")
+}
@@ -0,0 +1,84 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// (the hook functions and PeekMessageW aren't wrapped by x/sys/windows)
+var user32 = windows.NewLazySystemDLL("user32.dll")
+var procSetWindowsHookExW = user32.NewProc("SetWindowsHookExW")
+var procUnhookWindowsHookEx = user32.NewProc("UnhookWindowsHookEx")
+var procCallNextHookEx = user32.NewProc("CallNextHookEx")
+var procPeekMessageW = user32.NewProc("PeekMessageW")
+
+const (
+	whKeyboardLL		= 13
+	pmRemove			= 0x1
+)
+
+// The MSG PeekMessageW fills in
+type windowsMessage struct {
+	hwnd				uintptr
+	message				uint32
+	wParam				uintptr
+	lParam				uintptr
+	time				uint32
+	pt					struct{ x, y int32 }
+	lPrivate			uint32
+}
+
+// Registers a low-level keyboard hook (SetWindowsHookEx with WH_KEYBOARD_LL, as keyloggers do) for the duration, then unregisters it.
+// The hook passes every keystroke straight on without looking at it, so nothing's recorded.
+func hookInput(duration time.Duration) (*InputHookResponse, error) {
+	response := &InputHookResponse{api: "SetWindowsHookEx(WH_KEYBOARD_LL)"}
+
+	// (a low-level hook's called on the thread that registered it, from its message loop)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	callback := windows.NewCallback(func(code uintptr, wParam uintptr, lParam uintptr) uintptr {
+		result, _, _ := procCallNextHookEx.Call(0, code, wParam, lParam)
+		return result
+	})
+	var module windows.Handle
+	if err := windows.GetModuleHandleEx(0, nil, &module); err != nil {
+		response.status = "error"
+		return response, err
+	}
+	fmt.Printf("Registering a low-level keyboard hook for %v...\n", duration)
+	hook, _, err := procSetWindowsHookExW.Call(whKeyboardLL, callback, uintptr(module), 0)
+	if hook == 0 {
+		response.status = "error"
+		if errors.Is(err, syscall.ERROR_ACCESS_DENIED) {
+			response.status = "no_access"
+			err = fmt.Errorf("SetWindowsHookEx: %w", os.ErrPermission)
+		}
+		return response, err
+	}
+
+	// Keep the messages moving (so keystrokes aren't held up waiting on the hook), until it's time to unregister it
+	start := time.Now()
+	var message windowsMessage
+	for time.Since(start) < duration {
+		for {
+			result, _, _ := procPeekMessageW.Call(uintptr(unsafe.Pointer(&message)), 0, 0, 0, pmRemove)
+			if result == 0 {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	procUnhookWindowsHookEx.Call(hook)
+	response.duration = time.Since(start)
+	response.status = "hooked"
+	return response, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// The interpreters execute -interpreter can run a script block with
+var Interpreters = []string{"powershell", "cmd", "sh", "bash"}
+
+// Options for the execute command
+type ExecuteOptions struct {
+	interpreter			string		// the interpreter the script block's run with ("" to run the command itself)
+	encoded				bool		// whether the script block's passed Base64-encoded (with -EncodedCommand)
+	preload				string		// the environment variable the process is launched with, to load a library into it ("" for none)
+	preloadLibrary		string		// the library it points at
+	command				string		// the command to run, or the script block
+	args				[]string
+}
+
+// Parses execute's arguments: [-interpreter=name [-encoded]] [-preload=variable [-preload-library=path]] (command) [args...], where with
+// an interpreter, the command and its args are joined with spaces into the script block
+func parseExecuteOptions(args []string) (*ExecuteOptions, error) {
+	flags := flag.NewFlagSet("execute", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	interpreter := flags.String("interpreter", "", "the interpreter to run the script block with")
+	encoded := flags.Bool("encoded", false, "whether to pass the script block Base64-encoded (powershell only)")
+	preload := flags.String("preload", "", "the environment variable to launch the process with, to load a library into it")
+	preloadLibrary := flags.String("preload-library", "", "the library -preload points at")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid execute: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for execute! Args: %v", args)
+	}
+	if *interpreter != "" && !containsString(Interpreters, *interpreter) {
+		return nil, fmt.Errorf("invalid execute: invalid -interpreter %s (must be one of %v)", *interpreter, Interpreters)
+	}
+	if *encoded && *interpreter != "powershell" {
+		return nil, fmt.Errorf("invalid execute: -encoded needs -interpreter=powershell")
+	}
+	if *preload != "" {
+		*preloadLibrary, err = getPreloadLibrary(*preload, *preloadLibrary)
+		if err != nil {
+			return nil, err
+		}
+	} else if *preloadLibrary != "" {
+		return nil, fmt.Errorf("invalid execute: -preload-library needs -preload")
+	}
+	return &ExecuteOptions{interpreter: *interpreter, encoded: *encoded, preload: *preload, preloadLibrary: *preloadLibrary, command: flags.Arg(0), args: flags.Args()[1:]}, nil
+}
+
+// Gets the command line that runs the script block with the interpreter on the given OS, along with the script block's encoded form
+// ("" unless it's encoded)
+func getInterpreterCommand(goos string, interpreter string, script string, encoded bool) (string, []string, string) {
+	switch interpreter {
+	case "powershell":
+		cmd, args := getPowerShellCommand(goos)
+		if encoded {
+			encodedScript := encodePowerShellCommand(script)
+			return cmd, append(args, "-EncodedCommand", encodedScript), encodedScript
+		}
+		return cmd, append(args, "-Command", script), ""
+	case "cmd":
+		return "cmd.exe", []string{"/c", script}, ""
+	default:
+		// sh, bash
+		return interpreter, []string{"-c", script}, ""
+	}
+}
+
+// Gets PowerShell's command line on the given OS (powershell.exe on Windows, and PowerShell 7's pwsh elsewhere), up to what it runs
+func getPowerShellCommand(goos string) (string, []string) {
+	cmd := "pwsh"
+	if goos == "windows" {
+		cmd = "powershell.exe"
+	}
+	return cmd, []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass"}
+}
+
+// Encodes the script block as -EncodedCommand takes it: Base64 of its UTF-16LE
+func encodePowerShellCommand(script string) string {
+	units := utf16.Encode([]rune(script))
+	encoded := make([]byte, len(units) * 2)
+	for i, unit := range units {
+		encoded[i * 2] = byte(unit)
+		encoded[i * 2 + 1] = byte(unit >> 8)
+	}
+	return base64.StdEncoding.EncodeToString(encoded)
+}
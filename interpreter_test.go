@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Execute_Interpreter(t *testing.T) {
+	// The script block's words are joined into one, and run by the interpreter
+	callMain([]string{"./noisemaker", "-sink=stdout", "execute", "-interpreter=sh", "exit", "3"})
+	assert.Equal(t, activityLogEntry.activity, "execute")
+	assert.Equal(t, activityLogEntry.processCmd, "sh -c exit 3")
+	assert.Equal(t, activityLogEntry.method, "sh")
+	assert.Equal(t, activityLogEntry.details, "sh script block: exit 3")
+	assert.Equal(t, activityLogEntry.status, "exit status 3")
+
+	// Without one, the flags after the command are its own
+	callMain([]string{"./noisemaker", "-sink=stdout", "execute", "sh", "-c", "exit 0"})
+	assert.Equal(t, activityLogEntry.processCmd, "sh -c exit 0")
+	assert.Equal(t, activityLogEntry.method, "")
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+}
+
+func TestParseExecuteOptions(t *testing.T) {
+	options, err := parseExecuteOptions([]string{"-interpreter=powershell", "-encoded", "Get-Process", "|", "Select-Object", "-First", "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, &ExecuteOptions{interpreter: "powershell", encoded: true, command: "Get-Process", args: []string{"|", "Select-Object", "-First", "1"}}, options)
+
+	_, err = parseExecuteOptions([]string{"-interpreter=python", "print(1)"})
+	assert.ErrorContains(t, err, "invalid execute: invalid -interpreter python (must be one of [powershell cmd sh bash])")
+	_, err = parseExecuteOptions([]string{"-interpreter=sh", "-encoded", "id"})
+	assert.ErrorContains(t, err, "invalid execute: -encoded needs -interpreter=powershell")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "execute", "-interpreter=sh"}, "not enough arguments for execute! Args: [-interpreter=sh]")
+}
+
+func TestGetInterpreterCommand(t *testing.T) {
+	script := "Get-Process | Select-Object -First 1"
+	encoded := "RwBlAHQALQBQAHIAbwBjAGUAcwBzACAAfAAgAFMAZQBsAGUAYwB0AC0ATwBiAGoAZQBjAHQAIAAtAEYAaQByAHMAdAAgADEA"
+	assert.Equal(t, encoded, encodePowerShellCommand(script))
+
+	cmd, args, encodedScript := getInterpreterCommand("windows", "powershell", script, true)
+	assert.Equal(t, "powershell.exe", cmd)
+	assert.Equal(t, []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-EncodedCommand", encoded}, args)
+	assert.Equal(t, encoded, encodedScript)
+	cmd, args, encodedScript = getInterpreterCommand("linux", "powershell", script, false)
+	assert.Equal(t, "pwsh", cmd)
+	assert.Equal(t, []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", script}, args)
+	assert.Equal(t, "", encodedScript)
+	cmd, args, _ = getInterpreterCommand("windows", "cmd", "whoami /all", false)
+	assert.Equal(t, "cmd.exe", cmd)
+	assert.Equal(t, []string{"/c", "whoami /all"}, args)
+}
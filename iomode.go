@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// The ways create and update can write a file's contents, since file integrity sensors hook different syscalls: buffered (through a
+// buffered writer, as most programs do), mmap (through a shared memory mapping of the file), direct (bypassing the page cache, with
+// O_DIRECT on Linux, F_NOCACHE on Mac, or write-through on Windows), and syscall (with a single pwrite, or WriteFile on Windows, on the
+// raw file descriptor)
+var IOModes = []string{"buffered", "mmap", "direct", "syscall"}
+
+// Opens the file at path with the os.OpenFile flag, then writes the contents over the start of it with the I/O mode (leaving anything
+// after them as it was). Returns how many bytes were written.
+func writeFileContents(path string, flag int, contents string, mode string) (int, error) {
+	switch mode {
+	case "mmap":
+		return writeFileMapped(path, flag, []byte(contents))
+	case "direct":
+		return writeFileDirect(path, flag, []byte(contents))
+	case "syscall":
+		return writeFileSyscall(path, flag, []byte(contents))
+	}
+
+	f, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	writer := bufio.NewWriter(f)
+	bytesWritten, err := writer.WriteString(contents)
+	if err == nil {
+		err = writer.Flush()
+	}
+	return bytesWritten, err
+}
+
+// Gets the status a failure to write a file's contents stands for
+func getWriteFileStatus(err error) string {
+	if errors.Is(err, errors.ErrUnsupported) {
+		return "unsupported"
+	}
+	return "error"
+}
+
+// The error for an I/O mode the file's filesystem (or this OS) doesn't support
+func unsupportedIOMode(path string, mode string, err error) error {
+	return fmt.Errorf("%w: -io-mode=%s for %s: %v", errors.ErrUnsupported, mode, path, err)
+}
+
+// Gets the -io-mode to write the path's contents with, recording it as the entry's method (unless it's an SMB path, which smbclient
+// writes). Panics if it's invalid.
+func getIOMode(entry *ActivityLogEntry, path string) string {
+	if !containsString(IOModes, *ioModePtr) {
+		check(fmt.Errorf("invalid -io-mode %s (must be one of %v)", *ioModePtr, IOModes))
+	}
+	if _, found := isSMBClientPath(path); !found {
+		entry.method = *ioModePtr
+	}
+	return *ioModePtr
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Writes the contents with F_NOCACHE set on the file (bypassing the unified buffer cache, as close to O_DIRECT as Mac gets), then syncs
+// it
+func writeFileDirect(path string, flag int, contents []byte) (int, error) {
+	f, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err = unix.FcntlInt(f.Fd(), unix.F_NOCACHE, 1); err != nil {
+		return 0, unsupportedIOMode(path, "direct", err)
+	}
+	bytesWritten, err := f.Write(contents)
+	if err != nil {
+		return bytesWritten, err
+	}
+	return bytesWritten, f.Sync()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The size O_DIRECT writes (and their buffers) are aligned to
+const directBlockSize = 4096
+
+// Writes the contents with O_DIRECT (bypassing the page cache). Direct writes have to be whole, aligned blocks, so the contents are
+// padded out to a block with what's already in the file after them, and the file's cut back to its length afterwards.
+func writeFileDirect(path string, flag int, contents []byte) (int, error) {
+	f, err := os.OpenFile(path, flag | unix.O_DIRECT, 0666)
+	if errors.Is(err, unix.EINVAL) {
+		return 0, unsupportedIOMode(path, "direct", err)
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if len(contents) == 0 {
+		return 0, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size := (len(contents) + directBlockSize - 1) / directBlockSize * directBlockSize
+	buffer := alignedBuffer(size)
+	copy(buffer, contents)
+	if info.Size() > int64(len(contents)) {
+		// (so what's after the contents in the block isn't overwritten)
+		existing, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		_, err = existing.ReadAt(buffer[len(contents):], int64(len(contents)))
+		existing.Close()
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+	}
+	if _, err = f.Write(buffer); err != nil {
+		if errors.Is(err, unix.EINVAL) {
+			return 0, unsupportedIOMode(path, "direct", err)
+		}
+		return 0, err
+	}
+	return len(contents), f.Truncate(max(info.Size(), int64(len(contents))))
+}
+
+// Allocates a buffer of the size, aligned to directBlockSize
+func alignedBuffer(size int) []byte {
+	buffer := make([]byte, size + directBlockSize)
+	offset := int(uintptr(unsafe.Pointer(&buffer[0])) & (directBlockSize - 1))
+	if offset != 0 {
+		offset = directBlockSize - offset
+	}
+	return buffer[offset : offset + size]
+}
@@ -0,0 +1,12 @@
+//go:build !windows && !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+)
+
+// Direct writes aren't supported on this OS
+func writeFileDirect(path string, flag int, contents []byte) (int, error) {
+	return 0, unsupportedIOMode(path, "direct", fmt.Errorf("not supported on this OS"))
+}
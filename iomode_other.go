@@ -0,0 +1,57 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Writes the contents through a shared memory mapping of the file (growing the file to fit them first, if it's shorter), then syncs
+// the mapping back to the file
+func writeFileMapped(path string, flag int, contents []byte) (int, error) {
+	f, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if len(contents) == 0 {
+		// (there's nothing to map)
+		return 0, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < int64(len(contents)) {
+		if err = f.Truncate(int64(len(contents))); err != nil {
+			return 0, err
+		}
+	}
+
+	mapped, err := unix.Mmap(int(f.Fd()), 0, len(contents), unix.PROT_READ | unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return 0, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	defer unix.Munmap(mapped)
+	bytesWritten := copy(mapped, contents)
+	if err = unix.Msync(mapped, unix.MS_SYNC); err != nil {
+		return 0, &os.PathError{Op: "msync", Path: path, Err: err}
+	}
+	return bytesWritten, nil
+}
+
+// Writes the contents with a single pwrite on the raw file descriptor, without going through os.File
+func writeFileSyscall(path string, flag int, contents []byte) (int, error) {
+	fd, err := unix.Open(path, flag | unix.O_CLOEXEC, 0666)
+	if err != nil {
+		return 0, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer unix.Close(fd)
+	bytesWritten, err := unix.Pwrite(fd, contents, 0)
+	if err != nil {
+		return 0, &os.PathError{Op: "pwrite", Path: path, Err: err}
+	}
+	return bytesWritten, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_IOMode(t *testing.T) {
+	for _, mode := range IOModes {
+		dir := t.TempDir()
+		path := dir + "/test.txt"
+
+		// The same create and update, whichever way they're written
+		output := callMain([]string{"./noisemaker", "-sink=stdout", "-io-mode=" + mode, "create", path, "Hello World!\n"})
+		if activityLogEntry.status == "unsupported" {
+			t.Logf("-io-mode=%s isn't supported here: %s", mode, output)
+			continue
+		}
+		assert.Equal(t, activityLogEntry.status, "created", mode)
+		assert.Equal(t, activityLogEntry.method, mode)
+		assert.Contains(t, output, "13 bytes written to new file " + path, mode)
+		contents, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "Hello World!\n", string(contents), mode)
+
+		// (an update writes over the start of the file, leaving the rest as it was)
+		callMain([]string{"./noisemaker", "-sink=stdout", "-io-mode=" + mode, "update", path, "Howdy"})
+		assert.Equal(t, activityLogEntry.status, "updated", mode)
+		contents, err = os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "Howdy World!\n", string(contents), mode)
+		callMain([]string{"./noisemaker", "-sink=stdout", "-io-mode=" + mode, "update", path, "Hello again, World!\n"})
+		contents, _ = os.ReadFile(path)
+		assert.Equal(t, "Hello again, World!\n", string(contents), mode)
+
+		// Empty files, and files that aren't there
+		callMain([]string{"./noisemaker", "-sink=stdout", "-io-mode=" + mode, "create", dir + "/empty.txt"})
+		assert.Equal(t, activityLogEntry.status, "created", mode)
+		info, err := os.Stat(dir + "/empty.txt")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), info.Size())
+		callMain([]string{"./noisemaker", "-sink=stdout", "-io-mode=" + mode, "create", dir + "/missing/test.txt"})
+		assert.Equal(t, activityLogEntry.status, "error", mode)
+	}
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-io-mode=async", "create", t.TempDir() + "/test.txt"}, "invalid -io-mode async (must be one of [buffered mmap direct syscall])")
+}
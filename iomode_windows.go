@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Opens the file at path with CreateFile, with the disposition the os.OpenFile flag stands for and the given flags and attributes
+func openWindowsFile(path string, flag int, attributes uint32) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	disposition := uint32(windows.OPEN_EXISTING)
+	if flag & os.O_CREATE != 0 {
+		disposition = windows.OPEN_ALWAYS
+		if flag & os.O_TRUNC != 0 {
+			disposition = windows.CREATE_ALWAYS
+		}
+	} else if flag & os.O_TRUNC != 0 {
+		disposition = windows.TRUNCATE_EXISTING
+	}
+	handle, err := windows.CreateFile(name, windows.GENERIC_READ | windows.GENERIC_WRITE, windows.FILE_SHARE_READ, nil, disposition, windows.FILE_ATTRIBUTE_NORMAL | attributes, 0)
+	if err != nil {
+		return windows.InvalidHandle, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return handle, nil
+}
+
+// Writes the contents through a view of a file mapping (growing the file to fit them, if it's shorter), then flushes the view back to
+// the file
+func writeFileMapped(path string, flag int, contents []byte) (int, error) {
+	handle, err := openWindowsFile(path, flag, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(handle)
+	if len(contents) == 0 {
+		// (there's nothing to map)
+		return 0, nil
+	}
+	var info windows.ByHandleFileInformation
+	if err = windows.GetFileInformationByHandle(handle, &info); err != nil {
+		return 0, &os.PathError{Op: "GetFileInformationByHandle", Path: path, Err: err}
+	}
+	size := max(int64(info.FileSizeHigh) << 32 | int64(info.FileSizeLow), int64(len(contents)))
+
+	mapping, err := windows.CreateFileMapping(handle, nil, windows.PAGE_READWRITE, uint32(size >> 32), uint32(size), nil)
+	if err != nil {
+		return 0, &os.PathError{Op: "CreateFileMapping", Path: path, Err: err}
+	}
+	defer windows.CloseHandle(mapping)
+	view, err := windows.MapViewOfFile(mapping, windows.FILE_MAP_WRITE, 0, 0, uintptr(len(contents)))
+	if err != nil {
+		return 0, &os.PathError{Op: "MapViewOfFile", Path: path, Err: err}
+	}
+	defer windows.UnmapViewOfFile(view)
+	mapped := unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&view))), len(contents))
+	bytesWritten := copy(mapped, contents)
+	if err = windows.FlushViewOfFile(view, uintptr(len(contents))); err != nil {
+		return 0, &os.PathError{Op: "FlushViewOfFile", Path: path, Err: err}
+	}
+	return bytesWritten, nil
+}
+
+// Writes the contents with write-through set on the file, so they go straight to disk rather than waiting in the cache
+func writeFileDirect(path string, flag int, contents []byte) (int, error) {
+	handle, err := openWindowsFile(path, flag, windows.FILE_FLAG_WRITE_THROUGH)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(handle)
+	return writeWindowsFile(path, handle, contents)
+}
+
+// Writes the contents with a single WriteFile on the raw handle, without going through os.File
+func writeFileSyscall(path string, flag int, contents []byte) (int, error) {
+	handle, err := openWindowsFile(path, flag, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(handle)
+	return writeWindowsFile(path, handle, contents)
+}
+
+func writeWindowsFile(path string, handle windows.Handle, contents []byte) (int, error) {
+	var bytesWritten uint32
+	if err := windows.WriteFile(handle, contents, &bytesWritten, nil); err != nil {
+		return int(bytesWritten), &os.PathError{Op: "WriteFile", Path: path, Err: err}
+	}
+	return int(bytesWritten), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Where journald listens for native protocol messages, and the identifier entries are sent with
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+const JournaldIdentifier = "noisemaker"
+
+// Gets the journal field for a column (ie. NM_PROCESS_CMD for processCmd, or NM_HOST_IPS for hostIPs)
+func getJournaldFieldName(column string) string {
+	var name strings.Builder
+	name.WriteString("NM_")
+	runes := []rune(column)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i - 1]) {
+			name.WriteRune('_')
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return name.String()
+}
+
+// Serializes an entry as a journald native protocol message: a short MESSAGE, the PRIORITY (errors at err, and everything else at
+// info), the SYSLOG_IDENTIFIER, and every column (unescaped) as an NM_* field
+func serializeToJournald(entry *ActivityLogEntry) []byte {
+	priority := "6"
+	if isFailureStatus(entry.status) {
+		priority = "3"
+	}
+	message := unescapeRawText(entry.activity)
+	if entry.path != "" {
+		message += " " + unescapeRawText(entry.path)
+	}
+	if entry.status != "" {
+		message += " (" + unescapeRawText(entry.status) + ")"
+	}
+
+	var buffer bytes.Buffer
+	writeJournaldField(&buffer, "MESSAGE", message)
+	writeJournaldField(&buffer, "PRIORITY", priority)
+	writeJournaldField(&buffer, "SYSLOG_IDENTIFIER", JournaldIdentifier)
+	writeJournaldField(&buffer, "SYSLOG_PID", strconv.Itoa(entry.processId))
+	values := serializeToCSV(entry)
+	for i, column := range strings.Split(HeaderStr, ",") {
+		value := values[i]
+		if !containsString(NumericColumns, column) {
+			value = unescapeRawText(value)
+		}
+		writeJournaldField(&buffer, getJournaldFieldName(column), value)
+	}
+	return buffer.Bytes()
+}
+
+// Writes a field as KEY=value, or (if the value has newlines in it) as the key, then the value's length and the value
+func writeJournaldField(buffer *bytes.Buffer, key string, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buffer, "%s=%s\n", key, value)
+		return
+	}
+	buffer.WriteString(key + "\n")
+	binary.Write(buffer, binary.LittleEndian, uint64(len(value)))
+	buffer.WriteString(value + "\n")
+}
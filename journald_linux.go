@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Sends entries to systemd-journald over its native protocol, with each column as a structured field
+type JournaldSink struct {
+	socketPath			string
+	conn				*net.UnixConn
+}
+
+// Connects to journald's socket (default /run/systemd/journal/socket)
+func newJournaldSink(socketPath string) (Sink, error) {
+	if socketPath == "" {
+		socketPath = DefaultJournaldSocket
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to journald at %s: %v", socketPath, err)
+	}
+	return &JournaldSink{socketPath: socketPath, conn: conn}, nil
+}
+
+// Best-effort, like the forwarding sinks
+func (sink *JournaldSink) WriteEntry(entry *ActivityLogEntry) error {
+	message := serializeToJournald(entry)
+	sink.conn.SetWriteDeadline(time.Now().Add(SinkForwardTimeout))
+	_, err := sink.conn.Write(message)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		err = sink.writeViaFile(message)
+	}
+	if err != nil {
+		slog.Warn("Unable to forward log entry to journald", "error", err)
+	}
+	return nil
+}
+
+// Sends a message that's too big for a datagram the way journald expects: written to an (unlinked) file, with only its descriptor sent
+func (sink *JournaldSink) writeViaFile(message []byte) error {
+	file, err := os.CreateTemp("", "noisemaker-journal-")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	os.Remove(file.Name())
+	_, err = file.Write(message)
+	if err != nil {
+		return err
+	}
+
+	// Sent with sendmsg directly, since the descriptor is the whole message (there's no data to go with it)
+	rawConn, err := sink.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(file.Fd()))
+	var sendErr error
+	err = rawConn.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendmsg(int(fd), nil, rights, &syscall.SockaddrUnix{Name: sink.socketPath}, 0)
+		return sendErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+func (sink *JournaldSink) Close() error {
+	return sink.conn.Close()
+}
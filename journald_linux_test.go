@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournaldSink(t *testing.T) {
+	socketPath := t.TempDir() + "/journal.sock"
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	assert.Nil(t, err)
+	defer listener.Close()
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	sink, err := openSinks([]string{"journald:" + socketPath}, "", false)
+	assert.Nil(t, err)
+	defer sink.Close()
+	sink.WriteEntry(&ActivityLogEntry{activity: "create", status: "created", path: "/tmp/test.txt", runId: "run-1"})
+	buffer := make([]byte, 65536)
+	n, err := listener.Read(buffer)
+	assert.Nil(t, err)
+	fields := parseTestJournaldFields(t, buffer[:n])
+	assert.Equal(t, "create /tmp/test.txt (created)", fields["MESSAGE"])
+	assert.Equal(t, "6", fields["PRIORITY"])
+	assert.Equal(t, "run-1", fields["NM_RUN_ID"])
+
+	// Entries too big for a datagram are sent as a file descriptor instead
+	sink.WriteEntry(&ActivityLogEntry{activity: "discovery", status: "discovered", details: strings.Repeat("x", 4 * 1024 * 1024)})
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := listener.ReadMsgUnix(buffer, oob)
+	assert.Nil(t, err)
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	assert.Nil(t, err)
+	if !assert.Len(t, messages, 1) {
+		return
+	}
+	fds, err := syscall.ParseUnixRights(&messages[0])
+	assert.Nil(t, err)
+	file := os.NewFile(uintptr(fds[0]), "journal")
+	defer file.Close()
+	file.Seek(0, 0)
+	var contents bytes.Buffer
+	contents.ReadFrom(file)
+	fields = parseTestJournaldFields(t, contents.Bytes())
+	assert.Len(t, fields["NM_DETAILS"], 4 * 1024 * 1024)
+}
+
+func TestMain_Sink_JournaldUnreachable(t *testing.T) {
+	_, err := openSinks([]string{"journald:" + t.TempDir() + "/nonexistent.sock"}, "", false)
+	assert.ErrorContains(t, err, "unable to connect to journald at")
+}
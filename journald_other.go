@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// journald is Linux-only
+func newJournaldSink(socketPath string) (Sink, error) {
+	return nil, fmt.Errorf("the journald sink is not supported on %s", runtime.GOOS)
+}
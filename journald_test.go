@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Parses a journald native protocol message back into its fields
+func parseTestJournaldFields(t *testing.T, message []byte) map[string]string {
+	fields := map[string]string{}
+	for len(message) > 0 {
+		line, rest, _ := bytes.Cut(message, []byte("\n"))
+		if key, value, found := bytes.Cut(line, []byte("=")); found {
+			fields[string(key)] = string(value)
+			message = rest
+			continue
+		}
+		length := binary.LittleEndian.Uint64(rest[:8])
+		fields[string(line)] = string(rest[8:8 + length])
+		message = rest[8 + length + 1:]
+	}
+	return fields
+}
+
+func TestGetJournaldFieldName(t *testing.T) {
+	assert.Equal(t, "NM_PROCESS_CMD", getJournaldFieldName("processCmd"))
+	assert.Equal(t, "NM_HOST_IPS", getJournaldFieldName("hostIPs"))
+	assert.Equal(t, "NM_PID", getJournaldFieldName("pid"))
+}
+
+func TestSerializeToJournald(t *testing.T) {
+	entry := &ActivityLogEntry{activity: "discovery", status: "error", path: "/etc/passwd", processId: 42, details: "root:x:0:0\\nnick:x:1000:1000\\, more", destPort: 443}
+	fields := parseTestJournaldFields(t, serializeToJournald(entry))
+	assert.Equal(t, "discovery /etc/passwd (error)", fields["MESSAGE"])
+	assert.Equal(t, "3", fields["PRIORITY"])
+	assert.Equal(t, "noisemaker", fields["SYSLOG_IDENTIFIER"])
+	assert.Equal(t, "42", fields["SYSLOG_PID"])
+	assert.Equal(t, "root:x:0:0\nnick:x:1000:1000, more", fields["NM_DETAILS"])
+	assert.Equal(t, "443", fields["NM_DEST_PORT"])
+	assert.Equal(t, "", fields["NM_RUN_ID"])
+	assert.Len(t, fields, 4 + len(strings.Split(HeaderStr, ",")))
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Where a pod's service account credentials are mounted (replaced in tests)
+var k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// The resources k8sprobe knows the endpoints of: the API group's path, and whether the resource lives in a namespace
+var K8sResources = map[string]K8sResource{
+	"pods": {"/api/v1", true},
+	"secrets": {"/api/v1", true},
+	"configmaps": {"/api/v1", true},
+	"serviceaccounts": {"/api/v1", true},
+	"services": {"/api/v1", true},
+	"namespaces": {"/api/v1", false},
+	"nodes": {"/api/v1", false},
+	"deployments": {"/apis/apps/v1", true},
+	"daemonsets": {"/apis/apps/v1", true},
+	"roles": {"/apis/rbac.authorization.k8s.io/v1", true},
+	"rolebindings": {"/apis/rbac.authorization.k8s.io/v1", true},
+	"clusterroles": {"/apis/rbac.authorization.k8s.io/v1", false},
+	"clusterrolebindings": {"/apis/rbac.authorization.k8s.io/v1", false},
+}
+
+// The probes k8sprobe makes by default: the ones discovery tooling starts with
+var K8sDefaultProbes = []string{"namespaces", "pods", "secrets", "serviceaccounts", "clusterrolebindings"}
+
+// Where a resource's endpoint is
+type K8sResource struct {
+	group				string
+	namespaced			bool
+}
+
+// One API call to make: a list of the resource, or a get of the named object (ie. "pods", or "secrets/db-password")
+type K8sProbe struct {
+	verb				string		// list or get
+	resource			string
+	name				string
+	namespace			string		// the namespace it's made in (empty for cluster-wide resources)
+}
+
+// How to reach and authenticate to the API server
+type K8sConfig struct {
+	server				string
+	namespace			string		// the namespace probes are made in, if none's given
+	token				string
+	username			string
+	password			string
+	tlsConfig			*tls.Config
+	auth				string		// how it authenticates: serviceaccount, token, client-certificate, basic, or none
+}
+
+// Response data from k8sprobe action
+type K8sProbeResponse struct {
+	accessed			int
+	denied				int
+	missing				int
+	status				string
+}
+
+// Options for the k8sprobe command
+type K8sProbeOptions struct {
+	kubeconfig			string
+	namespace			string
+	timeout				time.Duration
+	probes				[]*K8sProbe
+}
+
+// Parses k8sprobe's arguments: [--kubeconfig=path] [--namespace=ns] [--timeout=duration] [probes...], where each probe is a resource
+// (listed) or resource/name (got)
+func parseK8sProbeOptions(args []string) (*K8sProbeOptions, error) {
+	flags := flag.NewFlagSet("k8sprobe", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	kubeconfig := flags.String("kubeconfig", "", "the kubeconfig to authenticate with (default in-cluster credentials, or else $KUBECONFIG or ~/.kube/config)")
+	namespace := flags.String("namespace", "", "the namespace to probe (default the context's namespace, or default)")
+	timeout := flags.Duration("timeout", 10 * time.Second, "how long to wait on each API call")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid k8sprobe: %v", err)
+	}
+
+	options := &K8sProbeOptions{kubeconfig: *kubeconfig, namespace: *namespace, timeout: *timeout}
+	probes := flags.Args()
+	if len(probes) == 0 {
+		probes = K8sDefaultProbes
+	}
+	for _, probe := range probes {
+		resource, name, _ := strings.Cut(probe, "/")
+		if _, found := K8sResources[resource]; !found {
+			return nil, fmt.Errorf("invalid k8sprobe: unknown resource %s", resource)
+		}
+		verb := "list"
+		if name != "" {
+			verb = "get"
+		}
+		options.probes = append(options.probes, &K8sProbe{verb: verb, resource: resource, name: name})
+	}
+	return options, nil
+}
+
+// The parts of a kubeconfig used to reach the API server
+type Kubeconfig struct {
+	CurrentContext		string				`yaml:"current-context"`
+	Contexts			[]struct {
+		Name				string				`yaml:"name"`
+		Context				struct {
+			Cluster				string				`yaml:"cluster"`
+			User				string				`yaml:"user"`
+			Namespace			string				`yaml:"namespace"`
+		}									`yaml:"context"`
+	}									`yaml:"contexts"`
+	Clusters			[]struct {
+		Name				string				`yaml:"name"`
+		Cluster				struct {
+			Server				string				`yaml:"server"`
+			CertificateAuthority		string		`yaml:"certificate-authority"`
+			CertificateAuthorityData	string		`yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify		bool		`yaml:"insecure-skip-tls-verify"`
+		}									`yaml:"cluster"`
+	}									`yaml:"clusters"`
+	Users				[]struct {
+		Name				string				`yaml:"name"`
+		User				struct {
+			Token				string				`yaml:"token"`
+			TokenFile			string				`yaml:"tokenFile"`
+			ClientCertificate		string		`yaml:"client-certificate"`
+			ClientCertificateData	string		`yaml:"client-certificate-data"`
+			ClientKey				string		`yaml:"client-key"`
+			ClientKeyData			string		`yaml:"client-key-data"`
+			Username			string				`yaml:"username"`
+			Password			string				`yaml:"password"`
+		}									`yaml:"user"`
+	}									`yaml:"users"`
+}
+
+// Gets how to reach the API server: from the kubeconfig, if one's given, or else from the pod's service account when running in a
+// cluster, or else from $KUBECONFIG (its first file) or ~/.kube/config
+func loadK8sConfig(kubeconfigPath string) (*K8sConfig, error) {
+	if kubeconfigPath == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return loadInClusterK8sConfig()
+	}
+	if kubeconfigPath == "" {
+		kubeconfigPath = strings.Split(os.Getenv("KUBECONFIG"), string(os.PathListSeparator))[0]
+	}
+	if kubeconfigPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		kubeconfigPath = filepath.Join(homeDir, ".kube", "config")
+	}
+	return loadKubeconfig(kubeconfigPath)
+}
+
+// Gets how to reach the API server from inside a pod, with its service account's token
+func loadInClusterK8sConfig() (*K8sConfig, error) {
+	token, err := os.ReadFile(filepath.Join(k8sServiceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	config := &K8sConfig{
+		server: "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")),
+		namespace: "default",
+		token: strings.TrimSpace(string(token)),
+		tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+		auth: "serviceaccount",
+	}
+	if namespace, err := os.ReadFile(filepath.Join(k8sServiceAccountDir, "namespace")); err == nil {
+		config.namespace = strings.TrimSpace(string(namespace))
+	}
+	config.tlsConfig.RootCAs, err = loadCertPool(filepath.Join(k8sServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Gets how to reach the API server from the kubeconfig's current context (relative paths in it are relative to the kubeconfig)
+func loadKubeconfig(path string) (*K8sConfig, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	kubeconfig := new(Kubeconfig)
+	if err = yaml.Unmarshal(contents, kubeconfig); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig %s: %v", path, err)
+	}
+	dir := filepath.Dir(path)
+	resolve := func(file string) string {
+		if file != "" && !filepath.IsAbs(file) {
+			return filepath.Join(dir, file)
+		}
+		return file
+	}
+	// (reads the inline base64 data, or else the file)
+	readData := func(data string, file string) ([]byte, error) {
+		if data != "" {
+			return base64.StdEncoding.DecodeString(data)
+		}
+		return os.ReadFile(resolve(file))
+	}
+
+	config := &K8sConfig{namespace: "default", tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12}, auth: "none"}
+	found := false
+	for _, context := range kubeconfig.Contexts {
+		if context.Name != kubeconfig.CurrentContext {
+			continue
+		}
+		found = true
+		if context.Context.Namespace != "" {
+			config.namespace = context.Context.Namespace
+		}
+		for _, cluster := range kubeconfig.Clusters {
+			if cluster.Name != context.Context.Cluster {
+				continue
+			}
+			config.server = strings.TrimSuffix(cluster.Cluster.Server, "/")
+			config.tlsConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+			if cluster.Cluster.CertificateAuthorityData != "" || cluster.Cluster.CertificateAuthority != "" {
+				ca, err := readData(cluster.Cluster.CertificateAuthorityData, cluster.Cluster.CertificateAuthority)
+				if err != nil {
+					return nil, fmt.Errorf("invalid kubeconfig %s: %v", path, err)
+				}
+				config.tlsConfig.RootCAs = x509.NewCertPool()
+				if !config.tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+					return nil, fmt.Errorf("invalid kubeconfig %s: no certificates in the certificate authority of cluster %s", path, cluster.Name)
+				}
+			}
+		}
+		for _, user := range kubeconfig.Users {
+			if user.Name != context.Context.User {
+				continue
+			}
+			switch {
+			case user.User.Token != "" || user.User.TokenFile != "":
+				config.auth = "token"
+				config.token = user.User.Token
+				if config.token == "" {
+					token, err := os.ReadFile(resolve(user.User.TokenFile))
+					if err != nil {
+						return nil, fmt.Errorf("invalid kubeconfig %s: %v", path, err)
+					}
+					config.token = strings.TrimSpace(string(token))
+				}
+			case user.User.ClientCertificateData != "" || user.User.ClientCertificate != "":
+				config.auth = "client-certificate"
+				cert, err := readData(user.User.ClientCertificateData, user.User.ClientCertificate)
+				if err == nil {
+					var key []byte
+					key, err = readData(user.User.ClientKeyData, user.User.ClientKey)
+					if err == nil {
+						var pair tls.Certificate
+						pair, err = tls.X509KeyPair(cert, key)
+						config.tlsConfig.Certificates = []tls.Certificate{pair}
+					}
+				}
+				if err != nil {
+					return nil, fmt.Errorf("invalid kubeconfig %s: %v", path, err)
+				}
+			case user.User.Username != "":
+				config.auth = "basic"
+				config.username = user.User.Username
+				config.password = user.User.Password
+			}
+		}
+	}
+	if !found || config.server == "" {
+		return nil, fmt.Errorf("invalid kubeconfig %s: no cluster for current context '%s'", path, kubeconfig.CurrentContext)
+	}
+	return config, nil
+}
+
+// Gets the path of the probe's endpoint
+func getK8sProbePath(probe *K8sProbe) string {
+	resource := K8sResources[probe.resource]
+	path := resource.group
+	if resource.namespaced {
+		path += "/namespaces/" + url.PathEscape(probe.namespace)
+	}
+	path += "/" + probe.resource
+	if probe.name != "" {
+		path += "/" + url.PathEscape(probe.name)
+	}
+	return path
+}
+
+// Makes each probe's API call, as part of the parent's run, logging each as a k8s-api activity (with the verb as its method, and the
+// resource and namespace in its details). Only metadata is asked for (so no secret's contents are ever read), and nothing's changed.
+func probeK8sAPI(activityLog Sink, parent *ActivityLogEntry, config *K8sConfig, probes []*K8sProbe, timeout time.Duration) *K8sProbeResponse {
+	response := new(K8sProbeResponse)
+	client := &http.Client{Timeout: timeout, Transport: newSourceTransport(config.tlsConfig)}
+	for _, probe := range probes {
+		entry := newChildLogEntry(parent, "k8s-api")
+		probeURL := config.server + getK8sProbePath(probe)
+		entry.processCmd = escapeRawText(strings.ToUpper(probe.verb) + " " + probeURL)
+		entry.path = escapeRawText(probeURL)
+		entry.method = probe.verb
+		entry.destAddr = parent.destAddr
+		entry.destPort = parent.destPort
+		entry.protocol = parent.protocol
+		details := "resource " + probe.resource
+		if probe.name != "" {
+			details += ", name " + probe.name
+		}
+		if probe.namespace != "" {
+			details += ", namespace " + probe.namespace
+		}
+
+		items, err := callK8sAPI(client, config, probeURL, probe, entry)
+		switch entry.status {
+		case "accessed":
+			response.accessed += 1
+			if probe.verb == "list" {
+				details += fmt.Sprintf(", %d items", items)
+			}
+			fmt.Printf("%s %s: %s\n", probe.verb, probe.resource, strings.TrimPrefix(details, "resource " + probe.resource + ", "))
+		case "no_access":
+			response.denied += 1
+			fmt.Printf("Access denied to %s %s (%s)\n", probe.verb, probe.resource, details)
+		default:
+			response.missing += 1
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		}
+		entry.details = escapeRawText(details)
+		writeLogEntry(activityLog, entry)
+	}
+
+	fmt.Printf("Made %d Kubernetes API calls: %d accessed, %d denied, %d not found or errored\n", len(probes), response.accessed, response.denied, response.missing)
+	response.status = "completed"
+	return response
+}
+
+// Makes the probe's API call, recording its result to the entry, and returns how many items it listed
+func callK8sAPI(client *http.Client, config *K8sConfig, probeURL string, probe *K8sProbe, entry *ActivityLogEntry) (int, error) {
+	request, err := http.NewRequestWithContext(runContext, "GET", probeURL, nil)
+	if err != nil {
+		entry.status = "invalid_request"
+		return 0, err
+	}
+	// (without falling back to the whole object, for servers that can't give just its metadata)
+	kind := "PartialObjectMetadata"
+	if probe.verb == "list" {
+		kind = "PartialObjectMetadataList"
+	}
+	request.Header.Set("Accept", "application/json;as=" + kind + ";g=meta.k8s.io;v=v1")
+	if config.token != "" {
+		request.Header.Set("Authorization", "Bearer " + config.token)
+	} else if config.username != "" {
+		request.SetBasicAuth(config.username, config.password)
+	}
+
+	httpResponse, err := client.Do(request)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			entry.status = "timeout"
+		} else if errors.As(err, new(*net.OpError)) {
+			entry.status = "unreachable"
+		} else {
+			entry.status = "error"
+		}
+		return 0, err
+	}
+	defer httpResponse.Body.Close()
+	switch {
+	case httpResponse.StatusCode == http.StatusUnauthorized || httpResponse.StatusCode == http.StatusForbidden:
+		entry.status = "no_access"
+	case httpResponse.StatusCode == http.StatusNotFound:
+		entry.status = "not_found"
+	case httpResponse.StatusCode != http.StatusOK:
+		entry.status = "error"
+		err = fmt.Errorf("%s %s: %s", probe.verb, probe.resource, httpResponse.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(httpResponse.Header.Get("Content-Type"))
+	if entry.status == "" && mediaType != "application/json" {
+		entry.status = "error"
+		err = fmt.Errorf("%s %s: unexpected %s response, discarded", probe.verb, probe.resource, httpResponse.Header.Get("Content-Type"))
+	}
+	if entry.status != "" {
+		// (whatever's in it is never read)
+		received, _ := io.Copy(io.Discard, httpResponse.Body)
+		entry.bytesReceived = int(received)
+		return 0, err
+	}
+
+	body, err := io.ReadAll(httpResponse.Body)
+	entry.bytesReceived = len(body)
+	if err != nil {
+		entry.status = "error"
+		return 0, err
+	}
+	list := struct {
+		Kind			string				`json:"kind"`
+		Items			[]json.RawMessage	`json:"items"`
+	}{}
+	json.Unmarshal(body, &list)
+	if list.Kind != kind {
+		// Anything but metadata (ie. a whole secret) is dropped as it is, without a word of it logged
+		entry.status = "error"
+		return 0, fmt.Errorf("%s %s: unexpected response (not %s), discarded", probe.verb, probe.resource, kind)
+	}
+	entry.status = "accessed"
+	return len(list.Items), nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts an API server that lists two pods (and gets any one) with the token "lab-token", refuses secrets, ignores what's asked for
+// with configmaps (responding with the whole object, or YAML), and doesn't know of any other resource. Returns it, and the Accept
+// headers it was sent.
+func startTestK8sServer(t *testing.T) (*httptest.Server, *[]string) {
+	accepts := []string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepts = append(accepts, r.Header.Get("Accept"))
+		switch {
+		case r.Header.Get("Authorization") != "Bearer lab-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case strings.Contains(r.URL.Path, "/secrets"):
+			w.WriteHeader(http.StatusForbidden)
+		case r.URL.Path == "/api/v1/namespaces/lab/configmaps":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"kind":"ConfigMapList","items":[{"metadata":{"name":"db"},"data":{"password":"hunter2"}}]}`)
+		case strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/lab/configmaps/"):
+			w.Header().Set("Content-Type", "application/yaml")
+			fmt.Fprint(w, "kind: PartialObjectMetadata\ndata:\n  password: hunter2\n")
+		case r.URL.Path == "/api/v1/namespaces/lab/pods":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"kind":"PartialObjectMetadataList","items":[{"metadata":{"name":"web"}},{"metadata":{"name":"db"}}]}`)
+		case strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/lab/pods/"):
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"kind":"PartialObjectMetadata","metadata":{"name":"web"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &accepts
+}
+
+// Writes a kubeconfig for the server, trusting its certificate
+func writeTestKubeconfig(t *testing.T, server *httptest.Server, token string) string {
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(dir + "/ca.crt", ca, 0600))
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: lab
+contexts:
+- name: lab
+  context:
+    cluster: lab-cluster
+    user: lab-user
+    namespace: lab
+clusters:
+- name: lab-cluster
+  cluster:
+    server: %s
+    certificate-authority: ca.crt
+users:
+- name: lab-user
+  user:
+    token: %s
+`, server.URL, token)
+	assert.Nil(t, os.WriteFile(dir + "/config", []byte(kubeconfig), 0600))
+	return dir + "/config"
+}
+
+func TestMain_K8sProbe(t *testing.T) {
+	server, accepts := startTestK8sServer(t)
+	kubeconfig := writeTestKubeconfig(t, server, "lab-token")
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Each call's logged with its verb, resource, and namespace (and only metadata's asked for)
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "k8sprobe", "--kubeconfig=" + kubeconfig, "pods", "secrets", "pods/web", "nodes"})
+	assert.Contains(t, output, "list pods: namespace lab, 2 items")
+	assert.Contains(t, output, "Access denied to list secrets (resource secrets, namespace lab)")
+	assert.Equal(t, activityLogEntry.activity, "k8sprobe")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.method, "token")
+	assert.Equal(t, activityLogEntry.protocol, "https")
+	assert.Equal(t, activityLogEntry.destAddr, "127.0.0.1")
+	assert.Equal(t, activityLogEntry.path, escapeRawText(server.URL))
+	assert.Equal(t, activityLogEntry.details, "2 accessed\\, 1 denied\\, 1 not found or errored\\, namespace lab")
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	entries := parsedLog.entries
+	assert.Len(t, entries, 5)
+	assert.Equal(t, "k8s-api", entries[0].activity)
+	assert.Equal(t, "list", entries[0].method)
+	assert.Equal(t, "accessed", entries[0].status)
+	assert.Equal(t, escapeRawText(server.URL + "/api/v1/namespaces/lab/pods"), entries[0].path)
+	assert.Equal(t, "resource pods\\, namespace lab\\, 2 items", entries[0].details)
+	assert.Equal(t, activityLogEntry.destPort, entries[0].destPort)
+	assert.Equal(t, "no_access", entries[1].status)
+	assert.Equal(t, "get", entries[2].method)
+	assert.Equal(t, "resource pods\\, name web\\, namespace lab", entries[2].details)
+	assert.Equal(t, "not_found", entries[3].status)
+	assert.Equal(t, escapeRawText(server.URL + "/api/v1/nodes"), entries[3].path)
+	assert.Equal(t, "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1", (*accepts)[0])
+	assert.Equal(t, "application/json;as=PartialObjectMetadata;g=meta.k8s.io;v=v1", (*accepts)[2])
+
+	// Anything but metadata is discarded as it is, without any of it logged
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "k8sprobe", "--kubeconfig=" + kubeconfig, "configmaps", "configmaps/db"})
+	assert.Contains(t, output, "Error: list configmaps: unexpected response (not PartialObjectMetadataList), discarded")
+	assert.Contains(t, output, "Error: get configmaps: unexpected application/yaml response, discarded")
+	assert.NotContains(t, output, "hunter2")
+	assert.Equal(t, activityLogEntry.details, "0 accessed\\, 0 denied\\, 2 not found or errored\\, namespace lab")
+	parsedLog, err = readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "error", parsedLog.entries[5].status)
+	assert.Equal(t, "error", parsedLog.entries[6].status)
+	assert.Equal(t, "resource configmaps\\, namespace lab", parsedLog.entries[5].details)
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	assert.NotContains(t, contents, "hunter2")
+
+	// Another namespace can be given, and a token that's refused is no access
+	callMain([]string{"./noisemaker", "-sink=stdout", "k8sprobe", "--kubeconfig=" + kubeconfig, "--namespace=kube-system", "pods"})
+	assert.Equal(t, activityLogEntry.details, "0 accessed\\, 0 denied\\, 1 not found or errored\\, namespace kube-system")
+	callMain([]string{"./noisemaker", "-sink=stdout", "k8sprobe", "--kubeconfig=" + writeTestKubeconfig(t, server, "wrong"), "pods"})
+	assert.Equal(t, activityLogEntry.details, "0 accessed\\, 1 denied\\, 0 not found or errored\\, namespace lab")
+}
+
+func TestMain_K8sProbe_InCluster(t *testing.T) {
+	server, _ := startTestK8sServer(t)
+	dir := t.TempDir()
+	os.WriteFile(dir + "/token", []byte("lab-token\n"), 0600)
+	os.WriteFile(dir + "/namespace", []byte("lab"), 0600)
+	os.WriteFile(dir + "/ca.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	defaultDir := k8sServiceAccountDir
+	k8sServiceAccountDir = dir
+	defer func() { k8sServiceAccountDir = defaultDir }()
+	host, port, _ := strings.Cut(strings.TrimPrefix(server.URL, "https://"), ":")
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "k8sprobe", "pods"})
+	assert.Contains(t, output, "list pods: namespace lab, 2 items")
+	assert.Equal(t, activityLogEntry.method, "serviceaccount")
+	assert.Equal(t, activityLogEntry.status, "completed")
+}
+
+func TestMain_K8sProbe_NoConfig(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	callMain([]string{"./noisemaker", "-sink=stdout", "k8sprobe", "--kubeconfig=" + t.TempDir() + "/missing"})
+	assert.Equal(t, activityLogEntry.status, "not_found")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "k8sprobe", "widgets"}, "invalid k8sprobe: unknown resource widgets")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The units a -size can be given in (powers of 1024, so 50GB is 50 GiB)
+var SizeUnits = map[string]int64{"": 1, "B": 1, "KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40}
+
+// How much of a file's contents are written at a time, for a file created with -size (so it can be larger than memory)
+const sizedFileChunkSize = 1 << 20
+
+// Options for the create command
+type CreateOptions struct {
+	path				string
+	contents			string
+	size				int64		// the size to create the file at (repeating the contents to fill it, or zeros without any), or -1
+	sparse				bool		// whether to leave everything after the contents as a hole, rather than writing it
+	ifNotExists			bool		// whether to skip it (rather than fail), if the file already exists
+	profile				*ContentProfile		// the profile to generate the contents with, in place of the contents given (or nil)
+	doubleExtension		string		// the executable extension added to the path (ie. exe, for invoice.pdf.exe), if it's given
+	fileName			*FileNameOptions	// the tricks played on the path's file name (or nil)
+	pathStress			*PathStressOptions	// how deep and long to make the path (or nil)
+	dirs				[]string	// the directories to create for the path first (outermost first), with -depth or -path-length
+}
+
+// Parses create's arguments: [-size=(size)] [-sparse] [-if-not-exists] [-profile=(profile)] [-entropy=(bits)]
+// [-double-extension=(extension)] [-rtlo=(extension)] [-homoglyphs] [-long-name=(length)] [-depth=(count)]
+// [-path-length=(length)] (path) [contents]
+func parseCreateOptions(args []string) (*CreateOptions, error) {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	size := flags.String("size", "", "the size to create the file at, ie. 50GB (default the size of the contents)")
+	sparse := flags.Bool("sparse", false, "leaves everything after the contents as a hole (default false)")
+	ifNotExists := flags.Bool("if-not-exists", false, "skips creating the file if it already exists, rather than failing (default false)")
+	getProfile := addContentProfileFlags(flags)
+	doubleExtension := flags.String("double-extension", "", "adds an executable extension to the path, ie. exe for invoice.pdf.exe (default none)")
+	getFileName := addFileNameFlags(flags)
+	getPathStress := addPathStressFlags(flags)
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid create: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for create! Args: %v", args)
+	}
+
+	options := &CreateOptions{path: flags.Arg(0), size: -1, sparse: *sparse, ifNotExists: *ifNotExists}
+	if flags.NArg() > 1 {
+		options.contents = flags.Arg(1)
+	}
+	options.profile, err = getProfile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid create: %v", err)
+	}
+	if options.profile != nil && flags.NArg() > 1 {
+		return nil, fmt.Errorf("invalid create: -profile and -entropy generate the contents, so can't be given contents too")
+	}
+	if *doubleExtension != "" {
+		options.doubleExtension = strings.ToLower(strings.TrimPrefix(*doubleExtension, "."))
+		if !containsString(ExecutableExtensions, options.doubleExtension) {
+			return nil, fmt.Errorf("invalid create: invalid -double-extension %s (must be one of %v)", *doubleExtension, ExecutableExtensions)
+		}
+		options.path += "." + options.doubleExtension
+		if options.profile == nil && flags.NArg() < 2 {
+			// (it's what the extension says it is, behind the one it looks like)
+			options.profile = &ContentProfile{name: "random", entropy: -1}
+			if containsString(ContentProfiles, ExtensionTypes[options.doubleExtension]) {
+				options.profile.name = ExtensionTypes[options.doubleExtension]
+			}
+		}
+	}
+	options.fileName, err = getFileName()
+	if err != nil {
+		return nil, fmt.Errorf("invalid create: %v", err)
+	}
+	if options.fileName != nil {
+		options.path, err = options.fileName.apply(options.path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid create: %v", err)
+		}
+	}
+	options.pathStress, err = getPathStress()
+	if err != nil {
+		return nil, fmt.Errorf("invalid create: %v", err)
+	}
+	if options.pathStress != nil {
+		// (last, so the path's padded out to its whole length)
+		options.path, options.dirs = options.pathStress.apply(options.path)
+	}
+	if *size != "" {
+		options.size, err = parseSize(*size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid create: %v", err)
+		}
+	}
+	if options.sparse && options.size < 0 {
+		return nil, fmt.Errorf("invalid create: -sparse needs a -size")
+	}
+	if options.size >= 0 && options.size < int64(len(options.contents)) {
+		return nil, fmt.Errorf("invalid create: -size %d is smaller than the contents (%d bytes)", options.size, len(options.contents))
+	}
+	return options, nil
+}
+
+// Parses a size in bytes, optionally with a unit (ie. 512, 64KB, or 50GB)
+func parseSize(text string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(text))
+	number := strings.TrimRight(upper, "KMGTB")
+	multiplier, found := SizeUnits[upper[len(number):]]
+	size, err := strconv.ParseInt(number, 10, 64)
+	if !found || err != nil || size < 0 || size > (1 << 62) / multiplier {
+		return 0, fmt.Errorf("invalid size '%s' (must be a number of bytes, optionally in KB, MB, GB, or TB)", text)
+	}
+	return size * multiplier, nil
+}
+
+// Formats a size in bytes in the largest unit it's a whole number of (ie. 50GB)
+func formatSize(size int64) string {
+	for _, unit := range []string{"TB", "GB", "MB", "KB"} {
+		if size > 0 && size % SizeUnits[unit] == 0 {
+			return strconv.FormatInt(size / SizeUnits[unit], 10) + unit
+		}
+	}
+	return strconv.FormatInt(size, 10) + "B"
+}
+
+// Create a file of the given size, starting with the header, then streaming its contents (repeated to fill it, or zeros without any)
+// rather than holding them in memory; or, if it's sparse, writing the contents and leaving the rest as a hole. Returns the size it
+// takes up on disk, too.
+func createSizedFile(path string, header string, contents string, size int64, sparse bool) (string, int64, error) {
+	if fileExists(path) {
+		fmt.Printf("File %s already exists, unable to write!\n", path)
+		return "exists", 0, fmt.Errorf("file_already_exists: %s", path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return "error", 0, err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(header)
+	if err == nil && sparse {
+		err = setSparse(f)
+		if err == nil {
+			_, err = f.WriteString(contents)
+		}
+		if err == nil {
+			err = f.Truncate(size)
+		}
+	} else if err == nil {
+		err = writeRepeated(f, contents, size - int64(len(header)))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return "error", 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return "error", 0, err
+	}
+	physicalSize := getPhysicalSize(path, info)
+	fmt.Printf("%d bytes (%s) written to new file %s, taking up %d bytes on disk\n", size, formatSize(size), path, physicalSize)
+	return "created", physicalSize, nil
+}
+
+// Writes size bytes of the contents, repeated (or of zeros, without any), a chunk at a time
+func writeRepeated(w io.Writer, contents string, size int64) error {
+	chunk := make([]byte, sizedFileChunkSize)
+	if contents != "" {
+		for i := 0; i < len(chunk); i += copy(chunk[i:], contents) {
+		}
+		// (so each chunk starts where the one before left off)
+		chunk = chunk[:len(chunk) / len(contents) * len(contents)]
+	}
+	writer := bufio.NewWriterSize(w, sizedFileChunkSize)
+	for written := int64(0); written < size; {
+		// (a big file can take a while, so it stops partway if the run's cancelled)
+		if err := runContext.Err(); err != nil {
+			return err
+		}
+		n, err := writer.Write(chunk[:min(int64(len(chunk)), size - written)])
+		if err != nil {
+			return err
+		}
+		written += int64(n)
+	}
+	return writer.Flush()
+}
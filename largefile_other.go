@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Files get holes wherever they're extended without being written, so there's nothing to do
+func setSparse(f *os.File) error {
+	return nil
+}
+
+// Gets the size the file takes up on disk (its allocated blocks, which are always 512 bytes)
+func getPhysicalSize(path string, info os.FileInfo) int64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int64(stat.Blocks) * 512
+	}
+	return info.Size()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Create_Size(t *testing.T) {
+	dir := t.TempDir()
+
+	// The contents are repeated to fill the size (or it's zeros, without any)
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "create", "-size=3MB", dir + "/big.txt", "abc"})
+	assert.Contains(t, output, fmt.Sprintf("3145728 bytes (3MB) written to new file %s/big.txt", dir))
+	assert.Equal(t, activityLogEntry.status, "created")
+	contents, err := os.ReadFile(dir + "/big.txt")
+	assert.Nil(t, err)
+	assert.Len(t, contents, 3 << 20)
+	assert.Equal(t, strings.Repeat("abc", 1 << 20), string(contents))
+	assert.True(t, strings.HasPrefix(activityLogEntry.details, "3145728 bytes logical\\, "))
+	callMain([]string{"./noisemaker", "-sink=stdout", "create", "-size=10", dir + "/zeros.bin"})
+	contents, _ = os.ReadFile(dir + "/zeros.bin")
+	assert.Equal(t, make([]byte, 10), contents)
+
+	// A sparse file takes up next to nothing on disk
+	callMain([]string{"./noisemaker", "-sink=stdout", "create", "-size=1GB", "-sparse", dir + "/sparse.bin", "header"})
+	assert.Equal(t, activityLogEntry.status, "created")
+	info, err := os.Stat(dir + "/sparse.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1 << 30), info.Size())
+	var physical int64
+	_, err = fmt.Sscanf(activityLogEntry.details, "1073741824 bytes logical\\, %d bytes physical\\, sparse", &physical)
+	assert.Nil(t, err)
+	assert.Less(t, physical, int64(1 << 20))
+	callMain([]string{"./noisemaker", "-sink=stdout", "create", "-size=1GB", "-sparse", dir + "/sparse.bin"})
+	assert.Equal(t, activityLogEntry.status, "exists")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "create", "-sparse", dir + "/test.txt"}, "invalid create: -sparse needs a -size")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "create", "-size=2", dir + "/test.txt", "abc"}, "invalid create: -size 2 is smaller than the contents (3 bytes)")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-io-mode=mmap", "create", "-size=1MB", dir + "/test.txt"}, "invalid create: -size can't be used with -io-mode=mmap")
+}
+
+func TestParseSize(t *testing.T) {
+	for text, expected := range map[string]int64{"512": 512, "64KB": 64 << 10, "50GB": 50 << 30, "2tb": 2 << 40, "0B": 0} {
+		size, err := parseSize(text)
+		assert.Nil(t, err, text)
+		assert.Equal(t, expected, size, text)
+	}
+	for _, text := range []string{"", "GB", "-5MB", "1.5GB", "10PB", "9999999999TB"} {
+		_, err := parseSize(text)
+		assert.ErrorContains(t, err, "invalid size", text)
+	}
+	assert.Equal(t, "50GB", formatSize(50 << 30))
+	assert.Equal(t, "1536KB", formatSize(1536 << 10))
+	assert.Equal(t, "1000B", formatSize(1000))
+}
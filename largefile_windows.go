@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// (GetCompressedFileSizeW isn't wrapped by x/sys/windows)
+var kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+var procGetCompressedFileSizeW = kernel32.NewProc("GetCompressedFileSizeW")
+
+// Marks the file as sparse, so it gets a hole wherever it's extended without being written (NTFS allocates it otherwise)
+func setSparse(f *os.File) error {
+	var returned uint32
+	return windows.DeviceIoControl(windows.Handle(f.Fd()), windows.FSCTL_SET_SPARSE, nil, 0, nil, 0, &returned, nil)
+}
+
+// Gets the size the file takes up on disk (less than its size, if it's sparse or compressed)
+func getPhysicalSize(path string, info os.FileInfo) int64 {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return info.Size()
+	}
+	var high uint32
+	low, _, err := procGetCompressedFileSizeW.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&high)))
+	if uint32(low) == 0xFFFFFFFF && err != windows.ERROR_SUCCESS {
+		return info.Size()
+	}
+	return int64(high) << 32 | int64(uint32(low))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Response data from listen action
+type ListenResponse struct {
+	receives			int
+	bytesReceived		int
+	bytesSent			int
+	status				string
+	path				string
+}
+
+// Counts the receive activities recorded by a listener, and signals when it's received enough (or the run's been cancelled)
+type receiveCounter struct {
+	mutex				sync.Mutex
+	maxReceives			int
+	response			*ListenResponse
+	done				chan struct{}
+	doneOnce			sync.Once
+}
+
+func newReceiveCounter(maxReceives int, path string) *receiveCounter {
+	counter := new(receiveCounter)
+	counter.maxReceives = maxReceives
+	counter.response = new(ListenResponse)
+	counter.response.path = path
+	counter.done = make(chan struct{})
+
+	// (the listener stops, too, if the run's cancelled)
+	go func() {
+		select {
+		case <-runContext.Done():
+			counter.doneOnce.Do(func() { close(counter.done) })
+		case <-counter.done:
+		}
+	}()
+	return counter
+}
+
+// Records a receive activity in the totals, and returns true if the listener should stop
+func (counter *receiveCounter) add(bytesReceived int, bytesSent int) bool {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	counter.response.receives += 1
+	counter.response.bytesReceived += bytesReceived
+	counter.response.bytesSent += bytesSent
+	if counter.maxReceives > 0 && counter.response.receives >= counter.maxReceives {
+		counter.doneOnce.Do(func() { close(counter.done) })
+		return true
+	}
+	return false
+}
+
+// Gets the final totals, with the given status
+func (counter *receiveCounter) finish(status string) *ListenResponse {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	counter.response.status = status
+	return counter.response
+}
+
+// Listens on the given port for inbound traffic (http, tcp, or udp), recording each connection (or datagram) as a receive activity.
+// Stops after maxReceives receive activities, or runs forever if maxReceives is 0. Connections that stay quiet for longer than
+// timeout are closed, so they can't hold the listener open.
+func listenForConnections(activityLog Sink, parent *ActivityLogEntry, port int, protocol string, echo bool, maxReceives int, timeout time.Duration) (*ListenResponse, error) {
+	listenAddr := ":" + strconv.Itoa(port)
+	path := protocol + "://" + listenAddr
+	counter := newReceiveCounter(maxReceives, path)
+
+	switch protocol {
+	case "http":
+		return listenHttp(activityLog, parent, listenAddr, echo, timeout, counter)
+	case "tcp":
+		return listenTcp(activityLog, parent, listenAddr, echo, timeout, counter)
+	case "udp":
+		return listenUdp(activityLog, parent, listenAddr, echo, counter)
+	default:
+		return counter.finish("unknown_protocol"), fmt.Errorf("unknown protocol: %s", protocol)
+	}
+}
+
+// Helper for listening for HTTP requests
+func listenHttp(activityLog Sink, parent *ActivityLogEntry, listenAddr string, echo bool, timeout time.Duration, counter *receiveCounter) (*ListenResponse, error) {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return counter.finish("error"), err
+	}
+	fmt.Printf("Listening for HTTP requests on %s...\n", listener.Addr().String())
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bytesSent := 0
+			if echo {
+				bytesSent, _ = w.Write(body)
+			}
+
+			entry := newChildLogEntry(parent, "receive")
+			entry.status = "received"
+			entry.method = escapeRawText(r.Method)
+			entry.path = escapeRawText("http://" + r.Host + r.RequestURI)
+			entry.sourceAddr, entry.sourcePort = splitAddrAndPort(r.RemoteAddr)
+			entry.destAddr, entry.destPort = splitAddrAndPort(listener.Addr().String())
+			entry.protocol = "http"
+			entry.bytesReceived = len(body)
+			entry.bytesSent = bytesSent
+
+			fmt.Printf("Received %d bytes from %s (%s %s)\n", len(body), r.RemoteAddr, r.Method, r.RequestURI)
+			writeLogEntry(activityLog, entry)
+			counter.add(entry.bytesReceived, entry.bytesSent)
+		}),
+		ReadTimeout: timeout,
+		IdleTimeout: timeout,
+	}
+
+	// Stop serving once we've received enough
+	go func() {
+		<-counter.done
+		server.Shutdown(context.Background())
+	}()
+
+	err = server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return counter.finish("error"), err
+	}
+	return counter.finish("stopped"), nil
+}
+
+// Helper for listening for TCP connections
+func listenTcp(activityLog Sink, parent *ActivityLogEntry, listenAddr string, echo bool, timeout time.Duration, counter *receiveCounter) (*ListenResponse, error) {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return counter.finish("error"), err
+	}
+	fmt.Printf("Listening for TCP connections on %s...\n", listener.Addr().String())
+
+	// Stop accepting once we've received enough
+	go func() {
+		<-counter.done
+		listener.Close()
+	}()
+
+	var connections sync.WaitGroup
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-counter.done:
+				connections.Wait()
+				return counter.finish("stopped"), nil
+			default:
+				listener.Close()
+				connections.Wait()
+				return counter.finish("error"), err
+			}
+		}
+
+		connections.Add(1)
+		go func() {
+			defer connections.Done()
+			defer conn.Close()
+
+			// Read until the sender closes the connection (or goes quiet), echoing as we go
+			bytesReceived := 0
+			bytesSent := 0
+			buffer := make([]byte, 4096)
+			for {
+				conn.SetReadDeadline(time.Now().Add(timeout))
+				n, err := conn.Read(buffer)
+				bytesReceived += n
+				if n > 0 && echo {
+					written, _ := conn.Write(buffer[:n])
+					bytesSent += written
+				}
+				if err != nil {
+					break
+				}
+			}
+
+			entry := newChildLogEntry(parent, "receive")
+			entry.status = "received"
+			entry.sourceAddr, entry.sourcePort = splitAddrAndPort(conn.RemoteAddr().String())
+			entry.destAddr, entry.destPort = splitAddrAndPort(conn.LocalAddr().String())
+			entry.protocol = "tcp"
+			entry.bytesReceived = bytesReceived
+			entry.bytesSent = bytesSent
+
+			fmt.Printf("Received %d bytes from %s\n", bytesReceived, conn.RemoteAddr().String())
+			writeLogEntry(activityLog, entry)
+			counter.add(entry.bytesReceived, entry.bytesSent)
+		}()
+	}
+}
+
+// Helper for listening for UDP datagrams
+func listenUdp(activityLog Sink, parent *ActivityLogEntry, listenAddr string, echo bool, counter *receiveCounter) (*ListenResponse, error) {
+	conn, err := net.ListenPacket("udp", listenAddr)
+	if err != nil {
+		return counter.finish("error"), err
+	}
+	defer conn.Close()
+	fmt.Printf("Listening for UDP datagrams on %s...\n", conn.LocalAddr().String())
+
+	// Stop reading once we've received enough
+	go func() {
+		<-counter.done
+		conn.Close()
+	}()
+
+	buffer := make([]byte, 65536)
+	for {
+		n, remoteAddr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			select {
+			case <-counter.done:
+				return counter.finish("stopped"), nil
+			default:
+				return counter.finish("error"), err
+			}
+		}
+
+		bytesSent := 0
+		if echo {
+			bytesSent, _ = conn.WriteTo(buffer[:n], remoteAddr)
+		}
+
+		entry := newChildLogEntry(parent, "receive")
+		entry.status = "received"
+		entry.sourceAddr, entry.sourcePort = splitAddrAndPort(remoteAddr.String())
+		entry.destAddr, entry.destPort = splitAddrAndPort(conn.LocalAddr().String())
+		entry.protocol = "udp"
+		entry.bytesReceived = n
+		entry.bytesSent = bytesSent
+
+		fmt.Printf("Received %d bytes from %s\n", n, remoteAddr.String())
+		writeLogEntry(activityLog, entry)
+		if counter.add(entry.bytesReceived, entry.bytesSent) {
+			return counter.finish("stopped"), nil
+		}
+	}
+}
+
+// Splits an address string like "100.100.100.100:1234" or "[a100::a600]:1234" into the address (IPv6 kept in brackets, as send records it) and port
+func splitAddrAndPort(addrWithPort string) (string, int) {
+	host, portStr, err := net.SplitHostPort(addrWithPort)
+	if err != nil {
+		return addrWithPort, 0
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		port = 0
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		host = "[" + host + "]"
+	}
+	return host, port
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Listen_Tcp_Echo(t *testing.T) {
+	port := getFreeTestPort(t, "tcp")
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-echo", "-max-receives=1", "listen", strconv.Itoa(port), "tcp"}
+	done := callMainInBackground(args)
+
+	conn := dialTestListener(t, "tcp", port)
+	_, err := conn.Write([]byte("Hello World!"))
+	assert.Nil(t, err)
+	conn.(*net.TCPConn).CloseWrite()
+	echoed, err := io.ReadAll(conn)
+	assert.Nil(t, err)
+	conn.Close()
+
+	output := <-done
+	assert.Equal(t, "Hello World!", string(echoed))
+	assert.Contains(t, output, "Received 12 bytes from")
+	assert.Equal(t, activityLogEntry.activity, "listen")
+	assert.Equal(t, activityLogEntry.status, "stopped")
+	assert.Equal(t, activityLogEntry.bytesReceived, 12)
+	assert.Equal(t, activityLogEntry.bytesSent, 12)
+	assertLogFileContains(t, logFilePath, ",receive,")
+}
+
+func TestMain_Listen_Tcp_Timeout(t *testing.T) {
+	port := getFreeTestPort(t, "tcp")
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// A sender that never closes its end shouldn't hold the listener open
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-listen-timeout=100ms", "-max-receives=1", "listen", strconv.Itoa(port), "tcp"}
+	done := callMainInBackground(args)
+	conn := dialTestListener(t, "tcp", port)
+	defer conn.Close()
+	_, err := conn.Write([]byte("Hello"))
+	assert.Nil(t, err)
+
+	select {
+	case output := <-done:
+		assert.Contains(t, output, "Received 5 bytes from")
+		assert.Equal(t, activityLogEntry.status, "stopped")
+		assert.Equal(t, activityLogEntry.bytesReceived, 5)
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener didn't close the quiet connection")
+	}
+}
+
+func TestMain_Listen_Udp(t *testing.T) {
+	port := getFreeTestPort(t, "udp")
+
+	args := []string{"./noisemaker", "-max-receives=2", "listen", strconv.Itoa(port), "udp"}
+	done := callMainInBackground(args)
+
+	// UDP is fire-and-forget, so keep sending until the listener has received enough
+	conn, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	assert.Nil(t, err)
+	defer conn.Close()
+	var output string
+	for output == "" {
+		conn.Write([]byte("ping"))
+		select {
+		case output = <-done:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	assert.Contains(t, output, "Received 4 bytes from")
+	assert.Equal(t, activityLogEntry.activity, "listen")
+	assert.Equal(t, activityLogEntry.status, "stopped")
+	assert.Equal(t, activityLogEntry.bytesReceived, 8)
+	assert.Equal(t, activityLogEntry.bytesSent, 0)
+}
+
+func TestMain_Listen_Http(t *testing.T) {
+	port := getFreeTestPort(t, "tcp")
+
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-echo", "-max-receives=1", "listen", strconv.Itoa(port)}
+	done := callMainInBackground(args)
+
+	dialTestListener(t, "tcp", port).Close()
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/upload?tags=a,b", port), "text/plain", bytes.NewBufferString("Hello World!"))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	output := <-done
+	assert.Equal(t, "Hello World!", string(body))
+	assert.Contains(t, output, "Received 12 bytes from")
+	assert.Equal(t, activityLogEntry.status, "stopped")
+	assert.Equal(t, activityLogEntry.path, fmt.Sprintf("http://:%d", port))
+	assert.Equal(t, activityLogEntry.bytesReceived, 12)
+
+	// The request's URL is escaped, so it doesn't split the receive entry's columns
+	assertLogFileContains(t, logFilePath, fmt.Sprintf(",http://127.0.0.1:%d/upload?tags=a\\,b,received,", port))
+	assert.Len(t, readTestRunIdsAndSeqs(t, logFilePath), 2)
+}
+
+func TestMain_Listen_UnknownProtocol(t *testing.T) {
+	args := []string{"./noisemaker", "listen", "0", "gopher"}
+	output := callMain(args)
+	assert.Contains(t, output, "unknown protocol: gopher")
+	assert.Equal(t, activityLogEntry.status, "unknown_protocol")
+}
+
+func TestSplitAddrAndPort(t *testing.T) {
+	addr, port := splitAddrAndPort("192.168.1.67:52680")
+	assert.Equal(t, "192.168.1.67", addr)
+	assert.Equal(t, 52680, port)
+
+	addr, port = splitAddrAndPort("[2600:1700:afd0:4ff0::b804]:52671")
+	assert.Equal(t, "[2600:1700:afd0:4ff0::b804]", addr)
+	assert.Equal(t, 52671, port)
+
+	addr, port = splitAddrAndPort("not-an-address")
+	assert.Equal(t, "not-an-address", addr)
+	assert.Equal(t, 0, port)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Diagnostics (ie. how a send's address was resolved, or why a sink couldn't forward an entry) are logged with slog, to stderr, apart
+// from the commands' own console output on stdout. By default only warnings and errors are; -v adds what noisemaker's doing, -vv adds
+// the debugging details, and -quiet leaves out everything but errors.
+
+// Gets the level of diagnostics to log, from the verbosity flags (the most verbose wins)
+func getLogLevel(verbose bool, veryVerbose bool, quiet bool) slog.Level {
+	switch {
+	case veryVerbose:
+		return slog.LevelDebug
+	case verbose:
+		return slog.LevelInfo
+	case quiet:
+		return slog.LevelError
+	}
+	return slog.LevelWarn
+}
+
+// Creates the logger diagnostics are written with, at the given level, as logfmt-style lines
+func newDiagnosticLogger(output io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(output, &slog.HandlerOptions{Level: level}))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLogLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelWarn, getLogLevel(false, false, false))
+	assert.Equal(t, slog.LevelInfo, getLogLevel(true, false, false))
+	assert.Equal(t, slog.LevelDebug, getLogLevel(true, true, false))
+	assert.Equal(t, slog.LevelError, getLogLevel(false, false, true))
+	assert.Equal(t, slog.LevelInfo, getLogLevel(true, false, true))
+}
+
+func TestMain_Verbosity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Diagnostics go to stderr, apart from the console output
+	output, diagnostics := callMainWithDiagnostics([]string{"./noisemaker", "-logfile=" + logFilePath, "-v", "send", "GET", host, port})
+	assert.Contains(t, output, "Sending 0 bytes of data to GET")
+	assert.Contains(t, diagnostics, "level=INFO msg=\"Creating new log file\"")
+	assert.NotContains(t, diagnostics, "level=DEBUG")
+
+	_, diagnostics = callMainWithDiagnostics([]string{"./noisemaker", "-logfile=" + logFilePath, "-vv", "send", "GET", host, port})
+	assert.Contains(t, diagnostics, "level=DEBUG msg=Connected sourceAddr=127.0.0.1")
+
+	// Warnings are logged by default, but not with -quiet
+	_, diagnostics = callMainWithDiagnostics([]string{"./noisemaker", "-logfile=" + logFilePath, "send", "GET", "127.0.0.1", "1"})
+	assert.Contains(t, diagnostics, "level=WARN msg=\"Send attempt failed\" attempt=1")
+	assert.NotContains(t, diagnostics, "level=INFO")
+	_, diagnostics = callMainWithDiagnostics([]string{"./noisemaker", "-logfile=" + logFilePath, "-quiet", "send", "GET", "127.0.0.1", "1"})
+	assert.Equal(t, "", diagnostics)
+}
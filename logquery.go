@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Which entries to pick out of an activity log (shared by log query and log stats)
+type LogFilter struct {
+	activities			[]string
+	statuses			[]string
+	runId				string
+	since				time.Time
+	until				time.Time
+	pathGlob			string
+}
+
+// The flags a LogFilter's parsed from
+type LogFilterFlags struct {
+	activities			*string
+	statuses			*string
+	runId				*string
+	since				*string
+	until				*string
+	pathGlob			*string
+}
+
+// Which entries to pick out of an activity log, and how to print them
+type LogQuery struct {
+	LogFilter
+	path				string
+	columns				[]string
+	format				string
+}
+
+// Response data from log query action
+type LogQueryResponse struct {
+	scanned				int
+	matched				int
+	status				string
+}
+
+// Parses the filters and output options of a log query (ie. --activity=send --since=1h --status=error --path-glob='*.docx'),
+// followed by the log to query (defaulting to defaultPath)
+func parseLogQuery(args []string, defaultPath string, now time.Time) (*LogQuery, error) {
+	flags := flag.NewFlagSet("log query", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	filterFlags := addLogFilterFlags(flags)
+	columns := flags.String("columns", HeaderStr, "comma-separated columns to print (default all)")
+	format := flags.String("format", "csv", "the format to print matching entries in, csv or jsonl (default csv)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log query: %v", err)
+	}
+
+	query := &LogQuery{path: defaultPath, format: *format}
+	if flags.NArg() > 0 {
+		query.path = flags.Arg(0)
+	}
+	query.LogFilter, err = filterFlags.parse(now)
+	if err != nil {
+		return nil, err
+	}
+
+	query.columns = splitList(*columns)
+	allColumns := strings.Split(HeaderStr, ",")
+	for _, column := range query.columns {
+		if !containsString(allColumns, column) {
+			return nil, fmt.Errorf("invalid column '%s' (must be one of %s)", column, HeaderStr)
+		}
+	}
+	if query.format != "csv" && query.format != "jsonl" {
+		return nil, fmt.Errorf("invalid format '%s' (must be csv or jsonl)", query.format)
+	}
+	return query, nil
+}
+
+// Adds the filter flags (--activity, --status, --run-id, --since, --until, and --path-glob) to flags
+func addLogFilterFlags(flags *flag.FlagSet) *LogFilterFlags {
+	return &LogFilterFlags{
+		activities: flags.String("activity", "", "comma-separated activities to match (default any)"),
+		statuses: flags.String("status", "", "comma-separated statuses to match (default any)"),
+		runId: flags.String("run-id", "", "the run ID to match (default any)"),
+		since: flags.String("since", "", "only match entries at or after this time, as a duration ago (ie. 1h) or an RFC3339 timestamp (default any)"),
+		until: flags.String("until", "", "only match entries at or before this time, as a duration ago (ie. 30m) or an RFC3339 timestamp (default any)"),
+		pathGlob: flags.String("path-glob", "", "a glob the path must match, ie. *.docx (matched against just the file name, if it has no slashes) (default any)"),
+	}
+}
+
+// Parses the (already parsed) filter flags' values, with times relative to now
+func (filterFlags *LogFilterFlags) parse(now time.Time) (LogFilter, error) {
+	filter := LogFilter{runId: *filterFlags.runId, pathGlob: *filterFlags.pathGlob}
+	filter.activities = splitList(*filterFlags.activities)
+	filter.statuses = splitList(*filterFlags.statuses)
+	var err error
+	filter.since, err = parseTimeBound(*filterFlags.since, now)
+	if err != nil {
+		return filter, fmt.Errorf("invalid since '%s' (must be a duration, like 1h, or an RFC3339 timestamp)", *filterFlags.since)
+	}
+	filter.until, err = parseTimeBound(*filterFlags.until, now)
+	if err != nil {
+		return filter, fmt.Errorf("invalid until '%s' (must be a duration, like 1h, or an RFC3339 timestamp)", *filterFlags.until)
+	}
+	_, err = path.Match(filter.pathGlob, "")
+	if err != nil {
+		return filter, fmt.Errorf("invalid path-glob '%s': %v", filter.pathGlob, err)
+	}
+	return filter, nil
+}
+
+// Parses a time given as a duration ago (ie. 1h), or as an RFC3339 timestamp; leaves it unset if it's empty
+func parseTimeBound(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return now.Add(-duration), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Splits a comma-separated list, dropping any empty items
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Whether the entry passes every one of the filters
+func (filter *LogFilter) matches(entry *ActivityLogEntry) bool {
+	if len(filter.activities) > 0 && !containsString(filter.activities, unescapeRawText(entry.activity)) {
+		return false
+	}
+	if len(filter.statuses) > 0 && !containsString(filter.statuses, unescapeRawText(entry.status)) {
+		return false
+	}
+	if filter.runId != "" && unescapeRawText(entry.runId) != filter.runId {
+		return false
+	}
+	if !filter.since.IsZero() || !filter.until.IsZero() {
+		timestamp, err := time.Parse(time.RFC3339, entry.timestamp)
+		if err != nil {
+			return false
+		}
+		if !filter.since.IsZero() && timestamp.Before(filter.since) {
+			return false
+		}
+		if !filter.until.IsZero() && timestamp.After(filter.until) {
+			return false
+		}
+	}
+	if filter.pathGlob != "" {
+		entryPath := unescapeRawText(entry.path)
+		if !strings.ContainsAny(filter.pathGlob, "/\\") {
+			// Match just the file name (of Windows paths, too)
+			entryPath = path.Base(strings.ReplaceAll(entryPath, "\\", "/"))
+		}
+		matched, _ := path.Match(filter.pathGlob, entryPath)
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads the log, and prints the query's columns of each matching entry to out, in order
+func runLogQuery(query *LogQuery, out io.Writer) (*LogQueryResponse, error) {
+	response := &LogQueryResponse{status: "error"}
+	parsedLog, err := readLog(query.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			response.status = "not_found"
+		}
+		return response, err
+	}
+
+	allColumns := strings.Split(HeaderStr, ",")
+	if query.format == "csv" {
+		fmt.Fprintln(out, strings.Join(query.columns, ","))
+	}
+	for _, entry := range parsedLog.entries {
+		response.scanned += 1
+		if !query.matches(entry) {
+			continue
+		}
+		response.matched += 1
+		if query.format == "jsonl" {
+			fmt.Fprintf(out, "%s\n", serializeColumnsToJSON(entry, query.columns))
+			continue
+		}
+		values := serializeToCSV(entry)
+		selected := []string{}
+		for _, column := range query.columns {
+			selected = append(selected, values[slices.Index(allColumns, column)])
+		}
+		fmt.Fprintln(out, strings.Join(selected, ","))
+	}
+	response.status = "completed"
+	return response, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a log with a few sends and creates, an hour apart
+func writeTestQueryLog(t *testing.T, path string) {
+	entries := []*ActivityLogEntry{
+		{timestamp: "2024-11-05T12:00:00Z", activity: "send", status: "sent", path: "http://www.google.com:80", runId: "run-1", seq: 1},
+		{timestamp: "2024-11-05T13:00:00Z", activity: "create", status: "created", path: "/home/nick/Documents/report.docx", runId: "run-1", seq: 2},
+		{timestamp: "2024-11-05T14:00:00Z", activity: "send", status: "error", path: "http://INVALID_URL:80", runId: "run-2", seq: 1, details: "no such host\\, retrying"},
+		{timestamp: "2024-11-05T15:00:00Z", activity: "create", status: "error", path: "C:\\Users\\Nick\\notes.docx", runId: "run-2", seq: 2},
+	}
+	contents := getCSVFileHeader()
+	for _, entry := range entries {
+		contents += strings.Join(serializeToCSV(entry), ",") + "\n"
+	}
+	os.WriteFile(path, []byte(contents), 0644)
+}
+
+func TestMain_LogQuery(t *testing.T) {
+	dir := t.TempDir()
+	writeTestQueryLog(t, dir + "/campaign-log.csv")
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "log", "query", "--activity=send", "--status=error", "--columns=timestamp,path,details", dir + "/campaign-log.csv"}
+	output := callMain(args)
+	assert.Contains(t, output, "timestamp,path,details\n2024-11-05T14:00:00Z,http://INVALID_URL:80,no such host\\, retrying\n")
+	assert.Equal(t, activityLogEntry.activity, "log")
+	assert.Equal(t, activityLogEntry.method, "query")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "1 of 4 entries matched")
+}
+
+func TestMain_LogQuery_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "log", "query", dir + "/nonexistent-log.csv"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "not_found")
+}
+
+func TestMain_LogQuery_InvalidFilter(t *testing.T) {
+	args := []string{"./noisemaker", "log", "query", "--since=yesterday"}
+	assertMainPanicsWithMessage(t, args, "invalid since 'yesterday' (must be a duration, like 1h, or an RFC3339 timestamp)")
+}
+
+func TestMain_Log_InvalidCommand(t *testing.T) {
+	args := []string{"./noisemaker", "log", "tail"}
+	assertMainPanicsWithMessage(t, args, "invalid log command specified: tail")
+}
+
+func TestMain_Log_NotEnoughArguments(t *testing.T) {
+	args := []string{"./noisemaker", "log"}
+	assertMainPanicsWithMessage(t, args, "not enough arguments for log! Args: []")
+}
+
+func TestRunLogQuery_Filters(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	writeTestQueryLog(t, logFilePath)
+	now, _ := time.Parse(time.RFC3339, "2024-11-05T16:00:00Z")
+	queryPaths := func(args ...string) []string {
+		query, err := parseLogQuery(append(append(args, "--columns=path"), logFilePath), "", now)
+		assert.Nil(t, err)
+		var out bytes.Buffer
+		_, err = runLogQuery(query, &out)
+		assert.Nil(t, err)
+		return strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+	}
+
+	assert.Equal(t, []string{"/home/nick/Documents/report.docx", "C:\\Users\\Nick\\notes.docx"}, queryPaths("--path-glob=*.docx"))
+	assert.Equal(t, []string{"/home/nick/Documents/report.docx"}, queryPaths("--path-glob=/home/*/Documents/*"))
+	assert.Equal(t, []string{"http://INVALID_URL:80", "C:\\Users\\Nick\\notes.docx"}, queryPaths("--since=2h30m"))
+	assert.Equal(t, []string{"http://www.google.com:80", "/home/nick/Documents/report.docx"}, queryPaths("--until=2024-11-05T13:00:00Z"))
+	assert.Equal(t, []string{"http://INVALID_URL:80", "C:\\Users\\Nick\\notes.docx"}, queryPaths("--run-id=run-2"))
+	assert.Equal(t, []string{"/home/nick/Documents/report.docx", "C:\\Users\\Nick\\notes.docx"}, queryPaths("--activity=create,delete"))
+}
+
+func TestRunLogQuery_JSONL(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	writeTestQueryLog(t, logFilePath)
+	query, err := parseLogQuery([]string{"--status=error", "--columns=activity,seq,details", "--format=jsonl", logFilePath}, "", time.Now())
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	response, err := runLogQuery(query, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, response.matched)
+	assert.Equal(t, `{"activity":"send","seq":1,"details":"no such host, retrying"}` + "\n" + `{"activity":"create","seq":2,"details":""}` + "\n", out.String())
+}
+
+func TestParseLogQuery_Invalid(t *testing.T) {
+	_, err := parseLogQuery([]string{"--columns=timestamp,colour"}, "", time.Now())
+	assert.ErrorContains(t, err, "invalid column 'colour'")
+	_, err = parseLogQuery([]string{"--format=xml"}, "", time.Now())
+	assert.ErrorContains(t, err, "invalid format 'xml' (must be csv or jsonl)")
+	_, err = parseLogQuery([]string{"--path-glob=[docx"}, "", time.Now())
+	assert.ErrorContains(t, err, "invalid path-glob")
+	_, err = parseLogQuery([]string{"--colour=red"}, "", time.Now())
+	assert.ErrorContains(t, err, "invalid log query: flag provided but not defined: -colour")
+}
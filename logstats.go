@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The intervals the timeline's split into, when none's given (the shortest that makes at most AutoTimelineBuckets buckets)
+var TimelineIntervals = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+const AutoTimelineBuckets = 24
+
+// The most buckets a timeline can have (so a short interval over a long campaign doesn't print forever)
+const MaxTimelineBuckets = 1000
+
+// How many destinations are listed in the text summary (the JSON and HTML summaries list them all)
+const MaxReportedDestinations = 20
+
+// How wide the timeline's bars are in the text summary, at their longest
+const TimelineBarWidth = 40
+
+// Which entries to summarize, and how to print the summary
+type LogStatsOptions struct {
+	LogFilter
+	path				string
+	format				string
+	interval			time.Duration		// 0 to pick one from TimelineIntervals
+	outputPath			string				// empty to print it
+}
+
+// A summary of an activity log (or the entries in it that were matched)
+type LogStats struct {
+	Path				string				`json:"path"`
+	Entries				int					`json:"entries"`
+	Errors				int					`json:"errors"`
+	ErrorRate			float64				`json:"errorRate"`
+	BytesSent			int					`json:"bytesSent"`
+	BytesReceived		int					`json:"bytesReceived"`
+	Runs				int					`json:"runs"`
+	First				string				`json:"first"`
+	Last				string				`json:"last"`
+	Activities			[]*ActivityStats	`json:"activities"`
+	Destinations		[]*DestinationStats	`json:"destinations"`
+	Interval			string				`json:"interval"`
+	Timeline			[]*TimelineBucket	`json:"timeline"`
+}
+
+// The totals for one activity
+type ActivityStats struct {
+	Activity			string				`json:"activity"`
+	Entries				int					`json:"entries"`
+	Errors				int					`json:"errors"`
+	ErrorRate			float64				`json:"errorRate"`
+	BytesSent			int					`json:"bytesSent"`
+	BytesReceived		int					`json:"bytesReceived"`
+}
+
+// The totals for one destination (destAddr, and destPort if there is one)
+type DestinationStats struct {
+	Destination			string				`json:"destination"`
+	Entries				int					`json:"entries"`
+	BytesSent			int					`json:"bytesSent"`
+}
+
+// How many entries were logged in one interval of the timeline (starting at Start, in UTC)
+type TimelineBucket struct {
+	Start				string				`json:"start"`
+	Entries				int					`json:"entries"`
+	Errors				int					`json:"errors"`
+	Width				int					`json:"-"`			// the bar's length, out of TimelineBarWidth (or percent, in HTML)
+}
+
+// Response data from log stats action
+type LogStatsResponse struct {
+	stats				*LogStats
+	status				string
+}
+
+// Parses the filters (the same as log query's) and output options of log stats (ie. --run-id=... --format=html --output=report.html),
+// followed by the log to summarize (defaulting to defaultPath)
+func parseLogStatsOptions(args []string, defaultPath string, now time.Time) (*LogStatsOptions, error) {
+	flags := flag.NewFlagSet("log stats", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	filterFlags := addLogFilterFlags(flags)
+	format := flags.String("format", "text", "the format to print the summary in, text, json, or html (default text)")
+	interval := flags.String("interval", "", "the length of each bucket of the timeline, ie. 15m (default picked from the log's time span)")
+	outputPath := flags.String("output", "", "the file to write the summary to (default printed)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log stats: %v", err)
+	}
+
+	options := &LogStatsOptions{path: defaultPath, format: *format, outputPath: *outputPath}
+	if flags.NArg() > 0 {
+		options.path = flags.Arg(0)
+	}
+	options.LogFilter, err = filterFlags.parse(now)
+	if err != nil {
+		return nil, err
+	}
+	if *interval != "" {
+		options.interval, err = time.ParseDuration(*interval)
+		if err != nil || options.interval <= 0 {
+			return nil, fmt.Errorf("invalid interval '%s' (must be a positive duration, like 15m)", *interval)
+		}
+	}
+	if options.format != "text" && options.format != "json" && options.format != "html" {
+		return nil, fmt.Errorf("invalid format '%s' (must be text, json, or html)", options.format)
+	}
+	return options, nil
+}
+
+// Reads the log, summarizes the entries matching the options' filters, and writes the summary to out (or the options' output file)
+func runLogStats(options *LogStatsOptions, out io.Writer) (*LogStatsResponse, error) {
+	response := &LogStatsResponse{status: "error"}
+	parsedLog, err := readLog(options.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			response.status = "not_found"
+		}
+		return response, err
+	}
+
+	entries := []*ActivityLogEntry{}
+	for _, entry := range parsedLog.entries {
+		if options.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	stats, err := summarizeLogEntries(entries, options.interval)
+	if err != nil {
+		return response, err
+	}
+	stats.Path = options.path
+	response.stats = stats
+
+	if options.outputPath != "" {
+		file, err := os.Create(options.outputPath)
+		if err != nil {
+			return response, err
+		}
+		defer file.Close()
+		out = file
+	}
+	switch options.format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(stats)
+	case "html":
+		err = LogStatsHTMLTemplate.Execute(out, stats)
+	default:
+		err = writeLogStatsText(stats, out)
+	}
+	if err != nil {
+		return response, err
+	}
+	response.status = "completed"
+	return response, nil
+}
+
+// Totals up the entries by activity and destination, and counts them over time (in buckets of interval, or one picked to fit)
+func summarizeLogEntries(entries []*ActivityLogEntry, interval time.Duration) (*LogStats, error) {
+	stats := &LogStats{Activities: []*ActivityStats{}, Destinations: []*DestinationStats{}, Timeline: []*TimelineBucket{}}
+	activities := map[string]*ActivityStats{}
+	destinations := map[string]*DestinationStats{}
+	runIds := map[string]bool{}
+	var first, last time.Time
+	timestamps := []time.Time{}
+	for _, entry := range entries {
+		activity := unescapeRawText(entry.activity)
+		isError := isFailureStatus(unescapeRawText(entry.status))
+		if activities[activity] == nil {
+			activities[activity] = &ActivityStats{Activity: activity}
+			stats.Activities = append(stats.Activities, activities[activity])
+		}
+		activityStats := activities[activity]
+		activityStats.Entries += 1
+		activityStats.BytesSent += entry.bytesSent
+		activityStats.BytesReceived += entry.bytesReceived
+		stats.Entries += 1
+		stats.BytesSent += entry.bytesSent
+		stats.BytesReceived += entry.bytesReceived
+		if isError {
+			activityStats.Errors += 1
+			stats.Errors += 1
+		}
+		if entry.runId != "" {
+			runIds[entry.runId] = true
+		}
+
+		if entry.destAddr != "" {
+			destination := unescapeRawText(entry.destAddr)
+			if entry.destPort != 0 {
+				destination = fmt.Sprintf("%s:%d", destination, entry.destPort)
+			}
+			if destinations[destination] == nil {
+				destinations[destination] = &DestinationStats{Destination: destination}
+				stats.Destinations = append(stats.Destinations, destinations[destination])
+			}
+			destinations[destination].Entries += 1
+			destinations[destination].BytesSent += entry.bytesSent
+		}
+
+		// Entries without a valid timestamp are still counted, just not on the timeline
+		timestamp, err := time.Parse(time.RFC3339, entry.timestamp)
+		if err != nil {
+			timestamps = append(timestamps, time.Time{})
+			continue
+		}
+		timestamps = append(timestamps, timestamp)
+		if first.IsZero() || timestamp.Before(first) {
+			first = timestamp
+		}
+		if last.IsZero() || timestamp.After(last) {
+			last = timestamp
+		}
+	}
+	stats.Runs = len(runIds)
+	stats.ErrorRate = getRate(stats.Errors, stats.Entries)
+	for _, activityStats := range stats.Activities {
+		activityStats.ErrorRate = getRate(activityStats.Errors, activityStats.Entries)
+	}
+
+	// Busiest first
+	sort.SliceStable(stats.Activities, func(i, j int) bool {
+		if stats.Activities[i].Entries != stats.Activities[j].Entries {
+			return stats.Activities[i].Entries > stats.Activities[j].Entries
+		}
+		return stats.Activities[i].Activity < stats.Activities[j].Activity
+	})
+	sort.SliceStable(stats.Destinations, func(i, j int) bool {
+		if stats.Destinations[i].Entries != stats.Destinations[j].Entries {
+			return stats.Destinations[i].Entries > stats.Destinations[j].Entries
+		}
+		return stats.Destinations[i].Destination < stats.Destinations[j].Destination
+	})
+
+	if first.IsZero() {
+		return stats, nil
+	}
+	stats.First = first.Format(time.RFC3339)
+	stats.Last = last.Format(time.RFC3339)
+	if interval == 0 {
+		interval = pickTimelineInterval(last.Sub(first))
+	}
+	start := first.UTC().Truncate(interval)
+	bucketCount := int(last.UTC().Sub(start) / interval) + 1
+	if bucketCount > MaxTimelineBuckets {
+		return nil, fmt.Errorf("interval %s would make %d timeline buckets (at most %d)", formatInterval(interval), bucketCount, MaxTimelineBuckets)
+	}
+	stats.Interval = formatInterval(interval)
+	for i := 0; i < bucketCount; i++ {
+		stats.Timeline = append(stats.Timeline, &TimelineBucket{Start: start.Add(time.Duration(i) * interval).Format(time.RFC3339)})
+	}
+	for i, timestamp := range timestamps {
+		if timestamp.IsZero() {
+			continue
+		}
+		bucket := stats.Timeline[int(timestamp.UTC().Sub(start) / interval)]
+		bucket.Entries += 1
+		if isFailureStatus(unescapeRawText(entries[i].status)) {
+			bucket.Errors += 1
+		}
+	}
+	busiest := 0
+	for _, bucket := range stats.Timeline {
+		busiest = max(busiest, bucket.Entries)
+	}
+	for _, bucket := range stats.Timeline {
+		bucket.Width = bucket.Entries * TimelineBarWidth / busiest
+	}
+	return stats, nil
+}
+
+// Gets count as a fraction of total (or 0, if there's nothing to count)
+func getRate(count int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total)
+}
+
+// Picks the shortest interval that splits the span into at most AutoTimelineBuckets buckets (or the longest there is)
+func pickTimelineInterval(span time.Duration) time.Duration {
+	for _, interval := range TimelineIntervals {
+		if span / interval < AutoTimelineBuckets {
+			return interval
+		}
+	}
+	return TimelineIntervals[len(TimelineIntervals) - 1]
+}
+
+// Formats an interval without its zero units (ie. "1h" rather than "1h0m0s")
+func formatInterval(interval time.Duration) string {
+	formatted := interval.String()
+	if strings.HasSuffix(formatted, "m0s") {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if strings.HasSuffix(formatted, "h0m") {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
+
+// Writes the summary as aligned tables: the totals by activity, the busiest destinations, then the timeline
+func writeLogStatsText(stats *LogStats, out io.Writer) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "Summary of %s: %d entries from %d runs", stats.Path, stats.Entries, stats.Runs)
+	if stats.First != "" {
+		fmt.Fprintf(writer, ", %s to %s", stats.First, stats.Last)
+	}
+	fmt.Fprintf(writer, "\n\n")
+
+	fmt.Fprintf(writer, "ACTIVITY\tENTRIES\tERRORS\tERROR RATE\tBYTES SENT\tBYTES RECEIVED\n")
+	for _, activityStats := range stats.Activities {
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%.1f%%\t%d\t%d\n", activityStats.Activity, activityStats.Entries, activityStats.Errors, activityStats.ErrorRate * 100, activityStats.BytesSent, activityStats.BytesReceived)
+	}
+	fmt.Fprintf(writer, "TOTAL\t%d\t%d\t%.1f%%\t%d\t%d\n\n", stats.Entries, stats.Errors, stats.ErrorRate * 100, stats.BytesSent, stats.BytesReceived)
+
+	fmt.Fprintf(writer, "DESTINATION (%d UNIQUE)\tENTRIES\tBYTES SENT\n", len(stats.Destinations))
+	for i, destination := range stats.Destinations {
+		if i == MaxReportedDestinations {
+			fmt.Fprintf(writer, "(and %d more)\t\t\n", len(stats.Destinations) - MaxReportedDestinations)
+			break
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%d\n", destination.Destination, destination.Entries, destination.BytesSent)
+	}
+
+	if len(stats.Timeline) > 0 {
+		fmt.Fprintf(writer, "\nTIMELINE (%s BUCKETS)\tENTRIES\tERRORS\n", stats.Interval)
+		for _, bucket := range stats.Timeline {
+			fmt.Fprintf(writer, "%s\t%d\t%d\t%s\n", bucket.Start, bucket.Entries, bucket.Errors, strings.Repeat("#", bucket.Width))
+		}
+	}
+	return writer.Flush()
+}
+
+// A standalone page with the same tables as the text summary (with the timeline drawn as bars)
+var LogStatsHTMLTemplate = template.Must(template.New("log stats").Funcs(template.FuncMap{
+	"percent": func(rate float64) string { return fmt.Sprintf("%.1f%%", rate * 100) },
+	"barWidth": func(width int) int { return width * 100 / TimelineBarWidth },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>noisemaker activity summary: {{.Path}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.75em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.bar { background: #4a7ebb; height: 1em; }
+.errors { background: #c0392b; height: 1em; }
+</style>
+</head>
+<body>
+<h1>Activity summary</h1>
+<p>{{.Path}}: {{.Entries}} entries from {{.Runs}} runs{{if .First}}, {{.First}} to {{.Last}}{{end}}</p>
+<h2>Activities</h2>
+<table>
+<tr><th>Activity</th><th>Entries</th><th>Errors</th><th>Error rate</th><th>Bytes sent</th><th>Bytes received</th></tr>
+{{range .Activities}}<tr><td>{{.Activity}}</td><td>{{.Entries}}</td><td>{{.Errors}}</td><td>{{percent .ErrorRate}}</td><td>{{.BytesSent}}</td><td>{{.BytesReceived}}</td></tr>
+{{end}}<tr><th>Total</th><th>{{.Entries}}</th><th>{{.Errors}}</th><th>{{percent .ErrorRate}}</th><th>{{.BytesSent}}</th><th>{{.BytesReceived}}</th></tr>
+</table>
+<h2>Destinations ({{len .Destinations}} unique)</h2>
+<table>
+<tr><th>Destination</th><th>Entries</th><th>Bytes sent</th></tr>
+{{range .Destinations}}<tr><td>{{.Destination}}</td><td>{{.Entries}}</td><td>{{.BytesSent}}</td></tr>
+{{end}}</table>
+{{if .Timeline}}<h2>Timeline ({{.Interval}} buckets)</h2>
+<table>
+<tr><th>Start (UTC)</th><th>Entries</th><th>Errors</th><th style="width: 20em"></th></tr>
+{{range .Timeline}}<tr><td>{{.Start}}</td><td>{{.Entries}}</td><td>{{.Errors}}</td><td style="text-align: left"><div class="{{if .Errors}}errors{{else}}bar{{end}}" style="width: {{barWidth .Width}}%"></div></td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
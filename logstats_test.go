@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a log of a short campaign: a few sends (one failed) to two destinations, a listen, and a create, over 20 minutes
+func writeTestStatsLog(t *testing.T, path string) {
+	entries := []*ActivityLogEntry{
+		{timestamp: "2024-11-05T12:00:00Z", activity: "send", status: "sent", destAddr: "www.google.com", destPort: 80, bytesSent: 100, runId: "run-1", seq: 1},
+		{timestamp: "2024-11-05T12:01:00Z", activity: "send", status: "sent", destAddr: "www.google.com", destPort: 80, bytesSent: 50, runId: "run-1", seq: 2},
+		{timestamp: "2024-11-05T12:07:00Z", activity: "send", status: "send_failed", destAddr: "10.0.0.5", destPort: 443, runId: "run-1", seq: 3},
+		{timestamp: "2024-11-05T12:12:00Z", activity: "listen", status: "received", bytesReceived: 12, runId: "run-2", seq: 1},
+		{timestamp: "2024-11-05T12:20:00Z", activity: "create", status: "created", path: "/tmp/test.txt", runId: "run-2", seq: 2},
+	}
+	contents := getCSVFileHeader()
+	for _, entry := range entries {
+		contents += strings.Join(serializeToCSV(entry), ",") + "\n"
+	}
+	os.WriteFile(path, []byte(contents), 0644)
+}
+
+func TestMain_LogStats(t *testing.T) {
+	dir := t.TempDir()
+	writeTestStatsLog(t, dir + "/campaign-log.csv")
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "log", "stats", dir + "/campaign-log.csv"}
+	output := callMain(args)
+	assert.Contains(t, output, "Summary of " + dir + "/campaign-log.csv: 5 entries from 2 runs, 2024-11-05T12:00:00Z to 2024-11-05T12:20:00Z\n")
+	assert.Contains(t, output, "send      3        1       33.3%       150         0\n")
+	assert.Contains(t, output, "TOTAL     5        1       20.0%       150         12\n")
+	assert.Contains(t, output, "www.google.com:80       2        150\n")
+	assert.Contains(t, output, "TIMELINE (1m BUCKETS)")
+	assert.Equal(t, activityLogEntry.activity, "log")
+	assert.Equal(t, activityLogEntry.method, "stats")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "5 entries summarized (3 activities\\, 2 unique destinations)")
+}
+
+func TestMain_LogStats_HTMLOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeTestStatsLog(t, dir + "/campaign-log.csv")
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "log", "stats", "--format=html", "--output=" + dir + "/summary.html", dir + "/campaign-log.csv"}
+	output := callMain(args)
+	assert.Contains(t, output, "Wrote summary of log file " + dir + "/campaign-log.csv to " + dir + "/summary.html\n")
+	assert.NotContains(t, output, "<html>")
+	contents, err := readTestFile(dir + "/summary.html")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(contents, "<!DOCTYPE html>\n"))
+	assert.Contains(t, contents, "<tr><td>send</td><td>3</td><td>1</td><td>33.3%</td><td>150</td><td>0</td></tr>")
+	assert.Contains(t, contents, "<h2>Destinations (2 unique)</h2>")
+	assert.Equal(t, activityLogEntry.status, "completed")
+}
+
+func TestMain_LogStats_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "log", "stats", dir + "/nonexistent-log.csv"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "not_found")
+}
+
+func TestRunLogStats_JSON(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	writeTestStatsLog(t, logFilePath)
+	options, err := parseLogStatsOptions([]string{"--format=json", "--interval=10m", "--run-id=run-1", logFilePath}, "", time.Now())
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	_, err = runLogStats(options, &out)
+	assert.Nil(t, err)
+	stats := map[string]any{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &stats))
+	assert.Equal(t, float64(3), stats["entries"])
+	assert.Equal(t, float64(150), stats["bytesSent"])
+	assert.Equal(t, "10m", stats["interval"])
+	assert.Equal(t, []any{
+		map[string]any{"destination": "www.google.com:80", "entries": float64(2), "bytesSent": float64(150)},
+		map[string]any{"destination": "10.0.0.5:443", "entries": float64(1), "bytesSent": float64(0)},
+	}, stats["destinations"])
+	assert.Equal(t, []any{
+		map[string]any{"start": "2024-11-05T12:00:00Z", "entries": float64(3), "errors": float64(1)},
+	}, stats["timeline"])
+}
+
+func TestSummarizeLogEntries_Timeline(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	writeTestStatsLog(t, logFilePath)
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+
+	// Empty buckets are kept, so the gaps show
+	stats, err := summarizeLogEntries(parsedLog.entries, 5 * time.Minute)
+	assert.Nil(t, err)
+	counts := []int{}
+	for _, bucket := range stats.Timeline {
+		counts = append(counts, bucket.Entries)
+	}
+	assert.Equal(t, []int{2, 1, 1, 0, 1}, counts)
+	assert.Equal(t, "2024-11-05T12:15:00Z", stats.Timeline[3].Start)
+	assert.Equal(t, TimelineBarWidth, stats.Timeline[0].Width)
+
+	_, err = summarizeLogEntries(parsedLog.entries, time.Millisecond)
+	assert.ErrorContains(t, err, "timeline buckets (at most 1000)")
+}
+
+func TestPickTimelineInterval(t *testing.T) {
+	assert.Equal(t, time.Minute, pickTimelineInterval(0))
+	assert.Equal(t, time.Minute, pickTimelineInterval(20 * time.Minute))
+	assert.Equal(t, 15 * time.Minute, pickTimelineInterval(3 * time.Hour))
+	assert.Equal(t, 24 * time.Hour, pickTimelineInterval(7 * 24 * time.Hour))
+	assert.Equal(t, 7 * 24 * time.Hour, pickTimelineInterval(365 * 24 * time.Hour))
+	assert.Equal(t, "1h", formatInterval(time.Hour))
+	assert.Equal(t, "1h30m", formatInterval(90 * time.Minute))
+}
+
+func TestParseLogStatsOptions_Invalid(t *testing.T) {
+	_, err := parseLogStatsOptions([]string{"--format=pdf"}, "", time.Now())
+	assert.ErrorContains(t, err, "invalid format 'pdf' (must be text, json, or html)")
+	_, err = parseLogStatsOptions([]string{"--interval=-5m"}, "", time.Now())
+	assert.ErrorContains(t, err, "invalid interval '-5m'")
+	_, err = parseLogStatsOptions([]string{"--since=yesterday"}, "", time.Now())
+	assert.ErrorContains(t, err, "invalid since 'yesterday'")
+}
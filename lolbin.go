@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The URL the lolbins that download fetch, by default (nothing's served there, unless you serve it)
+const DefaultLOLBinURL = "http://127.0.0.1/noisemaker-lolbin.txt"
+
+// The contents of the harmless input file the lolbins that read a file are given
+const LOLBinInput = "noisemaker lolbin input\n"
+
+// A benign living-off-the-land binary invocation: a built-in tool used the way an intruder would, but on something harmless. Its args
+// can use {url} (the URL to fetch), {dir} (a temporary directory for anything it writes), and {input} (a harmless file in {dir}).
+type LOLBin struct {
+	name				string
+	platforms			[]string	// the OSes it's run on
+	cmd					string
+	args				[]string
+	techniques			[]string	// the MITRE ATT&CK techniques it simulates
+	description			string
+}
+
+// The catalog of lolbins, selected by name (some have a version for each OS, with the same name)
+var LOLBins = []LOLBin{
+	{"certutil-urlcache", []string{"windows"}, "certutil.exe", []string{"-urlcache", "-split", "-f", "{url}", `{dir}\noisemaker.txt`}, []string{"T1105"}, "Downloads a file with certutil's URL cache"},
+	{"certutil-encode", []string{"windows"}, "certutil.exe", []string{"-encode", "{input}", `{dir}\noisemaker.b64`}, []string{"T1027", "T1140"}, "Base64-encodes a file with certutil"},
+	{"bitsadmin", []string{"windows"}, "bitsadmin.exe", []string{"/transfer", "noisemaker", "/download", "/priority", "normal", "{url}", `{dir}\noisemaker.txt`}, []string{"T1197", "T1105"}, "Downloads a file with a BITS job"},
+	{"mshta", []string{"windows"}, "mshta.exe", []string{"javascript:close();"}, []string{"T1218.005"}, "Runs an inline script (that just closes itself) with mshta"},
+	{"curl", []string{"windows"}, "curl.exe", []string{"-s", "-o", `{dir}\noisemaker.txt`, "{url}"}, []string{"T1105"}, "Downloads a file with curl"},
+	{"curl", []string{"linux", "darwin"}, "curl", []string{"-s", "-o", "{dir}/noisemaker.txt", "{url}"}, []string{"T1105"}, "Downloads a file with curl"},
+	{"wget", []string{"linux"}, "wget", []string{"-q", "-O", "{dir}/noisemaker.txt", "{url}"}, []string{"T1105"}, "Downloads a file with wget"},
+	{"python", []string{"windows"}, "python.exe", []string{"-c", "import getpass, platform; print(getpass.getuser(), platform.node())"}, []string{"T1059.006"}, "Runs an inline Python one-liner that prints the user and host"},
+	{"python", []string{"linux", "darwin"}, "python3", []string{"-c", "import getpass, platform; print(getpass.getuser(), platform.node())"}, []string{"T1059.006"}, "Runs an inline Python one-liner that prints the user and host"},
+	{"base64", []string{"linux"}, "base64", []string{"{input}"}, []string{"T1027"}, "Base64-encodes a file, as staged data is obfuscated"},
+	{"base64", []string{"darwin"}, "base64", []string{"-i", "{input}"}, []string{"T1027"}, "Base64-encodes a file, as staged data is obfuscated"},
+	{"osascript", []string{"darwin"}, "osascript", []string{"-e", `return "noisemaker"`}, []string{"T1059.002"}, "Runs an inline AppleScript that just returns a string"},
+}
+
+// Options for the lolbin command
+type LOLBinOptions struct {
+	name				string		// the lolbin to run ("list" to list them)
+	url					string
+}
+
+// Response data from lolbin action
+type LOLBinResponse struct {
+	commandLine			string
+	processId			int
+	bytesReceived		int
+	status				string
+}
+
+// Parses lolbin's arguments: [-url=(url)] (name|list)
+func parseLOLBinOptions(args []string) (*LOLBinOptions, error) {
+	flags := flag.NewFlagSet("lolbin", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	lolbinURL := flags.String("url", DefaultLOLBinURL, "the URL the lolbins that download fetch")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lolbin: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for lolbin! Args: %v", args)
+	}
+	return &LOLBinOptions{name: flags.Arg(0), url: *lolbinURL}, nil
+}
+
+// Gets the lolbins for the given OS, in catalog order
+func getLOLBins(goos string) []LOLBin {
+	lolbins := []LOLBin{}
+	for _, lolbin := range LOLBins {
+		if containsString(lolbin.platforms, goos) {
+			lolbins = append(lolbins, lolbin)
+		}
+	}
+	return lolbins
+}
+
+// Looks up the lolbin with the given name, for the given OS
+func getLOLBin(goos string, name string) (*LOLBin, error) {
+	names := []string{}
+	for _, lolbin := range getLOLBins(goos) {
+		if lolbin.name == name {
+			return &lolbin, nil
+		}
+		names = append(names, lolbin.name)
+	}
+	return nil, fmt.Errorf("unknown lolbin '%s' for %s (must be one of %s)", name, goos, strings.Join(names, ", "))
+}
+
+// Prints each of the lolbins for the given OS: its name, techniques, and description, and its command line
+func listLOLBins(output io.Writer, goos string) int {
+	lolbins := getLOLBins(goos)
+	for _, lolbin := range lolbins {
+		fmt.Fprintf(output, "%s (%s): %s\n", lolbin.name, strings.Join(lolbin.techniques, ", "), lolbin.description)
+		fmt.Fprintf(output, "    %s\n", strings.Join(append([]string{lolbin.cmd}, lolbin.args...), " "))
+	}
+	return len(lolbins)
+}
+
+// Gets the lolbin's args, with its placeholders filled in
+func expandLOLBinArgs(lolbin *LOLBin, lolbinURL string, dir string, input string) []string {
+	replacer := strings.NewReplacer("{url}", lolbinURL, "{dir}", dir, "{input}", input)
+	args := []string{}
+	for _, arg := range lolbin.args {
+		args = append(args, replacer.Replace(arg))
+	}
+	return args
+}
+
+// Runs the lolbin with its placeholders filled in, in a temporary directory (with the harmless input file in it) that's removed
+// afterwards, logging it as an execute activity (with its exact command line) sharing the parent's correlation ID
+func runLOLBin(activityLog Sink, parent *ActivityLogEntry, lolbin *LOLBin, lolbinURL string) *LOLBinResponse {
+	response := &LOLBinResponse{commandLine: strings.Join(append([]string{lolbin.cmd}, lolbin.args...), " ")}
+	dir, err := os.MkdirTemp("", "noisemaker-lolbin-*")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = "error"
+		return response
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "noisemaker-input.txt")
+	if err = os.WriteFile(input, []byte(LOLBinInput), 0600); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = "error"
+		return response
+	}
+
+	args := expandLOLBinArgs(lolbin, lolbinURL, dir, input)
+	response.commandLine = strings.Join(append([]string{lolbin.cmd}, args...), " ")
+	entry := newChildLogEntry(parent, "execute")
+	entry.processCmd = escapeCommandString(lolbin.cmd, args)
+	entry.details = escapeRawText(strings.Join(lolbin.techniques, " "))
+
+	fmt.Printf("Running %s (%s)...\n", response.commandLine, lolbin.name)
+	cmd := exec.CommandContext(runContext, lolbin.cmd, args...)
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		fmt.Printf("%s\n", strings.TrimSpace(string(output)))
+	}
+	if cmd.ProcessState != nil {
+		response.processId = cmd.ProcessState.Pid()
+	}
+	response.bytesReceived = len(output)
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		response.status = exitErr.ProcessState.String()
+	} else if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = "unable_to_run"
+	} else {
+		response.status = "exit status 0"
+	}
+	entry.processId = response.processId
+	entry.bytesReceived = response.bytesReceived
+	entry.status = response.status
+	writeLogEntry(activityLog, entry)
+	return response
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_LOLBin(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "lolbin", "base64"})
+	assert.Contains(t, output, base64.StdEncoding.EncodeToString([]byte(LOLBinInput)))
+	assert.Equal(t, activityLogEntry.activity, "lolbin")
+	assert.Equal(t, activityLogEntry.path, "base64")
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	assert.True(t, strings.HasPrefix(activityLogEntry.details, "T1027: Base64-encodes a file\\, as staged data is obfuscated\\, command base64 /"))
+	assert.NotZero(t, activityLogEntry.processId)
+
+	// Its exact command line is logged as an execute, linked to the lolbin (which is what's replayed)
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 2)
+	execute := parsedLog.entries[0]
+	assert.Equal(t, "execute", execute.activity)
+	assert.True(t, strings.HasPrefix(execute.processCmd, "base64 /"))
+	assert.True(t, strings.HasSuffix(execute.processCmd, "/noisemaker-input.txt"))
+	assert.Equal(t, "T1027", execute.details)
+	assert.Equal(t, activityLogEntry.correlationId, execute.correlationId)
+	steps, err := loadReplaySteps(&ReplayOptions{path: logFilePath, speed: 1})
+	assert.Nil(t, err)
+	assert.Len(t, steps, 1)
+	assert.Equal(t, "lolbin", steps[0].command)
+}
+
+func TestMain_LOLBin_URL(t *testing.T) {
+	requested := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "lolbin", "-url=" + server.URL + "/payload.txt", "curl"})
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	assert.Equal(t, "/payload.txt", requested)
+	assert.Contains(t, activityLogEntry.details, server.URL + "/payload.txt")
+}
+
+func TestMain_LOLBin_List(t *testing.T) {
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "lolbin", "list"})
+	assert.Contains(t, output, "curl (T1105): Downloads a file with curl\n    curl -s -o {dir}/noisemaker.txt {url}\n")
+	assert.Equal(t, activityLogEntry.method, "list")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, fmt.Sprintf("%d lolbins", len(getLOLBins(runtime.GOOS))))
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "lolbin", "certutil-urlcache"}, "unknown lolbin 'certutil-urlcache' for " + runtime.GOOS + " (must be one of curl, ")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "lolbin"}, "not enough arguments for lolbin! Args: []")
+}
+
+func TestGetLOLBins(t *testing.T) {
+	// Every lolbin is mapped to a technique, and a name's only used once per OS
+	for _, goos := range []string{"windows", "linux", "darwin"} {
+		names := map[string]bool{}
+		for _, lolbin := range getLOLBins(goos) {
+			assert.NotEmpty(t, lolbin.techniques)
+			assert.False(t, names[lolbin.name], lolbin.name)
+			names[lolbin.name] = true
+		}
+	}
+	lolbin, err := getLOLBin("windows", "certutil-urlcache")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-urlcache", "-split", "-f", "http://10.0.0.5/a.txt", `C:\Temp\nm\noisemaker.txt`}, expandLOLBinArgs(lolbin, "http://10.0.0.5/a.txt", `C:\Temp\nm`, `C:\Temp\nm\noisemaker-input.txt`))
+}
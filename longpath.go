@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Windows' MAX_PATH: the most characters a path can have (with its terminating null) for anything that doesn't use \\?\ paths
+const MaxPath = 260
+
+// The name of each directory -depth nests the file in
+const NestedDirName = "nested"
+
+// The longest name given each of the directories -path-length pads the path out with (under the 255 most filesystems take)
+const MaxLongPathDirName = 200
+
+// What the directories -path-length pads the path out with are named, repeated to their length
+const LongPathDirName = "longpath"
+
+// Stressing how sensors handle paths that are long, or deep (as many truncate, or drop, the events for them)
+type PathStressOptions struct {
+	depth				int			// how many directories to nest the file in (or 0)
+	pathLength			int			// the length (in characters) to pad the whole path out to with long directories (or 0)
+}
+
+// Adds the -depth and -path-length flags to a command's flags, returning a function that gets the options they give (nil without any)
+func addPathStressFlags(flags *flag.FlagSet) func() (*PathStressOptions, error) {
+	depth := flags.Int("depth", 0, "nests the file in this many directories (default 0, none)")
+	pathLength := flags.Int("path-length", 0, "pads the path out to this many characters with long directories, ie. 261 for just over MAX_PATH (default 0, none)")
+	return func() (*PathStressOptions, error) {
+		if *depth == 0 && *pathLength == 0 {
+			return nil, nil
+		}
+		if *depth < 0 {
+			return nil, fmt.Errorf("invalid -depth %d (must be 0 or more)", *depth)
+		}
+		if *pathLength < 0 {
+			return nil, fmt.Errorf("invalid -path-length %d (must be 0 or more)", *pathLength)
+		}
+		return &PathStressOptions{depth: *depth, pathLength: *pathLength}, nil
+	}
+}
+
+// Nests the file at the end of the path in -depth directories, and then in as many long ones as pad the path out to -path-length,
+// returning the new path and the directories to create for it (outermost first)
+func (options *PathStressOptions) apply(path string) (string, []string) {
+	dir, name := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	dirs := []string{}
+	for i := 0; i < options.depth; i++ {
+		dir = filepath.Join(dir, NestedDirName)
+		dirs = append(dirs, dir)
+	}
+	for {
+		// (each directory takes its name's length, and a separator)
+		missing := options.pathLength - utf8.RuneCountInString(filepath.Join(dir, name))
+		if missing < 2 {
+			if missing == 1 {
+				// (too short for a directory, so the name's padded instead)
+				extension := filepath.Ext(name)
+				name = strings.TrimSuffix(name, extension) + "_" + extension
+			}
+			break
+		}
+		length := min(missing - 1, MaxLongPathDirName)
+		if missing - (length + 1) == 1 {
+			// (leaving room for the last directory)
+			length -= 1
+		}
+		dir = filepath.Join(dir, strings.Repeat(LongPathDirName, length / len(LongPathDirName) + 1)[:length])
+		dirs = append(dirs, dir)
+	}
+	return filepath.Join(dir, name), dirs
+}
+
+// Gets the labels the path is recorded with: long-path=true if it's over MAX_PATH, and deep-path=true if it's nested with -depth
+func (options *PathStressOptions) getLabels(labels string, path string) string {
+	if utf8.RuneCountInString(path) >= MaxPath {
+		labels = addLabel(labels, "long-path", "true")
+	}
+	if options.depth > 0 {
+		labels = addLabel(labels, "deep-path", "true")
+	}
+	return labels
+}
+
+// Creates each of the directories (outermost first) that doesn't exist yet, tracking them to be deleted (innermost first), and
+// returning how many the OS accepted before one failed (including any already there)
+func createNestedDirs(entry *ActivityLogEntry, dirs []string) (int, string, error) {
+	created := 0
+	for i, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			continue
+		}
+		err := os.Mkdir(dir, 0755)
+		if err != nil {
+			fmt.Printf("Error: %v (after creating %d directories)\n", err, created)
+			return i, getPathErrorStatus(err), err
+		}
+		trackArtifact(entry, "file", dir, "delete", dir)
+		created += 1
+	}
+	fmt.Printf("Created %d directories, %d deep\n", created, len(dirs))
+	return len(dirs), "created", nil
+}
+
+// Gets the status for an error creating a path: too_long if the OS rejected it for its length, or else as getFileErrorStatus has it
+func getPathErrorStatus(err error) string {
+	if isPathTooLong(err) {
+		return "too_long"
+	}
+	return getFileErrorStatus(err)
+}
+
+// Describes a stressed path for an entry's details, ie. `path 300 characters (over MAX_PATH, 260), 12 of 12 directories accepted`
+func getPathStressDetails(path string, dirs []string, accepted int) string {
+	length := utf8.RuneCountInString(path)
+	comparison := "under"
+	if length >= MaxPath {
+		comparison = "over"
+	}
+	return fmt.Sprintf("path %d characters (%s MAX_PATH, %d), %d of %d directories accepted", length, comparison, MaxPath, accepted, len(dirs))
+}
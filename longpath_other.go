@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Whether the OS rejected a path for being too long (past PATH_MAX, or with a name past NAME_MAX)
+func isPathTooLong(err error) bool {
+	return errors.Is(err, syscall.ENAMETOOLONG)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Create_LongPath(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// Just over MAX_PATH, with the path created as the entry's path
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-path-length=261", dir + "/report.txt", "hello"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.Len(t, activityLogEntry.path, 261)
+	assert.True(t, strings.HasSuffix(activityLogEntry.path, "/report.txt"))
+	assert.FileExists(t, activityLogEntry.path)
+	assert.Equal(t, "long-path=true", activityLogEntry.labels)
+	assert.Regexp(t, "^path 261 characters \\(over MAX_PATH\\\\, 260\\)\\\\, [0-9]+ of [0-9]+ directories accepted$", activityLogEntry.details)
+
+	// Each directory's tracked, to be deleted after the file
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-depth=3", dir + "/deep.txt"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.Equal(t, dir + "/nested/nested/nested/deep.txt", activityLogEntry.path)
+	assert.Equal(t, "deep-path=true", activityLogEntry.labels)
+	assert.Equal(t, fmt.Sprintf("path %d characters (under MAX_PATH\\, 260)\\, 3 of 3 directories accepted", len(dir) + 30), activityLogEntry.details)
+	artifacts, err := readArtifactManifest(dir + "/noisemaker-artifacts.jsonl", "")
+	assert.Nil(t, err)
+	targets := []string{}
+	for _, artifact := range artifacts[len(artifacts) - 4:] {
+		targets = append(targets, artifact.Target)
+	}
+	assert.Equal(t, []string{dir + "/nested", dir + "/nested/nested", dir + "/nested/nested/nested", dir + "/nested/nested/nested/deep.txt"}, targets)
+
+	// (the directories already there are used as they are)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-depth=2", dir + "/shallow.txt"})
+	assert.Equal(t, "created", activityLogEntry.status)
+
+	if runtime.GOOS != "windows" {
+		// Past what the OS takes, it records how deep it got
+		callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-depth=1000", dir + "/deepest.txt"})
+		assert.Equal(t, "too_long", activityLogEntry.status)
+		assert.Equal(t, "long-path=true;deep-path=true", activityLogEntry.labels)
+		assert.Regexp(t, "directories accepted$", activityLogEntry.details)
+		assert.NotContains(t, activityLogEntry.details, "1000 of 1000")
+	}
+}
+
+func TestPathStressOptions_Apply(t *testing.T) {
+	path, dirs := (&PathStressOptions{depth: 2}).apply("/tmp/report.txt")
+	assert.Equal(t, filepath.FromSlash("/tmp/nested/nested/report.txt"), path)
+	assert.Equal(t, []string{filepath.FromSlash("/tmp/nested"), filepath.FromSlash("/tmp/nested/nested")}, dirs)
+
+	// The path's padded out to exactly its length, whatever's left over
+	for _, length := range []int{17, 18, 19, 20, 259, 260, 261, 402, 403, 404, 1000} {
+		path, dirs = (&PathStressOptions{pathLength: length}).apply("/tmp/report.txt")
+		assert.Len(t, path, length)
+		for _, dir := range dirs {
+			assert.LessOrEqual(t, len(filepath.Base(dir)), MaxLongPathDirName)
+			assert.True(t, strings.HasPrefix(path, dir))
+		}
+	}
+
+	// (or left as it is, if it's already that long)
+	path, dirs = (&PathStressOptions{pathLength: 10}).apply("/tmp/report.txt")
+	assert.Equal(t, filepath.FromSlash("/tmp/report.txt"), path)
+	assert.Empty(t, dirs)
+}
+
+func TestAddPathStressFlags(t *testing.T) {
+	parse := func(args ...string) (*PathStressOptions, error) {
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		getPathStress := addPathStressFlags(flags)
+		assert.Nil(t, flags.Parse(args))
+		return getPathStress()
+	}
+	options, err := parse()
+	assert.Nil(t, err)
+	assert.Nil(t, options)
+	options, err = parse("-depth=50", "-path-length=300")
+	assert.Nil(t, err)
+	assert.Equal(t, &PathStressOptions{depth: 50, pathLength: 300}, options)
+
+	_, err = parse("-depth=-1")
+	assert.ErrorContains(t, err, "invalid -depth -1 (must be 0 or more)")
+	_, err = parse("-path-length=-1")
+	assert.ErrorContains(t, err, "invalid -path-length -1 (must be 0 or more)")
+}
+
+func TestMain_Create_Depth_Cleanup(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// The file's deleted, and then each directory, innermost first
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", "-depth=3", dir + "/deep.txt"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "cleanup"})
+	assert.Equal(t, "completed", activityLogEntry.status)
+	assert.NoDirExists(t, dir + "/nested")
+
+	// (a directory with something else in it is left as it is)
+	assert.Nil(t, os.Mkdir(dir + "/full", 0755))
+	assert.Nil(t, os.WriteFile(dir + "/full/keep.txt", []byte("keep"), 0644))
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "delete", dir + "/full"})
+	assert.Equal(t, "not_found", activityLogEntry.status)
+	assert.FileExists(t, dir + "/full/keep.txt")
+}
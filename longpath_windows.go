@@ -0,0 +1,14 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// The error Windows gives for a path past MAX_PATH, where it isn't given as a \\?\ path (ERROR_FILENAME_EXCED_RANGE)
+const errorFileNameExceedsRange = syscall.Errno(206)
+
+// Whether the OS rejected a path for being too long (past MAX_PATH, or with a name past the 255 characters NTFS takes)
+func isPathTooLong(err error) bool {
+	return errors.Is(err, errorFileNameExceedsRange)
+}
@@ -4,27 +4,33 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"encoding/csv"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-const HeaderStr = "timestamp,activity,os,username,processName,processCmd,pid,path,status,method,sourceAddr,sourcePort,destAddr,destPort,bytesSent,protocol"
+const HeaderStr = "timestamp,activity,os,username,processName,processCmd,pid,path,status,method,sourceAddr,sourcePort,destAddr,destPort,bytesSent,protocol,attempt,bytesReceived,details,correlationId,runId,seq,hostname,hostIPs,machineId,note,labels,signature,elevated,dnsTime,tlsVersion,tlsCipher"
 
 type ActivityLogEntry struct {
 	timestamp   		string  `csv:"timestamp"`   		// RFC3339 timestamp
-	activity    		string  `csv:"activity"`    		// [execute, create, modify, delete, send]
+	activity    		string  `csv:"activity"`    		// [execute, create, modify, delete, send, listen, receive, scan, connect, netenum, discover, discovery, credprobe, access, procaccess, pipe, useradd, userdel, groupadd, groupdel, screenshot, stage, exfil, playbook, daemon, control, dispatch, collect, migrate-log, verify, log, replay, compare, verify-signatures, decrypt-log, generate, scenario, resume, shutdown, cleanup, ssh, remote-exec, read, k8sprobe, k8s-api, containerprobe, shred, hosts, browser, dropper, download, lolbin, fileless, inject, inputhook, avdevice, beacon, dga, traffic, doctor, capabilities, action, script, fuzz, run-start, run-end, heartbeat, watch, observe, decoy, edgenames]
 	os	        		string  `csv:"os"`          		// operating system name
 	username    		string  `csv:"username"`    		// current username
 	processName 		string  `csv:"processName"` 		// process name
@@ -34,15 +40,36 @@ type ActivityLogEntry struct {
 	path   				string  `csv:"path"`   				// path to the file (also used by "send" to include the full URL)
 	status 				string  `csv:"status"` 				// [created, modified, deleted, sent, not_found, invalid_path, no_access, error]
 	// send only:
-	method	   			string  `csv:"method"`	 			// method (GET, POST, etc.)
+	method	   			string  `csv:"method"`	 			// method (GET, POST, etc.; also used by "pipe" for create or connect)
 	sourceAddr 			string  `csv:"sourceAddr"` 			// source IP address (resolved)
 	sourcePort 			int     `csv:"sourcePort"` 			// source port
 	destAddr   			string  `csv:"destAddr"`   			// destination IP address (resolved)
 	destPort   			int     `csv:"destPort"`   			// destination port
 	bytesSent  			int     `csv:"bytesSent"`  			// number of bytes transmitted
 	protocol   			string  `csv:"protocol"`   			// the protocol used (http:, ftp:, udp:, etc.)
+	attempt				int		`csv:"attempt"`				// which attempt this was (1 for the first try, 2+ for retries)
+	// listen, receive only:
+	bytesReceived		int		`csv:"bytesReceived"`		// number of bytes received
+	// discovery only:
+	details				string	`csv:"details"`				// a summary of what was found (with newlines and commas escaped)
+	// composite activities (ie. exfil) only:
+	correlationId		string	`csv:"correlationId"`		// shared by all entries logged for the same composite activity
+	runId				string	`csv:"runId"`				// shared by all entries logged by the same invocation
+	seq					int		`csv:"seq"`					// the order this entry was written in, within the run (starting from 1)
+	hostname			string	`csv:"hostname"`
+	hostIPs				string	`csv:"hostIPs"`				// space-separated, IPv4 first
+	machineId			string	`csv:"machineId"`			// ie. /etc/machine-id, or the MachineGuid on Windows
+	note				string	`csv:"note"`				// the operator's annotation for the run (with newlines and commas escaped)
+	labels				string	`csv:"labels"`				// the operator's key=value labels for the run, separated by semicolons
+	signature			string	`csv:"signature"`			// with -sign-key, the entry's signature (covering the previous one in its run), as <algorithm>:<schema version>:<base64>
+	elevated			string	`csv:"elevated"`			// [true, false]: whether the process was running as root (or as an elevated administrator, on Windows)
+	// http and https sends only:
+	dnsTime				int		`csv:"dnsTime"`				// how long the destination's name took to resolve, in milliseconds (0 for an IP, or a reused connection)
+	tlsVersion			string	`csv:"tlsVersion"`			// https only, the TLS version negotiated (ie. TLS 1.3)
+	tlsCipher			string	`csv:"tlsCipher"`			// https only, the cipher suite negotiated (ie. TLS_AES_128_GCM_SHA256)
 	// responseStatusCd 	int     `csv:"responseStatusCd"`	// the response status code from the request
 	// responseBody		string	`csv:"responseBody"`		// the response body (with newlines and commas escaped)
+	response			*MessageResponse					// send only: the response, for a playbook step's extract (not logged)
 }
 
 // Response data from send action
@@ -50,37 +77,242 @@ type MessageResponse struct {
 	sourceAddr			string
 	sourcePort			int
 	bytesSent			int
+	bytesReceived		int
 	status				string
 	path				string
+	duration			time.Duration	// how long the payload took to transfer (with -rate-limit)
+	statusCode			int				// http and https only
+	headers				http.Header		// http and https only
+	body				string			// the response's body (or what was read back over a Unix domain socket)
+	cookiesSent			[]string		// with -cookie-jar, the names of the cookies the request carried
+	cookiesSet			[]string		// with -cookie-jar, the names of the cookies the response set
+	auth				string			// with -auth, the scheme and user it authenticated with, and how the server answered
+	reusedConnection	bool			// http and https only, whether the request went over a connection an earlier one was made on
+	destAddr			string			// http and https only, the IP address the request's connection was made to
+	dnsDuration			time.Duration	// http and https only, how long the destination's name took to resolve
+	tlsVersion			string			// https only, the TLS version negotiated
+	tlsCipher			string			// https only, the cipher suite negotiated
 }
 
 // Current activity log entry (for testing)
 var activityLogEntry *ActivityLogEntry = new(ActivityLogEntry)
 
+// Logging options (defined once up front, like the rest)
+var runIdPtr = flag.String("run-id", "", "the run ID to stamp on every activity log entry (default a random UUID)")
+var notePtr = flag.String("note", "", "a free-text annotation to record on every activity log entry, ie. the scenario phase (default none)")
+var labelsPtr = flag.String("labels", "", "comma-separated key=value labels to record on every activity log entry (default none)")
+var runSummaryPtr = flag.Bool("run-summary", false, "log a run-start entry before the command, and a run-end entry (with the run's entry counts and duration) after it")
+var heartbeatPtr = flag.Duration("heartbeat", 0, "log a heartbeat entry this often while the command runs, ie. 1m (default none)")
+
+// Sink options
+var sinkSpecsPtr = newSinkListFlag()
+var metricsAddrPtr = flag.String("metrics-addr", "", "the address to serve Prometheus metrics on (at /metrics) for the rest of the run, ie. :9464 (default none)")
+
+// Output options
+var outputPtr = flag.String("output", "text", "how to print the run's result: text, or json for a single JSON object on stdout (with everything else on stderr) (default text)")
+var quietPtr = flag.Bool("quiet", false, "whether to leave out the commands' console output, printing nothing but the -output=json result, and to log only errors to stderr (default false)")
+
+// Verbosity options
+var verbosePtr = flag.Bool("v", false, "whether to log what noisemaker's doing to stderr, besides warnings and errors (default false)")
+var veryVerbosePtr = flag.Bool("vv", false, "whether to log debugging details to stderr too, ie. the responses sends get (default false)")
+
+// Daemon and control options
+var tlsCertPtr = flag.String("tls-cert", "", "the PEM certificate to present (as the daemon's server certificate, or the controller's client certificate) (default none)")
+var tlsKeyPtr = flag.String("tls-key", "", "the PEM private key for -tls-cert (default none)")
+var tlsCAPtr = flag.String("tls-ca", "", "the PEM CA certificate(s) to verify the other side with (the daemon requires client certificates signed by it) (default none)")
+var daemonTokenFilePtr = flag.String("daemon-token-file", "", "the file the daemon writes its bearer token to (readable by the current user only), and control reads it from (default noisemaker-daemon-token, next to the activity log)")
+var controlTimeoutPtr = flag.Duration("control-timeout", 10 * time.Minute, "how long to wait for each agent to finish a dispatched playbook (default 10m)")
+
+// Send options (defined once up front, since main() may be called repeatedly under test)
+var retriesPtr = flag.Int("retries", 0, "the number of times to retry a failed send (default 0)")
+var retryBackoffPtr = flag.Duration("retry-backoff", time.Second, "the delay before the first retry of a failed send (or playbook step, with on_error: retry), doubled after each retry (default 1s)")
+var chunkSizePtr = flag.String("chunk-size", "0", "the most bytes of a send's payload to send in each request, splitting it across several (ie. 64KB); 0 sends it in one (default 0)")
+var failRatePtr = flag.Float64("fail-rate", 0, "the fraction (0.0 to 1.0) of send attempts to deliberately fail without sending (default 0)")
+
+// Source binding options
+var sourceIPPtr = flag.String("source-ip", "", "the local address to bind the network commands' outbound connections to (default whichever the OS picks)")
+var interfacePtr = flag.String("interface", "", "the local interface whose address to bind the network commands' outbound connections to (default whichever the OS picks)")
+var ipVersionPtr = flag.String("ip-version", "auto", "the IP version the network commands connect over: 4, 6, or auto (default auto, whichever the destination resolves to)")
+
+// Session options
+var authPtr = flag.String("auth", "", "the credentials to authenticate sends with, as (scheme):(user):(password), where the scheme is basic, digest, or ntlm (default none)")
+var cookieJarPtr = flag.Bool("cookie-jar", false, "whether to keep the cookies each send (or download) is set for the rest of the run, so later ones carry the session (default false)")
+
+// HTTP client options
+var dialTimeoutPtr = flag.Duration("dial-timeout", 30 * time.Second, "how long sends and downloads wait to connect (default 30s)")
+var tlsHandshakeTimeoutPtr = flag.Duration("tls-handshake-timeout", 10 * time.Second, "how long sends and downloads wait for the TLS handshake over https (default 10s)")
+var responseTimeoutPtr = flag.Duration("response-timeout", 0, "how long sends and downloads wait for a response once the request's written; 0 for no limit (default 0)")
+var disableKeepAlivesPtr = flag.Bool("disable-keepalives", false, "whether every send and download gets a new connection, rather than reusing one (default false)")
+var maxIdleConnsPtr = flag.Int("max-idle-conns", 2, "the most idle connections kept open to each host, for later sends to reuse; 0 keeps none (default 2)")
+
+// Rate limiting options
+var rateLimitPtr = flag.String("rate-limit", "", "the most bytes per second to send payloads at, ie. 100KB/s (default none, as fast as possible)")
+
+// Listen options
+var echoPtr = flag.Bool("echo", false, "whether to echo received data back to the sender when listening (default false)")
+var maxReceivesPtr = flag.Int("max-receives", 0, "the number of inbound connections (or datagrams, or collected streams) to receive before the listener stops; 0 listens until interrupted (default 0)")
+var listenTimeoutPtr = flag.Duration("listen-timeout", 30 * time.Second, "how long an inbound connection can go without sending anything before the listener closes it (default 30s)")
+
+// Custom action options
+var actionsPtr = flag.String("actions", "", "the YAML file declaring the custom actions the action command runs (external binaries, or Go plugins) (default none)")
+
+// Privileged command options
+var allowPrivilegedPtr = flag.Bool("allow-privileged", false, "whether to allow privileged commands that change the system, like useradd (default false)")
+
+// Run-as options
+var asUserPtr = flag.String("as-user", "", "the local account to perform execute and file actions as, recorded as their username (default the current user)")
+
+// File I/O options
+var ioModePtr = flag.String("io-mode", "buffered", "how create and update write a file's contents: buffered, mmap, direct, or syscall (default buffered)")
+
+// Stage options
+var archivePasswordPtr = flag.String("archive-password", "", "the password to encrypt staged zip archives with (default none)")
+
+// Signing options
+var signKeyPtr = flag.String("sign-key", "", "the HMAC key or Ed25519 private key (PEM) file to sign every activity log entry with, or to verify signatures with (default none)")
+
+// Encryption options
+var logEncryptPtr = flag.String("log-encrypt", "", "the AES-256 key file (64 hex digits) to encrypt the csv and jsonl activity log files with, or to read encrypted logs with (default none)")
+
+// Artifact options
+var manifestPtr = flag.String("manifest", "", "the file to record every artifact the run makes in (ie. files it creates), for cleanup to remove (default noisemaker-artifacts.jsonl, next to the activity log)")
+
+// Timeout options
+var timeoutPtr = flag.Duration("timeout", 0, "how long the whole run can take before it's cancelled, logging what it did with status cancelled (default none)")
+
+// Shutdown options
+var cleanupPtr = flag.Bool("cleanup", false, "whether to undo what the run did (ie. delete the files it created) when it's shut down by SIGINT or SIGTERM (default false)")
+
+// Playbook options
+var stateFilePtr = flag.String("state-file", "", "the file to save a playbook's (or scenario's) progress to, and to resume it from if it's interrupted (default none)")
+var onErrorPtr = flag.String("on-error", "", "what a playbook does when a run of a step fails (including with a failure status), for steps without an on_error of their own: stop, continue, or retry (default none, stopping only at an invalid run)")
+
+// SSH options
+var sshKeyPtr = flag.String("ssh-key", "", "the private key file to authenticate ssh connections with (default none)")
+var sshPasswordPtr = flag.String("ssh-password", "", "the password to authenticate ssh connections with (default none)")
+var sshKnownHostsPtr = flag.String("ssh-known-hosts", "", "the known_hosts file to check ssh host keys against (default none, accepting any host key)")
+var sshTimeoutPtr = flag.Duration("ssh-timeout", 10 * time.Second, "how long to wait to connect and authenticate over ssh (default 10s)")
+
+// Remote execution options
+var remoteUserPtr = flag.String("remote-user", "", "the account (ie. DOMAIN\\name) to authenticate remote-exec and file actions on SMB paths with (default the current user's credentials, on Windows)")
+var remotePasswordPtr = flag.String("remote-password", "", "the password for -remote-user (default none)")
+
+// Scan options
+var scanRatePtr = flag.Float64("scan-rate", 0, "the maximum number of connect attempts per second when scanning; 0 for no limit (default 0)")
+var scanTimeoutPtr = flag.Duration("scan-timeout", time.Second, "how long to wait for each connect attempt before considering the port filtered (default 1s)")
+
 // Usage: noisemaker [opts...] <command> [args...]
 // Options:
 //   - -logfile=<path>	(sets activity log path; default './activity-log.csv')
 //   - -overwrite		(sets activity log to overwrite log file if existing, instead of appending; default false)
+//   - -sink=<type[:target]>	(writes the activity log to this sink, ie. csv, jsonl:<path>, stdout, syslog[:<addr>], webhook:<url>, otlp:<url>, grpc:<addr>, eventlog[:<channel>], oslog[:<subsystem>], journald[:<socket>], s3://<bucket>/<prefix>, or amqp:<url>; may be repeated; default csv at -logfile)
+//   - -metrics-addr=<addr>	(serves Prometheus metrics on addr at /metrics, while the run lasts; default none)
+//   - -output=<text|json>	(prints the run's result, its activity log entry and exit status, as a single JSON object on stdout with json, moving the console output to stderr; default text)
+//   - -quiet		(leaves out the commands' console output, and logs only errors to stderr; default false)
+//   - -v, -vv		(logs what noisemaker's doing to stderr, or debugging details too; default only warnings and errors)
+//   - -run-id=<id>		(stamps every activity log entry with this run ID; default a random UUID)
+//   - -note=<text>		(records this annotation on every activity log entry; default none)
+//   - -labels=<key=value,...>	(records these labels on every activity log entry; default none)
+//   - -run-summary		(logs a run-start entry before the command, and a run-end entry after it; default false)
+//   - -heartbeat=<duration>	(logs a heartbeat entry this often while the command runs; default none)
+//   - -retries=<n>		(retries a failed send up to n times; default 0)
+//   - -retry-backoff=<duration>	(delay before the first retry of a send, or a playbook step, doubled after each retry; default 1s)
+//   - -chunk-size=<size>	(splits a send's payload across several requests of no more than this, ie. 64KB, to each of a comma-separated list of hosts in turn; default 0, in one)
+//   - -fail-rate=<fraction>	(deliberately fails this fraction of send attempts; default 0)
+//   - -source-ip=<ip>, -interface=<name>	(binds the network commands' outbound connections to this local address, or this interface's, recording it as a label; default whichever the OS picks)
+//   - -ip-version=<4|6|auto>	(connects over only IPv4 or IPv6, recording it as a label; default auto)
+//   - -auth=<scheme>:<user>:<password>	(authenticates sends with basic, digest, or ntlm auth, logging the scheme and user; default none)
+//   - -cookie-jar		(keeps the cookies sends are set for the rest of the run, logging their names; default false)
+//   - -dial-timeout=<duration>, -tls-handshake-timeout=<duration>	(how long sends and downloads wait to connect, and for the TLS handshake; default 30s and 10s)
+//   - -response-timeout=<duration>	(how long sends and downloads wait for a response once the request's written; default 0, no limit)
+//   - -disable-keepalives	(makes a new connection for every send and download, rather than reusing one; default false)
+//   - -max-idle-conns=<n>	(keeps up to n idle connections open to each host for later sends to reuse, 0 for none; default 2)
+//   - -rate-limit=<size>/s	(sends payloads no faster than this, ie. 100KB/s, logging how long each took; default none)
+//   - -echo		(echoes received data back to the sender when listening; default false)
+//   - -max-receives=<n>	(stops listening after n inbound connections, or collecting after n streams; default 0, runs until interrupted)
+//   - -listen-timeout=<duration>	(closes inbound connections that go quiet for this long when listening; default 30s)
+//   - -scan-rate=<n>	(limits scans to n connect attempts per second; default 0, no limit)
+//   - -scan-timeout=<duration>	(how long to wait on each connect attempt when scanning; default 1s)
+//   - -actions=<path>	(declares the custom actions the action command can run, as external binaries or Go plugins; default none)
+//   - -allow-privileged	(allows privileged commands that change the system, like useradd; default false)
+//   - -io-mode=<mode>	(how create and update write a file's contents: buffered, mmap, direct, or syscall; default buffered)
+//   - -as-user=<name>	(performs execute, file actions, and dropper's script and download's file as this local account, recording it as their username; default the current user)
+//   - -archive-password=<password>	(encrypts staged zip archives with the password; default none)
+//   - -sign-key=<path>	(signs every activity log entry with this HMAC key or Ed25519 private key, or verifies signatures with it; default none)
+//   - -log-encrypt=<path>	(encrypts the csv and jsonl activity log files with this AES-256 key, and reads encrypted logs with it; default none)
+//   - -manifest=<path>	(records every artifact the run makes, ie. files it creates, in this file for cleanup; default noisemaker-artifacts.jsonl, next to -logfile)
+//   - -timeout=<duration>	(cancels the whole run once it's taken this long, logging what it did with status cancelled; default none)
+//   - -cleanup		(undoes what the run did, ie. deleting the files it created, if it's shut down by SIGINT or SIGTERM; default false)
+//   - -state-file=<path>	(saves a playbook's progress to this file after each step, and resumes from it if it exists; default none)
+//   - -on-error=<stop|continue|retry>	(what a playbook does when a step fails, unless the step's on_error says otherwise; default none, stopping only at an invalid step)
+//   - -tls-cert=<path>, -tls-key=<path>	(the certificate the daemon serves, or the controller presents to agents; default none)
+//   - -tls-ca=<path>	(the CA to verify the other side with; the daemon requires client certificates signed by it; default none)
+//   - -daemon-token-file=<path>	(the file the daemon writes the bearer token it's started with to, and control reads it from; default noisemaker-daemon-token, next to -logfile)
+//   - -control-timeout=<duration>	(how long to wait for each agent to finish a dispatched playbook; default 10m)
+//   - -ssh-key=<path>, -ssh-password=<password>	(the private key and password to authenticate ssh connections with; default none)
+//   - -ssh-known-hosts=<path>	(the known_hosts file to check ssh host keys against; default none, accepting any host key)
+//   - -ssh-timeout=<duration>	(how long to wait to connect and authenticate over ssh; default 10s)
+//   - -remote-user=<user>, -remote-password=<password>	(the account to authenticate remote-exec and file actions on SMB paths with; default the current user's credentials, on Windows)
 //
 // Commands:
-//   - execute (runs command-line string)
+//   - execute (runs command-line string, or a script block with -interpreter, ie. Base64-encoded PowerShell with -encoded)
 //   - create (creates file)
 //   - modify (modifies file)
 //   - delete (deletes file)
-//   - send (sends an HTTP(S) request)
+//   - read (reads file)
+//   - shred (overwrites file before deleting it)
+//   - dropper (writes a script to disk, runs it, and deletes it)
+//   - download (downloads a file over HTTP(S), and runs it with -then-execute)
+//   - lolbin (lists, or runs one of, a catalog of benign living-off-the-land binary invocations, ie. certutil -urlcache)
+//   - fileless (runs a script without writing it to disk: piped to an interpreter's stdin, as a /dev/fd pipe, or from an in-memory file)
+//   - send (sends an HTTP(S) request, or a raw message over a Unix domain socket)
+//   - beacon (sends a series of requests, with long sleeps and jitter between them, rotating hosts, and padding payloads)
+//   - dga (looks up, and makes HTTP requests to, pseudo-random domains generated from a seed, as DGA malware does)
+//   - traffic (generates realistic, structured HTTP traffic from a profile, ie. REST API chatter, browser page loads, or file sync)
+//   - listen (listens for inbound HTTP, TCP, or UDP traffic)
+//   - scan (attempts TCP connects across hosts and ports)
+//   - netenum (enumerates network interfaces, neighbors, and routes)
+//   - discover (enumerates users, processes, services, installed software, and domain info)
+//   - credprobe (attempts read-only opens of well-known credential stores)
+//   - browser (writes throwaway browser history and downloads databases, and probes the real profiles read-only with -probe)
+//   - containerprobe (probes container escape indicators, ie. the Docker socket and /proc/1/cgroup, read-only)
+//   - k8sprobe (makes read-only Kubernetes API calls, ie. listing pods and secrets' metadata)
+//   - procaccess (opens a handle to another process, ie. lsass.exe, without reading from it; Windows only)
+//   - inject (injects a harmless call into a suspended child noisemaker, with CreateRemoteThread or QueueUserAPC; Windows only)
+//   - pipe (creates or connects to a named pipe, or a Unix domain socket outside of Windows)
+//   - ssh (runs a command on a remote host over SSH, as lateral movement would)
+//   - remote-exec (runs a command on a remote Windows host over WinRM, or as a service created over SMB)
+//   - useradd, userdel, groupadd, groupdel (creates or deletes a throwaway local account or group; requires -allow-privileged)
+//   - hosts (adds or removes an entry in the hosts file, as DNS redirection does; requires -allow-privileged)
+//   - screenshot (captures the screen to a file)
+//   - inputhook (briefly registers a keyboard hook, ie. SetWindowsHookEx or CGEventTapCreate, without recording any keystrokes)
+//   - avdevice (opens and immediately closes the default microphone or camera, without capturing anything)
+//   - stage (archives files into a zip or tar archive)
+//   - exfil (stages a directory into an archive, and sends it)
+//   - playbook (runs the steps of a playbook file in order, as one run, with variables, loops, conditions, and parallel stages)
+//   - scenario (lists, shows, or runs the built-in scenarios, ie. ransomware-lite)
+//   - script (runs a Starlark-style script, with loops, randomness, and conditions, that calls the commands as functions)
+//   - daemon (runs persistently, accepting commands and playbooks over a local HTTP API)
+//   - control (dispatches a playbook to remote daemons, and collects their activity logs)
+//   - collect (receives activity log entries streamed over gRPC, from other instances' grpc sinks)
+//   - migrate-log (upgrades an older CSV or JSON lines activity log to the current columns)
+//   - verify (checks every row of an activity log against the schema, reporting malformed lines)
+//   - log query (prints the entries of an activity log that match the given filters)
+//   - log stats (summarizes an activity log by activity, destination, and time, as text, JSON, or HTML)
+//   - replay (runs the commands recorded in an activity log again, with the same timing)
+//   - generate (runs a random mix of benign activity, following a workstation or server profile)
+//   - fuzz (runs file and network commands with randomized edge-case parameters, labeled so any case can be run again)
+//   - watch (watches a directory for changes made by anything else, optionally putting deleted files back, as a decoy maintainer)
+//   - decoy (plants bait documents and keys in directories, then checks whether each was accessed, modified, or deleted, or removes them)
+//   - edgenames (tries creating files with Windows' reserved names, trailing dots and spaces, and names that differ only in case)
+//   - compare (matches an activity log against a sensor export, reporting what the sensor missed)
+//   - verify-signatures (checks the signature of every entry in an activity log signed with -sign-key)
+//   - decrypt-log (decrypts an activity log encrypted with -log-encrypt)
+//   - cleanup (removes the artifacts recorded in the artifact manifest, ie. files created by earlier runs)
+//   - action (runs a custom action declared in the -actions file, as an external binary or a Go plugin, logging what it reports)
+//   - capabilities (lists which commands, protocols, methods, and sinks are supported on this OS and build, as text or JSON)
+//   - doctor (checks the commands' prerequisites, ie. write access to the activity log, outbound connectivity, privileges, and interpreters)
 func main() {
-	// Determine which OS we're on ('darwin', 'linux', etc.)
-	currentOS := runtime.GOOS
-
-	// Get the current process name and PID
-	currentProcessId := os.Getpid()
-	currentProcessName, err := os.Executable()
-	check(err)
-
-	// Determines the current user
-	currentUser, err := user.Current()
-	check(err)
-
 	// Parse log file flags
 	// TODO: Clean up how we parse flags!
 	var logFilePath string
@@ -100,6 +332,9 @@ func main() {
 	// Parse?
 	flag.Parse()
 
+	// Log diagnostics to stderr, as verbosely as asked
+	slog.SetDefault(newDiagnosticLogger(os.Stderr, getLogLevel(*verbosePtr, *veryVerbosePtr, *quietPtr)))
+
 	// Get whatever values we had already
 	if existingLogfileFlag == nil {
 		logFilePath = *logFilePathPtr
@@ -125,301 +360,1837 @@ func main() {
 		commandArgs = remainingArgs[1:]
 	}
 
-	// Parse log entries from the existing log file, if any.
-	existingLogEntries := []*ActivityLogEntry{}
-	activityLogFileExists := fileExists(logFilePath)
-	peekActivityLogFile, err := os.OpenFile(logFilePath, os.O_RDONLY, 0644)
-	if activityLogFileExists && err != nil {
-		scanner := bufio.NewScanner(peekActivityLogFile)
-		if scanner.Scan() {
-			firstLine := scanner.Text()
-			fmt.Printf("First line: %s\n", firstLine)
-			if !isCSVHeaderStr(firstLine) {
-				// Try to parse it as a record, but fail gracefully
-				row, err := splitCSVRow(firstLine)
-				if err != nil {
-					fmt.Printf("Unable to tokenize first row, syntax error in '%s'!\n", firstLine)
-				}
-				parsedLogEntry, err := deserializeFromCSV(row)
-				if err != nil {
-					fmt.Printf("Unable to deserialize first row, parser error in %v\n", row)
+	// Load the signing key, if there is one (a public key can only verify signatures)
+	logSigner = nil
+	if *signKeyPtr != "" {
+		var err error
+		logSigner, err = loadLogSigner(*signKeyPtr)
+		check(err)
+		if !logSigner.canSign() && command != "verify-signatures" {
+			check(fmt.Errorf("can't sign activity log entries with the public key in %s (use the private key)", *signKeyPtr))
+		}
+	}
+
+	// Load the log encryption key, if there is one
+	logCipher = nil
+	if *logEncryptPtr != "" {
+		var err error
+		logCipher, err = loadLogCipher(*logEncryptPtr)
+		check(err)
+	}
+
+	// Record the artifacts the run makes in the manifest (by default, next to the activity log)
+	artifactManifestPath = *manifestPtr
+	if artifactManifestPath == "" {
+		artifactManifestPath = filepath.Join(filepath.Dir(logFilePath), "noisemaker-artifacts.jsonl")
+	}
+	daemonTokenPath = *daemonTokenFilePtr
+	if daemonTokenPath == "" {
+		daemonTokenPath = filepath.Join(filepath.Dir(logFilePath), DefaultDaemonTokenName)
+	}
+
+	// Keep the console output (besides the stdout sink) out of the result's way, and print the result once the command's done (or has panicked)
+	check(checkOutputFormat(*outputPtr, *sinkSpecsPtr))
+	resultOutput, restoreConsoleOutput := redirectConsoleOutput(*outputPtr, *quietPtr)
+	defer func() {
+		restoreConsoleOutput()
+		if *outputPtr != "json" {
+			return
+		}
+		if r := recover(); r != nil {
+			writeJSONResult(resultOutput, activityLogEntry, PanicExitStatus, fmt.Sprintf("%v", r))
+			panic(r)
+		}
+		writeJSONResult(resultOutput, activityLogEntry, 0, "")
+	}()
+
+	// Open the activity log (and any other sinks), leaving out a log that's about to be verified if opening it would change it
+	sinkSpecs := []string(*sinkSpecsPtr)
+	if command == "verify" {
+		verifyPath := logFilePath
+		if len(commandArgs) > 0 {
+			verifyPath = commandArgs[0]
+		}
+		sinkSpecs = getVerifySinkSpecs(sinkSpecs, logFilePath, verifyPath)
+	}
+	activityLog, err := openSinks(sinkSpecs, logFilePath, overwrite)
+	if err != nil && command == "doctor" {
+		// (doctor reports why, rather than panicking before it's checked anything)
+		slog.Warn("Unable to open the activity log, so the doctor entry won't be written to it", "error", err)
+		activityLog, err = &MultiSink{}, nil
+	}
+	check(err)
+	if *metricsAddrPtr != "" {
+		metricsSink, err := newMetricsSink(*metricsAddrPtr)
+		if err != nil {
+			activityLog.Close()
+			check(err)
+		}
+		activityLog = &MultiSink{sinks: []Sink{activityLog, metricsSink}}
+	}
+	defer activityLog.Close()
+
+	// Create the initial activity log entry, and start numbering this run's entries from 1
+	logSequences = map[string]int{}
+	lastLogSignatures = map[string]string{}
+	runSummary = nil
+	runArtifacts = []*Artifact{}
+	activityLogEntry = newActivityLogEntry(command, commandArgs)
+	activityLogEntry.runId = escapeRawText(*runIdPtr)
+	if activityLogEntry.runId == "" {
+		activityLogEntry.runId = newUUID()
+	}
+	activityLogEntry.note = escapeRawText(*notePtr)
+	activityLogEntry.labels, err = parseLabels(*labelsPtr)
+	check(err)
+
+	// Bind outbound connections to the source address (or interface) and IP version, and record which on every entry
+	sourceIP, err = resolveSourceIP(*sourceIPPtr, *interfacePtr, *ipVersionPtr)
+	check(err)
+	ipVersion = *ipVersionPtr
+	if ipVersion != "auto" {
+		activityLogEntry.labels = addLabel(activityLogEntry.labels, "ip-version", ipVersion)
+	}
+	if *interfacePtr != "" {
+		activityLogEntry.labels = addLabel(activityLogEntry.labels, "interface", escapeRawText(*interfacePtr))
+	}
+	if sourceIP != nil {
+		activityLogEntry.labels = addLabel(activityLogEntry.labels, "source-ip", sourceIP.String())
+	}
+
+	// Shape the sends' payloads to the rate limit, and keep their session's cookies
+	rateLimit, err = parseRateLimit(*rateLimitPtr)
+	check(err)
+	cookieJar, err = newCookieJar(*cookieJarPtr)
+	check(err)
+	sendAuth, err = parseSendAuth(*authPtr)
+	check(err)
+
+	// Make (and reuse) HTTP connections the way the HTTP client options say, recording any that aren't the defaults
+	httpClientOptions, err = parseHTTPClientOptions(*dialTimeoutPtr, *tlsHandshakeTimeoutPtr, *responseTimeoutPtr, *disableKeepAlivesPtr, *maxIdleConnsPtr)
+	check(err)
+	activityLogEntry.labels = httpClientOptions.getLabels(activityLogEntry.labels)
+	resetSourceHTTPClient()
+
+	// Playbook steps without an on_error of their own do what -on-error says when they fail
+	if *onErrorPtr != "" && !containsString(PlaybookErrorActions, *onErrorPtr) {
+		check(fmt.Errorf("invalid -on-error '%s' (must be one of %v)", *onErrorPtr, PlaybookErrorActions))
+	}
+	playbookOnError = *onErrorPtr
+
+	// Shut down gracefully on SIGINT or SIGTERM (besides the commands that stop on them themselves)
+	if !containsString(GracefulShutdownCommands, command) {
+		stopWatching := watchForShutdown(activityLog, activityLogEntry)
+		defer stopWatching()
+	}
+
+	// Cancel the run (and everything it's doing) once the -timeout is up
+	stopTimeout := startRunTimeout(activityLog, activityLogEntry, *timeoutPtr)
+	defer stopTimeout()
+
+	// Log the run's start and end (with -run-summary), and a heartbeat while it runs (with -heartbeat), so a run that finished can be
+	// told apart from one whose host died partway through
+	if *heartbeatPtr < 0 {
+		check(fmt.Errorf("invalid -heartbeat %v (must be 0 or more)", *heartbeatPtr))
+	}
+	if *runSummaryPtr || *heartbeatPtr > 0 {
+		var stopHeartbeat func()
+		runSummary, stopHeartbeat = startRunSummary(activityLog, activityLogEntry, *runSummaryPtr, *heartbeatPtr)
+		defer func() {
+			stopHeartbeat()
+			if r := recover(); r != nil {
+				runSummary.end(activityLog, "error", fmt.Sprintf("%v", r))
+				panic(r)
+			}
+			if isRunCancelled() {
+				runSummary.end(activityLog, "cancelled", fmt.Sprintf("-timeout of %v reached", *timeoutPtr))
+			} else {
+				runSummary.end(activityLog, "completed", "")
+			}
+		}()
+	}
+	runCommand(activityLog, activityLogEntry, command, commandArgs)
+}
+
+// Creates the log entry for a command, with the details of the current process, user, and host
+func newActivityLogEntry(command string, commandArgs []string) *ActivityLogEntry {
+	// Get the current process name and PID
+	currentProcessName, err := os.Executable()
+	check(err)
+
+	// Determines the current user
+	currentUser, err := user.Current()
+	check(err)
+
+	// Determines which host this is, so logs from several hosts can be told apart
+	currentHost := getHostInfo()
+
+	activityLogEntry := new(ActivityLogEntry)
+	activityLogEntry.timestamp = time.Now().Format(time.RFC3339)
+	activityLogEntry.activity = command
+	activityLogEntry.username = currentUser.Username
+	activityLogEntry.os = runtime.GOOS
+	activityLogEntry.processName = escapeRawText(currentProcessName)
+	activityLogEntry.processCmd = escapeCommandString(command, commandArgs)
+	activityLogEntry.processId = os.Getpid()
+	activityLogEntry.hostname = escapeRawText(currentHost.hostname)
+	activityLogEntry.hostIPs = currentHost.hostIPs
+	activityLogEntry.machineId = escapeRawText(currentHost.machineId)
+	activityLogEntry.elevated = strconv.FormatBool(currentHost.elevated)
+	return activityLogEntry
+}
+
+// Runs a single command, recording it (and any sub-activities) to the activity log. Panics if the command's invalid.
+func runCommand(activityLog Sink, activityLogEntry *ActivityLogEntry, command string, commandArgs []string) {
+	// Determine which OS we're on ('darwin', 'linux', etc.)
+	currentOS := activityLogEntry.os
+	var err error
+
+	// Once the run's been cancelled, nothing more's done (the command's just logged as cancelled)
+	if isRunCancelled() {
+		markCancelled(activityLogEntry)
+		writeLogEntry(activityLog, activityLogEntry)
+		return
+	}
+
+	// The file commands' paths (and only those) can use templates (ie. {tmp}) for where things are on this OS, which are recorded expanded
+	if paths, ok := PathTemplateCommands[command]; ok {
+		expanded, found, err := expandPathTemplates(currentOS, paths, commandArgs)
+		check(err)
+		if found {
+			commandArgs = expanded
+			activityLogEntry.processCmd = escapeCommandString(command, commandArgs)
+		}
+	}
+
+	// With -as-user, the action's performed as (and recorded as) the other account
+	var runAs *RunAsUser
+	if *asUserPtr != "" && containsString(RunAsCommands, command) {
+		runAs, err = lookupRunAsUser(*asUserPtr)
+		if err != nil {
+			check(fmt.Errorf("invalid -as-user %s: %v", *asUserPtr, err))
+		}
+		defer runAs.close()
+		slog.Info("Acting as user", "user", runAs.name)
+		activityLogEntry.username = escapeRawText(runAs.name)
+	}
+
+	// Determine what process to run
+	switch command {
+	case "execute":
+		// Get the command to run (with -interpreter, the interpreter's command line that runs the script block)
+		options, err := parseExecuteOptions(commandArgs)
+		check(err)
+		procCmd := options.command
+		procArgs := options.args
+		details := []string{}
+		if options.interpreter != "" {
+			script := strings.Join(append([]string{options.command}, options.args...), " ")
+			var encodedScript string
+			procCmd, procArgs, encodedScript = getInterpreterCommand(currentOS, options.interpreter, script, options.encoded)
+			activityLogEntry.method = options.interpreter
+			details = append(details, options.interpreter + " script block: " + script)
+			if options.encoded {
+				details = append(details, "encoded: " + encodedScript)
+			}
+		}
+
+		// (with -preload, it's launched with the variable pointing at the library)
+		var env []string
+		if options.preload != "" {
+			env = getPreloadEnv(options.preload, options.preloadLibrary)
+			details = append(details, "env: " + strings.Join(env, " "))
+		}
+		if len(details) > 0 {
+			activityLogEntry.details = escapeRawText(strings.Join(details, ", "))
+		}
+
+		// Call startProcess and capture the output
+		activityLogEntry.processCmd = escapeCommandString(procCmd, procArgs)
+
+		fmt.Printf("Running command %s with args %v\n", procCmd, procArgs)
+		process, cancelFunc, processState, err := startProcess(procCmd, procArgs, env, runAs)
+		check(err)
+
+		// Close the connection, if we need to
+		if cancelFunc != nil {
+			// TODO: Verify this does what we think it does!
+			// `defer cancelFunc` vs `defer cancelFunc()`!
+			defer cancelFunc()
+		}
+
+		// Record the process info
+		if processState != nil {
+			activityLogEntry.processId = processState.Pid()
+			activityLogEntry.status = processState.String()
+		} else {
+			activityLogEntry.processId = process.Pid
+			activityLogEntry.status = "unable_to_run"
+		}
+
+	case "dropper":
+		// Get the arguments, and link all the steps' entries together
+		options, err := parseDropperOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.path)
+		activityLogEntry.method = strings.TrimPrefix(strings.ToLower(filepath.Ext(options.path)), ".")
+		activityLogEntry.correlationId = newUUID()
+
+		// Drop the script, run it, and delete it (each step is logged as it's done)
+		dropperResponse := dropAndExecute(activityLog, activityLogEntry, options, runAs)
+		activityLogEntry.processId = dropperResponse.processId
+		activityLogEntry.status = dropperResponse.status // [exit status N, unable_to_run, exists, no_access, error]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d bytes dropped", len(options.contents)))
+	case "download":
+		// Get the arguments, and link all the steps' entries together
+		options, err := parseDownloadOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.path)
+		activityLogEntry.method = "GET"
+		activityLogEntry.correlationId = newUUID()
+
+		// Download the file, and run it with -then-execute (each step is logged as it's done)
+		downloadResponse := downloadFile(activityLog, activityLogEntry, options, runAs)
+		activityLogEntry.processId = downloadResponse.processId
+		activityLogEntry.bytesReceived = downloadResponse.bytesReceived
+		activityLogEntry.status = downloadResponse.status // [received, exit status N, unable_to_run, not_found, no_access, exists, error]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%s, %d bytes, sha256 %s", options.url, downloadResponse.bytesReceived, downloadResponse.sha256))
+	case "lolbin":
+		options, err := parseLOLBinOptions(commandArgs)
+		check(err)
+		if options.name == "list" {
+			activityLogEntry.method = "list"
+			count := listLOLBins(os.Stdout, currentOS)
+			activityLogEntry.status = "completed"
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d lolbins", count))
+			break
+		}
+
+		// Look it up in the catalog, and link its execute entry to this one
+		lolbin, err := getLOLBin(currentOS, options.name)
+		check(err)
+		activityLogEntry.path = escapeRawText(lolbin.name)
+		activityLogEntry.correlationId = newUUID()
+
+		// Run it (its exact command line is logged as it's run)
+		lolbinResponse := runLOLBin(activityLog, activityLogEntry, lolbin, options.url)
+		activityLogEntry.processId = lolbinResponse.processId
+		activityLogEntry.bytesReceived = lolbinResponse.bytesReceived
+		activityLogEntry.status = lolbinResponse.status // [exit status N, unable_to_run, error]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%s: %s, command %s", strings.Join(lolbin.techniques, " "), lolbin.description, lolbinResponse.commandLine))
+	case "fileless":
+		options, err := parseFilelessOptions(currentOS, commandArgs)
+		check(err)
+		activityLogEntry.method = options.method
+
+		// Run it (nothing's written to disk, so there's no path or artifact)
+		filelessResponse := runFileless(currentOS, options)
+		activityLogEntry.processId = filelessResponse.processId
+		activityLogEntry.bytesSent = filelessResponse.bytesSent
+		activityLogEntry.bytesReceived = filelessResponse.bytesReceived
+		activityLogEntry.status = filelessResponse.status // [exit status N, unable_to_run, unsupported, error]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%s script over %s: %s, command %s", options.interpreter, options.method, options.script, filelessResponse.commandLine))
+	case "create":
+		// Call createFile (or createSizedFile, with a -size) and capture the output
+		options, err := parseCreateOptions(commandArgs)
+		check(err)
+		path := options.path
+		contents := options.contents
+		header := ""
+		if options.profile != nil {
+			random := newContentRandom()
+			if options.size < 0 {
+				contents = options.profile.generate(DefaultGeneratedFileSize, random)
+			} else {
+				header, contents = options.profile.generateSized(options.size, random)
+			}
+		}
+		var contentDetails string
+		if options.profile != nil || options.doubleExtension != "" {
+			// (described by what a sensor would measure of them, and what the file's extension says it is)
+			size := options.size
+			if size < 0 {
+				size = int64(len(contents))
+			}
+			magicType := getMagicType(header + contents)
+			declaredDetails, mismatched, doubleExtension := getDeclaredTypeDetails(path, magicType)
+			contentDetails = getContentDetails(getSizedFileEntropy(header, contents, size, options.sparse), magicType) + ", " + declaredDetails
+			if mismatched {
+				activityLogEntry.labels = addLabel(activityLogEntry.labels, "extension-mismatch", "true")
+			}
+			if doubleExtension {
+				activityLogEntry.labels = addLabel(activityLogEntry.labels, "double-extension", "true")
+			}
+		}
+		if options.doubleExtension != "" || options.fileName != nil || options.pathStress != nil {
+			// (the file created isn't the one the command line gives)
+			activityLogEntry.path = escapeRawText(path)
+		}
+		if options.fileName != nil {
+			activityLogEntry.labels = options.fileName.getLabels(activityLogEntry.labels)
+		}
+		if options.pathStress != nil {
+			activityLogEntry.labels = options.pathStress.getLabels(activityLogEntry.labels, path)
+		}
+
+		defer connectSMBPath(activityLogEntry, path)()
+		mode := getIOMode(activityLogEntry, path)
+		var status string
+		accepted := 0
+		if len(options.dirs) > 0 {
+			// (each directory's created in turn, to record how deep the OS went before it gave up, and the file's only created if they all are)
+			if _, found := isSMBClientPath(path); found {
+				check(fmt.Errorf("invalid create: -depth and -path-length can't be used with SMB paths"))
+			}
+			status, err = runAs.do(func() (string, error) {
+				count, status, err := createNestedDirs(activityLogEntry, options.dirs)
+				accepted = count
+				return status, err
+			})
+		}
+		if err == nil && options.size >= 0 {
+			// (the contents are streamed with buffered writes, and locally)
+			if mode != "buffered" {
+				check(fmt.Errorf("invalid create: -size can't be used with -io-mode=%s", mode))
+			} else if _, found := isSMBClientPath(path); found {
+				check(fmt.Errorf("invalid create: -size can't be used with SMB paths on %s", currentOS))
+			}
+			var physicalSize int64
+			status, err = runAs.do(func() (string, error) {
+				status, size, err := createSizedFile(path, header, contents, options.size, options.sparse)
+				physicalSize = size
+				return status, err
+			})
+			if err == nil {
+				details := fmt.Sprintf("%d bytes logical, %d bytes physical", options.size, physicalSize)
+				if options.sparse {
+					details += ", sparse"
 				}
-				if parsedLogEntry != nil {
-					fmt.Printf("Deserialized first row to %v\n", parsedLogEntry)
-					existingLogEntries = append(existingLogEntries, parsedLogEntry)
+				if contentDetails != "" {
+					details += ", " + contentDetails
 				}
+				activityLogEntry.details = escapeRawText(details)
+			}
+		} else if err == nil {
+			status, err = runAs.do(func() (string, error) { return createFile(path, contents, mode) })
+			if err == nil && contentDetails != "" {
+				activityLogEntry.details = escapeRawText(fmt.Sprintf("%d bytes, %s", len(contents), contentDetails))
 			}
+		}
+		if err != nil && status == "exists" && options.ifNotExists {
+			// (it's already there, ie. from an earlier run of the same playbook)
+			fmt.Printf("Skipping creating %s, since it already exists\n", path)
+			activityLogEntry.status = "skipped"
+			activityLogEntry.details = escapeRawText("already exists (-if-not-exists)")
+		} else if err != nil {
+			// TODO: Add more specific create error info to log entry!
+			activityLogEntry.status = status // [exists, not_found, invalid_path, no_access, too_long, error]
+			if isPathTooLong(err) {
+				activityLogEntry.status = "too_long"
+			}
+		} else {
+			activityLogEntry.status = "created"
+			trackArtifact(activityLogEntry, "file", path, "delete", path)
+		}
+		if options.pathStress != nil {
+			// (whether the OS accepted it, or how deep it went before it didn't)
+			if activityLogEntry.details != "" {
+				activityLogEntry.details += escapeRawText(", ")
+			}
+			activityLogEntry.details += escapeRawText(getPathStressDetails(path, options.dirs, accepted))
+		}
+		if options.fileName != nil {
+			// (whether or not it was created, the name tried is recorded, escaped)
+			if activityLogEntry.details != "" {
+				activityLogEntry.details += escapeRawText(", ")
+			}
+			activityLogEntry.details += escapeRawText(getFileNameDetails(path))
+		}
+	case "update":
+		// Call updateFile (or createFile, with -create-if-missing, if it doesn't exist) and capture the output
+		options, err := parseUpdateOptions(commandArgs)
+		check(err)
+		path := options.path
+		contents := options.contents
+		if isFilePattern(path) {
+			// (each of the files it matches is updated, and logged, in turn)
+			fileSetResponse := runFileSet(activityLog, activityLogEntry, "update", []string{path}, options.getArgs, "updated", false)
+			activityLogEntry.status = fileSetResponse.status // [updated, partial, not_found, or the failed updates' status]
+			activityLogEntry.details = escapeRawText(getFileSetDetails(fileSetResponse, "updated"))
+			break
+		}
 
-			// Read the other rows
-			for scanner.Scan() {
-				existingRow := scanner.Text()
-				// Try to parse it as a record, and skip ahead if we fail anywhere
-				row, err := splitCSVRow(existingRow)
-				if err != nil {
-					fmt.Printf("Unable to tokenize row, syntax error in '%s'!\n", existingRow)
-					continue
+		defer connectSMBPath(activityLogEntry, path)()
+		mode := getIOMode(activityLogEntry, path)
+		contentDetails := ""
+		if options.profile != nil {
+			contents = options.profile.generate(getUpdatedFileSize(path), newContentRandom())
+			magicType := getMagicType(contents)
+			declaredDetails, mismatched, _ := getDeclaredTypeDetails(path, magicType)
+			contentDetails = getContentDetails(getSizedFileEntropy("", contents, int64(len(contents)), false), magicType) + ", " + declaredDetails
+			if mismatched {
+				activityLogEntry.labels = addLabel(activityLogEntry.labels, "extension-mismatch", "true")
+			}
+		}
+		status, err := runAs.do(func() (string, error) { return updateFile(path, contents, mode) })
+		if err == nil && contentDetails != "" {
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d bytes, %s", len(contents), contentDetails))
+		}
+		if err != nil && status == "not_found" && options.createIfMissing {
+			status, err = runAs.do(func() (string, error) { return createFile(path, contents, mode) })
+			if err == nil {
+				details := "created, since it didn't exist (-create-if-missing)"
+				if contentDetails != "" {
+					details += fmt.Sprintf(", %d bytes, %s", len(contents), contentDetails)
 				}
-				parsedLogEntry, err := deserializeFromCSV(row)
-				if err != nil {
-					fmt.Printf("Unable to deserialize first row, parser error in %v\n", row)
-					continue
+				activityLogEntry.details = escapeRawText(details)
+				trackArtifact(activityLogEntry, "file", path, "delete", path)
+			}
+		}
+		activityLogEntry.status = status // [updated, created, not_found, invalid_path, no_access, error]
+	case "delete":
+		// Call deleteFile (or trashFile, with -trash) and capture the output
+		options, err := parseDeleteOptions(commandArgs)
+		check(err)
+		if len(options.paths) > 1 || isFilePattern(options.path) {
+			// (each of the files is deleted, and logged, in turn)
+			fileSetResponse := runFileSet(activityLog, activityLogEntry, "delete", options.paths, options.getArgs, "deleted", options.ignoreMissing)
+			activityLogEntry.status = fileSetResponse.status // [deleted, partial, skipped, or the failed deletes' status]
+			activityLogEntry.details = escapeRawText(getFileSetDetails(fileSetResponse, "deleted"))
+			break
+		}
+		path := options.path
+		if options.trash {
+			if _, found := parseSMBPath(path); found {
+				check(fmt.Errorf("invalid delete: -trash can't be used with SMB paths"))
+			}
+			activityLogEntry.method = "trash"
+			var trashResponse *TrashResponse
+			status, err := runAs.do(func() (string, error) {
+				response, err := trashFile(path)
+				trashResponse = response
+				return response.status, err
+			})
+			activityLogEntry.status = status // [trashed, not_found, no_access, error]
+			if err != nil && status == "not_found" && options.ignoreMissing {
+				skipMissingFile(activityLogEntry, path)
+			} else if err == nil {
+				activityLogEntry.details = escapeRawText("moved to " + trashResponse.destination)
+				untrackArtifact("delete", path)
+				for _, created := range trashResponse.created {
+					trackArtifact(activityLogEntry, "file", created, "delete", created)
 				}
-				if parsedLogEntry != nil {
-					fmt.Printf("Deserialized first row to %v\n", parsedLogEntry)
-					existingLogEntries = append(existingLogEntries, parsedLogEntry)
+			}
+			break
+		}
+		defer connectSMBPath(activityLogEntry, path)()
+		status, err := runAs.do(func() (string, error) { return deleteFile(path) })
+		if err != nil && status == "not_found" && options.ignoreMissing {
+			skipMissingFile(activityLogEntry, path)
+		} else if err != nil {
+			// TODO: Add more specific delete error info to log entry!
+			activityLogEntry.status = status // [not_found, invalid_path, no_access, error]
+		} else {
+			activityLogEntry.status = "deleted"
+			untrackArtifact("delete", path)
+		}
+	case "shred":
+		// Call shredFile and record how much was overwritten
+		options, err := parseShredOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.path)
+		shredResponse, err := shredFile(options.path, options.passes)
+		activityLogEntry.status = shredResponse.status // [shredded, not_found, no_access, error]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d passes, %d bytes overwritten", shredResponse.passes, options.passes, shredResponse.bytesOverwritten))
+		if err == nil {
+			untrackArtifact("delete", options.path)
+		}
+	case "read":
+		// Call readFile and record how much was read
+		if len(commandArgs) < 1 {
+			check(fmt.Errorf("not enough arguments for read! Args: %v", commandArgs))
+		}
+		path := commandArgs[0]
+		defer connectSMBPath(activityLogEntry, path)()
+		var contents string
+		status, err := runAs.do(func() (string, error) {
+			read, status, err := readFile(path)
+			contents = read
+			return status, err
+		})
+		activityLogEntry.status = status // [read, not_found, invalid_path, no_access, error]
+		if err == nil {
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d bytes read", len(contents)))
+		}
+	case "send":
+		if len(commandArgs) < 2 {
+			check(fmt.Errorf("not enough arguments for send! Args: %v", commandArgs))
+		}
+
+		// Get the arguments
+		method := http.MethodGet
+		if len(commandArgs) > 0 {
+			method = commandArgs[0]
+		}
+		destAddr := "192.168.0.1"
+		if len(commandArgs) > 1 {
+			destAddr = commandArgs[1]
+		}
+		destPort := 80
+		if len(commandArgs) > 2 {
+			destPort, err = strconv.Atoi(commandArgs[2])
+			check(err)
+		}
+		protocol := "http"
+		if len(commandArgs) > 3 {
+			protocol = commandArgs[3]
+		}
+		data := ""
+		if len(commandArgs) > 4 {
+			data = commandArgs[4]
+		}
+
+		// Record the parsed identifying information
+		activityLogEntry.method = method
+		activityLogEntry.destAddr = destAddr
+		activityLogEntry.destPort = destPort
+		activityLogEntry.protocol = protocol
+
+		// Validate the retry options
+		retries := *retriesPtr
+		if retries < 0 {
+			check(fmt.Errorf("invalid retries for send: %d", retries))
+		}
+		failRate := *failRatePtr
+		if failRate < 0 || failRate > 1 {
+			check(fmt.Errorf("invalid fail-rate for send: %v (must be between 0.0 and 1.0)", failRate))
+		}
+		backoff := *retryBackoffPtr
+
+		// With -chunk-size, split it across several requests (to each of the hosts in turn), each logged as it's made
+		chunkSize, err := parseSize(*chunkSizePtr)
+		if err != nil || chunkSize > 1 << 30 {
+			check(fmt.Errorf("invalid chunk-size for send: '%s' (must be a number of bytes, optionally in KB, MB, or GB, up to 1GB)", *chunkSizePtr))
+		}
+		if chunkSize > 0 {
+			destAddrs := splitList(destAddr)
+			if len(destAddrs) == 0 {
+				check(fmt.Errorf("invalid send: no destaddrs in '%s'", destAddr))
+			}
+			activityLogEntry.destAddr = escapeRawText(strings.Join(destAddrs, ","))
+			activityLogEntry.correlationId = newUUID()
+			chunkedResponse := sendChunks(activityLog, activityLogEntry, method, destAddrs, destPort, protocol, data, int(chunkSize), failRate, retries, backoff)
+			activityLogEntry.bytesSent = chunkedResponse.bytesSent
+			activityLogEntry.bytesReceived = chunkedResponse.bytesReceived
+			activityLogEntry.status = chunkedResponse.status // [sent, partial, or the failed chunk's status]
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d chunks sent, chunk size %s, transfer %s", chunkedResponse.sent, chunkedResponse.chunks, formatSize(chunkSize), activityLogEntry.correlationId))
+			break
+		}
+
+		// Send it, retrying on failure. Every attempt but the last is logged here; the last is logged below.
+		for attempt := 1; ; attempt++ {
+			activityLogEntry.timestamp = time.Now().Format(time.RFC3339)
+			activityLogEntry.attempt = attempt
+
+			// Log the details of what we're sending
+			if retries > 0 {
+				slog.Info("Sending", "attempt", attempt, "of", retries + 1)
+			}
+			fmt.Printf("Sending %d bytes of data to %s %s (port %d) using protocol %s...\n", len(data), method, destAddr, destPort, protocol)
+
+			// TODO: Add header encoding somehow!
+			messageResponse, err := sendMessageWithFailureRate(method, destAddr, destPort, protocol, nil, data, failRate)
+			if err != nil {
+				// TODO: Add more specific error handling?
+				slog.Warn("Send attempt failed", "attempt", attempt, "error", err)
+				activityLogEntry.status = messageResponse.status
+			} else {
+				activityLogEntry.status = "sent"
+			}
+
+			// Record the resolved path details and how many bytes were sent
+			activityLogEntry.path = escapeRawText(messageResponse.path)
+			activityLogEntry.sourceAddr = messageResponse.sourceAddr
+			activityLogEntry.sourcePort = messageResponse.sourcePort
+			recordSendConnection(activityLogEntry, messageResponse)
+			activityLogEntry.bytesSent = messageResponse.bytesSent
+			activityLogEntry.bytesReceived = messageResponse.bytesReceived
+			activityLogEntry.details = escapeRawText(getSendDetails(messageResponse))
+			activityLogEntry.response = messageResponse
+
+			if err == nil || attempt > retries || isRunCancelled() {
+				break
+			}
+
+			// Record the failed attempt, and back off before retrying (if the run's cancelled meanwhile, the retry's logged as cancelled)
+			writeLogEntry(activityLog, activityLogEntry)
+			slog.Info("Retrying", "backoff", backoff)
+			sleepContext(backoff)
+			backoff *= 2
+		}
+	case "beacon":
+		options, err := parseBeaconOptions(commandArgs)
+		check(err)
+		failRate := *failRatePtr
+		if failRate < 0 || failRate > 1 {
+			check(fmt.Errorf("invalid fail-rate for beacon: %v (must be between 0.0 and 1.0)", failRate))
+		}
+		activityLogEntry.method = options.method
+		activityLogEntry.destAddr = escapeRawText(strings.Join(options.destAddrs, ","))
+		activityLogEntry.destPort = options.destPort
+		activityLogEntry.protocol = options.protocol
+		activityLogEntry.correlationId = newUUID()
+
+		// Make each transmission (each is logged as it's made)
+		beaconResponse := runBeacon(activityLog, activityLogEntry, options, failRate)
+		activityLogEntry.bytesSent = beaconResponse.bytesSent
+		activityLogEntry.bytesReceived = beaconResponse.bytesReceived
+		activityLogEntry.status = beaconResponse.status // [sent, partial, or the failed transmissions' status]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d sent, sleep %v, jitter %v, pad %d, seed %d", beaconResponse.sent, options.count, options.sleep, options.jitter, options.pad, options.seed))
+	case "traffic":
+		options, err := parseTrafficOptions(commandArgs)
+		check(err)
+		if options.profile == "list" {
+			activityLogEntry.method = "list"
+			count := listTrafficProfiles(os.Stdout)
+			activityLogEntry.status = "completed"
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d profiles", count))
+			break
+		}
+		failRate := *failRatePtr
+		if failRate < 0 || failRate > 1 {
+			check(fmt.Errorf("invalid fail-rate for traffic: %v (must be between 0.0 and 1.0)", failRate))
+		}
+		profile, _ := getTrafficProfile(options.profile)
+		activityLogEntry.method = profile.name
+		activityLogEntry.destAddr = options.destAddr
+		activityLogEntry.destPort = options.destPort
+		activityLogEntry.protocol = options.protocol
+		activityLogEntry.correlationId = newUUID()
+
+		// Make each of its requests (each is logged as it's made)
+		trafficResponse := runTraffic(activityLog, activityLogEntry, options, profile, failRate)
+		activityLogEntry.bytesSent = trafficResponse.bytesSent
+		activityLogEntry.bytesReceived = trafficResponse.bytesReceived
+		activityLogEntry.status = trafficResponse.status // [sent, partial, or the failed requests' status]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%s: %d of %d requests sent, over %d cycles, seed %d", profile.name, trafficResponse.sent, trafficResponse.requests, options.count, options.seed))
+	case "dga":
+		options, err := parseDGAOptions(commandArgs, time.Now())
+		check(err)
+		activityLogEntry.protocol = "dns"
+		activityLogEntry.correlationId = newUUID()
+
+		// Look up each domain (each lookup is logged as it's made)
+		domains := generateDGADomains(options.seed, options.count, options.tlds)
+		dgaResponse := runDGA(activityLog, activityLogEntry, options, domains)
+		activityLogEntry.status = "completed"
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d domains, %d resolved, %d not found, %d failed, seed %d", len(domains), dgaResponse.resolved, dgaResponse.notFound, dgaResponse.failed, options.seed))
+	case "listen":
+		if len(commandArgs) < 1 {
+			check(fmt.Errorf("not enough arguments for listen! Args: %v", commandArgs))
+		}
+
+		// Get the arguments
+		port, err := strconv.Atoi(commandArgs[0])
+		check(err)
+		protocol := "http"
+		if len(commandArgs) > 1 {
+			protocol = commandArgs[1]
+		}
+		maxReceives := *maxReceivesPtr
+		if maxReceives < 0 {
+			check(fmt.Errorf("invalid max-receives for listen: %d", maxReceives))
+		}
+
+		// Record the parsed identifying information
+		activityLogEntry.destPort = port
+		activityLogEntry.protocol = protocol
+
+		// Listen until we've received enough (each inbound connection is logged as it arrives)
+		listenResponse, err := listenForConnections(activityLog, activityLogEntry, port, protocol, *echoPtr, maxReceives, *listenTimeoutPtr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		activityLogEntry.status = listenResponse.status
+		activityLogEntry.path = escapeRawText(listenResponse.path)
+		activityLogEntry.bytesReceived = listenResponse.bytesReceived
+		activityLogEntry.bytesSent = listenResponse.bytesSent
+	case "scan":
+		if len(commandArgs) < 2 {
+			check(fmt.Errorf("not enough arguments for scan! Args: %v", commandArgs))
+		}
+
+		// Get the arguments
+		hosts, err := parseHostList(commandArgs[0])
+		check(err)
+		ports, err := parsePortList(commandArgs[1])
+		check(err)
+		rate := *scanRatePtr
+		if rate < 0 {
+			check(fmt.Errorf("invalid scan-rate for scan: %v", rate))
+		}
+
+		// Record the parsed identifying information
+		activityLogEntry.destAddr = escapeRawText(commandArgs[0])
+		activityLogEntry.protocol = "tcp"
+		activityLogEntry.path = escapeRawText("tcp://" + commandArgs[0] + ":" + commandArgs[1])
+
+		// Scan (each connect attempt is logged as it's made)
+		scanResponse := scanPorts(activityLog, activityLogEntry, hosts, ports, rate, *scanTimeoutPtr)
+		activityLogEntry.status = scanResponse.status
+	case "netenum":
+		// Run the native network discovery queries (each is logged as it's run)
+		discoveryResponse := runDiscoveryQueries(activityLog, activityLogEntry, getNetworkDiscoveryQueries(currentOS))
+		activityLogEntry.status = discoveryResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d queries completed, %d failed", discoveryResponse.completed, discoveryResponse.failed))
+	case "discover":
+		// Get the sub-modes to run (default: all)
+		modes := SystemDiscoveryModes
+		if len(commandArgs) > 0 {
+			modes = commandArgs
+		}
+		queries, err := getSystemDiscoveryQueries(currentOS, modes)
+		check(err)
+
+		// Run the native system discovery queries (each is logged as it's run)
+		discoveryResponse := runDiscoveryQueries(activityLog, activityLogEntry, queries)
+		activityLogEntry.status = discoveryResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d queries completed, %d failed", discoveryResponse.completed, discoveryResponse.failed))
+	case "credprobe":
+		// Get the paths to probe (default: the well-known credential stores for this OS)
+		homeDir, err := os.UserHomeDir()
+		check(err)
+		credentialPaths := getCredentialPaths(currentOS, homeDir)
+		if len(commandArgs) > 0 {
+			credentialPaths = []CredentialPath{}
+			for _, path := range commandArgs {
+				credentialPaths = append(credentialPaths, CredentialPath{path, "user-specified path"})
+			}
+		}
+
+		// Probe each path (each attempt is logged as it's made)
+		probeResponse := probeCredentialPaths(activityLog, activityLogEntry, credentialPaths)
+		activityLogEntry.status = probeResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d accessed, %d denied, %d not found or errored", probeResponse.accessed, probeResponse.denied, probeResponse.missing))
+	case "containerprobe":
+		// Get the indicators to probe (the well-known container escape indicators for this OS)
+		homeDir, err := os.UserHomeDir()
+		check(err)
+		containerProbes := getContainerProbes(currentOS, homeDir)
+
+		// Probe each one (each attempt is logged as it's made)
+		probeResponse := probeContainerIndicators(activityLog, activityLogEntry, containerProbes)
+		activityLogEntry.status = probeResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d accessed, %d denied, %d not found or errored", probeResponse.accessed, probeResponse.denied, probeResponse.missing))
+	case "browser":
+		// Get the arguments, and the real profile directories to probe with -probe
+		options, err := parseBrowserOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.dir)
+		homeDir, err := os.UserHomeDir()
+		check(err)
+		profiles := getBrowserProfiles(currentOS, homeDir, options.browsers)
+
+		// Write each throwaway database, then probe the profiles (each is logged as it's done)
+		browserResponse := simulateBrowserArtifacts(activityLog, activityLogEntry, options, profiles)
+		activityLogEntry.status = browserResponse.status // [completed, partial, error]
+		details := fmt.Sprintf("%d databases written, %d history entries, %d downloads", browserResponse.written, browserResponse.visits, browserResponse.downloads)
+		if options.probe {
+			details += fmt.Sprintf(", %d profile files accessed, %d denied, %d not found or errored", browserResponse.accessed, browserResponse.denied, browserResponse.missing)
+		}
+		activityLogEntry.details = escapeRawText(details)
+	case "k8sprobe":
+		// Get the API calls to make, and the credentials to make them with
+		options, err := parseK8sProbeOptions(commandArgs)
+		check(err)
+		config, err := loadK8sConfig(options.kubeconfig)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			if os.IsNotExist(err) {
+				activityLogEntry.status = "not_found"
+			} else {
+				activityLogEntry.status = "error"
+			}
+			break
+		}
+		namespace := options.namespace
+		if namespace == "" {
+			namespace = config.namespace
+		}
+		for _, probe := range options.probes {
+			if K8sResources[probe.resource].namespaced {
+				probe.namespace = namespace
+			}
+		}
+
+		// Record the API server (and how we're authenticating to it)
+		server, err := url.Parse(config.server)
+		check(err)
+		activityLogEntry.path = escapeRawText(config.server)
+		activityLogEntry.method = config.auth
+		activityLogEntry.protocol = server.Scheme
+		activityLogEntry.destAddr = server.Hostname()
+		activityLogEntry.destPort = 443
+		if server.Port() != "" {
+			activityLogEntry.destPort, _ = strconv.Atoi(server.Port())
+		}
+
+		// Make each call (each is logged as it's made)
+		probeResponse := probeK8sAPI(activityLog, activityLogEntry, config, options.probes, options.timeout)
+		activityLogEntry.status = probeResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d accessed, %d denied, %d not found or errored, namespace %s", probeResponse.accessed, probeResponse.denied, probeResponse.missing, namespace))
+	case "procaccess":
+		// Get the arguments
+		target := "lsass.exe"
+		if len(commandArgs) > 0 {
+			target = commandArgs[0]
+		}
+		accessMask := DefaultProcessAccessMask
+		if len(commandArgs) > 1 {
+			accessMask, err = parseAccessMask(commandArgs[1])
+			check(err)
+		}
+
+		// Open the handle, and record the target and access mask
+		status, pid, err := accessProcess(target, accessMask)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Printf("Opened a handle to %s (pid %d) with access mask 0x%x\n", target, pid, accessMask)
+		}
+		activityLogEntry.path = escapeRawText(target)
+		activityLogEntry.status = status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("pid %d, access mask 0x%x", pid, accessMask))
+	case "inject":
+		options, err := parseInjectOptions(commandArgs)
+		check(err)
+		activityLogEntry.method = options.method
+
+		// Inject into the cooperating child (never any other process)
+		injectResponse, err := injectIntoChild(options.method)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			if errors.Is(err, errors.ErrUnsupported) {
+				injectResponse.status = "unsupported"
+			} else if errors.Is(err, os.ErrPermission) {
+				injectResponse.status = "no_access"
+			} else if injectResponse.status == "" {
+				injectResponse.status = "error"
+			}
+		} else {
+			fmt.Printf("Injected into %s (pid %d) with %s\n", injectResponse.path, injectResponse.targetPid, options.method)
+		}
+		activityLogEntry.path = escapeRawText(injectResponse.path)
+		activityLogEntry.processId = injectResponse.targetPid
+		activityLogEntry.bytesSent = injectResponse.bytesWritten
+		activityLogEntry.status = injectResponse.status // [injected, queued, timeout, unsupported, no_access, error]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("source pid %d, target pid %d, %d bytes written at 0x%x, strlen returned %d", injectResponse.sourcePid, injectResponse.targetPid, injectResponse.bytesWritten, injectResponse.address, injectResponse.exitCode))
+	case "pipe":
+		if len(commandArgs) < 2 {
+			check(fmt.Errorf("not enough arguments for pipe! Args: %v", commandArgs))
+		}
+
+		// Get the arguments
+		mode := commandArgs[0]
+		name := commandArgs[1]
+		data := ""
+		if len(commandArgs) > 2 {
+			data = commandArgs[2]
+		}
+
+		// Record the parsed identifying information
+		activityLogEntry.method = mode
+		activityLogEntry.protocol = PipeProtocol
+
+		var pipeResponse *PipeResponse
+		switch mode {
+		case "create":
+			pipeResponse, err = createPipe(name, *echoPtr)
+		case "connect":
+			pipeResponse, err = connectPipe(name, data)
+		default:
+			check(fmt.Errorf("invalid mode for pipe: %s (must be create or connect)", mode))
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+
+		// Record the resolved path and how many bytes were exchanged
+		activityLogEntry.status = pipeResponse.status
+		activityLogEntry.path = escapeRawText(pipeResponse.path)
+		activityLogEntry.bytesSent = pipeResponse.bytesSent
+		activityLogEntry.bytesReceived = pipeResponse.bytesReceived
+	case "ssh":
+		if len(commandArgs) < 2 {
+			check(fmt.Errorf("not enough arguments for ssh! Args: %v", commandArgs))
+		}
+
+		// Get the arguments (the remote command's run by the remote user's shell, as ssh would)
+		target, err := parseSSHTarget(commandArgs[0])
+		check(err)
+		remoteCommand := strings.Join(commandArgs[1:], " ")
+
+		// Record the parsed identifying information
+		activityLogEntry.destAddr = target.host
+		activityLogEntry.destPort = target.port
+		activityLogEntry.protocol = "ssh"
+		activityLogEntry.path = escapeRawText(fmt.Sprintf("ssh://%s@%s", target.user, net.JoinHostPort(target.host, strconv.Itoa(target.port))))
+
+		fmt.Printf("Running %s on %s as %s over ssh...\n", remoteCommand, target.host, target.user)
+		sshResponse, err := runSSHCommand(target, remoteCommand, *sshKeyPtr, *sshPasswordPtr, *sshKnownHostsPtr, *sshTimeoutPtr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+
+		// Record who it ran as, how it authenticated, and how it exited
+		activityLogEntry.status = sshResponse.status
+		activityLogEntry.method = sshResponse.method
+		activityLogEntry.sourceAddr = sshResponse.sourceAddr
+		activityLogEntry.sourcePort = sshResponse.sourcePort
+		activityLogEntry.bytesReceived = sshResponse.bytesReceived
+		details := fmt.Sprintf("user %s, command %s", target.user, remoteCommand)
+		if sshResponse.hostKey != "" {
+			details += ", host key " + sshResponse.hostKey
+		}
+		activityLogEntry.details = escapeRawText(details)
+	case "remote-exec":
+		if len(commandArgs) < 3 {
+			check(fmt.Errorf("not enough arguments for remote-exec! Args: %v", commandArgs))
+		}
+
+		// Get the arguments (the command's run by cmd.exe on the remote host)
+		method := commandArgs[0]
+		host := commandArgs[1]
+		remoteCommand := strings.Join(commandArgs[2:], " ")
+		if !containsString(RemoteExecMethods, method) {
+			check(fmt.Errorf("invalid method for remote-exec: %s (must be one of %v)", method, RemoteExecMethods))
+		}
+
+		// Record the parsed identifying information, and link all the steps' entries together
+		activityLogEntry.method = method
+		activityLogEntry.destAddr = host
+		activityLogEntry.destPort = RemoteExecPorts[method]
+		activityLogEntry.protocol = method
+		activityLogEntry.correlationId = newUUID()
+
+		// Work out the native commands (the service, and the payload it runs, are named after the correlation ID)
+		service := "noisemaker-" + activityLogEntry.correlationId[:8]
+		payloadPath := filepath.Join(os.TempDir(), service + ".bat")
+		credentials := RemoteCredentials{user: *remoteUserPtr, password: *remotePasswordPtr}
+		if !containsString(RemoteExecPlatforms[method], currentOS) {
+			fmt.Printf("remote-exec over %s is not supported on %s\n", method, currentOS)
+			activityLogEntry.status = "unsupported"
+			break
+		}
+		steps, err := getRemoteExecSteps(currentOS, method, host, credentials, remoteCommand, payloadPath, service)
+		check(err)
+		if method == "smb" {
+			check(writeRemoteExecPayload(payloadPath, remoteCommand))
+			defer os.Remove(payloadPath)
+			activityLogEntry.path = escapeRawText(`\\` + host + `\ADMIN$\Temp\` + service + ".bat")
+		}
+
+		// Run them (each is logged as it's run)
+		fmt.Printf("Running %s on %s over %s...\n", remoteCommand, host, method)
+		remoteExecResponse := runRemoteExecSteps(activityLog, activityLogEntry, steps)
+		activityLogEntry.status = remoteExecResponse.status
+		details := fmt.Sprintf("%d of %d steps completed, command %s", remoteExecResponse.completed, len(steps), remoteCommand)
+		if method == "smb" {
+			details += ", service " + service
+		}
+		if credentials.user != "" {
+			details += ", as " + credentials.user
+		}
+		activityLogEntry.details = escapeRawText(details)
+	case "useradd", "userdel", "groupadd", "groupdel":
+		// Get the arguments
+		name := DefaultAccountName
+		if len(commandArgs) > 0 {
+			name = commandArgs[0]
+		}
+		activityLogEntry.path = escapeRawText(name)
+
+		// These change the system, so they have to be explicitly allowed
+		if !*allowPrivilegedPtr {
+			fmt.Printf("Command %s changes local accounts, and is disabled without -allow-privileged!\n", command)
+			activityLogEntry.status = "disabled"
+			break
+		}
+
+		status, nativeCmd, err := manageAccount(currentOS, command, name)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		activityLogEntry.status = status
+		activityLogEntry.details = escapeRawText(nativeCmd)
+
+		// (so a shutdown with -cleanup can remove what was added)
+		switch {
+		case command == "useradd" && status == "created":
+			trackArtifact(activityLogEntry, "user", name, "userdel", name)
+		case command == "groupadd" && status == "created":
+			trackArtifact(activityLogEntry, "group", name, "groupdel", name)
+		case status == "deleted":
+			untrackArtifact(command, name)
+		}
+	case "hosts":
+		// Get the arguments
+		if len(commandArgs) < 1 || (commandArgs[0] != "add" && commandArgs[0] != "remove") {
+			check(fmt.Errorf("invalid hosts: must be hosts (add|remove) [ip] [hostname]! Args: %v", commandArgs))
+		}
+		ip := DefaultHostsEntryIP
+		if len(commandArgs) > 1 {
+			ip = commandArgs[1]
+		}
+		hostname := DefaultHostsEntryName
+		if len(commandArgs) > 2 {
+			hostname = commandArgs[2]
+		}
+		if net.ParseIP(ip) == nil {
+			check(fmt.Errorf("invalid hosts: invalid ip '%s'", ip))
+		}
+		if err = checkHostsEntryName(hostname); err != nil {
+			check(fmt.Errorf("invalid hosts: %v", err))
+		}
+		activityLogEntry.path = escapeRawText(hostsFilePath)
+		activityLogEntry.method = commandArgs[0]
+
+		// This changes the system's name resolution, so it has to be explicitly allowed
+		if !*allowPrivilegedPtr {
+			fmt.Printf("Command %s changes the hosts file, and is disabled without -allow-privileged!\n", command)
+			activityLogEntry.status = "disabled"
+			break
+		}
+
+		var hostsResponse *HostsResponse
+		if commandArgs[0] == "add" {
+			hostsResponse, err = addHostsEntry(hostsFilePath, ip, hostname)
+		} else {
+			hostsResponse, err = removeHostsEntry(hostsFilePath, ip, hostname)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		activityLogEntry.status = hostsResponse.status // [added, removed, exists, not_found, no_access, error]
+		activityLogEntry.details = escapeRawText(hostsResponse.line)
+
+		// (so a shutdown with -cleanup can remove the line that was added)
+		switch hostsResponse.status {
+		case "added":
+			trackArtifact(activityLogEntry, "hosts-entry", hostsResponse.line, "hosts", "remove", ip, hostname)
+		case "removed":
+			untrackArtifact("hosts", "remove", ip, hostname)
+		}
+	case "inputhook":
+		options, err := parseInputHookOptions(commandArgs)
+		check(err)
+
+		// Register the hook, and unregister it once the duration's up
+		inputHookResponse, err := hookInput(options.duration)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Printf("Unregistered the %s hook after %v\n", inputHookResponse.api, inputHookResponse.duration)
+		}
+		activityLogEntry.method = escapeRawText(inputHookResponse.api)
+		activityLogEntry.status = inputHookResponse.status // [hooked, no_access, unsupported, error]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("registered for %dms", inputHookResponse.duration.Milliseconds()))
+	case "avdevice":
+		kind, err := parseAVDeviceArgs(commandArgs)
+		check(err)
+		activityLogEntry.method = kind
+
+		// Open the device, and close it again
+		avDeviceResponse, err := openAVDevice(kind)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Printf("Opened and closed %s %s\n", kind, avDeviceResponse.device)
+		}
+		activityLogEntry.path = escapeRawText(avDeviceResponse.device)
+		activityLogEntry.status = avDeviceResponse.status // [opened, not_found, no_access, unsupported, error]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("opened with %s", avDeviceResponse.api))
+	case "screenshot":
+		// Get the arguments
+		path := "./screenshot.png"
+		if len(commandArgs) > 0 {
+			path = commandArgs[0]
+		}
+		activityLogEntry.path = escapeRawText(path)
+
+		// Capture the screen, and record how and how big it was
+		screenshotResponse, err := captureScreen(currentOS, path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		activityLogEntry.status = screenshotResponse.status
+		if screenshotResponse.status == "captured" {
+			trackArtifact(activityLogEntry, "file", path, "delete", path)
+		}
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d bytes, using %s", screenshotResponse.size, screenshotResponse.method))
+	case "stage":
+		if len(commandArgs) < 2 {
+			check(fmt.Errorf("not enough arguments for stage! Args: %v", commandArgs))
+		}
+
+		// Get the arguments
+		archivePath := commandArgs[0]
+		sourcePaths := commandArgs[1:]
+		activityLogEntry.path = escapeRawText(archivePath)
+
+		// Archive the files, and record how many there were and how big they were
+		stageResponse, err := stageFiles(archivePath, sourcePaths, *archivePasswordPtr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		activityLogEntry.status = stageResponse.status
+		if stageResponse.status == "staged" {
+			trackArtifact(activityLogEntry, "file", archivePath, "delete", archivePath)
+		}
+		encrypted := ""
+		if *archivePasswordPtr != "" {
+			encrypted = ", encrypted"
+		}
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d source files, %d source bytes, %d archive bytes (%s%s)", stageResponse.sourceCount, stageResponse.sourceBytes, stageResponse.archiveBytes, stageResponse.format, encrypted))
+	case "exfil":
+		if len(commandArgs) < 3 {
+			check(fmt.Errorf("not enough arguments for exfil! Args: %v", commandArgs))
+		}
+
+		// Get the arguments
+		dir := commandArgs[0]
+		method := commandArgs[1]
+		destAddr := commandArgs[2]
+		destPort := 80
+		if len(commandArgs) > 3 {
+			destPort, err = strconv.Atoi(commandArgs[3])
+			check(err)
+		}
+		protocol := "http"
+		if len(commandArgs) > 4 {
+			protocol = commandArgs[4]
+		}
+		failRate := *failRatePtr
+		if failRate < 0 || failRate > 1 {
+			check(fmt.Errorf("invalid fail-rate for exfil: %v (must be between 0.0 and 1.0)", failRate))
+		}
+		retries := *retriesPtr
+		if retries < 0 {
+			check(fmt.Errorf("invalid retries for exfil: %d", retries))
+		}
+
+		// Record the parsed identifying information, and link all the steps' entries together
+		activityLogEntry.method = method
+		activityLogEntry.destAddr = destAddr
+		activityLogEntry.destPort = destPort
+		activityLogEntry.protocol = protocol
+		activityLogEntry.correlationId = newUUID()
+
+		// Stage and send it (each step is logged as it's done)
+		exfilResponse := exfilDirectory(activityLog, activityLogEntry, dir, method, destAddr, destPort, protocol, *archivePasswordPtr, failRate, retries, *retryBackoffPtr)
+		activityLogEntry.path = escapeRawText(dir)
+		activityLogEntry.status = exfilResponse.status
+		activityLogEntry.bytesSent = exfilResponse.bytesSent
+		activityLogEntry.bytesReceived = exfilResponse.bytesReceived
+	case "playbook":
+		if len(commandArgs) < 1 {
+			check(fmt.Errorf("not enough arguments for playbook! Args: %v", commandArgs))
+		}
+
+		// Load it, with any variables given after it (all of the steps are checked up front)
+		path := commandArgs[0]
+		activityLogEntry.path = escapeRawText(path)
+		playbook, err := loadPlaybook(path)
+		check(err)
+		check(setPlaybookVars(playbook, commandArgs[1:]))
+		checkpoint, err := openPlaybookCheckpoint(*stateFilePtr, activityLog, activityLogEntry, playbook)
+		check(err)
+		defer checkpoint.saveAfter()
+
+		// Run it (each step is logged as it's run)
+		runPlaybookActivity(activityLog, activityLogEntry, playbook, checkpoint)
+	case "scenario":
+		if len(commandArgs) < 1 || (commandArgs[0] != "list" && len(commandArgs) < 2) {
+			check(fmt.Errorf("not enough arguments for scenario! Args: %v", commandArgs))
+		}
+
+		activityLogEntry.method = commandArgs[0]
+		switch commandArgs[0] {
+		case "list":
+			scenarioResponse := listScenarios(os.Stdout)
+			activityLogEntry.status = scenarioResponse.status
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d scenarios", scenarioResponse.scenarios))
+		case "show":
+			// Print the scenario's playbook (ie. to start a new playbook from)
+			activityLogEntry.path = escapeRawText(commandArgs[1])
+			contents, err := readScenario(commandArgs[1])
+			check(err)
+			fmt.Print(string(contents))
+			activityLogEntry.status = "completed"
+		case "run":
+			// Load it, with any variables given after it (all of the steps are checked up front)
+			name := commandArgs[1]
+			activityLogEntry.path = escapeRawText(name)
+			playbook, cleanup, err := loadScenario(name, commandArgs[2:])
+			check(err)
+			checkpoint, err := openPlaybookCheckpoint(*stateFilePtr, activityLog, activityLogEntry, playbook)
+			if err != nil {
+				cleanup()
+				check(err)
+			}
+			defer checkpoint.saveAfter()
+			defer func() {
+				// (a temporary workdir is kept while there's a state file to resume in it from)
+				if checkpoint == nil || checkpoint.removed {
+					cleanup()
 				}
+			}()
+
+			// Run it (each step is logged as it's run)
+			runPlaybookActivity(activityLog, activityLogEntry, playbook, checkpoint)
+		default:
+			check(fmt.Errorf("invalid scenario command specified: %s", commandArgs[0]))
+		}
+	case "script":
+		// Parse it up front (so a syntax error's reported before anything's run), then run it, logging each command it runs
+		options, err := parseScriptOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.path)
+		stmts, err := loadScript(options.path)
+		check(err)
+		activityLogEntry.correlationId = newUUID()
+		scriptResponse := runScript(activityLog, activityLogEntry, stmts, options)
+		activityLogEntry.status = scriptResponse.status
+	case "cleanup":
+		options, err := parseCleanupOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.path)
+
+		// Remove whatever's still there (with nothing recorded yet, there's nothing to remove)
+		artifacts, err := readArtifactManifest(options.path, options.runId)
+		if os.IsNotExist(err) {
+			artifacts, err = []*Artifact{}, nil
+		}
+		check(err)
+		artifactsResponse := undoArtifacts(activityLog, activityLogEntry, artifacts, "cleanup")
+		fmt.Printf("Removed %d of %d artifacts\n", artifactsResponse.removed, artifactsResponse.artifacts)
+		activityLogEntry.status = artifactsResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d artifacts removed, %d failed", artifactsResponse.removed, artifactsResponse.artifacts, artifactsResponse.failed))
+	case "replay":
+		options, err := parseReplayOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.path)
+
+		// Read the commands to replay up front, since the log may be the one being written to
+		steps, err := loadReplaySteps(options)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			activityLogEntry.status = "error"
+			if os.IsNotExist(err) {
+				activityLogEntry.status = "not_found"
 			}
-		} else if scanner.Err() != nil {
-			fmt.Println("Unable to open existing file for appending, it does not exist!")
+			activityLogEntry.details = escapeRawText(err.Error())
+			break
 		}
-	}
-	peekActivityLogFile.Close()
 
-	// Open the activity log for writing
-	var activityLogFile *os.File
-	var writeHistoricalRecords bool
-	if activityLogFileExists && !overwrite {
-		fmt.Printf("Opening existing log file %s for appending...\n", logFilePath)
-		activityLogFile, err = os.OpenFile(logFilePath, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0644)
-		writeHistoricalRecords = false
-	} else if activityLogFileExists && overwrite {
-		fmt.Printf("Opening existing log file %s for overwriting...\n", logFilePath)
-		activityLogFile, err = os.OpenFile(logFilePath, os.O_RDWR | os.O_CREATE, 0644)
-		writeHistoricalRecords = true
-	} else {
-		fmt.Printf("Creating new log file %s...\n", logFilePath)
-		activityLogFile, err = os.Create(logFilePath)
-		writeHistoricalRecords = true
-	}
-	check(err)
-	defer activityLogFile.Close()
+		// Run them again (each step is logged as it's run)
+		replayResponse := runReplay(activityLog, activityLogEntry, steps, options.speed)
+		activityLogEntry.status = replayResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d steps replayed (at %gx speed)", replayResponse.completed, replayResponse.steps, options.speed))
+	case "generate":
+		options, err := parseGenerateOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.profile.Name)
 
-	// Write the header and old records
-	if writeHistoricalRecords {
-		// Write header
-		_, err = activityLogFile.WriteString(HeaderStr + "\n")
+		// Generate the activity (each one is logged as it's done)
+		fmt.Printf("Generating %s activity for %v (%g per minute, on average)...\n", options.profile.Name, options.duration, options.profile.Rate)
+		generateResponse, err := runGenerate(activityLog, activityLogEntry, options)
+		activityLogEntry.status = generateResponse.status
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			activityLogEntry.details = escapeRawText(err.Error())
+			break
+		}
+		kinds := []string{}
+		for _, kind := range GenerateActivityKinds {
+			kinds = append(kinds, fmt.Sprintf("%d %s", generateResponse.kinds[kind], kind))
+		}
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d activities generated (%s), %d failed, with seed %d", generateResponse.completed, strings.Join(kinds, ", "), generateResponse.failed, options.seed))
+	case "fuzz":
+		options, err := parseFuzzOptions(commandArgs, currentOS)
 		check(err)
+		activityLogEntry.correlationId = newUUID()
 
-		// Write all other existing log entries
-		for _, logEntry := range existingLogEntries {
-			writeLogEntry(activityLogFile, logEntry)
+		// Run the cases (each command is logged as it's run, labeled with its seed and case number)
+		fuzzResponse, err := runFuzz(activityLog, activityLogEntry, options, currentOS)
+		activityLogEntry.status = fuzzResponse.status
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			activityLogEntry.details = escapeRawText(err.Error())
+			break
 		}
-	}
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d cases (%d commands), %d failed, with seed %d", fuzzResponse.cases, fuzzResponse.commands, fuzzResponse.failed, options.seed))
+	case "compare":
+		options, err := parseCompareOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.logPath)
 
-	// Create the initial activity log entry
-	activityLogEntry.timestamp = time.Now().Format(time.RFC3339)
-	activityLogEntry.activity = command
-	activityLogEntry.username = currentUser.Username
-	activityLogEntry.os = currentOS
-	activityLogEntry.processName = currentProcessName
-	activityLogEntry.processCmd = escapeCommandString(command, commandArgs)
-	activityLogEntry.processId = currentProcessId
+		// Print the coverage report
+		compareResponse, err := runCompare(options, os.Stdout)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			activityLogEntry.details = escapeRawText(err.Error())
+		} else {
+			report := compareResponse.report
+			activityLogEntry.method = report.Format
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d entries detected (%.1f%% coverage) in %s", report.Detected, report.Generated, report.Coverage * 100, options.exportPath))
+		}
+		activityLogEntry.status = compareResponse.status
+	case "daemon":
+		addr := DefaultDaemonAddr
+		if len(commandArgs) > 0 {
+			addr = commandArgs[0]
+		}
+
+		tlsConfig, err := getDaemonTLSConfig(*tlsCertPtr, *tlsKeyPtr, *tlsCAPtr)
+		check(err)
+
+		// Serve until stopped (each job is logged as it's run)
+		daemonResponse, err := runDaemon(activityLog, activityLogEntry, addr, tlsConfig, daemonTokenPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		activityLogEntry.path = escapeRawText(daemonResponse.addr)
+		activityLogEntry.status = daemonResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d jobs completed, %d failed, %d cancelled", daemonResponse.completed, daemonResponse.failed, daemonResponse.cancelled))
+	case "control":
+		if len(commandArgs) < 2 {
+			check(fmt.Errorf("not enough arguments for control! Args: %v", commandArgs))
+		}
 
-	// Determine what process to run
-	switch command {
-	case "execute":
-		// Call startProcess and capture the output
-		procCmd := commandArgs[0]
-		procArgs := commandArgs[1:]
-		activityLogEntry.processCmd = escapeCommandString(procCmd, procArgs)
+		// Load the playbook, and check it before sending it anywhere
+		path := commandArgs[0]
+		activityLogEntry.path = escapeRawText(path)
+		playbookContents, err := os.ReadFile(path)
+		check(err)
+		playbook, err := parsePlaybook(playbookContents)
+		check(err)
+		agents := []string{}
+		for _, agentList := range commandArgs[1:] {
+			for _, agent := range strings.Split(agentList, ",") {
+				if strings.TrimSpace(agent) != "" {
+					agents = append(agents, strings.TrimSpace(agent))
+				}
+			}
+		}
 
-		fmt.Printf("Running command %s with args %v\n", procCmd, procArgs)
-		process, cancelFunc, processState, err := startProcess(procCmd, procArgs)
+		// Agents given as just a host use HTTPS, if we have anything to do TLS with
+		tlsConfig, err := getControlTLSConfig(*tlsCertPtr, *tlsKeyPtr, *tlsCAPtr)
 		check(err)
+		defaultScheme := "http"
+		if *tlsCertPtr != "" || *tlsCAPtr != "" {
+			defaultScheme = "https"
+		}
+		client := &http.Client{Transport: newSourceTransport(tlsConfig), Timeout: 30 * time.Second}
 
-		// Close the connection, if we need to
-		if cancelFunc != nil {
-			// TODO: Verify this does what we think it does!
-			// `defer cancelFunc` vs `defer cancelFunc()`!
-			defer cancelFunc()
+		// Agents given without a token of their own get the local daemon's (if there is one)
+		token := ""
+		if fileExists(daemonTokenPath) {
+			token, err = readDaemonToken(daemonTokenPath)
+			check(err)
 		}
 
-		// Record the process info
-		if processState != nil {
-			activityLogEntry.processId = processState.Pid()
-			activityLogEntry.status = processState.String()
-		} else {
-			activityLogEntry.processId = process.Pid
-			activityLogEntry.status = "unable_to_run"
+		// Dispatch it (each agent's entries, and its dispatch, are logged as they're collected)
+		fmt.Printf("Dispatching playbook %s to %d agents...\n", playbook.Name, len(agents))
+		controlResponse := controlAgents(activityLog, activityLogEntry, playbookContents, agents, client, defaultScheme, token, *controlTimeoutPtr)
+		activityLogEntry.status = controlResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d agents completed, %d entries collected", controlResponse.succeeded, len(agents), controlResponse.collected))
+	case "collect":
+		addr := DefaultCollectAddr
+		if len(commandArgs) > 0 {
+			addr = commandArgs[0]
+		}
+		maxStreams := *maxReceivesPtr
+		if maxStreams < 0 {
+			check(fmt.Errorf("invalid max-receives for collect: %d", maxStreams))
 		}
 
-	case "create":
-		// Call createFile and capture the output
-		if len(commandArgs) < 1 {
-			check(fmt.Errorf("not enough arguments for create! Args: %v", commandArgs))
+		// Collect until we've been sent enough (each entry is logged as it arrives)
+		collectResponse, err := runCollector(activityLog, activityLogEntry, addr, maxStreams)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
 		}
-		path := commandArgs[0]
-		var contents string = ""
-		if len(commandArgs) > 1 {
-			contents = commandArgs[1]
+		activityLogEntry.path = escapeRawText(collectResponse.addr)
+		activityLogEntry.protocol = "grpc"
+		activityLogEntry.status = collectResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d entries received over %d streams", collectResponse.received, collectResponse.streams))
+	case "watch":
+		options, err := parseWatchOptions(commandArgs)
+		check(err)
+		activityLogEntry.path = escapeRawText(options.dir)
+
+		// Watch until we're told to stop (each change is logged as it's observed)
+		watchResponse, err := watchDirectory(activityLog, activityLogEntry, options)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		activityLogEntry.method = watchResponse.method
+		activityLogEntry.status = watchResponse.status // [stopped, not_found, no_access, error]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d files, %d created, %d modified, %d deleted, %d re-created", watchResponse.files, watchResponse.created, watchResponse.modified, watchResponse.deleted, watchResponse.recreated))
+	case "decoy":
+		options, err := parseDecoyOptions(commandArgs, filepath.Join(filepath.Dir(flag.Lookup("logfile").Value.String()), DefaultDecoyManifestName))
+		check(err)
+		activityLogEntry.path = escapeRawText(options.manifest)
+		activityLogEntry.method = options.mode
+
+		// Plant, check, or remove each decoy (each is logged as it's done)
+		var decoyResponse *DecoyResponse
+		var details string
+		switch options.mode {
+		case "plant":
+			decoyResponse = plantDecoys(activityLog, activityLogEntry, options)
+			details = fmt.Sprintf("%d decoys planted in %d directories, %d failed (seed %d)", decoyResponse.planted, len(options.dirs), decoyResponse.failed, options.seed)
+		case "check":
+			decoyResponse, err = checkDecoys(activityLog, activityLogEntry, options)
+			details = fmt.Sprintf("%d decoys: %d accessed, %d modified, %d deleted, %d untouched, %d failed", decoyResponse.decoys, decoyResponse.accessed, decoyResponse.modified, decoyResponse.deleted, decoyResponse.untouched, decoyResponse.failed)
+		case "remove":
+			decoyResponse, err = removeDecoys(activityLog, activityLogEntry, options)
+			details = fmt.Sprintf("%d of %d decoys removed, %d failed", decoyResponse.removed, decoyResponse.decoys, decoyResponse.failed)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			details = err.Error()
 		}
+		activityLogEntry.status = decoyResponse.status // [completed, partial, error, not_found, no_access]
+		activityLogEntry.details = escapeRawText(details)
+	case "edgenames":
+		options, err := parseEdgeNamesOptions(commandArgs)
+		check(err)
 
-		status, err := createFile(path, contents)
+		// Try each name (each attempt is logged, with what the OS made of it)
+		edgeNamesResponse, err := tryEdgeNames(activityLog, activityLogEntry, options)
+		activityLogEntry.path = escapeRawText(edgeNamesResponse.dir)
+		activityLogEntry.method = strings.Join(options.sets, ",")
+		activityLogEntry.status = edgeNamesResponse.status // [completed, not_found, no_access, error]
 		if err != nil {
-			// TODO: Add more specific create error info to log entry!
-			activityLogEntry.status = status // [not_found, invalid_path, no_access, error]
-		} else {
-			activityLogEntry.status = "created"
+			fmt.Printf("Error: %v\n", err)
+			activityLogEntry.path = escapeRawText(options.dir)
+			activityLogEntry.details = escapeRawText(err.Error())
+			break
 		}
-	case "update":
-		// Call updateFile and capture the output
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d names: %d created as given, %d renamed, %d not on disk, %d collided, %d rejected", edgeNamesResponse.attempts, edgeNamesResponse.created, edgeNamesResponse.renamed, edgeNamesResponse.missing, edgeNamesResponse.collided, edgeNamesResponse.rejected))
+	case "migrate-log":
 		if len(commandArgs) < 1 {
-			check(fmt.Errorf("not enough arguments for update! Args: %v", commandArgs))
+			check(fmt.Errorf("not enough arguments for migrate-log! Args: %v", commandArgs))
 		}
+
+		// Get the arguments (migrating in place, by default)
 		path := commandArgs[0]
-		contents := ""
+		outputPath := path
 		if len(commandArgs) > 1 {
-			contents = commandArgs[1]
+			outputPath = commandArgs[1]
 		}
+		activityLogEntry.path = escapeRawText(path)
 
-		status, err := updateFile(path, contents)
+		// Migrate it
+		migrateResponse, err := migrateLog(path, outputPath)
 		if err != nil {
-			activityLogEntry.status = status // [not_found, invalid_path, no_access, error]
+			fmt.Printf("Error: %v\n", err)
+			activityLogEntry.details = escapeRawText(err.Error())
 		} else {
-			activityLogEntry.status = "updated"
+			fmt.Printf("Log file %s %s: %d entries from schema version %d (now %d)\n", path, migrateResponse.status, migrateResponse.entries, migrateResponse.fromVersion, SchemaVersion)
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d entries migrated from schema version %d to %d", migrateResponse.entries, migrateResponse.fromVersion, SchemaVersion))
 		}
-	case "delete":
-		// Call deleteFile and capture the output
-		if len(commandArgs) < 1 {
-			check(fmt.Errorf("not enough arguments for delete! Args: %v", commandArgs))
+		activityLogEntry.status = migrateResponse.status
+	case "verify":
+		// Verify the activity log, unless we're given another one
+		path := flag.Lookup("logfile").Value.String()
+		if len(commandArgs) > 0 {
+			path = commandArgs[0]
 		}
-		path := commandArgs[0]
-		status, err := deleteFile(path)
+		activityLogEntry.path = escapeRawText(path)
+
+		verifyResponse, err := verifyLog(path)
 		if err != nil {
-			// TODO: Add more specific delete error info to log entry!
-			activityLogEntry.status = status // [not_found, invalid_path, no_access, error]
+			fmt.Printf("Error: %v\n", err)
+			activityLogEntry.details = escapeRawText(err.Error())
 		} else {
-			activityLogEntry.status = "deleted"
+			fmt.Printf("Log file %s is %s: %d of %d rows malformed\n", path, verifyResponse.status, verifyResponse.malformed, verifyResponse.rows)
+			activityLogEntry.details = escapeRawText(describeVerifyResponse(verifyResponse))
 		}
-	case "send":
-		if len(commandArgs) < 2 {
-			check(fmt.Errorf("not enough arguments for send! Args: %v", commandArgs))
+		activityLogEntry.status = verifyResponse.status
+	case "verify-signatures":
+		if logSigner == nil {
+			check(fmt.Errorf("verify-signatures needs -sign-key (the HMAC key, or the Ed25519 private or public key)"))
 		}
 
-		// Get the arguments
-		method := http.MethodGet
+		// Check the activity log, unless we're given another one
+		path := flag.Lookup("logfile").Value.String()
 		if len(commandArgs) > 0 {
-			method = commandArgs[0]
-		}
-		destAddr := "192.168.0.1"
-		if len(commandArgs) > 1 {
-			destAddr = commandArgs[1]
+			path = commandArgs[0]
 		}
-		destPort := 80
-		if len(commandArgs) > 2 {
-			destPort, err = strconv.Atoi(commandArgs[2])
-			check(err)
+		activityLogEntry.path = escapeRawText(path)
+
+		signaturesResponse, err := verifyLogSignatures(path, logSigner)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			activityLogEntry.details = escapeRawText(err.Error())
+		} else {
+			fmt.Printf("Log file %s is %s: %d of %d entries have valid signatures\n", path, signaturesResponse.status, signaturesResponse.valid, signaturesResponse.entries)
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d entries have valid signatures, %d problems found", signaturesResponse.valid, signaturesResponse.entries, len(signaturesResponse.problems)))
 		}
-		protocol := "http"
-		if len(commandArgs) > 3 {
-			protocol = commandArgs[3]
+		activityLogEntry.status = signaturesResponse.status
+	case "decrypt-log":
+		if len(commandArgs) < 1 {
+			check(fmt.Errorf("not enough arguments for decrypt-log! Args: %v", commandArgs))
 		}
-		data := ""
-		if len(commandArgs) > 4 {
-			data = commandArgs[4]
+		if logCipher == nil {
+			check(fmt.Errorf("decrypt-log needs -log-encrypt (the log's key)"))
 		}
 
-		// Record the parsed identifying information
-		activityLogEntry.method = method
-		activityLogEntry.destAddr = destAddr
-		activityLogEntry.destPort = destPort
-		activityLogEntry.protocol = protocol
-
-		// Log the details of what we're sending
-		fmt.Printf("Sending %d bytes of data to %s %s (port %d) using protocol %s...\n", len(data), method, destAddr, destPort, protocol)
+		// Decrypt it to the output, or to the console
+		path := commandArgs[0]
+		outputPath := ""
+		if len(commandArgs) > 1 {
+			outputPath = commandArgs[1]
+		}
+		activityLogEntry.path = escapeRawText(path)
 
-		// Send it!
-		// TODO: Add header encoding somehow!
-		messageResponse, err := sendMessage(method, destAddr, destPort, protocol, nil, data)
+		decryptResponse, err := decryptLogFile(path, outputPath)
 		if err != nil {
-			// TODO: Add more specific error handling?
-			activityLogEntry.status = messageResponse.status
+			fmt.Printf("Error: %v\n", err)
+			activityLogEntry.details = escapeRawText(err.Error())
 		} else {
-			activityLogEntry.status = "sent"
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d lines decrypted", decryptResponse.lines))
+			if outputPath != "" {
+				fmt.Printf("Log file %s decrypted to %s: %d lines\n", path, outputPath, decryptResponse.lines)
+				activityLogEntry.details = escapeRawText(fmt.Sprintf("%d lines decrypted to %s", decryptResponse.lines, outputPath))
+			}
+		}
+		activityLogEntry.status = decryptResponse.status
+	case "log":
+		if len(commandArgs) < 1 {
+			check(fmt.Errorf("not enough arguments for log! Args: %v", commandArgs))
 		}
 
-		// Record the resolved path details and how many bytes were sent
-		activityLogEntry.path = messageResponse.path
-		activityLogEntry.sourceAddr = messageResponse.sourceAddr
-		activityLogEntry.sourcePort = messageResponse.sourcePort
-		activityLogEntry.bytesSent = messageResponse.bytesSent
+		// Query the activity log, unless we're given another one
+		activityLogEntry.method = commandArgs[0]
+		switch commandArgs[0] {
+		case "query":
+			query, err := parseLogQuery(commandArgs[1:], flag.Lookup("logfile").Value.String(), time.Now())
+			check(err)
+			activityLogEntry.path = escapeRawText(query.path)
+
+			// Print the matching entries (the log entry for the query only goes to the sinks)
+			queryResponse, err := runLogQuery(query, os.Stdout)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				activityLogEntry.details = escapeRawText(err.Error())
+			} else {
+				activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d entries matched", queryResponse.matched, queryResponse.scanned))
+			}
+			activityLogEntry.status = queryResponse.status
+		case "stats":
+			options, err := parseLogStatsOptions(commandArgs[1:], flag.Lookup("logfile").Value.String(), time.Now())
+			check(err)
+			activityLogEntry.path = escapeRawText(options.path)
+
+			// Print (or write out) the summary of the matching entries
+			statsResponse, err := runLogStats(options, os.Stdout)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				activityLogEntry.details = escapeRawText(err.Error())
+			} else {
+				if options.outputPath != "" {
+					fmt.Printf("Wrote summary of log file %s to %s\n", options.path, options.outputPath)
+				}
+				stats := statsResponse.stats
+				activityLogEntry.details = escapeRawText(fmt.Sprintf("%d entries summarized (%d activities, %d unique destinations)", stats.Entries, len(stats.Activities), len(stats.Destinations)))
+			}
+			activityLogEntry.status = statsResponse.status
+		default:
+			check(fmt.Errorf("invalid log command specified: %s", commandArgs[0]))
+		}
+	case "doctor":
+		// Check every command's prerequisites, and report which are met
+		options, err := parseDoctorOptions(commandArgs, flag.Lookup("logfile").Value.String())
+		check(err)
+		doctorResponse := runDoctor(options, currentOS, os.Stdout)
+		fmt.Printf("%d checks passed, %d warnings, %d failed\n", doctorResponse.passed, doctorResponse.warnings, doctorResponse.failed)
+		activityLogEntry.status = doctorResponse.status // [healthy, degraded, unhealthy]
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d checks passed, %d warnings, %d failed", doctorResponse.passed, len(doctorResponse.checks), doctorResponse.warnings, doctorResponse.failed))
+	case "action":
+		// Run one of the custom actions declared in the -actions file, logging what it reports it did
+		name, actionArgs, err := parseActionArgs(commandArgs)
+		check(err)
+		actions, err := loadActions(*actionsPtr)
+		check(err)
+		if name == "list" {
+			activityLogEntry.method = "list"
+			count := listActions(os.Stdout, actions)
+			activityLogEntry.status = "completed"
+			activityLogEntry.details = escapeRawText(fmt.Sprintf("%d actions", count))
+			break
+		}
+		action, found := actions[name]
+		if !found {
+			check(fmt.Errorf("unknown action '%s' (declare it in the -actions file)", name))
+		}
+		activityLogEntry.correlationId = newUUID()
+		actionResponse := runAction(activityLog, activityLogEntry, action, actionArgs)
+		activityLogEntry.status = actionResponse.status
+	case "capabilities":
+		// List what's supported on this OS and build, so playbooks can be planned around it
+		format, err := parseCapabilitiesFormat(commandArgs)
+		check(err)
+		activityLogEntry.method = format
+		capabilitiesResponse, err := printCapabilities(os.Stdout, format, currentOS, CgoEnabled)
+		check(err)
+		activityLogEntry.status = capabilitiesResponse.status
+		activityLogEntry.details = escapeRawText(fmt.Sprintf("%d of %d capabilities supported on %s/%s", capabilitiesResponse.supported, capabilitiesResponse.total, currentOS, runtime.GOARCH))
 	case "help":
 		// TODO: Print the help text?
 	default:
 		check(fmt.Errorf("invalid command specified: %s", command))
 	}
 
-	writeLogEntry(activityLogFile, activityLogEntry)
+	markCancelled(activityLogEntry)
+	writeLogEntry(activityLog, activityLogEntry)
+}
+
+// Runs a single command like runCommand, but recovers if it's invalid, recording the entry with an error status (and the reason in details)
+func runCommandSafely(activityLog Sink, activityLogEntry *ActivityLogEntry, command string, commandArgs []string) error {
+	err := runCommandRecovering(activityLog, activityLogEntry, command, commandArgs)
+	if err != nil {
+		markCancelled(activityLogEntry)
+		writeLogEntry(activityLog, activityLogEntry)
+	}
+	return err
+}
+
+// Runs a single command like runCommand, but recovers if it's invalid, setting the entry's error status (and the reason in details)
+// without logging it, so the caller can record what it does about it first
+func runCommandRecovering(activityLog Sink, activityLogEntry *ActivityLogEntry, command string, commandArgs []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+			activityLogEntry.status = "error"
+			activityLogEntry.details = escapeRawText(err.Error())
+		}
+	}()
+	runCommand(activityLog, activityLogEntry, command, commandArgs)
+	return nil
 }
 
 // =====================================================================
 // Actions
 // =====================================================================
 
-// Create a file with given contents
-func createFile(path string, contents string) (string, error) {
-	if fileExists(path) {
-		fmt.Printf("File %s already exists, unable to write!\n", path)
-		return "exists", fmt.Errorf("file_already_exists: %s", path)
-	}
-	f, err := os.Create(path)
-	if err != nil {
-		// TODO: Change this to spit out appropriate messages ("not_found", "invalid_path", "no_access", "error")
-		fmt.Printf("Error: %v\n", err)
-		return "error", err
-	}
-	defer f.Close()
-
-	bytesWritten, err := f.WriteString(contents)
-	if err != nil {
-		return "error", err
-	}
+// Create a file with given contents, written with the I/O mode
+func createFile(path string, contents string, mode string) (string, error) {
+	return runCancellable("cancelled", func() (string, error) {
+		if smbPath, found := isSMBClientPath(path); found {
+			return createSMBFile(smbPath, contents)
+		}
+		if fileExists(path) {
+			fmt.Printf("File %s already exists, unable to write!\n", path)
+			return "exists", fmt.Errorf("file_already_exists: %s", path)
+		}
+		bytesWritten, err := writeFileContents(path, os.O_RDWR | os.O_CREATE | os.O_TRUNC, contents, mode)
+		if err != nil {
+			// TODO: Change this to spit out appropriate messages ("not_found", "invalid_path", "no_access", "error")
+			fmt.Printf("Error: %v\n", err)
+			return getWriteFileStatus(err), err
+		}
 
-	fmt.Printf("%d bytes written to new file %s\n", bytesWritten, path)
-	return "created", nil
+		fmt.Printf("%d bytes written to new file %s\n", bytesWritten, path)
+		return "created", nil
+	})
 }
 
-// Update a file with new contents, if it exists
-func updateFile(path string, contents string) (string, error) {
-	if !fileExists(path) {
-		fmt.Printf("File %s not found for updating!\n", path)
-		return "not_found", fmt.Errorf("file_not_found: %s", path)
-	}
+// Update a file with new contents (written with the I/O mode), if it exists
+func updateFile(path string, contents string, mode string) (string, error) {
+	return runCancellable("cancelled", func() (string, error) {
+		if smbPath, found := isSMBClientPath(path); found {
+			return updateSMBFile(smbPath, contents)
+		}
+		if !fileExists(path) {
+			fmt.Printf("File %s not found for updating!\n", path)
+			return "not_found", fmt.Errorf("file_not_found: %s", path)
+		}
 	
-	f, err := os.OpenFile(path, os.O_RDWR, 0644)
-	if err != nil {
-		// TODO: Change this to spit out appropriate messages ("not_found", "invalid_path", "no_access", "error")
-		return "error", err
-	}
-	defer f.Close()
-
-	bytesWritten, err := f.WriteString(contents)
-	if err != nil {
-		return "error", err
-	}
+		bytesWritten, err := writeFileContents(path, os.O_RDWR, contents, mode)
+		if err != nil {
+			// TODO: Change this to spit out appropriate messages ("not_found", "invalid_path", "no_access", "error")
+			return getWriteFileStatus(err), err
+		}
 
-	fmt.Printf("%d bytes written to updated file %s\n", bytesWritten, path)
-	return "updated", nil
+		fmt.Printf("%d bytes written to updated file %s\n", bytesWritten, path)
+		return "updated", nil
+	})
 }
 
 // Delete a file, if it exists
 func deleteFile(path string) (string, error) {
-	if !fileExists(path) {
-		fmt.Printf("File %s not found for deleting!\n", path)
-		return "not_found", fmt.Errorf("file_not_found: %s", path)
-	}
+	return runCancellable("cancelled", func() (string, error) {
+		if smbPath, found := isSMBClientPath(path); found {
+			return deleteSMBFile(smbPath)
+		}
+		if !fileExists(path) && !isEmptyDir(path) {
+			// (a directory's only deleted if it's empty, as one an artifact was put in is, once cleanup's deleted what's in it)
+			fmt.Printf("File %s not found for deleting!\n", path)
+			return "not_found", fmt.Errorf("file_not_found: %s", path)
+		}
 
-	err := os.Remove(path)
-	if err != nil {
-		// TODO: Change this to spit out appropriate messages ("not_found", "invalid_path", "no_access", "error")
-		return "error", err
+		err := os.Remove(path)
+		if err != nil {
+			// TODO: Change this to spit out appropriate messages ("not_found", "invalid_path", "no_access", "error")
+			return "error", err
+		}
+
+		fmt.Printf("File %s deleted\n", path)
+		return "deleted", nil
+	})
+}
+
+// Read a file's contents, if it exists
+func readFile(path string) (string, string, error) {
+	type result struct {
+		contents			string
+		status				string
 	}
+	read, err := runCancellable(result{status: "cancelled"}, func() (result, error) {
+		var contents string
+		if smbPath, found := isSMBClientPath(path); found {
+			var status string
+			var err error
+			contents, status, err = readSMBFile(smbPath)
+			if err != nil {
+				return result{status: status}, err
+			}
+		} else {
+			if !fileExists(path) {
+				fmt.Printf("File %s not found for reading!\n", path)
+				return result{status: "not_found"}, fmt.Errorf("file_not_found: %s", path)
+			}
+			read, err := os.ReadFile(path)
+			if os.IsPermission(err) {
+				fmt.Printf("Error: %v\n", err)
+				return result{status: "no_access"}, err
+			} else if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return result{status: "error"}, err
+			}
+			contents = string(read)
+		}
 
-	fmt.Printf("File %s deleted\n", path)
-	return "deleted", nil
+		fmt.Printf("%d bytes read from file %s\n", len(contents), path)
+		return result{contents: contents, status: "read"}, nil
+	})
+	return read.contents, read.status, err
 }
 
-// Send an HTTP/HTTPS message to the given recipient
+// Send an HTTP/HTTPS message (or a raw message over a Unix domain socket) to the given recipient
 func sendMessage(method string, destAddr string, destPort int, protocol string, headers any, body string) (*MessageResponse, error) {
 	// Add the port number into the destination address string
 	destAddrWithPort, err := injectPortIntoAddress(destAddr, destPort, protocol)
@@ -433,12 +2204,26 @@ func sendMessage(method string, destAddr string, destPort int, protocol string,
 	switch protocol {
 	case "http", "https":
 		return sendHttpMessage(method, path, headers, body)
+	case "unix":
+		return sendUnixMessage(destAddr, path, body)
 	default:
 		// Return an error
 		return makeErrorResponse("unknown_protocol", path), fmt.Errorf("unknown protocol: %s", protocol)
 	}
 }
 
+// Sends a message, unless the attempt is picked to deliberately fail (with probability failRate)
+func sendMessageWithFailureRate(method string, destAddr string, destPort int, protocol string, headers any, body string, failRate float64) (*MessageResponse, error) {
+	if failRate > 0 && rand.Float64() < failRate {
+		path := fmt.Sprintf("%s://%s:%d", protocol, destAddr, destPort)
+		if destAddrWithPort, err := injectPortIntoAddress(destAddr, destPort, protocol); err == nil {
+			path = protocol + "://" + destAddrWithPort
+		}
+		return makeErrorResponse("injected_failure", path), fmt.Errorf("injected failure (fail-rate %v)", failRate)
+	}
+	return sendMessage(method, destAddr, destPort, protocol, headers, body)
+}
+
 // ==================================================================================
 // Helper methods
 // ==================================================================================
@@ -467,6 +2252,18 @@ func makeSuccessResponse(status string, sourceAddr string, sourcePort int, bytes
 	return response
 }
 
+// Gets a send's details: how it authenticated with -auth, how long its payload took under -rate-limit, and the names of its cookies
+// with -cookie-jar (or nothing)
+func getSendDetails(response *MessageResponse) string {
+	details := []string{}
+	for _, detail := range []string{response.auth, getRateLimitDetails(response), getCookieDetails(response), getConnectionDetails(response)} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	return strings.Join(details, ", ")
+}
+
 // TODO: Replace this with something that uses the field annotations!
 func serializeToCSV(logInfo *ActivityLogEntry) []string {
 	return []string{
@@ -486,6 +2283,22 @@ func serializeToCSV(logInfo *ActivityLogEntry) []string {
 		strconv.Itoa(logInfo.destPort),
 		strconv.Itoa(logInfo.bytesSent),
 		logInfo.protocol,
+		strconv.Itoa(logInfo.attempt),
+		strconv.Itoa(logInfo.bytesReceived),
+		logInfo.details,
+		logInfo.correlationId,
+		logInfo.runId,
+		strconv.Itoa(logInfo.seq),
+		logInfo.hostname,
+		logInfo.hostIPs,
+		logInfo.machineId,
+		logInfo.note,
+		logInfo.labels,
+		logInfo.signature,
+		logInfo.elevated,
+		strconv.Itoa(logInfo.dnsTime),
+		logInfo.tlsVersion,
+		logInfo.tlsCipher,
 		// strconv.Itoa(logInfo.responseStatusCd),
 		// logInfo.responseBody,
 	}
@@ -531,31 +2344,169 @@ func deserializeFromCSV(row []string) (*ActivityLogEntry, error) {
 	logInfo.destPort = destPortVal
 	logInfo.bytesSent = bytesSentVal
 	logInfo.protocol = row[15]
+	if len(row) > 16 {
+		// Older logs don't have an attempt column
+		attemptVal, err := strconv.Atoi(row[16])
+		if err == nil {
+			logInfo.attempt = attemptVal
+		}
+	}
+	if len(row) > 17 {
+		bytesReceivedVal, err := strconv.Atoi(row[17])
+		if err == nil {
+			logInfo.bytesReceived = bytesReceivedVal
+		}
+	}
+	if len(row) > 18 {
+		logInfo.details = row[18]
+	}
+	if len(row) > 19 {
+		logInfo.correlationId = row[19]
+	}
+	if len(row) > 20 {
+		logInfo.runId = row[20]
+	}
+	if len(row) > 21 {
+		seqVal, err := strconv.Atoi(row[21])
+		if err == nil {
+			logInfo.seq = seqVal
+		}
+	}
+	if len(row) > 22 {
+		logInfo.hostname = row[22]
+	}
+	if len(row) > 23 {
+		logInfo.hostIPs = row[23]
+	}
+	if len(row) > 24 {
+		logInfo.machineId = row[24]
+	}
+	if len(row) > 25 {
+		logInfo.note = row[25]
+	}
+	if len(row) > 26 {
+		logInfo.labels = row[26]
+	}
+	if len(row) > 27 {
+		logInfo.signature = row[27]
+	}
+	if len(row) > 28 {
+		logInfo.elevated = row[28]
+	}
+	if len(row) > 29 {
+		dnsTimeVal, err := strconv.Atoi(row[29])
+		if err == nil {
+			logInfo.dnsTime = dnsTimeVal
+		}
+	}
+	if len(row) > 30 {
+		logInfo.tlsVersion = row[30]
+	}
+	if len(row) > 31 {
+		logInfo.tlsCipher = row[31]
+	}
 
 	return logInfo, nil
 }
 
+// Splits a log row into its fields, on every comma that wasn't escaped by escapeRawText (the fields are kept escaped, as they're stored)
 func splitCSVRow(rowText string) ([]string, error) {
-	reader := csv.NewReader(strings.NewReader(rowText))
-	fields, err := reader.Read()
-	if err != nil && err != io.EOF {
-		return nil, err
+	if strings.ContainsAny(rowText, "\r\n") {
+		return nil, fmt.Errorf("log row contains an unescaped line break: '%s'", rowText)
+	}
+	fields := []string{}
+	start := 0
+	for i := 0; i < len(rowText); i++ {
+		if rowText[i] == '\\' {
+			// Skip whatever's escaped (ie. a comma, or a backslash, so one at the end of a field doesn't escape the separator)
+			i++
+		} else if rowText[i] == ',' {
+			fields = append(fields, rowText[start:i])
+			start = i + 1
+		}
 	}
-	return fields, nil
+	return append(fields, rowText[start:]), nil
 }
 
 func fileExists(path string) bool {
 	info, err := os.Stat(path)
-	if os.IsNotExist(err) {
+	if err != nil {
+		// (including when it can't be looked at, ie. as an -as-user account that can't search its directory)
 		return false
 	}
 	return !info.IsDir()
 }
 
-func writeLogEntry(activityLogFile *os.File, activityLogEntry *ActivityLogEntry) {
-	logEntryCSV := strings.Join(serializeToCSV(activityLogEntry), ",")
-	_, err := activityLogFile.WriteString(logEntryCSV + "\n")
+// Whether there's an empty directory at the path
+func isEmptyDir(path string) bool {
+	entries, err := os.ReadDir(path)
+	return err == nil && len(entries) == 0
+}
+
+// Creates a log entry for a sub-activity (ie. each connection received by listen), sharing the process details of its parent
+func newChildLogEntry(parent *ActivityLogEntry, activity string) *ActivityLogEntry {
+	entry := new(ActivityLogEntry)
+	entry.timestamp = time.Now().Format(time.RFC3339)
+	entry.activity = activity
+	entry.os = parent.os
+	entry.username = parent.username
+	entry.processName = parent.processName
+	entry.processCmd = parent.processCmd
+	entry.processId = parent.processId
+	entry.correlationId = parent.correlationId
+	entry.runId = parent.runId
+	entry.hostname = parent.hostname
+	entry.hostIPs = parent.hostIPs
+	entry.machineId = parent.machineId
+	entry.elevated = parent.elevated
+	entry.note = parent.note
+	entry.labels = parent.labels
+	return entry
+}
+
+// Guards the activity log (and the sequence number), since some commands record entries from several goroutines
+var logFileMutex sync.Mutex
+
+// The sequence number of the last entry written in each run (by run ID)
+var logSequences = map[string]int{}
+
+// Writes a new entry for this run to the activity log, stamping it with the next sequence number. The number is taken under the same
+// lock as the write, so the rows in each sink are always in sequence order, with no gaps or duplicates (even when written from several goroutines).
+func writeLogEntry(activityLog Sink, activityLogEntry *ActivityLogEntry) {
+	logFileMutex.Lock()
+	defer logFileMutex.Unlock()
+	logSequences[activityLogEntry.runId] += 1
+	activityLogEntry.seq = logSequences[activityLogEntry.runId]
+	if logSigner != nil && logSigner.canSign() {
+		activityLogEntry.signature = logSigner.sign(activityLogEntry, lastLogSignatures[activityLogEntry.runId])
+		lastLogSignatures[activityLogEntry.runId] = activityLogEntry.signature
+	}
+	err := activityLog.WriteEntry(activityLogEntry)
 	check(err)
+	if runSummary != nil {
+		runSummary.count(activityLogEntry)
+	}
+}
+
+// Parses labels like "phase=2,technique=T1021" into the form they're logged in ("phase=2;technique=T1021")
+func parseLabels(labelList string) (string, error) {
+	labels := []string{}
+	for _, token := range strings.Split(labelList, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		key, value, found := strings.Cut(token, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return "", fmt.Errorf("invalid label '%s' (must be key=value)", token)
+		}
+		if strings.ContainsAny(key + value, ";\n") {
+			return "", fmt.Errorf("invalid label '%s' (can't contain semicolons or newlines)", token)
+		}
+		labels = append(labels, key + "=" + strings.TrimSpace(value))
+	}
+	return strings.Join(labels, ";"), nil
 }
 
 func escapeCommandString(cmd string, args []string) string {
@@ -563,68 +2514,109 @@ func escapeCommandString(cmd string, args []string) string {
 	return escapeRawText(consolidated)
 }
 
-// Escapes commas and newlines
+// Escapes commas and newlines (and backslashes, so ones already in the text, ie. in Windows paths, aren't mistaken for escapes)
 func escapeRawText(text string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(text, ",", "\\,"), "\n", "\\n")
+	return strings.NewReplacer("\\", "\\\\", ",", "\\,", "\n", "\\n").Replace(text)
+}
+
+// Undoes escapeRawText (in one pass, so an escaped backslash followed by an n isn't read as a newline)
+func unescapeRawText(text string) string {
+	return strings.NewReplacer("\\\\", "\\", "\\,", ",", "\\n", "\n").Replace(text)
 }
 
 
 // Helper for sending an HTTP/HTTPS request
 func sendHttpMessage(method string, path string, headers any, body string) (*MessageResponse, error) {
-	// Shove everything into an HTTP request
-	reqBodyBuffer := bytes.NewBufferString(body)
-	req, err := http.NewRequest(method, path, reqBodyBuffer)
-	if err != nil {
-		return makeErrorResponse("invalid_request", path), err
-	}
-	// TODO: Determine how we want the user to specify headers as CLI args!
-	addHeadersAsNeeded(req, headers)
-
 	// Set up the tracer, so we get the current machine's external connection info
 	var sourceAddr string
 	var sourcePort int = 0
+	var reusedConnection bool
+	// (and what actually happened on the wire: the address the name resolved to, how long that took, and the TLS negotiated)
+	var destAddr string
+	var dnsStarted time.Time
+	var dnsDuration time.Duration
+	var tlsState *tls.ConnectionState
+	var wire wireCounter
 	trace := &httptrace.ClientTrace {
 		GetConn: func(hostPort string) {},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			dnsStarted = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			dnsDuration = time.Since(dnsStarted)
+		},
 		GotConn: func(connInfo httptrace.GotConnInfo) {
-			// Get the local address and port, as "100.100.100.100:1234" or "[a100:a200:a300:a400:a500:a600]:1234"
-			localConnStr := connInfo.Conn.LocalAddr().String()
-			fmt.Printf("Local address string is %s\n", localConnStr)
-			if strings.Contains(localConnStr, "]:") {
-				fmt.Println("Detected ipv6 local address")
-				connStrPieces := strings.Split(localConnStr, "]:")
-				sourceAddr = connStrPieces[0] + "]"
-				sourcePort, err = strconv.Atoi(connStrPieces[1])
-				check(err)
-			} else {
-				fmt.Println("Assuming ipv4 local address")
-				connStrPieces := strings.Split(localConnStr, ":")
-				sourceAddr = connStrPieces[0]
-				sourcePort, err = strconv.Atoi(connStrPieces[1])
-				check(err)
+			// Get the local address and port, from "100.100.100.100:1234" or "[a100:a200:a300:a400:a500:a600]:1234" (IPv6 kept in brackets)
+			sourceAddr, sourcePort = splitAddrAndPort(connInfo.Conn.LocalAddr().String())
+			destAddr, _ = splitAddrAndPort(connInfo.Conn.RemoteAddr().String())
+			reusedConnection = connInfo.Reused
+			wire.track(connInfo.Conn, connInfo.Reused)
+			slog.Debug("Connected", "sourceAddr", sourceAddr, "sourcePort", sourcePort, "destAddr", destAddr)
+		},
+		ConnectStart: func(network string, addr string) {},
+		ConnectDone: func(network string, addr string, err error) {
+			// (the address the connection's attempted to, in case it fails before there's a connection to ask)
+			if err == nil {
+				destAddr, _ = splitAddrAndPort(addr)
 			}
-
-			if err != nil {
-				// TODO: What do we do if the port isn't present?
-				fmt.Printf("Local host is addr %s port unknown\n", sourceAddr)
-			} else {
-				fmt.Printf("Local host is addr %s port %d\n", sourceAddr, sourcePort)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil {
+				tlsState = &state
 			}
-
-			// TODO: Do the same for the remote address and port?
 		},
-		ConnectStart: func(network string, addr string) {},
-		ConnectDone: func(network string, addr string, err error) {},
+	}
+	recordConnection := func(response *MessageResponse) *MessageResponse {
+		// (what was written and read on the wire, not the body's length: so a GET's request line and headers count, as does a
+		// challenge's round trip, and any TLS)
+		response.bytesSent, response.bytesReceived = wire.counts()
+		response.destAddr = destAddr
+		response.dnsDuration = dnsDuration
+		if tlsState != nil {
+			response.tlsVersion = tls.VersionName(tlsState.Version)
+			response.tlsCipher = tls.CipherSuiteName(tlsState.CipherSuite)
+		}
+		return response
 	}
 
-	// Wrap the request with the tracer
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	// Shove everything into an HTTP request (written no faster than -rate-limit, if set), wrapped with the tracer
+	var limitedBody *rateLimitedReader
+	newRequest := func(body string) (*http.Request, error) {
+		var reqBody io.Reader = bytes.NewBufferString(body)
+		if rateLimit > 0 && len(body) > 0 {
+			limitedBody = newRateLimitedReader(reqBody, rateLimit)
+			reqBody = limitedBody
+		}
+		req, err := http.NewRequestWithContext(runContext, method, path, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = int64(len(body))
+		// TODO: Determine how we want the user to specify headers as CLI args!
+		addHeadersAsNeeded(req, headers)
+		return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), nil
+	}
 
-	// Emit the HTTP request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return makeErrorResponse("error", path), err
+	// Emit the HTTP request (authenticating it, with -auth)
+	var req *http.Request
+	var resp *http.Response
+	var authDetails string
+	var err error
+	if sendAuth != nil {
+		req, resp, authDetails, err = doAuthenticatedRequest(getSessionHTTPClient(), sendAuth, newRequest, body)
+	} else if req, err = newRequest(body); err == nil {
+		resp, err = getSessionHTTPClient().Do(req)
+	}
+	if err != nil && req == nil {
+		return makeErrorResponse("invalid_request", path), err
+	} else if err != nil {
+		return recordConnection(makeErrorResponse("error", path)), err
 	}
 	defer resp.Body.Close()
+	if resp.TLS != nil {
+		// (a reused connection's handshake was done for an earlier request)
+		tlsState = resp.TLS
+	}
 
 	// Read the response body
 	var responseBodyStr string
@@ -635,16 +2627,83 @@ func sendHttpMessage(method string, path string, headers any, body string) (*Mes
 		responseBodyStr = string(responseBody)
 	}
 
-	// Print the response body and HTTP error code to the console, but do not add to activity log!
-	fmt.Printf("Received HTTP(s) response code %d, and response body:\n=== START ===\n%s\n=== END ===\n\n", resp.StatusCode, responseBodyStr)
+	// Log the response body and HTTP status code as a diagnostic, but do not add to activity log!
+	slog.Debug("Received HTTP(s) response", "statusCode", resp.StatusCode, "body", responseBodyStr)
 
 	// Return a success
-	return makeSuccessResponse("sent", sourceAddr, sourcePort, int(req.ContentLength), path), nil
+	response := makeSuccessResponse("sent", sourceAddr, sourcePort, 0, path)
+	response.statusCode = resp.StatusCode
+	response.headers = resp.Header
+	response.body = responseBodyStr
+	response.reusedConnection = reusedConnection
+	recordConnection(response)
+	if cookieJar != nil {
+		// (the client adds the jar's cookies to the request itself)
+		response.cookiesSent = getCookieNames(req.Cookies())
+		response.cookiesSet = getCookieNames(resp.Cookies())
+	}
+	if limitedBody != nil {
+		response.duration = limitedBody.getElapsed()
+	}
+	if authDetails != "" {
+		response.auth = authDetails + " (" + resp.Status + ")"
+	}
+	return response, nil
+}
+
+// How long to wait for a response after writing to a Unix domain socket
+const UnixSocketReadTimeout = 5 * time.Second
+
+// Helper for writing a raw message to a Unix domain socket (ie. /var/run/docker.sock), and reading back any response
+func sendUnixMessage(socketPath string, path string, body string) (*MessageResponse, error) {
+	conn, err := new(net.Dialer).DialContext(runContext, "unix", socketPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return makeErrorResponse("not_found", path), err
+		} else if errors.Is(err, os.ErrPermission) {
+			return makeErrorResponse("no_access", path), err
+		}
+		return makeErrorResponse("error", path), err
+	}
+	defer conn.Close()
+
+	var bytesSent int
+	var duration time.Duration
+	if rateLimit > 0 {
+		limitedBody := newRateLimitedReader(strings.NewReader(body), rateLimit)
+		var written int64
+		written, err = io.Copy(conn, limitedBody)
+		bytesSent, duration = int(written), limitedBody.getElapsed()
+	} else {
+		bytesSent, err = conn.Write([]byte(body))
+	}
+	if err != nil {
+		return makeErrorResponse("error", path), err
+	}
+
+	// Let the other end know we're done, then read until it closes its end (or goes quiet)
+	conn.(*net.UnixConn).CloseWrite()
+	conn.SetReadDeadline(time.Now().Add(UnixSocketReadTimeout))
+	responseBody, _ := io.ReadAll(conn)
+
+	// Log the response as a diagnostic, but do not add to activity log!
+	slog.Debug("Received response over Unix domain socket", "socket", socketPath, "bytes", len(responseBody), "body", string(responseBody))
+
+	// Return a success (there's no source address or port for a Unix domain socket)
+	response := makeSuccessResponse("sent", "", 0, bytesSent, path)
+	response.bytesReceived = len(responseBody)
+	response.duration = duration
+	response.body = string(responseBody)
+	return response, nil
 }
 
-// TODO: Incorporate headers before sending a request?
+// Adds the headers (given as a map of names to values, ie. by traffic's profiles) to the request
 func addHeadersAsNeeded(req *http.Request, headers any) {
-	// panic("unimplemented")
+	if headerMap, ok := headers.(map[string]string); ok {
+		for name, value := range headerMap {
+			req.Header.Set(name, value)
+		}
+	}
 }
 
 // Injects the port number into the address
@@ -652,17 +2711,26 @@ func addHeadersAsNeeded(req *http.Request, headers any) {
 func injectPortIntoAddress(addr string, port int, protocol string) (string, error) {
 	switch protocol {
 	case "http", "https":
-		u, err := url.Parse(protocol + "://" + addr)
-		if err != nil {
+		// The host can be followed by a path (ie. example.com/index.html), and an IPv6 literal can be given with or without its
+		// brackets (or with a port of its own, which the given port replaces)
+		host, rest := addr, ""
+		if i := strings.IndexAny(addr, "/?#"); i >= 0 {
+			host, rest = addr[:i], addr[i:]
+		}
+		if hostOnly, _, err := net.SplitHostPort(host); err == nil {
+			host = hostOnly
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if host == "" {
 			return "", fmt.Errorf("unable to parse address %s", addr)
 		}
 
-		hostWithPort := u.Hostname() + ":" + strconv.Itoa(port)
-		fmt.Printf("Replacing '%s' with '%s' in '%s'...\n", u.Hostname(), hostWithPort, addr)
-		newAddress := strings.Replace(addr, u.Hostname(), hostWithPort, 1)
-
-		fmt.Printf("New URL: %s\n", newAddress)
+		newAddress := net.JoinHostPort(host, strconv.Itoa(port)) + rest
+		slog.Debug("Resolved address", "address", newAddress)
 		return newAddress, nil
+	case "unix":
+		// The address is the socket path, and there's no port
+		return addr, nil
 	default:
 		return "", fmt.Errorf("unknown protocol: %s", protocol)
 	}
@@ -681,7 +2749,7 @@ func isCSVHeaderStr(line string) bool {
 
 // https://gist.github.com/lee8oi/ec404fa99ea0f6efd9d1
 // https://stackoverflow.com/questions/78973708/how-can-i-scan-and-print-the-stdout-of-a-process-using-os-startprocess
-func startProcess(cmd string, args []string) (*os.Process, context.CancelFunc, *os.ProcessState, error) {
+func startProcess(cmd string, args []string, env []string, runAs *RunAsUser) (*os.Process, context.CancelFunc, *os.ProcessState, error) {
 	realCmd, err := exec.LookPath(cmd)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("unable to resolve path for %s: %v", cmd, err)
@@ -695,17 +2763,27 @@ func startProcess(cmd string, args []string) (*os.Process, context.CancelFunc, *
 
 	var procAttr os.ProcAttr
 	procAttr.Files = []*os.File{os.Stdin, w, os.Stderr}
+	if len(env) > 0 {
+		// (on top of this process's own)
+		procAttr.Env = append(os.Environ(), env...)
+	}
+	if runAs != nil {
+		realCmd, args, err = runAs.prepareProcess(realCmd, args, &procAttr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
 
 	lines := []string{}
 	grCtx, grCancel := context.WithCancel(context.Background())
 	go func(intCtx context.Context) {
-		fmt.Printf("Reading from pipe...\n")
+		slog.Debug("Reading from pipe")
 		rs := bufio.NewScanner(r)
 		i := 0
 		for rs.Scan() {
 			select {
 			case <- intCtx.Done():
-				fmt.Printf("command exited, %d lines emitted\n", i)
+				slog.Debug("Command exited", "lines", i)
 				return
 			default:
 				i += 1
@@ -714,15 +2792,26 @@ func startProcess(cmd string, args []string) (*os.Process, context.CancelFunc, *
 				lines = append(lines, text)
 			}
 		}
-		fmt.Printf("Done reading from pipe\n")
+		slog.Debug("Done reading from pipe")
 	}(grCtx)
 
-	fmt.Printf("Starting command %s with args %v\n", realCmd, args)
+	slog.Debug("Starting command", "command", realCmd, "args", args)
 	p, err := os.StartProcess(realCmd, args, &procAttr)
 	if err != nil {
 		return nil, grCancel, nil, err
 	}
 
+	// Kill it if the run's cancelled while it's running
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-runContext.Done():
+			p.Kill()
+		case <-exited:
+		}
+	}()
+
 	// Wait for process completion
 	processState, err := p.Wait()
 	if err != nil {
@@ -730,7 +2819,7 @@ func startProcess(cmd string, args []string) (*os.Process, context.CancelFunc, *
 	}
 
 	// TODO: Check the lines here? Thread-safe?
-	fmt.Printf("Parsed lines: %#v\n", lines)
+	slog.Debug("Parsed lines", "lines", lines)
 
 	return p, grCancel, processState, nil
 }
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -58,6 +65,21 @@ func TestMain_Create_FileExists(t *testing.T) {
 	assert.Equal(t, activityLogEntry.status, "exists")
 }
 
+func TestMain_Create_IfNotExists(t *testing.T) {
+	path := t.TempDir() + "/idempotent.txt"
+
+	// The first run creates it, and a run after that leaves it alone
+	callMain([]string{"./noisemaker", "-sink=stdout", "create", "-if-not-exists", path, "first"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "create", "-if-not-exists", path, "second"})
+	assert.Contains(t, output, "Skipping creating " + path + ", since it already exists")
+	assert.Equal(t, "skipped", activityLogEntry.status)
+	assert.Equal(t, "already exists (-if-not-exists)", activityLogEntry.details)
+	contents, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(contents))
+}
+
 func TestMain_Create_FileWithoutAccess(t *testing.T) {
 	// Precondition: "${getRootDir()}root" doesn't exist, AND we don't have access to create it!
 	filePathWithoutAccess := fmt.Sprintf("%s%s", getRootDir(), "root")
@@ -147,6 +169,246 @@ func TestMain_Update_NonExistentFile(t *testing.T) {
 	// TODO: Finish!
 }
 
+func TestMain_Update_CreateIfMissing(t *testing.T) {
+	path := t.TempDir() + "/idempotent.txt"
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "update", "-create-if-missing", path, "first"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.Equal(t, "created\\, since it didn't exist (-create-if-missing)", activityLogEntry.details)
+	callMain([]string{"./noisemaker", "-sink=stdout", "update", "-create-if-missing", path, "second"})
+	assert.Equal(t, "updated", activityLogEntry.status)
+	contents, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(contents))
+
+	// Without it, a missing file's still not_found
+	callMain([]string{"./noisemaker", "-sink=stdout", "update", path + ".missing", "third"})
+	assert.Equal(t, "not_found", activityLogEntry.status)
+}
+
+func TestMain_Delete_IgnoreMissing(t *testing.T) {
+	path := t.TempDir() + "/idempotent.txt"
+	assert.Nil(t, os.WriteFile(path, []byte("delete me"), 0644))
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "delete", "-ignore-missing", path})
+	assert.Equal(t, "deleted", activityLogEntry.status)
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "delete", "-ignore-missing", path})
+	assert.Contains(t, output, "Skipping deleting " + path + ", since it doesn't exist")
+	assert.Equal(t, "skipped", activityLogEntry.status)
+	assert.Equal(t, "not found (-ignore-missing)", activityLogEntry.details)
+	callMain([]string{"./noisemaker", "-sink=stdout", "delete", path})
+	assert.Equal(t, "not_found", activityLogEntry.status)
+}
+
+func TestMain_Send_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "pong")
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	// The response body is only logged with -vv
+	args := []string{"./noisemaker", "send", "GET", host, port}
+	output, diagnostics := callMainWithDiagnostics(args)
+	assert.NotContains(t, output + diagnostics, "pong")
+	args = []string{"./noisemaker", "-vv", "send", "GET", host, port}
+	output, diagnostics = callMainWithDiagnostics(args)
+	assert.NotContains(t, output, "pong")
+	assert.Contains(t, diagnostics, `msg="Received HTTP(s) response" statusCode=200 body=pong`)
+	assert.Equal(t, activityLogEntry.activity, "send")
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.attempt, 1)
+	assert.Equal(t, activityLogEntry.path, fmt.Sprintf("http://%s:%s", host, port))
+}
+
+func TestMain_Send_RetriesWithInjectedFailures(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-v", "-retries=2", "-retry-backoff=1ms", "-fail-rate=1", "send", "GET", "127.0.0.1", "1"}
+	_, diagnostics := callMainWithDiagnostics(args)
+	assert.Contains(t, diagnostics, `msg=Sending attempt=3 of=3`)
+	assert.Equal(t, activityLogEntry.activity, "send")
+	assert.Equal(t, activityLogEntry.status, "injected_failure")
+	assert.Equal(t, activityLogEntry.attempt, 3)
+
+	// Every attempt should be logged separately
+	contents, err := os.ReadFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, strings.Count(string(contents), ",injected_failure,"))
+}
+
+func TestMain_Send_UnixSocket(t *testing.T) {
+	// Precondition: something is listening on the socket, and answers each message
+	dir, err := os.MkdirTemp("", "nm")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	socketPath := dir + "/test.sock"
+	listener, err := net.Listen("unix", socketPath)
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.ReadAll(conn)
+		conn.Write([]byte("HTTP/1.0 200 OK\r\n\r\n[]"))
+	}()
+
+	request := "GET /containers/json HTTP/1.0\r\n\r\n"
+	args := []string{"./noisemaker", "-vv", "send", "POST", socketPath, "0", "unix", request}
+	_, diagnostics := callMainWithDiagnostics(args)
+	assert.Contains(t, diagnostics, "HTTP/1.0 200 OK")
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.path, "unix://"+socketPath)
+	assert.Equal(t, activityLogEntry.protocol, "unix")
+	assert.Equal(t, activityLogEntry.bytesSent, len(request))
+	assert.Equal(t, activityLogEntry.bytesReceived, 21)
+}
+
+func TestMain_Send_UnixSocketNotFound(t *testing.T) {
+	socketPath := t.TempDir() + "/nonexistent.sock"
+
+	args := []string{"./noisemaker", "send", "POST", socketPath, "0", "unix", "Hello World!"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "not_found")
+	assert.Equal(t, activityLogEntry.path, "unix://"+socketPath)
+}
+
+func TestMain_Send_InvalidFailRate(t *testing.T) {
+	args := []string{"./noisemaker", "-fail-rate=1.5", "send", "GET", "127.0.0.1"}
+	assertMainPanicsWithMessage(t, args, "invalid fail-rate for send: 1.5")
+}
+
+func TestMain_RunId_Generated(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	file := t.TempDir() + "/test.txt"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "create", file}
+	callMain(args)
+	firstRunId := activityLogEntry.runId
+	assert.Len(t, firstRunId, 36)
+
+	// Each invocation should get its own
+	args = []string{"./noisemaker", "-logfile=" + logFilePath, "delete", file}
+	callMain(args)
+	assert.Len(t, activityLogEntry.runId, 36)
+	assert.NotEqual(t, firstRunId, activityLogEntry.runId)
+	assertLogFileContains(t, logFilePath, "," + firstRunId + ",")
+}
+
+func TestMain_RunId_Override(t *testing.T) {
+	dir := createTestStagingDir(t)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Every entry from a composite activity should share the run ID
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=scenario-42", "exfil", dir, "POST", "127.0.0.1", "1"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.runId, "scenario-42")
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, strings.Count(contents, ",scenario-42,"))
+}
+
+func TestMain_Seq_InWriteOrder(t *testing.T) {
+	dir := createTestStagingDir(t)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Two runs, appending to the same log; each run numbers its own entries from 1
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=first", "exfil", dir, "POST", "127.0.0.1", "1"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.seq, 4)
+	args = []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=second", "create", t.TempDir() + "/test.txt"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.seq, 1)
+
+	assert.Equal(t, []string{"first,1", "first,2", "first,3", "first,4", "second,1"}, readTestRunIdsAndSeqs(t, logFilePath))
+}
+
+func TestWriteLogEntry_Concurrent(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	activityLog, err := newCSVFileSink(logFilePath, false)
+	assert.Nil(t, err)
+
+	// Every row should still come out numbered in order, with no gaps or duplicates
+	logSequences = map[string]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			writeLogEntry(activityLog, &ActivityLogEntry{activity: "receive", runId: "concurrent"})
+		}()
+	}
+	wg.Wait()
+	activityLog.Close()
+
+	expected := []string{}
+	for i := 1; i <= 50; i++ {
+		expected = append(expected, fmt.Sprintf("concurrent,%d", i))
+	}
+	assert.Equal(t, expected, readTestRunIdsAndSeqs(t, logFilePath))
+}
+
+func TestMain_NoteAndLabels(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-note=phase 2, lateral movement", "-labels=phase=2, technique=T1021", "create", t.TempDir() + "/test.txt"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.note, "phase 2\\, lateral movement")
+	assert.Equal(t, activityLogEntry.labels, "phase=2;technique=T1021")
+	assertLogFileContains(t, logFilePath, ",phase 2\\, lateral movement,phase=2;technique=T1021,,")
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels("")
+	assert.Nil(t, err)
+	assert.Equal(t, "", labels)
+	labels, err = parseLabels("team=red,empty=,url=http://x?a=b")
+	assert.Nil(t, err)
+	assert.Equal(t, "team=red;empty=;url=http://x?a=b", labels)
+
+	_, err = parseLabels("team")
+	assert.ErrorContains(t, err, "invalid label 'team'")
+	_, err = parseLabels("=red")
+	assert.ErrorContains(t, err, "invalid label '=red'")
+	_, err = parseLabels("team=red;blue")
+	assert.ErrorContains(t, err, "can't contain semicolons")
+}
+
+func TestSplitCSVRow(t *testing.T) {
+	row, err := splitCSVRow("a,b\\,c,,d")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b\\,c", "", "d"}, row)
+
+	// Fields ending in an (escaped) backslash
+	row, err = splitCSVRow("C:\\\\,b\\\\\\,c,\\\\")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"C:\\\\", "b\\\\\\,c", "\\\\"}, row)
+
+	_, err = splitCSVRow("a,b\nc")
+	assert.NotNil(t, err)
+}
+
+func TestEscapeRawText(t *testing.T) {
+	// Windows paths (and ones ending in a backslash) come back out as they went in
+	for _, text := range []string{"C:\\Users\\nick\\notes", "\\\\.\\pipe\\noisemaker", "C:\\Temp\\", "a\\,b\n\\nc"} {
+		assert.Equal(t, text, unescapeRawText(escapeRawText(text)))
+	}
+	assert.Equal(t, "C:\\\\Users\\\\nick", escapeRawText("C:\\Users\\nick"))
+
+	// Including through a log row, and when exported as JSON
+	entry := &ActivityLogEntry{activity: "create", path: escapeRawText("C:\\Users\\nick\\"), processCmd: escapeCommandString("create", []string{"C:\\Users\\nick\\", "a,b"})}
+	row, err := splitCSVRow(strings.Join(serializeToCSV(entry), ","))
+	assert.Nil(t, err)
+	parsed, err := deserializeFromCSV(row)
+	assert.Nil(t, err)
+	assert.Equal(t, "C:\\Users\\nick\\", unescapeRawText(parsed.path))
+	assert.Equal(t, "create C:\\Users\\nick\\ a,b", unescapeRawText(parsed.processCmd))
+	assert.Contains(t, string(serializeColumnsToJSON(entry, []string{"path"})), `"path":"C:\\Users\\nick\\"`)
+}
+
 // ==============================================================================
 // Helpers:
 // TODO: Extract test helpers to separate file!
@@ -208,10 +470,94 @@ func getRootDir() string {
 // 	}
 // }
 
+// Gets the host and port of a test server, as they'd be passed to the send command
+func getTestServerHostAndPort(t *testing.T, server *httptest.Server) (string, string) {
+	u, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+	return u.Hostname(), u.Port()
+}
+
+// Calls main() on another goroutine, and sends back the console output as a string once it returns
+func callMainInBackground(args []string) chan string {
+	done := make(chan string, 1)
+	go func() {
+		done <- callMain(args)
+	}()
+	return done
+}
+
+// Reads the "runId,seq" of each entry in the log file, in file order
+func readTestRunIdsAndSeqs(t *testing.T, logFilePath string) []string {
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	runIdsAndSeqs := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(contents), "\n")[2:] {
+		row, err := splitCSVRow(line)
+		assert.Nil(t, err)
+		entry, err := deserializeFromCSV(row)
+		assert.Nil(t, err)
+		runIdsAndSeqs = append(runIdsAndSeqs, fmt.Sprintf("%s,%d", entry.runId, entry.seq))
+	}
+	return runIdsAndSeqs
+}
+
+// Gets a port that's free to listen on
+func getFreeTestPort(t *testing.T, network string) int {
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).Port
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// Dials a listener started by main(), retrying until it's up
+func dialTestListener(t *testing.T, network string, port int) net.Conn {
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		conn, err = net.Dial(network, fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			return conn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("unable to connect to test listener on port %d: %v", port, err)
+	return nil
+}
+
+// Reads the file at the given path as a string
+func readTestFile(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	return string(contents), err
+}
+
+// Asserts that the activity log file at the given path contains the given text
+func assertLogFileContains(t *testing.T, logFilePath string, text string) {
+	contents, err := os.ReadFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(contents), text)
+}
+
+// Resets all of our flags to their defaults, so options don't leak between calls to main()
+func resetFlags() {
+	flag.VisitAll(func(f *flag.Flag) {
+		// Leave the go test flags alone!
+		if !strings.HasPrefix(f.Name, "test.") {
+			f.Value.Set(f.DefValue)
+		}
+	})
+}
+
 // Calls main(), and returns the console output as a string.
 func callMain(args []string) string {
 	output, _ := captureOutput(func() error {
 		oldArgs := os.Args
+		resetFlags()
 		os.Args = args
 		main()
 		os.Args = oldArgs
@@ -220,16 +566,37 @@ func callMain(args []string) string {
 	return output
 }
 
+// Calls main(), and returns the console output and the diagnostics it logged to stderr, as strings.
+func callMainWithDiagnostics(args []string) (string, string) {
+	orig := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	diagnostics := make(chan string, 1)
+	go func() {
+		out, _ := io.ReadAll(r)
+		diagnostics <- string(out)
+	}()
+	output := callMain(args)
+	os.Stderr = orig
+	w.Close()
+	return output, <-diagnostics
+}
+
 // https://stackoverflow.com/a/77151975/410342
 func captureOutput(f func() error) (string, error) {
 	orig := os.Stdout
 	r, w, _ := os.Pipe()
 	os.Stdout = w
+	// (read as it's written, so a run with more output than the pipe holds doesn't block)
+	output := make(chan string, 1)
+	go func() {
+		out, _ := io.ReadAll(r)
+		output <- string(out)
+	}()
 	err := f()
 	os.Stdout = orig
 	w.Close()
-	out, _ := io.ReadAll(r)
-	return string(out), err
+	return <-output, err
 }
 
 // https://stackoverflow.com/a/31596110/410342
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The upper bounds of the buckets for the bytes-per-activity histograms
+var MetricsBytesBuckets = []float64{0, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// Counts every entry written, and serves the counts as Prometheus metrics on /metrics for as long as the run lasts
+type MetricsSink struct {
+	mutex				sync.Mutex
+	startTime			time.Time
+	actions				map[[2]string]int		// by activity and status
+	errors				map[string]int			// by activity
+	bytesSent			map[string]int			// by activity
+	bytesReceived		map[string]int			// by activity
+	bytes				map[string]*metricsHistogram	// bytes sent and received per entry, by activity
+	listener			net.Listener
+	server				*http.Server
+}
+
+type metricsHistogram struct {
+	counts				[]int		// per bucket (not cumulative)
+	sum					float64
+	count				int
+}
+
+// Starts serving metrics on addr (ie. ":9464")
+func newMetricsSink(addr string) (*MetricsSink, error) {
+	sink := &MetricsSink{
+		startTime: time.Now(),
+		actions: map[[2]string]int{},
+		errors: map[string]int{},
+		bytesSent: map[string]int{},
+		bytesReceived: map[string]int{},
+		bytes: map[string]*metricsHistogram{},
+	}
+
+	var err error
+	sink.listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		sink.writeMetrics(w)
+	})
+	sink.server = &http.Server{Handler: mux}
+	fmt.Printf("Serving metrics on http://%s/metrics...\n", sink.listener.Addr().String())
+	go sink.server.Serve(sink.listener)
+	return sink, nil
+}
+
+func (sink *MetricsSink) WriteEntry(entry *ActivityLogEntry) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.actions[[2]string{entry.activity, entry.status}] += 1
+	if isFailureStatus(entry.status) {
+		sink.errors[entry.activity] += 1
+	}
+	sink.bytesSent[entry.activity] += entry.bytesSent
+	sink.bytesReceived[entry.activity] += entry.bytesReceived
+
+	histogram := sink.bytes[entry.activity]
+	if histogram == nil {
+		histogram = &metricsHistogram{counts: make([]int, len(MetricsBytesBuckets))}
+		sink.bytes[entry.activity] = histogram
+	}
+	histogram.observe(float64(entry.bytesSent + entry.bytesReceived))
+	return nil
+}
+
+// Stops serving metrics
+func (sink *MetricsSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return sink.server.Shutdown(ctx)
+}
+
+func (histogram *metricsHistogram) observe(value float64) {
+	for i, bound := range MetricsBytesBuckets {
+		if value <= bound {
+			histogram.counts[i] += 1
+			break
+		}
+	}
+	histogram.sum += value
+	histogram.count += 1
+}
+
+// Writes all the metrics in the Prometheus text exposition format
+func (sink *MetricsSink) writeMetrics(w io.Writer) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP noisemaker_start_time_seconds When this run started, in seconds since the epoch.\n")
+	fmt.Fprintf(w, "# TYPE noisemaker_start_time_seconds gauge\n")
+	fmt.Fprintf(w, "noisemaker_start_time_seconds %d\n", sink.startTime.Unix())
+
+	fmt.Fprintf(w, "# HELP noisemaker_actions_total Activities logged, by activity and status.\n")
+	fmt.Fprintf(w, "# TYPE noisemaker_actions_total counter\n")
+	actionKeys := [][2]string{}
+	for key := range sink.actions {
+		actionKeys = append(actionKeys, key)
+	}
+	sort.Slice(actionKeys, func(i, j int) bool {
+		return actionKeys[i][0] + "," + actionKeys[i][1] < actionKeys[j][0] + "," + actionKeys[j][1]
+	})
+	for _, key := range actionKeys {
+		fmt.Fprintf(w, "noisemaker_actions_total{activity=\"%s\",status=\"%s\"} %d\n", escapeMetricLabel(key[0]), escapeMetricLabel(key[1]), sink.actions[key])
+	}
+
+	writeMetricsCounter(w, "noisemaker_errors_total", "Activities logged with an error status, by activity.", sink.errors)
+	writeMetricsCounter(w, "noisemaker_bytes_sent_total", "Bytes sent, by activity.", sink.bytesSent)
+	writeMetricsCounter(w, "noisemaker_bytes_received_total", "Bytes received, by activity.", sink.bytesReceived)
+
+	fmt.Fprintf(w, "# HELP noisemaker_activity_bytes Bytes sent and received per activity logged, by activity.\n")
+	fmt.Fprintf(w, "# TYPE noisemaker_activity_bytes histogram\n")
+	for _, activity := range sortedMetricsKeys(sink.bytes) {
+		histogram := sink.bytes[activity]
+		label := escapeMetricLabel(activity)
+		cumulative := 0
+		for i, bound := range MetricsBytesBuckets {
+			cumulative += histogram.counts[i]
+			fmt.Fprintf(w, "noisemaker_activity_bytes_bucket{activity=\"%s\",le=\"%s\"} %d\n", label, strconv.FormatFloat(bound, 'f', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "noisemaker_activity_bytes_bucket{activity=\"%s\",le=\"+Inf\"} %d\n", label, histogram.count)
+		fmt.Fprintf(w, "noisemaker_activity_bytes_sum{activity=\"%s\"} %s\n", label, strconv.FormatFloat(histogram.sum, 'f', -1, 64))
+		fmt.Fprintf(w, "noisemaker_activity_bytes_count{activity=\"%s\"} %d\n", label, histogram.count)
+	}
+}
+
+// Helper for writing a counter labeled by activity
+func writeMetricsCounter(w io.Writer, name string, help string, values map[string]int) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, activity := range sortedMetricsKeys(values) {
+		fmt.Fprintf(w, "%s{activity=\"%s\"} %d\n", name, escapeMetricLabel(activity), values[activity])
+	}
+}
+
+func sortedMetricsKeys[V any](values map[string]V) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Escapes a label value for the text exposition format
+func escapeMetricLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Metrics_WhileListening(t *testing.T) {
+	port := getFreeTestPort(t, "tcp")
+	metricsPort := getFreeTestPort(t, "tcp")
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-metrics-addr=127.0.0.1:" + strconv.Itoa(metricsPort), "-max-receives=2", "listen", strconv.Itoa(port), "tcp"}
+	done := callMainInBackground(args)
+
+	// The first connection should show up in the metrics while still listening
+	conn := dialTestListener(t, "tcp", port)
+	conn.Write([]byte("Hello World!"))
+	conn.Close()
+	metrics := ""
+	for i := 0; i < 50 && !strings.Contains(metrics, "noisemaker_actions_total{activity=\"receive\""); i++ {
+		time.Sleep(20 * time.Millisecond)
+		metrics = getTestMetrics(t, metricsPort)
+	}
+	assert.Contains(t, metrics, "noisemaker_actions_total{activity=\"receive\",status=\"received\"} 1\n")
+	assert.Contains(t, metrics, "noisemaker_bytes_received_total{activity=\"receive\"} 12\n")
+	assert.Contains(t, metrics, "noisemaker_activity_bytes_bucket{activity=\"receive\",le=\"64\"} 1\n")
+
+	conn = dialTestListener(t, "tcp", port)
+	conn.Close()
+	<-done
+	assert.Equal(t, activityLogEntry.status, "stopped")
+
+	// And the endpoint should go away with the run
+	_, err := net.DialTimeout("tcp", "127.0.0.1:" + strconv.Itoa(metricsPort), time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestMetricsSink_WriteMetrics(t *testing.T) {
+	sink, err := newMetricsSink("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	sink.WriteEntry(&ActivityLogEntry{activity: "send", status: "sent", bytesSent: 100, bytesReceived: 2000})
+	sink.WriteEntry(&ActivityLogEntry{activity: "send", status: "error"})
+	sink.WriteEntry(&ActivityLogEntry{activity: "create", status: "created"})
+
+	var metrics strings.Builder
+	sink.writeMetrics(&metrics)
+	text := metrics.String()
+	assert.Contains(t, text, "# TYPE noisemaker_actions_total counter\n")
+	assert.Contains(t, text, "noisemaker_actions_total{activity=\"create\",status=\"created\"} 1\nnoisemaker_actions_total{activity=\"send\",status=\"error\"} 1\nnoisemaker_actions_total{activity=\"send\",status=\"sent\"} 1\n")
+	assert.Contains(t, text, "noisemaker_errors_total{activity=\"send\"} 1\n")
+	assert.Contains(t, text, "noisemaker_bytes_sent_total{activity=\"send\"} 100\n")
+	assert.Contains(t, text, "noisemaker_activity_bytes_bucket{activity=\"send\",le=\"0\"} 1\n")
+	assert.Contains(t, text, "noisemaker_activity_bytes_bucket{activity=\"send\",le=\"1024\"} 1\n")
+	assert.Contains(t, text, "noisemaker_activity_bytes_bucket{activity=\"send\",le=\"4096\"} 2\n")
+	assert.Contains(t, text, "noisemaker_activity_bytes_bucket{activity=\"send\",le=\"+Inf\"} 2\n")
+	assert.Contains(t, text, "noisemaker_activity_bytes_sum{activity=\"send\"} 2100\n")
+}
+
+func TestEscapeMetricLabel(t *testing.T) {
+	assert.Equal(t, "a\\\\b\\\"c\\nd", escapeMetricLabel("a\\b\"c\nd"))
+}
+
+// Scrapes the metrics endpoint
+func getTestMetrics(t *testing.T, port int) string {
+	response, err := http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/metrics")
+	if err != nil {
+		return ""
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	return string(body)
+}
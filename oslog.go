@@ -0,0 +1,13 @@
+package main
+
+// The unified log subsystem activities are written under on macOS by default
+const DefaultOSLogSubsystem = "noisemaker"
+
+// Gets the unified log category for an entry: its activity, so they can be filtered by it (ie. log show --predicate 'category == "send"')
+func getOSLogCategory(entry *ActivityLogEntry) string {
+	activity := unescapeRawText(entry.activity)
+	if activity == "" {
+		return "unknown"
+	}
+	return activity
+}
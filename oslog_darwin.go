@@ -0,0 +1,65 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#include <os/log.h>
+#include <stdlib.h>
+
+// os_log_with_type is a macro (its format has to be a literal), so it's wrapped to be called from Go
+static void noisemakerLog(os_log_t log, os_log_type_t type, const char *message) {
+	os_log_with_type(log, type, "%{public}s", message);
+}
+*/
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// Writes each entry to the unified log as JSON, under the subsystem, with its activity as the category (errors at the error
+// level, and everything else at the default level, so they're all kept)
+type OSLogSink struct {
+	subsystem			string
+	logs				map[string]C.os_log_t		// by category
+	mutex				sync.Mutex
+}
+
+func newOSLogSink(subsystem string) (Sink, error) {
+	if subsystem == "" {
+		subsystem = DefaultOSLogSubsystem
+	}
+	return &OSLogSink{subsystem: subsystem, logs: map[string]C.os_log_t{}}, nil
+}
+
+// Gets the log for the category, creating it the first time it's used (they're never freed, like os_log_create expects)
+func (sink *OSLogSink) getLog(category string) C.os_log_t {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	log, ok := sink.logs[category]
+	if !ok {
+		subsystem := C.CString(sink.subsystem)
+		defer C.free(unsafe.Pointer(subsystem))
+		categoryStr := C.CString(category)
+		defer C.free(unsafe.Pointer(categoryStr))
+		log = C.os_log_create(subsystem, categoryStr)
+		sink.logs[category] = log
+	}
+	return log
+}
+
+func (sink *OSLogSink) WriteEntry(entry *ActivityLogEntry) error {
+	logType := C.os_log_type_t(C.OS_LOG_TYPE_DEFAULT)
+	if isFailureStatus(entry.status) {
+		logType = C.os_log_type_t(C.OS_LOG_TYPE_ERROR)
+	}
+	message := C.CString(string(serializeToJSON(entry)))
+	defer C.free(unsafe.Pointer(message))
+	C.noisemakerLog(sink.getLog(getOSLogCategory(entry)), logType, message)
+	return nil
+}
+
+func (sink *OSLogSink) Close() error {
+	return nil
+}
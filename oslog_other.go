@@ -0,0 +1,16 @@
+//go:build !darwin || !cgo
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The unified log is macOS-only (and needs cgo, to call os_log)
+func newOSLogSink(subsystem string) (Sink, error) {
+	if runtime.GOOS == "darwin" {
+		return nil, fmt.Errorf("the oslog sink needs noisemaker to be built with cgo (CGO_ENABLED=1)")
+	}
+	return nil, fmt.Errorf("the oslog sink is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOSLogCategory(t *testing.T) {
+	assert.Equal(t, "migrate-log", getOSLogCategory(&ActivityLogEntry{activity: "migrate-log"}))
+	assert.Equal(t, "unknown", getOSLogCategory(&ActivityLogEntry{}))
+}
+
+func TestMain_Sink_OSLogUnsupported(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("the unified log is supported on darwin")
+	}
+	_, err := openSinks([]string{"oslog"}, "", false)
+	assert.ErrorContains(t, err, "the oslog sink is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The OTLP/HTTP path for logs, if the sink's URL doesn't give one
+const OTLPLogsPath = "/v1/logs"
+
+// OTLP severity number for INFO (and WARN, for activities that didn't go as planned)
+const OTLPSeverityInfo = 9
+const OTLPSeverityWarn = 13
+
+// Forwards entries to an OpenTelemetry collector as OTLP log records (over HTTP, JSON-encoded), one request per entry
+type OTLPSink struct {
+	url					string
+	client				*http.Client
+}
+
+// Sets up a sink for the collector at endpoint (ie. http://collector:4318), adding the logs path if it has none
+func newOTLPSink(endpoint string) (*OTLPSink, error) {
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil || (endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https") || endpointUrl.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s' (must be an http or https URL)", endpoint)
+	}
+	if endpointUrl.Path == "" || endpointUrl.Path == "/" {
+		endpointUrl.Path = OTLPLogsPath
+	}
+	return &OTLPSink{url: endpointUrl.String(), client: &http.Client{Timeout: SinkForwardTimeout}}, nil
+}
+
+func (sink *OTLPSink) WriteEntry(entry *ActivityLogEntry) error {
+	request, err := json.Marshal(buildOTLPLogsRequest(entry))
+	if err != nil {
+		return err
+	}
+	response, err := sink.client.Post(sink.url, "application/json", bytes.NewReader(request))
+	if err != nil {
+		slog.Warn("Unable to forward log entry to OTLP collector", "error", err)
+		return nil
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		slog.Warn("Unable to forward log entry to OTLP collector", "status", response.Status)
+	}
+	return nil
+}
+
+func (sink *OTLPSink) Close() error {
+	sink.client.CloseIdleConnections()
+	return nil
+}
+
+var uuidPattern = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+// Builds an OTLP ExportLogsServiceRequest holding the entry as a single log record. Every column becomes a noisemaker.* attribute,
+// and the host details become resource attributes. If the run ID is a UUID, it's used as the trace ID, so a run's records are grouped.
+func buildOTLPLogsRequest(entry *ActivityLogEntry) map[string]any {
+	record := map[string]any{
+		"observedTimeUnixNano": strconv.FormatInt(time.Now().UnixNano(), 10),
+		"severityNumber": OTLPSeverityInfo,
+		"severityText": "INFO",
+		"body": map[string]any{"stringValue": strings.TrimSpace(entry.activity + " " + entry.status)},
+		"attributes": buildOTLPAttributes(entry),
+	}
+	timestamp, err := time.Parse(time.RFC3339, entry.timestamp)
+	if err == nil {
+		record["timeUnixNano"] = strconv.FormatInt(timestamp.UnixNano(), 10)
+	}
+	// Failures are logged at WARN (everything else at INFO)
+	if isFailureStatus(entry.status) {
+		record["severityNumber"] = OTLPSeverityWarn
+		record["severityText"] = "WARN"
+	}
+	if uuidPattern.MatchString(entry.runId) {
+		record["traceId"] = strings.ToLower(strings.ReplaceAll(entry.runId, "-", ""))
+	}
+
+	resourceAttributes := []map[string]any{
+		otlpStringAttribute("service.name", "noisemaker"),
+		otlpStringAttribute("os.type", entry.os),
+	}
+	if entry.hostname != "" {
+		resourceAttributes = append(resourceAttributes, otlpStringAttribute("host.name", unescapeRawText(entry.hostname)))
+	}
+	if entry.machineId != "" {
+		resourceAttributes = append(resourceAttributes, otlpStringAttribute("host.id", unescapeRawText(entry.machineId)))
+	}
+
+	return map[string]any{
+		"resourceLogs": []map[string]any{{
+			"resource": map[string]any{"attributes": resourceAttributes},
+			"scopeLogs": []map[string]any{{
+				"scope": map[string]any{"name": "noisemaker"},
+				"logRecords": []map[string]any{record},
+			}},
+		}},
+	}
+}
+
+// Converts every non-empty column of the entry into a noisemaker.<column> attribute
+func buildOTLPAttributes(entry *ActivityLogEntry) []map[string]any {
+	attributes := []map[string]any{}
+	values := serializeToCSV(entry)
+	for i, column := range strings.Split(HeaderStr, ",") {
+		value := values[i]
+		if value == "" {
+			continue
+		}
+		key := "noisemaker." + column
+		if containsString(NumericColumns, column) {
+			// OTLP/JSON encodes 64-bit ints as strings
+			attributes = append(attributes, map[string]any{"key": key, "value": map[string]any{"intValue": value}})
+		} else {
+			attributes = append(attributes, otlpStringAttribute(key, unescapeRawText(value)))
+		}
+	}
+	return attributes
+}
+
+func otlpStringAttribute(key string, value string) map[string]any {
+	return map[string]any{"key": key, "value": map[string]any{"stringValue": value}}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Sink_OTLP(t *testing.T) {
+	received := make(chan map[string]any, 10)
+	paths := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request map[string]any
+		json.Unmarshal(body, &request)
+		paths <- r.URL.Path
+		received <- request
+	}))
+	defer server.Close()
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-sink=csv", "-sink=otlp:" + server.URL, "-run-id=3f1c6a2e-8d4b-4e0f-9a17-5b2c9d8e7f01", "create", t.TempDir() + "/test.txt"}
+	callMain(args)
+	assertLogFileContains(t, logFilePath, ",created,")
+	assert.Equal(t, OTLPLogsPath, <-paths)
+
+	request := <-received
+	resourceLogs := request["resourceLogs"].([]any)[0].(map[string]any)
+	record := resourceLogs["scopeLogs"].([]any)[0].(map[string]any)["logRecords"].([]any)[0].(map[string]any)
+	assert.Equal(t, "create created", record["body"].(map[string]any)["stringValue"])
+	assert.Equal(t, "INFO", record["severityText"])
+	assert.Equal(t, "3f1c6a2e8d4b4e0f9a175b2c9d8e7f01", record["traceId"])
+	assert.NotEmpty(t, record["timeUnixNano"])
+}
+
+func TestBuildOTLPLogsRequest(t *testing.T) {
+	entry := &ActivityLogEntry{timestamp: "2024-11-05T16:20:14-06:00", activity: "send", status: "error", hostname: "lab-vm-1", destPort: 443, processCmd: "send GET a\\,b", runId: "not-a-uuid"}
+	encoded, err := json.Marshal(buildOTLPLogsRequest(entry))
+	assert.Nil(t, err)
+	text := string(encoded)
+
+	assert.Contains(t, text, `"timeUnixNano":"1730845214000000000"`)
+	assert.Contains(t, text, `"severityText":"WARN"`)
+	assert.Contains(t, text, `{"key":"host.name","value":{"stringValue":"lab-vm-1"}}`)
+	assert.Contains(t, text, `{"key":"noisemaker.destPort","value":{"intValue":"443"}}`)
+	assert.Contains(t, text, `{"key":"noisemaker.processCmd","value":{"stringValue":"send GET a,b"}}`)
+	assert.False(t, strings.Contains(text, "traceId"))
+	assert.False(t, strings.Contains(text, "noisemaker.path"))
+
+	// Severity follows the shared failure statuses
+	encoded, _ = json.Marshal(buildOTLPLogsRequest(&ActivityLogEntry{status: "unreachable"}))
+	assert.Contains(t, string(encoded), `"severityText":"WARN"`)
+	encoded, _ = json.Marshal(buildOTLPLogsRequest(&ActivityLogEntry{status: "filtered"}))
+	assert.Contains(t, string(encoded), `"severityText":"INFO"`)
+}
+
+func TestNewOTLPSink(t *testing.T) {
+	sink, err := newOTLPSink("https://collector:4318/custom/logs")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://collector:4318/custom/logs", sink.url)
+
+	_, err = newOTLPSink("collector:4318")
+	assert.ErrorContains(t, err, "invalid OTLP endpoint")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The formats the final result can be printed in: text prints nothing more than the commands' own output, and json prints the
+// result as a single JSON object on stdout, moving everything else to stderr
+var OutputFormats = []string{"text", "json"}
+
+// The exit status noisemaker exits with when a command panics (as every Go program does)
+const PanicExitStatus = 2
+
+// Checks the output format, and that nothing else writes to stdout alongside the JSON result
+func checkOutputFormat(format string, sinkSpecs []string) error {
+	if !containsString(OutputFormats, format) {
+		return fmt.Errorf("invalid -output '%s' (must be one of %v)", format, OutputFormats)
+	}
+	if format == "json" && containsString(sinkSpecs, "stdout") {
+		return fmt.Errorf("-sink=stdout can't be used with -output=json (both write to stdout)")
+	}
+	return nil
+}
+
+// The original stdout, while the console output's redirected (the result, and the stdout sink, still go to it)
+var originalStdout *os.File
+
+// Gets the original stdout, whether or not the console output's redirected
+func getOriginalStdout() *os.File {
+	if originalStdout != nil {
+		return originalStdout
+	}
+	return os.Stdout
+}
+
+// Moves the commands' console output out of the way of the result: to stderr with -output=json, or nowhere with -quiet. Returns where
+// the result should be printed (the original stdout), and a function that puts the console output back.
+func redirectConsoleOutput(format string, quiet bool) (*os.File, func()) {
+	stdout := os.Stdout
+	var redirected *os.File
+	switch {
+	case quiet:
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			return stdout, func() {}
+		}
+		redirected = devNull
+	case format == "json":
+		redirected = os.Stderr
+	default:
+		return stdout, func() {}
+	}
+	originalStdout = stdout
+	os.Stdout = redirected
+	return stdout, func() {
+		os.Stdout = stdout
+		originalStdout = nil
+		if quiet {
+			redirected.Close()
+		}
+	}
+}
+
+// Prints the result of a run as a single JSON object: the command's activity log entry, whether its status is a failure, and the exit
+// status (with the reason, if it panicked)
+func writeJSONResult(output io.Writer, entry *ActivityLogEntry, exitStatus int, reason string) error {
+	result := map[string]any{
+		"entry": json.RawMessage(serializeToJSON(entry)),
+		"failed": exitStatus != 0 || isFailureStatus(entry.status),
+		"exitStatus": exitStatus,
+	}
+	if reason != "" {
+		result["error"] = reason
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(append(encoded, '\n'))
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Output_JSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Nothing but the result is printed to stdout
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-output=json", "send", "POST", host, port, "http", "hello"})
+	var result map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(output), &result))
+	assert.Equal(t, float64(0), result["exitStatus"])
+	assert.Equal(t, false, result["failed"])
+	assert.Nil(t, result["error"])
+	entry := result["entry"].(map[string]any)
+	assert.Equal(t, "send", entry["activity"])
+	assert.Equal(t, "sent", entry["status"])
+	// (the request line and headers count, besides the body)
+	assert.Greater(t, entry["bytesSent"], float64(5))
+	assert.Equal(t, activityLogEntry.runId, entry["runId"])
+
+	// A failed command is flagged
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-output=json", "read", t.TempDir() + "/missing.txt"})
+	assert.Nil(t, json.Unmarshal([]byte(output), &result))
+	assert.Equal(t, true, result["failed"])
+	assert.Equal(t, "not_found", result["entry"].(map[string]any)["status"])
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-output=json", "send", "GET", host, port}, "-sink=stdout can't be used with -output=json (both write to stdout)")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-output=xml", "send", "GET", host, port}, "invalid -output 'xml' (must be one of [text json])")
+}
+
+func TestMain_Output_Quiet(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	filePath := t.TempDir() + "/file.txt"
+
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-quiet", "create", filePath, "hello"})
+	assert.Equal(t, activityLogEntry.status, "created")
+	assert.Equal(t, "", output)
+
+	// The stdout sink still writes to stdout
+	output = callMain([]string{"./noisemaker", "-sink=stdout", "-quiet", "update", filePath, "world"})
+	assert.Equal(t, string(serializeToJSON(activityLogEntry)) + "\n", output)
+
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-quiet", "-output=json", "delete", filePath})
+	var result map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(output), &result))
+	assert.Equal(t, "deleted", result["entry"].(map[string]any)["status"])
+}
+
+func TestWriteJSONResult(t *testing.T) {
+	// A panic is reported with its reason
+	var output bytes.Buffer
+	entry := &ActivityLogEntry{activity: "send", details: "a\\, b"}
+	assert.Nil(t, writeJSONResult(&output, entry, PanicExitStatus, "not enough arguments for send! Args: [GET]"))
+	var result map[string]any
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &result))
+	assert.Equal(t, float64(PanicExitStatus), result["exitStatus"])
+	assert.Equal(t, true, result["failed"])
+	assert.Equal(t, "not enough arguments for send! Args: [GET]", result["error"])
+	assert.Equal(t, "a, b", result["entry"].(map[string]any)["details"])
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Where a command's paths are in its arguments (which are all that's expanded, so a file's contents, or a script block, are left alone)
+type PathTemplateArgs struct {
+	indexes				[]int		// which of its positional arguments (not counting its flags) are paths
+	rest				bool		// whether every positional argument after the last of them is a path too
+	flags				[]string	// which of its flags (given as -name=value) are paths
+	flagsAfter			int			// how many positional arguments come before its flags (ie. decoy's mode)
+}
+
+// Commands whose paths can use path templates (ie. "{tmp}/dropped.txt"), so a playbook can run unchanged on every OS
+var PathTemplateCommands = map[string]PathTemplateArgs{
+	"execute": {indexes: []int{0}, flags: []string{"preload-library"}},
+	"create": {indexes: []int{0}},
+	"update": {indexes: []int{0}},
+	"delete": {indexes: []int{0}, rest: true},
+	"read": {indexes: []int{0}},
+	"shred": {indexes: []int{0}},
+	"dropper": {indexes: []int{0}},
+	"download": {indexes: []int{1}},
+	"stage": {indexes: []int{0}, rest: true},
+	"exfil": {indexes: []int{0}},
+	"decoy": {indexes: []int{1}, rest: true, flags: []string{"decoys"}, flagsAfter: 1},
+	"edgenames": {indexes: []int{0}},
+}
+
+// The path templates that are in the current user's home directory (which can't be expanded without one)
+var HomePathTemplates = []string{"home", "desktop", "documents", "downloads", "appdata"}
+
+// A path template, ie. {tmp} (anything else in braces is left alone, since it can be part of a file's name)
+var pathTemplatePattern = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// Gets where each path template is on the given OS, for the given home and temporary directories: the user's own folders, their
+// per-user application data (%APPDATA%, ~/Library/Application Support, or ~/.config), and the machine's (%ProgramData%, /Library/Application
+// Support, or /var/lib)
+func getPathTemplates(goos string, homeDir string, tmpDir string) map[string]string {
+	templates := map[string]string{
+		"tmp": tmpDir,
+		"home": homeDir,
+		"desktop": filepath.Join(homeDir, "Desktop"),
+		"documents": filepath.Join(homeDir, "Documents"),
+		"downloads": filepath.Join(homeDir, "Downloads"),
+	}
+	switch goos {
+	case "windows":
+		templates["appdata"] = getEnvOrDefault("APPDATA", filepath.Join(homeDir, "AppData", "Roaming"))
+		templates["programdata"] = getEnvOrDefault("ProgramData", `C:\ProgramData`)
+	case "darwin":
+		templates["appdata"] = filepath.Join(homeDir, "Library", "Application Support")
+		templates["programdata"] = "/Library/Application Support"
+	default:
+		// linux, freebsd, etc.
+		templates["appdata"] = getEnvOrDefault("XDG_CONFIG_HOME", filepath.Join(homeDir, ".config"))
+		templates["programdata"] = "/var/lib"
+	}
+	return templates
+}
+
+// Gets the environment variable's value, or the default if it isn't set
+func getEnvOrDefault(name string, defaultValue string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// Expands the path templates in each of the arguments that's a path to where they are on this OS, returning whether any were
+func expandPathTemplates(goos string, paths PathTemplateArgs, args []string) ([]string, bool, error) {
+	if !strings.Contains(strings.Join(args, ""), "{") {
+		return args, false, nil
+	}
+	homeDir, homeErr := os.UserHomeDir()
+	templates := getPathTemplates(goos, homeDir, os.TempDir())
+
+	found := false
+	var err error
+	expand := func(arg string) string {
+		return pathTemplatePattern.ReplaceAllStringFunc(arg, func(template string) string {
+			name := template[1:len(template) - 1]
+			value, known := templates[name]
+			if !known {
+				return template
+			}
+			if homeErr != nil && containsString(HomePathTemplates, name) && err == nil {
+				err = fmt.Errorf("invalid path template %s: %v", template, homeErr)
+			}
+			found = true
+			return value
+		})
+	}
+
+	expanded := []string{}
+	positional := 0
+	flagsDone := false
+	for _, arg := range args {
+		switch {
+		case !flagsDone && positional >= paths.flagsAfter && arg == "--":
+			flagsDone = true
+		case !flagsDone && positional >= paths.flagsAfter && strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// (a flag, expanded if it's a path)
+			name, value, hasValue := strings.Cut(arg, "=")
+			if hasValue && containsString(paths.flags, strings.TrimLeft(name, "-")) {
+				arg = name + "=" + expand(value)
+			}
+		default:
+			if positional >= paths.flagsAfter {
+				// (the flags end at the first argument after them, as the flag package has it)
+				flagsDone = true
+			}
+			if paths.isPath(positional) {
+				arg = expand(arg)
+			}
+			positional++
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded, found, err
+}
+
+// Whether a command's positional argument (at the index, not counting its flags) is a path
+func (paths PathTemplateArgs) isPath(index int) bool {
+	if slices.Contains(paths.indexes, index) {
+		return true
+	}
+	return paths.rest && len(paths.indexes) > 0 && index > slices.Max(paths.indexes)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Create_PathTemplate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the temporary directory comes from TMP on Windows")
+	}
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	// The file's made in the OS's temporary directory, and its command line's recorded with it expanded
+	callMain([]string{"./noisemaker", "-sink=stdout", "create", "{tmp}/templated.txt", "hello"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.FileExists(t, dir + "/templated.txt")
+	assert.Equal(t, "create " + dir + "/templated.txt hello", activityLogEntry.processCmd)
+
+	// Only the path's expanded (the contents are written as they're given)
+	callMain([]string{"./noisemaker", "-sink=stdout", "create", "{tmp}/contents.txt", "saved to {tmp} and {home}"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	contents, err := readTestFile(dir + "/contents.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "saved to {tmp} and {home}", contents)
+	// (update writes over the start of the file)
+	callMain([]string{"./noisemaker", "-sink=stdout", "update", "{tmp}/contents.txt", "now in {tmp}"})
+	assert.Equal(t, "updated", activityLogEntry.status)
+	contents, err = readTestFile(dir + "/contents.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "now in {tmp}p} and {home}", contents)
+
+	// (anything else in braces is just part of the name)
+	callMain([]string{"./noisemaker", "-sink=stdout", "create", dir + "/{draft}.txt"})
+	assert.Equal(t, "created", activityLogEntry.status)
+	assert.FileExists(t, dir + "/{draft}.txt")
+}
+
+func TestGetPathTemplates(t *testing.T) {
+	t.Setenv("APPDATA", `C:\Users\alice\AppData\Roaming`)
+	t.Setenv("ProgramData", "")
+	templates := getPathTemplates("windows", `C:\Users\alice`, `C:\Temp`)
+	assert.Equal(t, `C:\Temp`, templates["tmp"])
+	assert.Equal(t, `C:\Users\alice\AppData\Roaming`, templates["appdata"])
+	assert.Equal(t, `C:\ProgramData`, templates["programdata"])
+
+	templates = getPathTemplates("darwin", "/Users/alice", "/tmp")
+	assert.Equal(t, filepath.Join("/Users/alice", "Desktop"), templates["desktop"])
+	assert.Equal(t, filepath.Join("/Users/alice", "Library", "Application Support"), templates["appdata"])
+	assert.Equal(t, "/Library/Application Support", templates["programdata"])
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	templates = getPathTemplates("linux", "/home/alice", "/tmp")
+	assert.Equal(t, filepath.Join("/home/alice", ".config"), templates["appdata"])
+	assert.Equal(t, "/var/lib", templates["programdata"])
+	for _, name := range HomePathTemplates {
+		assert.NotEmpty(t, templates[name])
+	}
+}
+
+func TestExpandPathTemplates(t *testing.T) {
+	args := []string{"{nothing}.txt", "plain"}
+	expanded, found, err := expandPathTemplates(runtime.GOOS, PathTemplateCommands["create"], args)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Equal(t, args, expanded)
+
+	// Only each command's paths are expanded, past its flags (and a mode before them)
+	tmp := os.TempDir()
+	for _, test := range []struct{ command string; args, expected []string }{
+		{"create", []string{"{tmp}/a.txt", "{tmp}"}, []string{tmp + "/a.txt", "{tmp}"}},
+		{"create", []string{"-size=1KB", "-sparse", "{tmp}/a.txt", "{tmp}"}, []string{"-size=1KB", "-sparse", tmp + "/a.txt", "{tmp}"}},
+		{"update", []string{"-create-if-missing", "{tmp}/a.txt", "{tmp}"}, []string{"-create-if-missing", tmp + "/a.txt", "{tmp}"}},
+		{"dropper", []string{"-keep", "{tmp}/a.sh", "echo {tmp}"}, []string{"-keep", tmp + "/a.sh", "echo {tmp}"}},
+		{"download", []string{"http://example.com/{tmp}", "{tmp}/a.exe"}, []string{"http://example.com/{tmp}", tmp + "/a.exe"}},
+		{"delete", []string{"-trash", "{tmp}/a.txt", "{tmp}/b.txt", "{tmp}/c.txt"}, []string{"-trash", tmp + "/a.txt", tmp + "/b.txt", tmp + "/c.txt"}},
+		{"stage", []string{"{tmp}/a.zip", "{tmp}/b.txt"}, []string{tmp + "/a.zip", tmp + "/b.txt"}},
+		{"exfil", []string{"{tmp}/dir", "http", "{tmp}"}, []string{tmp + "/dir", "http", "{tmp}"}},
+		{"execute", []string{"{tmp}/a.exe", "{tmp}"}, []string{tmp + "/a.exe", "{tmp}"}},
+		{"execute", []string{"-preload=LD_PRELOAD", "-preload-library={tmp}/a.so", "{tmp}/a"}, []string{"-preload=LD_PRELOAD", "-preload-library=" + tmp + "/a.so", tmp + "/a"}},
+		{"execute", []string{"-interpreter=sh", "--", "-{tmp}", "{tmp}"}, []string{"-interpreter=sh", "--", "-" + tmp, "{tmp}"}},
+		{"decoy", []string{"plant", "-kinds={tmp}", "-decoys={tmp}/d.jsonl", "{tmp}/x", "{tmp}/y"}, []string{"plant", "-kinds={tmp}", "-decoys=" + tmp + "/d.jsonl", tmp + "/x", tmp + "/y"}},
+		{"edgenames", []string{"-sets=case", "{tmp}"}, []string{"-sets=case", tmp}},
+	} {
+		expanded, found, err = expandPathTemplates(runtime.GOOS, PathTemplateCommands[test.command], test.args)
+		assert.Nil(t, err, test.command)
+		assert.True(t, found, test.command)
+		assert.Equal(t, test.expected, expanded, test.command)
+	}
+
+	t.Setenv("HOME", "")
+	t.Setenv("USERPROFILE", "")
+	if runtime.GOOS != "windows" && runtime.GOOS != "plan9" {
+		_, _, err = expandPathTemplates(runtime.GOOS, PathTemplateCommands["create"], []string{"{desktop}/x.txt"})
+		assert.ErrorContains(t, err, "invalid path template {desktop}")
+	}
+}
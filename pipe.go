@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Response data from pipe actions
+type PipeResponse struct {
+	bytesReceived		int
+	bytesSent			int
+	status				string
+	path				string
+}
+
+// Creates the pipe with the given name, waits for a single client to connect and send a message, and optionally echoes it back
+func createPipe(name string, echo bool) (*PipeResponse, error) {
+	path := getPipePath(name)
+	fmt.Printf("Creating pipe %s, and waiting for a client to connect...\n", path)
+	response, err := servePipe(path, echo)
+	if err != nil {
+		return response, err
+	}
+	fmt.Printf("Received %d bytes on pipe %s, sent %d bytes back\n", response.bytesReceived, path, response.bytesSent)
+	return response, nil
+}
+
+// Connects to the pipe with the given name, sends the given message, and reads any response until the pipe is closed
+func connectPipe(name string, data string) (*PipeResponse, error) {
+	path := getPipePath(name)
+	fmt.Printf("Sending %d bytes of data to pipe %s...\n", len(data), path)
+	response, err := dialPipe(path, data)
+	if err != nil {
+		return response, err
+	}
+	fmt.Printf("Sent %d bytes on pipe %s, received %d bytes back\n", response.bytesSent, path, response.bytesReceived)
+	return response, nil
+}
+
+// Helper for an error response from pipe actions
+func makePipeErrorResponse(status string, path string) *PipeResponse {
+	response := new(PipeResponse)
+	response.status = status
+	response.path = path
+	return response
+}
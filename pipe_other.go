@@ -0,0 +1,94 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// The protocol recorded for pipe activities
+const PipeProtocol = "unix"
+
+// Gets the full path of a Unix domain socket (ie. "noisemaker" -> "/tmp/noisemaker.sock")
+func getPipePath(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return filepath.Join(os.TempDir(), name + ".sock")
+}
+
+// Helper for serving a single client on a Unix domain socket
+func servePipe(path string, echo bool) (*PipeResponse, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return makePipeErrorResponse(getPipeErrorStatus(err), path), err
+	}
+	defer listener.Close()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		return makePipeErrorResponse("error", path), err
+	}
+	defer conn.Close()
+
+	// The client closes its end for writing once it's sent its message
+	message, err := io.ReadAll(conn)
+	if err != nil {
+		return makePipeErrorResponse("error", path), err
+	}
+
+	response := makePipeErrorResponse("received", path)
+	response.bytesReceived = len(message)
+	if echo && len(message) > 0 {
+		response.bytesSent, err = conn.Write(message)
+		if err != nil {
+			response.status = "error"
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+// Helper for sending a message on a Unix domain socket
+func dialPipe(path string, data string) (*PipeResponse, error) {
+	conn, err := new(net.Dialer).DialContext(runContext, "unix", path)
+	if err != nil {
+		return makePipeErrorResponse(getPipeErrorStatus(err), path), err
+	}
+	defer conn.Close()
+
+	response := makePipeErrorResponse("sent", path)
+	response.bytesSent, err = conn.Write([]byte(data))
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+	conn.(*net.UnixConn).CloseWrite()
+
+	// Read the server's response, if any, until it closes its end
+	message, err := io.ReadAll(conn)
+	response.bytesReceived = len(message)
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+	return response, nil
+}
+
+// Maps an error from creating or opening a socket to a status
+func getPipeErrorStatus(err error) string {
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+		return "not_found"
+	} else if errors.Is(err, os.ErrPermission) {
+		return "no_access"
+	} else if errors.Is(err, syscall.EADDRINUSE) {
+		return "exists"
+	}
+	return "error"
+}
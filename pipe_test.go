@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAndConnectPipe_Echo(t *testing.T) {
+	name := getTestPipeName(t)
+
+	done := make(chan *PipeResponse, 1)
+	go func() {
+		response, err := createPipe(name, true)
+		assert.Nil(t, err)
+		done <- response
+	}()
+
+	// Keep trying until the pipe's been created
+	var clientResponse *PipeResponse
+	var err error
+	for i := 0; i < 100; i++ {
+		clientResponse, err = connectPipe(name, "Hello World!")
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, err)
+	serverResponse := <-done
+
+	assert.Equal(t, "sent", clientResponse.status)
+	assert.Equal(t, 12, clientResponse.bytesSent)
+	assert.Equal(t, 12, clientResponse.bytesReceived)
+	assert.Equal(t, "received", serverResponse.status)
+	assert.Equal(t, 12, serverResponse.bytesReceived)
+	assert.Equal(t, 12, serverResponse.bytesSent)
+	assert.Equal(t, getPipePath(name), serverResponse.path)
+}
+
+func TestMain_Pipe_ConnectNotFound(t *testing.T) {
+	name := getTestPipeName(t)
+
+	args := []string{"./noisemaker", "pipe", "connect", name, "Hello World!"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.activity, "pipe")
+	assert.Equal(t, activityLogEntry.method, "connect")
+	assert.Equal(t, activityLogEntry.protocol, PipeProtocol)
+	assert.Equal(t, activityLogEntry.path, getPipePath(name))
+	assert.Equal(t, activityLogEntry.status, "not_found")
+}
+
+func TestMain_Pipe_InvalidMode(t *testing.T) {
+	args := []string{"./noisemaker", "pipe", "listen", "noisemaker"}
+	assertMainPanicsWithMessage(t, args, "invalid mode for pipe: listen")
+}
+
+// Gets a pipe name that's unique to this test run (a full socket path outside of Windows, so it's cleaned up)
+func getTestPipeName(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		return "noisemaker-test-" + t.Name()
+	}
+	dir, err := os.MkdirTemp("", "nm")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir + "/test.sock"
+}
@@ -0,0 +1,126 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// The protocol recorded for pipe activities
+const PipeProtocol = "named_pipe"
+
+// Gets the full path of a named pipe (ie. "noisemaker" -> "\\.\pipe\noisemaker")
+func getPipePath(name string) string {
+	if strings.HasPrefix(name, `\\`) {
+		return name
+	}
+	return `\\.\pipe\` + name
+}
+
+// Helper for serving a single client on a Windows named pipe
+func servePipe(path string, echo bool) (*PipeResponse, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return makePipeErrorResponse("invalid_path", path), err
+	}
+	handle, err := windows.CreateNamedPipe(pathPtr, windows.PIPE_ACCESS_DUPLEX, windows.PIPE_TYPE_MESSAGE|windows.PIPE_READMODE_MESSAGE|windows.PIPE_WAIT, 1, 65536, 65536, 0, nil)
+	if err != nil {
+		return makePipeErrorResponse(getPipeErrorStatus(err), path), err
+	}
+	defer windows.CloseHandle(handle)
+
+	// Wait for the client (it may have already connected by the time we get here)
+	err = windows.ConnectNamedPipe(handle, nil)
+	if err != nil && !errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
+		return makePipeErrorResponse("error", path), err
+	}
+	defer windows.DisconnectNamedPipe(handle)
+
+	message, err := readPipeMessage(handle)
+	if err != nil {
+		return makePipeErrorResponse("error", path), err
+	}
+
+	response := makePipeErrorResponse("received", path)
+	response.bytesReceived = len(message)
+	if echo && len(message) > 0 {
+		var written uint32
+		err = windows.WriteFile(handle, message, &written, nil)
+		response.bytesSent = int(written)
+		if err != nil {
+			response.status = "error"
+			return response, err
+		}
+		windows.FlushFileBuffers(handle)
+	}
+	return response, nil
+}
+
+// Helper for sending a message on a Windows named pipe
+func dialPipe(path string, data string) (*PipeResponse, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return makePipeErrorResponse("invalid_path", path), err
+	}
+	handle, err := windows.CreateFile(pathPtr, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return makePipeErrorResponse(getPipeErrorStatus(err), path), err
+	}
+	defer windows.CloseHandle(handle)
+
+	mode := uint32(windows.PIPE_READMODE_MESSAGE)
+	err = windows.SetNamedPipeHandleState(handle, &mode, nil, nil)
+	if err != nil {
+		return makePipeErrorResponse("error", path), err
+	}
+
+	response := makePipeErrorResponse("sent", path)
+	var written uint32
+	err = windows.WriteFile(handle, []byte(data), &written, nil)
+	response.bytesSent = int(written)
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+
+	// Read the server's response, if any, until it closes its end
+	message, err := readPipeMessage(handle)
+	response.bytesReceived = len(message)
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+	return response, nil
+}
+
+// Reads a single message from the pipe, returning an empty message if the other end closes it first
+func readPipeMessage(handle windows.Handle) ([]byte, error) {
+	message := []byte{}
+	buffer := make([]byte, 65536)
+	for {
+		var read uint32
+		err := windows.ReadFile(handle, buffer, &read, nil)
+		message = append(message, buffer[:read]...)
+		if err == nil {
+			return message, nil
+		} else if errors.Is(err, windows.ERROR_MORE_DATA) {
+			continue
+		} else if errors.Is(err, windows.ERROR_BROKEN_PIPE) || errors.Is(err, windows.ERROR_PIPE_NOT_CONNECTED) {
+			return message, nil
+		}
+		return message, err
+	}
+}
+
+// Maps an error from creating or opening a pipe to a status
+func getPipeErrorStatus(err error) string {
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return "not_found"
+	} else if errors.Is(err, windows.ERROR_ACCESS_DENIED) || errors.Is(err, windows.ERROR_PIPE_BUSY) {
+		return "no_access"
+	}
+	return "error"
+}
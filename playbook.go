@@ -0,0 +1,870 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A scripted sequence of commands, run in order as a single run (ie. one step of an attack scenario after another)
+type Playbook struct {
+	Name				string						`yaml:"name" json:"name"`
+	Description			string						`yaml:"description" json:"description,omitempty"`
+	Vars				map[string]PlaybookValue	`yaml:"vars" json:"vars,omitempty"`
+	Schedule			*Schedule					`yaml:"schedule" json:"schedule,omitempty"`
+	CleanupOnFailure	bool						`yaml:"cleanup_on_failure" json:"cleanup_on_failure,omitempty"`	// removes the run's artifacts if a step fails
+	OnUnprivileged		string						`yaml:"on_unprivileged" json:"on_unprivileged,omitempty"`	// fail (by default) or skip, for steps that require privilege
+	Steps				[]PlaybookStep				`yaml:"steps" json:"steps"`
+}
+
+// A single command in a playbook, with the same arguments it would take on the command line (with ${name} replaced by the variable's
+// value), optionally run once for each of a list of values, a number of times, or only when an earlier step's status matches
+type PlaybookStep struct {
+	Name				string			`yaml:"name" json:"name"`
+	Command				string			`yaml:"command" json:"command"`
+	Args				[]string		`yaml:"args" json:"args"`
+	Foreach				PlaybookValue	`yaml:"foreach" json:"foreach,omitempty"`	// runs the step for each value, as ${item} (or ${<as>})
+	As					string			`yaml:"as" json:"as,omitempty"`
+	Repeat				int				`yaml:"repeat" json:"repeat,omitempty"`		// runs the step this many times
+	When				string			`yaml:"when" json:"when,omitempty"`			// ie. "previous == created", or "drop != error"
+	Parallel			bool			`yaml:"parallel" json:"parallel,omitempty"`	// runs the step at once with the parallel steps next to it
+	DependsOn			[]string		`yaml:"depends_on" json:"depends_on,omitempty"`	// waits for these (earlier) steps to finish first
+	Stage				string			`yaml:"stage" json:"stage,omitempty"`		// names the step's stage, in its entries' labels
+	RequiresPrivilege	bool			`yaml:"requires_privilege" json:"requires_privilege,omitempty"`	// only runs elevated (as root, or an administrator)
+	Extract				map[string]string	`yaml:"extract" json:"extract,omitempty"`	// send only: sets variables for later steps from its response (ie. task: json:task.command)
+	OnError				string			`yaml:"on_error" json:"on_error,omitempty"`	// stop, continue, or retry, when a run of it fails (default -on-error's)
+	Retries				int				`yaml:"retries" json:"retries,omitempty"`	// with on_error: retry, how many times a failed run's retried (default 1)
+}
+
+// A playbook variable's value: a single value, or a list of them
+type PlaybookValue []string
+
+// A single run of a playbook step, with its loop expanded and its variables replaced
+type PlaybookRun struct {
+	command				string
+	args				[]string
+	iteration			int
+	iterations			int
+}
+
+// Steps of a playbook that are run together: several parallel steps at once, or a single step
+type PlaybookStage struct {
+	name				string
+	named				bool
+	parallel			bool
+	steps				[]int
+}
+
+// Response data from playbook action
+type PlaybookResponse struct {
+	completed			int
+	failed				int
+	skipped				int
+	total				int
+	runs				int				// how many times it was run, on a cron schedule
+	rolledBack			int				// with cleanup_on_failure, how many artifacts were removed after a step failed
+	continued			int				// how many of the failed runs were continued past, with on_error: continue
+	retried				int				// with on_error: retry, how many times failed runs were retried
+	status				string
+}
+
+// What a playbook does with steps that require privilege, when it isn't run elevated: fails before running any step, or skips them
+var PlaybookUnprivilegedActions = []string{"fail", "skip"}
+
+// What a playbook does when a run of a step with on_error fails (it's invalid, or its status is a failure status): stops, carries on
+// with the next run, or retries it (and stops, if it never succeeds). Without one, it stops at an invalid run, but carries on after
+// one with a failure status (for later steps' conditions to check).
+var PlaybookErrorActions = []string{"stop", "continue", "retry"}
+
+// What steps without an on_error of their own do when a run fails (-on-error; none by default)
+var playbookOnError = ""
+
+// How many times a failed run's retried with on_error: retry, unless its step says otherwise
+const DefaultPlaybookStepRetries = 1
+
+// Commands that can't be run as a step of a playbook
+var NonPlaybookCommands = []string{"playbook", "scenario", "script", "daemon", "control", "collect", "replay"}
+
+// Reads and parses the playbook at path
+func loadPlaybook(path string) (*Playbook, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePlaybook(contents)
+}
+
+// A reference to a variable, in a step's arguments or foreach
+var playbookVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// The part of a variable assignment given on the command line before the =
+var playbookVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (value *PlaybookValue) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*value = PlaybookValue{node.Value}
+		return nil
+	case yaml.SequenceNode:
+		var values []string
+		err := node.Decode(&values)
+		if err != nil {
+			return err
+		}
+		*value = values
+		return nil
+	default:
+		return fmt.Errorf("line %d: must be a value or a list of values", node.Line)
+	}
+}
+
+// Parses a playbook from YAML (or JSON), and checks that every step can be run
+func parsePlaybook(contents []byte) (*Playbook, error) {
+	playbook := new(Playbook)
+	err := yaml.Unmarshal(contents, playbook)
+	if err != nil {
+		return nil, fmt.Errorf("invalid playbook: %v", err)
+	}
+	if len(playbook.Steps) == 0 {
+		return nil, fmt.Errorf("invalid playbook: no steps")
+	}
+	if playbook.Schedule != nil {
+		err = playbook.Schedule.parse()
+		if err != nil {
+			return nil, fmt.Errorf("invalid playbook: %v", err)
+		}
+	}
+	err = checkPlaybook(playbook)
+	if err != nil {
+		return nil, err
+	}
+	return playbook, nil
+}
+
+// Checks that every step of the playbook can be run, and that every variable it uses has a value
+func checkPlaybook(playbook *Playbook) error {
+	if playbook.OnUnprivileged != "" && !containsString(PlaybookUnprivilegedActions, playbook.OnUnprivileged) {
+		return fmt.Errorf("invalid playbook: invalid on_unprivileged '%s' (must be one of %v)", playbook.OnUnprivileged, PlaybookUnprivilegedActions)
+	}
+	names := []string{}
+	for i, step := range playbook.Steps {
+		if step.Command == "" {
+			return fmt.Errorf("invalid playbook: step %d has no command", i + 1)
+		}
+		if containsString(NonPlaybookCommands, step.Command) {
+			return fmt.Errorf("invalid playbook: step %d can't run %s from a playbook", i + 1, step.Command)
+		}
+		if step.When != "" {
+			err := checkPlaybookCondition(playbook, step.When, i, names)
+			if err != nil {
+				return fmt.Errorf("invalid playbook: step %d %v", i + 1, err)
+			}
+		}
+		for _, dependency := range step.DependsOn {
+			if !containsString(names, dependency) {
+				return fmt.Errorf("invalid playbook: step %d depends on step '%s', but there's no step before it with that name", i + 1, dependency)
+			}
+		}
+		if len(step.Extract) > 0 && step.Command != "send" {
+			return fmt.Errorf("invalid playbook: step %d has extract, but only send steps can extract values", i + 1)
+		}
+		for name, expression := range step.Extract {
+			if !playbookVarNamePattern.MatchString(name) {
+				return fmt.Errorf("invalid playbook: step %d extracts an invalid variable '%s'", i + 1, name)
+			}
+			err := checkExtractExpression(expression)
+			if err != nil {
+				return fmt.Errorf("invalid playbook: step %d %v", i + 1, err)
+			}
+		}
+		if step.OnError != "" && !containsString(PlaybookErrorActions, step.OnError) {
+			return fmt.Errorf("invalid playbook: step %d has an invalid on_error '%s' (must be one of %v)", i + 1, step.OnError, PlaybookErrorActions)
+		}
+		if step.Retries < 0 {
+			return fmt.Errorf("invalid playbook: step %d has an invalid retries %d (must be 0 or more)", i + 1, step.Retries)
+		}
+		if strings.ContainsAny(step.Stage, ",;=\n") {
+			return fmt.Errorf("invalid playbook: step %d has an invalid stage '%s' (can't contain commas, semicolons, equals signs, or newlines)", i + 1, step.Stage)
+		}
+		if step.Stage != "" && step.Parallel && i > 0 && playbook.Steps[i - 1].Parallel {
+			for j := i - 1; j >= 0 && playbook.Steps[j].Parallel; j-- {
+				if playbook.Steps[j].Stage != "" && playbook.Steps[j].Stage != step.Stage {
+					return fmt.Errorf("invalid playbook: step %d has stage '%s', but runs in parallel with stage '%s'", i + 1, step.Stage, playbook.Steps[j].Stage)
+				}
+			}
+		}
+		_, err := expandPlaybookStep(playbook, i, getPlaybookStepVars(playbook, i, nil))
+		if err != nil {
+			return fmt.Errorf("invalid playbook: step %d %v", i + 1, err)
+		}
+		if step.Name != "" {
+			names = append(names, step.Name)
+		}
+	}
+	return nil
+}
+
+// Sets the playbook's variables from name=value assignments (ie. given on the command line), overriding the playbook's own values; a
+// value with commas is a list, when it's looped over
+func setPlaybookVars(playbook *Playbook, assignments []string) error {
+	for _, assignment := range assignments {
+		name, value, found := strings.Cut(assignment, "=")
+		if !found || !playbookVarNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid playbook variable '%s' (must be name=value)", assignment)
+		}
+		if playbook.Vars == nil {
+			playbook.Vars = map[string]PlaybookValue{}
+		}
+		playbook.Vars[name] = PlaybookValue{value}
+	}
+	return checkPlaybook(playbook)
+}
+
+// Parses a step's condition, as "<step> == <status>" or "<step> != <status>", where <step> is an earlier step's name, or "previous"
+// for the step run just before it
+func parsePlaybookCondition(condition string) (string, string, string, error) {
+	fields := strings.Fields(condition)
+	if len(fields) != 3 || (fields[1] != "==" && fields[1] != "!=") {
+		return "", "", "", fmt.Errorf("has an invalid condition '%s' (must be '<step> == <status>' or '<step> != <status>')", condition)
+	}
+	return fields[0], fields[1], fields[2], nil
+}
+
+// Checks that the condition of step i is valid, and refers to a step that's finished before it runs: one before it (and not one running
+// alongside it in a parallel stage, unless it depends on it)
+func checkPlaybookCondition(playbook *Playbook, condition string, i int, names []string) error {
+	stepName, _, _, err := parsePlaybookCondition(condition)
+	if err != nil {
+		return err
+	}
+	step := playbook.Steps[i]
+	if stepName == "previous" {
+		if i == 0 {
+			return fmt.Errorf("has a condition on the previous step, but it's the first step")
+		}
+		if step.Parallel || playbook.Steps[i - 1].Parallel {
+			return fmt.Errorf("has a condition on the previous step, but it's in or after a parallel stage (name the step instead)")
+		}
+		return nil
+	}
+	if !containsString(names, stepName) {
+		return fmt.Errorf("has a condition on step '%s', but there's no step before it with that name", stepName)
+	}
+	if step.Parallel && !containsString(step.DependsOn, stepName) {
+		for j := i - 1; j >= 0 && playbook.Steps[j].Parallel; j-- {
+			if playbook.Steps[j].Name == stepName {
+				return fmt.Errorf("has a condition on step '%s', but runs in parallel with it (add it to depends_on)", stepName)
+			}
+		}
+	}
+	return nil
+}
+
+// Whether the condition holds for the statuses of the steps run so far (by name, and the previous step's)
+func evaluatePlaybookCondition(condition string, statuses map[string]string, previous string) bool {
+	stepName, operator, status, _ := parsePlaybookCondition(condition)
+	actual := previous
+	if stepName != "previous" {
+		actual = statuses[stepName]
+	}
+	return (actual == status) == (operator == "==")
+}
+
+// Gets the variables step i of the playbook can use: the playbook's, and the ones the steps before it extract from their responses
+// (with the values extracted so far, or empty until they have been)
+func getPlaybookStepVars(playbook *Playbook, i int, extracted map[string]string) map[string]PlaybookValue {
+	vars := map[string]PlaybookValue{}
+	for name, value := range playbook.Vars {
+		vars[name] = value
+	}
+	for j := 0; j < i; j++ {
+		for name := range playbook.Steps[j].Extract {
+			vars[name] = PlaybookValue{extracted[name]}
+		}
+	}
+	return vars
+}
+
+// Expands step i of the playbook into each of its runs (once, or once for each foreach value or repeat), with its variables replaced
+func expandPlaybookStep(playbook *Playbook, i int, playbookVars map[string]PlaybookValue) ([]*PlaybookRun, error) {
+	step := playbook.Steps[i]
+	if step.Repeat < 0 {
+		return nil, fmt.Errorf("has an invalid repeat %d", step.Repeat)
+	}
+	if step.Repeat > 0 && step.Foreach != nil {
+		return nil, fmt.Errorf("has both foreach and repeat")
+	}
+	if step.As != "" && step.Foreach == nil {
+		return nil, fmt.Errorf("has as, but no foreach")
+	}
+	if step.As != "" && !playbookVarNamePattern.MatchString(step.As) {
+		return nil, fmt.Errorf("has an invalid as '%s'", step.As)
+	}
+
+	// Work out the loop's values (one empty iteration, if it doesn't loop)
+	itemName := step.As
+	if itemName == "" {
+		itemName = "item"
+	}
+	var items []string
+	looping := step.Foreach != nil || step.Repeat > 0
+	if step.Foreach != nil {
+		for _, value := range step.Foreach {
+			values, err := expandPlaybookItem(playbookVars, value)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, values...)
+		}
+	} else if step.Repeat > 0 {
+		for n := 1; n <= step.Repeat; n++ {
+			items = append(items, strconv.Itoa(n))
+		}
+	} else {
+		items = []string{""}
+	}
+
+	runs := []*PlaybookRun{}
+	for n, item := range items {
+		vars := map[string]PlaybookValue{}
+		for name, value := range playbookVars {
+			vars[name] = value
+		}
+		if looping {
+			vars["index"] = PlaybookValue{strconv.Itoa(n + 1)}
+			if step.Foreach != nil {
+				vars[itemName] = PlaybookValue{item}
+			}
+		}
+		run := &PlaybookRun{command: step.Command, args: []string{}, iteration: n + 1, iterations: len(items)}
+		for _, arg := range step.Args {
+			replaced, err := replacePlaybookVars(vars, arg)
+			if err != nil {
+				return nil, err
+			}
+			run.args = append(run.args, replaced)
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// Expands a foreach value: a reference to a variable on its own (ie. "${hosts}") is each of the variable's values (a variable with a
+// single value is split on commas, so a list can be given on the command line), and anything else is a single value
+func expandPlaybookItem(vars map[string]PlaybookValue, value string) ([]string, error) {
+	match := playbookVarPattern.FindStringSubmatch(value)
+	if match == nil || match[0] != value {
+		replaced, err := replacePlaybookVars(vars, value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{replaced}, nil
+	}
+	values, found := vars[match[1]]
+	if !found {
+		return nil, fmt.Errorf("uses undefined variable '%s'", match[1])
+	}
+	if len(values) == 1 {
+		return strings.Split(values[0], ","), nil
+	}
+	return values, nil
+}
+
+// Replaces each ${name} in the text with the variable's value (a list's values are joined with commas, ie. for scan's ports)
+func replacePlaybookVars(vars map[string]PlaybookValue, text string) (string, error) {
+	var err error
+	replaced := playbookVarPattern.ReplaceAllStringFunc(text, func(reference string) string {
+		name := playbookVarPattern.FindStringSubmatch(reference)[1]
+		values, found := vars[name]
+		if !found {
+			err = fmt.Errorf("uses undefined variable '%s'", name)
+			return reference
+		}
+		return strings.Join(values, ",")
+	})
+	return replaced, err
+}
+
+// Runs the playbook as the entry's activity (whether it was loaded from a file, or submitted to the daemon), recording its overall result.
+// With a checkpoint, its progress is saved as it goes, and the state file's removed once it's completed. With cleanup_on_failure, a
+// run that fails is rolled back.
+func runPlaybookActivity(activityLog Sink, activityLogEntry *ActivityLogEntry, playbook *Playbook, checkpoint *PlaybookCheckpoint) *PlaybookResponse {
+	var playbookResponse *PlaybookResponse
+	if playbook.Schedule != nil && playbook.Schedule.cron != nil {
+		playbookResponse = runScheduledPlaybook(activityLog, activityLogEntry, playbook, checkpoint)
+	} else {
+		playbookResponse = runPlaybook(activityLog, activityLogEntry, playbook, checkpoint)
+	}
+	if playbookResponse.status != "completed" && playbook.CleanupOnFailure {
+		rollBackPlaybook(activityLog, activityLogEntry, playbook, playbookResponse)
+	}
+	// (once it's rolled back, the steps the state file records as done have been undone, so it starts over)
+	if checkpoint != nil && (playbookResponse.status == "completed" || playbook.CleanupOnFailure) {
+		check(checkpoint.remove())
+	}
+	activityLogEntry.status = playbookResponse.status
+	details := fmt.Sprintf("%d of %d steps completed", playbookResponse.completed, playbookResponse.total)
+	if playbookResponse.skipped > 0 {
+		details += fmt.Sprintf(", %d skipped", playbookResponse.skipped)
+	}
+	if playbookResponse.continued > 0 {
+		details += fmt.Sprintf(", %d failed and continued past", playbookResponse.continued)
+	}
+	if playbookResponse.retried > 0 {
+		details += fmt.Sprintf(", %d retries", playbookResponse.retried)
+	}
+	if playbookResponse.runs > 0 || (playbook.Schedule != nil && playbook.Schedule.cron != nil) {
+		details += fmt.Sprintf(", over %d scheduled runs", playbookResponse.runs)
+	}
+	if playbookResponse.rolledBack > 0 {
+		details += fmt.Sprintf(", %d artifacts rolled back", playbookResponse.rolledBack)
+	}
+	activityLogEntry.details = escapeRawText(details)
+	return playbookResponse
+}
+
+// Removes the artifacts the failed playbook's run made (from the artifact manifest, so ones made before it was resumed are too), most
+// recent first, each logged as its own entry with a rollback=true label
+func rollBackPlaybook(activityLog Sink, parent *ActivityLogEntry, playbook *Playbook, response *PlaybookResponse) {
+	artifacts, err := getRunArtifacts(unescapeRawText(parent.runId))
+	if err != nil {
+		slog.Warn("Couldn't roll back playbook", "playbook", playbook.Name, "error", err)
+		return
+	}
+	fmt.Printf("Rolling back %d artifacts of playbook %s...\n", len(artifacts), playbook.Name)
+	artifactsResponse := undoArtifacts(activityLog, parent, artifacts, "rollback")
+	response.rolledBack = artifactsResponse.removed
+}
+
+// Expands every step of the playbook into its runs (which parsePlaybook has already checked can be done)
+func expandPlaybook(playbook *Playbook) [][]*PlaybookRun {
+	stepRuns := [][]*PlaybookRun{}
+	for i := range playbook.Steps {
+		runs, err := expandPlaybookStep(playbook, i, getPlaybookStepVars(playbook, i, nil))
+		check(err)
+		stepRuns = append(stepRuns, runs)
+	}
+	return stepRuns
+}
+
+// Groups the playbook's steps into the stages they're run in: each run of consecutive parallel steps is one stage (run at once), and
+// every other step is a stage of its own
+func getPlaybookStages(playbook *Playbook) []*PlaybookStage {
+	stages := []*PlaybookStage{}
+	for i, step := range playbook.Steps {
+		if len(stages) == 0 || !step.Parallel || !stages[len(stages) - 1].parallel {
+			stages = append(stages, &PlaybookStage{name: fmt.Sprintf("stage-%d", len(stages) + 1), parallel: step.Parallel})
+		}
+		stage := stages[len(stages) - 1]
+		if step.Stage != "" {
+			stage.name = step.Stage
+			stage.named = true
+		}
+		stage.steps = append(stage.steps, i)
+	}
+	return stages
+}
+
+// Runs each stage of the playbook in order, as part of the parent's run, logging each run of a step (each of a loop's runs in turn) as
+// its own entry. The steps of a parallel stage are run at once, except that a step waits for the steps it depends on to finish first.
+// A step whose condition doesn't hold is skipped (and its status is "skipped", for later conditions). Stops at the first run that's
+// invalid (the run's entry records why), once the steps already running alongside it have finished, unless its step's on_error says to
+// continue past it or retry it. With a checkpoint, the runs it
+// already records as finished aren't run again. Unless it's run elevated, a playbook with steps that require privilege fails before
+// running any of them (or, with on_unprivileged: skip, skips those steps).
+func runPlaybook(activityLog Sink, parent *ActivityLogEntry, playbook *Playbook, checkpoint *PlaybookCheckpoint) *PlaybookResponse {
+	state := &PlaybookState{playbook: playbook, response: new(PlaybookResponse), runs: expandPlaybook(playbook), statuses: map[string]string{}, extracted: map[string]string{}, checkpoint: checkpoint}
+	for _, runs := range state.runs {
+		state.response.total += len(runs)
+	}
+	if checkpoint != nil {
+		for name, status := range checkpoint.Statuses {
+			state.statuses[name] = status
+		}
+		for name, value := range checkpoint.Extracted {
+			state.extracted[name] = value
+		}
+		state.previous = checkpoint.Previous
+		state.response.completed = checkpoint.Completed
+		state.response.skipped = checkpoint.Skipped
+		state.response.failed = checkpoint.Continued
+		state.response.continued = checkpoint.Continued
+	}
+	if parent.elevated != "true" && playbook.OnUnprivileged != "skip" {
+		for i, step := range playbook.Steps {
+			if step.RequiresPrivilege && !state.isDone(i, len(state.runs[i]) - 1) {
+				fmt.Printf("Step %d of %d requires privilege, but noisemaker isn't running elevated (run it as root or an administrator, or set on_unprivileged: skip)\n", i + 1, len(playbook.Steps))
+				logInsufficientPrivilege(activityLog, parent, state.runs[i][0])
+				state.finishStep(i, "insufficient_privilege", 0, 1)
+				break
+			}
+		}
+	}
+
+	for _, stage := range getPlaybookStages(playbook) {
+		if state.hasFailed() || isRunCancelled() {
+			break
+		}
+		if !stage.parallel {
+			runPlaybookStep(activityLog, parent, playbook, stage, stage.steps[0], state)
+		} else {
+			fmt.Printf("Running %d steps of stage %s in parallel...\n", len(stage.steps), stage.name)
+			done := map[int]chan bool{}
+			for _, i := range stage.steps {
+				done[i] = make(chan bool)
+			}
+			var waitGroup sync.WaitGroup
+			for _, i := range stage.steps {
+				waitGroup.Add(1)
+				go func() {
+					defer waitGroup.Done()
+					defer close(done[i])
+					for _, dependency := range getPlaybookDependencies(playbook, i) {
+						if dependencyDone, found := done[dependency]; found {
+							<-dependencyDone
+						}
+					}
+					if !state.hasFailed() {
+						runPlaybookStep(activityLog, parent, playbook, stage, i, state)
+					}
+				}()
+			}
+			waitGroup.Wait()
+			state.previous = ""
+		}
+	}
+
+	response := state.response
+	if response.failed == 0 {
+		response.status = "completed"
+	} else {
+		response.status = "error"
+	}
+	fmt.Printf("Ran %d of %d steps of playbook %s\n", response.completed, response.total, playbook.Name)
+	return response
+}
+
+// Runs each of step i's runs in turn (unless its condition doesn't hold), recording its status for later conditions
+func runPlaybookStep(activityLog Sink, parent *ActivityLogEntry, playbook *Playbook, stage *PlaybookStage, i int, state *PlaybookState) {
+	step := playbook.Steps[i]
+	stepName := step.Name
+	if stepName == "" {
+		stepName = step.Command
+	}
+	runs := state.runs[i]
+	if state.isDone(i, len(runs) - 1) {
+		// (it finished before the run was resumed)
+		return
+	}
+
+	// (the condition's checked once, for every run of the step)
+	if step.When != "" && !state.evaluate(step.When) {
+		fmt.Printf("Skipping step %d of %d (%s), since %s doesn't hold\n", i + 1, len(playbook.Steps), stepName, step.When)
+		state.finishStep(i, "skipped", len(runs), 0)
+		return
+	}
+	if step.RequiresPrivilege && parent.elevated != "true" {
+		fmt.Printf("Skipping step %d of %d (%s), since it requires privilege and noisemaker isn't running elevated\n", i + 1, len(playbook.Steps), stepName)
+		logInsufficientPrivilege(activityLog, parent, runs[0])
+		state.finishStep(i, "insufficient_privilege", len(runs), 0)
+		return
+	}
+
+	runs = state.expandWithExtracted(i)
+	onError := getPlaybookOnError(step)
+	retries := 0
+	if onError == "retry" {
+		retries = DefaultPlaybookStepRetries
+		if step.Retries > 0 {
+			retries = step.Retries
+		}
+	}
+	for n, run := range runs {
+		if state.isDone(i, n) {
+			continue
+		}
+		if run.iterations > 1 {
+			fmt.Printf("Running step %d of %d (%s, %d of %d)...\n", i + 1, len(playbook.Steps), stepName, run.iteration, run.iterations)
+		} else {
+			fmt.Printf("Running step %d of %d (%s)...\n", i + 1, len(playbook.Steps), stepName)
+		}
+
+		if playbook.Schedule != nil {
+			playbook.Schedule.wait()
+		}
+		// Run it (again, while it fails and there are retries left)
+		backoff := *retryBackoffPtr
+		for attempt := 1; ; attempt++ {
+			entry := newChildLogEntry(parent, run.command)
+			entry.processCmd = escapeCommandString(run.command, run.args)
+			if stage.parallel || stage.named {
+				entry.labels = addLabel(entry.labels, "stage", stage.name)
+			}
+			if onError != "" {
+				entry.labels = addLabel(entry.labels, "on_error", onError)
+			}
+			if retries > 0 {
+				entry.attempt = attempt
+			}
+			err := runPlaybookRun(activityLog, entry, step, run, state, onError, getPlaybookErrorOutcome(onError, attempt, retries))
+			if err == nil {
+				state.finishRun(i, n, entry.status)
+				break
+			}
+			fmt.Printf("Step %d (%s) failed: %v\n", i + 1, stepName, err)
+			status := "error"
+			if entry.status != "" {
+				status = entry.status
+			}
+			if onError == "continue" {
+				state.continueRun(i, n, status)
+				break
+			}
+			if attempt > retries || isRunCancelled() {
+				state.finishStep(i, status, 0, 1)
+				return
+			}
+			fmt.Printf("Retrying step %d (%s) in %v...\n", i + 1, stepName, backoff)
+			state.retry()
+			sleepContext(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+// Runs one attempt at a run of the step, logging it as the entry, and then extracts the values the step sets from its response,
+// returning why if either fails, or (with on_error) its status is a failure status. An invalid run's entry records the outcome (ie.
+// that it's being retried) after why.
+func runPlaybookRun(activityLog Sink, entry *ActivityLogEntry, step PlaybookStep, run *PlaybookRun, state *PlaybookState, onError string, outcome string) error {
+	err := runCommandRecovering(activityLog, entry, run.command, run.args)
+	if err != nil {
+		if outcome != "" {
+			entry.details = escapeRawText(err.Error() + " (" + outcome + ")")
+		}
+		markCancelled(entry)
+		writeLogEntry(activityLog, entry)
+		return err
+	}
+	if onError != "" && isFailureStatus(unescapeRawText(entry.status)) {
+		return fmt.Errorf("its status is %s", unescapeRawText(entry.status))
+	}
+	if len(step.Extract) > 0 {
+		return state.extract(step, entry.response)
+	}
+	return nil
+}
+
+// Gets what the step does when a run of it fails: its own on_error, or else -on-error's (if neither is set, none)
+func getPlaybookOnError(step PlaybookStep) string {
+	if step.OnError != "" {
+		return step.OnError
+	}
+	return playbookOnError
+}
+
+// Describes what's done after the attempt at a run fails, for its entry (nothing, when the playbook just stops)
+func getPlaybookErrorOutcome(onError string, attempt int, retries int) string {
+	switch {
+	case onError == "continue":
+		return "on_error: continuing"
+	case onError == "retry" && attempt <= retries:
+		return fmt.Sprintf("on_error: retrying, %d of %d retries", attempt, retries)
+	case onError == "retry":
+		return fmt.Sprintf("on_error: stopping after %d retries", retries)
+	}
+	return ""
+}
+
+// Logs the run of a step that requires privilege as refused, with the insufficient_privilege status (without running it)
+func logInsufficientPrivilege(activityLog Sink, parent *ActivityLogEntry, run *PlaybookRun) {
+	entry := newChildLogEntry(parent, run.command)
+	entry.processCmd = escapeCommandString(run.command, run.args)
+	entry.status = "insufficient_privilege"
+	entry.details = escapeRawText("requires privilege, but the process isn't elevated (root, or an elevated administrator)")
+	writeLogEntry(activityLog, entry)
+}
+
+// The steps that step i depends on (by name)
+func getPlaybookDependencies(playbook *Playbook, i int) []int {
+	dependencies := []int{}
+	for j := 0; j < i; j++ {
+		if playbook.Steps[j].Name != "" && containsString(playbook.Steps[i].DependsOn, playbook.Steps[j].Name) {
+			dependencies = append(dependencies, j)
+		}
+	}
+	return dependencies
+}
+
+// Adds a key=value label to labels (in the form they're logged in)
+func addLabel(labels string, key string, value string) string {
+	if labels == "" {
+		return key + "=" + value
+	}
+	return labels + ";" + key + "=" + value
+}
+
+// The progress of a playbook that's being run, shared by the steps of a parallel stage
+type PlaybookState struct {
+	mutex				sync.Mutex
+	playbook			*Playbook
+	response			*PlaybookResponse
+	runs				[][]*PlaybookRun
+	statuses			map[string]string		// the status of each named step that's finished
+	extracted			map[string]string		// the values the steps that have finished extracted from their responses
+	previous			string					// the status of the last step finished outside of a parallel stage
+	checkpoint			*PlaybookCheckpoint		// with -state-file, where the progress is saved
+}
+
+// Whether a run's failed in a way that stops the playbook (rather than being continued past)
+func (state *PlaybookState) hasFailed() bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return state.response.failed > state.response.continued
+}
+
+func (state *PlaybookState) evaluate(condition string) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return evaluatePlaybookCondition(condition, state.statuses, state.previous)
+}
+
+// Expands step i again with the values extracted so far, since they can change its runs (ie. looping over an extracted list)
+func (state *PlaybookState) expandWithExtracted(i int) []*PlaybookRun {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if len(state.extracted) == 0 {
+		return state.runs[i]
+	}
+	runs, err := expandPlaybookStep(state.playbook, i, getPlaybookStepVars(state.playbook, i, state.extracted))
+	if err != nil {
+		// (checkPlaybook has already expanded it, so this can't happen)
+		return state.runs[i]
+	}
+	state.response.total += len(runs) - len(state.runs[i])
+	state.runs[i] = runs
+	return runs
+}
+
+// Extracts the values the step sets from its response, for the steps after it
+func (state *PlaybookState) extract(step PlaybookStep, response *MessageResponse) error {
+	if response == nil {
+		return fmt.Errorf("there's no response to extract values from")
+	}
+	names := []string{}
+	for name := range step.Extract {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := map[string]string{}
+	for _, name := range names {
+		value, err := extractResponseValue(response, step.Extract[name])
+		if err != nil {
+			return fmt.Errorf("couldn't extract %s (%s): %v", name, step.Extract[name], err)
+		}
+		fmt.Printf("Extracted %s = %s\n", name, value)
+		values[name] = value
+	}
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	for name, value := range values {
+		state.extracted[name] = value
+		if state.checkpoint != nil {
+			if state.checkpoint.Extracted == nil {
+				state.checkpoint.Extracted = map[string]string{}
+			}
+			state.checkpoint.Extracted[name] = value
+		}
+	}
+	return nil
+}
+
+// Whether run n of step i finished before the run was resumed
+func (state *PlaybookState) isDone(i int, n int) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return state.checkpoint != nil && state.checkpoint.isDone(i, n)
+}
+
+// Records that run n of step i completed with the status (which is the step's status, if it's the last run)
+func (state *PlaybookState) finishRun(i int, n int, status string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.response.completed += 1
+	if n == len(state.runs[i]) - 1 {
+		state.setStatus(i, status)
+	}
+	if state.checkpoint != nil {
+		state.checkpoint.markDone(i, n)
+		state.save()
+	}
+}
+
+// Records that run n of step i failed with the status, but was continued past (with on_error: continue), so it isn't run again if the
+// run's resumed
+func (state *PlaybookState) continueRun(i int, n int, status string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.response.failed += 1
+	state.response.continued += 1
+	if n == len(state.runs[i]) - 1 {
+		state.setStatus(i, status)
+	}
+	if state.checkpoint != nil {
+		state.checkpoint.Continued = state.response.continued
+		state.checkpoint.markDone(i, n)
+		state.save()
+	}
+}
+
+// Records that a failed run's being retried
+func (state *PlaybookState) retry() {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.response.retried += 1
+}
+
+// Records that step i finished early with the status, with how many of its runs were skipped (all of them), or failed
+func (state *PlaybookState) finishStep(i int, status string, skipped int, failed int) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.response.skipped += skipped
+	state.response.failed += failed
+	state.setStatus(i, status)
+	if state.checkpoint != nil {
+		for n := 0; n < skipped; n++ {
+			state.checkpoint.markDone(i, n)
+		}
+		state.save()
+	}
+}
+
+func (state *PlaybookState) setStatus(i int, status string) {
+	state.previous = status
+	if state.checkpoint != nil {
+		state.checkpoint.Previous = status
+	}
+	if name := state.playbook.Steps[i].Name; name != "" {
+		state.statuses[name] = status
+		if state.checkpoint != nil {
+			state.checkpoint.Statuses[name] = status
+		}
+	}
+}
+
+// Saves the progress to the state file (a failure to is reported, but doesn't stop the playbook)
+func (state *PlaybookState) save() {
+	state.checkpoint.Completed = state.response.completed
+	state.checkpoint.Skipped = state.response.skipped
+	err := state.checkpoint.save()
+	if err != nil {
+		slog.Warn("Couldn't save the state file", "path", state.checkpoint.path, "error", err)
+	}
+}
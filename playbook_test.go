@@ -0,0 +1,442 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Playbook(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: drop-and-clean
+steps:
+  - name: drop
+    command: create
+    args: ["` + dir + `/dropped.txt", "payload"]
+  - command: update
+    args: ["` + dir + `/dropped.txt", "updated payload"]
+  - command: delete
+    args: ["` + dir + `/dropped.txt"]
+`), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=playbook-run", "playbook", playbookPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Running step 1 of 3 (drop)...")
+	assert.Contains(t, output, "Running step 2 of 3 (update)...")
+	assert.Equal(t, activityLogEntry.activity, "playbook")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.seq, 4)
+	assert.False(t, fileExists(dir + "/dropped.txt"))
+
+	// Every step should be logged as part of the same run, in order
+	assert.Equal(t, []string{"playbook-run,1", "playbook-run,2", "playbook-run,3", "playbook-run,4"}, readTestRunIdsAndSeqs(t, logFilePath))
+	assertLogFileContains(t, logFilePath, ",create,")
+	assertLogFileContains(t, logFilePath, ",delete,")
+}
+
+func TestMain_Playbook_StopsAtInvalidStep(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: broken
+steps:
+  - command: create
+  - command: create
+    args: ["` + dir + `/never.txt"]
+`), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "playbook", playbookPath}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "error")
+	assert.False(t, fileExists(dir + "/never.txt"))
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Contains(t, contents, ",error,")
+	assert.Contains(t, contents, "not enough arguments for create!")
+	// (the schema version and header, then the failed step and the playbook)
+	assert.Equal(t, 4, strings.Count(contents, "\n"))
+}
+
+func TestMain_Playbook_OnError(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: best-effort
+steps:
+  - command: create
+    on_error: continue
+  - command: create
+    args: ["` + dir + `/after-continue.txt"]
+  - command: create
+    on_error: retry
+    retries: 2
+  - command: create
+    args: ["` + dir + `/never.txt"]
+`), 0644)
+
+	// A step that's continued past doesn't stop the playbook, and one that's retried is run again until it's out of retries
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-retry-backoff=1ms", "playbook", playbookPath})
+	assert.Equal(t, "error", activityLogEntry.status)
+	assert.Equal(t, "1 of 4 steps completed\\, 1 failed and continued past\\, 2 retries", activityLogEntry.details)
+	assert.True(t, fileExists(dir + "/after-continue.txt"))
+	assert.False(t, fileExists(dir + "/never.txt"))
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 6)
+	assert.Equal(t, "not enough arguments for create! Args: [] (on_error: continuing)", unescapeRawText(parsedLog.entries[0].details))
+	for n, entry := range parsedLog.entries[2:5] {
+		assert.Equal(t, "error", entry.status)
+		assert.Equal(t, n + 1, entry.attempt)
+	}
+	assert.Contains(t, unescapeRawText(parsedLog.entries[2].details), "(on_error: retrying, 1 of 2 retries)")
+	assert.Contains(t, unescapeRawText(parsedLog.entries[4].details), "(on_error: stopping after 2 retries)")
+
+	// -on-error sets what the steps without one of their own do, and a run with a failure status fails too
+	os.Remove(dir + "/after-continue.txt")
+	os.Remove(logFilePath)
+	os.WriteFile(playbookPath, []byte(`
+name: best-effort
+steps:
+  - command: create
+  - command: read
+    args: ["` + dir + `/missing.txt"]
+  - command: create
+    args: ["` + dir + `/after-continue.txt"]
+  - command: read
+    args: ["` + dir + `/missing.txt"]
+    on_error: stop
+  - command: create
+    args: ["` + dir + `/never.txt"]
+`), 0644)
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-on-error=continue", "playbook", playbookPath})
+	assert.Contains(t, output, "Step 2 (read) failed: its status is not_found")
+	assert.Equal(t, "error", activityLogEntry.status)
+	assert.Equal(t, "1 of 5 steps completed\\, 2 failed and continued past", activityLogEntry.details)
+	assert.True(t, fileExists(dir + "/after-continue.txt"))
+	assert.False(t, fileExists(dir + "/never.txt"))
+	parsedLog, err = readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 5)
+	assert.Equal(t, "on_error=continue", parsedLog.entries[1].labels)
+	assert.Equal(t, "on_error=stop", parsedLog.entries[3].labels)
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "-on-error=ignore", "playbook", playbookPath}, "invalid -on-error 'ignore' (must be one of [stop continue retry])")
+}
+
+func TestMain_Playbook_CleanupOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	statePath := dir + "/state.json"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: half-done
+cleanup_on_failure: true
+steps:
+  - command: create
+    foreach: [a, b]
+    args: ["` + dir + `/${item}.txt"]
+  - command: update
+    args: ["` + dir + `/a.txt", "changed"]
+  - command: create
+`), 0644)
+	os.WriteFile(dir + "/existing.txt", []byte("left alone"), 0644)
+
+	// What the run made is removed once a step fails (and the state file, since it's been undone)
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-state-file=" + statePath, "playbook", playbookPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Rolling back 2 artifacts of playbook half-done...")
+	assert.Equal(t, activityLogEntry.status, "error")
+	assert.Equal(t, activityLogEntry.details, "3 of 4 steps completed\\, 2 artifacts rolled back")
+	assert.False(t, fileExists(dir + "/a.txt"))
+	assert.False(t, fileExists(dir + "/b.txt"))
+	assert.True(t, fileExists(dir + "/existing.txt"))
+	assert.False(t, fileExists(statePath))
+	assertLogFileContains(t, logFilePath, ",rollback=true,")
+
+	// Without it, they're left behind
+	os.WriteFile(playbookPath, []byte("name: half-done\nsteps:\n  - command: create\n    args: [\"" + dir + "/a.txt\"]\n  - command: create\n"), 0644)
+	callMain(args)
+	assert.Equal(t, activityLogEntry.details, "1 of 2 steps completed")
+	assert.True(t, fileExists(dir + "/a.txt"))
+	assert.True(t, fileExists(statePath))
+}
+
+func TestMain_Playbook_RequiresPrivilege(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+	writePlaybook := func(onUnprivileged string) {
+		os.WriteFile(playbookPath, []byte(`
+name: persistence
+on_unprivileged: ` + onUnprivileged + `
+steps:
+  - command: create
+    args: ["` + dir + `/dropped.txt"]
+  - name: account
+    command: useradd
+    args: ["svc-backdoor"]
+    requires_privilege: true
+  - command: delete
+    args: ["` + dir + `/dropped.txt"]
+    when: account == insufficient_privilege
+`), 0644)
+	}
+	isElevated = func() bool { return false }
+	defer func() { isElevated = isProcessElevated }()
+
+	// Unprivileged, it fails before running any step
+	writePlaybook("fail")
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "playbook", playbookPath})
+	assert.Contains(t, output, "Step 2 of 3 requires privilege, but noisemaker isn't running elevated")
+	assert.Equal(t, activityLogEntry.elevated, "false")
+	assert.Equal(t, activityLogEntry.status, "error")
+	assert.Equal(t, activityLogEntry.details, "0 of 3 steps completed")
+	assert.False(t, fileExists(dir + "/dropped.txt"))
+	assertLogFileContains(t, logFilePath, ",useradd,")
+	assertLogFileContains(t, logFilePath, ",insufficient_privilege,")
+
+	// Or skips the step, which later conditions can check for
+	writePlaybook("skip")
+	output = callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "playbook", playbookPath})
+	assert.Contains(t, output, "Skipping step 2 of 3 (account), since it requires privilege and noisemaker isn't running elevated")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "2 of 3 steps completed\\, 1 skipped")
+	assert.False(t, fileExists(dir + "/dropped.txt"))
+}
+
+func TestMain_Playbook_Loops(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: loops
+vars:
+  dir: "` + dir + `"
+  files: [a.txt, b.txt]
+steps:
+  - name: drop
+    command: create
+    foreach: ["${files}", c.txt]
+    as: file
+    args: ["${dir}/${file}", "file ${index}"]
+  - command: update
+    repeat: 2
+    args: ["${dir}/a.txt", "update ${index}"]
+`), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=loop-run", "playbook", playbookPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Running step 1 of 2 (drop, 3 of 3)...")
+	assert.Contains(t, output, "Running step 2 of 2 (update, 2 of 2)...")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "5 of 5 steps completed")
+	assert.Equal(t, activityLogEntry.seq, 6)
+
+	contents, err := readTestFile(dir + "/b.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "file 2", contents)
+	contents, err = readTestFile(dir + "/a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "update 2", contents)
+	assert.True(t, fileExists(dir + "/c.txt"))
+	assertLogFileContains(t, logFilePath, ",create " + dir + "/c.txt file 3,")
+}
+
+func TestMain_Playbook_Conditions(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: conditions
+steps:
+  - name: cleanup
+    command: delete
+    args: ["` + dir + `/missing.txt"]
+  - command: create
+    when: cleanup == deleted
+    args: ["` + dir + `/never.txt"]
+  - command: create
+    when: previous == skipped
+    args: ["` + dir + `/fallback.txt"]
+  - command: create
+    when: cleanup != deleted
+    repeat: 2
+    args: ["` + dir + `/repeated.txt"]
+`), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "playbook", playbookPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Skipping step 2 of 4 (create), since cleanup == deleted doesn't hold")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "4 of 5 steps completed\\, 1 skipped")
+	assert.False(t, fileExists(dir + "/never.txt"))
+	assert.True(t, fileExists(dir + "/fallback.txt"))
+	assert.True(t, fileExists(dir + "/repeated.txt"))
+}
+
+func TestMain_Playbook_Vars(t *testing.T) {
+	dir := t.TempDir()
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: vars
+vars:
+  names: default.txt
+steps:
+  - command: create
+    foreach: ["${names}"]
+    args: ["` + dir + `/${item}"]
+`), 0644)
+
+	// Variables given after the playbook override its own (and a value with commas is a list)
+	args := []string{"./noisemaker", "-sink=stdout", "playbook", playbookPath, "names=one.txt,two.txt"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.details, "2 of 2 steps completed")
+	assert.True(t, fileExists(dir + "/one.txt"))
+	assert.True(t, fileExists(dir + "/two.txt"))
+	assert.False(t, fileExists(dir + "/default.txt"))
+
+	args = []string{"./noisemaker", "-sink=stdout", "playbook", playbookPath, "names"}
+	assertMainPanicsWithMessage(t, args, "invalid playbook variable 'names' (must be name=value)")
+}
+
+func TestMain_Playbook_Parallel(t *testing.T) {
+	// Each request waits (for a while) for the other, so they only both answer "together" if they're sent at once
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		waitGroup.Done()
+		together := make(chan bool)
+		go func() {
+			waitGroup.Wait()
+			close(together)
+		}()
+		select {
+		case <-together:
+			fmt.Fprint(w, "together")
+		case <-time.After(5 * time.Second):
+			fmt.Fprint(w, "alone")
+		}
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: parallel
+steps:
+  - name: beacon-1
+    command: send
+    parallel: true
+    stage: beaconing
+    args: [GET, "` + host + `", "` + port + `"]
+  - name: beacon-2
+    command: send
+    parallel: true
+    args: [GET, "` + host + `", "` + port + `"]
+  - name: drop
+    command: create
+    parallel: true
+    args: ["` + dir + `/dropped.txt", "payload"]
+  - command: update
+    parallel: true
+    depends_on: [drop]
+    when: drop == created
+    args: ["` + dir + `/dropped.txt", "updated payload"]
+  - command: delete
+    args: ["` + dir + `/dropped.txt"]
+`), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-labels=phase=2", "-vv", "playbook", playbookPath}
+	output, diagnostics := callMainWithDiagnostics(args)
+	assert.Contains(t, output, "Running 4 steps of stage beaconing in parallel...")
+	assert.Equal(t, 2, strings.Count(diagnostics, "together"))
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "5 of 5 steps completed")
+	assert.Equal(t, activityLogEntry.labels, "phase=2")
+	assert.False(t, fileExists(dir + "/dropped.txt"))
+
+	// The parallel steps' entries carry the stage's name, and a step that depends on another is run after it
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	activities := []string{}
+	for _, entry := range parsedLog.entries {
+		if entry.activity == "send" || entry.activity == "create" || entry.activity == "update" {
+			assert.Equal(t, "phase=2;stage=beaconing", entry.labels)
+		} else {
+			assert.Equal(t, "phase=2", entry.labels)
+		}
+		if entry.activity != "send" {
+			activities = append(activities, entry.activity)
+		}
+	}
+	assert.Equal(t, []string{"create", "update", "delete", "playbook"}, activities)
+}
+
+func TestMain_Playbook_NotEnoughArguments(t *testing.T) {
+	args := []string{"./noisemaker", "playbook"}
+	assertMainPanicsWithMessage(t, args, "not enough arguments for playbook! Args: []")
+}
+
+func TestParsePlaybook(t *testing.T) {
+	playbook, err := parsePlaybook([]byte(`{"name": "json", "steps": [{"command": "netenum"}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "json", playbook.Name)
+	assert.Equal(t, "netenum", playbook.Steps[0].Command)
+
+	_, err = parsePlaybook([]byte("name: empty\n"))
+	assert.ErrorContains(t, err, "no steps")
+	_, err = parsePlaybook([]byte("steps:\n  - args: [a]\n"))
+	assert.ErrorContains(t, err, "step 1 has no command")
+	_, err = parsePlaybook([]byte("steps:\n  - command: daemon\n"))
+	assert.ErrorContains(t, err, "step 1 can't run daemon from a playbook")
+	_, err = parsePlaybook([]byte("steps: [[["))
+	assert.ErrorContains(t, err, "invalid playbook")
+
+	// Variables and control flow
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    args: [\"${path}\"]\n"))
+	assert.ErrorContains(t, err, "step 1 uses undefined variable 'path'")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    args: [\"${index}\"]\n"))
+	assert.ErrorContains(t, err, "step 1 uses undefined variable 'index'")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    foreach: [a]\n    repeat: 2\n"))
+	assert.ErrorContains(t, err, "step 1 has both foreach and repeat")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    as: file\n"))
+	assert.ErrorContains(t, err, "step 1 has as, but no foreach")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    when: previous == created\n"))
+	assert.ErrorContains(t, err, "step 1 has a condition on the previous step, but it's the first step")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n  - command: delete\n    when: later == created\n"))
+	assert.ErrorContains(t, err, "step 2 has a condition on step 'later', but there's no step before it with that name")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n  - command: delete\n    when: previous is created\n"))
+	assert.ErrorContains(t, err, "step 2 has an invalid condition 'previous is created'")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    depends_on: [later]\n"))
+	assert.ErrorContains(t, err, "step 1 depends on step 'later', but there's no step before it with that name")
+	_, err = parsePlaybook([]byte("steps:\n  - name: a\n    command: create\n    parallel: true\n  - command: delete\n    parallel: true\n    when: a == created\n"))
+	assert.ErrorContains(t, err, "step 2 has a condition on step 'a', but runs in parallel with it (add it to depends_on)")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    parallel: true\n  - command: delete\n    when: previous == created\n"))
+	assert.ErrorContains(t, err, "step 2 has a condition on the previous step, but it's in or after a parallel stage (name the step instead)")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    parallel: true\n    stage: a\n  - command: delete\n    parallel: true\n    stage: b\n"))
+	assert.ErrorContains(t, err, "step 2 has stage 'b', but runs in parallel with stage 'a'")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    stage: a;b\n"))
+	assert.ErrorContains(t, err, "step 1 has an invalid stage 'a;b'")
+	_, err = parsePlaybook([]byte("vars:\n  ports: {a: b}\nsteps:\n  - command: create\n"))
+	assert.ErrorContains(t, err, "must be a value or a list of values")
+	_, err = parsePlaybook([]byte("on_unprivileged: ignore\nsteps:\n  - command: create\n"))
+	assert.ErrorContains(t, err, "invalid on_unprivileged 'ignore' (must be one of [fail skip])")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    on_error: ignore\n"))
+	assert.ErrorContains(t, err, "step 1 has an invalid on_error 'ignore' (must be one of [stop continue retry])")
+	_, err = parsePlaybook([]byte("steps:\n  - command: create\n    on_error: retry\n    retries: -1\n"))
+	assert.ErrorContains(t, err, "step 1 has an invalid retries -1 (must be 0 or more)")
+}
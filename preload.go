@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The environment variables execute -preload can launch its child with, each of which has the loader (or, for COR_PROFILER, the .NET
+// runtime) load a library into it: LD_PRELOAD on Linux, DYLD_INSERT_LIBRARIES on Mac, and COR_PROFILER on Windows
+var PreloadVariables = []string{"LD_PRELOAD", "DYLD_INSERT_LIBRARIES", "COR_PROFILER"}
+
+// The CLSID execute -preload=COR_PROFILER names as the profiler (nothing's registered as it, so the runtime just declines to load it)
+const PreloadProfilerCLSID = "{6e6f6973-656d-616b-6572-70726f66696c}"
+
+// Gets the benign library the variable points at by default: one the child has loaded anyway (libc or libSystem), or for COR_PROFILER,
+// a system DLL that isn't a profiler
+func getDefaultPreloadLibrary(variable string) string {
+	switch variable {
+	case "LD_PRELOAD":
+		return "libc.so.6"
+	case "DYLD_INSERT_LIBRARIES":
+		return "/usr/lib/libSystem.B.dylib"
+	default:
+		// COR_PROFILER
+		systemRoot := os.Getenv("SystemRoot")
+		if systemRoot == "" {
+			systemRoot = `C:\Windows`
+		}
+		return systemRoot + `\System32\kernel32.dll`
+	}
+}
+
+// Gets the environment variables that point the variable at the library (COR_PROFILER also needs profiling enabled, and the library
+// as its path)
+func getPreloadEnv(variable string, library string) []string {
+	if variable == "COR_PROFILER" {
+		return []string{"COR_ENABLE_PROFILING=1", "COR_PROFILER=" + PreloadProfilerCLSID, "COR_PROFILER_PATH=" + library}
+	}
+	return []string{variable + "=" + library}
+}
+
+// Validates execute's -preload variable, and gets its library (the default, unless one's given)
+func getPreloadLibrary(variable string, library string) (string, error) {
+	if !containsString(PreloadVariables, variable) {
+		return "", fmt.Errorf("invalid execute: invalid -preload %s (must be one of %s)", variable, strings.Join(PreloadVariables, ", "))
+	}
+	if library == "" {
+		library = getDefaultPreloadLibrary(variable)
+	}
+	return library, nil
+}
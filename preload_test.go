@@ -0,0 +1,34 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Execute_Preload(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh isn't available on Windows")
+	}
+
+	// The child's launched with the variable pointing at the library (and it's recorded)
+	callMain([]string{"./noisemaker", "-sink=stdout", "execute", "-preload=LD_PRELOAD", "-interpreter=sh", `test "$LD_PRELOAD" = libc.so.6 || exit 4`})
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	assert.Equal(t, activityLogEntry.details, `sh script block: test "$LD_PRELOAD" = libc.so.6 || exit 4\, env: LD_PRELOAD=libc.so.6`)
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "execute", "-preload=COR_PROFILER", "-preload-library=C:\\noisemaker.dll", "sh", "-c", `test "$COR_PROFILER_PATH" = 'C:\noisemaker.dll' || exit 4`})
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	assert.Equal(t, activityLogEntry.details, "env: COR_ENABLE_PROFILING=1 COR_PROFILER=" + PreloadProfilerCLSID + ` COR_PROFILER_PATH=C:\\noisemaker.dll`)
+}
+
+func TestParseExecuteOptions_Preload(t *testing.T) {
+	options, err := parseExecuteOptions([]string{"-preload=DYLD_INSERT_LIBRARIES", "/usr/bin/true"})
+	assert.Nil(t, err)
+	assert.Equal(t, &ExecuteOptions{preload: "DYLD_INSERT_LIBRARIES", preloadLibrary: "/usr/lib/libSystem.B.dylib", command: "/usr/bin/true", args: []string{}}, options)
+
+	_, err = parseExecuteOptions([]string{"-preload=LD_AUDIT", "id"})
+	assert.ErrorContains(t, err, "invalid execute: invalid -preload LD_AUDIT (must be one of LD_PRELOAD, DYLD_INSERT_LIBRARIES, COR_PROFILER)")
+	_, err = parseExecuteOptions([]string{"-preload-library=libc.so.6", "id"})
+	assert.ErrorContains(t, err, "invalid execute: -preload-library needs -preload")
+}
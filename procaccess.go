@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PROCESS_QUERY_LIMITED_INFORMATION | PROCESS_VM_READ, the access mask credential dumpers typically request
+const DefaultProcessAccessMask uint32 = 0x1010
+
+// Opens a handle to the target process (by name or pid) with the given access mask, reading nothing, and closes it again.
+// Returns the status, the resolved pid, and any error.
+func accessProcess(target string, accessMask uint32) (string, int, error) {
+	pid, err := strconv.Atoi(target)
+	if err != nil {
+		pid, err = findProcessId(target)
+		if err != nil {
+			return "not_found", 0, err
+		}
+	}
+
+	fmt.Printf("Opening process %s (pid %d) with access mask 0x%x...\n", target, pid, accessMask)
+	status, err := openProcessHandle(pid, accessMask)
+	return status, pid, err
+}
+
+// Parses an access mask like "0x1010" or "4112"
+func parseAccessMask(mask string) (uint32, error) {
+	mask = strings.ToLower(strings.TrimSpace(mask))
+	base := 10
+	if strings.HasPrefix(mask, "0x") {
+		mask = mask[2:]
+		base = 16
+	}
+	value, err := strconv.ParseUint(mask, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid access mask: %s", mask)
+	}
+	return uint32(value), nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Process handles are Windows-only
+func findProcessId(name string) (int, error) {
+	return 0, fmt.Errorf("looking up processes by name is not supported on %s", runtime.GOOS)
+}
+
+// Process handles are Windows-only
+func openProcessHandle(pid int, accessMask uint32) (string, error) {
+	return "unsupported", fmt.Errorf("opening process handles is not supported on %s", runtime.GOOS)
+}
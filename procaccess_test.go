@@ -0,0 +1,48 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_ProcAccess(t *testing.T) {
+	args := []string{"./noisemaker", "procaccess", "nonexistent-process.exe", "0x1410"}
+	output := callMain(args)
+	assert.Equal(t, activityLogEntry.activity, "procaccess")
+	assert.Equal(t, activityLogEntry.path, "nonexistent-process.exe")
+	assert.Equal(t, activityLogEntry.status, "not_found")
+	assert.Equal(t, activityLogEntry.details, "pid 0\\, access mask 0x1410")
+	if runtime.GOOS == "windows" {
+		assert.Contains(t, output, "no running process named nonexistent-process.exe")
+	}
+}
+
+func TestMain_ProcAccess_InvalidAccessMask(t *testing.T) {
+	args := []string{"./noisemaker", "procaccess", "lsass.exe", "PROCESS_ALL_ACCESS"}
+	assertMainPanicsWithMessage(t, args, "invalid access mask")
+}
+
+func TestAccessProcess_Unsupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process handles are supported on windows")
+	}
+	status, pid, err := accessProcess("1", DefaultProcessAccessMask)
+	assert.Equal(t, "unsupported", status)
+	assert.Equal(t, 1, pid)
+	assert.ErrorContains(t, err, "not supported on "+runtime.GOOS)
+}
+
+func TestParseAccessMask(t *testing.T) {
+	mask, err := parseAccessMask("0x1010")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0x1010), mask)
+
+	mask, err = parseAccessMask("4112")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0x1010), mask)
+
+	_, err = parseAccessMask("0x100000000")
+	assert.NotNil(t, err)
+}
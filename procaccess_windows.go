@@ -0,0 +1,42 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Finds the pid of the first running process with the given executable name (ie. "lsass.exe")
+func findProcessId(name string) (int, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		if strings.EqualFold(syscall.UTF16ToString(entry.ExeFile[:]), name) {
+			return int(entry.ProcessID), nil
+		}
+	}
+	return 0, fmt.Errorf("no running process named %s", name)
+}
+
+// Opens (and immediately closes) a handle to the given process with the given access mask
+func openProcessHandle(pid int, accessMask uint32) (string, error) {
+	handle, err := syscall.OpenProcess(accessMask, false, uint32(pid))
+	if err != nil {
+		if errors.Is(err, syscall.ERROR_ACCESS_DENIED) {
+			return "no_access", err
+		}
+		return "error", err
+	}
+	syscall.CloseHandle(handle)
+	return "opened", nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// The most bytes per second the sends' payloads are written at (0 for no limit), set by -rate-limit
+var rateLimit int64 = 0
+
+// How many chunks a second a rate-limited payload is written in (so it's shaped evenly, rather than sent in one burst each second)
+const RateLimitChunksPerSecond = 10
+
+// Parses a rate limit like 100KB/s (a size, optionally in KB, MB, GB, or TB, per second) into bytes per second (0 for no limit)
+func parseRateLimit(text string) (int64, error) {
+	if text == "" {
+		return 0, nil
+	}
+	size, err := parseSize(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(text)), "/S"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid -rate-limit '%s' (must be a size per second, ie. 100KB/s)", text)
+	}
+	return size, nil
+}
+
+// A reader that hands out what it wraps no faster than rate bytes per second, in small chunks, recording how long it took to be read
+type rateLimitedReader struct {
+	reader				io.Reader
+	rate				int64
+	start				time.Time
+	read				int64
+	elapsed				time.Duration	// how long it took to read everything (once it has been)
+}
+
+// Wraps the reader so it's read at no more than rate bytes per second
+func newRateLimitedReader(reader io.Reader, rate int64) *rateLimitedReader {
+	return &rateLimitedReader{reader: reader, rate: rate}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+
+	// Wait until what's been read so far is due, then hand out no more than a chunk
+	due := r.start.Add(time.Duration(float64(r.read) / float64(r.rate) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		if err := sleepContext(wait); err != nil {
+			return 0, err
+		}
+	}
+	chunk := r.rate / RateLimitChunksPerSecond
+	if chunk < 1 {
+		chunk = 1
+	}
+	if int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if err == io.EOF {
+		r.elapsed = time.Since(r.start)
+	}
+	return n, err
+}
+
+// Gets how long the reader's taken to be read (so far, if it hasn't been read to the end)
+func (r *rateLimitedReader) getElapsed() time.Duration {
+	if r.elapsed == 0 && !r.start.IsZero() {
+		return time.Since(r.start)
+	}
+	return r.elapsed
+}
+
+// Gets the rate limit and how long the payload took to transfer under it, for a send's details (or nothing, without -rate-limit)
+func getRateLimitDetails(response *MessageResponse) string {
+	if rateLimit == 0 {
+		return ""
+	}
+	return fmt.Sprintf("rate-limited to %s/s, transferred in %v", formatSize(rateLimit), response.duration.Round(time.Millisecond))
+}
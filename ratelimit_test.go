@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Send_RateLimit(t *testing.T) {
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = len(body)
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	// 2KB at 8KB/s takes a quarter of a second, and how long it took is logged
+	payload := strings.Repeat("a", 2048)
+	start := time.Now()
+	callMain([]string{"./noisemaker", "-sink=stdout", "-rate-limit=8KB/s", "send", "POST", host, port, "http", payload})
+	assert.GreaterOrEqual(t, time.Since(start), 200 * time.Millisecond)
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Greater(t, activityLogEntry.bytesSent, 2048)
+	assert.Equal(t, 2048, received)
+	assert.True(t, strings.HasPrefix(activityLogEntry.details, "rate-limited to 8KB/s\\, transferred in "), activityLogEntry.details)
+
+	// Without it, nothing's added
+	callMain([]string{"./noisemaker", "-sink=stdout", "send", "POST", host, port, "http", payload})
+	assert.Equal(t, activityLogEntry.details, "")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-rate-limit=fast", "send", "GET", host, port}, "invalid -rate-limit 'fast' (must be a size per second, ie. 100KB/s)")
+}
+
+func TestParseRateLimit(t *testing.T) {
+	for text, expected := range map[string]int64{"": 0, "100KB/s": 100 << 10, "1mb/s": 1 << 20, "512": 512, "0/s": 0} {
+		rate, err := parseRateLimit(text)
+		assert.Nil(t, err, text)
+		assert.Equal(t, expected, rate, text)
+	}
+	_, err := parseRateLimit("100KB/m")
+	assert.ErrorContains(t, err, "invalid -rate-limit '100KB/m'")
+}
+
+func TestRateLimitedReader(t *testing.T) {
+	// Everything's read, in chunks of no more than a tenth of the rate, taking as long as the rate says
+	reader := newRateLimitedReader(strings.NewReader(strings.Repeat("b", 100)), 500)
+	buffer := make([]byte, 64)
+	n, err := reader.Read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, 500 / RateLimitChunksPerSecond, n)
+	rest, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Len(t, rest, 50)
+	assert.GreaterOrEqual(t, reader.getElapsed(), 150 * time.Millisecond)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// The ways remote-exec can run a command on a remote Windows host: over WinRM (as winrs does), or by copying a payload over SMB and
+// running it as a service (as PsExec does)
+var RemoteExecMethods = []string{"winrm", "smb"}
+
+// The OSes each remote-exec method can be run from (winrs is Windows-only, and elsewhere SMB uses Samba's tools)
+var RemoteExecPlatforms = map[string][]string{"winrm": {"windows"}, "smb": {"windows", "linux", "darwin"}}
+
+// The port each remote-exec method connects to
+var RemoteExecPorts = map[string]int{"winrm": 5985, "smb": 445}
+
+// One of the native commands a remote execution is made of (ie. copying the payload, or creating the service)
+type RemoteExecStep struct {
+	name				string		// what the step does (ie. "copy-payload", or "create-service")
+	cmd					string		// the native command to run
+	args				[]string	// the args to the native command
+	redacted			string		// the command line to log, with any password redacted
+	undoes				string		// the step it undoes, which it's still run after a failure to clean up after (if that step completed)
+	exitCodes			[]int		// the exit codes besides 0 that count as the step completing
+}
+
+// Response data from remote-exec action
+type RemoteExecResponse struct {
+	completed			int
+	failed				int
+	status				string
+}
+
+// The credentials given with -remote-user and -remote-password (with none, the current user's are used, where the OS can)
+type RemoteCredentials struct {
+	user				string
+	password			string
+}
+
+// Gets the native commands to run the command on the host with the given method, from an OS of goos: the payload (a batch file, at
+// payloadPath) is what's copied over SMB, and service is the name the service (and the copied payload) is created with
+func getRemoteExecSteps(goos string, method string, host string, credentials RemoteCredentials, command string, payloadPath string, service string) ([]*RemoteExecStep, error) {
+	if credentials.user != "" && credentials.password == "" {
+		return nil, fmt.Errorf("-remote-user %s needs a -remote-password", credentials.user)
+	}
+	steps := []*RemoteExecStep{}
+	secrets := map[string]string{}
+	secret := func(arg string, shown string) string {
+		secrets[arg] = shown
+		return arg
+	}
+	addStep := func(name string, undoes string, cmd string, args ...string) *RemoteExecStep {
+		step := &RemoteExecStep{name: name, undoes: undoes, cmd: cmd, args: args}
+		shown := []string{cmd}
+		for _, arg := range args {
+			if redacted, found := secrets[arg]; found {
+				arg = redacted
+			}
+			shown = append(shown, arg)
+		}
+		step.redacted = strings.Join(shown, " ")
+		steps = append(steps, step)
+		return step
+	}
+	remotePayload := `Temp\` + service + ".bat"
+	binPath := `cmd.exe /c %SystemRoot%\` + remotePayload
+
+	switch goos + "/" + method {
+	case "windows/winrm":
+		args := []string{"-r:http://" + host + ":5985/wsman"}
+		if credentials.user != "" {
+			args = append(args, "-u:" + credentials.user, secret("-p:" + credentials.password, "-p:********"))
+		}
+		addStep("exec", "", "winrs", append(args, command)...)
+	case "windows/smb":
+		share := `\\` + host + `\ADMIN$`
+		if credentials.user != "" {
+			addStep("connect", "", "net", "use", `\\` + host + `\IPC$`, secret(credentials.password, "********"), "/user:" + credentials.user, "/persistent:no")
+		}
+		addStep("copy-payload", "", "cmd", "/c", "copy", "/Y", payloadPath, share + `\` + remotePayload)
+		addStep("create-service", "", "sc.exe", `\\` + host, "create", service, "binPath=", binPath, "start=", "demand")
+		// (cmd.exe never answers the service manager, so the service "fails" to start with 1053 once it's run the payload)
+		addStep("start-service", "", "sc.exe", `\\` + host, "start", service).exitCodes = []int{1053}
+		addStep("delete-service", "create-service", "sc.exe", `\\` + host, "delete", service)
+		addStep("delete-payload", "copy-payload", "cmd", "/c", "del", share + `\` + remotePayload)
+		if credentials.user != "" {
+			addStep("disconnect", "connect", "net", "use", `\\` + host + `\IPC$`, "/delete")
+		}
+	case "darwin/smb", "linux/smb":
+		// (with Samba's smbclient and net, which need an account to authenticate as)
+		if credentials.user == "" {
+			return nil, fmt.Errorf("remote-exec over smb needs -remote-user and -remote-password on %s", goos)
+		}
+		account := secret(credentials.user + "%" + credentials.password, credentials.user + "%********")
+		addStep("copy-payload", "", "smbclient", "//" + host + "/ADMIN$", "-U", account, "-c", "put " + payloadPath + " " + remotePayload)
+		addStep("create-service", "", "net", "rpc", "service", "create", service, service, binPath, "-I", host, "-U", account)
+		addStep("start-service", "", "net", "rpc", "service", "start", service, "-I", host, "-U", account)
+		addStep("delete-service", "create-service", "net", "rpc", "service", "delete", service, "-I", host, "-U", account)
+		addStep("delete-payload", "copy-payload", "smbclient", "//" + host + "/ADMIN$", "-U", account, "-c", "del " + remotePayload)
+	default:
+		return nil, fmt.Errorf("remote-exec over %s is not supported on %s", method, goos)
+	}
+	return steps, nil
+}
+
+// Writes the payload copied over SMB: a batch file that runs the command (the caller removes it)
+func writeRemoteExecPayload(path string, command string) error {
+	return os.WriteFile(path, []byte("@echo off\r\n" + command + "\r\n"), 0600)
+}
+
+// Runs each of the steps in turn, as part of the parent's run, logging each as its own entry (with the step as its method) sharing the
+// parent's correlation ID. After a step fails, the rest are skipped, except the ones that clean up after a step that completed (ie.
+// deleting the service it created).
+func runRemoteExecSteps(activityLog Sink, parent *ActivityLogEntry, steps []*RemoteExecStep) *RemoteExecResponse {
+	response := new(RemoteExecResponse)
+	completed := []string{}
+	for _, step := range steps {
+		if response.failed > 0 && !containsString(completed, step.undoes) {
+			continue
+		}
+		entry := newChildLogEntry(parent, "remote-exec")
+		entry.processCmd = escapeRawText(step.redacted)
+		entry.method = step.name
+		entry.destAddr = parent.destAddr
+		entry.destPort = parent.destPort
+		entry.protocol = parent.protocol
+
+		fmt.Printf("Running %s (%s)...\n", step.redacted, step.name)
+		output, err := exec.CommandContext(runContext, step.cmd, step.args...).CombinedOutput()
+		if len(output) > 0 {
+			fmt.Printf("%s\n", strings.TrimSpace(string(output)))
+		}
+		entry.bytesReceived = len(output)
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			entry.status = exitErr.ProcessState.String()
+			if slices.Contains(step.exitCodes, exitErr.ExitCode()) {
+				err = nil
+			}
+		} else if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			entry.status = "unable_to_run"
+		} else {
+			entry.status = "exit status 0"
+		}
+		writeLogEntry(activityLog, entry)
+		if err != nil {
+			response.failed += 1
+			continue
+		}
+		response.completed += 1
+		completed = append(completed, step.name)
+	}
+
+	if response.failed == 0 {
+		response.status = "completed"
+	} else {
+		response.status = "error"
+	}
+	return response
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The names of the steps, and the command lines they're logged with
+func getTestRemoteExecSteps(steps []*RemoteExecStep) ([]string, []string) {
+	names := []string{}
+	commands := []string{}
+	for _, step := range steps {
+		names = append(names, step.name)
+		commands = append(commands, step.redacted)
+	}
+	return names, commands
+}
+
+func TestGetRemoteExecSteps(t *testing.T) {
+	credentials := RemoteCredentials{user: `LAB\admin`, password: "hunter2"}
+
+	// PsExec-style (with the password never logged)
+	steps, err := getRemoteExecSteps("windows", "smb", "10.0.0.5", credentials, "whoami", `C:\Temp\noisemaker-1a2b3c4d.bat`, "noisemaker-1a2b3c4d")
+	assert.Nil(t, err)
+	names, commands := getTestRemoteExecSteps(steps)
+	assert.Equal(t, []string{"connect", "copy-payload", "create-service", "start-service", "delete-service", "delete-payload", "disconnect"}, names)
+	assert.Equal(t, `net use \\10.0.0.5\IPC$ ******** /user:LAB\admin /persistent:no`, commands[0])
+	assert.Equal(t, `cmd /c copy /Y C:\Temp\noisemaker-1a2b3c4d.bat \\10.0.0.5\ADMIN$\Temp\noisemaker-1a2b3c4d.bat`, commands[1])
+	assert.Equal(t, `sc.exe \\10.0.0.5 create noisemaker-1a2b3c4d binPath= cmd.exe /c %SystemRoot%\Temp\noisemaker-1a2b3c4d.bat start= demand`, commands[2])
+	assert.Equal(t, "hunter2", steps[0].args[2])
+	assert.Equal(t, "create-service", steps[4].undoes)
+	assert.Equal(t, []int{1053}, steps[3].exitCodes)
+
+	// With Samba's tools, and over WinRM
+	steps, err = getRemoteExecSteps("linux", "smb", "10.0.0.5", credentials, "whoami", "/tmp/noisemaker-1a2b3c4d.bat", "noisemaker-1a2b3c4d")
+	assert.Nil(t, err)
+	names, commands = getTestRemoteExecSteps(steps)
+	assert.Equal(t, []string{"copy-payload", "create-service", "start-service", "delete-service", "delete-payload"}, names)
+	assert.Equal(t, `smbclient //10.0.0.5/ADMIN$ -U LAB\admin%******** -c put /tmp/noisemaker-1a2b3c4d.bat Temp\noisemaker-1a2b3c4d.bat`, commands[0])
+	steps, err = getRemoteExecSteps("windows", "winrm", "10.0.0.5", credentials, "whoami /all", "", "")
+	assert.Nil(t, err)
+	_, commands = getTestRemoteExecSteps(steps)
+	assert.Equal(t, []string{`winrs -r:http://10.0.0.5:5985/wsman -u:LAB\admin -p:******** whoami /all`}, commands)
+	steps, err = getRemoteExecSteps("windows", "winrm", "10.0.0.5", RemoteCredentials{}, "whoami", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-r:http://10.0.0.5:5985/wsman", "whoami"}, steps[0].args)
+
+	_, err = getRemoteExecSteps("linux", "smb", "10.0.0.5", RemoteCredentials{}, "whoami", "/tmp/payload.bat", "service")
+	assert.ErrorContains(t, err, "remote-exec over smb needs -remote-user and -remote-password on linux")
+	_, err = getRemoteExecSteps("windows", "smb", "10.0.0.5", RemoteCredentials{user: "admin"}, "whoami", "/tmp/payload.bat", "service")
+	assert.ErrorContains(t, err, "-remote-user admin needs a -remote-password")
+	_, err = getRemoteExecSteps("linux", "winrm", "10.0.0.5", credentials, "whoami", "", "")
+	assert.ErrorContains(t, err, "remote-exec over winrm is not supported on linux")
+}
+
+func TestRunRemoteExecSteps(t *testing.T) {
+	recorder := newRunRecorderSink()
+	parent := newActivityLogEntry("remote-exec", nil)
+	parent.runId = "remote-run"
+	parent.destAddr = "10.0.0.5"
+	parent.protocol = "smb"
+	step := func(name string, undoes string, args ...string) *RemoteExecStep {
+		return &RemoteExecStep{name: name, undoes: undoes, cmd: "go", args: args, redacted: name}
+	}
+
+	// After a step fails, only the steps that undo what's been done are run
+	steps := []*RemoteExecStep{
+		step("copy-payload", "", "version"),
+		step("create-service", "", "no-such-command"),
+		step("start-service", "", "version"),
+		step("delete-service", "create-service", "version"),
+		step("delete-payload", "copy-payload", "version"),
+	}
+	response := runRemoteExecSteps(recorder, parent, steps)
+	assert.Equal(t, "error", response.status)
+	assert.Equal(t, 2, response.completed)
+	assert.Equal(t, 1, response.failed)
+	entries := recorder.getEntries("remote-run")
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "remote-exec", entries[0].activity)
+	assert.Equal(t, "copy-payload", entries[0].method)
+	assert.Equal(t, "exit status 0", entries[0].status)
+	assert.Equal(t, "10.0.0.5", entries[0].destAddr)
+	assert.Equal(t, "smb", entries[0].protocol)
+	assert.Equal(t, "exit status 2", entries[1].status)
+	assert.Equal(t, "delete-payload", entries[2].method)
+
+	// Exit codes the step expects count as it completing
+	steps = []*RemoteExecStep{step("start-service", "", "no-such-command")}
+	steps[0].exitCodes = []int{2}
+	response = runRemoteExecSteps(recorder, parent, steps)
+	assert.Equal(t, "completed", response.status)
+}
+
+func TestMain_RemoteExec(t *testing.T) {
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "remote-exec", "rdp", "10.0.0.5", "whoami"}, "invalid method for remote-exec: rdp (must be one of [winrm smb])")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "remote-exec", "smb", "10.0.0.5"}, "not enough arguments for remote-exec! Args: [smb 10.0.0.5]")
+	if runtime.GOOS == "windows" {
+		t.Skip("winrm is supported on Windows")
+	}
+	callMain([]string{"./noisemaker", "-sink=stdout", "remote-exec", "winrm", "10.0.0.5", "whoami"})
+	assert.Equal(t, activityLogEntry.status, "unsupported")
+	assert.Equal(t, activityLogEntry.method, "winrm")
+	assert.Equal(t, activityLogEntry.destPort, 5985)
+}
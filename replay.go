@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Commands that aren't replayed: the ones that manage other runs or logs, and playbooks, scenarios, generate, and fuzz (their steps
+// are replayed instead)
+var NonReplayCommands = []string{"playbook", "scenario", "script", "generate", "fuzz", "daemon", "control", "collect", "migrate-log", "verify", "log", "replay", "compare", "verify-signatures", "decrypt-log", "cleanup", "help"}
+
+// Commands whose own entries run processes that are logged as execute entries of their own (sharing its correlation ID), which
+// replaying the command runs again
+var ProcessRunningCommands = []string{"dropper", "download", "lolbin"}
+
+// Which entries of a log to replay, and how fast
+type ReplayOptions struct {
+	LogFilter
+	path				string
+	speed				float64
+}
+
+// A command recorded in an activity log, to be run again
+type ReplayStep struct {
+	command				string
+	args				[]string
+	timestamp			time.Time			// zero if it wasn't recorded properly
+}
+
+// Response data from replay action
+type ReplayResponse struct {
+	steps				int
+	completed			int
+	failed				int
+	status				string
+}
+
+// Parses the filters (the same as log query's) and speed of a replay (ie. --speed=2 --run-id=...), followed by the log to replay
+func parseReplayOptions(args []string) (*ReplayOptions, error) {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	filterFlags := addLogFilterFlags(flags)
+	speed := flags.Float64("speed", 1, "how many times faster than recorded to replay, ie. 2 for twice as fast, or 0.5 for half as fast (default 1)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replay: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for replay! Args: %v", args)
+	}
+
+	options := &ReplayOptions{path: flags.Arg(0), speed: *speed}
+	options.LogFilter, err = filterFlags.parse(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if options.speed <= 0 {
+		return nil, fmt.Errorf("invalid speed %v (must be more than 0)", options.speed)
+	}
+	return options, nil
+}
+
+// Reads the commands to replay out of the log. Entries logged as part of another command (ie. exfil's stage and send, the script
+// dropper runs, or a chunked send's chunks) are left out, since replaying the command they're part of logs them again.
+func loadReplaySteps(options *ReplayOptions) ([]*ReplayStep, error) {
+	parsedLog, err := readLog(options.path)
+	if err != nil {
+		return nil, err
+	}
+	composed := map[string]bool{}
+	parents := map[string]*ActivityLogEntry{}
+	for _, entry := range parsedLog.entries {
+		if containsString(ProcessRunningCommands, unescapeRawText(entry.activity)) && entry.correlationId != "" {
+			composed[entry.correlationId] = true
+		}
+		if entry.correlationId != "" {
+			// (a composite command's own entry is written after its parts)
+			parents[entry.correlationId] = entry
+		}
+	}
+	steps := []*ReplayStep{}
+	for _, entry := range parsedLog.entries {
+		if !options.matches(entry) || (entry.activity == "execute" && composed[entry.correlationId]) {
+			continue
+		}
+		if parent := parents[entry.correlationId]; parent != nil && parent != entry && parent.activity == entry.activity {
+			continue
+		}
+		step := parseReplayStep(entry)
+		if step != nil {
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// Works out the command an entry was logged for, from its processCmd (or nil, if it shouldn't be replayed)
+func parseReplayStep(entry *ActivityLogEntry) *ReplayStep {
+	activity := unescapeRawText(entry.activity)
+	if activity == "" || containsString(NonReplayCommands, activity) {
+		return nil
+	}
+	cmd := strings.TrimSuffix(unescapeRawText(entry.processCmd), " ")
+	if cmd == "" {
+		return nil
+	}
+
+	// The args were joined with spaces (and executed processes are recorded without the "execute")
+	fields := strings.Split(cmd, " ")
+	step := &ReplayStep{command: activity}
+	if activity == "execute" {
+		step.args = fields
+	} else if fields[0] == activity {
+		step.args = fields[1:]
+	} else {
+		// It's part of another command's activity
+		return nil
+	}
+	step.timestamp, _ = time.Parse(time.RFC3339, entry.timestamp)
+	return step
+}
+
+// Runs each of the steps again in order, as part of the parent's run, waiting between them as long as was recorded
+// between them (divided by speed). Failed steps are logged (with why), and the rest are still replayed.
+func runReplay(activityLog Sink, parent *ActivityLogEntry, steps []*ReplayStep, speed float64) *ReplayResponse {
+	response := &ReplayResponse{steps: len(steps)}
+	for i, step := range steps {
+		if i > 0 && !step.timestamp.IsZero() && !steps[i - 1].timestamp.IsZero() {
+			delay := time.Duration(float64(step.timestamp.Sub(steps[i - 1].timestamp)) / speed)
+			if delay > 0 && sleepContext(delay) != nil {
+				break
+			}
+		}
+		fmt.Printf("Replaying step %d of %d (%s)...\n", i + 1, len(steps), strings.TrimSpace(step.command + " " + strings.Join(step.args, " ")))
+
+		entry := newChildLogEntry(parent, step.command)
+		entry.processCmd = escapeCommandString(step.command, step.args)
+		err := runCommandSafely(activityLog, entry, step.command, step.args)
+		if err != nil {
+			fmt.Printf("Step %d (%s) failed: %v\n", i + 1, step.command, err)
+			response.failed += 1
+			continue
+		}
+		response.completed += 1
+	}
+
+	if response.failed == 0 {
+		response.status = "completed"
+	} else if response.completed > 0 {
+		response.status = "partial"
+	} else {
+		response.status = "error"
+	}
+	fmt.Printf("Replayed %d of %d steps\n", response.completed, len(steps))
+	return response
+}
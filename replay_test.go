@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Replay(t *testing.T) {
+	dir := t.TempDir()
+	recordedLogPath := dir + "/recorded-log.csv"
+	callMain([]string{"./noisemaker", "-logfile=" + recordedLogPath, "create", dir + "/dropped.txt", "payload"})
+	callMain([]string{"./noisemaker", "-logfile=" + recordedLogPath, "delete", dir + "/dropped.txt"})
+	callMain([]string{"./noisemaker", "-logfile=" + recordedLogPath, "verify"})
+	assert.False(t, fileExists(dir + "/dropped.txt"))
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "-run-id=replay-run", "replay", "--speed=100", recordedLogPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Replaying step 1 of 2 (create " + dir + "/dropped.txt payload)...")
+	assert.Contains(t, output, "Replaying step 2 of 2 (delete " + dir + "/dropped.txt)...")
+	assert.Equal(t, activityLogEntry.activity, "replay")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "2 of 2 steps replayed (at 100x speed)")
+
+	// The replayed commands are logged as part of the replay's run, in order
+	assert.Equal(t, []string{"replay-run,1", "replay-run,2", "replay-run,3"}, readTestRunIdsAndSeqs(t, dir + "/activity-log.csv"))
+	assertLogFileContains(t, dir + "/activity-log.csv", ",created,")
+	assertLogFileContains(t, dir + "/activity-log.csv", ",deleted,")
+}
+
+func TestMain_Replay_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "replay", dir + "/nonexistent-log.csv"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "not_found")
+}
+
+func TestMain_Replay_NotEnoughArguments(t *testing.T) {
+	args := []string{"./noisemaker", "replay", "--speed=2"}
+	assertMainPanicsWithMessage(t, args, "not enough arguments for replay! Args: [--speed=2]")
+}
+
+func TestParseReplayStep(t *testing.T) {
+	// Executed processes are recorded without the "execute"
+	step := parseReplayStep(&ActivityLogEntry{activity: "execute", processCmd: "ls -la /tmp", timestamp: "2024-11-05T12:00:00Z"})
+	assert.Equal(t, "execute", step.command)
+	assert.Equal(t, []string{"ls", "-la", "/tmp"}, step.args)
+	assert.Equal(t, "2024-11-05T12:00:00Z", step.timestamp.Format(time.RFC3339))
+
+	step = parseReplayStep(&ActivityLogEntry{activity: "send", processCmd: escapeCommandString("send", []string{"POST", "www.postman-echo.com/post", "443", "https", "a,b"})})
+	assert.Equal(t, []string{"POST", "www.postman-echo.com/post", "443", "https", "a,b"}, step.args)
+	assert.True(t, step.timestamp.IsZero())
+
+	// Entries logged as part of another command aren't replayed, and neither are playbooks (or commands without args)
+	assert.Nil(t, parseReplayStep(&ActivityLogEntry{activity: "stage", processCmd: "exfil /tmp/secrets www.postman-echo.com/post https"}))
+	assert.Nil(t, parseReplayStep(&ActivityLogEntry{activity: "playbook", processCmd: "playbook playbook.yaml"}))
+	step = parseReplayStep(&ActivityLogEntry{activity: "discover", processCmd: escapeCommandString("discover", []string{})})
+	assert.Equal(t, []string{}, step.args)
+}
+
+func TestRunReplay_Timing(t *testing.T) {
+	// Recorded two seconds apart, replayed at 10x
+	dir := t.TempDir()
+	contents := getCSVFileHeader()
+	for i, timestamp := range []string{"2024-11-05T12:00:00Z", "2024-11-05T12:00:02Z"} {
+		entry := &ActivityLogEntry{timestamp: timestamp, activity: "create", status: "created", processCmd: escapeCommandString("create", []string{dir + "/test" + string(rune('1' + i)) + ".txt"})}
+		contents += strings.Join(serializeToCSV(entry), ",") + "\n"
+	}
+	os.WriteFile(dir + "/recorded-log.csv", []byte(contents), 0644)
+	options, err := parseReplayOptions([]string{"--speed=10", dir + "/recorded-log.csv"})
+	assert.Nil(t, err)
+	steps, err := loadReplaySteps(options)
+	assert.Nil(t, err)
+	assert.Len(t, steps, 2)
+
+	sink, _ := newCSVFileSink(dir + "/activity-log.csv", false)
+	defer sink.Close()
+	started := time.Now()
+	response := runReplay(sink, &ActivityLogEntry{runId: "replay-run"}, steps, options.speed)
+	assert.Equal(t, "completed", response.status)
+	assert.GreaterOrEqual(t, time.Since(started), 200 * time.Millisecond)
+	assert.True(t, fileExists(dir + "/test2.txt"))
+}
+
+func TestParseReplayOptions_Invalid(t *testing.T) {
+	_, err := parseReplayOptions([]string{"--speed=0", "activity-log.csv"})
+	assert.ErrorContains(t, err, "invalid speed 0 (must be more than 0)")
+	_, err = parseReplayOptions([]string{"--until=tomorrow", "activity-log.csv"})
+	assert.ErrorContains(t, err, "invalid until 'tomorrow'")
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"sync"
+)
+
+// Commands that -as-user applies to: they're performed as the other account, and their entries record it as the username
+var RunAsCommands = []string{"execute", "create", "update", "delete", "read", "dropper", "download"}
+
+// The environment variable the -as-user account's password is read from, on Windows (which has to log the account on)
+const RunAsPasswordEnv = "NOISEMAKER_AS_USER_PASSWORD"
+
+// Guards impersonating the -as-user account for file actions, since it changes who the whole process is acting as, for the moment
+var runAsMutex sync.Mutex
+
+// Performs the file action as the account (or as ourselves, if it's nil), returning its status
+func (runAs *RunAsUser) do(action func() (string, error)) (string, error) {
+	if runAs == nil {
+		return action()
+	}
+	runAsMutex.Lock()
+	defer runAsMutex.Unlock()
+	return runAs.impersonate(action)
+}
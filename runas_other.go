@@ -0,0 +1,98 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// A local account that actions are performed as (with -as-user)
+type RunAsUser struct {
+	name				string
+	uid					uint32
+	gid					uint32
+	groups				[]uint32
+}
+
+// Looks up the local account to perform actions as
+func lookupRunAsUser(name string) (*RunAsUser, error) {
+	account, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	runAs := &RunAsUser{name: account.Username}
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported uid %s", account.Uid)
+	}
+	gid, err := strconv.ParseUint(account.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported gid %s", account.Gid)
+	}
+	runAs.uid, runAs.gid = uint32(uid), uint32(gid)
+	groupIds, _ := account.GroupIds()
+	for _, groupId := range groupIds {
+		group, err := strconv.ParseUint(groupId, 10, 32)
+		if err == nil {
+			runAs.groups = append(runAs.groups, uint32(group))
+		}
+	}
+	return runAs, nil
+}
+
+// Sets up the process to be started as the account: as root, by setting its credentials (as setuid would), and otherwise by starting
+// it with sudo (which has to be allowed without a password). Returns the path and args to start instead.
+func (runAs *RunAsUser) prepareProcess(path string, args []string, procAttr *os.ProcAttr) (string, []string, error) {
+	if os.Geteuid() == 0 {
+		procAttr.Sys = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: runAs.uid, Gid: runAs.gid, Groups: runAs.groups}}
+		return path, args, nil
+	}
+	sudo, err := exec.LookPath("sudo")
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to run as %s without root or sudo: %v", runAs.name, err)
+	}
+	return sudo, append([]string{sudo, "-n", "-u", runAs.name, "--"}, args...), nil
+}
+
+// Performs the file action with the account's effective user and groups, then switches back (only root can switch to them)
+func (runAs *RunAsUser) impersonate(action func() (string, error)) (string, error) {
+	if os.Geteuid() != 0 {
+		fmt.Printf("Unable to act as %s: file actions can only be performed as another user when running as root\n", runAs.name)
+		return "no_access", fmt.Errorf("not running as root")
+	}
+	groups, err := syscall.Getgroups()
+	if err != nil {
+		return "error", err
+	}
+	egid := syscall.Getegid()
+	userGroups := []int{}
+	for _, group := range runAs.groups {
+		userGroups = append(userGroups, int(group))
+	}
+	defer func() {
+		// (back to root first, since only root can set the groups back)
+		check(syscall.Seteuid(0))
+		check(syscall.Setegid(egid))
+		check(syscall.Setgroups(groups))
+	}()
+	err = syscall.Setgroups(userGroups)
+	if err == nil {
+		err = syscall.Setegid(int(runAs.gid))
+	}
+	if err == nil {
+		err = syscall.Seteuid(int(runAs.uid))
+	}
+	if err != nil {
+		return "error", fmt.Errorf("unable to act as %s: %v", runAs.name, err)
+	}
+	return action()
+}
+
+// Releases the account (there's nothing to release, outside of Windows)
+func (runAs *RunAsUser) close() {
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_AsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("acting as another user needs root")
+	}
+	account, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody account to act as")
+	}
+	dir := t.TempDir()
+	os.Chmod(filepath.Dir(dir), 0755)
+	os.Chmod(dir, 0777)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// The file's created by the other account, and its entry records it as the username
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-as-user=nobody", "create", dir + "/dropped.txt", "payload"})
+	assert.Equal(t, activityLogEntry.status, "created")
+	assert.Equal(t, activityLogEntry.username, "nobody")
+	info, err := os.Stat(dir + "/dropped.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, account.Uid, strconv.Itoa(int(info.Sys().(*syscall.Stat_t).Uid)))
+	assert.Equal(t, 0, os.Geteuid())
+
+	// And it's refused what the account can't do (and we can still do afterwards)
+	os.WriteFile(dir + "/root-only.txt", []byte("secret"), 0600)
+	os.Chmod(dir, 0755)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-as-user=nobody", "delete", dir + "/root-only.txt"})
+	assert.Equal(t, activityLogEntry.status, "error")
+	assert.True(t, fileExists(dir + "/root-only.txt"))
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "delete", dir + "/root-only.txt"})
+	assert.Equal(t, activityLogEntry.status, "deleted")
+
+	// Processes run as the account too
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-as-user=nobody", "execute", "sh", "-c", "test $(id -u) = " + account.Uid})
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	assert.Equal(t, activityLogEntry.username, "nobody")
+}
+
+func TestMain_AsUser_Unknown(t *testing.T) {
+	dir := t.TempDir()
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "-as-user=noisemaker-no-such-user", "create", dir + "/dropped.txt"}, "invalid -as-user noisemaker-no-such-user: user: unknown user noisemaker-no-such-user")
+	assert.False(t, fileExists(dir + "/dropped.txt"))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// A local account that actions are performed as (with -as-user), logged on with its password
+type RunAsUser struct {
+	name				string
+	token				windows.Token
+}
+
+var advapi32 = windows.NewLazySystemDLL("advapi32.dll")
+var procLogonUserW = advapi32.NewProc("LogonUserW")
+var procImpersonateLoggedOnUser = advapi32.NewProc("ImpersonateLoggedOnUser")
+
+const (
+	LOGON32_LOGON_INTERACTIVE = 2
+	LOGON32_PROVIDER_DEFAULT = 0
+)
+
+// Logs the account on (as DOMAIN\name, or a local account's name) with the password in NOISEMAKER_AS_USER_PASSWORD, the way
+// CreateProcessWithLogonW would, keeping its token to start processes and perform file actions with
+func lookupRunAsUser(name string) (*RunAsUser, error) {
+	domain, account := ".", name
+	if before, after, found := strings.Cut(name, `\`); found {
+		domain, account = before, after
+	}
+	accountPtr, err := windows.UTF16PtrFromString(account)
+	if err != nil {
+		return nil, err
+	}
+	domainPtr, err := windows.UTF16PtrFromString(domain)
+	if err != nil {
+		return nil, err
+	}
+	passwordPtr, err := windows.UTF16PtrFromString(os.Getenv(RunAsPasswordEnv))
+	if err != nil {
+		return nil, err
+	}
+	var token windows.Token
+	result, _, err := procLogonUserW.Call(uintptr(unsafe.Pointer(accountPtr)), uintptr(unsafe.Pointer(domainPtr)), uintptr(unsafe.Pointer(passwordPtr)),
+		LOGON32_LOGON_INTERACTIVE, LOGON32_PROVIDER_DEFAULT, uintptr(unsafe.Pointer(&token)))
+	if result == 0 {
+		return nil, fmt.Errorf("unable to log on as %s (with the password in %s): %v", name, RunAsPasswordEnv, err)
+	}
+	return &RunAsUser{name: name, token: token}, nil
+}
+
+// Sets up the process to be started with the account's token (with CreateProcessAsUser)
+func (runAs *RunAsUser) prepareProcess(path string, args []string, procAttr *os.ProcAttr) (string, []string, error) {
+	procAttr.Sys = &syscall.SysProcAttr{Token: syscall.Token(runAs.token)}
+	return path, args, nil
+}
+
+// Performs the file action with this thread impersonating the account, then reverts to our own token
+func (runAs *RunAsUser) impersonate(action func() (string, error)) (string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	result, _, err := procImpersonateLoggedOnUser.Call(uintptr(runAs.token))
+	if result == 0 {
+		return "error", fmt.Errorf("unable to act as %s: %v", runAs.name, err)
+	}
+	defer windows.RevertToSelf()
+	return action()
+}
+
+// Closes the account's token
+func (runAs *RunAsUser) close() {
+	runAs.token.Close()
+}
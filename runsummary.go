@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The entries logged about a run itself, rather than anything it did (so they aren't counted in its run-end entry)
+var RunSummaryActivities = []string{"run-start", "run-end", "heartbeat"}
+
+// Tracks a run's entries for its run-start, heartbeat, and run-end entries, so downstream consumers can tell a run that finished from
+// one whose host died partway through (which has no run-end)
+type RunSummary struct {
+	parent				*ActivityLogEntry
+	started				time.Time
+	entries				int				// the entries the run's logged, besides the summary's own
+	failed				int				// how many of them have a failure status
+	cancelled			int
+	ended				bool
+	mutex				sync.Mutex
+}
+
+// The run's summary, with -run-summary or -heartbeat (nil otherwise)
+var runSummary *RunSummary
+
+// Starts tracking the parent's run: with -run-summary, logs its run-start entry, and with a heartbeat interval, logs a heartbeat entry
+// every interval until the returned function's called
+func startRunSummary(activityLog Sink, parent *ActivityLogEntry, logStartAndEnd bool, heartbeat time.Duration) (*RunSummary, func()) {
+	summary := &RunSummary{parent: parent, started: time.Now()}
+	if logStartAndEnd {
+		entry := newChildLogEntry(parent, "run-start")
+		entry.status = "started"
+		entry.details = escapeRawText(fmt.Sprintf("pid %d", parent.processId))
+		writeLogEntry(activityLog, entry)
+	} else {
+		// (without -run-summary, there's no run-end entry to write)
+		summary.ended = true
+	}
+	if heartbeat <= 0 {
+		return summary, func() {}
+	}
+
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				entry := newChildLogEntry(parent, "heartbeat")
+				entry.status = "running"
+				entry.details = escapeRawText(summary.getDetails("running for"))
+				writeLogEntry(activityLog, entry)
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	return summary, func() {
+		close(stopped)
+		<-done
+	}
+}
+
+// Counts one of the run's entries (called as it's written)
+func (summary *RunSummary) count(entry *ActivityLogEntry) {
+	if entry.runId != summary.parent.runId || containsString(RunSummaryActivities, entry.activity) {
+		return
+	}
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.entries++
+	if isFailureStatus(unescapeRawText(entry.status)) {
+		summary.failed++
+	} else if entry.status == "cancelled" {
+		summary.cancelled++
+	}
+}
+
+// Describes how long the run's taken so far, and the entries it's logged, ie. "ran for 2m0s, 12 entries (1 failed, 0 cancelled)"
+func (summary *RunSummary) getDetails(took string) string {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	return fmt.Sprintf("%s %v, %d entries (%d failed, %d cancelled)", took, time.Since(summary.started).Round(time.Millisecond), summary.entries, summary.failed, summary.cancelled)
+}
+
+// Logs the run's run-end entry with how it ended ([completed, error, interrupted, cancelled]), if it hasn't been already (ie. by a
+// shutdown signal, before the command itself returned)
+func (summary *RunSummary) end(activityLog Sink, status string, reason string) {
+	summary.mutex.Lock()
+	if summary.ended {
+		summary.mutex.Unlock()
+		return
+	}
+	summary.ended = true
+	summary.mutex.Unlock()
+
+	entry := newChildLogEntry(summary.parent, "run-end")
+	entry.status = status
+	details := summary.getDetails("ran for")
+	if reason != "" {
+		details += ", " + reason
+	}
+	entry.details = escapeRawText(details)
+	writeLogEntry(activityLog, entry)
+}
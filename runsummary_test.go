@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_RunSummary(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// The run's entries are bracketed by its run-start and run-end
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-run-summary", "read", dir + "/missing.txt"})
+	assert.Equal(t, "read", activityLogEntry.activity)
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 3)
+	start, end := parsedLog.entries[0], parsedLog.entries[2]
+	assert.Equal(t, "run-start", start.activity)
+	assert.Equal(t, "started", start.status)
+	assert.Equal(t, 1, start.seq)
+	assert.Equal(t, "read " + dir + "/missing.txt", start.processCmd)
+	assert.Equal(t, "run-end", end.activity)
+	assert.Equal(t, "completed", end.status)
+	assert.Equal(t, 3, end.seq)
+	assert.Regexp(t, "^ran for [0-9.]+m?s\\\\, 1 entries \\(1 failed\\\\, 0 cancelled\\)$", end.details)
+	for _, entry := range parsedLog.entries {
+		assert.Equal(t, activityLogEntry.runId, entry.runId)
+	}
+
+	// A run that panics still records how it ended
+	os.Remove(logFilePath)
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "-run-summary", "send", "GET", "127.0.0.1", "http"}, "invalid syntax")
+	parsedLog, err = readLog(logFilePath)
+	assert.Nil(t, err)
+	end = parsedLog.entries[len(parsedLog.entries) - 1]
+	assert.Equal(t, "run-end", end.activity)
+	assert.Equal(t, "error", end.status)
+
+	// Without it, there's just the command's entry
+	os.Remove(logFilePath)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "read", dir + "/missing.txt"})
+	parsedLog, err = readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 1)
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "-heartbeat=-1s", "read", dir + "/missing.txt"}, "invalid -heartbeat -1s (must be 0 or more)")
+}
+
+func TestMain_Heartbeat(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep isn't a command on Windows")
+	}
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// A long-running command logs a heartbeat every interval, until it's done
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-heartbeat=100ms", "execute", "sleep", "0.35"})
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	heartbeats := 0
+	for _, entry := range parsedLog.entries {
+		if entry.activity == "heartbeat" {
+			heartbeats++
+			assert.Equal(t, "running", entry.status)
+			assert.Contains(t, entry.details, "running for ")
+		}
+	}
+	assert.GreaterOrEqual(t, heartbeats, 2)
+	last := parsedLog.entries[len(parsedLog.entries) - 1]
+	assert.Equal(t, "execute", last.activity)
+
+	// (and none are logged once it's finished)
+	time.Sleep(200 * time.Millisecond)
+	parsedLog, err = readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, last.seq, parsedLog.entries[len(parsedLog.entries) - 1].seq)
+}
+
+func TestRunSummary_End(t *testing.T) {
+	recorder := newRunRecorderSink()
+	parent := &ActivityLogEntry{runId: "summary-run", activity: "playbook"}
+	summary, stop := startRunSummary(recorder, parent, true, 0)
+	stop()
+	summary.count(&ActivityLogEntry{runId: "summary-run", activity: "create", status: "created"})
+	summary.count(&ActivityLogEntry{runId: "summary-run", activity: "send", status: "cancelled"})
+	summary.count(&ActivityLogEntry{runId: "other-run", activity: "send", status: "error"})
+
+	// It's only ended once (ie. by a shutdown signal, and not again when the command returns)
+	summary.end(recorder, "interrupted", "received interrupt")
+	summary.end(recorder, "completed", "")
+	entries := recorder.getEntries("summary-run")
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "run-end", entries[1].activity)
+	assert.Equal(t, "interrupted", entries[1].status)
+	assert.Contains(t, entries[1].details, "2 entries (0 failed\\, 1 cancelled)\\, received interrupt")
+
+	// Without -run-summary (just heartbeats), there's no run-start or run-end
+	summary, stop = startRunSummary(recorder, &ActivityLogEntry{runId: "heartbeat-run"}, false, time.Hour)
+	stop()
+	summary.end(recorder, "completed", "")
+	assert.Empty(t, recorder.getEntries("heartbeat-run"))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How many entries the S3 sink batches into each object, at most
+const S3BatchSize = 100
+
+// How long the S3 sink holds onto a batch before uploading it, even if it isn't full (checked as entries are written)
+const S3FlushInterval = time.Minute
+
+// Region to sign S3 requests for, if neither AWS_REGION nor AWS_DEFAULT_REGION is set
+const DefaultS3Region = "us-east-1"
+
+// Uploads entries to S3-compatible object storage, as JSON lines objects of up to S3BatchSize entries each, so the log outlives
+// an ephemeral host. Each object is named for its first entry, as <prefix><runId>/<seq>.jsonl (with seq zero-padded, so they sort).
+type S3Sink struct {
+	url					*url.URL
+	accessKeyId			string
+	secretAccessKey		string
+	sessionToken		string
+	region				string
+	client				*http.Client
+	batch				[]*ActivityLogEntry
+	batchStarted		time.Time
+}
+
+// Sets up a sink for the bucket and prefix at target, given as either s3://<bucket>/<prefix> (for AWS) or an http(s) URL with the bucket
+// in the path (ie. http://minio:9000/<bucket>/<prefix>, for other S3-compatible stores). The credentials come from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN environment variables, so they stay out of process listings and shell history.
+func newS3Sink(target string) (*S3Sink, error) {
+	sink := &S3Sink{
+		accessKeyId: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		region: os.Getenv("AWS_REGION"),
+		client: &http.Client{Timeout: SinkForwardTimeout},
+	}
+	if sink.region == "" {
+		sink.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if sink.region == "" {
+		sink.region = DefaultS3Region
+	}
+
+	// s3://<bucket>/<prefix> is the bucket's virtual-hosted endpoint on AWS
+	bucketUrlStr := target
+	if bucketAndPrefix, found := strings.CutPrefix(target, "//"); found {
+		bucket, prefix, _ := strings.Cut(bucketAndPrefix, "/")
+		bucketUrlStr = "https://" + bucket + ".s3." + sink.region + ".amazonaws.com/" + prefix
+	}
+	bucketUrl, err := url.Parse(bucketUrlStr)
+	if err != nil || (bucketUrl.Scheme != "http" && bucketUrl.Scheme != "https") || bucketUrl.Host == "" || bucketUrl.Host == ".s3." + sink.region + ".amazonaws.com" {
+		return nil, fmt.Errorf("invalid sink 's3:%s' (must be s3://<bucket>/<prefix> or s3:<http or https URL>)", target)
+	}
+	if sink.accessKeyId == "" || sink.secretAccessKey == "" {
+		return nil, fmt.Errorf("no credentials for the s3 sink (set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+	sink.url = bucketUrl
+	return sink, nil
+}
+
+func (sink *S3Sink) WriteEntry(entry *ActivityLogEntry) error {
+	if len(sink.batch) == 0 {
+		sink.batchStarted = time.Now()
+	}
+	sink.batch = append(sink.batch, entry)
+	if len(sink.batch) >= S3BatchSize || time.Since(sink.batchStarted) >= S3FlushInterval {
+		sink.flush()
+	}
+	return nil
+}
+
+// Uploads whatever's left in the batch
+func (sink *S3Sink) Close() error {
+	if len(sink.batch) > 0 {
+		sink.flush()
+	}
+	sink.client.CloseIdleConnections()
+	return nil
+}
+
+// Uploads the batch as a single object. The batch is dropped either way, so a store that's down doesn't hold up the run.
+func (sink *S3Sink) flush() {
+	var body bytes.Buffer
+	for _, entry := range sink.batch {
+		body.Write(serializeToJSON(entry))
+		body.WriteByte('\n')
+	}
+	key := fmt.Sprintf("%s/%08d.jsonl", sink.batch[0].runId, sink.batch[0].seq)
+	sink.batch = nil
+
+	err := sink.putObject(key, body.Bytes())
+	if err != nil {
+		slog.Warn("Unable to upload log entries to S3", "error", err)
+	}
+}
+
+// PUTs the object at key (under the sink's prefix), signed with AWS Signature Version 4
+func (sink *S3Sink) putObject(key string, contents []byte) error {
+	objectUrl := *sink.url
+	objectUrl.Path = objectUrl.Path + key
+	objectUrl.RawPath = awsURIEncode(objectUrl.Path, false)
+	request, err := http.NewRequest("PUT", objectUrl.String(), bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	if sink.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", sink.sessionToken)
+	}
+	signAWSRequest(request, contents, sink.accessKeyId, sink.secretAccessKey, sink.region, "s3", time.Now())
+
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("%s uploading %s: %s", response.Status, key, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Signs the request (adding the X-Amz-Date, X-Amz-Content-Sha256, and Authorization headers) with AWS Signature Version 4, covering
+// the host and every header already set on it
+func signAWSRequest(request *http.Request, payload []byte, accessKeyId string, secretAccessKey string, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256.Sum256(payload)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	// The canonical headers are the lowercased names, sorted, with the values trimmed
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// The canonical query string is sorted by name (then value), with everything encoded
+	query := request.URL.Query()
+	queryParams := []string{}
+	for name, values := range query {
+		for _, value := range values {
+			queryParams = append(queryParams, awsURIEncode(name, true) + "=" + awsURIEncode(value, true))
+		}
+	}
+	slices.Sort(queryParams)
+
+	canonicalPath := request.URL.Path
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		awsURIEncode(canonicalPath, false),
+		strings.Join(queryParams, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	key := hmacSHA256([]byte("AWS4" + secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=" + accessKeyId + "/" + scope + ", SignedHeaders=" + signedHeaders + ", Signature=" + signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Percent-encodes everything but the unreserved characters (and slashes, unless encodeSlash is set), the way AWS signatures expect
+func awsURIEncode(text string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(text) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
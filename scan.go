@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Most addresses we'll expand from a single CIDR block (a /16)
+const MaxScanHostsPerCIDR = 65536
+
+// Response data from scan action
+type ScanResponse struct {
+	attempts			int
+	open				int
+	closed				int
+	filtered			int
+	errors				int
+	status				string
+}
+
+// Attempts a TCP connect to every port on every host, at no more than rate attempts per second (0 for no limit).
+// Each attempt is logged as a connect activity, with status open, closed, filtered, or error.
+func scanPorts(activityLog Sink, parent *ActivityLogEntry, hosts []string, ports []int, rate float64, timeout time.Duration) *ScanResponse {
+	response := new(ScanResponse)
+
+	var interval time.Duration
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+
+	fmt.Printf("Scanning %d ports on %d hosts...\n", len(ports), len(hosts))
+	for _, host := range hosts {
+		for _, port := range ports {
+			// Pace the attempts
+			if interval > 0 && response.attempts > 0 {
+				sleepContext(interval)
+			}
+			if isRunCancelled() {
+				break
+			}
+
+			entry := newChildLogEntry(parent, "connect")
+			entry.destAddr = host
+			entry.destPort = port
+			entry.protocol = "tcp"
+			entry.path = "tcp://" + net.JoinHostPort(host, strconv.Itoa(port))
+
+			status, conn := probePort(host, port, timeout)
+			if conn != nil {
+				entry.sourceAddr, entry.sourcePort = splitAddrAndPort(conn.LocalAddr().String())
+				conn.Close()
+			}
+			entry.status = status
+
+			response.attempts += 1
+			switch status {
+			case "open":
+				response.open += 1
+				fmt.Printf("%s port %d is open\n", host, port)
+			case "closed":
+				response.closed += 1
+			case "filtered":
+				response.filtered += 1
+			default:
+				response.errors += 1
+			}
+			writeLogEntry(activityLog, entry)
+		}
+	}
+
+	fmt.Printf("Scanned %d ports: %d open, %d closed, %d filtered, %d errors\n", response.attempts, response.open, response.closed, response.filtered, response.errors)
+	response.status = "completed"
+	return response
+}
+
+// Attempts a TCP connect to the given host and port, and determines the port status from the outcome.
+// If the port is open, the connection is returned (and the caller must close it).
+func probePort(host string, port int, timeout time.Duration) (string, net.Conn) {
+	conn, err := newSourceDialer(timeout).DialContext(runContext, getIPNetwork("tcp"), net.JoinHostPort(host, strconv.Itoa(port)))
+	if err == nil {
+		return "open", conn
+	}
+
+	// Refused means something answered (with a RST), timing out means nothing did
+	if errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(err.Error(), "refused") {
+		return "closed", nil
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "filtered", nil
+	}
+	return "error", nil
+}
+
+// Parses a port list like "22,80,8000-8100" into a sorted list of unique ports
+func parsePortList(portList string) ([]int, error) {
+	seen := map[int]bool{}
+	ports := []int{}
+	for _, token := range strings.Split(portList, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+
+		low, high := token, token
+		if strings.Contains(token, "-") {
+			bounds := strings.SplitN(token, "-", 2)
+			low, high = bounds[0], bounds[1]
+		}
+		lowPort, err := strconv.Atoi(low)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in '%s'", token)
+		}
+		highPort, err := strconv.Atoi(high)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in '%s'", token)
+		}
+		if lowPort < 1 || highPort > 65535 || lowPort > highPort {
+			return nil, fmt.Errorf("invalid port range '%s'", token)
+		}
+
+		for port := lowPort; port <= highPort; port++ {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports in '%s'", portList)
+	}
+
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// Parses a host list like "10.0.0.1,10.0.1.0/28,example.com" into a list of hosts, expanding any CIDR blocks
+func parseHostList(hostList string) ([]string, error) {
+	hosts := []string{}
+	for _, token := range strings.Split(hostList, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		if !strings.Contains(token, "/") {
+			// (an IPv6 literal's connected to without its brackets, if it's given with them)
+			hosts = append(hosts, strings.TrimSuffix(strings.TrimPrefix(token, "["), "]"))
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR block '%s'", token)
+		}
+		ones, bits := network.Mask.Size()
+		if bits-ones > 16 {
+			return nil, fmt.Errorf("CIDR block '%s' is too large to scan (at most %d hosts)", token, MaxScanHostsPerCIDR)
+		}
+		for ip := network.IP.Mask(network.Mask); network.Contains(ip); ip = nextIP(ip) {
+			hosts = append(hosts, ip.String())
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts in '%s'", hostList)
+	}
+	return hosts, nil
+}
+
+// Gets the IP address after the given one
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i] += 1
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Scan_OpenAndClosed(t *testing.T) {
+	// Precondition: one port is listening, and another isn't
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+	closedPort := getFreeTestPort(t, "tcp")
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	ports := fmt.Sprintf("%d,%d", openPort, closedPort)
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "scan", "127.0.0.1", ports}
+	output := callMain(args)
+	assert.Contains(t, output, fmt.Sprintf("127.0.0.1 port %d is open", openPort))
+	assert.Contains(t, output, "Scanned 2 ports: 1 open, 1 closed, 0 filtered, 0 errors")
+	assert.Equal(t, activityLogEntry.activity, "scan")
+	assert.Equal(t, activityLogEntry.status, "completed")
+
+	// Each attempt should be logged separately
+	assertLogFileContains(t, logFilePath, ",connect,")
+	assertLogFileContains(t, logFilePath, fmt.Sprintf("tcp://127.0.0.1:%d,open,", openPort))
+	assertLogFileContains(t, logFilePath, fmt.Sprintf("tcp://127.0.0.1:%d,closed,", closedPort))
+}
+
+func TestMain_Scan_PortListEscaped(t *testing.T) {
+	// The port list's commas end up in the summary entry's path, and shouldn't split it into extra columns
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	ports := fmt.Sprintf("%d,%d", getFreeTestPort(t, "tcp"), getFreeTestPort(t, "tcp"))
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "scan", "127.0.0.1", ports}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.path, "tcp://127.0.0.1:" + strings.ReplaceAll(ports, ",", "\\,"))
+
+	contents, err := os.ReadFile(logFilePath)
+	assert.Nil(t, err)
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n")[1:] {
+		row, err := splitCSVRow(line)
+		assert.Nil(t, err)
+		assert.Len(t, row, len(strings.Split(HeaderStr, ",")), line)
+	}
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://127.0.0.1:" + ports, unescapeRawText(parsedLog.entries[len(parsedLog.entries) - 1].path))
+}
+
+func TestMain_Scan_NotEnoughArguments(t *testing.T) {
+	args := []string{"./noisemaker", "scan", "127.0.0.1"}
+	assertMainPanicsWithMessage(t, args, "not enough arguments for scan! Args: [127.0.0.1]")
+}
+
+func TestMain_Scan_InvalidPorts(t *testing.T) {
+	args := []string{"./noisemaker", "scan", "127.0.0.1", "80-0"}
+	assertMainPanicsWithMessage(t, args, "invalid port range '80-0'")
+}
+
+func TestParsePortList(t *testing.T) {
+	ports, err := parsePortList("443,20-22, 80,22")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{20, 21, 22, 80, 443}, ports)
+
+	_, err = parsePortList("65536")
+	assert.NotNil(t, err)
+	_, err = parsePortList("http")
+	assert.NotNil(t, err)
+	_, err = parsePortList(",")
+	assert.NotNil(t, err)
+}
+
+func TestParseHostList(t *testing.T) {
+	hosts, err := parseHostList("example.com,10.0.0.254/31,192.168.1.1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example.com", "10.0.0.254", "10.0.0.255", "192.168.1.1"}, hosts)
+
+	hosts, err = parseHostList("10.0.0.0/30")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.0,10.0.0.1,10.0.0.2,10.0.0.3", strings.Join(hosts, ","))
+
+	_, err = parseHostList("10.0.0.0/8")
+	assert.ErrorContains(t, err, "too large to scan")
+	_, err = parseHostList("10.0.0.0/33")
+	assert.ErrorContains(t, err, "invalid CIDR block")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The built-in scenarios: playbooks shipped with noisemaker, run by name
+//
+//go:embed scenarios/*.yaml
+var scenarioFiles embed.FS
+
+// Response data from scenario action
+type ScenarioResponse struct {
+	scenarios			int
+	status				string
+}
+
+// Gets the names of the built-in scenarios, in order
+func getScenarioNames() []string {
+	entries, err := scenarioFiles.ReadDir("scenarios")
+	check(err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reads the YAML of the built-in scenario with the name
+func readScenario(name string) ([]byte, error) {
+	contents, err := scenarioFiles.ReadFile(path.Join("scenarios", name + ".yaml"))
+	if err != nil || strings.ContainsAny(name, "/\\") {
+		return nil, fmt.Errorf("unknown scenario '%s' (must be one of %s)", name, strings.Join(getScenarioNames(), ", "))
+	}
+	return contents, nil
+}
+
+// Loads the built-in scenario with the name, with its variables set from name=value assignments. Every scenario has a workdir
+// variable for the files it works on; if it's not given, a temporary directory is made for it, which the returned function removes (as
+// well as the one it was resumed in, if it's since been resumed from a state file).
+func loadScenario(name string, assignments []string) (*Playbook, func(), error) {
+	contents, err := readScenario(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	playbook, err := parsePlaybook(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = setPlaybookVars(playbook, assignments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() {}
+	if workdir := playbook.Vars["workdir"]; len(workdir) == 1 && workdir[0] == "" {
+		dir, err := os.MkdirTemp("", "noisemaker-" + name + "-")
+		if err != nil {
+			return nil, nil, err
+		}
+		playbook.Vars["workdir"] = PlaybookValue{dir}
+		cleanup = func() {
+			os.RemoveAll(dir)
+			if resumed := playbook.Vars["workdir"][0]; resumed != dir && filepath.Dir(resumed) == filepath.Dir(dir) && strings.HasPrefix(filepath.Base(resumed), "noisemaker-" + name + "-") {
+				os.RemoveAll(resumed)
+			}
+		}
+	}
+	return playbook, cleanup, nil
+}
+
+// Prints each built-in scenario's name and description, and the variables it can be run with (and their defaults)
+func listScenarios(output io.Writer) *ScenarioResponse {
+	response := &ScenarioResponse{status: "error"}
+	for _, name := range getScenarioNames() {
+		contents, err := readScenario(name)
+		check(err)
+		playbook, err := parsePlaybook(contents)
+		check(err)
+
+		fmt.Fprintf(output, "%s: %s\n", name, playbook.Description)
+		varNames := []string{}
+		for varName := range playbook.Vars {
+			varNames = append(varNames, varName)
+		}
+		sort.Strings(varNames)
+		for _, varName := range varNames {
+			value := strings.Join(playbook.Vars[varName], ",")
+			if varName == "workdir" && value == "" {
+				value = "(a temporary directory)"
+			}
+			fmt.Fprintf(output, "    %s=%s\n", varName, value)
+		}
+		response.scenarios++
+	}
+	response.status = "completed"
+	return response
+}
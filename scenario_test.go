@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Scenario_List(t *testing.T) {
+	args := []string{"./noisemaker", "-sink=stdout", "scenario", "list"}
+	output := callMain(args)
+	assert.Contains(t, output, "ransomware-lite: Drops a handful of documents")
+	assert.Contains(t, output, "    workdir=(a temporary directory)\n")
+	assert.Contains(t, output, "    target=127.0.0.1\n")
+	assert.Equal(t, activityLogEntry.activity, "scenario")
+	assert.Equal(t, activityLogEntry.method, "list")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "4 scenarios")
+}
+
+func TestMain_Scenario_Show(t *testing.T) {
+	args := []string{"./noisemaker", "-sink=stdout", "scenario", "show", "exfil-http"}
+	output := callMain(args)
+	assert.Contains(t, output, "name: exfil-http\n")
+	assert.Contains(t, output, "    command: exfil\n")
+	assert.Equal(t, activityLogEntry.status, "completed")
+
+	args = []string{"./noisemaker", "-sink=stdout", "scenario", "show", "../playbook"}
+	assertMainPanicsWithMessage(t, args, "unknown scenario '../playbook' (must be one of exfil-http, hoststamper, ransomware-lite, recon-burst)")
+}
+
+func TestMain_Scenario_RunRansomwareLite(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-run-id=scenario-run", "scenario", "run", "ransomware-lite", "workdir=" + dir, "files=a.docx,b.xlsx"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.activity, "scenario")
+	assert.Equal(t, activityLogEntry.path, "ransomware-lite")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "8 of 8 steps completed")
+	assert.False(t, fileExists(dir + "/a.docx"))
+	assert.False(t, fileExists(dir + "/README-DECRYPT.txt"))
+	assertLogFileContains(t, logFilePath, ",update " + dir + "/b.xlsx NOISEMAKER-ENCRYPTED:")
+	assertLogFileContains(t, logFilePath, ",updated,")
+}
+
+func TestMain_Scenario_RunExfilHTTP(t *testing.T) {
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = len(body)
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+
+	// (in a temporary directory of its own, which is removed afterwards)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "scenario", "run", "exfil-http", "dest=" + host, "port=" + port}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "7 of 7 steps completed")
+	assert.Greater(t, received, 0)
+	assertLogFileContains(t, logFilePath, ",exfiltrated,")
+
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	for _, entry := range parsedLog.entries {
+		if entry.activity == "exfil" {
+			assert.False(t, fileExists(unescapeRawText(entry.path)))
+		}
+	}
+}
+
+func TestMain_Scenario_InvalidVariable(t *testing.T) {
+	args := []string{"./noisemaker", "-sink=stdout", "scenario", "run", "recon-burst", "target"}
+	assertMainPanicsWithMessage(t, args, "invalid playbook variable 'target' (must be name=value)")
+	args = []string{"./noisemaker", "-sink=stdout", "scenario", "run"}
+	assertMainPanicsWithMessage(t, args, "not enough arguments for scenario! Args: [run]")
+	args = []string{"./noisemaker", "-sink=stdout", "scenario", "start", "recon-burst"}
+	assertMainPanicsWithMessage(t, args, "invalid scenario command specified: start")
+}
+
+func TestLoadScenario(t *testing.T) {
+	// Every built-in scenario is a valid playbook, with a description and a workdir
+	for _, name := range getScenarioNames() {
+		playbook, cleanup, err := loadScenario(name, nil)
+		assert.Nil(t, err, name)
+		assert.Equal(t, name, playbook.Name)
+		assert.NotEmpty(t, playbook.Description, name)
+		workdir := playbook.Vars["workdir"][0]
+		_, err = os.Stat(workdir)
+		assert.Nil(t, err, name)
+		cleanup()
+		_, err = os.Stat(workdir)
+		assert.True(t, os.IsNotExist(err), name)
+	}
+
+	// A given workdir is left alone
+	dir := t.TempDir()
+	_, cleanup, err := loadScenario("recon-burst", []string{"workdir=" + dir})
+	assert.Nil(t, err)
+	cleanup()
+	_, err = os.Stat(dir)
+	assert.Nil(t, err)
+}
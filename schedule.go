@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How schedules tell the time and wait (replaced in tests, so days of scheduled activity don't take days)
+var scheduleNow = time.Now
+var scheduleSleep = func(duration time.Duration) { sleepContext(duration) }
+
+// The days of the week, as they're named in schedules (from Sunday, the same as time.Weekday)
+var ScheduleDayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// When activity happens over a long run: at the times of a cron expression (for a playbook that's run again and again, as a campaign),
+// and only within the hours and days given (ie. business hours on weekdays), less often on weekends
+type Schedule struct {
+	Cron				string			`yaml:"cron" json:"cron,omitempty"`					// ie. "*/30 * * * *", to run the playbook every half hour
+	Duration			string			`yaml:"duration" json:"duration,omitempty"`			// how long to keep running it for, with cron (ie. 72h)
+	Jitter				string			`yaml:"jitter" json:"jitter,omitempty"`				// the most each run's randomly delayed by, with cron
+	Hours				string			`yaml:"hours" json:"hours,omitempty"`				// ie. "09:00-12:00,13:00-17:30" (default all day)
+	Days				string			`yaml:"days" json:"days,omitempty"`					// ie. "mon-fri" (default every day)
+	WeekendRate			*float64		`yaml:"weekend_rate" json:"weekend_rate,omitempty"`	// the fraction of activity that still happens on weekends
+	Timezone			string			`yaml:"timezone" json:"timezone,omitempty"`			// ie. America/Chicago (default local time)
+	cron				*CronSchedule
+	duration			time.Duration
+	jitter				time.Duration
+	windows				[][2]int		// each window's start and end, in minutes since midnight
+	days				[7]bool
+	weekendRate			float64
+	location			*time.Location
+}
+
+// A parsed cron expression (minute, hour, day of month, month, and day of week), as the values each field matches
+type CronSchedule struct {
+	minutes				[60]bool
+	hours				[24]bool
+	daysOfMonth			[32]bool
+	months				[13]bool
+	daysOfWeek			[7]bool
+	anyDayOfMonth		bool
+	anyDayOfWeek		bool
+}
+
+// Parses and checks the schedule's settings
+func (schedule *Schedule) parse() error {
+	var err error
+	schedule.location = time.Local
+	if schedule.Timezone != "" {
+		schedule.location, err = time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid schedule: unknown timezone '%s'", schedule.Timezone)
+		}
+	}
+
+	if schedule.Cron != "" {
+		schedule.cron, err = parseCron(schedule.Cron)
+		if err != nil {
+			return err
+		}
+		if schedule.Duration == "" {
+			return fmt.Errorf("invalid schedule: cron needs a duration, to know when to stop")
+		}
+	}
+	if schedule.Duration != "" {
+		schedule.duration, err = time.ParseDuration(schedule.Duration)
+		if err != nil || schedule.duration <= 0 {
+			return fmt.Errorf("invalid schedule: invalid duration '%s'", schedule.Duration)
+		}
+	}
+	if schedule.Jitter != "" {
+		schedule.jitter, err = time.ParseDuration(schedule.Jitter)
+		if err != nil || schedule.jitter < 0 {
+			return fmt.Errorf("invalid schedule: invalid jitter '%s'", schedule.Jitter)
+		}
+	}
+
+	schedule.windows, err = parseScheduleHours(schedule.Hours)
+	if err != nil {
+		return err
+	}
+	schedule.days, err = parseScheduleDays(schedule.Days)
+	if err != nil {
+		return err
+	}
+	schedule.weekendRate = 1
+	if schedule.WeekendRate != nil {
+		schedule.weekendRate = *schedule.WeekendRate
+		if schedule.weekendRate < 0 || schedule.weekendRate > 1 {
+			return fmt.Errorf("invalid schedule: invalid weekend_rate %v (must be between 0.0 and 1.0)", schedule.weekendRate)
+		}
+	}
+	return nil
+}
+
+// Parses hour windows like "09:00-12:00,13:00-17:30" (a window can end at 24:00, or wrap past midnight, ie. "22:00-06:00"); all day if empty
+func parseScheduleHours(hours string) ([][2]int, error) {
+	if strings.TrimSpace(hours) == "" {
+		return [][2]int{{0, 24 * 60}}, nil
+	}
+	windows := [][2]int{}
+	for _, window := range strings.Split(hours, ",") {
+		start, end, found := strings.Cut(strings.TrimSpace(window), "-")
+		startMinute, startErr := parseScheduleTime(start)
+		endMinute, endErr := parseScheduleTime(end)
+		if !found || startErr != nil || endErr != nil || startMinute == endMinute || startMinute == 24 * 60 {
+			return nil, fmt.Errorf("invalid schedule: invalid hours '%s' (must be like 09:00-17:30)", strings.TrimSpace(window))
+		}
+		windows = append(windows, [2]int{startMinute, endMinute})
+	}
+	return windows, nil
+}
+
+// Parses a time of day like 09:30 (or 24:00), as minutes since midnight
+func parseScheduleTime(text string) (int, error) {
+	hour, minute, found := strings.Cut(strings.TrimSpace(text), ":")
+	hours, hourErr := strconv.Atoi(hour)
+	minutes, minuteErr := strconv.Atoi(minute)
+	if !found || hourErr != nil || minuteErr != nil || hours < 0 || minutes < 0 || minutes > 59 || hours * 60 + minutes > 24 * 60 {
+		return 0, fmt.Errorf("invalid time '%s'", text)
+	}
+	return hours * 60 + minutes, nil
+}
+
+// Parses days like "mon-fri" or "mon,wed,fri" (a range can wrap, ie. "fri-mon"); every day if empty
+func parseScheduleDays(days string) ([7]bool, error) {
+	var parsed [7]bool
+	if strings.TrimSpace(days) == "" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+	for _, token := range strings.Split(strings.ToLower(days), ",") {
+		start, end, isRange := strings.Cut(strings.TrimSpace(token), "-")
+		startDay := slices.Index(ScheduleDayNames, start)
+		endDay := startDay
+		if isRange {
+			endDay = slices.Index(ScheduleDayNames, end)
+		}
+		if startDay < 0 || endDay < 0 {
+			return parsed, fmt.Errorf("invalid schedule: invalid days '%s' (must be like mon-fri, or mon,wed,fri)", strings.TrimSpace(token))
+		}
+		for day := startDay; ; day = (day + 1) % 7 {
+			parsed[day] = true
+			if day == endDay {
+				break
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// Whether activity can happen at the time: on one of the schedule's days, in one of its windows (a window that wraps past midnight
+// counts for the day it started on)
+func (schedule *Schedule) isActive(at time.Time) bool {
+	local := at.In(schedule.location)
+	minute := local.Hour() * 60 + local.Minute()
+	today := int(local.Weekday())
+	yesterday := (today + 6) % 7
+	for _, window := range schedule.windows {
+		if window[0] < window[1] {
+			if schedule.days[today] && minute >= window[0] && minute < window[1] {
+				return true
+			}
+		} else if (schedule.days[today] && minute >= window[0]) || (schedule.days[yesterday] && minute < window[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the first time from at on when activity can happen (at itself, if it's active), or the zero time if it never can
+func (schedule *Schedule) nextActive(at time.Time) time.Time {
+	if schedule.isActive(at) {
+		return at
+	}
+	next := at.Truncate(time.Minute)
+	for i := 0; i < 8 * 24 * 60; i++ {
+		next = next.Add(time.Minute)
+		if schedule.isActive(next) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+func (schedule *Schedule) isWeekend(at time.Time) bool {
+	weekday := at.In(schedule.location).Weekday()
+	return weekday == time.Saturday || weekday == time.Sunday
+}
+
+// Waits until activity can happen (if it can't now), printing why
+func (schedule *Schedule) wait() {
+	now := scheduleNow()
+	next := schedule.nextActive(now)
+	if next.After(now) {
+		fmt.Printf("Waiting until %s (outside of the schedule's hours)...\n", next.In(schedule.location).Format(time.RFC3339))
+		scheduleSleep(next.Sub(now))
+	}
+}
+
+// Parses a cron expression's five fields: minute, hour, day of month, month, and day of week (0 or 7 for Sunday, or sun-sat), each as
+// *, a value, a range (ie. 9-17), or a list of them (ie. 1,15), optionally stepped (ie. */15)
+func parseCron(expression string) (*CronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule: invalid cron '%s' (must have 5 fields: minute, hour, day of month, month, and day of week)", expression)
+	}
+	cron := new(CronSchedule)
+	err := parseCronField(fields[0], 0, 59, nil, cron.minutes[:])
+	if err == nil {
+		err = parseCronField(fields[1], 0, 23, nil, cron.hours[:])
+	}
+	if err == nil {
+		err = parseCronField(fields[2], 1, 31, nil, cron.daysOfMonth[:])
+	}
+	if err == nil {
+		err = parseCronField(fields[3], 1, 12, nil, cron.months[:])
+	}
+	var daysOfWeek [8]bool
+	if err == nil {
+		err = parseCronField(fields[4], 0, 7, ScheduleDayNames, daysOfWeek[:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: invalid cron '%s' (%v)", expression, err)
+	}
+	copy(cron.daysOfWeek[:], daysOfWeek[:7])
+	cron.daysOfWeek[0] = cron.daysOfWeek[0] || daysOfWeek[7]
+	cron.anyDayOfMonth = strings.HasPrefix(fields[2], "*")
+	cron.anyDayOfWeek = strings.HasPrefix(fields[4], "*")
+	return cron, nil
+}
+
+// Parses a single cron field, marking the values it matches
+func parseCronField(field string, min int, max int, names []string, matches []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return fmt.Errorf("invalid step in '%s'", part)
+			}
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			startText, endText, isRange := strings.Cut(rangePart, "-")
+			var err error
+			start, err = parseCronValue(startText, min, max, names)
+			if err != nil {
+				return err
+			}
+			end = start
+			if isRange {
+				end, err = parseCronValue(endText, min, max, names)
+				if err != nil {
+					return err
+				}
+			} else if stepped {
+				end = max
+			}
+			if end < start {
+				return fmt.Errorf("invalid range '%s'", rangePart)
+			}
+		}
+		for value := start; value <= end; value += step {
+			matches[value] = true
+		}
+	}
+	return nil
+}
+
+func parseCronValue(text string, min int, max int, names []string) (int, error) {
+	if index := slices.Index(names, strings.ToLower(text)); index >= 0 {
+		return index, nil
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("invalid value '%s' (must be from %d to %d)", text, min, max)
+	}
+	return value, nil
+}
+
+// Whether the cron expression matches the day (if both the day of month and day of week are restricted, either can match, the same
+// as cron)
+func (cron *CronSchedule) matchesDay(at time.Time) bool {
+	dayOfMonth := cron.daysOfMonth[at.Day()]
+	dayOfWeek := cron.daysOfWeek[at.Weekday()]
+	if !cron.anyDayOfMonth && !cron.anyDayOfWeek {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
+
+// Gets the next time the cron expression matches after the time, in the location, or the zero time if it doesn't within 5 years
+// (ie. for February 30th)
+func (cron *CronSchedule) next(after time.Time, location *time.Location) time.Time {
+	next := after.In(location).Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		switch {
+		case !cron.months[next.Month()]:
+			next = time.Date(next.Year(), next.Month() + 1, 1, 0, 0, 0, 0, location)
+		case !cron.matchesDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day() + 1, 0, 0, 0, 0, location)
+		case !cron.hours[next.Hour()]:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour() + 1, 0, 0, 0, location)
+		case !cron.minutes[next.Minute()]:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// Runs the playbook again at each of its schedule's cron times, until the schedule's duration is up (skipping times outside of its
+// hours and days, and on weekends, all but its weekend rate of them), adding up the results of every run. Stops after a run that
+// fails (but not one whose failures were all continued past). With a checkpoint, it stops at the end it was first started with, and
+// an interrupted run is finished before waiting for the next.
+func runScheduledPlaybook(activityLog Sink, parent *ActivityLogEntry, playbook *Playbook, checkpoint *PlaybookCheckpoint) *PlaybookResponse {
+	schedule := playbook.Schedule
+	response := &PlaybookResponse{status: "completed"}
+	end := scheduleNow().Add(schedule.duration)
+	if checkpoint != nil {
+		var err error
+		end, err = checkpoint.getEnd(end)
+		check(err)
+		response.runs = checkpoint.Scheduled.Runs
+		response.completed = checkpoint.Scheduled.Completed
+		response.skipped = checkpoint.Scheduled.Skipped
+		response.total = checkpoint.Scheduled.Total
+		if checkpoint.inPass() {
+			fmt.Printf("Finishing the scheduled run that was interrupted...\n")
+			if !addScheduledRun(response, runPlaybook(activityLog, parent, playbook, checkpoint), checkpoint) {
+				return response
+			}
+		}
+	}
+	fmt.Printf("Running playbook %s on schedule '%s' until %s...\n", playbook.Name, schedule.Cron, end.In(schedule.location).Format(time.RFC3339))
+	for at := schedule.cron.next(scheduleNow(), schedule.location); !at.IsZero() && !at.After(end); at = schedule.cron.next(at, schedule.location) {
+		if !schedule.isActive(at) {
+			continue
+		}
+		if schedule.isWeekend(at) && rand.Float64() >= schedule.weekendRate {
+			fmt.Printf("Skipping the run at %s (on the weekend)\n", at.Format(time.RFC3339))
+			continue
+		}
+		if schedule.jitter > 0 {
+			at = at.Add(time.Duration(rand.Int63n(int64(schedule.jitter))))
+		}
+		if wait := at.Sub(scheduleNow()); wait > 0 {
+			fmt.Printf("Waiting until %s for the next run...\n", at.Format(time.RFC3339))
+			scheduleSleep(wait)
+		}
+		if isRunCancelled() {
+			break
+		}
+
+		if !addScheduledRun(response, runPlaybook(activityLog, parent, playbook, checkpoint), checkpoint) {
+			break
+		}
+	}
+	return response
+}
+
+// Adds a scheduled run's results to the response (and to the checkpoint's totals, if it completed), returning whether it completed
+func addScheduledRun(response *PlaybookResponse, runResponse *PlaybookResponse, checkpoint *PlaybookCheckpoint) bool {
+	response.runs++
+	response.completed += runResponse.completed
+	response.failed += runResponse.failed
+	response.skipped += runResponse.skipped
+	response.total += runResponse.total
+	response.continued += runResponse.continued
+	response.retried += runResponse.retried
+	if runResponse.failed > 0 {
+		response.status = "error"
+	}
+	if runResponse.failed > runResponse.continued {
+		return false
+	}
+	if checkpoint != nil {
+		err := checkpoint.finishPass(runResponse)
+		if err != nil {
+			slog.Warn("Couldn't save the state file", "path", checkpoint.path, "error", err)
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Replaces the schedule's clock with a fake one starting at the time, which only moves when it's slept on, until the test's done
+func useTestScheduleClock(t *testing.T, start time.Time) {
+	var mutex sync.Mutex
+	now := start
+	scheduleNow = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	scheduleSleep = func(duration time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if duration > 0 {
+			now = now.Add(duration)
+		}
+	}
+	t.Cleanup(func() {
+		scheduleNow = time.Now
+		scheduleSleep = time.Sleep
+	})
+}
+
+func TestMain_Playbook_Schedule(t *testing.T) {
+	// Precondition: it's just after midnight on a Friday, with three days to go
+	useTestScheduleClock(t, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: business-hours
+schedule:
+  cron: "0 * * * *"
+  duration: 72h
+  hours: "09:00-12:00,13:00-17:00"
+  weekend_rate: 0
+  timezone: UTC
+steps:
+  - command: delete
+    args: ["` + dir + `/missing.txt"]
+`), 0644)
+
+	// Only the hourly runs in Friday's business hours happen (none on the weekend)
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "playbook", playbookPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Running playbook business-hours on schedule '0 * * * *' until 2024-11-04T00:00:00Z...")
+	assert.Contains(t, output, "Waiting until 2024-11-01T09:00:00Z for the next run...")
+	assert.Contains(t, output, "Skipping the run at 2024-11-02T09:00:00Z (on the weekend)")
+	assert.NotContains(t, output, "2024-11-01T12:00:00Z")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "7 of 7 steps completed\\, over 7 scheduled runs")
+	assert.Equal(t, time.Date(2024, 11, 1, 16, 0, 0, 0, time.UTC), scheduleNow())
+}
+
+func TestMain_Playbook_ScheduleHours(t *testing.T) {
+	// Precondition: it's Saturday evening
+	useTestScheduleClock(t, time.Date(2024, 11, 2, 18, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+	playbookPath := dir + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte(`
+name: weekdays
+schedule:
+  hours: "09:00-17:00"
+  days: mon-fri
+  timezone: UTC
+steps:
+  - command: create
+    args: ["` + dir + `/test.txt"]
+`), 0644)
+
+	// Without a cron, the playbook's run once, waiting for the hours before each step
+	args := []string{"./noisemaker", "-sink=stdout", "playbook", playbookPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Waiting until 2024-11-04T09:00:00Z (outside of the schedule's hours)...")
+	assert.Equal(t, activityLogEntry.details, "1 of 1 steps completed")
+	assert.True(t, fileExists(dir + "/test.txt"))
+}
+
+func TestMain_Generate_Schedule(t *testing.T) {
+	// Precondition: it's Friday morning, for a day and a bit
+	useTestScheduleClock(t, time.Date(2024, 11, 1, 8, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+	profilePath := dir + "/profile.yaml"
+	os.WriteFile(profilePath, []byte("rate: 1\ninterval: fixed\nactivities:\n  - kind: file\n    weight: 1\n    files: [notes.txt]\n"), 0644)
+
+	// One a minute for Friday's hour, and none on Saturday
+	args := []string{"./noisemaker", "-sink=stdout", "generate", "--profile=" + profilePath, "--duration=30h", "--hours=09:00-10:00", "--weekend-rate=0", "--timezone=UTC", "--seed=1", "--dir=" + dir}
+	output := callMain(args)
+	assert.Contains(t, output, "Waiting until 2024-11-01T09:00:00Z (outside of the schedule's hours)...")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "59 activities generated (59 file\\, 0 web\\, 0 process)\\, 0 failed\\, with seed 1")
+	assert.Equal(t, time.Date(2024, 11, 2, 14, 0, 0, 0, time.UTC), scheduleNow())
+
+	args = []string{"./noisemaker", "-sink=stdout", "generate", "--days=mon-funday"}
+	assertMainPanicsWithMessage(t, args, "invalid schedule: invalid days 'mon-funday' (must be like mon-fri, or mon,wed,fri)")
+}
+
+func TestParseCron(t *testing.T) {
+	cron, err := parseCron("*/15 9-17 * * mon-fri")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 11, 4, 9, 0, 0, 0, time.UTC), cron.next(time.Date(2024, 11, 1, 17, 50, 0, 0, time.UTC), time.UTC))
+	assert.Equal(t, time.Date(2024, 11, 1, 9, 15, 0, 0, time.UTC), cron.next(time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC), time.UTC))
+
+	// With both days restricted, either matches (the same as cron)
+	cron, err = parseCron("0 12 13 * 5")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 11, 8, 12, 0, 0, 0, time.UTC), cron.next(time.Date(2024, 11, 1, 13, 0, 0, 0, time.UTC), time.UTC))
+	cron, err = parseCron("0 0 29 2 *")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC), cron.next(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.UTC))
+	cron, err = parseCron("0 0 30 2 *")
+	assert.Nil(t, err)
+	assert.True(t, cron.next(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.UTC).IsZero())
+
+	// In another timezone
+	chicago, err := time.LoadLocation("America/Chicago")
+	assert.Nil(t, err)
+	cron, err = parseCron("0 9 * * *")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 11, 1, 14, 0, 0, 0, time.UTC), cron.next(time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), chicago).UTC())
+
+	for _, expression := range []string{"* * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * * funday"} {
+		_, err = parseCron(expression)
+		assert.ErrorContains(t, err, "invalid schedule: invalid cron '" + expression + "'", expression)
+	}
+}
+
+func TestSchedule_IsActive(t *testing.T) {
+	schedule := &Schedule{Hours: "22:00-06:00", Days: "fri", Timezone: "UTC"}
+	assert.Nil(t, schedule.parse())
+	assert.True(t, schedule.isActive(time.Date(2024, 11, 1, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, schedule.isActive(time.Date(2024, 11, 2, 3, 0, 0, 0, time.UTC)))
+	assert.False(t, schedule.isActive(time.Date(2024, 11, 1, 3, 0, 0, 0, time.UTC)))
+	assert.False(t, schedule.isActive(time.Date(2024, 11, 2, 7, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2024, 11, 8, 22, 0, 0, 0, time.UTC), schedule.nextActive(time.Date(2024, 11, 2, 7, 0, 0, 0, time.UTC)))
+
+	schedule = &Schedule{Hours: "09:00-17:00", Days: "sat-sun,wed", Timezone: "America/Chicago"}
+	assert.Nil(t, schedule.parse())
+	assert.True(t, schedule.isActive(time.Date(2024, 11, 6, 15, 0, 0, 0, time.UTC)))
+	assert.False(t, schedule.isActive(time.Date(2024, 11, 6, 14, 59, 0, 0, time.UTC)))
+	assert.True(t, schedule.isWeekend(time.Date(2024, 11, 3, 12, 0, 0, 0, time.UTC)))
+
+	for settings, message := range map[*Schedule]string{
+		{Hours: "9-5"}: "invalid hours '9-5' (must be like 09:00-17:30)",
+		{Hours: "09:00-09:00"}: "invalid hours '09:00-09:00'",
+		{Days: "weekdays"}: "invalid days 'weekdays'",
+		{Cron: "0 * * * *"}: "cron needs a duration, to know when to stop",
+		{Duration: "-1h"}: "invalid duration '-1h'",
+		{Timezone: "Mars/Olympus_Mons"}: "unknown timezone 'Mars/Olympus_Mons'",
+		{WeekendRate: new(float64)}: "",
+	} {
+		err := settings.parse()
+		if message == "" {
+			assert.Nil(t, err)
+		} else {
+			assert.ErrorContains(t, err, "invalid schedule: " + message)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The version of the activity log's column set, bumped whenever columns are added (every column added goes on the end of HeaderStr)
+const SchemaVersion = 12
+
+// How many columns (from the start of HeaderStr) each schema version had, oldest first
+var SchemaColumnCounts = []int{16, 17, 18, 19, 20, 21, 22, 25, 27, 28, 29, 32}
+
+// Starts the line above the header of a CSV activity log, ie. "#schemaVersion=12"
+const SchemaVersionPrefix = "#schemaVersion="
+
+// Response data from migrate-log action
+type MigrateResponse struct {
+	entries				int
+	fromVersion			int
+	status				string
+}
+
+// Gets the lines a CSV activity log starts with: the schema version, then the header
+func getCSVFileHeader() string {
+	return SchemaVersionPrefix + strconv.Itoa(SchemaVersion) + "\n" + HeaderStr + "\n"
+}
+
+func isSchemaVersionStr(line string) bool {
+	return strings.HasPrefix(line, SchemaVersionPrefix)
+}
+
+// Rewrites the activity log at path (CSV, or JSON lines) with the current schema's columns, to outputPath.
+// If outputPath is the same file, it's only rewritten if it needs to be, and the original's kept alongside it (as .bak).
+func migrateLog(path string, outputPath string) (*MigrateResponse, error) {
+	response := &MigrateResponse{status: "error"}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		response.status = "not_found"
+		return response, err
+	}
+	plaintext, err := decryptLogIfEncrypted(path, contents)
+	if err != nil {
+		return response, err
+	}
+
+	parsedLog, err := parseLog(path, plaintext)
+	if err != nil {
+		return response, err
+	}
+	response.fromVersion = parsedLog.version
+	response.entries = len(parsedLog.entries)
+	if parsedLog.sqlite {
+		response.status = "unsupported"
+		return response, fmt.Errorf("SQLite logs can't be migrated")
+	}
+	if parsedLog.version > SchemaVersion {
+		response.status = "unsupported_version"
+		return response, fmt.Errorf("log schema version %d is newer than this version of noisemaker supports (%d)", parsedLog.version, SchemaVersion)
+	}
+
+	if outputPath == path {
+		if parsedLog.version == SchemaVersion && parsedLog.versioned {
+			response.status = "up_to_date"
+			return response, nil
+		}
+		err = os.WriteFile(path + ".bak", contents, 0644)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	// Write it back out in the same format (encrypted, if it was)
+	var buffer bytes.Buffer
+	if !parsedLog.jsonl {
+		buffer.WriteString(getCSVFileHeader())
+	}
+	for _, entry := range parsedLog.entries {
+		if parsedLog.jsonl {
+			buffer.Write(append(serializeToJSON(entry), '\n'))
+		} else {
+			buffer.WriteString(strings.Join(serializeToCSV(entry), ",") + "\n")
+		}
+	}
+	output := buffer.Bytes()
+	if isEncryptedLog(contents) {
+		output = encryptLog(logCipher, output)
+	}
+	err = os.WriteFile(outputPath, output, 0644)
+	if err != nil {
+		return response, err
+	}
+	response.status = "migrated"
+	return response, nil
+}
+
+// Migrates the log, if it's older than the current schema, so new entries can be appended to it. Failing that, it's left as it was.
+func migrateLogIfNeeded(path string) error {
+	response, err := migrateLog(path, path)
+	if response.status == "unsupported_version" {
+		return err
+	}
+	if err != nil {
+		fmt.Printf("Unable to migrate log file %s, leaving it as-is: %v\n", path, err)
+	} else if response.status == "migrated" {
+		fmt.Printf("Migrated log file %s from schema version %d to %d (the original is in %s.bak)\n", path, response.fromVersion, SchemaVersion, path)
+	}
+	return nil
+}
+
+// Whether the log is JSON lines (by its extension, or by what's in it), rather than CSV
+func isJSONLLog(path string, contents []byte) bool {
+	if strings.HasSuffix(path, ".jsonl") || strings.HasSuffix(path, ".json") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(contents), []byte("{"))
+}
+
+// Works out which schema version a CSV log was written with, from its version line, its header, or (for logs with neither)
+// the number of fields in its first row
+func getCSVSchemaVersion(lines []string) (int, bool, error) {
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if isSchemaVersionStr(line) {
+			version, err := strconv.Atoi(strings.TrimPrefix(line, SchemaVersionPrefix))
+			if err != nil || version < 1 {
+				return 0, false, fmt.Errorf("invalid schema version line '%s'", line)
+			}
+			return version, true, nil
+		}
+
+		// The header of an older version is the start of the current one
+		columns := strings.Split(HeaderStr, ",")
+		if strings.HasPrefix(line, "timestamp,") {
+			for i, count := range SchemaColumnCounts {
+				if line == strings.Join(columns[:count], ",") {
+					return i + 1, false, nil
+				}
+			}
+			if strings.HasPrefix(line, HeaderStr + ",") {
+				return SchemaVersion + 1, false, nil
+			}
+			return 0, false, fmt.Errorf("unrecognized header '%s'", line)
+		}
+
+		row, err := splitCSVRow(line)
+		if err != nil {
+			return 0, false, err
+		}
+		for i, count := range SchemaColumnCounts {
+			if len(row) <= count {
+				return i + 1, false, nil
+			}
+		}
+		return SchemaVersion + 1, false, nil
+	}
+
+	// There's nothing in it to migrate
+	return SchemaVersion, false, nil
+}
+
+// The entries read from an activity log (of any schema version, up to the current one)
+type ParsedLog struct {
+	entries				[]*ActivityLogEntry
+	version				int					// the oldest schema version the entries were written with
+	versioned			bool				// whether the version was recorded (rather than worked out from the columns)
+	jsonl				bool
+	sqlite				bool
+}
+
+// Reads every entry in the activity log at path (CSV, JSON lines, or SQLite), failing if it's from a newer schema version
+func readLog(path string) (*ParsedLog, error) {
+	contents, err := readLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parsedLog, err := parseLog(path, contents)
+	if err != nil {
+		return nil, err
+	}
+	if parsedLog.version > SchemaVersion {
+		return nil, fmt.Errorf("log schema version %d is newer than this version of noisemaker supports (%d)", parsedLog.version, SchemaVersion)
+	}
+	return parsedLog, nil
+}
+
+// Parses a log's entries, with the columns older versions didn't have left empty. If it's from a newer version, none are parsed.
+func parseLog(path string, contents []byte) (*ParsedLog, error) {
+	if isSQLiteLog(contents) {
+		return parseSQLiteLog(path)
+	}
+	if isJSONLLog(path, contents) {
+		return parseJSONLLog(contents)
+	}
+	return parseCSVLog(contents)
+}
+
+// Parses a CSV log's rows (older versions are missing columns from the end)
+func parseCSVLog(contents []byte) (*ParsedLog, error) {
+	lines := strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n")
+	version, versioned, err := getCSVSchemaVersion(lines)
+	if err != nil {
+		return nil, err
+	}
+	parsedLog := &ParsedLog{version: version, versioned: versioned}
+	if version > SchemaVersion {
+		return parsedLog, nil
+	}
+
+	for i, line := range lines {
+		if line == "" || isSchemaVersionStr(line) || strings.HasPrefix(line, "timestamp,") {
+			continue
+		}
+		row, err := splitCSVRow(line)
+		if err != nil || len(row) < SchemaColumnCounts[0] {
+			return nil, fmt.Errorf("invalid row on line %d: '%s'", i + 1, line)
+		}
+		entry, err := deserializeFromCSV(row)
+		if err != nil {
+			return nil, fmt.Errorf("invalid row on line %d: %v", i + 1, err)
+		}
+		parsedLog.entries = append(parsedLog.entries, entry)
+	}
+	return parsedLog, nil
+}
+
+// Parses a JSON lines log's entries (older versions are missing keys for the newer columns)
+func parseJSONLLog(contents []byte) (*ParsedLog, error) {
+	parsedLog := &ParsedLog{version: SchemaVersion, versioned: true, jsonl: true}
+	for i, line := range strings.Split(string(contents), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		object := map[string]any{}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		err := decoder.Decode(&object)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry on line %d: %v", i + 1, err)
+		}
+
+		// Entries from before the version was recorded are as old as the columns they have
+		version := 0
+		if number, ok := object["schemaVersion"].(json.Number); ok {
+			parsed, err := number.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema version on line %d: %v", i + 1, number)
+			}
+			version = int(parsed)
+		} else {
+			parsedLog.versioned = false
+			version = getJSONSchemaVersion(object)
+		}
+		if version > SchemaVersion {
+			return &ParsedLog{version: version, jsonl: true}, nil
+		}
+		if len(parsedLog.entries) == 0 || version < parsedLog.version {
+			parsedLog.version = version
+		}
+		parsedLog.entries = append(parsedLog.entries, deserializeFromJSON(object))
+	}
+	return parsedLog, nil
+}
+
+// Works out which (unversioned) schema version an entry's from, by the last column it has
+func getJSONSchemaVersion(object map[string]any) int {
+	columns := strings.Split(HeaderStr, ",")
+	for i := len(SchemaColumnCounts) - 1; i >= 0; i-- {
+		if _, ok := object[columns[SchemaColumnCounts[i] - 1]]; ok {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// Undoes serializeToJSON (leaving any missing columns empty)
+func deserializeFromJSON(object map[string]any) *ActivityLogEntry {
+	row := []string{}
+	for _, column := range strings.Split(HeaderStr, ",") {
+		switch value := object[column].(type) {
+		case string:
+			row = append(row, escapeRawText(value))
+		case json.Number:
+			row = append(row, value.String())
+		case nil:
+			row = append(row, "")
+		default:
+			row = append(row, escapeRawText(fmt.Sprintf("%v", value)))
+		}
+	}
+	entry, _ := deserializeFromCSV(row)
+	return entry
+}
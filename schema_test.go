@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The original (version 1) columns, and a row written with them
+const TestV1HeaderStr = "timestamp,activity,os,username,processName,processCmd,pid,path,status,method,sourceAddr,sourcePort,destAddr,destPort,bytesSent,protocol"
+const TestV1Row = "2024-11-05T16:22:23-06:00,send,windows,DESKTOP-FESHU4L\\Nick,main.exe,send POST www.postman-echo.com/post 443 https Hello World!,41356,https://www.postman-echo.com:443/post,sent,POST,192.168.1.67,52680,www.postman-echo.com/post,443,12,https"
+
+func TestMain_MigrateLog(t *testing.T) {
+	dir := t.TempDir()
+	oldLogPath := dir + "/old-log.csv"
+	os.WriteFile(oldLogPath, []byte(TestV1HeaderStr + "\n" + TestV1Row + "\n"), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "migrate-log", oldLogPath}
+	output := callMain(args)
+	assert.Contains(t, output, "Log file " + oldLogPath + " migrated: 1 entries from schema version 1 (now " + strconv.Itoa(SchemaVersion) + ")")
+	assert.Equal(t, activityLogEntry.activity, "migrate-log")
+	assert.Equal(t, activityLogEntry.status, "migrated")
+	assert.Equal(t, activityLogEntry.details, "1 entries migrated from schema version 1 to " + strconv.Itoa(SchemaVersion))
+
+	// The migrated log has every column (with the new ones empty), and the original's kept
+	contents, err := readTestFile(oldLogPath)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(contents), "\n")
+	assert.Equal(t, []string{"#schemaVersion=" + strconv.Itoa(SchemaVersion), HeaderStr}, lines[:2])
+	assert.Equal(t, TestV1Row + ",0,0,,,,0,,,,,,,,0,,", lines[2])
+	original, err := readTestFile(oldLogPath + ".bak")
+	assert.Nil(t, err)
+	assert.Equal(t, TestV1HeaderStr + "\n" + TestV1Row + "\n", original)
+}
+
+func TestMain_MigrateLog_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "migrate-log", dir + "/nonexistent-log.csv"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "not_found")
+}
+
+func TestMain_MigrateLog_NotEnoughArguments(t *testing.T) {
+	args := []string{"./noisemaker", "migrate-log"}
+	assertMainPanicsWithMessage(t, args, "not enough arguments for migrate-log! Args: []")
+}
+
+func TestMain_AppendToOldLog(t *testing.T) {
+	// Precondition: the log was written by an older version
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	os.WriteFile(logFilePath, []byte(TestV1HeaderStr + "\n" + TestV1Row + "\n"), 0644)
+
+	// It should be migrated before anything's appended to it
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "create", t.TempDir() + "/test.txt"}
+	output := callMain(args)
+	assert.Contains(t, output, "Migrated log file " + logFilePath + " from schema version 1")
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(contents), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, HeaderStr, lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], TestV1Row + ","))
+	assert.Contains(t, lines[3], ",created,")
+	assert.True(t, fileExists(logFilePath + ".bak"))
+}
+
+func TestMigrateLog_UpToDate(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	sink, err := newCSVFileSink(logFilePath, false)
+	assert.Nil(t, err)
+	sink.WriteEntry(&ActivityLogEntry{activity: "create", status: "created", seq: 1})
+	sink.Close()
+
+	response, err := migrateLog(logFilePath, logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "up_to_date", response.status)
+	assert.Equal(t, SchemaVersion, response.fromVersion)
+	assert.False(t, fileExists(logFilePath + ".bak"))
+}
+
+func TestMigrateLog_WithoutHeader(t *testing.T) {
+	// Rows with runId and seq, but no host columns (version 7)
+	dir := t.TempDir()
+	row := TestV1Row + ",1,0,,,run-1,3"
+	os.WriteFile(dir + "/old-log.csv", []byte(row + "\n"), 0644)
+
+	response, err := migrateLog(dir + "/old-log.csv", dir + "/new-log.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, "migrated", response.status)
+	assert.Equal(t, 7, response.fromVersion)
+	assert.Equal(t, 1, response.entries)
+	assert.False(t, fileExists(dir + "/old-log.csv.bak"))
+	assertLogFileContains(t, dir + "/new-log.csv", row + ",,,,,,,,0,,\n")
+	runIdsAndSeqs := readTestRunIdsAndSeqs(t, dir + "/new-log.csv")
+	assert.Equal(t, []string{"run-1,3"}, runIdsAndSeqs)
+}
+
+func TestMigrateLog_NewerVersion(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	contents := "#schemaVersion=" + strconv.Itoa(SchemaVersion + 1) + "\n" + HeaderStr + ",responseStatusCd\n"
+	os.WriteFile(logFilePath, []byte(contents), 0644)
+
+	response, err := migrateLog(logFilePath, logFilePath)
+	assert.ErrorContains(t, err, "is newer than this version of noisemaker supports")
+	assert.Equal(t, "unsupported_version", response.status)
+
+	// And it shouldn't be appended to, either
+	_, err = newCSVFileSink(logFilePath, false)
+	assert.NotNil(t, err)
+	unchanged, _ := readTestFile(logFilePath)
+	assert.Equal(t, contents, unchanged)
+}
+
+func TestMigrateLog_UnrecognizedHeader(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	os.WriteFile(logFilePath, []byte("timestamp,activity,something-else\n"), 0644)
+
+	_, err := migrateLog(logFilePath, logFilePath)
+	assert.ErrorContains(t, err, "unrecognized header")
+}
+
+func TestMigrateLog_JSONL(t *testing.T) {
+	// Precondition: an entry from before the note and labels (and the schema version) were recorded
+	dir := t.TempDir()
+	os.WriteFile(dir + "/old-log.jsonl", []byte(`{"timestamp":"2024-11-05T16:20:14-06:00","activity":"send","processCmd":"send GET a,b","destPort":443,"runId":"run-1","seq":2,"hostname":"lab-vm-1","hostIPs":"","machineId":""}` + "\n"), 0644)
+
+	response, err := migrateLog(dir + "/old-log.jsonl", dir + "/new-log.jsonl")
+	assert.Nil(t, err)
+	assert.Equal(t, "migrated", response.status)
+	assert.Equal(t, 8, response.fromVersion)
+	contents, err := readTestFile(dir + "/new-log.jsonl")
+	assert.Nil(t, err)
+	assert.Contains(t, contents, `"processCmd":"send GET a,b"`)
+	assert.Contains(t, contents, `"destPort":443`)
+	assert.Contains(t, contents, `"seq":2`)
+	assert.Contains(t, contents, `"note":"","labels":"","signature":"","elevated":"","dnsTime":0,"tlsVersion":"","tlsCipher":"","schemaVersion":` + strconv.Itoa(SchemaVersion) + "}\n")
+
+	// Migrating it again shouldn't change anything
+	response, err = migrateLog(dir + "/new-log.jsonl", dir + "/new-log.jsonl")
+	assert.Nil(t, err)
+	assert.Equal(t, "up_to_date", response.status)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Size of the placeholder image written when there's no screen to capture
+const PlaceholderScreenWidth = 1024
+const PlaceholderScreenHeight = 768
+
+// Captures the primary screen in PowerShell, via the same GDI calls (BitBlt) screen-capture tools use
+const WindowsCaptureScript = `Add-Type -AssemblyName System.Windows.Forms,System.Drawing; ` +
+	`$b = [System.Windows.Forms.Screen]::PrimaryScreen.Bounds; ` +
+	`$bmp = New-Object System.Drawing.Bitmap $b.Width, $b.Height; ` +
+	`$g = [System.Drawing.Graphics]::FromImage($bmp); ` +
+	`$g.CopyFromScreen($b.Location, [System.Drawing.Point]::Empty, $b.Size); ` +
+	`$bmp.Save($env:NOISEMAKER_SCREENSHOT_PATH, [System.Drawing.Imaging.ImageFormat]::Png); ` +
+	`$g.Dispose(); $bmp.Dispose()`
+
+// Response data from screenshot action
+type ScreenshotResponse struct {
+	size				int64
+	method				string
+	status				string
+}
+
+// Captures the screen to the given path using the native tools for the OS, or writes a black placeholder image if there's no display
+func captureScreen(goos string, path string) (*ScreenshotResponse, error) {
+	response := new(ScreenshotResponse)
+	if isHeadless(goos) {
+		fmt.Printf("No display found, writing a placeholder image to %s...\n", path)
+		response.method = "placeholder"
+		err := writePlaceholderScreenshot(path)
+		if err != nil {
+			response.status = "error"
+			return response, err
+		}
+		response.status = "placeholder"
+	} else {
+		cmd, args := getScreenshotCommand(goos, path)
+		response.method = cmd
+		fmt.Printf("Capturing the screen to %s using %s...\n", path, cmd)
+
+		captureCmd := exec.CommandContext(runContext, cmd, args...)
+		captureCmd.Env = append(os.Environ(), "NOISEMAKER_SCREENSHOT_PATH=" + path)
+		output, err := captureCmd.CombinedOutput()
+		if err != nil {
+			fmt.Printf("%s\n", strings.TrimSpace(string(output)))
+			if _, ok := err.(*exec.ExitError); !ok {
+				response.status = "not_found"
+			} else {
+				response.status = "error"
+			}
+			return response, err
+		}
+		response.status = "captured"
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+	response.size = info.Size()
+	fmt.Printf("%d bytes written to screenshot %s\n", response.size, path)
+	return response, nil
+}
+
+// Determines whether there's a display to capture (only Linux and friends can run without one)
+func isHeadless(goos string) bool {
+	switch goos {
+	case "windows", "darwin":
+		return false
+	default:
+		return os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == ""
+	}
+}
+
+// Gets the native screen capture command (and args) for the OS
+func getScreenshotCommand(goos string, path string) (string, []string) {
+	switch goos {
+	case "windows":
+		return "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", WindowsCaptureScript}
+	case "darwin":
+		// -x disables the capture sound
+		return "screencapture", []string{"-x", path}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			return "grim", []string{path}
+		}
+		return firstAvailableCommand(
+			[]string{"import", "-window", "root", path},
+			[]string{"gnome-screenshot", "-f", path},
+			[]string{"scrot", "-o", path},
+		)
+	}
+}
+
+// Writes a black PNG the size of a small screen
+func writePlaceholderScreenshot(path string) error {
+	img := image.NewRGBA(image.Rect(0, 0, PlaceholderScreenWidth, PlaceholderScreenHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Black}, image.Point{}, draw.Src)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Screenshot_Headless(t *testing.T) {
+	// Precondition: there's no display
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	path := t.TempDir() + "/screenshot.png"
+
+	response, err := captureScreen("linux", path)
+	assert.Nil(t, err)
+	assert.Equal(t, "placeholder", response.status)
+	assert.Equal(t, "placeholder", response.method)
+
+	// The placeholder should be a real image, the size of a small screen
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	assert.Nil(t, err)
+	assert.Equal(t, PlaceholderScreenWidth, img.Bounds().Dx())
+	assert.Equal(t, PlaceholderScreenHeight, img.Bounds().Dy())
+	info, _ := f.Stat()
+	assert.Equal(t, info.Size(), response.size)
+}
+
+func TestMain_Screenshot_InvalidPath(t *testing.T) {
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	if !isHeadless(runtime.GOOS) {
+		t.Skip("only headless screenshots can be tested")
+	}
+
+	path := t.TempDir() + "/nonexistent-dir/screenshot.png"
+	args := []string{"./noisemaker", "screenshot", path}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.activity, "screenshot")
+	assert.Equal(t, activityLogEntry.path, path)
+	assert.Equal(t, activityLogEntry.status, "error")
+}
+
+func TestGetScreenshotCommand(t *testing.T) {
+	cmd, args := getScreenshotCommand("darwin", "./screenshot.png")
+	assert.Equal(t, "screencapture", cmd)
+	assert.Equal(t, []string{"-x", "./screenshot.png"}, args)
+
+	cmd, _ = getScreenshotCommand("windows", "./screenshot.png")
+	assert.Equal(t, "powershell", cmd)
+
+	t.Setenv("WAYLAND_DISPLAY", "wayland-0")
+	cmd, _ = getScreenshotCommand("linux", "./screenshot.png")
+	assert.Equal(t, "grim", cmd)
+}
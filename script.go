@@ -0,0 +1,302 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options for the script command
+type ScriptOptions struct {
+	path				string
+	seed				int64
+	vars				[]string	// name=value assignments, for the script's vars
+}
+
+// Response data from script action
+type ScriptResponse struct {
+	actions				int			// how many commands it ran
+	failed				int			// how many of them failed
+	status				string
+}
+
+// Parses script's arguments: [-seed=n] (path) [name=value...]
+func parseScriptOptions(args []string) (*ScriptOptions, error) {
+	flags := flag.NewFlagSet("script", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	seed := flags.Int64("seed", 0, "the seed for the script's random module, for the same choices again (default random)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for script! Args: %v", args)
+	}
+	options := &ScriptOptions{path: flags.Arg(0), seed: *seed, vars: flags.Args()[1:]}
+	if options.seed == 0 {
+		options.seed = time.Now().UnixNano()
+	}
+	for _, assignment := range options.vars {
+		if name, _, found := strings.Cut(assignment, "="); !found || !playbookVarNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid script variable '%s' (must be name=value)", assignment)
+		}
+	}
+	return options, nil
+}
+
+// Reads and parses the script at path (so it's checked before any of it's run)
+func loadScript(path string) ([]ScriptStmt, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	stmts, err := parseScript(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("invalid script %s: %v", path, err)
+	}
+	return stmts, nil
+}
+
+// Runs the script, logging each command it runs as its own entry (sharing the script's correlation ID), as a playbook's steps are
+func runScript(activityLog Sink, parent *ActivityLogEntry, stmts []ScriptStmt, options *ScriptOptions) *ScriptResponse {
+	response := new(ScriptResponse)
+	interpreter := newScriptInterpreter(os.Stdout, getScriptAPI(activityLog, parent, options, response))
+	err := interpreter.run(stmts)
+	if err != nil {
+		fmt.Printf("Script %s failed: %v\n", options.path, err)
+		response.status = "error"
+	} else {
+		response.status = "completed"
+	}
+	fmt.Printf("Ran %d commands from script %s (%d failed)\n", response.actions, options.path, response.failed)
+
+	details := fmt.Sprintf("%d commands run, %d failed, seed %d", response.actions, response.failed, options.seed)
+	if err != nil {
+		details += ": " + err.Error()
+	}
+	parent.details = escapeRawText(details)
+	return response
+}
+
+// Gets the variables a script's run with, beyond the builtins: the commands it can run, log (to record its own entries), sleep, random
+// (seeded), vars (from the command line), os, and elevated
+func getScriptAPI(activityLog Sink, parent *ActivityLogEntry, options *ScriptOptions, response *ScriptResponse) map[string]any {
+	api := map[string]any{}
+	add := func(members map[string]any, name string, call func(name string, args []any, kwargs map[string]any) (any, error)) {
+		members[name] = &ScriptBuiltin{name: name, call: func(args []any, kwargs map[string]any) (any, error) {
+			return call(name, args, kwargs)
+		}}
+	}
+
+	// Runs a command (with its args as they'd be given on the command line), returning its entry's columns
+	runCommandFromScript := func(command string, args []any) (any, error) {
+		if containsString(NonPlaybookCommands, command) {
+			return nil, fmt.Errorf("a script can't run %s", command)
+		}
+		if !containsString(Commands, command) {
+			return nil, fmt.Errorf("unknown command %s", command)
+		}
+		if err := runContext.Err(); err != nil {
+			return nil, fmt.Errorf("the run was cancelled (%v)", err)
+		}
+		commandArgs := []string{}
+		for _, arg := range args {
+			if arg != nil {
+				commandArgs = append(commandArgs, formatScriptValue(arg, false))
+			}
+		}
+		entry := newChildLogEntry(parent, command)
+		entry.processCmd = escapeCommandString(command, commandArgs)
+		err := runCommandSafely(activityLog, entry, command, commandArgs)
+		response.actions++
+		if err != nil || isFailureStatus(entry.status) {
+			response.failed++
+		}
+		return getScriptResult(entry, err), nil
+	}
+
+	add(api, "run", func(name string, args []any, kwargs map[string]any) (any, error) {
+		if _, err := bindScriptArgs(name, nil, kwargs); err != nil {
+			return nil, err
+		}
+		if len(args) < 1 {
+			return nil, fmt.Errorf("run() is missing argument command")
+		}
+		command, err := getScriptString("command", args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		return runCommandFromScript(command, args[1:])
+	})
+	add(api, "execute", func(name string, args []any, kwargs map[string]any) (any, error) {
+		if _, err := bindScriptArgs(name, nil, kwargs); err != nil {
+			return nil, err
+		}
+		if len(args) < 1 {
+			return nil, fmt.Errorf("execute() is missing argument command")
+		}
+		return runCommandFromScript("execute", args)
+	})
+	for command, params := range map[string][]string{"create": {"path", "contents?"}, "update": {"path", "contents"}, "delete": {"path"}, "read": {"path"}} {
+		add(api, command, func(name string, args []any, kwargs map[string]any) (any, error) {
+			values, err := bindScriptArgs(name, args, kwargs, params...)
+			if err != nil {
+				return nil, err
+			}
+			return runCommandFromScript(name, values)
+		})
+	}
+	add(api, "send", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "method", "destaddr", "destport?", "protocol?", "body?")
+		if err != nil {
+			return nil, err
+		}
+		// (the port defaults to the protocol's, if the protocol or body's given)
+		if values[2] != nil || values[3] != nil || values[4] != nil {
+			if values[3] == nil {
+				values[3] = "http"
+			}
+			if values[2] == nil {
+				values[2] = 80
+				if values[3] == "https" {
+					values[2] = 443
+				}
+			}
+		}
+		return runCommandFromScript("send", values)
+	})
+
+	add(api, "log", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "message", "status?")
+		if err != nil {
+			return nil, err
+		}
+		status := "completed"
+		if values[1] != nil {
+			status, err = getScriptString("status", values[1], false)
+			if err != nil {
+				return nil, err
+			}
+			if !containsString(KnownStatuses, status) {
+				return nil, fmt.Errorf("unknown status '%s'", status)
+			}
+		}
+		entry := newChildLogEntry(parent, "script")
+		entry.method = "log"
+		entry.path = parent.path
+		entry.status = status
+		entry.details = escapeRawText(formatScriptValue(values[0], false))
+		writeLogEntry(activityLog, entry)
+		return nil, nil
+	})
+	add(api, "sleep", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "duration")
+		if err != nil {
+			return nil, err
+		}
+		// (in seconds, or as a duration, ie. "1m30s")
+		var duration time.Duration
+		if seconds, ok := toScriptFloat(values[0]); ok {
+			duration = time.Duration(seconds * float64(time.Second))
+		} else if text, ok := values[0].(string); ok {
+			if duration, err = time.ParseDuration(text); err != nil {
+				return nil, fmt.Errorf("invalid duration '%s'", text)
+			}
+		} else {
+			return nil, fmt.Errorf("duration must be a number of seconds or a string, not %s", getScriptType(values[0]))
+		}
+		return nil, sleepContext(duration)
+	})
+
+	random := rand.New(rand.NewSource(options.seed))
+	randomMembers := map[string]any{}
+	add(randomMembers, "randint", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs("random." + name, args, kwargs, "a", "b")
+		if err != nil {
+			return nil, err
+		}
+		a, err := getScriptInt("a", values[0])
+		if err != nil {
+			return nil, err
+		}
+		b, err := getScriptInt("b", values[1])
+		if err != nil {
+			return nil, err
+		}
+		if b < a {
+			return nil, fmt.Errorf("random.randint's b (%d) is less than a (%d)", b, a)
+		}
+		return a + random.Intn(b - a + 1), nil
+	})
+	add(randomMembers, "random", func(name string, args []any, kwargs map[string]any) (any, error) {
+		_, err := bindScriptArgs("random." + name, args, kwargs)
+		return random.Float64(), err
+	})
+	add(randomMembers, "choice", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs("random." + name, args, kwargs, "seq")
+		if err != nil {
+			return nil, err
+		}
+		items, err := getScriptItems(values[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("random.choice from nothing")
+		}
+		return items[random.Intn(len(items))], nil
+	})
+	add(randomMembers, "shuffle", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs("random." + name, args, kwargs, "list")
+		if err != nil {
+			return nil, err
+		}
+		list, ok := values[0].(*ScriptList)
+		if !ok {
+			return nil, fmt.Errorf("list must be a list, not %s", getScriptType(values[0]))
+		}
+		random.Shuffle(len(list.items), func(i int, j int) {
+			list.items[i], list.items[j] = list.items[j], list.items[i]
+		})
+		return nil, nil
+	})
+	api["random"] = &ScriptModule{name: "random", members: randomMembers}
+
+	vars := newScriptDict()
+	for _, assignment := range options.vars {
+		name, value, _ := strings.Cut(assignment, "=")
+		vars.set(name, value)
+	}
+	api["vars"] = vars
+	api["os"] = parent.os
+	api["elevated"] = parent.elevated == "true"
+	return api
+}
+
+// Gets what a script's told about a command it ran: its entry's columns (unescaped), whether it failed (and why), and for a send, the
+// response's status code and body
+func getScriptResult(entry *ActivityLogEntry, err error) *ScriptDict {
+	result := newScriptDict()
+	result.set("status", entry.status)
+	result.set("failed", err != nil || isFailureStatus(entry.status))
+	result.set("details", unescapeRawText(entry.details))
+	result.set("path", unescapeRawText(entry.path))
+	result.set("method", unescapeRawText(entry.method))
+	result.set("destAddr", unescapeRawText(entry.destAddr))
+	result.set("destPort", entry.destPort)
+	result.set("bytesSent", entry.bytesSent)
+	result.set("bytesReceived", entry.bytesReceived)
+	result.set("pid", entry.processId)
+	if entry.response != nil {
+		result.set("statusCode", entry.response.statusCode)
+		result.set("body", entry.response.body)
+	}
+	if err != nil {
+		result.set("error", err.Error())
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Script(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	scriptPath := dir + "/drop.star"
+	assert.Nil(t, os.WriteFile(scriptPath, []byte(`
+count = int(vars.get("count", "1"))
+for i in range(count):
+    path = vars["workdir"] + "/file-{}.txt".format(i)
+    if create(path, "contents " + str(i))["failed"]:
+        fail("couldn't create " + path)
+    read(path)
+    delete(path)
+
+response = send("GET", vars["host"], int(vars["port"]))
+if response["statusCode"] == 200 and response["body"] == "pong":
+    log("got " + response["body"])
+print("picked", random.choice(["a", "b", "c"]), "on", os)
+`), 0644))
+
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "script", "-seed=3", scriptPath, "count=2", "workdir=" + dir, "host=" + host, "port=" + port})
+	assert.Contains(t, output, "picked ")
+	assert.Contains(t, output, "Ran 7 commands from script " + scriptPath + " (0 failed)")
+	assert.Equal(t, "script", activityLogEntry.activity)
+	assert.Equal(t, "completed", activityLogEntry.status)
+	assert.Equal(t, "7 commands run\\, 0 failed\\, seed 3", activityLogEntry.details)
+	assert.NoFileExists(t, dir + "/file-0.txt")
+	contents, err := os.ReadFile(logFilePath)
+	assert.Nil(t, err)
+	for _, activity := range []string{",create,", ",read,", ",delete,", ",send,", ",script,"} {
+		assert.Contains(t, string(contents), activity)
+	}
+	// (the commands, and the log entry, share the script's correlation ID)
+	assert.Equal(t, 9, strings.Count(string(contents), activityLogEntry.correlationId))
+
+	// The same seed makes the same choices
+	again := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "script", "-seed=3", scriptPath, "count=0", "workdir=" + dir, "host=" + host, "port=" + port})
+	picked := func(output string) string {
+		return output[strings.Index(output, "picked "):][:len("picked a")]
+	}
+	assert.Equal(t, picked(output), picked(again))
+}
+
+func TestMain_Script_Failures(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	scriptPath := dir + "/fail.star"
+	assert.Nil(t, os.WriteFile(scriptPath, []byte("result = read('" + dir + "/missing.txt')\nif result['failed']:\n    fail('read says', result['status'])\n"), 0644))
+
+	output := callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "script", scriptPath})
+	assert.Contains(t, output, "Script " + scriptPath + " failed: line 3: fail: read says not_found")
+	assert.Equal(t, "error", activityLogEntry.status)
+	assert.Contains(t, activityLogEntry.details, "1 commands run\\, 1 failed")
+
+	// A script can't run a playbook (or another script)
+	assert.Nil(t, os.WriteFile(scriptPath, []byte("run('playbook', 'other.yaml')\n"), 0644))
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "script", scriptPath})
+	assert.Equal(t, "error", activityLogEntry.status)
+	assert.Contains(t, activityLogEntry.details, "line 1: a script can't run playbook")
+
+	// A syntax error stops it before anything's run
+	assert.Nil(t, os.WriteFile(scriptPath, []byte("create('" + dir + "/never.txt')\nif True\n"), 0644))
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "script", scriptPath}, "invalid script " + scriptPath + ": line 2: expected ':', found the end of the line")
+	assert.NoFileExists(t, dir + "/never.txt")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "script"}, "not enough arguments for script!")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-logfile=" + logFilePath, "script", scriptPath, "novalue"}, "invalid script variable 'novalue' (must be name=value)")
+}
@@ -0,0 +1,2632 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A small dialect of Starlark (itself a dialect of Python) for scripts: values, operators, if/elif/else, for loops (over lists, tuples,
+// dicts, and ranges), def, list comprehensions, and the builtins below. As in Starlark, there's no while, and functions can't call
+// themselves, so every script finishes; unlike it, there's no load, lambda, set, or *args.
+
+// A token of a script
+type ScriptToken struct {
+	kind				string		// [name, int, float, string, op, newline, indent, dedent, eof]
+	text				string
+	line				int
+}
+
+// An error in a script, at the line it's on
+type ScriptError struct {
+	line				int
+	message				string
+}
+
+// The names a variable can't have
+var ScriptKeywords = []string{"and", "break", "continue", "def", "elif", "else", "for", "if", "in", "not", "or", "pass", "return", "True", "False", "None"}
+
+// The operators, longest first
+var ScriptOperators = []string{"//=", "==", "!=", "<=", ">=", "+=", "-=", "*=", "/=", "%=", "//", "+", "-", "*", "/", "%", "<", ">", "=", "(", ")", "[", "]", "{", "}", ",", ":", ".", ";"}
+
+// The longest list range can make (so a typo can't exhaust memory)
+const MaxScriptRange = 10000000
+
+// The longest string (in bytes) or list (in items) repeating, concatenating, joining, or replacing can make (for the same reason)
+const MaxScriptLength = 10000000
+
+func (err *ScriptError) Error() string {
+	return fmt.Sprintf("line %d: %s", err.line, err.message)
+}
+
+// =====================================================================
+// Tokens
+// =====================================================================
+
+// Splits the script into tokens, with indent and dedent tokens where its blocks start and end (newlines inside brackets are ignored)
+func tokenizeScript(source string) ([]*ScriptToken, error) {
+	tokens := []*ScriptToken{}
+	indents := []int{0}
+	depth := 0
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	for n := 0; n < len(lines); n++ {
+		line, i := lines[n], 0
+		if depth == 0 {
+			// (blank lines, and ones with only a comment, don't start or end a block)
+			width := 0
+			for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+				if line[i] == '\t' {
+					width += 8 - width % 8
+				} else {
+					width++
+				}
+				i++
+			}
+			if i == len(line) || line[i] == '#' {
+				continue
+			}
+			if width > indents[len(indents) - 1] {
+				indents = append(indents, width)
+				tokens = append(tokens, &ScriptToken{kind: "indent", line: n + 1})
+			}
+			for width < indents[len(indents) - 1] {
+				indents = indents[:len(indents) - 1]
+				tokens = append(tokens, &ScriptToken{kind: "dedent", line: n + 1})
+			}
+			if width != indents[len(indents) - 1] {
+				return nil, &ScriptError{n + 1, "unindent doesn't match any outer indentation"}
+			}
+		}
+
+		for i < len(line) {
+			c := line[i]
+			switch {
+			case c == ' ' || c == '\t':
+				i++
+			case c == '#':
+				i = len(line)
+			case isScriptNameChar(c, false):
+				end := i
+				for end < len(line) && isScriptNameChar(line[end], true) {
+					end++
+				}
+				tokens = append(tokens, &ScriptToken{kind: "name", text: line[i:end], line: n + 1})
+				i = end
+			case c >= '0' && c <= '9':
+				end, kind := i, "int"
+				for end < len(line) && (line[end] >= '0' && line[end] <= '9' || line[end] == '.' && kind == "int") {
+					if line[end] == '.' {
+						kind = "float"
+					}
+					end++
+				}
+				// (with an exponent, ie. 1e3 or 2.5E-2)
+				if exponent := strings.TrimLeft(line[min(end + 1, len(line)):], "+-"); end < len(line) && (line[end] == 'e' || line[end] == 'E') && exponent != "" && exponent[0] >= '0' && exponent[0] <= '9' {
+					kind, end = "float", len(line) - len(exponent)
+					for end < len(line) && line[end] >= '0' && line[end] <= '9' {
+						end++
+					}
+				}
+				tokens = append(tokens, &ScriptToken{kind: kind, text: line[i:end], line: n + 1})
+				i = end
+			case c == '"' || c == '\'':
+				// (a triple-quoted string can carry on over several lines)
+				text, end, endLine, err := scanScriptString(lines, n, i)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, &ScriptToken{kind: "string", text: text, line: n + 1})
+				n, line, i = endLine, lines[endLine], end
+			default:
+				op := ""
+				for _, candidate := range ScriptOperators {
+					if strings.HasPrefix(line[i:], candidate) {
+						op = candidate
+						break
+					}
+				}
+				if op == "" {
+					return nil, &ScriptError{n + 1, fmt.Sprintf("unexpected character '%c'", c)}
+				}
+				switch op {
+				case "(", "[", "{":
+					depth++
+				case ")", "]", "}":
+					depth--
+				}
+				if depth < 0 {
+					return nil, &ScriptError{n + 1, fmt.Sprintf("unexpected '%s'", op)}
+				}
+				tokens = append(tokens, &ScriptToken{kind: "op", text: op, line: n + 1})
+				i += len(op)
+			}
+		}
+		if depth == 0 && len(tokens) > 0 && tokens[len(tokens) - 1].kind != "newline" {
+			tokens = append(tokens, &ScriptToken{kind: "newline", line: n + 1})
+		}
+	}
+	if depth > 0 {
+		return nil, &ScriptError{len(lines), "unclosed bracket at the end of the script"}
+	}
+	for len(indents) > 1 {
+		indents = indents[:len(indents) - 1]
+		tokens = append(tokens, &ScriptToken{kind: "dedent", line: len(lines)})
+	}
+	return append(tokens, &ScriptToken{kind: "eof", line: len(lines)}), nil
+}
+
+// Whether the character can be in a name (or start one)
+func isScriptNameChar(c byte, digits bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || digits && c >= '0' && c <= '9'
+}
+
+// Scans the string starting at lines[n][i] (in single, double, or triple quotes), returning its text (with escapes replaced), and the
+// line and position just after it
+func scanScriptString(lines []string, n int, i int) (string, int, int, error) {
+	quote := string(lines[n][i])
+	triple := strings.HasPrefix(lines[n][i:], strings.Repeat(quote, 3))
+	closing, j, start := quote, i + 1, n
+	if triple {
+		closing, j = strings.Repeat(quote, 3), i + 3
+	}
+	var text strings.Builder
+	for {
+		line := lines[n]
+		for j < len(line) {
+			switch {
+			case line[j] == '\\' && j + 1 < len(line):
+				escapes := map[byte]string{'n': "\n", 't': "\t", 'r': "\r", '\\': "\\", '\'': "'", '"': "\"", '0': "\x00"}
+				if escaped, found := escapes[line[j + 1]]; found {
+					text.WriteString(escaped)
+				} else {
+					text.WriteString(line[j:j + 2])
+				}
+				j += 2
+			case strings.HasPrefix(line[j:], closing):
+				return text.String(), j + len(closing), n, nil
+			default:
+				text.WriteByte(line[j])
+				j++
+			}
+		}
+		if !triple || n + 1 == len(lines) {
+			return "", 0, 0, &ScriptError{start + 1, "unterminated string"}
+		}
+		text.WriteByte('\n')
+		n, j = n + 1, 0
+	}
+}
+
+// =====================================================================
+// Syntax
+// =====================================================================
+
+// The expressions and statements a script's made of
+type ScriptExpr any
+type ScriptStmt any
+
+type ScriptLiteral struct {
+	value				any
+}
+
+type ScriptName struct {
+	name				string
+}
+
+type ScriptListExpr struct {
+	items				[]ScriptExpr
+}
+
+type ScriptTupleExpr struct {
+	items				[]ScriptExpr
+}
+
+type ScriptDictExpr struct {
+	keys				[]ScriptExpr
+	values				[]ScriptExpr
+}
+
+// [element for target in iterable if condition]
+type ScriptComprehension struct {
+	element				ScriptExpr
+	target				ScriptExpr
+	iterable			ScriptExpr
+	condition			ScriptExpr		// (nil if there isn't one)
+}
+
+type ScriptUnaryExpr struct {
+	op					string
+	operand				ScriptExpr
+}
+
+type ScriptBinaryExpr struct {
+	op					string
+	left				ScriptExpr
+	right				ScriptExpr
+}
+
+// then if condition else otherwise
+type ScriptConditionalExpr struct {
+	condition			ScriptExpr
+	then				ScriptExpr
+	otherwise			ScriptExpr
+}
+
+type ScriptCallExpr struct {
+	function			ScriptExpr
+	args				[]ScriptExpr
+	keywords			[]string
+	keywordArgs			[]ScriptExpr
+}
+
+type ScriptIndexExpr struct {
+	operand				ScriptExpr
+	index				ScriptExpr
+}
+
+// operand[low:high]
+type ScriptSliceExpr struct {
+	operand				ScriptExpr
+	low					ScriptExpr		// (nil for the start)
+	high				ScriptExpr		// (nil for the end)
+}
+
+type ScriptAttrExpr struct {
+	operand				ScriptExpr
+	name				string
+}
+
+type ScriptExprStmt struct {
+	line				int
+	expr				ScriptExpr
+}
+
+// target = value (or +=, and the other augmented assignments)
+type ScriptAssignStmt struct {
+	line				int
+	target				ScriptExpr
+	op					string
+	value				ScriptExpr
+}
+
+// if condition: body (else: otherwise, which has the elifs)
+type ScriptIfStmt struct {
+	line				int
+	condition			ScriptExpr
+	body				[]ScriptStmt
+	otherwise			[]ScriptStmt
+}
+
+type ScriptForStmt struct {
+	line				int
+	target				ScriptExpr
+	iterable			ScriptExpr
+	body				[]ScriptStmt
+}
+
+type ScriptDefStmt struct {
+	line				int
+	name				string
+	params				[]string
+	defaults			[]ScriptExpr	// (nil for the params without a default)
+	body				[]ScriptStmt
+}
+
+type ScriptReturnStmt struct {
+	line				int
+	value				ScriptExpr		// (nil for None)
+}
+
+// break, continue, or pass
+type ScriptBranchStmt struct {
+	line				int
+	keyword				string
+}
+
+// Parses a script's tokens, keeping track of whether it's in a loop or a function (for break, continue, and return)
+type ScriptParser struct {
+	tokens				[]*ScriptToken
+	pos					int
+	loops				int
+	functions			int
+}
+
+// Parses a script into its statements
+func parseScript(source string) ([]ScriptStmt, error) {
+	tokens, err := tokenizeScript(source)
+	if err != nil {
+		return nil, err
+	}
+	parser := &ScriptParser{tokens: tokens}
+	stmts := []ScriptStmt{}
+	for parser.peek().kind != "eof" {
+		parsed, err := parser.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, parsed...)
+	}
+	return stmts, nil
+}
+
+func (parser *ScriptParser) peek() *ScriptToken {
+	return parser.tokens[parser.pos]
+}
+
+func (parser *ScriptParser) next() *ScriptToken {
+	token := parser.tokens[parser.pos]
+	if token.kind != "eof" {
+		parser.pos++
+	}
+	return token
+}
+
+// Whether the next token is the operator or keyword
+func (parser *ScriptParser) is(text string) bool {
+	token := parser.peek()
+	return (token.kind == "op" || token.kind == "name") && token.text == text
+}
+
+// Moves past the next token if it's the operator or keyword
+func (parser *ScriptParser) accept(text string) bool {
+	if parser.is(text) {
+		parser.next()
+		return true
+	}
+	return false
+}
+
+func (parser *ScriptParser) expect(text string) error {
+	if !parser.accept(text) {
+		return parser.unexpected("expected '" + text + "'")
+	}
+	return nil
+}
+
+// An error for the next token, which isn't what was expected
+func (parser *ScriptParser) unexpected(expected string) error {
+	token := parser.peek()
+	found := map[string]string{"eof": "the end of the script", "newline": "the end of the line", "indent": "indent", "dedent": "unindent"}[token.kind]
+	if found == "" {
+		found = "'" + token.text + "'"
+	}
+	if token.kind == "string" {
+		found = "a string"
+	}
+	if expected == "" {
+		return &ScriptError{token.line, "unexpected " + found}
+	}
+	return &ScriptError{token.line, expected + ", found " + found}
+}
+
+func (parser *ScriptParser) parseStatement() ([]ScriptStmt, error) {
+	switch {
+	case parser.is("if"):
+		stmt, err := parser.parseIf()
+		return []ScriptStmt{stmt}, err
+	case parser.is("for"):
+		stmt, err := parser.parseFor()
+		return []ScriptStmt{stmt}, err
+	case parser.is("def"):
+		stmt, err := parser.parseDef()
+		return []ScriptStmt{stmt}, err
+	case parser.is("while"):
+		return nil, &ScriptError{parser.peek().line, "while isn't supported (use a for loop over a range)"}
+	}
+	return parser.parseSimpleStatements()
+}
+
+// Parses the statements on a line (separated by semicolons)
+func (parser *ScriptParser) parseSimpleStatements() ([]ScriptStmt, error) {
+	stmts := []ScriptStmt{}
+	for {
+		stmt, err := parser.parseSimpleStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+		if !parser.accept(";") || parser.peek().kind == "newline" {
+			break
+		}
+	}
+	if parser.peek().kind != "newline" {
+		return nil, parser.unexpected("expected the end of the line")
+	}
+	parser.next()
+	return stmts, nil
+}
+
+func (parser *ScriptParser) parseSimpleStatement() (ScriptStmt, error) {
+	line := parser.peek().line
+	switch {
+	case parser.is("pass"), parser.is("break"), parser.is("continue"):
+		keyword := parser.next().text
+		if keyword != "pass" && parser.loops == 0 {
+			return nil, &ScriptError{line, keyword + " outside a loop"}
+		}
+		return &ScriptBranchStmt{line: line, keyword: keyword}, nil
+	case parser.accept("return"):
+		if parser.functions == 0 {
+			return nil, &ScriptError{line, "return outside a function"}
+		}
+		if parser.peek().kind == "newline" || parser.is(";") {
+			return &ScriptReturnStmt{line: line}, nil
+		}
+		value, err := parser.parseExprList()
+		return &ScriptReturnStmt{line: line, value: value}, err
+	}
+
+	expr, err := parser.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "+=", "-=", "*=", "/=", "//=", "%="} {
+		if parser.accept(op) {
+			if !isScriptAssignable(expr, op == "=") {
+				return nil, &ScriptError{line, "can't assign to that expression"}
+			}
+			value, err := parser.parseExprList()
+			return &ScriptAssignStmt{line: line, target: expr, op: op, value: value}, err
+		}
+	}
+	return &ScriptExprStmt{line: line, expr: expr}, nil
+}
+
+// Whether the expression can be assigned to: a name, an item (ie. x[0]), or (unless it's augmented) a tuple or list of them
+func isScriptAssignable(expr ScriptExpr, unpack bool) bool {
+	switch expr := expr.(type) {
+	case *ScriptName, *ScriptIndexExpr:
+		return true
+	case *ScriptTupleExpr:
+		return unpack && areScriptAssignable(expr.items)
+	case *ScriptListExpr:
+		return unpack && areScriptAssignable(expr.items)
+	}
+	return false
+}
+
+func areScriptAssignable(exprs []ScriptExpr) bool {
+	for _, expr := range exprs {
+		if !isScriptAssignable(expr, true) {
+			return false
+		}
+	}
+	return len(exprs) > 0
+}
+
+// Parses a block: the indented statements after a colon (or the statements after it, on the same line)
+func (parser *ScriptParser) parseBlock() ([]ScriptStmt, error) {
+	if err := parser.expect(":"); err != nil {
+		return nil, err
+	}
+	if parser.peek().kind != "newline" {
+		return parser.parseSimpleStatements()
+	}
+	parser.next()
+	if parser.peek().kind != "indent" {
+		return nil, parser.unexpected("expected an indented block")
+	}
+	parser.next()
+	stmts := []ScriptStmt{}
+	for parser.peek().kind != "dedent" && parser.peek().kind != "eof" {
+		parsed, err := parser.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, parsed...)
+	}
+	parser.next()
+	return stmts, nil
+}
+
+// Parses an if (or an elif, as the else of the one before it)
+func (parser *ScriptParser) parseIf() (ScriptStmt, error) {
+	stmt := &ScriptIfStmt{line: parser.next().line}
+	var err error
+	if stmt.condition, err = parser.parseExpr(); err != nil {
+		return nil, err
+	}
+	if stmt.body, err = parser.parseBlock(); err != nil {
+		return nil, err
+	}
+	if parser.is("elif") {
+		elif, err := parser.parseIf()
+		stmt.otherwise = []ScriptStmt{elif}
+		return stmt, err
+	}
+	if parser.accept("else") {
+		stmt.otherwise, err = parser.parseBlock()
+	}
+	return stmt, err
+}
+
+func (parser *ScriptParser) parseFor() (ScriptStmt, error) {
+	stmt := &ScriptForStmt{line: parser.next().line}
+	var err error
+	if stmt.target, err = parser.parseTargets(); err != nil {
+		return nil, err
+	}
+	if err = parser.expect("in"); err != nil {
+		return nil, err
+	}
+	if stmt.iterable, err = parser.parseExprList(); err != nil {
+		return nil, err
+	}
+	parser.loops++
+	stmt.body, err = parser.parseBlock()
+	parser.loops--
+	return stmt, err
+}
+
+// Parses the targets of a for loop (or a comprehension), ie. "k, v"
+func (parser *ScriptParser) parseTargets() (ScriptExpr, error) {
+	targets := []ScriptExpr{}
+	for {
+		target, err := parser.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+		if !parser.accept(",") {
+			break
+		}
+	}
+	var target ScriptExpr = &ScriptTupleExpr{items: targets}
+	if len(targets) == 1 {
+		target = targets[0]
+	}
+	if !isScriptAssignable(target, true) {
+		return nil, &ScriptError{parser.peek().line, "can't assign to that expression"}
+	}
+	return target, nil
+}
+
+func (parser *ScriptParser) parseDef() (ScriptStmt, error) {
+	stmt := &ScriptDefStmt{line: parser.next().line}
+	name := parser.peek()
+	if name.kind != "name" || containsString(ScriptKeywords, name.text) {
+		return nil, parser.unexpected("expected the function's name")
+	}
+	parser.next()
+	stmt.name = name.text
+	if err := parser.expect("("); err != nil {
+		return nil, err
+	}
+	for !parser.accept(")") {
+		param := parser.peek()
+		if param.kind != "name" || containsString(ScriptKeywords, param.text) || containsString(stmt.params, param.text) {
+			return nil, parser.unexpected("expected a parameter name")
+		}
+		parser.next()
+		var defaultValue ScriptExpr
+		if parser.accept("=") {
+			var err error
+			if defaultValue, err = parser.parseExpr(); err != nil {
+				return nil, err
+			}
+		} else if len(stmt.defaults) > 0 && stmt.defaults[len(stmt.defaults) - 1] != nil {
+			return nil, &ScriptError{param.line, fmt.Sprintf("parameter %s needs a default, since the ones before it have one", param.text)}
+		}
+		stmt.params = append(stmt.params, param.text)
+		stmt.defaults = append(stmt.defaults, defaultValue)
+		if !parser.is(")") {
+			if err := parser.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// (a loop around the def doesn't make break valid in its body)
+	loops := parser.loops
+	parser.loops = 0
+	parser.functions++
+	var err error
+	stmt.body, err = parser.parseBlock()
+	parser.functions--
+	parser.loops = loops
+	return stmt, err
+}
+
+// Parses one or more expressions separated by commas (more than one is a tuple)
+func (parser *ScriptParser) parseExprList() (ScriptExpr, error) {
+	expr, err := parser.parseExpr()
+	if err != nil || !parser.is(",") {
+		return expr, err
+	}
+	items := []ScriptExpr{expr}
+	for parser.accept(",") {
+		// (a trailing comma's allowed)
+		if token := parser.peek(); token.kind == "newline" || token.kind == "eof" || (token.kind == "op" && containsString(ScriptTupleEnds, token.text)) {
+			break
+		}
+		item, err := parser.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return &ScriptTupleExpr{items: items}, nil
+}
+
+func (parser *ScriptParser) parseExpr() (ScriptExpr, error) {
+	expr, err := parser.parseBinary(0)
+	if err != nil || !parser.accept("if") {
+		return expr, err
+	}
+	condition, err := parser.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if err = parser.expect("else"); err != nil {
+		return nil, err
+	}
+	otherwise, err := parser.parseExpr()
+	return &ScriptConditionalExpr{condition: condition, then: expr, otherwise: otherwise}, err
+}
+
+// The tokens that can end a tuple (after a trailing comma)
+var ScriptTupleEnds = []string{")", "]", "}", ";", ":", "=", "+=", "-=", "*=", "/=", "//=", "%="}
+
+// The binary operators, from the loosest binding to the tightest ("not" comes between "and" and the comparisons)
+var ScriptBinaryOperators = [][]string{{"or"}, {"and"}, {"==", "!=", "<", "<=", ">", ">=", "in", "not in"}, {"+", "-"}, {"*", "/", "//", "%"}}
+
+// Parses the binary operators of the level and tighter (each left-associative, except the comparisons, which can't be chained)
+func (parser *ScriptParser) parseBinary(level int) (ScriptExpr, error) {
+	if level == len(ScriptBinaryOperators) {
+		return parser.parseUnary()
+	}
+	if level == 2 && parser.accept("not") {
+		operand, err := parser.parseBinary(2)
+		return &ScriptUnaryExpr{op: "not", operand: operand}, err
+	}
+	left, err := parser.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		token := parser.peek()
+		if token.kind == "op" || token.kind == "name" {
+			op = token.text
+		}
+		if op == "not" && parser.tokens[parser.pos + 1].kind == "name" && parser.tokens[parser.pos + 1].text == "in" {
+			op = "not in"
+		}
+		if !containsString(ScriptBinaryOperators[level], op) {
+			return left, nil
+		}
+		parser.pos += len(strings.Fields(op))
+		right, err := parser.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &ScriptBinaryExpr{op: op, left: left, right: right}
+		if level == 2 {
+			if token := parser.peek(); containsString(ScriptBinaryOperators[2], token.text) && token.kind != "string" {
+				return nil, &ScriptError{token.line, "comparisons can't be chained (use and)"}
+			}
+			return left, nil
+		}
+	}
+}
+
+func (parser *ScriptParser) parseUnary() (ScriptExpr, error) {
+	if parser.is("-") || parser.is("+") {
+		op := parser.next().text
+		operand, err := parser.parseUnary()
+		return &ScriptUnaryExpr{op: op, operand: operand}, err
+	}
+	return parser.parsePrimary()
+}
+
+// Parses an operand, with any calls, indexes, slices, and attributes after it
+func (parser *ScriptParser) parsePrimary() (ScriptExpr, error) {
+	expr, err := parser.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case parser.accept("("):
+			call := &ScriptCallExpr{function: expr}
+			for !parser.accept(")") {
+				if token := parser.peek(); token.kind == "name" && parser.tokens[parser.pos + 1].kind == "op" && parser.tokens[parser.pos + 1].text == "=" {
+					parser.pos += 2
+					value, err := parser.parseExpr()
+					if err != nil {
+						return nil, err
+					}
+					call.keywords = append(call.keywords, token.text)
+					call.keywordArgs = append(call.keywordArgs, value)
+				} else {
+					if len(call.keywords) > 0 {
+						return nil, &ScriptError{token.line, "positional argument after a keyword argument"}
+					}
+					arg, err := parser.parseExpr()
+					if err != nil {
+						return nil, err
+					}
+					call.args = append(call.args, arg)
+				}
+				if !parser.is(")") {
+					if err := parser.expect(","); err != nil {
+						return nil, err
+					}
+				}
+			}
+			expr = call
+		case parser.accept("["):
+			var index, high ScriptExpr
+			if !parser.is(":") {
+				if index, err = parser.parseExpr(); err != nil {
+					return nil, err
+				}
+			}
+			if parser.accept(":") {
+				if !parser.is("]") {
+					if high, err = parser.parseExpr(); err != nil {
+						return nil, err
+					}
+				}
+				expr = &ScriptSliceExpr{operand: expr, low: index, high: high}
+			} else {
+				expr = &ScriptIndexExpr{operand: expr, index: index}
+			}
+			if err = parser.expect("]"); err != nil {
+				return nil, err
+			}
+		case parser.accept("."):
+			name := parser.peek()
+			if name.kind != "name" {
+				return nil, parser.unexpected("expected an attribute name")
+			}
+			parser.next()
+			expr = &ScriptAttrExpr{operand: expr, name: name.text}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func (parser *ScriptParser) parseOperand() (ScriptExpr, error) {
+	start := parser.pos
+	token := parser.next()
+	switch token.kind {
+	case "name":
+		switch token.text {
+		case "True", "False":
+			return &ScriptLiteral{value: token.text == "True"}, nil
+		case "None":
+			return &ScriptLiteral{value: nil}, nil
+		}
+		if containsString(ScriptKeywords, token.text) {
+			parser.pos = start
+			return nil, parser.unexpected("")
+		}
+		return &ScriptName{name: token.text}, nil
+	case "int":
+		value, err := strconv.Atoi(token.text)
+		if err != nil {
+			return nil, &ScriptError{token.line, fmt.Sprintf("invalid int %s", token.text)}
+		}
+		return &ScriptLiteral{value: value}, nil
+	case "float":
+		value, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, &ScriptError{token.line, fmt.Sprintf("invalid float %s", token.text)}
+		}
+		return &ScriptLiteral{value: value}, nil
+	case "string":
+		// (strings next to each other are joined)
+		text := token.text
+		for parser.peek().kind == "string" {
+			text += parser.next().text
+		}
+		return &ScriptLiteral{value: text}, nil
+	case "op":
+		switch token.text {
+		case "(":
+			if parser.accept(")") {
+				return &ScriptTupleExpr{}, nil
+			}
+			expr, err := parser.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			return expr, parser.expect(")")
+		case "[":
+			return parser.parseList()
+		case "{":
+			dict := &ScriptDictExpr{}
+			for !parser.accept("}") {
+				key, err := parser.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				if err = parser.expect(":"); err != nil {
+					return nil, err
+				}
+				value, err := parser.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				dict.keys = append(dict.keys, key)
+				dict.values = append(dict.values, value)
+				if !parser.is("}") {
+					if err := parser.expect(","); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return dict, nil
+		}
+	}
+	parser.pos = start
+	return nil, parser.unexpected("")
+}
+
+// Parses a list (after its opening bracket), or a list comprehension
+func (parser *ScriptParser) parseList() (ScriptExpr, error) {
+	if parser.accept("]") {
+		return &ScriptListExpr{}, nil
+	}
+	first, err := parser.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.accept("for") {
+		comprehension := &ScriptComprehension{element: first}
+		if comprehension.target, err = parser.parseTargets(); err != nil {
+			return nil, err
+		}
+		if err = parser.expect("in"); err != nil {
+			return nil, err
+		}
+		if comprehension.iterable, err = parser.parseBinary(0); err != nil {
+			return nil, err
+		}
+		if parser.accept("if") {
+			if comprehension.condition, err = parser.parseBinary(0); err != nil {
+				return nil, err
+			}
+		}
+		return comprehension, parser.expect("]")
+	}
+	list := &ScriptListExpr{items: []ScriptExpr{first}}
+	for parser.accept(",") && !parser.is("]") {
+		item, err := parser.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list.items = append(list.items, item)
+	}
+	return list, parser.expect("]")
+}
+
+// =====================================================================
+// Values
+// =====================================================================
+
+// A script's values are nil (None), bool, int, float64, string, and these
+type ScriptList struct {
+	items				[]any
+}
+
+type ScriptTuple []any
+
+// A dict, which keeps its keys in the order they were added
+type ScriptDict struct {
+	keys				[]any
+	values				map[any]any
+}
+
+// A function defined in the script, with the variables it was defined among
+type ScriptFunction struct {
+	def					*ScriptDefStmt
+	defaults			[]any
+	env					*ScriptEnv
+}
+
+// A function implemented in Go, with the positional and keyword args it was called with
+type ScriptBuiltin struct {
+	name				string
+	call				func(args []any, kwargs map[string]any) (any, error)
+}
+
+// A set of builtins under a name, ie. random.randint
+type ScriptModule struct {
+	name				string
+	members				map[string]any
+}
+
+func newScriptDict() *ScriptDict {
+	return &ScriptDict{values: map[any]any{}}
+}
+
+func (dict *ScriptDict) get(key any) (any, bool, error) {
+	if err := checkScriptHashable(key); err != nil {
+		return nil, false, err
+	}
+	value, found := dict.values[key]
+	return value, found, nil
+}
+
+func (dict *ScriptDict) set(key any, value any) error {
+	if err := checkScriptHashable(key); err != nil {
+		return err
+	}
+	if _, found := dict.values[key]; !found {
+		dict.keys = append(dict.keys, key)
+	}
+	dict.values[key] = value
+	return nil
+}
+
+func (dict *ScriptDict) remove(key any) {
+	delete(dict.values, key)
+	for i, existing := range dict.keys {
+		if existing == key {
+			dict.keys = append(dict.keys[:i], dict.keys[i + 1:]...)
+			return
+		}
+	}
+}
+
+// Only None, bools, numbers, and strings can be dict keys
+func checkScriptHashable(key any) error {
+	switch key.(type) {
+	case nil, bool, int, float64, string:
+		return nil
+	}
+	return fmt.Errorf("a %s can't be a dict key", getScriptType(key))
+}
+
+// Gets the name of the value's type, as type() does
+func getScriptType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "NoneType"
+	case bool:
+		return "bool"
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case *ScriptList:
+		return "list"
+	case ScriptTuple:
+		return "tuple"
+	case *ScriptDict:
+		return "dict"
+	case *ScriptFunction:
+		return "function"
+	case *ScriptBuiltin:
+		return "builtin_function_or_method"
+	case *ScriptModule:
+		return "module"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// Whether the value's true, in a condition (None, False, zero, and empty strings, lists, tuples, and dicts aren't)
+func isScriptTrue(value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case int:
+		return value != 0
+	case float64:
+		return value != 0
+	case string:
+		return value != ""
+	case *ScriptList:
+		return len(value.items) > 0
+	case ScriptTuple:
+		return len(value) > 0
+	case *ScriptDict:
+		return len(value.keys) > 0
+	}
+	return true
+}
+
+// Formats the value as str() does (or, quoted, as it's shown inside a list)
+func formatScriptValue(value any, quoted bool) string {
+	join := func(items []any) string {
+		formatted := []string{}
+		for _, item := range items {
+			formatted = append(formatted, formatScriptValue(item, true))
+		}
+		return strings.Join(formatted, ", ")
+	}
+	switch value := value.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if value {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(value)
+	case float64:
+		formatted := strconv.FormatFloat(value, 'g', -1, 64)
+		if !strings.ContainsAny(formatted, ".eIN") {
+			formatted += ".0"
+		}
+		return formatted
+	case string:
+		if quoted {
+			return strconv.Quote(value)
+		}
+		return value
+	case *ScriptList:
+		return "[" + join(value.items) + "]"
+	case ScriptTuple:
+		if len(value) == 1 {
+			return "(" + join(value) + ",)"
+		}
+		return "(" + join(value) + ")"
+	case *ScriptDict:
+		formatted := []string{}
+		for _, key := range value.keys {
+			formatted = append(formatted, formatScriptValue(key, true) + ": " + formatScriptValue(value.values[key], true))
+		}
+		return "{" + strings.Join(formatted, ", ") + "}"
+	case *ScriptFunction:
+		return "<function " + value.def.name + ">"
+	case *ScriptBuiltin:
+		return "<built-in function " + value.name + ">"
+	case *ScriptModule:
+		return "<module " + value.name + ">"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// Whether the values are equal (ints and floats are compared by value; lists, tuples, and dicts by their contents)
+func areScriptValuesEqual(left any, right any) bool {
+	switch left := left.(type) {
+	case int:
+		switch right := right.(type) {
+		case int:
+			return left == right
+		case float64:
+			return float64(left) == right
+		}
+		return false
+	case float64:
+		switch right := right.(type) {
+		case int:
+			return left == float64(right)
+		case float64:
+			return left == right
+		}
+		return false
+	case *ScriptList:
+		right, ok := right.(*ScriptList)
+		return ok && areScriptItemsEqual(left.items, right.items)
+	case ScriptTuple:
+		right, ok := right.(ScriptTuple)
+		return ok && areScriptItemsEqual(left, right)
+	case *ScriptDict:
+		right, ok := right.(*ScriptDict)
+		if !ok || len(left.keys) != len(right.keys) {
+			return false
+		}
+		for _, key := range left.keys {
+			value, found := right.values[key]
+			if !found || !areScriptValuesEqual(left.values[key], value) {
+				return false
+			}
+		}
+		return true
+	case nil, bool, string:
+		return left == right
+	}
+	return left == right
+}
+
+func areScriptItemsEqual(left []any, right []any) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if !areScriptValuesEqual(left[i], right[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Orders two numbers or two strings (-1, 0, or 1)
+func compareScriptValues(left any, right any) (int, error) {
+	if leftText, ok := left.(string); ok {
+		if rightText, ok := right.(string); ok {
+			return strings.Compare(leftText, rightText), nil
+		}
+	}
+	leftNumber, leftOk := toScriptFloat(left)
+	rightNumber, rightOk := toScriptFloat(right)
+	if !leftOk || !rightOk {
+		return 0, fmt.Errorf("can't compare %s with %s", getScriptType(left), getScriptType(right))
+	}
+	switch {
+	case leftNumber < rightNumber:
+		return -1, nil
+	case leftNumber > rightNumber:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func toScriptFloat(value any) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+// Gets the items of a list, tuple, or dict (its keys), to loop over (a copy, so the loop can change it)
+func getScriptItems(value any) ([]any, error) {
+	switch value := value.(type) {
+	case *ScriptList:
+		return append([]any{}, value.items...), nil
+	case ScriptTuple:
+		return append([]any{}, value...), nil
+	case *ScriptDict:
+		return append([]any{}, value.keys...), nil
+	}
+	return nil, fmt.Errorf("can't loop over a %s", getScriptType(value))
+}
+
+// Applies the binary operator (other than and and or, which don't always evaluate their right operand) to its operands
+func applyScriptOperator(op string, left any, right any) (any, error) {
+	switch op {
+	case "==":
+		return areScriptValuesEqual(left, right), nil
+	case "!=":
+		return !areScriptValuesEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		order, err := compareScriptValues(left, right)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]bool{"<": order < 0, "<=": order <= 0, ">": order > 0, ">=": order >= 0}[op], nil
+	case "in", "not in":
+		found, err := isScriptValueIn(left, right)
+		return found == (op == "in"), err
+	case "+":
+		switch left := left.(type) {
+		case string:
+			if right, ok := right.(string); ok {
+				err := checkScriptLength("string", len(left) + len(right), 1)
+				if err != nil {
+					return nil, err
+				}
+				return left + right, nil
+			}
+		case *ScriptList:
+			if right, ok := right.(*ScriptList); ok {
+				err := checkScriptLength("list", len(left.items) + len(right.items), 1)
+				if err != nil {
+					return nil, err
+				}
+				return &ScriptList{items: append(append([]any{}, left.items...), right.items...)}, nil
+			}
+		case ScriptTuple:
+			if right, ok := right.(ScriptTuple); ok {
+				err := checkScriptLength("tuple", len(left) + len(right), 1)
+				if err != nil {
+					return nil, err
+				}
+				return append(append(ScriptTuple{}, left...), right...), nil
+			}
+		}
+	case "*":
+		// (a string or list times an int repeats it)
+		swapped := false
+		if _, ok := left.(int); ok {
+			left, right, swapped = right, left, true
+		}
+		if count, ok := right.(int); ok {
+			switch left := left.(type) {
+			case string:
+				err := checkScriptLength("string", len(left), count)
+				if err != nil {
+					return nil, err
+				}
+				return strings.Repeat(left, max(count, 0)), nil
+			case *ScriptList:
+				err := checkScriptLength("list", len(left.items), count)
+				if err != nil {
+					return nil, err
+				}
+				repeated := &ScriptList{}
+				for i := 0; i < count; i++ {
+					repeated.items = append(repeated.items, left.items...)
+				}
+				return repeated, nil
+			}
+		}
+		if swapped {
+			// (back the way they were, for the error)
+			left, right = right, left
+		}
+	}
+
+	if leftInt, ok := left.(int); ok {
+		if rightInt, ok := right.(int); ok {
+			switch op {
+			case "+":
+				return leftInt + rightInt, nil
+			case "-":
+				return leftInt - rightInt, nil
+			case "*":
+				return leftInt * rightInt, nil
+			case "//", "%":
+				if rightInt == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				quotient, remainder := leftInt / rightInt, leftInt % rightInt
+				if remainder != 0 && (remainder < 0) != (rightInt < 0) {
+					quotient, remainder = quotient - 1, remainder + rightInt
+				}
+				if op == "//" {
+					return quotient, nil
+				}
+				return remainder, nil
+			}
+		}
+	}
+	leftNumber, leftOk := toScriptFloat(left)
+	rightNumber, rightOk := toScriptFloat(right)
+	if leftOk && rightOk {
+		if (op == "/" || op == "//" || op == "%") && rightNumber == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		switch op {
+		case "+":
+			return leftNumber + rightNumber, nil
+		case "-":
+			return leftNumber - rightNumber, nil
+		case "*":
+			return leftNumber * rightNumber, nil
+		case "/":
+			return leftNumber / rightNumber, nil
+		case "//":
+			return math.Floor(leftNumber / rightNumber), nil
+		case "%":
+			return leftNumber - rightNumber * math.Floor(leftNumber / rightNumber), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported operands for %s: %s and %s", op, getScriptType(left), getScriptType(right))
+}
+
+// Checks that something size long (in bytes, for a string, or items), repeated count times, isn't longer than MaxScriptLength
+func checkScriptLength(kind string, size int, count int) error {
+	if count > 0 && size > MaxScriptLength / count {
+		unit := "items"
+		if kind == "string" {
+			unit = "bytes"
+		}
+		return fmt.Errorf("%s is too long (more than %d %s)", kind, MaxScriptLength, unit)
+	}
+	return nil
+}
+
+// Whether the value's in the container: a substring of a string, an item of a list or tuple, or a key of a dict
+func isScriptValueIn(value any, container any) (bool, error) {
+	switch container := container.(type) {
+	case string:
+		text, ok := value.(string)
+		if !ok {
+			return false, fmt.Errorf("'in <string>' needs a string, not %s", getScriptType(value))
+		}
+		return strings.Contains(container, text), nil
+	case *ScriptList, ScriptTuple:
+		items, _ := getScriptItems(container)
+		for _, item := range items {
+			if areScriptValuesEqual(item, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *ScriptDict:
+		_, found, err := container.get(value)
+		return found, err
+	}
+	return false, fmt.Errorf("'in' needs a string, list, tuple, or dict, not %s", getScriptType(container))
+}
+
+// Gets an item of a list, tuple, or string (by its index, counting back from the end if it's negative), or of a dict (by its key)
+func getScriptItem(operand any, index any) (any, error) {
+	if dict, ok := operand.(*ScriptDict); ok {
+		value, found, err := dict.get(index)
+		if err == nil && !found {
+			err = fmt.Errorf("key %s not in dict", formatScriptValue(index, true))
+		}
+		return value, err
+	}
+	i, ok := index.(int)
+	if !ok {
+		return nil, fmt.Errorf("a %s index must be an int, not %s", getScriptType(operand), getScriptType(index))
+	}
+	var length int
+	switch operand := operand.(type) {
+	case *ScriptList:
+		length = len(operand.items)
+	case ScriptTuple:
+		length = len(operand)
+	case string:
+		length = len(operand)
+	default:
+		return nil, fmt.Errorf("a %s can't be indexed", getScriptType(operand))
+	}
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		return nil, fmt.Errorf("index %v out of range (length %d)", index, length)
+	}
+	switch operand := operand.(type) {
+	case *ScriptList:
+		return operand.items[i], nil
+	case ScriptTuple:
+		return operand[i], nil
+	}
+	return operand.(string)[i:i + 1], nil
+}
+
+// Gets part of a list, tuple, or string, from low up to high (either of which can be None, for the start or end)
+func sliceScriptValue(operand any, low any, high any) (any, error) {
+	var length int
+	switch operand := operand.(type) {
+	case *ScriptList:
+		length = len(operand.items)
+	case ScriptTuple:
+		length = len(operand)
+	case string:
+		length = len(operand)
+	default:
+		return nil, fmt.Errorf("a %s can't be sliced", getScriptType(operand))
+	}
+	bounds := []int{0, length}
+	for i, bound := range []any{low, high} {
+		if bound == nil {
+			continue
+		}
+		n, ok := bound.(int)
+		if !ok {
+			return nil, fmt.Errorf("slice indexes must be ints, not %s", getScriptType(bound))
+		}
+		if n < 0 {
+			n += length
+		}
+		bounds[i] = min(max(n, 0), length)
+	}
+	start, end := bounds[0], max(bounds[0], bounds[1])
+	switch operand := operand.(type) {
+	case *ScriptList:
+		return &ScriptList{items: append([]any{}, operand.items[start:end]...)}, nil
+	case ScriptTuple:
+		return append(ScriptTuple{}, operand[start:end]...), nil
+	}
+	return operand.(string)[start:end], nil
+}
+
+// =====================================================================
+// Evaluation
+// =====================================================================
+
+// The variables of the script (or of a function's call), and the ones around them
+type ScriptEnv struct {
+	vars				map[string]any
+	parent				*ScriptEnv
+}
+
+// Runs a script's statements, with the builtins (and any others it's given) as its predeclared variables
+type ScriptInterpreter struct {
+	globals				*ScriptEnv
+	output				io.Writer					// where print writes
+	calling				map[*ScriptDefStmt]bool		// the functions being called (which can't be called again until they return)
+}
+
+// How a block of statements finished
+const (
+	scriptNext = iota
+	scriptBreak
+	scriptContinue
+	scriptReturn
+)
+
+func (env *ScriptEnv) lookup(name string) (any, bool) {
+	for ; env != nil; env = env.parent {
+		if value, found := env.vars[name]; found {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Creates an interpreter with the builtins, and the predeclared variables (ie. the commands a script can run)
+func newScriptInterpreter(output io.Writer, predeclared map[string]any) *ScriptInterpreter {
+	interpreter := &ScriptInterpreter{output: output, calling: map[*ScriptDefStmt]bool{}}
+	universe := &ScriptEnv{vars: interpreter.getBuiltins()}
+	for name, value := range predeclared {
+		universe.vars[name] = value
+	}
+	interpreter.globals = &ScriptEnv{vars: map[string]any{}, parent: universe}
+	return interpreter
+}
+
+// Runs the script's statements, returning the first error (at the line it happened on)
+func (interpreter *ScriptInterpreter) run(stmts []ScriptStmt) error {
+	_, _, err := interpreter.execBlock(interpreter.globals, stmts)
+	return err
+}
+
+func (interpreter *ScriptInterpreter) execBlock(env *ScriptEnv, stmts []ScriptStmt) (int, any, error) {
+	for _, stmt := range stmts {
+		outcome, value, err := interpreter.exec(env, stmt)
+		if err != nil {
+			if _, ok := err.(*ScriptError); !ok {
+				err = &ScriptError{getScriptLine(stmt), err.Error()}
+			}
+			return scriptNext, nil, err
+		}
+		if outcome != scriptNext {
+			return outcome, value, nil
+		}
+	}
+	return scriptNext, nil, nil
+}
+
+func getScriptLine(stmt ScriptStmt) int {
+	switch stmt := stmt.(type) {
+	case *ScriptExprStmt:
+		return stmt.line
+	case *ScriptAssignStmt:
+		return stmt.line
+	case *ScriptIfStmt:
+		return stmt.line
+	case *ScriptForStmt:
+		return stmt.line
+	case *ScriptDefStmt:
+		return stmt.line
+	case *ScriptReturnStmt:
+		return stmt.line
+	case *ScriptBranchStmt:
+		return stmt.line
+	}
+	return 0
+}
+
+func (interpreter *ScriptInterpreter) exec(env *ScriptEnv, stmt ScriptStmt) (int, any, error) {
+	switch stmt := stmt.(type) {
+	case *ScriptExprStmt:
+		_, err := interpreter.eval(env, stmt.expr)
+		return scriptNext, nil, err
+	case *ScriptAssignStmt:
+		value, err := interpreter.eval(env, stmt.value)
+		if err != nil {
+			return scriptNext, nil, err
+		}
+		if stmt.op != "=" {
+			current, err := interpreter.eval(env, stmt.target)
+			if err != nil {
+				return scriptNext, nil, err
+			}
+			if value, err = applyScriptOperator(strings.TrimSuffix(stmt.op, "="), current, value); err != nil {
+				return scriptNext, nil, err
+			}
+		}
+		return scriptNext, nil, interpreter.assign(env, stmt.target, value)
+	case *ScriptIfStmt:
+		condition, err := interpreter.eval(env, stmt.condition)
+		if err != nil {
+			return scriptNext, nil, err
+		}
+		if isScriptTrue(condition) {
+			return interpreter.execBlock(env, stmt.body)
+		}
+		return interpreter.execBlock(env, stmt.otherwise)
+	case *ScriptForStmt:
+		iterable, err := interpreter.eval(env, stmt.iterable)
+		if err != nil {
+			return scriptNext, nil, err
+		}
+		items, err := getScriptItems(iterable)
+		if err != nil {
+			return scriptNext, nil, err
+		}
+		for _, item := range items {
+			if err = interpreter.assign(env, stmt.target, item); err != nil {
+				return scriptNext, nil, err
+			}
+			outcome, value, err := interpreter.execBlock(env, stmt.body)
+			if err != nil || outcome == scriptReturn {
+				return outcome, value, err
+			}
+			if outcome == scriptBreak {
+				break
+			}
+		}
+		return scriptNext, nil, nil
+	case *ScriptDefStmt:
+		function := &ScriptFunction{def: stmt, env: env}
+		for _, defaultExpr := range stmt.defaults {
+			var defaultValue any
+			if defaultExpr != nil {
+				var err error
+				if defaultValue, err = interpreter.eval(env, defaultExpr); err != nil {
+					return scriptNext, nil, err
+				}
+			}
+			function.defaults = append(function.defaults, defaultValue)
+		}
+		env.vars[stmt.name] = function
+		return scriptNext, nil, nil
+	case *ScriptReturnStmt:
+		if stmt.value == nil {
+			return scriptReturn, nil, nil
+		}
+		value, err := interpreter.eval(env, stmt.value)
+		return scriptReturn, value, err
+	case *ScriptBranchStmt:
+		return map[string]int{"pass": scriptNext, "break": scriptBreak, "continue": scriptContinue}[stmt.keyword], nil, nil
+	}
+	return scriptNext, nil, fmt.Errorf("unknown statement %T", stmt)
+}
+
+// Assigns the value to a name (in the env), an item, or (unpacking a list or tuple) several of them
+func (interpreter *ScriptInterpreter) assign(env *ScriptEnv, target ScriptExpr, value any) error {
+	switch target := target.(type) {
+	case *ScriptName:
+		env.vars[target.name] = value
+		return nil
+	case *ScriptIndexExpr:
+		operand, err := interpreter.eval(env, target.operand)
+		if err != nil {
+			return err
+		}
+		index, err := interpreter.eval(env, target.index)
+		if err != nil {
+			return err
+		}
+		switch operand := operand.(type) {
+		case *ScriptDict:
+			return operand.set(index, value)
+		case *ScriptList:
+			if _, err := getScriptItem(operand, index); err != nil {
+				return err
+			}
+			i := index.(int)
+			if i < 0 {
+				i += len(operand.items)
+			}
+			operand.items[i] = value
+			return nil
+		}
+		return fmt.Errorf("can't assign to an item of a %s", getScriptType(operand))
+	case *ScriptTupleExpr, *ScriptListExpr:
+		targets := []ScriptExpr{}
+		if tuple, ok := target.(*ScriptTupleExpr); ok {
+			targets = tuple.items
+		} else {
+			targets = target.(*ScriptListExpr).items
+		}
+		var items []any
+		switch value.(type) {
+		case *ScriptList, ScriptTuple:
+			items, _ = getScriptItems(value)
+		default:
+			return fmt.Errorf("can't unpack a %s", getScriptType(value))
+		}
+		if len(items) != len(targets) {
+			return fmt.Errorf("can't unpack %d values into %d variables", len(items), len(targets))
+		}
+		for i, item := range items {
+			if err := interpreter.assign(env, targets[i], item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("can't assign to that expression")
+}
+
+func (interpreter *ScriptInterpreter) eval(env *ScriptEnv, expr ScriptExpr) (any, error) {
+	switch expr := expr.(type) {
+	case *ScriptLiteral:
+		return expr.value, nil
+	case *ScriptName:
+		if value, found := env.lookup(expr.name); found {
+			return value, nil
+		}
+		return nil, fmt.Errorf("undefined: %s", expr.name)
+	case *ScriptListExpr:
+		items, err := interpreter.evalAll(env, expr.items)
+		return &ScriptList{items: items}, err
+	case *ScriptTupleExpr:
+		items, err := interpreter.evalAll(env, expr.items)
+		return ScriptTuple(items), err
+	case *ScriptDictExpr:
+		dict := newScriptDict()
+		for i := range expr.keys {
+			key, err := interpreter.eval(env, expr.keys[i])
+			if err != nil {
+				return nil, err
+			}
+			value, err := interpreter.eval(env, expr.values[i])
+			if err != nil {
+				return nil, err
+			}
+			if err = dict.set(key, value); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	case *ScriptComprehension:
+		iterable, err := interpreter.eval(env, expr.iterable)
+		if err != nil {
+			return nil, err
+		}
+		items, err := getScriptItems(iterable)
+		if err != nil {
+			return nil, err
+		}
+		// (its variables are its own)
+		inner := &ScriptEnv{vars: map[string]any{}, parent: env}
+		list := &ScriptList{}
+		for _, item := range items {
+			if err = interpreter.assign(inner, expr.target, item); err != nil {
+				return nil, err
+			}
+			if expr.condition != nil {
+				condition, err := interpreter.eval(inner, expr.condition)
+				if err != nil {
+					return nil, err
+				}
+				if !isScriptTrue(condition) {
+					continue
+				}
+			}
+			element, err := interpreter.eval(inner, expr.element)
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, element)
+		}
+		return list, nil
+	case *ScriptUnaryExpr:
+		operand, err := interpreter.eval(env, expr.operand)
+		if err != nil {
+			return nil, err
+		}
+		switch operand := operand.(type) {
+		case int:
+			if expr.op == "-" {
+				return -operand, nil
+			} else if expr.op == "+" {
+				return operand, nil
+			}
+		case float64:
+			if expr.op == "-" {
+				return -operand, nil
+			} else if expr.op == "+" {
+				return operand, nil
+			}
+		}
+		if expr.op == "not" {
+			return !isScriptTrue(operand), nil
+		}
+		return nil, fmt.Errorf("unsupported operand for unary %s: %s", expr.op, getScriptType(operand))
+	case *ScriptBinaryExpr:
+		left, err := interpreter.eval(env, expr.left)
+		if err != nil {
+			return nil, err
+		}
+		// (and and or only evaluate their right operand if they need to, and are whichever operand decided them)
+		switch {
+		case expr.op == "and" && !isScriptTrue(left), expr.op == "or" && isScriptTrue(left):
+			return left, nil
+		case expr.op == "and", expr.op == "or":
+			return interpreter.eval(env, expr.right)
+		}
+		right, err := interpreter.eval(env, expr.right)
+		if err != nil {
+			return nil, err
+		}
+		return applyScriptOperator(expr.op, left, right)
+	case *ScriptConditionalExpr:
+		condition, err := interpreter.eval(env, expr.condition)
+		if err != nil {
+			return nil, err
+		}
+		if isScriptTrue(condition) {
+			return interpreter.eval(env, expr.then)
+		}
+		return interpreter.eval(env, expr.otherwise)
+	case *ScriptCallExpr:
+		function, err := interpreter.eval(env, expr.function)
+		if err != nil {
+			return nil, err
+		}
+		args, err := interpreter.evalAll(env, expr.args)
+		if err != nil {
+			return nil, err
+		}
+		kwargs := map[string]any{}
+		for i, keyword := range expr.keywords {
+			if _, found := kwargs[keyword]; found {
+				return nil, fmt.Errorf("keyword argument %s given more than once", keyword)
+			}
+			if kwargs[keyword], err = interpreter.eval(env, expr.keywordArgs[i]); err != nil {
+				return nil, err
+			}
+		}
+		return interpreter.call(function, args, kwargs)
+	case *ScriptIndexExpr:
+		operand, err := interpreter.eval(env, expr.operand)
+		if err != nil {
+			return nil, err
+		}
+		index, err := interpreter.eval(env, expr.index)
+		if err != nil {
+			return nil, err
+		}
+		return getScriptItem(operand, index)
+	case *ScriptSliceExpr:
+		operand, err := interpreter.eval(env, expr.operand)
+		if err != nil {
+			return nil, err
+		}
+		bounds := []any{nil, nil}
+		for i, bound := range []ScriptExpr{expr.low, expr.high} {
+			if bound != nil {
+				if bounds[i], err = interpreter.eval(env, bound); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return sliceScriptValue(operand, bounds[0], bounds[1])
+	case *ScriptAttrExpr:
+		operand, err := interpreter.eval(env, expr.operand)
+		if err != nil {
+			return nil, err
+		}
+		return getScriptAttr(operand, expr.name)
+	}
+	return nil, fmt.Errorf("unknown expression %T", expr)
+}
+
+func (interpreter *ScriptInterpreter) evalAll(env *ScriptEnv, exprs []ScriptExpr) ([]any, error) {
+	values := []any{}
+	for _, expr := range exprs {
+		value, err := interpreter.eval(env, expr)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Calls a function (defined in the script, or a builtin) with the args
+func (interpreter *ScriptInterpreter) call(function any, args []any, kwargs map[string]any) (any, error) {
+	switch function := function.(type) {
+	case *ScriptBuiltin:
+		return function.call(args, kwargs)
+	case *ScriptFunction:
+		def := function.def
+		if interpreter.calling[def] {
+			return nil, fmt.Errorf("function %s called itself (recursion isn't allowed)", def.name)
+		}
+		if len(args) > len(def.params) {
+			return nil, fmt.Errorf("%s() takes %d arguments, but %d were given", def.name, len(def.params), len(args))
+		}
+		env := &ScriptEnv{vars: map[string]any{}, parent: function.env}
+		for i, param := range def.params {
+			value, found := kwargs[param]
+			switch {
+			case i < len(args) && found:
+				return nil, fmt.Errorf("%s() got more than one value for %s", def.name, param)
+			case i < len(args):
+				value = args[i]
+			case !found && def.defaults[i] == nil:
+				return nil, fmt.Errorf("%s() is missing argument %s", def.name, param)
+			case !found:
+				value = function.defaults[i]
+			}
+			env.vars[param] = value
+		}
+		for keyword := range kwargs {
+			if !containsString(def.params, keyword) {
+				return nil, fmt.Errorf("%s() got an unexpected keyword argument %s", def.name, keyword)
+			}
+		}
+
+		interpreter.calling[def] = true
+		defer delete(interpreter.calling, def)
+		_, value, err := interpreter.execBlock(env, def.body)
+		return value, err
+	}
+	return nil, fmt.Errorf("a %s can't be called", getScriptType(function))
+}
+
+// Binds a builtin's args to its params, by position or by keyword (a param ending in "?" is optional, and None if it isn't given)
+func bindScriptArgs(name string, args []any, kwargs map[string]any, params ...string) ([]any, error) {
+	if len(args) > len(params) {
+		return nil, fmt.Errorf("%s() takes at most %d arguments, but %d were given", name, len(params), len(args))
+	}
+	values := make([]any, len(params))
+	copy(values, args)
+	for keyword, value := range kwargs {
+		i := -1
+		for j, param := range params {
+			if strings.TrimSuffix(param, "?") == keyword {
+				i = j
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("%s() got an unexpected keyword argument %s", name, keyword)
+		}
+		if i < len(args) {
+			return nil, fmt.Errorf("%s() got more than one value for %s", name, keyword)
+		}
+		values[i] = value
+	}
+	for i, param := range params {
+		if _, found := kwargs[param]; i >= len(args) && !found && !strings.HasSuffix(param, "?") {
+			return nil, fmt.Errorf("%s() is missing argument %s", name, param)
+		}
+	}
+	return values, nil
+}
+
+// Checks that one of a builtin's args is a string (or None, if it's optional)
+func getScriptString(name string, value any, optional bool) (string, error) {
+	if text, ok := value.(string); ok || (optional && value == nil) {
+		return text, nil
+	}
+	return "", fmt.Errorf("%s must be a string, not %s", name, getScriptType(value))
+}
+
+func getScriptInt(name string, value any) (int, error) {
+	if n, ok := value.(int); ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("%s must be an int, not %s", name, getScriptType(value))
+}
+
+// Gets a member of a module, or a method of a list, dict, or string (bound to it)
+func getScriptAttr(operand any, name string) (any, error) {
+	if module, ok := operand.(*ScriptModule); ok {
+		if member, found := module.members[name]; found {
+			return member, nil
+		}
+		return nil, fmt.Errorf("module %s has no %s", module.name, name)
+	}
+	typeName := getScriptType(operand)
+	method, found := getScriptMethods(operand)[name]
+	if !found {
+		return nil, fmt.Errorf("%s has no attribute %s", typeName, name)
+	}
+	return &ScriptBuiltin{name: typeName + "." + name, call: func(args []any, kwargs map[string]any) (any, error) {
+		return method(typeName + "." + name, args, kwargs)
+	}}, nil
+}
+
+// The methods of a list, dict, or string (bound to it)
+func getScriptMethods(operand any) map[string]func(string, []any, map[string]any) (any, error) {
+	type method = func(string, []any, map[string]any) (any, error)
+	switch operand := operand.(type) {
+	case *ScriptList:
+		return map[string]method{
+			"append": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "x")
+				if err == nil {
+					operand.items = append(operand.items, values[0])
+				}
+				return nil, err
+			},
+			"extend": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "iterable")
+				if err != nil {
+					return nil, err
+				}
+				items, err := getScriptItems(values[0])
+				if err != nil {
+					return nil, err
+				}
+				err = checkScriptLength("list", len(operand.items) + len(items), 1)
+				if err != nil {
+					return nil, err
+				}
+				operand.items = append(operand.items, items...)
+				return nil, nil
+			},
+			"insert": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "index", "x")
+				if err != nil {
+					return nil, err
+				}
+				i, err := getScriptInt("index", values[0])
+				if err != nil {
+					return nil, err
+				}
+				if i < 0 {
+					i += len(operand.items)
+				}
+				i = min(max(i, 0), len(operand.items))
+				operand.items = append(operand.items[:i], append([]any{values[1]}, operand.items[i:]...)...)
+				return nil, nil
+			},
+			"pop": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "index?")
+				if err != nil {
+					return nil, err
+				}
+				if values[0] == nil {
+					values[0] = -1
+				}
+				item, err := getScriptItem(operand, values[0])
+				if err != nil {
+					return nil, err
+				}
+				i := values[0].(int)
+				if i < 0 {
+					i += len(operand.items)
+				}
+				operand.items = append(operand.items[:i], operand.items[i + 1:]...)
+				return item, nil
+			},
+			"index": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "x")
+				if err != nil {
+					return nil, err
+				}
+				for i, item := range operand.items {
+					if areScriptValuesEqual(item, values[0]) {
+						return i, nil
+					}
+				}
+				return nil, fmt.Errorf("%s not in list", formatScriptValue(values[0], true))
+			},
+			"remove": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "x")
+				if err != nil {
+					return nil, err
+				}
+				for i, item := range operand.items {
+					if areScriptValuesEqual(item, values[0]) {
+						operand.items = append(operand.items[:i], operand.items[i + 1:]...)
+						return nil, nil
+					}
+				}
+				return nil, fmt.Errorf("%s not in list", formatScriptValue(values[0], true))
+			},
+			"clear": func(name string, args []any, kwargs map[string]any) (any, error) {
+				_, err := bindScriptArgs(name, args, kwargs)
+				operand.items = nil
+				return nil, err
+			},
+		}
+	case *ScriptDict:
+		return map[string]method{
+			"get": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "key", "default?")
+				if err != nil {
+					return nil, err
+				}
+				value, found, err := operand.get(values[0])
+				if !found {
+					value = values[1]
+				}
+				return value, err
+			},
+			"keys": func(name string, args []any, kwargs map[string]any) (any, error) {
+				_, err := bindScriptArgs(name, args, kwargs)
+				return &ScriptList{items: append([]any{}, operand.keys...)}, err
+			},
+			"values": func(name string, args []any, kwargs map[string]any) (any, error) {
+				_, err := bindScriptArgs(name, args, kwargs)
+				list := &ScriptList{}
+				for _, key := range operand.keys {
+					list.items = append(list.items, operand.values[key])
+				}
+				return list, err
+			},
+			"items": func(name string, args []any, kwargs map[string]any) (any, error) {
+				_, err := bindScriptArgs(name, args, kwargs)
+				list := &ScriptList{}
+				for _, key := range operand.keys {
+					list.items = append(list.items, ScriptTuple{key, operand.values[key]})
+				}
+				return list, err
+			},
+			"pop": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "key", "default?")
+				if err != nil {
+					return nil, err
+				}
+				value, found, err := operand.get(values[0])
+				if err != nil {
+					return nil, err
+				}
+				if !found {
+					if len(args) + len(kwargs) < 2 {
+						return nil, fmt.Errorf("key %s not in dict", formatScriptValue(values[0], true))
+					}
+					return values[1], nil
+				}
+				operand.remove(values[0])
+				return value, nil
+			},
+			"setdefault": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "key", "default?")
+				if err != nil {
+					return nil, err
+				}
+				value, found, err := operand.get(values[0])
+				if err != nil || found {
+					return value, err
+				}
+				return values[1], operand.set(values[0], values[1])
+			},
+			"update": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "other")
+				if err != nil {
+					return nil, err
+				}
+				other, ok := values[0].(*ScriptDict)
+				if !ok {
+					return nil, fmt.Errorf("other must be a dict, not %s", getScriptType(values[0]))
+				}
+				for _, key := range other.keys {
+					operand.set(key, other.values[key])
+				}
+				return nil, nil
+			},
+			"clear": func(name string, args []any, kwargs map[string]any) (any, error) {
+				_, err := bindScriptArgs(name, args, kwargs)
+				operand.keys, operand.values = nil, map[any]any{}
+				return nil, err
+			},
+		}
+	case string:
+		// (the methods that take a single string, and return a string or a bool)
+		unary := func(function func(string) string) method {
+			return func(name string, args []any, kwargs map[string]any) (any, error) {
+				_, err := bindScriptArgs(name, args, kwargs)
+				return function(operand), err
+			}
+		}
+		test := func(function func(string, string) bool) method {
+			return func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "x")
+				if err != nil {
+					return nil, err
+				}
+				x, err := getScriptString("x", values[0], false)
+				return function(operand, x), err
+			}
+		}
+		trim := func(function func(string, string) string) method {
+			return func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "chars?")
+				if err != nil {
+					return nil, err
+				}
+				chars, err := getScriptString("chars", values[0], true)
+				if values[0] == nil {
+					chars = " \t\r\n"
+				}
+				return function(operand, chars), err
+			}
+		}
+		return map[string]method{
+			"lower": unary(strings.ToLower),
+			"upper": unary(strings.ToUpper),
+			"strip": trim(strings.Trim),
+			"lstrip": trim(strings.TrimLeft),
+			"rstrip": trim(strings.TrimRight),
+			"startswith": test(strings.HasPrefix),
+			"endswith": test(strings.HasSuffix),
+			"format": func(name string, args []any, kwargs map[string]any) (any, error) {
+				return formatScriptString(operand, args, kwargs)
+			},
+			"join": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "iterable")
+				if err != nil {
+					return nil, err
+				}
+				items, err := getScriptItems(values[0])
+				if err != nil {
+					return nil, err
+				}
+				texts := []string{}
+				length := len(operand) * max(len(items) - 1, 0)
+				for _, item := range items {
+					text, err := getScriptString("joined items", item, false)
+					if err != nil {
+						return nil, err
+					}
+					texts = append(texts, text)
+					length += len(text)
+				}
+				err = checkScriptLength("string", length, 1)
+				if err != nil {
+					return nil, err
+				}
+				return strings.Join(texts, operand), nil
+			},
+			"split": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "sep?")
+				if err != nil {
+					return nil, err
+				}
+				sep, err := getScriptString("sep", values[0], true)
+				if err != nil {
+					return nil, err
+				}
+				parts := strings.Fields(operand)
+				if values[0] != nil {
+					parts = strings.Split(operand, sep)
+				}
+				list := &ScriptList{}
+				for _, part := range parts {
+					list.items = append(list.items, part)
+				}
+				return list, nil
+			},
+			"replace": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "old", "new")
+				if err != nil {
+					return nil, err
+				}
+				old, err := getScriptString("old", values[0], false)
+				if err != nil {
+					return nil, err
+				}
+				replacement, err := getScriptString("new", values[1], false)
+				if err != nil {
+					return nil, err
+				}
+				err = checkScriptLength("string", len(operand) + strings.Count(operand, old) * (len(replacement) - len(old)), 1)
+				if err != nil {
+					return nil, err
+				}
+				return strings.ReplaceAll(operand, old, replacement), nil
+			},
+			"find": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "sub")
+				if err != nil {
+					return nil, err
+				}
+				sub, err := getScriptString("sub", values[0], false)
+				return strings.Index(operand, sub), err
+			},
+			"count": func(name string, args []any, kwargs map[string]any) (any, error) {
+				values, err := bindScriptArgs(name, args, kwargs, "sub")
+				if err != nil {
+					return nil, err
+				}
+				sub, err := getScriptString("sub", values[0], false)
+				return strings.Count(operand, sub), err
+			},
+		}
+	}
+	return nil
+}
+
+// Replaces the {} (or {0}, or {name}) fields of the string with the args, as str.format does ({{ and }} are braces)
+func formatScriptString(format string, args []any, kwargs map[string]any) (string, error) {
+	var formatted strings.Builder
+	next := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch {
+		case (c == '{' || c == '}') && i + 1 < len(format) && format[i + 1] == c:
+			formatted.WriteByte(c)
+			i++
+		case c == '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed { in format string")
+			}
+			field := format[i + 1:i + end]
+			var value any
+			if n, err := strconv.Atoi(field); err == nil || field == "" {
+				if field == "" {
+					n = next
+					next++
+				}
+				if n >= len(args) {
+					return "", fmt.Errorf("format string needs argument %d, but only %d were given", n, len(args))
+				}
+				value = args[n]
+			} else if found, ok := kwargs[field]; ok {
+				value = found
+			} else {
+				return "", fmt.Errorf("format string needs keyword argument %s", field)
+			}
+			formatted.WriteString(formatScriptValue(value, false))
+			i += end
+		case c == '}':
+			return "", fmt.Errorf("single } in format string")
+		default:
+			formatted.WriteByte(c)
+		}
+	}
+	return formatted.String(), nil
+}
+
+// =====================================================================
+// Builtins
+// =====================================================================
+
+func (interpreter *ScriptInterpreter) getBuiltins() map[string]any {
+	builtins := map[string]any{}
+	add := func(name string, call func(name string, args []any, kwargs map[string]any) (any, error)) {
+		builtins[name] = &ScriptBuiltin{name: name, call: func(args []any, kwargs map[string]any) (any, error) {
+			return call(name, args, kwargs)
+		}}
+	}
+
+	add("print", func(name string, args []any, kwargs map[string]any) (any, error) {
+		sep := " "
+		if value, found := kwargs["sep"]; found {
+			var err error
+			if sep, err = getScriptString("sep", value, false); err != nil {
+				return nil, err
+			}
+		}
+		texts := []string{}
+		for _, arg := range args {
+			texts = append(texts, formatScriptValue(arg, false))
+		}
+		fmt.Fprintln(interpreter.output, strings.Join(texts, sep))
+		return nil, nil
+	})
+	add("fail", func(name string, args []any, kwargs map[string]any) (any, error) {
+		texts := []string{}
+		for _, arg := range args {
+			texts = append(texts, formatScriptValue(arg, false))
+		}
+		return nil, fmt.Errorf("fail: %s", strings.Join(texts, " "))
+	})
+	add("len", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "x")
+		if err != nil {
+			return nil, err
+		}
+		switch value := values[0].(type) {
+		case string:
+			return len(value), nil
+		case *ScriptList:
+			return len(value.items), nil
+		case ScriptTuple:
+			return len(value), nil
+		case *ScriptDict:
+			return len(value.keys), nil
+		}
+		return nil, fmt.Errorf("a %s has no len", getScriptType(values[0]))
+	})
+	add("range", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "start", "stop?", "step?")
+		if err != nil {
+			return nil, err
+		}
+		if values[1] == nil {
+			values[0], values[1] = 0, values[0]
+		}
+		if values[2] == nil {
+			values[2] = 1
+		}
+		bounds := []int{}
+		for i, param := range []string{"start", "stop", "step"} {
+			n, err := getScriptInt(param, values[i])
+			if err != nil {
+				return nil, err
+			}
+			bounds = append(bounds, n)
+		}
+		start, stop, step := bounds[0], bounds[1], bounds[2]
+		if step == 0 {
+			return nil, fmt.Errorf("range's step can't be zero")
+		}
+		if (stop - start) / step > MaxScriptRange {
+			return nil, fmt.Errorf("range is too long (more than %d items)", MaxScriptRange)
+		}
+		list := &ScriptList{}
+		for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+			list.items = append(list.items, i)
+		}
+		return list, nil
+	})
+	add("str", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "x")
+		if err != nil {
+			return nil, err
+		}
+		return formatScriptValue(values[0], false), nil
+	})
+	add("int", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "x")
+		if err != nil {
+			return nil, err
+		}
+		switch value := values[0].(type) {
+		case int:
+			return value, nil
+		case bool:
+			if value {
+				return 1, nil
+			}
+			return 0, nil
+		case float64:
+			return int(value), nil
+		case string:
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid int %s", strconv.Quote(value))
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("can't convert a %s to an int", getScriptType(values[0]))
+	})
+	add("float", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "x")
+		if err != nil {
+			return nil, err
+		}
+		if number, ok := toScriptFloat(values[0]); ok {
+			return number, nil
+		}
+		if text, ok := values[0].(string); ok {
+			number, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid float %s", strconv.Quote(text))
+			}
+			return number, nil
+		}
+		return nil, fmt.Errorf("can't convert a %s to a float", getScriptType(values[0]))
+	})
+	add("bool", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "x?")
+		return err == nil && isScriptTrue(values[0]), err
+	})
+	add("type", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "x")
+		if err != nil {
+			return nil, err
+		}
+		return getScriptType(values[0]), nil
+	})
+	add("list", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "iterable?")
+		if err != nil || values[0] == nil {
+			return &ScriptList{}, err
+		}
+		items, err := getScriptItems(values[0])
+		return &ScriptList{items: items}, err
+	})
+	add("tuple", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "iterable?")
+		if err != nil || values[0] == nil {
+			return ScriptTuple{}, err
+		}
+		items, err := getScriptItems(values[0])
+		return ScriptTuple(items), err
+	})
+	add("dict", func(name string, args []any, kwargs map[string]any) (any, error) {
+		// (from another dict, or a list of pairs, and then the keyword args)
+		if len(args) > 1 {
+			return nil, fmt.Errorf("dict() takes at most 1 argument, but %d were given", len(args))
+		}
+		dict := newScriptDict()
+		if len(args) == 1 {
+			if other, ok := args[0].(*ScriptDict); ok {
+				for _, key := range other.keys {
+					dict.set(key, other.values[key])
+				}
+			} else {
+				pairs, err := getScriptItems(args[0])
+				if err != nil {
+					return nil, err
+				}
+				for _, pair := range pairs {
+					items, err := getScriptItems(pair)
+					if err != nil || len(items) != 2 {
+						return nil, fmt.Errorf("dict() needs a list of (key, value) pairs")
+					}
+					if err = dict.set(items[0], items[1]); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		keywords := []string{}
+		for keyword := range kwargs {
+			keywords = append(keywords, keyword)
+		}
+		sort.Strings(keywords)
+		for _, keyword := range keywords {
+			dict.set(keyword, kwargs[keyword])
+		}
+		return dict, nil
+	})
+	add("sorted", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "iterable", "key?", "reverse?")
+		if err != nil {
+			return nil, err
+		}
+		items, err := getScriptItems(values[0])
+		if err != nil {
+			return nil, err
+		}
+		keys := items
+		if values[1] != nil {
+			keys = []any{}
+			for _, item := range items {
+				key, err := interpreter.call(values[1], []any{item}, nil)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, key)
+			}
+		}
+		order := make([]int, len(items))
+		for i := range order {
+			order[i] = i
+		}
+		var compareErr error
+		sort.SliceStable(order, func(i int, j int) bool {
+			result, err := compareScriptValues(keys[order[i]], keys[order[j]])
+			if err != nil {
+				compareErr = err
+			}
+			if isScriptTrue(values[2]) {
+				return result > 0
+			}
+			return result < 0
+		})
+		sortedList := &ScriptList{}
+		for _, i := range order {
+			sortedList.items = append(sortedList.items, items[i])
+		}
+		return sortedList, compareErr
+	})
+	add("reversed", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "iterable")
+		if err != nil {
+			return nil, err
+		}
+		items, err := getScriptItems(values[0])
+		reversedList := &ScriptList{}
+		for i := len(items) - 1; i >= 0; i-- {
+			reversedList.items = append(reversedList.items, items[i])
+		}
+		return reversedList, err
+	})
+	add("enumerate", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "iterable", "start?")
+		if err != nil {
+			return nil, err
+		}
+		items, err := getScriptItems(values[0])
+		if err != nil {
+			return nil, err
+		}
+		start := 0
+		if values[1] != nil {
+			if start, err = getScriptInt("start", values[1]); err != nil {
+				return nil, err
+			}
+		}
+		list := &ScriptList{}
+		for i, item := range items {
+			list.items = append(list.items, ScriptTuple{start + i, item})
+		}
+		return list, nil
+	})
+	add("zip", func(name string, args []any, kwargs map[string]any) (any, error) {
+		if _, err := bindScriptArgs(name, nil, kwargs); err != nil {
+			return nil, err
+		}
+		lists := [][]any{}
+		shortest := -1
+		for _, arg := range args {
+			items, err := getScriptItems(arg)
+			if err != nil {
+				return nil, err
+			}
+			lists = append(lists, items)
+			if shortest < 0 || len(items) < shortest {
+				shortest = len(items)
+			}
+		}
+		list := &ScriptList{}
+		for i := 0; i < shortest; i++ {
+			tuple := ScriptTuple{}
+			for _, items := range lists {
+				tuple = append(tuple, items[i])
+			}
+			list.items = append(list.items, tuple)
+		}
+		return list, nil
+	})
+	for _, extreme := range []string{"min", "max"} {
+		add(extreme, func(name string, args []any, kwargs map[string]any) (any, error) {
+			if _, err := bindScriptArgs(name, nil, kwargs); err != nil {
+				return nil, err
+			}
+			items := args
+			if len(args) == 1 {
+				var err error
+				if items, err = getScriptItems(args[0]); err != nil {
+					return nil, err
+				}
+			}
+			if len(items) == 0 {
+				return nil, fmt.Errorf("%s() of nothing", name)
+			}
+			best := items[0]
+			for _, item := range items[1:] {
+				result, err := compareScriptValues(item, best)
+				if err != nil {
+					return nil, err
+				}
+				if (name == "min" && result < 0) || (name == "max" && result > 0) {
+					best = item
+				}
+			}
+			return best, nil
+		})
+	}
+	add("abs", func(name string, args []any, kwargs map[string]any) (any, error) {
+		values, err := bindScriptArgs(name, args, kwargs, "x")
+		if err != nil {
+			return nil, err
+		}
+		switch value := values[0].(type) {
+		case int:
+			if value < 0 {
+				return -value, nil
+			}
+			return value, nil
+		case float64:
+			return math.Abs(value), nil
+		}
+		return nil, fmt.Errorf("x must be a number, not %s", getScriptType(values[0]))
+	})
+	for _, quantifier := range []string{"any", "all"} {
+		add(quantifier, func(name string, args []any, kwargs map[string]any) (any, error) {
+			values, err := bindScriptArgs(name, args, kwargs, "iterable")
+			if err != nil {
+				return nil, err
+			}
+			items, err := getScriptItems(values[0])
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				if isScriptTrue(item) == (name == "any") {
+					return name == "any", nil
+				}
+			}
+			return name == "all", nil
+		})
+	}
+	return builtins
+}
@@ -0,0 +1,948 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Parses and runs the script with just the builtins, returning what it printed
+func runTestScript(t *testing.T, source string) (string, error) {
+	stmts, err := parseScript(source)
+	if err != nil {
+		return "", err
+	}
+	var output bytes.Buffer
+	err = newScriptInterpreter(&output, nil).run(stmts)
+	return output.String(), err
+}
+
+func TestScript_Values(t *testing.T) {
+	output, err := runTestScript(t, `
+x = 7
+print(x + 2, x - 2, x * 2, x / 2, x // 2, x % 3, -x // 2, -x % 3)
+print("a" + "b", "ab" * 3, [1] + [2], (1,) + (2,), [0] * 2)
+print(1 == 1.0, "a" < "b", 2 >= 3, "b" in "abc", 2 in [1, 2], "k" in {"k": 1}, 3 not in (1, 2))
+print(True and "yes", False or None, not [], 1 if x > 5 else 2)
+items = [3, 1, 2]
+items.append(4)
+items[0] = 5
+print(items, items[-1], items[1:3], items[:2], len(items), sorted(items), sorted(items, reverse=True))
+d = {"a": 1}
+d["b"] = 2
+d.update({"c": 3})
+print(d, d.get("z", 0), d.keys(), len(d), d.pop("a"), d)
+s = "  Hello, {}!  ".strip().format("world")
+print(s, s.lower(), s.split(", "), s.replace("world", "you"), "-".join(["a", "b"]), s.startswith("Hello"), s[0:5])
+print("{0}-{name}".format(1, name="n"), str(1.5), int("42"), float(2), type({}), 2.0, 1e3)
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, `9 5 14 3.5 3 1 -4 2
+ab ababab [1, 2] (1, 2) [0, 0]
+True True False True True True True
+yes None True 1
+[5, 1, 2, 4] 4 [1, 2] [5, 1] 4 [1, 2, 4, 5] [5, 4, 2, 1]
+{"b": 2, "c": 3} 0 ["a", "b", "c"] 3 1 {"b": 2, "c": 3}
+Hello, world! hello, world! ["Hello", "world!"] Hello, you! a-b True Hello
+1-n 1.5 42 2.0 dict 2.0 1000.0
+`, output)
+}
+
+func TestScript_ControlFlow(t *testing.T) {
+	output, err := runTestScript(t, `
+def classify(n, small=3):
+    if n < small:
+        return "small"
+    elif n < 6:
+        return "medium"
+    else:
+        return "large"
+
+total = 0
+for i in range(10):
+    if i == 2: continue
+    if i == 8:
+        break
+    total += i
+print(total, classify(1), classify(4), classify(n=9, small=1))
+print([i * i for i in range(5) if i % 2 == 0], [k for k, v in {"a": 1, "b": 2}.items() if v > 1])
+for i, name in enumerate(["x", "y"], start=1):
+    print(i, name)
+a, b = 1, 2
+a, b = b, a
+print(a, b, min(3, 1, 2), max([1, 5]), any([0, 1]), all([]), abs(-2), list(zip([1, 2], "ab".split("b"))))
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, "26 small medium large\n[0, 4, 16] [\"b\"]\n1 x\n2 y\n2 1 1 5 True True 2 [(1, \"a\"), (2, \"\")]\n", output)
+}
+
+func TestScript_Errors(t *testing.T) {
+	for source, message := range map[string]string{
+		"x = (1,\n": "unclosed bracket",
+		"if True:\nprint(1)\n": "line 2: expected an indented block",
+		"  x = 1\n": "line 1: unexpected indent",
+		"x = 1\nx = 2 = 3\n": "line 2: expected the end of the line, found '='",
+		"while True:\n    pass\n": "line 1: while isn't supported",
+		"break\n": "line 1: break outside a loop",
+		"return 1\n": "line 1: return outside a function",
+		"x = 'unterminated\n": "unterminated string",
+		"1 < 2 < 3\n": "comparisons can't be chained",
+		"def f(a=1, b):\n    pass\n": "parameter b needs a default",
+		"f(x=1, 2)\n": "positional argument after a keyword argument",
+		"x = 1\ny = undefined + x\n": "line 2: undefined: undefined",
+		"def f():\n    return f()\nf()\n": "line 2: function f called itself (recursion isn't allowed)",
+		"x = 1 / 0\n": "line 1: division by zero",
+		"x = [1][3]\n": "index 3 out of range (length 1)",
+		"x = {}['k']\n": "key \"k\" not in dict",
+		"x = 1 + 'a'\n": "unsupported operands for +: int and string",
+		"for c in 'abc':\n    pass\n": "can't loop over a string",
+		"a, b = [1]\n": "can't unpack 1 values into 2 variables",
+		"len(1, 2)\n": "len() takes at most 1 arguments, but 2 were given",
+		"def f(a):\n    pass\nf()\n": "f() is missing argument a",
+		"fail('stop', 1)\n": "line 1: fail: stop 1",
+		"x = {[]: 1}\n": "a list can't be a dict key",
+		"x = range(100000000)\n": "range is too long",
+		"x = 'a' * 100000000000\n": "line 1: string is too long (more than 10000000 bytes)",
+		"x = 100000000000 * 'ab'\n": "string is too long",
+		"x = [1, 2] * 9223372036854775807\n": "line 1: list is too long (more than 10000000 items)",
+		"x = 'a' * 1000\nfor i in range(20):\n    x += x\n": "line 3: string is too long",
+		"x = [0] * 1000\nfor i in range(20):\n    x = x + x\n": "list is too long",
+		"x = (0,)\nfor i in range(30):\n    x = x + x\n": "tuple is too long",
+		"x = [0] * 1000\nfor i in range(20):\n    x.extend(x)\n": "list is too long",
+		"x = ('a' * 10000).replace('a', 'b' * 10000)\n": "string is too long",
+		"x = ('a' * 10000000).join(['a', 'b'])\n": "string is too long",
+		"x = 1\nx.y\n": "int has no attribute y",
+	} {
+		_, err := runTestScript(t, source)
+		assert.ErrorContains(t, err, message, source)
+	}
+}
+
+func TestCheckScriptLength(t *testing.T) {
+	// Right up to the limit is fine, whatever it's made of (and repeating it no times, or fewer, makes nothing)
+	assert.Nil(t, checkScriptLength("string", MaxScriptLength, 1))
+	assert.Nil(t, checkScriptLength("string", 1000, MaxScriptLength / 1000))
+	assert.Nil(t, checkScriptLength("list", MaxScriptLength * 10, 0))
+	assert.Nil(t, checkScriptLength("list", MaxScriptLength * 10, -5))
+	assert.ErrorContains(t, checkScriptLength("string", MaxScriptLength + 1, 1), "string is too long (more than 10000000 bytes)")
+	assert.ErrorContains(t, checkScriptLength("list", 2, math.MaxInt), "list is too long (more than 10000000 items)")
+
+	// (and what's repeated no times is empty)
+	output, err := runTestScript(t, "print('ab' * 0, 'ab' * -2, [1] * -1, len('ab' * 5000000))\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "  [] 10000000\n", output)
+}
+
+func TestTokenizeScript(t *testing.T) {
+	tokens, err := tokenizeScript("if x:  # comment\n\n    y = [1,\n  2]\nz = '''a\nb'''\n")
+	assert.Nil(t, err)
+	kinds := []string{}
+	for _, token := range tokens {
+		kinds = append(kinds, token.kind)
+	}
+	assert.Equal(t, []string{"name", "name", "op", "newline", "indent", "name", "op", "op", "int", "op", "int", "op", "newline", "dedent", "name", "op", "string", "newline", "eof"}, kinds)
+	assert.Equal(t, "a\nb", tokens[16].text)
+	assert.Equal(t, 5, tokens[16].line)
+}
+
+// Evaluates the expression (with just the builtins, after any setup statements), returning its value formatted as it's shown in a list
+func evalTestScript(t *testing.T, setup string, expr string) (string, error) {
+	stmts, err := parseScript(setup + "\nresult = " + expr + "\n")
+	if err != nil {
+		return "", err
+	}
+	interpreter := newScriptInterpreter(io.Discard, nil)
+	if err = interpreter.run(stmts); err != nil {
+		return "", err
+	}
+	return formatScriptValue(interpreter.globals.vars["result"], true), nil
+}
+
+func TestScript_Operators(t *testing.T) {
+	for _, test := range []struct{ expr, expected string }{
+		// Arithmetic, on ints (which stay ints, except for /) and floats (and a mix of them)
+		{"1 + 2", "3"},
+		{"1 - 2", "-1"},
+		{"3 * 4", "12"},
+		{"7 / 2", "3.5"},
+		{"6 / 3", "2.0"},
+		{"7 // 2", "3"},
+		{"-7 // 2", "-4"},
+		{"7 // -2", "-4"},
+		{"7 % 3", "1"},
+		{"-7 % 3", "2"},
+		{"7 % -3", "-2"},
+		{"1.5 + 1", "2.5"},
+		{"1 - 0.5", "0.5"},
+		{"2 * 1.5", "3.0"},
+		{"7.0 // 2", "3.0"},
+		{"-7.5 // 2", "-4.0"},
+		{"7.5 % 2", "1.5"},
+		{"-7.5 % 2", "0.5"},
+		{"1 + 2 * 3 - 4 / 2", "5.0"},
+		{"(1 + 2) * 3", "9"},
+		{"2 * 3 % 4", "2"},
+		{"10 - 4 - 3", "3"},
+		{"100 // 10 // 3", "3"},
+
+		// Unary operators
+		{"-3", "-3"},
+		{"+3", "3"},
+		{"--3", "3"},
+		{"-1.5", "-1.5"},
+		{"-(1 + 2) * 2", "-6"},
+		{"not True", "False"},
+		{"not 0", "True"},
+		{"not ''", "True"},
+		{"not [0]", "False"},
+		{"not None", "True"},
+		{"not 1 == 2", "True"},
+
+		// Strings, lists, and tuples (added, and repeated)
+		{"'a' + 'b'", "\"ab\""},
+		{"'ab' * 3", "\"ababab\""},
+		{"3 * 'ab'", "\"ababab\""},
+		{"'ab' * 0", "\"\""},
+		{"[1] + [2, 3]", "[1, 2, 3]"},
+		{"[1, 2] * 2", "[1, 2, 1, 2]"},
+		{"2 * [0]", "[0, 0]"},
+		{"[1] * -1", "[]"},
+		{"(1,) + (2, 3)", "(1, 2, 3)"},
+		{"() + ()", "()"},
+
+		// Comparisons, of numbers (by value) and strings (by their bytes)
+		{"1 < 2", "True"},
+		{"2 <= 2", "True"},
+		{"3 > 4", "False"},
+		{"4 >= 5", "False"},
+		{"1 < 1.5", "True"},
+		{"'a' < 'b'", "True"},
+		{"'B' < 'a'", "True"},
+		{"'ab' > 'a'", "True"},
+
+		// Equality, by value (and by contents, for lists, tuples, and dicts)
+		{"1 == 1.0", "True"},
+		{"1 != 1", "False"},
+		{"'a' == 'a'", "True"},
+		{"'1' == 1", "False"},
+		{"None == None", "True"},
+		{"None == False", "False"},
+		{"True == 1", "False"},
+		{"[1, [2]] == [1, [2]]", "True"},
+		{"[1, 2] == [2, 1]", "False"},
+		{"[1] == (1,)", "False"},
+		{"(1, 2) == (1, 2)", "True"},
+		{"{'a': 1, 'b': 2} == {'b': 2, 'a': 1}", "True"},
+		{"{'a': 1} == {'a': 2}", "False"},
+		{"{'a': 1} != {'a': 1, 'b': 2}", "True"},
+
+		// Membership
+		{"'b' in 'abc'", "True"},
+		{"'' in 'abc'", "True"},
+		{"'d' not in 'abc'", "True"},
+		{"2 in [1, 2]", "True"},
+		{"2.0 in [1, 2]", "True"},
+		{"[2] in [[1], [2]]", "True"},
+		{"3 not in (1, 2)", "True"},
+		{"'k' in {'k': 1}", "True"},
+		{"1 in {'k': 1}", "False"},
+
+		// and and or are whichever operand decided them (and not evaluating the other)
+		{"True and 'yes'", "\"yes\""},
+		{"0 and undefined", "0"},
+		{"[] or 'default'", "\"default\""},
+		{"'set' or undefined", "\"set\""},
+		{"None or 0", "0"},
+		{"1 and 2 and 3", "3"},
+		{"0 or '' or None", "None"},
+		{"False or True and False", "False"},
+		{"not False and True", "True"},
+
+		// Conditional expressions
+		{"'yes' if 1 else 'no'", "\"yes\""},
+		{"'yes' if [] else 'no'", "\"no\""},
+		{"1 if False else 2 if False else 3", "3"},
+		{"undefined if False else 'ok'", "\"ok\""},
+
+		// Indexes and slices
+		{"[1, 2, 3][0]", "1"},
+		{"[1, 2, 3][-1]", "3"},
+		{"(1, 2)[1]", "2"},
+		{"'abc'[1]", "\"b\""},
+		{"'abc'[-3]", "\"a\""},
+		{"{'a': 1}['a']", "1"},
+		{"{1: 'int', 1.5: 'float', None: 'none', True: 'bool'}[1.5]", "\"float\""},
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][-2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:-1]", "[1, 2, 3]"},
+		{"[1, 2, 3, 4][3:1]", "[]"},
+		{"[1, 2, 3, 4][-10:10]", "[1, 2, 3, 4]"},
+		{"(1, 2, 3)[1:]", "(2, 3)"},
+		{"'hello'[1:4]", "\"ell\""},
+		{"'hello'[10:]", "\"\""},
+
+		// Literals
+		{"0", "0"},
+		{"1.5", "1.5"},
+		{"1e3", "1000.0"},
+		{"2.5E-1", "0.25"},
+		{"1.", "1.0"},
+		{"True", "True"},
+		{"None", "None"},
+		{"'it\\'s'", "\"it's\""},
+		{"\"tab\\tnew\\nline\\\\\"", "\"tab\\tnew\\nline\\\\\""},
+		{"'a' 'b' \"c\"", "\"abc\""},
+		{"'\\q'", "\"\\\\q\""},
+		{"[]", "[]"},
+		{"[1, 'a', None,]", "[1, \"a\", None]"},
+		{"()", "()"},
+		{"(1)", "1"},
+		{"(1,)", "(1,)"},
+		{"1, 2", "(1, 2)"},
+		{"{}", "{}"},
+		{"{'b': 1, 'a': 2,}", "{\"b\": 1, \"a\": 2}"},
+		{"{'a': 1, 'a': 2}", "{\"a\": 2}"},
+		{"[\n  1,\n  2,\n]", "[1, 2]"},
+	} {
+		result, err := evalTestScript(t, "", test.expr)
+		assert.Nil(t, err, test.expr)
+		assert.Equal(t, test.expected, result, test.expr)
+	}
+}
+
+func TestScript_OperatorErrors(t *testing.T) {
+	for _, test := range []struct{ expr, message string }{
+		{"1 + 'a'", "unsupported operands for +: int and string"},
+		{"'a' + 1", "unsupported operands for +: string and int"},
+		{"[1] + (2,)", "unsupported operands for +: list and tuple"},
+		{"'a' - 'b'", "unsupported operands for -: string and string"},
+		{"'a' * 'b'", "unsupported operands for *: string and string"},
+		{"'a' * 1.5", "unsupported operands for *: string and float"},
+		{"(1,) * 2", "unsupported operands for *: tuple and int"},
+		{"[1] / 2", "unsupported operands for /: list and int"},
+		{"None + 1", "unsupported operands for +: NoneType and int"},
+		{"True + 1", "unsupported operands for +: bool and int"},
+		{"{} + {}", "unsupported operands for +: dict and dict"},
+		{"1 / 0", "division by zero"},
+		{"1 // 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"1.5 / 0", "division by zero"},
+		{"1 // 0.0", "division by zero"},
+		{"1.5 % 0", "division by zero"},
+		{"-'a'", "unsupported operand for unary -: string"},
+		{"+[1]", "unsupported operand for unary +: list"},
+		{"-None", "unsupported operand for unary -: NoneType"},
+		{"1 < 'a'", "can't compare int with string"},
+		{"[1] < [2]", "can't compare list with list"},
+		{"None >= 0", "can't compare NoneType with int"},
+		{"1 in 'abc'", "'in <string>' needs a string, not int"},
+		{"1 in 2", "'in' needs a string, list, tuple, or dict, not int"},
+		{"[] in {}", "a list can't be a dict key"},
+		{"[1][1]", "index 1 out of range (length 1)"},
+		{"[1][-2]", "index -2 out of range (length 1)"},
+		{"''[0]", "index 0 out of range (length 0)"},
+		{"[1]['a']", "a list index must be an int, not string"},
+		{"'abc'[1.0]", "a string index must be an int, not float"},
+		{"(1,)[None]", "a tuple index must be an int, not NoneType"},
+		{"1[0]", "a int can't be indexed"},
+		{"{'a': 1}['b']", "key \"b\" not in dict"},
+		{"{'a': 1}[[]]", "a list can't be a dict key"},
+		{"1[0:1]", "a int can't be sliced"},
+		{"{}[0:1]", "a dict can't be sliced"},
+		{"[1]['a':]", "slice indexes must be ints, not string"},
+		{"{(1, 2): 3}", "a tuple can't be a dict key"},
+		{"{{}: 1}", "a dict can't be a dict key"},
+		{"undefined", "undefined: undefined"},
+		{"1()", "a int can't be called"},
+		{"'a'()", "a string can't be called"},
+		{"(1).real", "int has no attribute real"},
+		{"[].nothing", "list has no attribute nothing"},
+		{"None.x", "NoneType has no attribute x"},
+	} {
+		_, err := evalTestScript(t, "", test.expr)
+		assert.ErrorContains(t, err, "line 2: " + test.message, test.expr)
+	}
+}
+
+func TestScript_Statements(t *testing.T) {
+	for _, test := range []struct{ name, source, output string }{
+		{"assignment", "x = 1\ny = x\nx = 2\nprint(x, y)\n", "2 1\n"},
+		{"augmented assignment", "x = 10\nx += 5\nx -= 3\nx *= 2\nx //= 5\nx %= 3\nprint(x)\nx /= 4\nprint(x)\ns = 'a'\ns += 'b'\ns *= 2\nprint(s)\nl = [1]\nl += [2]\nprint(l)\n", "1\n0.25\nabab\n[1, 2]\n"},
+		{"augmented item assignment", "d = {'n': 1}\nd['n'] += 1\nl = [1, 2]\nl[-1] *= 10\nprint(d, l)\n", "{\"n\": 2} [1, 20]\n"},
+		{"item assignment", "l = [1, 2, 3]\nl[0] = 'a'\nl[-1] = 'c'\nd = {}\nd['k'] = 1\nd[2] = None\nd['k'] = 3\nprint(l, d)\n", "[\"a\", 2, \"c\"] {\"k\": 3, 2: None}\n"},
+		{"nested item assignment", "d = {'l': [0, 0]}\nd['l'][1] = 5\nprint(d)\n", "{\"l\": [0, 5]}\n"},
+		{"unpacking", "a, b = 1, 2\n(c, d) = [3, 4]\n[e, f] = (5, 6)\ng, (h, i) = 7, (8, 9)\nprint(a, b, c, d, e, f, g, h, i)\n", "1 2 3 4 5 6 7 8 9\n"},
+		{"swapping", "a, b = 1, 2\na, b = b, a\nprint(a, b)\n", "2 1\n"},
+		{"unpacking into items", "l = [0, 0]\nl[0], l[1] = 'x', 'y'\nprint(l)\n", "[\"x\", \"y\"]\n"},
+		{"trailing comma tuple", "t = 1,\nprint(t, len(t))\n", "(1,) 1\n"},
+		{"aliasing", "a = [1]\nb = a\nb.append(2)\nprint(a)\n", "[1, 2]\n"},
+		{"semicolons", "x = 1; y = 2; print(x + y)\nprint('done');\n", "3\ndone\n"},
+		{"comments and blank lines", "# start\n\nx = 1  # one\n    # indented comment\n\nprint(x)\n", "1\n"},
+		{"if", "if 1 < 2:\n    print('yes')\nif 1 > 2:\n    print('no')\n", "yes\n"},
+		{"if else", "if []:\n    print('full')\nelse:\n    print('empty')\n", "empty\n"},
+		{"elif", "for n in [1, 5, 10]:\n    if n < 3:\n        print(n, 'small')\n    elif n < 7:\n        print(n, 'medium')\n    elif n < 9:\n        print(n, 'large')\n    else:\n        print(n, 'huge')\n", "1 small\n5 medium\n10 huge\n"},
+		{"single-line blocks", "if True: print('a'); print('b')\nfor i in [1, 2]: print(i)\n", "a\nb\n1\n2\n"},
+		{"nested blocks", "for i in range(3):\n    if i % 2 == 0:\n        for j in range(i):\n            print(i, j)\n    else:\n        print('odd', i)\n", "odd 1\n2 0\n2 1\n"},
+		{"tab indentation", "if True:\n\tprint('tab')\n\tif True:\n\t\tprint('tabs')\n", "tab\ntabs\n"},
+		{"for over a list", "for x in ['a', 'b']:\n    print(x)\n", "a\nb\n"},
+		{"for over a tuple", "for x in (1, 2):\n    print(x)\n", "1\n2\n"},
+		{"for over a dict", "for k in {'b': 1, 'a': 2}:\n    print(k)\n", "b\na\n"},
+		{"for over items", "for k, v in {'a': 1, 'b': 2}.items():\n    print(k, v)\n", "a 1\nb 2\n"},
+		{"for over an empty list", "for x in []:\n    print(x)\nprint('after')\n", "after\n"},
+		{"for over a tuple literal", "for x in 1, 2:\n    print(x)\n", "1\n2\n"},
+		{"for into an item", "l = [0]\nfor l[0] in [1, 2]:\n    pass\nprint(l)\n", "[2]\n"},
+		{"for changing its list", "l = [1, 2]\nfor x in l:\n    l.append(x)\nprint(l)\n", "[1, 2, 1, 2]\n"},
+		{"loop variable after the loop", "for i in range(3):\n    pass\nprint(i)\n", "2\n"},
+		{"break", "for i in range(10):\n    if i == 3:\n        break\n    print(i)\n", "0\n1\n2\n"},
+		{"continue", "for i in range(5):\n    if i % 2:\n        continue\n    print(i)\n", "0\n2\n4\n"},
+		{"break in a nested loop", "for i in range(2):\n    for j in range(5):\n        if j == 1:\n            break\n        print(i, j)\n", "0 0\n1 0\n"},
+		{"pass", "pass\nif True:\n    pass\ndef f():\n    pass\nprint(f())\n", "None\n"},
+		{"def", "def add(a, b):\n    return a + b\nprint(add(1, 2), add('a', 'b'))\n", "3 ab\n"},
+		{"defaults", "def greet(name, greeting='hello', punctuation='!'):\n    return greeting + ' ' + name + punctuation\nprint(greet('a'))\nprint(greet('b', 'hi'))\nprint(greet('c', punctuation='?'))\nprint(greet(greeting='yo', name='d'))\n", "hello a!\nhi b!\nhello c?\nyo d!\n"},
+		{"defaults are evaluated once", "n = 1\ndef f(x=n):\n    return x\nn = 2\nprint(f())\n", "1\n"},
+		{"return without a value", "def f(x):\n    if x:\n        return\n    return 'no'\nprint(f(1), f(0))\n", "None no\n"},
+		{"falling off the end", "def f():\n    x = 1\nprint(f())\n", "None\n"},
+		{"return a tuple", "def f():\n    return 1, 2\na, b = f()\nprint(a, b, f())\n", "1 2 (1, 2)\n"},
+		{"return from a loop", "def first_even(items):\n    for item in items:\n        if item % 2 == 0:\n            return item\n    return None\nprint(first_even([1, 3, 4, 6]), first_even([1]))\n", "4 None\n"},
+		{"locals are their own", "x = 'global'\ndef f():\n    x = 'local'\n    return x\nprint(f(), x)\n", "local global\n"},
+		{"globals are readable", "prefix = '>'\ndef f(s):\n    return prefix + s\nprefix = '>>'\nprint(f('x'))\n", ">>x\n"},
+		{"functions calling functions", "def double(x):\n    return x * 2\ndef quadruple(x):\n    return double(double(x))\nprint(quadruple(3))\n", "12\n"},
+		{"a function called again", "def f(x):\n    return x + 1\nprint(f(f(1)))\n", "3\n"},
+		{"functions as values", "def f(x):\n    return x * 10\ng = f\nprint(g(2), sorted([3, 1, 2], key=f), type(f))\n", "20 [1, 2, 3] function\n"},
+		{"nested defs", "def outer(x):\n    def inner(y):\n        return x + y\n    return inner(10)\nprint(outer(1))\n", "11\n"},
+		{"def in a loop can't break", "for i in range(2):\n    def f():\n        return i\n    print(f())\n", "0\n1\n"},
+		{"comprehensions", "print([x * 2 for x in [1, 2, 3]], [x for x in range(10) if x % 3 == 0], [k + str(v) for k, v in {'a': 1}.items()])\n", "[2, 4, 6] [0, 3, 6, 9] [\"a1\"]\n"},
+		{"nested comprehensions", "print([[y for y in range(x)] for x in range(3)])\n", "[[], [0], [0, 1]]\n"},
+		{"comprehension variables are their own", "x = 'kept'\nl = [x for x in range(3)]\nprint(x, l)\n", "kept [0, 1, 2]\n"},
+		{"comprehension over a conditional", "print([x for x in [1, 2] if x > 1 or x < 0])\n", "[2]\n"},
+		{"expression statements", "[1, 2]\n1 + 1\nprint('ok')\n", "ok\n"},
+		{"multi-line brackets", "x = [\n    1,\n  2,\n        3]\nprint(\n  x,\n  len(x)\n)\n", "[1, 2, 3] 3\n"},
+		{"triple-quoted strings", "s = '''one\n  two'''\nprint(s)\nprint(\"\"\"a 'quoted' \"word\" \"\"\")\n", "one\n  two\na 'quoted' \"word\" \n"},
+		{"windows line endings", "x = 1\r\nif x:\r\n    print(x)\r\n", "1\n"},
+		{"no trailing newline", "print('last')", "last\n"},
+		{"empty script", "", ""},
+	} {
+		output, err := runTestScript(t, test.source)
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.output, output, test.name)
+	}
+}
+
+func TestScript_StatementErrors(t *testing.T) {
+	for _, test := range []struct{ source, message string }{
+		// Syntax errors (found before anything's run)
+		{"print('first')\nx = = 1\n", "line 2: unexpected '='"},
+		{"x = 1 +\n", "line 1: unexpected the end of the line"},
+		{"x = (1, 2\ny = 3\n", "line 3: unclosed bracket at the end of the script"},
+		{"x = (1, 2\ny = 3)\n", "line 2: expected ')', found 'y'"},
+		{"x = 1)\n", "line 1: unexpected ')'"},
+		{"x = {'a' 1}\n", "line 1: expected ':', found '1'"},
+		{"x = {'a': 1 'b': 2}\n", "line 1: expected ',', found a string"},
+		{"f(1 2)\n", "line 1: expected ',', found '2'"},
+		{"x = [1 2]\n", "line 1: expected ']', found '2'"},
+		{"x = 1 2\n", "line 1: expected the end of the line, found '2'"},
+		{"x = $\n", "line 1: unexpected character '$'"},
+		{"x = 'a\n", "line 1: unterminated string"},
+		{"x = '''a\nb\n", "line 1: unterminated string"},
+		{"x.\n", "line 1: expected an attribute name, found the end of the line"},
+		{"x. 1\n", "line 1: expected an attribute name, found '1'"},
+		{"x = 1 if True\n", "line 1: expected 'else', found the end of the line"},
+		{"1 = x\n", "line 1: can't assign to that expression"},
+		{"f() = 1\n", "line 1: can't assign to that expression"},
+		{"x + 1 = 2\n", "line 1: can't assign to that expression"},
+		{"a, b += 1\n", "line 1: can't assign to that expression"},
+		{"[a, 1] = 1, 2\n", "line 1: can't assign to that expression"},
+		{"() = ()\n", "line 1: can't assign to that expression"},
+		{"for 1 in [1]:\n    pass\n", "line 1: can't assign to that expression"},
+		{"for x [1]:\n    pass\n", "line 1: expected 'in', found ':'"},
+		{"for x 1:\n    pass\n", "line 1: expected 'in', found '1'"},
+		{"for x in [1]\n    pass\n", "line 1: expected ':', found the end of the line"},
+		{"if True\n    pass\n", "line 1: expected ':', found the end of the line"},
+		{"if True:\n    pass\n  else:\n    pass\n", "line 3: unindent doesn't match any outer indentation"},
+		{"if True:\n    pass\nelse\n    pass\n", "line 3: expected ':', found the end of the line"},
+		{"elif True:\n    pass\n", "line 1: unexpected 'elif'"},
+		{"else:\n    pass\n", "line 1: unexpected 'else'"},
+		{"def:\n    pass\n", "line 1: expected the function's name, found ':'"},
+		{"def if():\n    pass\n", "line 1: expected the function's name, found 'if'"},
+		{"def f:\n    pass\n", "line 1: expected '(', found ':'"},
+		{"def f(1):\n    pass\n", "line 1: expected a parameter name, found '1'"},
+		{"def f(a, a):\n    pass\n", "line 1: expected a parameter name, found 'a'"},
+		{"def f(None):\n    pass\n", "line 1: expected a parameter name, found 'None'"},
+		{"def f(a b):\n    pass\n", "line 1: expected ',', found 'b'"},
+		{"def f(a=1, b):\n    pass\n", "line 1: parameter b needs a default, since the ones before it have one"},
+		{"def f():\nreturn 1\n", "line 2: expected an indented block, found 'return'"},
+		{"for x in []:\n", "line 2: expected an indented block, found the end of the script"},
+		{"x = 1\n    y = 2\n", "line 2: unexpected indent"},
+		{"while x:\n    pass\n", "line 1: while isn't supported (use a for loop over a range)"},
+		{"continue\n", "line 1: continue outside a loop"},
+		{"if True:\n    break\n", "line 2: break outside a loop"},
+		{"for i in []:\n    def f():\n        break\n", "line 3: break outside a loop"},
+		{"return\n", "line 1: return outside a function"},
+		{"for i in []:\n    return i\n", "line 2: return outside a function"},
+		{"x = not\n", "line 1: unexpected the end of the line"},
+		{"x = for\n", "line 1: unexpected 'for'"},
+		{"x = 1 == 2 == 3\n", "line 1: comparisons can't be chained (use and)"},
+		{"x = 1 < 2 in [True]\n", "line 1: comparisons can't be chained (use and)"},
+		{"f(a=1, 2)\n", "line 1: positional argument after a keyword argument"},
+		{"x = [y for y in]\n", "line 1: unexpected ']'"},
+		{"x = [y for 1 in [1]]\n", "line 1: can't assign to that expression"},
+		{"x = [y for y [1]]\n", "line 1: expected 'in', found ']'"},
+		{"x = 99999999999999999999\n", "line 1: invalid int 99999999999999999999"},
+
+		// Runtime errors (at the line they happened on)
+		{"x = 1\nprint(y)\n", "line 2: undefined: y"},
+		{"def f():\n    return missing\nx = 1\nf()\n", "line 2: undefined: missing"},
+		{"def f(x):\n    return x + 1\nf('a')\n", "line 2: unsupported operands for +: string and int"},
+		{"for i in range(3):\n    if i == 2:\n        x = 1 / 0\n", "line 3: division by zero"},
+		{"for x in 1:\n    pass\n", "line 1: can't loop over a int"},
+		{"for x in None:\n    pass\n", "line 1: can't loop over a NoneType"},
+		{"for x in 'abc':\n    pass\n", "line 1: can't loop over a string"},
+		{"for a, b in [1, 2]:\n    pass\n", "line 1: can't unpack a int"},
+		{"for a, b in [(1, 2, 3)]:\n    pass\n", "line 1: can't unpack 3 values into 2 variables"},
+		{"a, b = 1\n", "line 1: can't unpack a int"},
+		{"a, b = 'ab'\n", "line 1: can't unpack a string"},
+		{"a, b = 1, 2, 3\n", "line 1: can't unpack 3 values into 2 variables"},
+		{"x = (1, 2)\nx[0] = 3\n", "line 2: can't assign to an item of a tuple"},
+		{"x = 'ab'\nx[0] = 'c'\n", "line 2: can't assign to an item of a string"},
+		{"x = [1]\nx[1] = 2\n", "line 2: index 1 out of range (length 1)"},
+		{"x = [1]\nx['a'] = 2\n", "line 2: a list index must be an int, not string"},
+		{"x = {}\nx[[]] = 1\n", "line 2: a list can't be a dict key"},
+		{"x = {}\nx['n'] += 1\n", "line 2: key \"n\" not in dict"},
+		{"x += 1\n", "line 1: undefined: x"},
+		{"x = 'a'\nx -= 'b'\n", "line 2: unsupported operands for -: string and string"},
+		{"def f():\n    return f()\nf()\n", "line 2: function f called itself (recursion isn't allowed)"},
+		{"def f(n):\n    return g(n)\ndef g(n):\n    return f(n)\nf(1)\n", "line 4: function f called itself (recursion isn't allowed)"},
+		{"def f(a):\n    pass\nf(1, 2)\n", "line 3: f() takes 1 arguments, but 2 were given"},
+		{"def f(a):\n    pass\nf()\n", "line 3: f() is missing argument a"},
+		{"def f(a):\n    pass\nf(1, a=2)\n", "line 3: f() got more than one value for a"},
+		{"def f(a):\n    pass\nf(1, b=1)\n", "line 3: f() got an unexpected keyword argument b"},
+		{"def f(a):\n    pass\nf(a=1, a=2)\n", "line 3: keyword argument a given more than once"},
+		{"def f(a=undefined):\n    pass\n", "line 1: undefined: undefined"},
+		{"x = [1 / 0 for i in range(1)]\n", "line 1: division by zero"},
+		{"x = [i for i in 5]\n", "line 1: can't loop over a int"},
+		{"x = [i for i in [1] if undefined]\n", "line 1: undefined: undefined"},
+		{"fail('stopped at', 3)\n", "line 1: fail: stopped at 3"},
+	} {
+		_, err := runTestScript(t, test.source)
+		assert.ErrorContains(t, err, test.message, test.source)
+	}
+}
+
+func TestScript_Builtins(t *testing.T) {
+	for _, test := range []struct{ expr, expected string }{
+		{"len('abc')", "3"},
+		{"len('')", "0"},
+		{"len([1, 2])", "2"},
+		{"len((1,))", "1"},
+		{"len({'a': 1, 'b': 2})", "2"},
+		{"len(x='ab')", "2"},
+		{"range(3)", "[0, 1, 2]"},
+		{"range(0)", "[]"},
+		{"range(-2)", "[]"},
+		{"range(2, 5)", "[2, 3, 4]"},
+		{"range(5, 2)", "[]"},
+		{"range(0, 10, 3)", "[0, 3, 6, 9]"},
+		{"range(5, 0, -2)", "[5, 3, 1]"},
+		{"range(0, 5, -1)", "[]"},
+		{"range(start=1, stop=3)", "[1, 2]"},
+		{"str(1)", "\"1\""},
+		{"str(1.5)", "\"1.5\""},
+		{"str(2.0)", "\"2.0\""},
+		{"str('a')", "\"a\""},
+		{"str(None)", "\"None\""},
+		{"str(True)", "\"True\""},
+		{"str([1, 'a'])", "\"[1, \\\"a\\\"]\""},
+		{"str((1,))", "\"(1,)\""},
+		{"str({'a': None})", "\"{\\\"a\\\": None}\""},
+		{"str(len)", "\"<built-in function len>\""},
+		{"str([].append)", "\"<built-in function list.append>\""},
+		{"int(3)", "3"},
+		{"int(3.9)", "3"},
+		{"int(-3.9)", "-3"},
+		{"int(True)", "1"},
+		{"int(False)", "0"},
+		{"int('42')", "42"},
+		{"int(' -7 ')", "-7"},
+		{"float(2)", "2.0"},
+		{"float(1.5)", "1.5"},
+		{"float('2.5')", "2.5"},
+		{"float(' 1e2 ')", "100.0"},
+		{"bool()", "False"},
+		{"bool(0)", "False"},
+		{"bool(0.0)", "False"},
+		{"bool('')", "False"},
+		{"bool([])", "False"},
+		{"bool(())", "False"},
+		{"bool({})", "False"},
+		{"bool(None)", "False"},
+		{"bool(1)", "True"},
+		{"bool('False')", "True"},
+		{"bool([0])", "True"},
+		{"bool(len)", "True"},
+		{"type(None)", "\"NoneType\""},
+		{"type(True)", "\"bool\""},
+		{"type(1)", "\"int\""},
+		{"type(1.0)", "\"float\""},
+		{"type('')", "\"string\""},
+		{"type([])", "\"list\""},
+		{"type(())", "\"tuple\""},
+		{"type({})", "\"dict\""},
+		{"type(len)", "\"builtin_function_or_method\""},
+		{"list()", "[]"},
+		{"list((1, 2))", "[1, 2]"},
+		{"list({'a': 1, 'b': 2})", "[\"a\", \"b\"]"},
+		{"tuple()", "()"},
+		{"tuple([1, 2])", "(1, 2)"},
+		{"tuple([1])", "(1,)"},
+		{"dict()", "{}"},
+		{"dict(b=2, a=1)", "{\"a\": 1, \"b\": 2}"},
+		{"dict([('a', 1), ['b', 2]])", "{\"a\": 1, \"b\": 2}"},
+		{"dict({'a': 1}, b=2)", "{\"a\": 1, \"b\": 2}"},
+		{"dict([('a', 1)], a=2)", "{\"a\": 2}"},
+		{"sorted([3, 1, 2])", "[1, 2, 3]"},
+		{"sorted([3, 1, 2], reverse=True)", "[3, 2, 1]"},
+		{"sorted(['b', 'a', 'C'])", "[\"C\", \"a\", \"b\"]"},
+		{"sorted([1.5, 1, 2])", "[1, 1.5, 2]"},
+		{"sorted({'b': 1, 'a': 2})", "[\"a\", \"b\"]"},
+		{"sorted((2, 1))", "[1, 2]"},
+		{"sorted([])", "[]"},
+		{"sorted(['bb', 'a', 'ccc'], key=len)", "[\"a\", \"bb\", \"ccc\"]"},
+		{"sorted(['bb', 'a', 'cc', 'b'], key=len)", "[\"a\", \"b\", \"bb\", \"cc\"]"},
+		{"sorted(['bb', 'a', 'cc', 'b'], key=len, reverse=True)", "[\"bb\", \"cc\", \"a\", \"b\"]"},
+		{"reversed([1, 2, 3])", "[3, 2, 1]"},
+		{"reversed((1, 2))", "[2, 1]"},
+		{"reversed([])", "[]"},
+		{"enumerate(['a', 'b'])", "[(0, \"a\"), (1, \"b\")]"},
+		{"enumerate(['a'], start=5)", "[(5, \"a\")]"},
+		{"enumerate([], 1)", "[]"},
+		{"zip([1, 2], ['a', 'b'])", "[(1, \"a\"), (2, \"b\")]"},
+		{"zip([1, 2, 3], ('a',))", "[(1, \"a\")]"},
+		{"zip([1, 2])", "[(1,), (2,)]"},
+		{"zip([1], [2], [3])", "[(1, 2, 3)]"},
+		{"zip()", "[]"},
+		{"min(3, 1, 2)", "1"},
+		{"min([3, 1, 2])", "1"},
+		{"min('b', 'a')", "\"a\""},
+		{"min(1, 0.5)", "0.5"},
+		{"min([7])", "7"},
+		{"max(3, 1, 2)", "3"},
+		{"max((1, 5))", "5"},
+		{"max(['a', 'c', 'b'])", "\"c\""},
+		{"max(1, 1.0)", "1"},
+		{"abs(-2)", "2"},
+		{"abs(2)", "2"},
+		{"abs(-1.5)", "1.5"},
+		{"abs(0)", "0"},
+		{"any([0, '', 1])", "True"},
+		{"any([0, None])", "False"},
+		{"any([])", "False"},
+		{"all([1, 'a', [0]])", "True"},
+		{"all([1, 0])", "False"},
+		{"all([])", "True"},
+		{"all({'a': 1})", "True"},
+		{"print('x')", "None"},
+	} {
+		result, err := evalTestScript(t, "", test.expr)
+		assert.Nil(t, err, test.expr)
+		assert.Equal(t, test.expected, result, test.expr)
+	}
+
+	// print prints its args separated by spaces (or its sep), unquoted
+	output, err := runTestScript(t, "print()\nprint(1, 'a', [1, 'a'], None, 1.0)\nprint('a', 'b', sep=', ')\nprint('a', 'b', sep='')\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "\n1 a [1, \"a\"] None 1.0\na, b\nab\n", output)
+}
+
+func TestScript_BuiltinErrors(t *testing.T) {
+	for _, test := range []struct{ expr, message string }{
+		{"len()", "len() is missing argument x"},
+		{"len(1)", "a int has no len"},
+		{"len(None)", "a NoneType has no len"},
+		{"len('a', 'b')", "len() takes at most 1 arguments, but 2 were given"},
+		{"len(y='a')", "len() got an unexpected keyword argument y"},
+		{"len('a', x='b')", "len() got more than one value for x"},
+		{"range()", "range() is missing argument start"},
+		{"range('3')", "stop must be an int, not string"},
+		{"range(1.5)", "stop must be an int, not float"},
+		{"range(0, 1, 1.0)", "step must be an int, not float"},
+		{"range(0, 10, 0)", "range's step can't be zero"},
+		{"range(1, 2, 3, 4)", "range() takes at most 3 arguments, but 4 were given"},
+		{"range(100000000)", "range is too long (more than 10000000 items)"},
+		{"range(0, -100000000, -1)", "range is too long"},
+		{"str()", "str() is missing argument x"},
+		{"int('abc')", "invalid int \"abc\""},
+		{"int('1.5')", "invalid int \"1.5\""},
+		{"int(None)", "can't convert a NoneType to an int"},
+		{"int([])", "can't convert a list to an int"},
+		{"float('abc')", "invalid float \"abc\""},
+		{"float(None)", "can't convert a NoneType to a float"},
+		{"float(True)", "can't convert a bool to a float"},
+		{"bool(1, 2)", "bool() takes at most 1 arguments, but 2 were given"},
+		{"type()", "type() is missing argument x"},
+		{"list(1)", "can't loop over a int"},
+		{"list('abc')", "can't loop over a string"},
+		{"tuple(1.5)", "can't loop over a float"},
+		{"dict(1, 2)", "dict() takes at most 1 argument, but 2 were given"},
+		{"dict(1)", "can't loop over a int"},
+		{"dict([1, 2])", "dict() needs a list of (key, value) pairs"},
+		{"dict([(1, 2, 3)])", "dict() needs a list of (key, value) pairs"},
+		{"dict([([], 1)])", "a list can't be a dict key"},
+		{"sorted()", "sorted() is missing argument iterable"},
+		{"sorted(1)", "can't loop over a int"},
+		{"sorted([1, 'a'])", "can't compare"},
+		{"sorted([[1], [2]])", "can't compare list with list"},
+		{"sorted([1, 2], key=1)", "a int can't be called"},
+		{"sorted([1, 2], cmp=len)", "sorted() got an unexpected keyword argument cmp"},
+		{"reversed(1)", "can't loop over a int"},
+		{"enumerate(1)", "can't loop over a int"},
+		{"enumerate([1], start='a')", "start must be an int, not string"},
+		{"zip([1], 2)", "can't loop over a int"},
+		{"zip([1], strict=True)", "zip() got an unexpected keyword argument strict"},
+		{"min()", "min() of nothing"},
+		{"min([])", "min() of nothing"},
+		{"max(1)", "can't loop over a int"},
+		{"max(1, 'a')", "can't compare string with int"},
+		{"max([1], key=len)", "max() got an unexpected keyword argument key"},
+		{"abs('a')", "x must be a number, not string"},
+		{"abs(None)", "x must be a number, not NoneType"},
+		{"any(1)", "can't loop over a int"},
+		{"all()", "all() is missing argument iterable"},
+		{"print('a', sep=1)", "sep must be a string, not int"},
+		{"fail()", "fail: "},
+		{"fail('no', [1], None)", "fail: no [1] None"},
+	} {
+		_, err := evalTestScript(t, "", test.expr)
+		assert.ErrorContains(t, err, "line 2: " + test.message, test.expr)
+	}
+}
+
+func TestScript_Methods(t *testing.T) {
+	for _, test := range []struct{ setup, expr, expected string }{
+		// Lists' (which change them in place)
+		{"l = [1]\nl.append(2)\nl.append([3])", "l", "[1, 2, [3]]"},
+		{"l = [1]\nr = l.append(2)", "r", "None"},
+		{"l = [1]\nl.extend([2, 3])\nl.extend((4,))\nl.extend({'k': 5})", "l", "[1, 2, 3, 4, \"k\"]"},
+		{"l = [1, 2]\nl.extend(l)", "l", "[1, 2, 1, 2]"},
+		{"l = [1, 3]\nl.insert(1, 2)\nl.insert(0, 0)\nl.insert(100, 4)\nl.insert(-1, 'x')\nl.insert(-100, 'y')", "l", "[\"y\", 0, 1, 2, 3, \"x\", 4]"},
+		{"l = [1, 2, 3]\np = l.pop()", "(p, l)", "(3, [1, 2])"},
+		{"l = [1, 2, 3]\np = l.pop(0)", "(p, l)", "(1, [2, 3])"},
+		{"l = [1, 2, 3]\np = l.pop(-2)", "(p, l)", "(2, [1, 3])"},
+		{"l = ['a', 'b', 'a']", "l.index('a')", "0"},
+		{"l = [1, 2.0]", "l.index(2)", "1"},
+		{"l = [1, 2, 1]\nl.remove(1)", "l", "[2, 1]"},
+		{"l = [1, 2]\nl.clear()", "l", "[]"},
+
+		// Dicts'
+		{"d = {'a': 1}", "d.get('a')", "1"},
+		{"d = {'a': 1}", "d.get('b')", "None"},
+		{"d = {'a': 1}", "d.get('b', 'default')", "\"default\""},
+		{"d = {'b': 1, 'a': 2}", "d.keys()", "[\"b\", \"a\"]"},
+		{"d = {'b': 1, 'a': 2}", "d.values()", "[1, 2]"},
+		{"d = {'b': 1, 'a': 2}", "d.items()", "[(\"b\", 1), (\"a\", 2)]"},
+		{"d = {}", "(d.keys(), d.values(), d.items())", "([], [], [])"},
+		{"d = {'a': 1, 'b': 2}\np = d.pop('a')", "(p, d)", "(1, {\"b\": 2})"},
+		{"d = {'a': 1}", "d.pop('z', 0)", "0"},
+		{"d = {'a': 1}", "d.pop('z', None)", "None"},
+		{"d = {'a': 1}\nr = d.setdefault('a', 5)", "(r, d)", "(1, {\"a\": 1})"},
+		{"d = {'a': 1}\nr = d.setdefault('b', 5)", "(r, d)", "(5, {\"a\": 1, \"b\": 5})"},
+		{"d = {}\nr = d.setdefault('k')", "(r, d)", "(None, {\"k\": None})"},
+		{"d = {'a': 1, 'b': 2}\nd.update({'b': 3, 'c': 4})", "d", "{\"a\": 1, \"b\": 3, \"c\": 4}"},
+		{"d = {'a': 1}\nd.clear()\nd['b'] = 2", "d", "{\"b\": 2}"},
+		{"d = {'a': 1, 'b': 2, 'c': 3}\nd.pop('b')\nd['b'] = 4", "d", "{\"a\": 1, \"c\": 3, \"b\": 4}"},
+		{"d = {'a': 1}\nkeys = d.keys()\nkeys.append('x')", "d", "{\"a\": 1}"},
+
+		// Strings' (which make new strings)
+		{"", "'MiXed'.lower()", "\"mixed\""},
+		{"", "'MiXed'.upper()", "\"MIXED\""},
+		{"", "' \\t padded\\n '.strip()", "\"padded\""},
+		{"", "'  padded  '.lstrip()", "\"padded  \""},
+		{"", "'  padded  '.rstrip()", "\"  padded\""},
+		{"", "'xxhixx'.strip('x')", "\"hi\""},
+		{"", "'xyhiyx'.lstrip('xy')", "\"hiyx\""},
+		{"", "'hi!?!'.rstrip('!?')", "\"hi\""},
+		{"", "'report.pdf'.startswith('rep')", "True"},
+		{"", "'report.pdf'.startswith('pdf')", "False"},
+		{"", "'report.pdf'.endswith('.pdf')", "True"},
+		{"", "'report.pdf'.endswith('')", "True"},
+		{"", "'{} and {}'.format(1, 'a')", "\"1 and a\""},
+		{"", "'{1}{0}{1}'.format('a', 'b')", "\"bab\""},
+		{"", "'{name} is {age}'.format(name='x', age=3)", "\"x is 3\""},
+		{"", "'{}-{k}-{}'.format(1, 2, k=3)", "\"1-3-2\""},
+		{"", "'{{literal}} {}'.format([1, 'a'])", "\"{literal} [1, \\\"a\\\"]\""},
+		{"", "'no fields'.format(1)", "\"no fields\""},
+		{"", "', '.join(['a', 'b', 'c'])", "\"a, b, c\""},
+		{"", "''.join(('a', 'b'))", "\"ab\""},
+		{"", "'-'.join([])", "\"\""},
+		{"", "'-'.join(['only'])", "\"only\""},
+		{"", "'a, b,c'.split(',')", "[\"a\", \" b\", \"c\"]"},
+		{"", "'a--b'.split('-')", "[\"a\", \"\", \"b\"]"},
+		{"", "'  a \\t b\\n'.split()", "[\"a\", \"b\"]"},
+		{"", "''.split()", "[]"},
+		{"", "'abc'.split('abc')", "[\"\", \"\"]"},
+		{"", "'a-b-c'.replace('-', '+')", "\"a+b+c\""},
+		{"", "'aaa'.replace('a', 'bb')", "\"bbbbbb\""},
+		{"", "'abc'.replace('x', 'y')", "\"abc\""},
+		{"", "'abc'.replace('', '-')", "\"-a-b-c-\""},
+		{"", "'hello'.find('l')", "2"},
+		{"", "'hello'.find('z')", "-1"},
+		{"", "'hello'.find('')", "0"},
+		{"", "'banana'.count('a')", "3"},
+		{"", "'banana'.count('ana')", "1"},
+		{"", "'banana'.count('z')", "0"},
+		{"s = 'unchanged'\ns.upper()", "s", "\"unchanged\""},
+
+		// (bound to what they came from)
+		{"l = []\nadd = l.append\nadd(1)\nadd(2)", "l", "[1, 2]"},
+		{"", "[s.upper() for s in 'a b'.split()]", "[\"A\", \"B\"]"},
+	} {
+		result, err := evalTestScript(t, test.setup, test.expr)
+		assert.Nil(t, err, test.setup + "; " + test.expr)
+		assert.Equal(t, test.expected, result, test.setup + "; " + test.expr)
+	}
+}
+
+func TestScript_MethodErrors(t *testing.T) {
+	for _, test := range []struct{ expr, message string }{
+		{"[].append()", "list.append() is missing argument x"},
+		{"[].append(1, 2)", "list.append() takes at most 1 arguments, but 2 were given"},
+		{"[].extend(1)", "can't loop over a int"},
+		{"[].extend('ab')", "can't loop over a string"},
+		{"[].insert(1)", "list.insert() is missing argument x"},
+		{"[].insert('a', 1)", "index must be an int, not string"},
+		{"[].pop()", "index -1 out of range (length 0)"},
+		{"[1].pop(1)", "index 1 out of range (length 1)"},
+		{"[1].pop('a')", "a list index must be an int, not string"},
+		{"[1].index(2)", "2 not in list"},
+		{"['a'].index('b')", "\"b\" not in list"},
+		{"[1].remove(2)", "2 not in list"},
+		{"[1].clear(1)", "list.clear() takes at most 0 arguments, but 1 were given"},
+		{"[].sort()", "list has no attribute sort"},
+		{"{}.get()", "dict.get() is missing argument key"},
+		{"{}.get([])", "a list can't be a dict key"},
+		{"{}.keys(1)", "dict.keys() takes at most 0 arguments, but 1 were given"},
+		{"{}.values(1)", "dict.values() takes at most 0 arguments"},
+		{"{}.items(1)", "dict.items() takes at most 0 arguments"},
+		{"{}.pop('a')", "key \"a\" not in dict"},
+		{"{}.pop([])", "a list can't be a dict key"},
+		{"{}.setdefault([])", "a list can't be a dict key"},
+		{"{}.update([('a', 1)])", "other must be a dict, not list"},
+		{"{}.update()", "dict.update() is missing argument other"},
+		{"{}.clear(1)", "dict.clear() takes at most 0 arguments"},
+		{"{}.append(1)", "dict has no attribute append"},
+		{"'a'.lower(1)", "string.lower() takes at most 0 arguments, but 1 were given"},
+		{"'a'.strip(1)", "chars must be a string, not int"},
+		{"'a'.startswith()", "string.startswith() is missing argument x"},
+		{"'a'.endswith(1)", "x must be a string, not int"},
+		{"'{}'.format()", "format string needs argument 0, but only 0 were given"},
+		{"'{1}'.format('a')", "format string needs argument 1, but only 1 were given"},
+		{"'{name}'.format(other=1)", "format string needs keyword argument name"},
+		{"'{'.format()", "unclosed { in format string"},
+		{"'}'.format()", "single } in format string"},
+		{"'-'.join([1, 2])", "joined items must be a string, not int"},
+		{"'-'.join('ab')", "can't loop over a string"},
+		{"'-'.join()", "string.join() is missing argument iterable"},
+		{"'a'.split(1)", "sep must be a string, not int"},
+		{"'a'.replace('a')", "string.replace() is missing argument new"},
+		{"'a'.replace(1, 'b')", "old must be a string, not int"},
+		{"'a'.replace('a', None)", "new must be a string, not NoneType"},
+		{"'a'.find(1)", "sub must be a string, not int"},
+		{"'a'.count()", "string.count() is missing argument sub"},
+		{"'a'.title()", "string has no attribute title"},
+		{"(1,).index(1)", "tuple has no attribute index"},
+	} {
+		_, err := evalTestScript(t, "", test.expr)
+		assert.ErrorContains(t, err, "line 2: " + test.message, test.expr)
+	}
+}
+
+func TestFormatScriptValue(t *testing.T) {
+	for _, test := range []struct{ value any; unquoted, quoted string }{
+		{nil, "None", "None"},
+		{true, "True", "True"},
+		{false, "False", "False"},
+		{-3, "-3", "-3"},
+		{2.0, "2.0", "2.0"},
+		{0.1, "0.1", "0.1"},
+		{1e21, "1e+21", "1e+21"},
+		{math.Inf(1), "+Inf", "+Inf"},
+		{math.NaN(), "NaN", "NaN"},
+		{"a\"b", "a\"b", "\"a\\\"b\""},
+		{&ScriptList{}, "[]", "[]"},
+		{&ScriptList{items: []any{"a", &ScriptList{items: []any{1}}}}, "[\"a\", [1]]", "[\"a\", [1]]"},
+		{ScriptTuple{}, "()", "()"},
+		{ScriptTuple{"a"}, "(\"a\",)", "(\"a\",)"},
+		{ScriptTuple{1, nil}, "(1, None)", "(1, None)"},
+		{&ScriptDict{keys: []any{"k", 1}, values: map[any]any{"k": "v", 1: 2.5}}, "{\"k\": \"v\", 1: 2.5}", "{\"k\": \"v\", 1: 2.5}"},
+		{&ScriptFunction{def: &ScriptDefStmt{name: "f"}}, "<function f>", "<function f>"},
+		{&ScriptModule{name: "random"}, "<module random>", "<module random>"},
+	} {
+		assert.Equal(t, test.unquoted, formatScriptValue(test.value, false), test.unquoted)
+		assert.Equal(t, test.quoted, formatScriptValue(test.value, true), test.quoted)
+	}
+}
+
+func TestTokenizeScript_Values(t *testing.T) {
+	for _, test := range []struct{ source, kind, text string }{
+		{"x", "name", "x"},
+		{"_private2", "name", "_private2"},
+		{"42", "int", "42"},
+		{"007", "int", "007"},
+		{"1.5", "float", "1.5"},
+		{"1.", "float", "1."},
+		{"1e3", "float", "1e3"},
+		{"1E+3", "float", "1E+3"},
+		{"2.5e-2", "float", "2.5e-2"},
+		{"'single'", "string", "single"},
+		{"\"double\"", "string", "double"},
+		{"'''triple'''", "string", "triple"},
+		{"\"\"\"it's \"quoted\" \"\"\"", "string", "it's \"quoted\" "},
+		{"'esc\\n\\t\\r\\\\\\'\\\"\\0'", "string", "esc\n\t\r\\'\"\x00"},
+		{"'unknown \\x escape'", "string", "unknown \\x escape"},
+		{"''", "string", ""},
+		{"//=", "op", "//="},
+		{"//", "op", "//"},
+		{"==", "op", "=="},
+		{"!=", "op", "!="},
+		{"<=", "op", "<="},
+		{"%=", "op", "%="},
+	} {
+		tokens, err := tokenizeScript(test.source)
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.kind, tokens[0].kind, test.source)
+		assert.Equal(t, test.text, tokens[0].text, test.source)
+		assert.Equal(t, []string{"newline", "eof"}, []string{tokens[1].kind, tokens[2].kind}, test.source)
+	}
+
+	// (1e, with no digits after it, is an int and then a name)
+	tokens, err := tokenizeScript("1e")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"int", "name"}, []string{tokens[0].kind, tokens[1].kind})
+
+	// Blocks are closed at the end of the script, however deep they are
+	tokens, err = tokenizeScript("if a:\n    if b:\n        c")
+	assert.Nil(t, err)
+	kinds := []string{}
+	for _, token := range tokens {
+		kinds = append(kinds, token.kind)
+	}
+	assert.Equal(t, []string{"name", "name", "op", "newline", "indent", "name", "name", "op", "newline", "indent", "name", "newline", "dedent", "dedent", "eof"}, kinds)
+
+	for source, message := range map[string]string{
+		"x = @\n": "line 1: unexpected character '@'",
+		"x = ]\n": "line 1: unexpected ']'",
+		"x = (\ny = 1\n": "line 3: unclosed bracket at the end of the script",
+		"if a:\n        b\n    c\n": "line 3: unindent doesn't match any outer indentation",
+		"x = 'a\n": "line 1: unterminated string",
+		"\n\nx = '''a\nb": "line 3: unterminated string",
+		"x = 'a\\'\n": "line 1: unterminated string",
+	} {
+		_, err := tokenizeScript(source)
+		assert.ErrorContains(t, err, message, source)
+	}
+}
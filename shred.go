@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// The patterns shred's passes overwrite a file with, in turn (repeated, with more passes than patterns)
+var ShredPatterns = []string{"random", "zeros", "ones"}
+
+// Options for the shred command
+type ShredOptions struct {
+	path				string
+	passes				int
+}
+
+// Response data from shred action
+type ShredResponse struct {
+	passes				int
+	bytesOverwritten	int64
+	status				string
+}
+
+// Parses shred's arguments: [-passes=n] (path)
+func parseShredOptions(args []string) (*ShredOptions, error) {
+	flags := flag.NewFlagSet("shred", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	passes := flags.Int("passes", len(ShredPatterns), "how many times to overwrite the file before deleting it")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shred: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for shred! Args: %v", args)
+	}
+	if *passes < 1 {
+		return nil, fmt.Errorf("invalid shred: -passes must be at least 1")
+	}
+	return &ShredOptions{path: flags.Arg(0), passes: *passes}, nil
+}
+
+// Overwrites the file with each pass's pattern in turn (syncing it to disk after each), then renames it to a random name (so its name
+// doesn't survive either) and deletes it, as anti-forensic wiping tools do
+func shredFile(path string, passes int) (*ShredResponse, error) {
+	response := new(ShredResponse)
+	if !fileExists(path) {
+		fmt.Printf("File %s not found for shredding!\n", path)
+		response.status = "not_found"
+		return response, fmt.Errorf("file_not_found: %s", path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		for pass := 0; pass < passes && err == nil; pass++ {
+			pattern := ShredPatterns[pass % len(ShredPatterns)]
+			err = overwriteFile(f, info.Size(), pattern)
+			if err == nil {
+				err = f.Sync()
+			}
+			if err == nil {
+				response.passes += 1
+				response.bytesOverwritten += info.Size()
+				fmt.Printf("Pass %d of %d: overwrote %d bytes of %s with %s\n", pass + 1, passes, info.Size(), path, pattern)
+			}
+		}
+	}
+	f.Close()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = "error"
+		return response, err
+	}
+
+	// Rename it away, then delete it
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	renamed := filepath.Join(filepath.Dir(path), hex.EncodeToString(suffix))
+	if err = os.Rename(path, renamed); err != nil {
+		renamed = path
+	}
+	if err = os.Remove(renamed); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	fmt.Printf("File %s shredded\n", path)
+	response.status = "shredded"
+	return response, nil
+}
+
+// Overwrites the first size bytes of the file with the pattern, a chunk at a time
+func overwriteFile(f *os.File, size int64, pattern string) error {
+	chunk := make([]byte, min(size, sizedFileChunkSize))
+	if pattern == "ones" {
+		for i := range chunk {
+			chunk[i] = 0xFF
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	for written := int64(0); written < size; {
+		if pattern == "random" {
+			rand.Read(chunk)
+		}
+		n, err := f.Write(chunk[:min(int64(len(chunk)), size - written)])
+		if err != nil {
+			return err
+		}
+		written += int64(n)
+	}
+	return nil
+}
+
+// Gets the status a failure to open or remove a file stands for
+func getFileErrorStatus(err error) string {
+	if os.IsNotExist(err) {
+		return "not_found"
+	} else if os.IsPermission(err) {
+		return "no_access"
+	}
+	return "error"
+}
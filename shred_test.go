@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Shred(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/evidence.log"
+	assert.Nil(t, os.WriteFile(path, []byte("Hello World!\n"), 0644))
+
+	// Each pass overwrites the whole file, then it's gone (under another name, too)
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "shred", path})
+	assert.Contains(t, output, fmt.Sprintf("Pass 1 of 3: overwrote 13 bytes of %s with random", path))
+	assert.Contains(t, output, fmt.Sprintf("Pass 3 of 3: overwrote 13 bytes of %s with ones", path))
+	assert.Contains(t, output, fmt.Sprintf("File %s shredded", path))
+	assert.Equal(t, activityLogEntry.activity, "shred")
+	assert.Equal(t, activityLogEntry.status, "shredded")
+	assert.Equal(t, activityLogEntry.details, "3 of 3 passes\\, 39 bytes overwritten")
+	assert.False(t, fileExists(path))
+	files, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+
+	assert.Nil(t, os.WriteFile(path, []byte("Hello World!\n"), 0644))
+	callMain([]string{"./noisemaker", "-sink=stdout", "shred", "-passes=7", path})
+	assert.Equal(t, activityLogEntry.details, "7 of 7 passes\\, 91 bytes overwritten")
+	callMain([]string{"./noisemaker", "-sink=stdout", "shred", path})
+	assert.Equal(t, activityLogEntry.status, "not_found")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "shred"}, "not enough arguments for shred! Args: []")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "shred", "-passes=0", path}, "invalid shred: -passes must be at least 1")
+}
+
+func TestOverwriteFile(t *testing.T) {
+	path := t.TempDir() + "/test.bin"
+	assert.Nil(t, os.WriteFile(path, []byte("Hello World!\n"), 0644))
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	assert.Nil(t, overwriteFile(f, 13, "zeros"))
+	contents, _ := os.ReadFile(path)
+	assert.Equal(t, make([]byte, 13), contents)
+	assert.Nil(t, overwriteFile(f, 13, "ones"))
+	contents, _ = os.ReadFile(path)
+	assert.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, contents)
+}
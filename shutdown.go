@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// The signals that stop a run gracefully (SIGTERM is ie. what a service manager sends)
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// Commands that stop gracefully on a shutdown signal themselves (recording their own entry), rather than being stopped by watchForShutdown
+var GracefulShutdownCommands = []string{"daemon", "collect", "watch"}
+
+// Response data from a shutdown
+type ShutdownResponse struct {
+	cleanups			int
+	failed				int
+	pending				int				// the cleanup actions left undone, without -cleanup
+	status				string
+}
+
+// How a shutdown exits the process (replaced in tests)
+var shutdownExit = os.Exit
+
+// Starts delivering shutdown signals to the returned channel, until the returned function's called
+func notifyShutdown() (chan os.Signal, func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, shutdownSignals...)
+	return signals, func() { signal.Stop(signals) }
+}
+
+// Watches for a shutdown signal while the parent's command runs. On one, the run is shut down (see shutdown), the activity log is closed
+// (once any entry that's being written has been, so no row is cut off partway), and the process exits. Returns the function that stops
+// watching.
+func watchForShutdown(activityLog Sink, parent *ActivityLogEntry) func() {
+	signals, stopSignals := notifyShutdown()
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case received := <-signals:
+			shutdown(activityLog, parent, received)
+			if runSummary != nil {
+				runSummary.end(activityLog, "interrupted", "received " + received.String())
+			}
+			logFileMutex.Lock()
+			activityLog.Close()
+			shutdownExit(1)
+			logFileMutex.Unlock()
+		case <-stopped:
+		}
+	}()
+	return func() {
+		stopSignals()
+		close(stopped)
+	}
+}
+
+// Shuts down the parent's run on the signal: with -cleanup, removes the artifacts the run made (see undoArtifacts), then logs a shutdown
+// entry recording the signal and the cleanup actions run (or left undone)
+func shutdown(activityLog Sink, parent *ActivityLogEntry, received os.Signal) *ShutdownResponse {
+	fmt.Printf("Received %v, shutting down...\n", received)
+	artifactsMutex.Lock()
+	artifacts := runArtifacts
+	runArtifacts = []*Artifact{}
+	artifactsMutex.Unlock()
+
+	response := &ShutdownResponse{status: "interrupted"}
+	if !*cleanupPtr {
+		response.pending = len(artifacts)
+	} else {
+		artifactsResponse := undoArtifacts(activityLog, parent, artifacts, "cleanup")
+		response.cleanups = artifactsResponse.artifacts
+		response.failed = artifactsResponse.failed
+	}
+
+	entry := newChildLogEntry(parent, "shutdown")
+	entry.method = escapeRawText(received.String())
+	entry.status = response.status
+	if *cleanupPtr {
+		entry.details = escapeRawText(fmt.Sprintf("%d cleanup actions run, %d failed", response.cleanups, response.failed))
+	} else {
+		entry.details = escapeRawText(fmt.Sprintf("%d cleanup actions left undone (without -cleanup)", response.pending))
+	}
+	writeLogEntry(activityLog, entry)
+	return response
+}
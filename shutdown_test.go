@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs the playbook's steps, then shuts the run down (as if it had been sent SIGTERM), with or without -cleanup
+func shutdownTestPlaybook(t *testing.T, steps string, cleanup bool) (*ShutdownResponse, []*ActivityLogEntry) {
+	playbookPath := t.TempDir() + "/playbook.yaml"
+	os.WriteFile(playbookPath, []byte("name: leftovers\nsteps:\n" + steps), 0644)
+	callMain([]string{"./noisemaker", "-sink=stdout", "-run-id=shutdown-run", "playbook", playbookPath})
+	assert.Equal(t, activityLogEntry.status, "completed")
+
+	*cleanupPtr = cleanup
+	defer func() { *cleanupPtr = false }()
+	recorder := newRunRecorderSink()
+	response := shutdown(recorder, activityLogEntry, syscall.SIGTERM)
+	return response, recorder.getEntries("shutdown-run")
+}
+
+func TestShutdown_Cleanup(t *testing.T) {
+	dir := t.TempDir()
+	response, entries := shutdownTestPlaybook(t, `
+  - command: create
+    args: ["` + dir + `/kept.txt"]
+  - command: create
+    args: ["` + dir + `/dropped.txt"]
+  - command: create
+    args: ["` + dir + `/gone.txt"]
+  - command: delete
+    args: ["` + dir + `/gone.txt"]
+`, true)
+
+	// Only what the run left behind is undone (the file it deleted itself isn't deleted again)
+	assert.Equal(t, 2, response.cleanups)
+	assert.Equal(t, 0, response.failed)
+	assert.False(t, fileExists(dir + "/kept.txt"))
+	assert.False(t, fileExists(dir + "/dropped.txt"))
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "delete", entries[0].activity)
+	assert.Equal(t, "delete " + dir + "/dropped.txt", entries[0].processCmd)
+	assert.Equal(t, "deleted", entries[0].status)
+	assert.Equal(t, "cleanup=true", entries[0].labels)
+	assert.Equal(t, "delete " + dir + "/kept.txt", entries[1].processCmd)
+	assert.Equal(t, "shutdown", entries[2].activity)
+	assert.Equal(t, "terminated", entries[2].method)
+	assert.Equal(t, "interrupted", entries[2].status)
+	assert.Equal(t, "2 cleanup actions run\\, 0 failed", entries[2].details)
+	assert.Equal(t, 8, entries[2].seq)
+}
+
+func TestShutdown_WithoutCleanup(t *testing.T) {
+	dir := t.TempDir()
+	response, entries := shutdownTestPlaybook(t, `
+  - command: create
+    args: ["` + dir + `/kept.txt"]
+`, false)
+
+	assert.Equal(t, 0, response.cleanups)
+	assert.Equal(t, 1, response.pending)
+	assert.True(t, fileExists(dir + "/kept.txt"))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "1 cleanup actions left undone (without -cleanup)", entries[0].details)
+}
+
+func TestWatchForShutdown(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("can't send SIGTERM on Windows")
+	}
+	exited := make(chan int, 1)
+	shutdownExit = func(code int) { exited <- code }
+	defer func() { shutdownExit = os.Exit }()
+
+	// The watcher catches the signal (so the test isn't killed), logs the shutdown, and exits
+	recorder := newRunRecorderSink()
+	parent := newActivityLogEntry("listen", nil)
+	parent.runId = "watched-run"
+	stopWatching := watchForShutdown(recorder, parent)
+	defer stopWatching()
+	process, err := os.FindProcess(os.Getpid())
+	assert.Nil(t, err)
+	assert.Nil(t, process.Signal(syscall.SIGTERM))
+	assert.Equal(t, 1, <-exited)
+	entries := recorder.getEntries("watched-run")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "shutdown", entries[0].activity)
+	assert.Equal(t, "terminated", entries[0].method)
+	assert.Equal(t, "interrupted", entries[0].status)
+}
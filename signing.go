@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The schema version the signature column was added in (entries can't be signed under older versions)
+const SignatureSchemaVersion = 10
+
+// How short an HMAC key can be (ie. `openssl rand -hex 32` makes a 64-byte key)
+const MinHMACKeyLength = 16
+
+// Response data from verify-signatures action
+type SignaturesResponse struct {
+	entries				int
+	valid				int
+	problems			[]string
+	status				string
+}
+
+// Signs activity log entries (with an HMAC key, or an Ed25519 private key), and verifies them (given either, or an Ed25519 public key)
+type LogSigner struct {
+	hmacKey				[]byte
+	privateKey			ed25519.PrivateKey
+	publicKey			ed25519.PublicKey
+}
+
+// The signer for -sign-key, if it's set
+var logSigner *LogSigner
+
+// The signature of the last entry written in each run (by run ID), which the next entry's signature covers, chaining them together
+var lastLogSignatures = map[string]string{}
+
+// Loads the key at path: a PEM Ed25519 private key (PKCS #8, ie. from `openssl genpkey -algorithm ed25519`) or public key (PKIX, for
+// verifying only), or anything else as an HMAC-SHA256 key (with surrounding whitespace trimmed)
+func loadLogSigner(path string) (*LogSigner, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		key := bytes.TrimSpace(contents)
+		if len(key) < MinHMACKeyLength {
+			return nil, fmt.Errorf("HMAC key in %s is too short (must be at least %d bytes)", path, MinHMACKeyLength)
+		}
+		return &LogSigner{hmacKey: key}, nil
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key in %s (must be Ed25519)", path)
+		}
+		return &LogSigner{privateKey: privateKey, publicKey: privateKey.Public().(ed25519.PublicKey)}, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported public key in %s (must be Ed25519)", path)
+		}
+		return &LogSigner{publicKey: publicKey}, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block '%s' in %s (must be an Ed25519 PRIVATE KEY or PUBLIC KEY, or an HMAC key)", block.Type, path)
+	}
+}
+
+// The algorithm recorded at the start of the signer's signatures
+func (signer *LogSigner) algorithm() string {
+	if signer.hmacKey != nil {
+		return "hmac-sha256"
+	}
+	return "ed25519"
+}
+
+// Whether the signer has a key it can sign with (rather than just an Ed25519 public key)
+func (signer *LogSigner) canSign() bool {
+	return signer.hmacKey != nil || signer.privateKey != nil
+}
+
+// Signs the entry and the previous signature in its run, as <algorithm>:<schema version>:<base64 signature>
+func (signer *LogSigner) sign(entry *ActivityLogEntry, previous string) string {
+	text := getSignedText(entry, SchemaVersion, previous)
+	var signature []byte
+	if signer.hmacKey != nil {
+		signature = hmacSHA256(signer.hmacKey, text)
+	} else {
+		signature = ed25519.Sign(signer.privateKey, []byte(text))
+	}
+	return signer.algorithm() + ":" + strconv.Itoa(SchemaVersion) + ":" + base64.StdEncoding.EncodeToString(signature)
+}
+
+// Checks the entry's signature, given the previous signature in its run
+func (signer *LogSigner) verify(entry *ActivityLogEntry, previous string) error {
+	if entry.signature == "" {
+		return fmt.Errorf("not signed")
+	}
+	parts := strings.SplitN(entry.signature, ":", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed signature '%s'", entry.signature)
+	}
+	if parts[0] != signer.algorithm() {
+		return fmt.Errorf("signed with %s, not the given %s key", parts[0], signer.algorithm())
+	}
+	version, err := strconv.Atoi(parts[1])
+	if err != nil || version < SignatureSchemaVersion || version > SchemaVersion {
+		return fmt.Errorf("malformed signature '%s' (unsupported schema version)", entry.signature)
+	}
+	signature, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("malformed signature '%s'", entry.signature)
+	}
+
+	text := getSignedText(entry, version, previous)
+	if signer.hmacKey != nil {
+		if !hmac.Equal(signature, hmacSHA256(signer.hmacKey, text)) {
+			return fmt.Errorf("invalid signature")
+		}
+	} else if !ed25519.Verify(signer.publicKey, []byte(text), signature) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// Gets the text an entry's signature covers: the previous signature in its run, then the entry's columns as of the schema version it was
+// signed under (so it still verifies once the log's migrated), leaving out the signature itself. The timestamp's converted to UTC, so the
+// signature survives it being written in another time zone (ie. by a collector).
+func getSignedText(entry *ActivityLogEntry, version int, previous string) string {
+	values := serializeToCSV(entry)
+	timestamp, err := time.Parse(time.RFC3339, entry.timestamp)
+	if err == nil {
+		values[0] = timestamp.UTC().Format(time.RFC3339)
+	}
+	columns := strings.Split(HeaderStr, ",")
+	signatureIndex := slices.Index(columns, "signature")
+	signed := slices.Delete(values[:SchemaColumnCounts[version - 1]], signatureIndex, signatureIndex + 1)
+	return previous + "\n" + strings.Join(signed, ",")
+}
+
+// Checks the signature of every entry in the activity log at path, and that each run's entries are all there (from seq 1, with none
+// missing in between), printing each problem found
+func verifyLogSignatures(path string, signer *LogSigner) (*SignaturesResponse, error) {
+	response := &SignaturesResponse{status: "error"}
+	if !fileExists(path) {
+		response.status = "not_found"
+		return response, fmt.Errorf("no activity log at %s", path)
+	}
+	parsedLog, err := readLog(path)
+	if err != nil {
+		return response, err
+	}
+
+	lastSignatures := map[string]string{}
+	lastSeqs := map[string]int{}
+	for _, entry := range parsedLog.entries {
+		response.entries++
+		runId := unescapeRawText(entry.runId)
+		if entry.seq != lastSeqs[entry.runId] + 1 {
+			response.problems = append(response.problems, fmt.Sprintf("run %s: expected seq %d next, but found %d (entries are missing or out of order)", runId, lastSeqs[entry.runId] + 1, entry.seq))
+		}
+		err := signer.verify(entry, lastSignatures[entry.runId])
+		if err != nil {
+			response.problems = append(response.problems, fmt.Sprintf("run %s seq %d: %v", runId, entry.seq, err))
+		} else {
+			response.valid++
+		}
+		lastSignatures[entry.runId] = entry.signature
+		lastSeqs[entry.runId] = entry.seq
+	}
+	for _, problem := range response.problems {
+		fmt.Println(problem)
+	}
+
+	response.status = "valid"
+	if len(response.problems) > 0 {
+		response.status = "invalid"
+	}
+	return response, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes an Ed25519 key pair as PEM files, returning their paths
+func writeTestEd25519Keys(t *testing.T) (string, string) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	privateBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.Nil(t, err)
+	publicBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	os.WriteFile(dir + "/private.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateBytes}), 0600)
+	os.WriteFile(dir + "/public.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicBytes}), 0644)
+	return dir + "/private.pem", dir + "/public.pem"
+}
+
+func TestMain_SignKey_HMAC(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := dir + "/log.key"
+	os.WriteFile(keyPath, []byte("0123456789abcdef0123456789abcdef\n"), 0600)
+	logFilePath := dir + "/activity-log.csv"
+
+	// Precondition: a signed log, with a run of several entries and a run of one
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-sign-key=" + keyPath, "-scan-timeout=100ms", "scan", "127.0.0.1", "1,2"}
+	callMain(args)
+	args = []string{"./noisemaker", "-logfile=" + logFilePath, "-sign-key=" + keyPath, "create", dir + "/test.txt"}
+	callMain(args)
+	assertLogFileContains(t, logFilePath, ",hmac-sha256:12:")
+
+	args = []string{"./noisemaker", "-logfile=" + dir + "/other-log.csv", "-sign-key=" + keyPath, "verify-signatures", logFilePath}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.activity, "verify-signatures")
+	assert.Equal(t, activityLogEntry.status, "valid")
+	assert.Equal(t, activityLogEntry.details, "4 of 4 entries have valid signatures\\, 0 problems found")
+
+	// Changing an entry breaks its signature, and the chain after it
+	contents, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	lines := strings.Split(contents, "\n")
+	lines[2] = strings.Replace(lines[2], ",127.0.0.1,", ",127.0.0.2,", 1)
+	os.WriteFile(logFilePath, []byte(strings.Join(lines, "\n")), 0644)
+	output := callMain(args)
+	assert.Contains(t, output, ": invalid signature\n")
+	assert.Equal(t, activityLogEntry.status, "invalid")
+	assert.Equal(t, activityLogEntry.details, "3 of 4 entries have valid signatures\\, 1 problems found")
+
+	// So does leaving an entry out
+	lines = strings.Split(contents, "\n")
+	os.WriteFile(logFilePath, []byte(strings.Join(append(lines[:3], lines[4:]...), "\n")), 0644)
+	output = callMain(args)
+	assert.Contains(t, output, ": expected seq 2 next, but found 3 (entries are missing or out of order)\n")
+	assert.Equal(t, activityLogEntry.status, "invalid")
+	assert.Equal(t, activityLogEntry.details, "2 of 3 entries have valid signatures\\, 2 problems found")
+}
+
+func TestMain_SignKey_Ed25519(t *testing.T) {
+	privateKeyPath, publicKeyPath := writeTestEd25519Keys(t)
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.jsonl"
+
+	args := []string{"./noisemaker", "-sink=jsonl:" + logFilePath, "-sign-key=" + privateKeyPath, "create", dir + "/test.txt"}
+	callMain(args)
+	assertLogFileContains(t, logFilePath, `"signature":"ed25519:12:`)
+
+	// Anyone with the public key can check it (but not sign with it)
+	args = []string{"./noisemaker", "-sink=stdout", "-sign-key=" + publicKeyPath, "verify-signatures", logFilePath}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "valid")
+	assert.Equal(t, activityLogEntry.signature, "")
+	args = []string{"./noisemaker", "-sink=stdout", "-sign-key=" + publicKeyPath, "create", dir + "/other.txt"}
+	assertMainPanicsWithMessage(t, args, "can't sign activity log entries with the public key in " + publicKeyPath + " (use the private key)")
+
+	// A different kind of key doesn't verify it
+	keyPath := dir + "/log.key"
+	os.WriteFile(keyPath, []byte("0123456789abcdef0123456789abcdef"), 0600)
+	args = []string{"./noisemaker", "-sink=stdout", "-sign-key=" + keyPath, "verify-signatures", logFilePath}
+	output := callMain(args)
+	assert.Contains(t, output, ": signed with ed25519, not the given hmac-sha256 key\n")
+	assert.Equal(t, activityLogEntry.status, "invalid")
+}
+
+func TestMain_VerifySignatures_Unsigned(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := dir + "/log.key"
+	os.WriteFile(keyPath, []byte("0123456789abcdef0123456789abcdef"), 0600)
+	logFilePath := dir + "/activity-log.csv"
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "create", dir + "/test.txt"})
+
+	args := []string{"./noisemaker", "-sink=stdout", "-sign-key=" + keyPath, "verify-signatures", logFilePath}
+	output := callMain(args)
+	assert.Contains(t, output, " seq 1: not signed\n")
+	assert.Equal(t, activityLogEntry.status, "invalid")
+}
+
+func TestMain_VerifySignatures_WithoutKey(t *testing.T) {
+	args := []string{"./noisemaker", "-sink=stdout", "verify-signatures"}
+	assertMainPanicsWithMessage(t, args, "verify-signatures needs -sign-key (the HMAC key, or the Ed25519 private or public key)")
+}
+
+func TestLoadLogSigner(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir + "/short.key", []byte("secret\n"), 0600)
+	_, err := loadLogSigner(dir + "/short.key")
+	assert.ErrorContains(t, err, "HMAC key in " + dir + "/short.key is too short (must be at least 16 bytes)")
+
+	os.WriteFile(dir + "/cert.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not really")}), 0644)
+	_, err = loadLogSigner(dir + "/cert.pem")
+	assert.ErrorContains(t, err, "unsupported PEM block 'CERTIFICATE'")
+
+	_, err = loadLogSigner(dir + "/missing.key")
+	assert.NotNil(t, err)
+}
+
+func TestGetSignedText(t *testing.T) {
+	entry := &ActivityLogEntry{timestamp: "2024-11-05T16:20:14-06:00", activity: "create", runId: "run-1", seq: 1, labels: "phase=2", signature: "ed25519:10:AAAA"}
+	text := getSignedText(entry, SignatureSchemaVersion, "previous")
+	assert.True(t, strings.HasPrefix(text, "previous\n2024-11-05T22:20:14Z,create,"))
+	assert.True(t, strings.HasSuffix(text, ",phase=2"))
+	assert.Equal(t, SchemaColumnCounts[SignatureSchemaVersion - 1] - 1, len(strings.Split(strings.SplitN(text, "\n", 2)[1], ",")))
+
+	// The same moment in another time zone is signed the same
+	entry.timestamp = "2024-11-05T22:20:14Z"
+	assert.Equal(t, text, getSignedText(entry, SignatureSchemaVersion, "previous"))
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A destination for activity log entries (a file, a collector, etc.)
+type Sink interface {
+	WriteEntry(entry *ActivityLogEntry) error
+	Close() error
+}
+
+// Default syslog collector, if the sink doesn't name one
+const DefaultSyslogAddr = "udp://127.0.0.1:514"
+
+// How long to wait on a forwarding sink's collector before giving up on an entry
+const SinkForwardTimeout = 10 * time.Second
+
+// The columns holding numbers, which are written as numbers (rather than strings) in JSON
+var NumericColumns = []string{"pid", "sourcePort", "destPort", "bytesSent", "attempt", "bytesReceived", "seq", "dnsTime"}
+
+// The values of every -sink flag given, ie. -sink=csv -sink=syslog:udp://collector:514
+type SinkListFlag []string
+
+func (sinks *SinkListFlag) String() string {
+	return strings.Join(*sinks, " ")
+}
+
+// Defines the -sink flag (which may be repeated)
+func newSinkListFlag() *SinkListFlag {
+	sinks := new(SinkListFlag)
+	flag.Var(sinks, "sink", "a sink to write the activity log to, as type[:target] (csv, jsonl:<path>, stdout, syslog[:<addr>], webhook:<url>, otlp:<url>, grpc:<addr>, eventlog[:<channel>], oslog[:<subsystem>], journald[:<socket>], s3://<bucket>/<prefix>, or amqp:<url>); may be repeated (default csv at -logfile)")
+	return sinks
+}
+
+// Adds a sink to the list (or clears the list, given an empty value)
+func (sinks *SinkListFlag) Set(value string) error {
+	if value == "" {
+		*sinks = nil
+		return nil
+	}
+	*sinks = append(*sinks, value)
+	return nil
+}
+
+// Opens every sink in the list, defaulting to just the CSV file at logFilePath if the list is empty
+func openSinks(sinkSpecs []string, logFilePath string, overwrite bool) (Sink, error) {
+	if len(sinkSpecs) == 0 {
+		sinkSpecs = []string{"csv"}
+	}
+
+	multiSink := new(MultiSink)
+	for _, sinkSpec := range sinkSpecs {
+		sink, err := openSink(sinkSpec, logFilePath, overwrite)
+		if err != nil {
+			multiSink.Close()
+			return nil, err
+		}
+		multiSink.sinks = append(multiSink.sinks, sink)
+	}
+	return multiSink, nil
+}
+
+// Opens a single sink, given as type[:target] (ie. "csv", "csv:./other-log.csv", "jsonl:./log.jsonl", "stdout",
+// "syslog", "syslog:tcp://collector:514", "webhook:https://collector/ingest", "otlp:http://collector:4318", "grpc:collector:7071", "eventlog:noisemaker", "oslog:noisemaker", "journald", "s3://bucket/prefix/", or "amqp:amqp://rabbitmq:5672/")
+func openSink(sinkSpec string, logFilePath string, overwrite bool) (Sink, error) {
+	sinkType, target, _ := strings.Cut(sinkSpec, ":")
+	switch sinkType {
+	case "csv":
+		if target == "" {
+			target = logFilePath
+		}
+		return newCSVFileSink(target, overwrite)
+	case "jsonl":
+		if target == "" {
+			return nil, fmt.Errorf("invalid sink '%s' (must be jsonl:<path>)", sinkSpec)
+		}
+		return newJSONLSink(target, overwrite)
+	case "stdout":
+		return &StdoutSink{out: getOriginalStdout()}, nil
+	case "syslog":
+		if target == "" {
+			target = DefaultSyslogAddr
+		}
+		return newSyslogSink(target)
+	case "otlp":
+		return newOTLPSink(target)
+	case "grpc":
+		return newGRPCSink(target)
+	case "eventlog":
+		return newEventLogSink(target)
+	case "oslog":
+		return newOSLogSink(target)
+	case "journald":
+		return newJournaldSink(target)
+	case "s3":
+		return newS3Sink(target)
+	case "amqp":
+		return newAMQPSink(target)
+	case "webhook":
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			return nil, fmt.Errorf("invalid sink '%s' (must be webhook:<http or https URL>)", sinkSpec)
+		}
+		return &WebhookSink{url: target, client: &http.Client{Timeout: SinkForwardTimeout}}, nil
+	default:
+		return nil, fmt.Errorf("invalid sink type '%s' (must be csv, jsonl, stdout, syslog, webhook, otlp, grpc, eventlog, oslog, journald, s3, or amqp)", sinkType)
+	}
+}
+
+// =====================================================================
+// Fan-out
+// =====================================================================
+
+// Writes each entry to every one of its sinks
+type MultiSink struct {
+	sinks				[]Sink
+}
+
+// Writes the entry to every sink (even if an earlier one fails), and returns any errors together
+func (multiSink *MultiSink) WriteEntry(entry *ActivityLogEntry) error {
+	errs := []error{}
+	for _, sink := range multiSink.sinks {
+		err := sink.WriteEntry(entry)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (multiSink *MultiSink) Close() error {
+	errs := []error{}
+	for _, sink := range multiSink.sinks {
+		err := sink.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// =====================================================================
+// Files
+// =====================================================================
+
+// Writes entries as rows of a CSV activity log file
+type CSVFileSink struct {
+	file				*LogFile
+}
+
+// Opens the CSV activity log file at logFilePath for appending, checking any existing file for consistency and loading its entries.
+// If overwrite is set (or the file's new), writes the header and the existing entries first.
+func newCSVFileSink(logFilePath string, overwrite bool) (*CSVFileSink, error) {
+	// Parse log entries from the existing log file, if any.
+	existingLogEntries := []*ActivityLogEntry{}
+	activityLogFileExists := fileExists(logFilePath)
+	peekActivityLogFile, err := os.OpenFile(logFilePath, os.O_RDONLY, 0644)
+	if activityLogFileExists && err != nil {
+		scanner := bufio.NewScanner(peekActivityLogFile)
+		if scanner.Scan() {
+			firstLine := scanner.Text()
+			slog.Debug("Read first line", "line", firstLine)
+			if !isCSVHeaderStr(firstLine) {
+				// Try to parse it as a record, but fail gracefully
+				row, err := splitCSVRow(firstLine)
+				if err != nil {
+					slog.Warn("Unable to tokenize first row, syntax error", "row", firstLine)
+				}
+				parsedLogEntry, err := deserializeFromCSV(row)
+				if err != nil {
+					slog.Warn("Unable to deserialize first row, parser error", "row", row)
+				}
+				if parsedLogEntry != nil {
+					slog.Debug("Deserialized first row", "entry", parsedLogEntry)
+					existingLogEntries = append(existingLogEntries, parsedLogEntry)
+				}
+			}
+
+			// Read the other rows
+			for scanner.Scan() {
+				existingRow := scanner.Text()
+				// Try to parse it as a record, and skip ahead if we fail anywhere
+				row, err := splitCSVRow(existingRow)
+				if err != nil {
+					slog.Warn("Unable to tokenize row, syntax error", "row", existingRow)
+					continue
+				}
+				parsedLogEntry, err := deserializeFromCSV(row)
+				if err != nil {
+					slog.Warn("Unable to deserialize first row, parser error", "row", row)
+					continue
+				}
+				if parsedLogEntry != nil {
+					slog.Debug("Deserialized first row", "entry", parsedLogEntry)
+					existingLogEntries = append(existingLogEntries, parsedLogEntry)
+				}
+			}
+		} else if scanner.Err() != nil {
+			slog.Warn("Unable to open existing file for appending, it does not exist")
+		}
+	}
+	peekActivityLogFile.Close()
+
+	// Bring an older log up to date first, so the rows appended to it match its header
+	if activityLogFileExists && !overwrite {
+		err = migrateLogIfNeeded(logFilePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Open the activity log for writing
+	var activityLogFile *LogFile
+	var writeHistoricalRecords bool
+	if activityLogFileExists && !overwrite {
+		slog.Info("Opening existing log file for appending", "path", logFilePath)
+		activityLogFile, err = openLogFile(logFilePath, os.O_APPEND | os.O_CREATE | os.O_WRONLY, true)
+		writeHistoricalRecords = false
+	} else if activityLogFileExists && overwrite {
+		slog.Info("Opening existing log file for overwriting", "path", logFilePath)
+		activityLogFile, err = openLogFile(logFilePath, os.O_RDWR | os.O_CREATE, false)
+		writeHistoricalRecords = true
+	} else {
+		slog.Info("Creating new log file", "path", logFilePath)
+		activityLogFile, err = openLogFile(logFilePath, os.O_RDWR | os.O_CREATE | os.O_TRUNC, false)
+		writeHistoricalRecords = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	sink := &CSVFileSink{file: activityLogFile}
+
+	// Write the header and old records
+	if writeHistoricalRecords {
+		// Write header (under the schema version)
+		_, err = activityLogFile.WriteString(getCSVFileHeader())
+		if err != nil {
+			activityLogFile.Close()
+			return nil, err
+		}
+
+		// Write all other existing log entries (as-is, keeping their sequence numbers)
+		for _, logEntry := range existingLogEntries {
+			err = sink.WriteEntry(logEntry)
+			if err != nil {
+				activityLogFile.Close()
+				return nil, err
+			}
+		}
+	}
+	return sink, nil
+}
+
+func (sink *CSVFileSink) WriteEntry(entry *ActivityLogEntry) error {
+	logEntryCSV := strings.Join(serializeToCSV(entry), ",")
+	_, err := sink.file.WriteString(logEntryCSV + "\n")
+	return err
+}
+
+func (sink *CSVFileSink) Close() error {
+	return sink.file.Close()
+}
+
+// Writes entries as JSON objects, one per line
+type JSONLSink struct {
+	file				*LogFile
+}
+
+// Opens the JSON lines file at path for appending (or truncates it, if overwrite is set)
+func newJSONLSink(path string, overwrite bool) (*JSONLSink, error) {
+	flags := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	appending := !overwrite && fileExists(path)
+	if overwrite {
+		flags |= os.O_TRUNC
+	} else if appending {
+		err := migrateLogIfNeeded(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	file, err := openLogFile(path, flags, appending)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLSink{file: file}, nil
+}
+
+func (sink *JSONLSink) WriteEntry(entry *ActivityLogEntry) error {
+	_, err := sink.file.WriteString(string(serializeToJSON(entry)) + "\n")
+	return err
+}
+
+func (sink *JSONLSink) Close() error {
+	return sink.file.Close()
+}
+
+// Writes entries to the console as JSON objects, one per line (ie. for a container's log shipper to pick up)
+type StdoutSink struct {
+	out					io.Writer
+}
+
+func (sink *StdoutSink) WriteEntry(entry *ActivityLogEntry) error {
+	_, err := sink.out.Write(append(serializeToJSON(entry), '\n'))
+	return err
+}
+
+func (sink *StdoutSink) Close() error {
+	return nil
+}
+
+// =====================================================================
+// Forwarding
+// Forwarding is best-effort: if the collector's unreachable, the failure is printed and the run carries on, the same as if the
+// collector had dropped the entry.
+// =====================================================================
+
+// Forwards entries to a syslog collector, as RFC 5424 messages with the entry as JSON in the message body
+type SyslogSink struct {
+	network				string
+	conn				net.Conn
+}
+
+// Connects to the syslog collector at addr (ie. udp://collector:514, tcp://collector:514, or unix:///dev/log)
+func newSyslogSink(addr string) (*SyslogSink, error) {
+	collectorUrl, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	sink := &SyslogSink{network: collectorUrl.Scheme}
+	var target string
+	switch sink.network {
+	case "udp", "tcp":
+		target = collectorUrl.Host
+	case "unix":
+		// /dev/log is a datagram socket
+		sink.network = "unixgram"
+		target = collectorUrl.Path
+	default:
+		return nil, fmt.Errorf("invalid syslog address '%s' (must be udp://, tcp://, or unix://)", addr)
+	}
+
+	sink.conn, err = net.DialTimeout(sink.network, target, SinkForwardTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *SyslogSink) WriteEntry(entry *ActivityLogEntry) error {
+	message := formatSyslogMessage(entry)
+	if sink.network == "tcp" {
+		// Octet-counted framing (RFC 6587), since the message is all on one line anyway
+		message = strconv.Itoa(len(message)) + " " + message
+	}
+	sink.conn.SetWriteDeadline(time.Now().Add(SinkForwardTimeout))
+	_, err := sink.conn.Write([]byte(message))
+	if err != nil {
+		slog.Warn("Unable to forward log entry to syslog", "error", err)
+	}
+	return nil
+}
+
+func (sink *SyslogSink) Close() error {
+	return sink.conn.Close()
+}
+
+// Formats an entry as an RFC 5424 message, from the user facility at informational severity
+func formatSyslogMessage(entry *ActivityLogEntry) string {
+	hostname := entry.hostname
+	if hostname == "" {
+		hostname = "-"
+	}
+	return fmt.Sprintf("<14>1 %s %s noisemaker %d %s - %s", entry.timestamp, hostname, entry.processId, entry.activity, serializeToJSON(entry))
+}
+
+// Forwards entries to an HTTP(S) collector, POSTing each as a JSON object
+type WebhookSink struct {
+	url					string
+	client				*http.Client
+}
+
+func (sink *WebhookSink) WriteEntry(entry *ActivityLogEntry) error {
+	response, err := sink.client.Post(sink.url, "application/json", bytes.NewReader(serializeToJSON(entry)))
+	if err != nil {
+		slog.Warn("Unable to forward log entry to webhook", "error", err)
+		return nil
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		slog.Warn("Unable to forward log entry to webhook", "status", response.Status)
+	}
+	return nil
+}
+
+func (sink *WebhookSink) Close() error {
+	sink.client.CloseIdleConnections()
+	return nil
+}
+
+// Serializes an entry as a JSON object, keyed by the CSV column names (in column order), with the escaping undone,
+// followed by the schema version
+func serializeToJSON(entry *ActivityLogEntry) []byte {
+	object := serializeColumnsToJSON(entry, strings.Split(HeaderStr, ","))
+	return append(object[:len(object) - 1], []byte(`,"schemaVersion":` + strconv.Itoa(SchemaVersion) + "}")...)
+}
+
+// Serializes just the given columns of an entry as a JSON object, in the order they're given
+func serializeColumnsToJSON(entry *ActivityLogEntry, columns []string) []byte {
+	values := serializeToCSV(entry)
+	allColumns := strings.Split(HeaderStr, ",")
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		buffer.Write(key)
+		buffer.WriteByte(':')
+
+		value := values[slices.Index(allColumns, column)]
+		if containsString(NumericColumns, column) {
+			buffer.WriteString(value)
+		} else {
+			encoded, _ := json.Marshal(unescapeRawText(value))
+			buffer.Write(encoded)
+		}
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes()
+}
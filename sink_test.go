@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Sink_CSVAndJSONL(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	jsonlPath := t.TempDir() + "/activity-log.jsonl"
+	file := t.TempDir() + "/test.txt"
+
+	// Both sinks should get the same entry
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-sink=csv", "-sink=jsonl:" + jsonlPath, "-note=hello, world", "create", file}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "created")
+	assertLogFileContains(t, logFilePath, ",created,")
+
+	contents, err := readTestFile(jsonlPath)
+	assert.Nil(t, err)
+	var parsed map[string]any
+	err = json.Unmarshal([]byte(strings.TrimSpace(contents)), &parsed)
+	assert.Nil(t, err)
+	assert.Equal(t, "create", parsed["activity"])
+	assert.Equal(t, "created", parsed["status"])
+	assert.Equal(t, "hello, world", parsed["note"])
+	assert.Equal(t, float64(1), parsed["seq"])
+	assert.Equal(t, activityLogEntry.runId, parsed["runId"])
+}
+
+func TestMain_Sink_WithoutCSV(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	jsonlPath := t.TempDir() + "/activity-log.jsonl"
+
+	// Naming sinks replaces the default CSV file
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-sink=jsonl:" + jsonlPath, "create", t.TempDir() + "/test.txt"}
+	callMain(args)
+	assert.False(t, fileExists(logFilePath))
+	assertLogFileContains(t, jsonlPath, `"activity":"create"`)
+}
+
+func TestMain_Sink_Webhook(t *testing.T) {
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r.Header.Get("Content-Type") + " " + string(body)
+	}))
+	defer server.Close()
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-sink=csv", "-sink=webhook:" + server.URL + "/ingest", "create", t.TempDir() + "/test.txt"}
+	callMain(args)
+	assertLogFileContains(t, logFilePath, ",created,")
+	assert.Contains(t, <-received, `application/json {"timestamp":`)
+}
+
+func TestMain_Sink_WebhookUnreachable(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	port := getFreeTestPort(t, "tcp")
+
+	// Forwarding is best-effort, so the run still completes
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "-sink=csv", "-sink=webhook:http://127.0.0.1:" + strconv.Itoa(port), "create", t.TempDir() + "/test.txt"}
+	_, diagnostics := callMainWithDiagnostics(args)
+	assert.Contains(t, diagnostics, "level=WARN msg=\"Unable to forward log entry to webhook\"")
+	assertLogFileContains(t, logFilePath, ",created,")
+}
+
+func TestMain_Sink_Invalid(t *testing.T) {
+	args := []string{"./noisemaker", "-sink=carrier-pigeon", "create", t.TempDir() + "/test.txt"}
+	assertMainPanicsWithMessage(t, args, "invalid sink type 'carrier-pigeon'")
+	args = []string{"./noisemaker", "-sink=jsonl", "create", t.TempDir() + "/test.txt"}
+	assertMainPanicsWithMessage(t, args, "invalid sink 'jsonl' (must be jsonl:<path>)")
+}
+
+func TestSyslogSink_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	sink, err := openSink("syslog:udp://" + conn.LocalAddr().String(), "", false)
+	assert.Nil(t, err)
+	defer sink.Close()
+	err = sink.WriteEntry(&ActivityLogEntry{timestamp: "2024-11-05T16:20:14-06:00", activity: "send", hostname: "lab-vm-1", processId: 42})
+	assert.Nil(t, err)
+
+	buffer := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buffer)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(buffer[:n]), `<14>1 2024-11-05T16:20:14-06:00 lab-vm-1 noisemaker 42 send - {"timestamp":`))
+}
+
+func TestSyslogSink_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	sink, err := openSink("syslog:tcp://" + listener.Addr().String(), "", false)
+	assert.Nil(t, err)
+	conn, err := listener.Accept()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	err = sink.WriteEntry(&ActivityLogEntry{activity: "send"})
+	assert.Nil(t, err)
+	sink.Close()
+
+	// Each message is prefixed with its length
+	contents, err := io.ReadAll(conn)
+	assert.Nil(t, err)
+	length, message, found := strings.Cut(string(contents), " ")
+	assert.True(t, found)
+	assert.Equal(t, strconv.Itoa(len(message)), length)
+	assert.True(t, strings.HasPrefix(message, "<14>1 "))
+}
+
+func TestStdoutSink(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := &StdoutSink{out: &buffer}
+	err := sink.WriteEntry(&ActivityLogEntry{activity: "create", processCmd: "create ./a\\,b.txt", seq: 3})
+	assert.Nil(t, err)
+	assert.Contains(t, buffer.String(), `"processCmd":"create ./a,b.txt"`)
+	assert.Contains(t, buffer.String(), `"seq":3`)
+	assert.True(t, strings.HasSuffix(buffer.String(), "}\n"))
+}
+
+func TestSinkListFlag(t *testing.T) {
+	var sinks SinkListFlag
+	sinks.Set("csv")
+	sinks.Set("stdout")
+	assert.Equal(t, SinkListFlag{"csv", "stdout"}, sinks)
+	sinks.Set("")
+	assert.Empty(t, sinks)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// The port file actions on an SMB path connect to (replaced in tests)
+var smbPort = 445
+
+// The smbclient errors that stand for each status, for SMB paths accessed with Samba's smbclient (anything else is an error)
+var SMBClientStatuses = map[string]string{
+	"NT_STATUS_OBJECT_NAME_NOT_FOUND": "not_found",
+	"NT_STATUS_OBJECT_PATH_NOT_FOUND": "not_found",
+	"NT_STATUS_NO_SUCH_FILE": "not_found",
+	"NT_STATUS_BAD_NETWORK_NAME": "not_found",
+	"NT_STATUS_OBJECT_NAME_INVALID": "invalid_path",
+	"NT_STATUS_ACCESS_DENIED": "no_access",
+	"NT_STATUS_LOGON_FAILURE": "no_access",
+	"NT_STATUS_ACCOUNT_DISABLED": "no_access",
+	"NT_STATUS_HOST_UNREACHABLE": "unreachable",
+	"NT_STATUS_CONNECTION_REFUSED": "unreachable",
+	"NT_STATUS_NETWORK_UNREACHABLE": "unreachable",
+	"NT_STATUS_IO_TIMEOUT": "timeout",
+}
+
+// A file on a network share, given as \\host\share\path (or //host/share/path)
+type SMBPath struct {
+	host				string
+	share				string
+	name				string		// the file's path within the share, separated by backslashes
+}
+
+// Parses a path that's on a network share (returning false if it's a local path)
+func parseSMBPath(path string) (*SMBPath, bool) {
+	if !strings.HasPrefix(path, `\\`) && !strings.HasPrefix(path, "//") {
+		return nil, false
+	}
+	parts := strings.SplitN(strings.ReplaceAll(path[2:], "/", `\`), `\`, 3)
+	if len(parts) < 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, false
+	}
+	return &SMBPath{host: parts[0], share: parts[1], name: parts[2]}, true
+}
+
+func (smbPath *SMBPath) String() string {
+	return `\\` + smbPath.host + `\` + smbPath.share + `\` + smbPath.name
+}
+
+// Records the share host of an SMB path separately from the path (as the host the file action connects to) and, on Windows with
+// -remote-user, connects to the share as that account first. Returns the function that disconnects again.
+func connectSMBPath(entry *ActivityLogEntry, path string) func() {
+	smbPath, found := parseSMBPath(path)
+	if !found {
+		return func() {}
+	}
+	entry.path = escapeRawText(smbPath.String())
+	entry.destAddr = smbPath.host
+	entry.destPort = smbPort
+	entry.protocol = "smb"
+	if runtime.GOOS != "windows" || *remoteUserPtr == "" {
+		return func() {}
+	}
+
+	share := `\\` + smbPath.host + `\` + smbPath.share
+	output, err := exec.CommandContext(runContext, "net", "use", share, *remotePasswordPtr, "/user:" + *remoteUserPtr, "/persistent:no").CombinedOutput()
+	if err != nil {
+		slog.Warn("Couldn't connect to share", "share", share, "user", *remoteUserPtr, "output", strings.TrimSpace(string(output)))
+		return func() {}
+	}
+	return func() { exec.Command("net", "use", share, "/delete").Run() }
+}
+
+// Whether the file actions on the path go through Samba's smbclient, rather than the OS (which is what's used on Windows)
+func isSMBClientPath(path string) (*SMBPath, bool) {
+	smbPath, found := parseSMBPath(path)
+	return smbPath, found && runtime.GOOS != "windows"
+}
+
+// Runs an smbclient command against the path's share (authenticating with -remote-user and -remote-password, or as a guest), and gets
+// the status its output stands for ("" if it succeeded)
+func runSMBClient(smbPath *SMBPath, command string) (string, error) {
+	args := []string{"//" + smbPath.host + "/" + smbPath.share, "-p", strconv.Itoa(smbPort), "-c", command}
+	if *remoteUserPtr != "" {
+		args = append(args, "-U", *remoteUserPtr + "%" + *remotePasswordPtr)
+	} else {
+		args = append(args, "-N")
+	}
+	output, err := exec.CommandContext(runContext, "smbclient", args...).CombinedOutput()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		fmt.Printf("Error: %v\n", err)
+		return "unable_to_run", err
+	}
+	return getSMBClientStatus(string(output), err)
+}
+
+// Gets the status smbclient's output stands for ("" if it succeeded)
+func getSMBClientStatus(output string, err error) (string, error) {
+	for code, status := range SMBClientStatuses {
+		if strings.Contains(output, code) {
+			return status, fmt.Errorf("smbclient: %s", code)
+		}
+	}
+	if strings.Contains(output, "NT_STATUS_") || err != nil {
+		fmt.Printf("Error: %s\n", strings.TrimSpace(output))
+		return "error", fmt.Errorf("smbclient: %s", strings.TrimSpace(output))
+	}
+	return "", nil
+}
+
+// Whether the file exists on the share (or the status that stopped it from being looked up)
+func smbFileExists(smbPath *SMBPath) (bool, string, error) {
+	status, err := runSMBClient(smbPath, fmt.Sprintf(`allinfo "%s"`, smbPath.name))
+	if status == "not_found" {
+		return false, "", nil
+	}
+	return err == nil, status, err
+}
+
+// Uploads the contents to the file on the share, replacing it if it's there
+func putSMBFile(smbPath *SMBPath, contents string) (string, error) {
+	local, err := os.CreateTemp("", "noisemaker-smb-*")
+	if err != nil {
+		return "error", err
+	}
+	defer os.Remove(local.Name())
+	_, err = local.WriteString(contents)
+	local.Close()
+	if err != nil {
+		return "error", err
+	}
+	return runSMBClient(smbPath, fmt.Sprintf(`put "%s" "%s"`, local.Name(), smbPath.name))
+}
+
+// Create a file with given contents on a share
+func createSMBFile(smbPath *SMBPath, contents string) (string, error) {
+	exists, status, err := smbFileExists(smbPath)
+	if err != nil {
+		return status, err
+	}
+	if exists {
+		fmt.Printf("File %s already exists, unable to write!\n", smbPath)
+		return "exists", fmt.Errorf("file_already_exists: %s", smbPath)
+	}
+	status, err = putSMBFile(smbPath, contents)
+	if err != nil {
+		return status, err
+	}
+	fmt.Printf("%d bytes written to new file %s\n", len(contents), smbPath)
+	return "created", nil
+}
+
+// Update a file on a share with new contents, if it exists
+func updateSMBFile(smbPath *SMBPath, contents string) (string, error) {
+	exists, status, err := smbFileExists(smbPath)
+	if err != nil {
+		return status, err
+	}
+	if !exists {
+		fmt.Printf("File %s not found for updating!\n", smbPath)
+		return "not_found", fmt.Errorf("file_not_found: %s", smbPath)
+	}
+	status, err = putSMBFile(smbPath, contents)
+	if err != nil {
+		return status, err
+	}
+	fmt.Printf("%d bytes written to updated file %s\n", len(contents), smbPath)
+	return "updated", nil
+}
+
+// Delete a file on a share, if it exists
+func deleteSMBFile(smbPath *SMBPath) (string, error) {
+	status, err := runSMBClient(smbPath, fmt.Sprintf(`del "%s"`, smbPath.name))
+	if status == "not_found" {
+		fmt.Printf("File %s not found for deleting!\n", smbPath)
+		return status, err
+	}
+	if err != nil {
+		return status, err
+	}
+	fmt.Printf("File %s deleted\n", smbPath)
+	return "deleted", nil
+}
+
+// Read a file on a share, returning its contents
+func readSMBFile(smbPath *SMBPath) (string, string, error) {
+	local, err := os.CreateTemp("", "noisemaker-smb-*")
+	if err != nil {
+		return "", "error", err
+	}
+	local.Close()
+	defer os.Remove(local.Name())
+	status, err := runSMBClient(smbPath, fmt.Sprintf(`get "%s" "%s"`, smbPath.name, local.Name()))
+	if status == "not_found" {
+		fmt.Printf("File %s not found for reading!\n", smbPath)
+	}
+	if err != nil {
+		return "", status, err
+	}
+	contents, err := os.ReadFile(local.Name())
+	if err != nil {
+		return "", "error", err
+	}
+	return string(contents), "read", nil
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A stand-in for smbclient, which logs how it's called and keeps the one file on its "share" at $SMB_STORE
+const testSMBClientScript = `#!/bin/sh
+printf "%s\n" "$*" >> "$SMB_LOG"
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-c" ]; then command="$2"; fi
+	shift
+done
+case "$command" in
+allinfo*) [ -f "$SMB_STORE" ] || { echo "NT_STATUS_OBJECT_NAME_NOT_FOUND opening remote file"; exit 1; } ;;
+put*) cp "$(echo "$command" | cut -d'"' -f2)" "$SMB_STORE" ;;
+del*) rm "$SMB_STORE" 2> /dev/null || { echo "NT_STATUS_NO_SUCH_FILE listing"; exit 1; } ;;
+get*) cp "$SMB_STORE" "$(echo "$command" | cut -d'"' -f4)" 2> /dev/null || { echo "NT_STATUS_OBJECT_NAME_NOT_FOUND opening remote file"; exit 1; } ;;
+esac
+`
+
+func TestMain_SMBPath(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(dir + "/smbclient", []byte(testSMBClientScript), 0755))
+	t.Setenv("PATH", dir + ":" + os.Getenv("PATH"))
+	t.Setenv("SMB_LOG", dir + "/smbclient.log")
+	t.Setenv("SMB_STORE", dir + "/share")
+	path := `\\fileserver\finance\Q3\report.txt`
+
+	// Each file action goes through smbclient, recording the share host separately from the path
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "-remote-user=LAB\\admin", "-remote-password=hunter2", "create", path, "Hello World!\n"})
+	assert.Contains(t, output, `13 bytes written to new file \\fileserver\finance\Q3\report.txt`)
+	assert.Equal(t, activityLogEntry.status, "created")
+	assert.Equal(t, activityLogEntry.path, escapeRawText(path))
+	assert.Equal(t, activityLogEntry.destAddr, "fileserver")
+	assert.Equal(t, activityLogEntry.destPort, 445)
+	assert.Equal(t, activityLogEntry.protocol, "smb")
+	contents, err := os.ReadFile(dir + "/share")
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello World!\n", string(contents))
+	callMain([]string{"./noisemaker", "-sink=stdout", "create", path})
+	assert.Equal(t, activityLogEntry.status, "exists")
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "update", path, "Goodbye!"})
+	assert.Equal(t, activityLogEntry.status, "updated")
+	output = callMain([]string{"./noisemaker", "-sink=stdout", "read", "//fileserver/finance/Q3/report.txt"})
+	assert.Contains(t, output, `8 bytes read from file //fileserver/finance/Q3/report.txt`)
+	assert.Equal(t, activityLogEntry.status, "read")
+	assert.Equal(t, activityLogEntry.path, escapeRawText(path))
+	callMain([]string{"./noisemaker", "-sink=stdout", "delete", path})
+	assert.Equal(t, activityLogEntry.status, "deleted")
+	callMain([]string{"./noisemaker", "-sink=stdout", "delete", path})
+	assert.Equal(t, activityLogEntry.status, "not_found")
+	callMain([]string{"./noisemaker", "-sink=stdout", "update", path})
+	assert.Equal(t, activityLogEntry.status, "not_found")
+	callMain([]string{"./noisemaker", "-sink=stdout", "read", path})
+	assert.Equal(t, activityLogEntry.status, "not_found")
+
+	// With the credentials given (or as a guest, without)
+	log, err := os.ReadFile(dir + "/smbclient.log")
+	assert.Nil(t, err)
+	calls := strings.Split(strings.TrimSpace(string(log)), "\n")
+	assert.Equal(t, `//fileserver/finance -p 445 -c allinfo "Q3\report.txt" -U LAB\admin%hunter2`, calls[0])
+	assert.Contains(t, calls[1], `//fileserver/finance -p 445 -c put "`)
+	assert.True(t, strings.HasSuffix(calls[1], `" "Q3\report.txt" -U LAB\admin%hunter2`))
+	assert.Equal(t, `//fileserver/finance -p 445 -c allinfo "Q3\report.txt" -N`, calls[2])
+}
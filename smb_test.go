@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSMBPath(t *testing.T) {
+	smbPath, found := parseSMBPath(`\\fileserver\finance\Q3\report.xlsx`)
+	assert.True(t, found)
+	assert.Equal(t, &SMBPath{host: "fileserver", share: "finance", name: `Q3\report.xlsx`}, smbPath)
+	smbPath, found = parseSMBPath("//10.0.0.5/C$/Temp/dropped.txt")
+	assert.True(t, found)
+	assert.Equal(t, `\\10.0.0.5\C$\Temp\dropped.txt`, smbPath.String())
+
+	// Local paths (and a share without a file) aren't SMB paths
+	for _, path := range []string{"/tmp/dropped.txt", `C:\Temp\dropped.txt`, `\\fileserver\finance`, `\\fileserver\\report.xlsx`} {
+		_, found = parseSMBPath(path)
+		assert.False(t, found, path)
+	}
+}
+
+func TestGetSMBClientStatus(t *testing.T) {
+	status, err := getSMBClientStatus("putting file /tmp/noisemaker-smb-1 as \\dropped.txt (0.0 kb/s)", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", status)
+	status, _ = getSMBClientStatus("NT_STATUS_OBJECT_NAME_NOT_FOUND opening remote file \\dropped.txt", fmt.Errorf("exit status 1"))
+	assert.Equal(t, "not_found", status)
+	status, _ = getSMBClientStatus("session setup failed: NT_STATUS_LOGON_FAILURE", fmt.Errorf("exit status 1"))
+	assert.Equal(t, "no_access", status)
+	status, _ = getSMBClientStatus("do_connect: Connection to fileserver failed (Error NT_STATUS_CONNECTION_REFUSED)", fmt.Errorf("exit status 1"))
+	assert.Equal(t, "unreachable", status)
+	status, _ = getSMBClientStatus("NT_STATUS_DISK_FULL", fmt.Errorf("exit status 1"))
+	assert.Equal(t, "error", status)
+}
+
+func TestMain_Read(t *testing.T) {
+	path := t.TempDir() + "/test.txt"
+	assert.Nil(t, os.WriteFile(path, []byte("Hello World!\n"), 0644))
+
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "read", path})
+	assert.Contains(t, output, fmt.Sprintf("13 bytes read from file %s", path))
+	assert.Equal(t, activityLogEntry.activity, "read")
+	assert.Equal(t, activityLogEntry.status, "read")
+	assert.Equal(t, activityLogEntry.details, "13 bytes read")
+	assert.Empty(t, activityLogEntry.destAddr)
+
+	output = callMain([]string{"./noisemaker", "-sink=stdout", "read", path + ".missing"})
+	assert.Contains(t, output, fmt.Sprintf("File %s.missing not found for reading!", path))
+	assert.Equal(t, activityLogEntry.status, "not_found")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "read"}, "not enough arguments for read! Args: []")
+}
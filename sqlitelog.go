@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// The table a SQLite activity log's entries are read from (one column per CSV column, named the same)
+const SQLiteLogTable = "activity_log"
+
+// Every SQLite database file starts with this
+var SQLiteFileHeader = []byte("SQLite format 3\x00")
+
+// Whether the log is a SQLite database, rather than CSV or JSON lines
+func isSQLiteLog(contents []byte) bool {
+	return bytes.HasPrefix(contents, SQLiteFileHeader)
+}
+
+// Reads a SQLite log's entries (read-only), in the order they were inserted. Like older logs, a table that's missing
+// some of the columns has them left empty, and if it has a schemaVersion column, the oldest entry's version is the log's.
+func parseSQLiteLog(path string) (*ParsedLog, error) {
+	db, err := sql.Open("sqlite", "file:" + (&url.URL{Path: filepath.ToSlash(path)}).EscapedPath() + "?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT * FROM " + SQLiteLogTable + " ORDER BY rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the %s table of SQLite log %s: %v", SQLiteLogTable, path, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	parsedLog := &ParsedLog{version: SchemaVersion, versioned: true, sqlite: true}
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return nil, err
+		}
+		object := map[string]any{}
+		for i, column := range columns {
+			if text, ok := values[i].([]byte); ok {
+				object[column] = string(text)
+			} else {
+				object[column] = values[i]
+			}
+		}
+
+		// Tables without a schemaVersion column are as old as the columns they have
+		version := getJSONSchemaVersion(object)
+		if recorded, ok := object["schemaVersion"].(int64); ok {
+			version = int(recorded)
+		} else {
+			parsedLog.versioned = false
+		}
+		if version > SchemaVersion {
+			return &ParsedLog{version: version, sqlite: true}, nil
+		}
+		if len(parsedLog.entries) == 0 || version < parsedLog.version {
+			parsedLog.version = version
+		}
+		parsedLog.entries = append(parsedLog.entries, deserializeFromJSON(object))
+	}
+	return parsedLog, rows.Err()
+}
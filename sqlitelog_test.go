@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a SQLite log with some of the columns (and a Windows path, and a comma)
+func writeTestSQLiteLog(t *testing.T, path string) {
+	db, err := sql.Open("sqlite", path)
+	assert.Nil(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE activity_log (timestamp TEXT, activity TEXT, path TEXT, status TEXT, destPort INTEGER, details TEXT, runId TEXT, seq INTEGER)")
+	assert.Nil(t, err)
+	rows := [][]any{
+		{"2024-11-05T12:00:00Z", "create", "C:\\Users\\nick\\notes.docx", "created", 0, nil, "run-1", 1},
+		{"2024-11-05T12:00:05Z", "send", "https://10.0.0.5:443/upload", "error", 443, "connection refused, retrying", "run-1", 2},
+		{"2024-11-05T12:00:10Z", "delete", "C:\\Users\\nick\\notes.docx", "deleted", 0, nil, "run-1", 3},
+	}
+	for _, row := range rows {
+		_, err = db.Exec("INSERT INTO activity_log VALUES (?, ?, ?, ?, ?, ?, ?, ?)", row...)
+		assert.Nil(t, err)
+	}
+}
+
+func TestMain_LogQuery_SQLite(t *testing.T) {
+	dir := t.TempDir()
+	writeTestSQLiteLog(t, dir + "/campaign.db")
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "log", "query", "--path-glob=*.docx", "--columns=seq,activity,path", dir + "/campaign.db"}
+	output := callMain(args)
+	assert.Contains(t, output, "seq,activity,path\n1,create,C:\\\\Users\\\\nick\\\\notes.docx\n3,delete,C:\\\\Users\\\\nick\\\\notes.docx\n")
+	assert.Equal(t, activityLogEntry.status, "completed")
+	assert.Equal(t, activityLogEntry.details, "2 of 3 entries matched")
+}
+
+func TestParseSQLiteLog(t *testing.T) {
+	path := t.TempDir() + "/campaign.sqlite"
+	writeTestSQLiteLog(t, path)
+
+	parsedLog, err := readLog(path)
+	assert.Nil(t, err)
+	assert.True(t, parsedLog.sqlite)
+	assert.False(t, parsedLog.versioned)
+	assert.Len(t, parsedLog.entries, 3)
+	assert.Equal(t, "connection refused, retrying", unescapeRawText(parsedLog.entries[1].details))
+	assert.Equal(t, 443, parsedLog.entries[1].destPort)
+	assert.Equal(t, "", parsedLog.entries[1].hostname)
+
+	// They're only read, never migrated (or verified)
+	_, err = migrateLog(path, path)
+	assert.ErrorContains(t, err, "SQLite logs can't be migrated")
+	_, err = verifyLog(path)
+	assert.ErrorContains(t, err, "SQLite logs can't be verified")
+}
+
+func TestParseSQLiteLog_NoTable(t *testing.T) {
+	path := t.TempDir() + "/empty.db"
+	db, err := sql.Open("sqlite", path)
+	assert.Nil(t, err)
+	_, err = db.Exec("CREATE TABLE other (id INTEGER)")
+	assert.Nil(t, err)
+	db.Close()
+
+	_, err = readLog(path)
+	assert.ErrorContains(t, err, "unable to read the activity_log table of SQLite log " + path)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Where an ssh command's run: the account, and the host (and port) it's on
+type SSHTarget struct {
+	user				string
+	host				string
+	port				int
+}
+
+// Response data from ssh action
+type SSHResponse struct {
+	sourceAddr			string
+	sourcePort			int
+	method				string			// the authentication method that was offered (publickey, password, or both)
+	hostKey				string			// the SHA256 fingerprint of the host's key
+	bytesReceived		int
+	status				string			// the remote command's exit status, or [unreachable, timeout, no_access, error]
+}
+
+// Parses an ssh target given as user@host[:port] (the port defaults to 22; an IPv6 host with a port is given as user@[host]:port)
+func parseSSHTarget(target string) (*SSHTarget, error) {
+	user, hostPort, found := strings.Cut(target, "@")
+	if !found || user == "" || hostPort == "" {
+		return nil, fmt.Errorf("invalid ssh target '%s' (must be user@host[:port])", target)
+	}
+	parsed := &SSHTarget{user: user, host: hostPort, port: 22}
+	if host, port, err := net.SplitHostPort(hostPort); err == nil {
+		parsed.host = host
+		parsed.port, err = strconv.Atoi(port)
+		if err != nil || parsed.port < 1 || parsed.port > 65535 {
+			return nil, fmt.Errorf("invalid ssh target '%s' (port must be 1 to 65535)", target)
+		}
+	}
+	return parsed, nil
+}
+
+// Gets the ways to authenticate with: the private key at keyPath, and the password (whichever are given)
+func getSSHAuthMethods(keyPath string, password string) ([]ssh.AuthMethod, string, error) {
+	methods := []ssh.AuthMethod{}
+	names := []string{}
+	if keyPath != "" {
+		contents, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, "", err
+		}
+		signer, err := ssh.ParsePrivateKey(contents)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid ssh key %s: %v", keyPath, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+		names = append(names, "publickey")
+	}
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+		names = append(names, "password")
+	}
+	if len(methods) == 0 {
+		return nil, "", fmt.Errorf("no ssh credentials (give -ssh-key, -ssh-password, or both)")
+	}
+	return methods, strings.Join(names, "+"), nil
+}
+
+// Connects to the target (checking its host key against knownHostsPath, if it's given, or accepting any key otherwise), runs the command
+// there, and records its exit status. Only connecting and authenticating are limited by the timeout, not the command itself.
+func runSSHCommand(target *SSHTarget, command string, keyPath string, password string, knownHostsPath string, timeout time.Duration) (*SSHResponse, error) {
+	response := new(SSHResponse)
+	methods, methodNames, err := getSSHAuthMethods(keyPath, password)
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+	response.method = methodNames
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if knownHostsPath != "" {
+		hostKeyCallback, err = knownhosts.New(knownHostsPath)
+		if err != nil {
+			response.status = "error"
+			return response, err
+		}
+	}
+	config := &ssh.ClientConfig{
+		User: target.user,
+		Auth: methods,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			response.hostKey = ssh.FingerprintSHA256(key)
+			return hostKeyCallback(hostname, remote, key)
+		},
+		Timeout: timeout,
+	}
+
+	// Connect and authenticate...
+	address := net.JoinHostPort(target.host, strconv.Itoa(target.port))
+	conn, err := newSourceDialer(timeout).DialContext(runContext, getIPNetwork("tcp"), address)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			response.status = "timeout"
+		} else {
+			response.status = "unreachable"
+		}
+		return response, err
+	}
+	defer conn.Close()
+	sourceAddr := conn.LocalAddr().(*net.TCPAddr)
+	response.sourceAddr = sourceAddr.IP.String()
+	response.sourcePort = sourceAddr.Port
+	conn.SetDeadline(time.Now().Add(timeout))
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			response.status = "timeout"
+		} else if strings.Contains(err.Error(), "unable to authenticate") {
+			response.status = "no_access"
+		} else {
+			response.status = "error"
+		}
+		return response, err
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(clientConn, channels, requests)
+	defer client.Close()
+
+	// ...then run the command
+	session, err := client.NewSession()
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+	defer session.Close()
+	var output bytes.Buffer
+	session.Stdout = &output
+	session.Stderr = &output
+	err = session.Run(command)
+	response.bytesReceived = output.Len()
+	if output.Len() > 0 {
+		fmt.Printf("%s", output.String())
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		response.status = fmt.Sprintf("exit status %d", exitErr.ExitStatus())
+		if exitErr.Signal() != "" {
+			response.status = "signal: " + exitErr.Signal()
+		}
+		return response, nil
+	}
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+	response.status = "exit status 0"
+	return response, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// Starts an SSH server that accepts the password "hunter2" and the client key, and runs "exit <n>" (exiting with n) or echoes any other
+// command back. Returns its port, its host key, and the path of the client's private key.
+func startTestSSHServer(t *testing.T) (int, ssh.PublicKey, string) {
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	assert.Nil(t, err)
+	clientPublicKey, clientPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ssh.NewPublicKey(clientPublicKey)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(clientPrivateKey, "")
+	assert.Nil(t, err)
+	keyPath := t.TempDir() + "/id_ed25519"
+	assert.Nil(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "lab" && string(password) == "hunter2" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong password")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "lab" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, config)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, hostSigner.PublicKey(), keyPath
+}
+
+func serveTestSSHConn(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		for request := range channelRequests {
+			if request.Type != "exec" {
+				request.Reply(false, nil)
+				continue
+			}
+			request.Reply(true, nil)
+			command := string(request.Payload[4:])
+			status := 0
+			if _, err := fmt.Sscanf(command, "exit %d", &status); err != nil {
+				channel.Write([]byte(command + "\n"))
+			}
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			channel.Close()
+		}
+	}
+}
+
+func TestMain_SSH(t *testing.T) {
+	port, hostKey, keyPath := startTestSSHServer(t)
+	target := fmt.Sprintf("lab@127.0.0.1:%d", port)
+
+	// With a key, the command's run and its exit status recorded
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "-ssh-key=" + keyPath, "ssh", target, "whoami", "&&", "hostname"})
+	assert.Contains(t, output, "whoami && hostname\n")
+	assert.Equal(t, activityLogEntry.activity, "ssh")
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	assert.Equal(t, activityLogEntry.method, "publickey")
+	assert.Equal(t, activityLogEntry.protocol, "ssh")
+	assert.Equal(t, activityLogEntry.path, fmt.Sprintf("ssh://lab@127.0.0.1:%d", port))
+	assert.Equal(t, activityLogEntry.destAddr, "127.0.0.1")
+	assert.Equal(t, activityLogEntry.destPort, port)
+	assert.Equal(t, activityLogEntry.sourceAddr, "127.0.0.1")
+	assert.Equal(t, activityLogEntry.bytesReceived, len("whoami && hostname\n"))
+	assert.Equal(t, activityLogEntry.details, "user lab\\, command whoami && hostname\\, host key " + ssh.FingerprintSHA256(hostKey))
+
+	// With a password, a failing command's exit status is recorded as it is
+	callMain([]string{"./noisemaker", "-sink=stdout", "-ssh-password=hunter2", "ssh", target, "exit 3"})
+	assert.Equal(t, activityLogEntry.status, "exit status 3")
+	assert.Equal(t, activityLogEntry.method, "password")
+
+	// Bad credentials are refused
+	callMain([]string{"./noisemaker", "-sink=stdout", "-ssh-password=wrong", "ssh", target, "whoami"})
+	assert.Equal(t, activityLogEntry.status, "no_access")
+	callMain([]string{"./noisemaker", "-sink=stdout", "ssh", target, "whoami"})
+	assert.Equal(t, activityLogEntry.status, "error")
+}
+
+func TestMain_SSH_KnownHosts(t *testing.T) {
+	port, hostKey, keyPath := startTestSSHServer(t)
+	target := fmt.Sprintf("lab@127.0.0.1:%d", port)
+	knownHostsPath := t.TempDir() + "/known_hosts"
+
+	// A host key that's known is accepted, and one that isn't is refused
+	os.WriteFile(knownHostsPath, []byte(fmt.Sprintf("[127.0.0.1]:%d %s", port, ssh.MarshalAuthorizedKey(hostKey))), 0600)
+	callMain([]string{"./noisemaker", "-sink=stdout", "-ssh-key=" + keyPath, "-ssh-known-hosts=" + knownHostsPath, "ssh", target, "whoami"})
+	assert.Equal(t, activityLogEntry.status, "exit status 0")
+	_, otherHostKey, _ := startTestSSHServer(t)
+	os.WriteFile(knownHostsPath, []byte(fmt.Sprintf("[127.0.0.1]:%d %s", port, ssh.MarshalAuthorizedKey(otherHostKey))), 0600)
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "-ssh-key=" + keyPath, "-ssh-known-hosts=" + knownHostsPath, "ssh", target, "whoami"})
+	assert.Equal(t, activityLogEntry.status, "error")
+	assert.Contains(t, output, "key mismatch")
+}
+
+func TestMain_SSH_Unreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "-ssh-password=hunter2", "ssh", fmt.Sprintf("lab@127.0.0.1:%d", port), "whoami"})
+	assert.Equal(t, activityLogEntry.status, "unreachable")
+}
+
+func TestParseSSHTarget(t *testing.T) {
+	target, err := parseSSHTarget("admin@10.0.0.5")
+	assert.Nil(t, err)
+	assert.Equal(t, &SSHTarget{user: "admin", host: "10.0.0.5", port: 22}, target)
+	target, err = parseSSHTarget("admin@[fd00::5]:2222")
+	assert.Nil(t, err)
+	assert.Equal(t, &SSHTarget{user: "admin", host: "fd00::5", port: 2222}, target)
+
+	_, err = parseSSHTarget("10.0.0.5")
+	assert.ErrorContains(t, err, "invalid ssh target '10.0.0.5' (must be user@host[:port])")
+	_, err = parseSSHTarget("admin@10.0.0.5:0")
+	assert.ErrorContains(t, err, "port must be 1 to 65535")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "ssh", "admin@10.0.0.5"}, "not enough arguments for ssh! Args: [admin@10.0.0.5]")
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Response data from stage action
+type StageResponse struct {
+	sourceCount			int
+	sourceBytes			int64
+	archiveBytes		int64
+	format				string
+	status				string
+}
+
+// Archives the given files (and directories, recursively) into an archive at archivePath, with the format picked from its extension
+// (.zip, .tar, .tar.gz, or .tgz). If password is given, the archive must be a zip, and each entry is encrypted with it.
+func stageFiles(archivePath string, sourcePaths []string, password string) (*StageResponse, error) {
+	response := new(StageResponse)
+	response.format = getArchiveFormat(archivePath)
+	if response.format == "" {
+		response.status = "invalid_path"
+		return response, fmt.Errorf("unknown archive format for %s (must be .zip, .tar, .tar.gz, or .tgz)", archivePath)
+	}
+	if password != "" && response.format != "zip" {
+		response.status = "invalid_path"
+		return response, fmt.Errorf("only zip archives can be password-protected, not %s", response.format)
+	}
+
+	// Find all the files to stage, up front
+	files, err := collectStageFiles(sourcePaths)
+	if err != nil {
+		response.status = "not_found"
+		return response, err
+	}
+
+	archiveFile, err := os.Create(archivePath)
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+	defer archiveFile.Close()
+
+	fmt.Printf("Staging %d files into %s archive %s...\n", len(files), response.format, archivePath)
+	switch response.format {
+	case "zip":
+		err = writeZipArchive(archiveFile, files, password, response)
+	default:
+		err = writeTarArchive(archiveFile, files, response.format == "tar.gz", response)
+	}
+	if err != nil {
+		response.status = "error"
+		return response, err
+	}
+
+	info, err := archiveFile.Stat()
+	if err == nil {
+		response.archiveBytes = info.Size()
+	}
+	fmt.Printf("Staged %d files (%d bytes) into %s (%d bytes)\n", response.sourceCount, response.sourceBytes, archivePath, response.archiveBytes)
+	response.status = "staged"
+	return response, nil
+}
+
+// Gets the archive format (zip, tar, or tar.gz) for the given path from its extension, or "" if it isn't an archive
+func getArchiveFormat(path string) string {
+	lowerPath := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lowerPath, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lowerPath, ".tar.gz"), strings.HasSuffix(lowerPath, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lowerPath, ".tar"):
+		return "tar"
+	default:
+		return ""
+	}
+}
+
+// Expands the given paths into the list of regular files to stage, walking any directories
+func collectStageFiles(sourcePaths []string) ([]string, error) {
+	files := []string{}
+	for _, sourcePath := range sourcePaths {
+		err := filepath.WalkDir(sourcePath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files found to stage in %v", sourcePaths)
+	}
+	return files, nil
+}
+
+// Gets the name of a file inside the archive (relative, with forward slashes)
+func getArchiveEntryName(path string) string {
+	name := filepath.ToSlash(filepath.Clean(strings.TrimPrefix(path, filepath.VolumeName(path))))
+	name = strings.TrimLeft(name, "/")
+	for strings.HasPrefix(name, "../") {
+		name = strings.TrimPrefix(name, "../")
+	}
+	return name
+}
+
+// Helper for writing a zip archive, optionally encrypting each entry with the password
+func writeZipArchive(archiveFile io.Writer, files []string, password string, response *StageResponse) error {
+	zipWriter := zip.NewWriter(archiveFile)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = getArchiveEntryName(path)
+		header.Method = zip.Deflate
+
+		if password == "" {
+			entryWriter, err := zipWriter.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			err = copyFileInto(entryWriter, path)
+			if err != nil {
+				return err
+			}
+		} else {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			err = writeEncryptedZipEntry(zipWriter, header, contents, password)
+			if err != nil {
+				return err
+			}
+		}
+
+		response.sourceCount += 1
+		response.sourceBytes += info.Size()
+	}
+	return zipWriter.Close()
+}
+
+// Helper for writing a tar archive, optionally gzipped
+func writeTarArchive(archiveFile io.Writer, files []string, gzipped bool, response *StageResponse) error {
+	var gzipWriter *gzip.Writer
+	if gzipped {
+		gzipWriter = gzip.NewWriter(archiveFile)
+		archiveFile = gzipWriter
+	}
+
+	tarWriter := tar.NewWriter(archiveFile)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = getArchiveEntryName(path)
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		err = copyFileInto(tarWriter, path)
+		if err != nil {
+			return err
+		}
+
+		response.sourceCount += 1
+		response.sourceBytes += info.Size()
+	}
+
+	err := tarWriter.Close()
+	if err != nil {
+		return err
+	}
+	if gzipWriter != nil {
+		return gzipWriter.Close()
+	}
+	return nil
+}
+
+func copyFileInto(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// =====================================================================
+// Traditional PKWARE (ZipCrypto) encryption, since archive/zip doesn't support writing encrypted entries.
+// It's weak, but it's what `zip -P` uses, and what every unzip tool can read.
+// =====================================================================
+
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	keys := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for _, b := range []byte(password) {
+		keys.update(b)
+	}
+	return keys
+}
+
+func (keys *zipCryptoKeys) update(b byte) {
+	keys[0] = crc32Update(keys[0], b)
+	keys[1] = (keys[1] + (keys[0] & 0xff)) * 134775813 + 1
+	keys[2] = crc32Update(keys[2], byte(keys[1] >> 24))
+}
+
+// Gets the next byte of the keystream
+func (keys *zipCryptoKeys) streamByte() byte {
+	temp := (keys[2] | 2) & 0xffff
+	return byte((temp * (temp ^ 1)) >> 8)
+}
+
+func (keys *zipCryptoKeys) encrypt(data []byte) []byte {
+	encrypted := make([]byte, len(data))
+	for i, b := range data {
+		encrypted[i] = b ^ keys.streamByte()
+		keys.update(b)
+	}
+	return encrypted
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[(crc ^ uint32(b)) & 0xff] ^ (crc >> 8)
+}
+
+// Compresses and encrypts the contents, and writes them as a raw zip entry
+func writeEncryptedZipEntry(zipWriter *zip.Writer, header *zip.FileHeader, contents []byte, password string) error {
+	var compressed bytes.Buffer
+	flateWriter, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	flateWriter.Write(contents)
+	err = flateWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	// The 12 byte encryption header is random, except for the last byte, which is checked against the CRC when decrypting
+	crc := crc32.ChecksumIEEE(contents)
+	encryptionHeader := make([]byte, 12)
+	_, err = rand.Read(encryptionHeader)
+	if err != nil {
+		return err
+	}
+	encryptionHeader[11] = byte(crc >> 24)
+
+	keys := newZipCryptoKeys(password)
+	encrypted := append(keys.encrypt(encryptionHeader), keys.encrypt(compressed.Bytes())...)
+
+	header.Flags |= 0x1 // encrypted
+	header.CRC32 = crc
+	header.CompressedSize64 = uint64(len(encrypted))
+	header.UncompressedSize64 = uint64(len(contents))
+	entryWriter, err := zipWriter.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	_, err = entryWriter.Write(encrypted)
+	return err
+}
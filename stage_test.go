@@ -0,0 +1,119 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Stage_Zip(t *testing.T) {
+	dir := createTestStagingDir(t)
+	archivePath := t.TempDir() + "/staged.zip"
+
+	args := []string{"./noisemaker", "stage", archivePath, dir}
+	output := callMain(args)
+	assert.Contains(t, output, "Staged 3 files (34 bytes) into "+archivePath)
+	assert.Equal(t, activityLogEntry.activity, "stage")
+	assert.Equal(t, activityLogEntry.path, archivePath)
+	assert.Equal(t, activityLogEntry.status, "staged")
+	assert.Contains(t, activityLogEntry.details, "3 source files\\, 34 source bytes")
+
+	reader, err := zip.OpenReader(archivePath)
+	assert.Nil(t, err)
+	defer reader.Close()
+	assert.Len(t, reader.File, 3)
+}
+
+func TestMain_Stage_TarGz(t *testing.T) {
+	dir := createTestStagingDir(t)
+	archivePath := t.TempDir() + "/staged.tar.gz"
+
+	args := []string{"./noisemaker", "stage", archivePath, dir + "/a.txt", dir + "/sub"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "staged")
+	assert.Contains(t, activityLogEntry.details, "2 source files\\, 20 source bytes")
+	assert.Contains(t, activityLogEntry.details, "(tar.gz)")
+
+	f, err := os.Open(archivePath)
+	assert.Nil(t, err)
+	defer f.Close()
+	gzipReader, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+	tarReader := tar.NewReader(gzipReader)
+	count := 0
+	for {
+		_, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		count += 1
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestMain_Stage_EncryptedZip(t *testing.T) {
+	dir := createTestStagingDir(t)
+	archivePath := t.TempDir() + "/staged.zip"
+
+	args := []string{"./noisemaker", "-archive-password=hunter2", "stage", archivePath, dir}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "staged")
+	assert.Contains(t, activityLogEntry.details, "(zip\\, encrypted)")
+
+	reader, err := zip.OpenReader(archivePath)
+	assert.Nil(t, err)
+	defer reader.Close()
+	for _, file := range reader.File {
+		assert.Equal(t, uint16(0x1), file.Flags&0x1)
+	}
+
+	// If unzip is around, make sure it can decrypt the archive with the password (and only with the password)
+	if _, err := exec.LookPath("unzip"); err == nil {
+		err = exec.Command("unzip", "-t", "-P", "hunter2", archivePath).Run()
+		assert.Nil(t, err)
+		err = exec.Command("unzip", "-t", "-P", "wrong", archivePath).Run()
+		assert.NotNil(t, err)
+	}
+}
+
+func TestMain_Stage_PasswordRequiresZip(t *testing.T) {
+	dir := createTestStagingDir(t)
+	archivePath := t.TempDir() + "/staged.tar"
+
+	args := []string{"./noisemaker", "-archive-password=hunter2", "stage", archivePath, dir}
+	output := callMain(args)
+	assert.Contains(t, output, "only zip archives can be password-protected, not tar")
+	assert.Equal(t, activityLogEntry.status, "invalid_path")
+}
+
+func TestMain_Stage_NotFound(t *testing.T) {
+	archivePath := t.TempDir() + "/staged.zip"
+
+	args := []string{"./noisemaker", "stage", archivePath, "./nonexistent-dir"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "not_found")
+	assert.False(t, fileExists(archivePath))
+}
+
+func TestGetArchiveEntryName(t *testing.T) {
+	assert.Equal(t, "tmp/staging/a.txt", getArchiveEntryName("/tmp/staging/a.txt"))
+	assert.Equal(t, "staging/a.txt", getArchiveEntryName("./staging/../staging/a.txt"))
+	assert.Equal(t, "a.txt", getArchiveEntryName("../../a.txt"))
+}
+
+// Creates a directory of files to stage, with 34 bytes across 3 files
+func createTestStagingDir(t *testing.T) string {
+	dir := t.TempDir()
+	assert.Nil(t, os.Mkdir(dir+"/sub", 0755))
+	assert.Nil(t, createTestFileUnlessExists(dir+"/a.txt", "Hello World!"))
+	assert.Nil(t, createTestFileUnlessExists(dir+"/b.txt", "Goodbye World!"))
+	assert.Nil(t, createTestFileUnlessExists(dir+"/sub/c.txt", "Nested!!"))
+	return dir
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// The context the run's actions are done in (file I/O, requests, connections, processes, and waits), which is cancelled once -timeout
+// is up, so a hung path or an unresponsive server can't wedge the run
+var runContext = context.Background()
+
+// How long a run's command gets to notice it's been cancelled (and log what it did) before it's stopped anyway
+var TimeoutGracePeriod = 5 * time.Second
+
+// Starts the run's timeout, if it has one: runContext is cancelled once it's up, and if the parent's command still hasn't finished by
+// the end of the grace period, its entry's logged as cancelled, the activity log is closed, and the process exits (as on a shutdown
+// signal). Returns the function that stops it.
+func startRunTimeout(activityLog Sink, parent *ActivityLogEntry, timeout time.Duration) func() {
+	if timeout <= 0 {
+		runContext = context.Background()
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	runContext = ctx
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+			return
+		}
+		select {
+		case <-time.After(TimeoutGracePeriod):
+			fmt.Printf("Timed out after %v, stopping...\n", timeout)
+			markCancelled(parent)
+			writeLogEntry(activityLog, parent)
+			if runSummary != nil {
+				runSummary.end(activityLog, "cancelled", fmt.Sprintf("-timeout of %v reached", timeout))
+			}
+			logFileMutex.Lock()
+			activityLog.Close()
+			shutdownExit(1)
+			logFileMutex.Unlock()
+		case <-stopped:
+		}
+	}()
+	return func() {
+		close(stopped)
+		runContext = context.Background()
+		cancel()
+	}
+}
+
+// Whether the run's been cancelled, because its -timeout is up
+func isRunCancelled() bool {
+	return runContext.Err() != nil
+}
+
+// Records the entry as cancelled if the run was cancelled while it was being done, keeping whatever else it recorded (ie. the bytes
+// sent before it was)
+func markCancelled(entry *ActivityLogEntry) {
+	if !isRunCancelled() || entry.status == "cancelled" {
+		return
+	}
+	entry.status = "cancelled"
+	reason := fmt.Sprintf("cancelled: -timeout of %v reached", *timeoutPtr)
+	if entry.details == "" {
+		entry.details = escapeRawText(reason)
+	} else {
+		entry.details += escapeRawText(" (" + reason + ")")
+	}
+}
+
+// Sleeps for the duration, or until the run's cancelled (returning why)
+func sleepContext(duration time.Duration) error {
+	if duration <= 0 {
+		return runContext.Err()
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-runContext.Done():
+		return runContext.Err()
+	}
+}
+
+// Does an action that could block for good (ie. file I/O on a hung NFS mount), giving up on it if the run's cancelled first: the
+// cancelled value's returned with the reason, and the action's left to finish (or not) on its own
+func runCancellable[T any](cancelled T, action func() (T, error)) (T, error) {
+	if runContext.Done() == nil {
+		return action()
+	}
+	if err := runContext.Err(); err != nil {
+		return cancelled, err
+	}
+	type result struct {
+		value				T
+		err					error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := action()
+		done <- result{value, err}
+	}()
+	select {
+	case finished := <-done:
+		return finished.value, finished.err
+	case <-runContext.Done():
+		return cancelled, runContext.Err()
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Timeout_Send(t *testing.T) {
+	// (a server that never answers)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	started := time.Now()
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-timeout=200ms", "send", "GET", host, port})
+	assert.Less(t, time.Since(started), 5 * time.Second)
+	assert.Equal(t, "send", activityLogEntry.activity)
+	assert.Equal(t, "cancelled", activityLogEntry.status)
+	assert.Contains(t, activityLogEntry.details, "cancelled: -timeout of 200ms reached")
+	assertLogFileContains(t, logFilePath, ",cancelled,")
+}
+
+func TestMain_Timeout_Execute(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep isn't a command on Windows")
+	}
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// The process is killed, rather than waited on
+	started := time.Now()
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-timeout=200ms", "execute", "sleep", "30"})
+	assert.Less(t, time.Since(started), 5 * time.Second)
+	assert.Equal(t, "cancelled", activityLogEntry.status)
+	assert.NotZero(t, activityLogEntry.processId)
+}
+
+func TestMain_Timeout_Playbook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep isn't a command on Windows")
+	}
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	playbookPath := dir + "/playbook.yaml"
+	assert.Nil(t, os.WriteFile(playbookPath, []byte("name: slow\nsteps:\n  - command: create\n    args: [\"" + dir + "/first.txt\"]\n  - command: execute\n    args: [sleep, \"30\"]\n  - command: create\n    args: [\"" + dir + "/never.txt\"]\n"), 0644))
+
+	// The step that's running is cancelled, and the ones after it aren't started
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-timeout=300ms", "playbook", playbookPath})
+	assert.Equal(t, "playbook", activityLogEntry.activity)
+	assert.Equal(t, "cancelled", activityLogEntry.status)
+	assert.FileExists(t, dir + "/first.txt")
+	assert.NoFileExists(t, dir + "/never.txt")
+	contents, err := os.ReadFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(string(contents), ",created,"))
+	assert.Equal(t, 2, strings.Count(string(contents), ",cancelled,"))
+
+	// Without a timeout, nothing's cancelled
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "read", dir + "/first.txt"})
+	assert.Equal(t, "read", activityLogEntry.status)
+}
+
+func TestRunCancellable(t *testing.T) {
+	defer func() { runContext = context.Background() }()
+	value, err := runCancellable("cancelled", func() (string, error) { return "done", nil })
+	assert.Nil(t, err)
+	assert.Equal(t, "done", value)
+
+	// An action that never finishes (ie. on a hung mount) is given up on once the run's cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+	runContext = ctx
+	hung := make(chan struct{})
+	defer close(hung)
+	value, err = runCancellable("cancelled", func() (string, error) {
+		<-hung
+		return "done", nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, "cancelled", value)
+	assert.Equal(t, context.DeadlineExceeded, sleepContext(time.Hour))
+}
+
+func TestStartRunTimeout(t *testing.T) {
+	exited := make(chan int, 1)
+	shutdownExit = func(code int) { exited <- code }
+	TimeoutGracePeriod = 10 * time.Millisecond
+	defer func() {
+		shutdownExit = os.Exit
+		TimeoutGracePeriod = 5 * time.Second
+	}()
+
+	// A command that never notices it's been cancelled has its entry logged anyway, and the process exits
+	recorder := newRunRecorderSink()
+	parent := &ActivityLogEntry{runId: "timeout-run", activity: "execute", status: "completed"}
+	stop := startRunTimeout(recorder, parent, 20 * time.Millisecond)
+	defer stop()
+	select {
+	case code := <-exited:
+		assert.Equal(t, 1, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run wasn't stopped")
+	}
+	entries := recorder.getEntries("timeout-run")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "cancelled", entries[0].status)
+
+	// A run that finishes in time isn't stopped
+	stop = startRunTimeout(recorder, parent, time.Hour)
+	stop()
+	assert.False(t, isRunCancelled())
+}
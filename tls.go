@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Builds the TLS config for the daemon (if it has a certificate), requiring clients to present a certificate signed by the CA, if one's given
+func getDaemonTLSConfig(certPath string, keyPath string, caPath string) (*tls.Config, error) {
+	if certPath == "" && keyPath == "" {
+		if caPath != "" {
+			return nil, fmt.Errorf("-tls-ca needs -tls-cert and -tls-key for the daemon")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if caPath != "" {
+		config.ClientCAs, err = loadCertPool(caPath)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Builds the TLS config for the controller, presenting its certificate (if it has one) and only trusting agents signed by the CA (if one's given)
+func getControlTLSConfig(certPath string, keyPath string, caPath string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caPath != "" {
+		var err error
+		config.RootCAs, err = loadCertPool(caPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// Loads the PEM certificates in the file at path
+func loadCertPool(path string) (*x509.CertPool, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(contents) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A single request of a traffic profile, and how long to wait before making it
+type TrafficRequest struct {
+	method				string
+	path				string
+	headers				map[string]string
+	body				string
+	delay				time.Duration
+}
+
+// A named pattern of benign but structured HTTP traffic, generating one cycle of its requests at a time (ie. one page load)
+type TrafficProfile struct {
+	name				string
+	description			string
+	generate			func(random *rand.Rand, cycle int) []TrafficRequest
+}
+
+// The catalog of traffic profiles, selected by name
+var TrafficProfiles = []TrafficProfile{
+	{"rest-api", "REST API chatter: a client fetching its session, listing, reading, creating, and updating resources as JSON, with think time in between", generateRESTAPITraffic},
+	{"browser", "A browser-like page load: the page, then its stylesheets, scripts, images, fonts, and favicon in a quick burst, and a background API call", generateBrowserTraffic},
+	{"sync", "A file sync client (OneDrive- or Dropbox-like): polling for changes, uploading a file in chunks to an upload session and committing it, and long-polling for notifications", generateSyncTraffic},
+}
+
+// The User-Agent each profile's requests are made with
+var TrafficUserAgents = map[string]string{
+	"rest-api": "okhttp/4.12.0",
+	"browser": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+	"sync": "Microsoft SkyDriveSync 24.101.0519.0002 ship; Windows NT 10.0 (19045)",
+}
+
+// Options for the traffic command
+type TrafficOptions struct {
+	profile				string		// the profile to generate ("list" to list them)
+	count				int			// how many cycles of it to generate
+	seed				int64
+	destAddr			string
+	destPort			int
+	protocol			string
+}
+
+// Response data from traffic action
+type TrafficResponse struct {
+	requests			int
+	sent				int
+	failed				int
+	bytesSent			int
+	bytesReceived		int
+	status				string
+}
+
+// Parses traffic's arguments: [-count=n] [-seed=n] (profile|list) (destaddr) [destport] [protocol]
+func parseTrafficOptions(args []string) (*TrafficOptions, error) {
+	flags := flag.NewFlagSet("traffic", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	count := flags.Int("count", 1, "how many cycles of the profile to generate (ie. page loads)")
+	seed := flags.Int64("seed", 0, "the random seed, for the same requests and delays again (default random)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid traffic: %v", err)
+	}
+	if flags.NArg() == 1 && flags.Arg(0) == "list" {
+		return &TrafficOptions{profile: "list"}, nil
+	}
+	if flags.NArg() < 2 {
+		return nil, fmt.Errorf("not enough arguments for traffic! Args: %v", args)
+	}
+	if *count < 1 {
+		return nil, fmt.Errorf("invalid traffic: invalid -count %d (must be at least 1)", *count)
+	}
+	_, err = getTrafficProfile(flags.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+
+	options := &TrafficOptions{profile: flags.Arg(0), count: *count, seed: *seed, destAddr: flags.Arg(1), destPort: 80, protocol: "http"}
+	if options.seed == 0 {
+		options.seed = time.Now().UnixNano()
+	}
+	if flags.NArg() > 2 {
+		options.destPort, err = strconv.Atoi(flags.Arg(2))
+		if err != nil {
+			return nil, fmt.Errorf("invalid traffic: invalid destport '%s'", flags.Arg(2))
+		}
+	}
+	if flags.NArg() > 3 {
+		options.protocol = flags.Arg(3)
+	}
+	return options, nil
+}
+
+// Looks up the traffic profile with the given name
+func getTrafficProfile(name string) (*TrafficProfile, error) {
+	names := []string{}
+	for _, profile := range TrafficProfiles {
+		if profile.name == name {
+			return &profile, nil
+		}
+		names = append(names, profile.name)
+	}
+	return nil, fmt.Errorf("unknown traffic profile '%s' (must be one of %s)", name, strings.Join(names, ", "))
+}
+
+// Prints each of the traffic profiles: its name and description
+func listTrafficProfiles(output io.Writer) int {
+	for _, profile := range TrafficProfiles {
+		fmt.Fprintf(output, "%s: %s\n", profile.name, profile.description)
+	}
+	return len(TrafficProfiles)
+}
+
+// Gets a random delay between min and max
+func getTrafficDelay(random *rand.Rand, min time.Duration, max time.Duration) time.Duration {
+	return min + time.Duration(random.Int63n(int64(max - min) + 1))
+}
+
+// Gets a random hex string of the given length (ie. for an asset's content hash, or an ID)
+func getTrafficHex(random *rand.Rand, length int) string {
+	text := ""
+	for len(text) < length {
+		text += fmt.Sprintf("%016x", random.Uint64())
+	}
+	return text[:length]
+}
+
+// Generates one cycle of REST API chatter: the client's session, then a page of orders, one of them, a new one, and an update to it
+func generateRESTAPITraffic(random *rand.Rand, cycle int) []TrafficRequest {
+	jsonHeaders := map[string]string{"Accept": "application/json", "Content-Type": "application/json"}
+	orderId := strconv.Itoa(10000 + random.Intn(90000))
+	requests := []TrafficRequest{
+		{"GET", "/api/v1/users/me", jsonHeaders, "", 0},
+		{"GET", fmt.Sprintf("/api/v1/orders?page=%d&limit=25", cycle), jsonHeaders, "", 0},
+		{"GET", "/api/v1/orders/" + orderId, jsonHeaders, "", 0},
+		{"POST", "/api/v1/orders", jsonHeaders, fmt.Sprintf(`{"sku":"SKU-%d","quantity":%d}`, 1000 + random.Intn(9000), 1 + random.Intn(5)), 0},
+		{"PATCH", "/api/v1/orders/" + orderId, jsonHeaders, `{"status":"shipped"}`, 0},
+	}
+	for i := range requests {
+		requests[i].delay = getTrafficDelay(random, 200 * time.Millisecond, 2 * time.Second)
+	}
+	return requests
+}
+
+// Generates one page load: the page, then each of its assets in a quick burst, and a background API call (after a while reading the
+// page before the next)
+func generateBrowserTraffic(random *rand.Rand, cycle int) []TrafficRequest {
+	pages := []string{"/", "/products", "/products/" + strconv.Itoa(100 + random.Intn(900)), "/about", "/blog/", "/contact"}
+	page := pages[(cycle - 1) % len(pages)]
+	html := map[string]string{"Accept": "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "Accept-Language": "en-US,en;q=0.9"}
+	asset := map[string]string{"Accept": "*/*", "Referer": page}
+	requests := []TrafficRequest{{"GET", page, html, "", getTrafficDelay(random, 2 * time.Second, 8 * time.Second)}}
+	if cycle == 1 {
+		requests[0].delay = 0
+	}
+	for _, path := range []string{
+		"/assets/css/main." + getTrafficHex(random, 8) + ".css",
+		"/assets/js/vendor." + getTrafficHex(random, 8) + ".js",
+		"/assets/js/app." + getTrafficHex(random, 8) + ".js",
+		"/assets/img/logo.svg",
+		fmt.Sprintf("/assets/img/hero-%d.jpg", 1 + random.Intn(4)),
+		"/assets/fonts/inter-var.woff2",
+		"/favicon.ico",
+	} {
+		requests = append(requests, TrafficRequest{"GET", path, asset, "", getTrafficDelay(random, 5 * time.Millisecond, 80 * time.Millisecond)})
+	}
+	api := map[string]string{"Accept": "application/json", "Referer": page, "X-Requested-With": "XMLHttpRequest"}
+	return append(requests, TrafficRequest{"GET", "/api/session", api, "", getTrafficDelay(random, 100 * time.Millisecond, 500 * time.Millisecond)})
+}
+
+// Generates one sync: a poll for changes, an upload session for a changed file (its chunks, then a commit), and a long-poll for notifications
+func generateSyncTraffic(random *rand.Rand, cycle int) []TrafficRequest {
+	jsonHeaders := map[string]string{"Accept": "application/json", "Content-Type": "application/json"}
+	octets := map[string]string{"Content-Type": "application/octet-stream"}
+	sessionId := getTrafficHex(random, 32)
+	cursor := getTrafficHex(random, 24)
+	requests := []TrafficRequest{
+		{"GET", "/v1/drive/root/delta?cursor=" + cursor, jsonHeaders, "", getTrafficDelay(random, time.Second, 5 * time.Second)},
+		{"POST", "/v1/drive/items/root:/Documents/notes-" + strconv.Itoa(cycle) + ".docx:/createUploadSession", jsonHeaders, `{"item":{"@microsoft.graph.conflictBehavior":"replace"}}`, getTrafficDelay(random, 100 * time.Millisecond, 500 * time.Millisecond)},
+	}
+	chunks := 1 + random.Intn(3)
+	for i := 0; i < chunks; i++ {
+		chunk := getBeaconPadding(random, 0, 4096)
+		requests = append(requests, TrafficRequest{"PUT", fmt.Sprintf("/v1/upload/%s?offset=%d", sessionId, i * len(chunk)), octets, chunk, getTrafficDelay(random, 50 * time.Millisecond, 300 * time.Millisecond)})
+	}
+	return append(requests,
+		TrafficRequest{"POST", "/v1/upload/" + sessionId + "/commit", jsonHeaders, fmt.Sprintf(`{"size":%d}`, chunks * 4096), getTrafficDelay(random, 50 * time.Millisecond, 200 * time.Millisecond)},
+		TrafficRequest{"GET", "/v1/notifications/longpoll?cursor=" + cursor, jsonHeaders, "", getTrafficDelay(random, 500 * time.Millisecond, 2 * time.Second)},
+	)
+}
+
+// Generates each cycle of the profile's requests, waiting before each as long as the profile says, and making them the way send does.
+// Each request is logged as its own send activity, sharing the parent's correlation ID, with where it falls in the profile.
+func runTraffic(activityLog Sink, parent *ActivityLogEntry, options *TrafficOptions, profile *TrafficProfile, failRate float64) *TrafficResponse {
+	response := new(TrafficResponse)
+	random := rand.New(rand.NewSource(options.seed))
+	var lastStatus string
+	for cycle := 1; cycle <= options.count; cycle++ {
+		requests := profile.generate(random, cycle)
+		for i, request := range requests {
+			if request.delay > 0 {
+				scheduleSleep(request.delay)
+			}
+			if isRunCancelled() {
+				break
+			}
+			headers := map[string]string{"User-Agent": TrafficUserAgents[profile.name]}
+			for name, value := range request.headers {
+				headers[name] = value
+			}
+
+			entry := newChildLogEntry(parent, "send")
+			entry.method = request.method
+			entry.destAddr = options.destAddr
+			entry.destPort = options.destPort
+			entry.protocol = options.protocol
+			fmt.Printf("%s %d.%d: %s %s (%d bytes)...\n", profile.name, cycle, i + 1, request.method, request.path, len(request.body))
+			messageResponse, err := sendMessageWithFailureRate(request.method, options.destAddr + request.path, options.destPort, options.protocol, headers, request.body, failRate)
+			if err != nil {
+				fmt.Printf("Request failed: %v\n", err)
+				entry.status = messageResponse.status
+				response.failed++
+			} else {
+				entry.status = "sent"
+				response.sent++
+			}
+			response.requests++
+			lastStatus = entry.status
+			entry.path = escapeRawText(messageResponse.path)
+			entry.sourceAddr = messageResponse.sourceAddr
+			entry.sourcePort = messageResponse.sourcePort
+			recordSendConnection(entry, messageResponse)
+			entry.bytesSent = messageResponse.bytesSent
+			entry.bytesReceived = messageResponse.bytesReceived
+			details := fmt.Sprintf("%s cycle %d of %d, request %d of %d, waited %v", profile.name, cycle, options.count, i + 1, len(requests), request.delay.Round(time.Millisecond))
+			if sendDetails := getSendDetails(messageResponse); sendDetails != "" {
+				details += ", " + sendDetails
+			}
+			entry.details = escapeRawText(details)
+			writeLogEntry(activityLog, entry)
+			response.bytesSent += messageResponse.bytesSent
+			response.bytesReceived += messageResponse.bytesReceived
+		}
+	}
+
+	switch {
+	case response.failed == 0:
+		response.status = "sent"
+	case response.sent == 0:
+		response.status = lastStatus
+	default:
+		response.status = "partial"
+	}
+	return response
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Traffic(t *testing.T) {
+	requests := []string{}
+	userAgents := []string{}
+	referers := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method + " " + r.URL.RequestURI())
+		userAgents = append(userAgents, r.UserAgent())
+		referers = append(referers, r.Referer())
+	}))
+	defer server.Close()
+	host, port := getTestServerHostAndPort(t, server)
+	useTestScheduleClock(t, time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC))
+	logFilePath := t.TempDir() + "/activity-log.csv"
+
+	// Two page loads: each page, then its assets, then its API call
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "traffic", "-count=2", "-seed=3", "browser", host, port})
+	assert.Equal(t, activityLogEntry.activity, "traffic")
+	assert.Equal(t, activityLogEntry.method, "browser")
+	assert.Equal(t, activityLogEntry.status, "sent")
+	assert.Equal(t, activityLogEntry.details, "browser: 18 of 18 requests sent\\, over 2 cycles\\, seed 3")
+	assert.Len(t, requests, 18)
+	assert.Equal(t, "GET /", requests[0])
+	assert.True(t, strings.HasPrefix(requests[1], "GET /assets/css/main."))
+	assert.Equal(t, "GET /favicon.ico", requests[7])
+	assert.Equal(t, "GET /api/session", requests[8])
+	assert.Equal(t, "GET /products", requests[9])
+	assert.Equal(t, "/products", referers[10])
+	assert.Equal(t, TrafficUserAgents["browser"], userAgents[0])
+
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 19)
+	first, asset := parsedLog.entries[0], parsedLog.entries[1]
+	assert.Equal(t, "send", first.activity)
+	assert.Equal(t, "GET", first.method)
+	assert.Equal(t, "http://" + host + ":" + port + "/", first.path)
+	assert.Equal(t, activityLogEntry.correlationId, first.correlationId)
+	assert.Equal(t, "browser cycle 1 of 2\\, request 1 of 9\\, waited 0s", first.details)
+	assert.True(t, strings.HasPrefix(asset.details, "browser cycle 1 of 2\\, request 2 of 9\\, waited "))
+
+	// The same seed gives the same traffic again
+	firstRequests := requests
+	requests = nil
+	callMain([]string{"./noisemaker", "-sink=stdout", "traffic", "-count=2", "-seed=3", "browser", host, port})
+	assert.Equal(t, firstRequests, requests)
+}
+
+func TestMain_Traffic_List(t *testing.T) {
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "traffic", "list"})
+	assert.Contains(t, output, "rest-api: REST API chatter")
+	assert.Equal(t, activityLogEntry.method, "list")
+	assert.Equal(t, activityLogEntry.details, "3 profiles")
+
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "traffic", "ftp", "127.0.0.1"}, "unknown traffic profile 'ftp' (must be one of rest-api, browser, sync)")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "traffic", "browser"}, "not enough arguments for traffic! Args: [browser]")
+}
+
+func TestTrafficProfiles(t *testing.T) {
+	// Every profile makes requests with a User-Agent, waiting a realistic while between them
+	for _, profile := range TrafficProfiles {
+		assert.NotEmpty(t, TrafficUserAgents[profile.name], profile.name)
+		requests := profile.generate(rand.New(rand.NewSource(1)), 2)
+		assert.NotEmpty(t, requests, profile.name)
+		for _, request := range requests {
+			assert.True(t, strings.HasPrefix(request.path, "/"), request.path)
+			assert.Less(t, request.delay, 10 * time.Second)
+		}
+	}
+
+	// A sync uploads its chunks in order, then commits them
+	requests := generateSyncTraffic(rand.New(rand.NewSource(1)), 1)
+	assert.Equal(t, "PUT", requests[2].method)
+	assert.Len(t, requests[2].body, 4096)
+	assert.True(t, strings.HasSuffix(requests[len(requests) - 2].path, "/commit"))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+)
+
+// Options for the delete command
+type DeleteOptions struct {
+	path				string
+	paths				[]string	// every path given (the first is path), each of which can be a glob (ie. "./staging/*.bin")
+	trash				bool		// whether to move the file to the trash (or Recycle Bin), rather than unlinking it
+	ignoreMissing		bool		// whether to skip it (rather than fail), if the file doesn't exist
+}
+
+// Parses delete's arguments: [-trash] [-ignore-missing] (path) [paths...]
+func parseDeleteOptions(args []string) (*DeleteOptions, error) {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	trash := flags.Bool("trash", false, "moves the file to the trash (or Recycle Bin), rather than unlinking it (default false)")
+	ignoreMissing := flags.Bool("ignore-missing", false, "skips deleting the file if it doesn't exist, rather than failing (default false)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delete: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for delete! Args: %v", args)
+	}
+	return &DeleteOptions{path: flags.Arg(0), paths: flags.Args(), trash: *trash, ignoreMissing: *ignoreMissing}, nil
+}
+
+// Gets the arguments to delete one of a set of files with, with the same options
+func (options *DeleteOptions) getArgs(path string) []string {
+	args := []string{}
+	if options.trash {
+		args = append(args, "-trash")
+	}
+	if options.ignoreMissing {
+		args = append(args, "-ignore-missing")
+	}
+	return append(args, path)
+}
+
+// Records a delete of a file that doesn't exist as skipped, with -ignore-missing (ie. an earlier run of the same playbook deleted it)
+func skipMissingFile(activityLogEntry *ActivityLogEntry, path string) {
+	fmt.Printf("Skipping deleting %s, since it doesn't exist\n", path)
+	activityLogEntry.status = "skipped"
+	activityLogEntry.details = escapeRawText("not found (-ignore-missing)")
+}
+
+// Response data from moving a file to the trash
+type TrashResponse struct {
+	destination			string		// where the file went (the Recycle Bin, on Windows, which picks the file's name there itself)
+	created				[]string	// the files made in the trash, which can be deleted to empty it again
+	status				string
+}
+
+// Moves a file to the trash (or Recycle Bin), if it exists
+func trashFile(path string) (*TrashResponse, error) {
+	if !fileExists(path) {
+		fmt.Printf("File %s not found for deleting!\n", path)
+		return &TrashResponse{status: "not_found"}, fmt.Errorf("file_not_found: %s", path)
+	}
+	response, err := moveToTrash(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	fmt.Printf("File %s moved to the trash, at %s\n", path, response.destination)
+	response.status = "trashed"
+	return response, nil
+}
@@ -0,0 +1,121 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Moves the file to the current user's trash: ~/.Trash on Mac, or the freedesktop.org trash (with the .trashinfo file that records
+// where it came from, so it can be restored) elsewhere
+func moveToTrash(path string) (*TrashResponse, error) {
+	response := new(TrashResponse)
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return response, err
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return response, err
+	}
+
+	if runtime.GOOS == "darwin" {
+		trashDir := filepath.Join(homeDir, ".Trash")
+		response.destination = getTrashName(trashDir, filepath.Base(absolute), "", func(name string, n int) string {
+			extension := filepath.Ext(name)
+			return fmt.Sprintf("%s %d%s", strings.TrimSuffix(name, extension), n, extension)
+		})
+		response.created = []string{response.destination}
+		return response, moveFile(absolute, response.destination)
+	}
+
+	trashDir := filepath.Join(homeDir, ".local", "share", "Trash")
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		trashDir = filepath.Join(dataHome, "Trash")
+	}
+	if err = os.MkdirAll(filepath.Join(trashDir, "files"), 0700); err != nil {
+		return response, err
+	}
+	if err = os.MkdirAll(filepath.Join(trashDir, "info"), 0700); err != nil {
+		return response, err
+	}
+	response.destination = getTrashName(filepath.Join(trashDir, "files"), filepath.Base(absolute), filepath.Join(trashDir, "info"), func(name string, n int) string {
+		return fmt.Sprintf("%s.%d", name, n)
+	})
+	infoPath := filepath.Join(trashDir, "info", filepath.Base(response.destination) + ".trashinfo")
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n", escapeTrashPath(absolute), time.Now().Format("2006-01-02T15:04:05"))
+	if err = os.WriteFile(infoPath, []byte(info), 0600); err != nil {
+		return response, err
+	}
+	response.created = []string{response.destination, infoPath}
+	if err = moveFile(absolute, response.destination); err != nil {
+		os.Remove(infoPath)
+		response.created = nil
+	}
+	return response, err
+}
+
+// Gets a name for the file in the trash that isn't taken yet (numbering it, with numbered, if it is), in the trash's directory of files
+// (and, for the freedesktop.org trash, its directory of .trashinfo files)
+func getTrashName(filesDir string, name string, infoDir string, numbered func(string, int) string) string {
+	candidate := name
+	for n := 2; ; n++ {
+		_, err := os.Lstat(filepath.Join(filesDir, candidate))
+		taken := err == nil
+		if infoDir != "" {
+			_, err = os.Lstat(filepath.Join(infoDir, candidate + ".trashinfo"))
+			taken = taken || err == nil
+		}
+		if !taken {
+			return filepath.Join(filesDir, candidate)
+		}
+		candidate = numbered(name, n)
+	}
+}
+
+// Escapes a path the way the freedesktop.org trash spec records it (as a URL path, without encoding slashes)
+func escapeTrashPath(path string) string {
+	escaped := strings.Builder{}
+	for _, b := range []byte(path) {
+		if b == '/' || b == '-' || b == '_' || b == '.' || b == '~' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// Moves the file (copying it, then removing it, if it's on another filesystem than the trash)
+func moveFile(from string, to string) error {
+	err := os.Rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := os.OpenFile(to, os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(destination, source)
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(to)
+		return err
+	}
+	return os.Remove(from)
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Delete_Trash(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	dir := t.TempDir()
+	path := dir + "/report draft.txt"
+	trashDir := filepath.Join(home, ".local", "share", "Trash", "files")
+	trashed := filepath.Join(trashDir, "report draft.txt")
+	renamed := filepath.Join(trashDir, "report draft.txt.2")
+	if runtime.GOOS == "darwin" {
+		trashDir = filepath.Join(home, ".Trash")
+		trashed = filepath.Join(trashDir, "report draft.txt")
+		renamed = filepath.Join(trashDir, "report draft 2.txt")
+	}
+
+	// The file's moved into the trash, rather than unlinked
+	assert.Nil(t, os.WriteFile(path, []byte("Hello World!\n"), 0644))
+	output := callMain([]string{"./noisemaker", "-sink=stdout", "delete", "-trash", path})
+	assert.Contains(t, output, "File " + path + " moved to the trash, at " + trashed)
+	assert.Equal(t, activityLogEntry.status, "trashed")
+	assert.Equal(t, activityLogEntry.method, "trash")
+	assert.Equal(t, activityLogEntry.details, escapeRawText("moved to " + trashed))
+	assert.False(t, fileExists(path))
+	contents, err := os.ReadFile(trashed)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello World!\n", string(contents))
+	if runtime.GOOS != "darwin" {
+		info, err := os.ReadFile(filepath.Join(home, ".local", "share", "Trash", "info", "report draft.txt.trashinfo"))
+		assert.Nil(t, err)
+		assert.Contains(t, string(info), "[Trash Info]\nPath=" + escapeTrashPath(path) + "\nDeletionDate=")
+		assert.Contains(t, string(info), "%20draft.txt")
+	}
+
+	// Another file of the same name doesn't replace it
+	assert.Nil(t, os.WriteFile(path, []byte("Goodbye!\n"), 0644))
+	callMain([]string{"./noisemaker", "-sink=stdout", "delete", "-trash", path})
+	assert.Equal(t, activityLogEntry.details, escapeRawText("moved to " + renamed))
+	assert.True(t, fileExists(trashed))
+	assert.True(t, fileExists(renamed))
+
+	callMain([]string{"./noisemaker", "-sink=stdout", "delete", "-trash", path})
+	assert.Equal(t, activityLogEntry.status, "not_found")
+	assertMainPanicsWithMessage(t, []string{"./noisemaker", "-sink=stdout", "delete", "-trash"}, "not enough arguments for delete! Args: [-trash]")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// (SHFileOperationW isn't wrapped by x/sys/windows)
+var shell32 = windows.NewLazySystemDLL("shell32.dll")
+var procSHFileOperationW = shell32.NewProc("SHFileOperationW")
+
+// The SHFILEOPSTRUCTW SHFileOperationW takes
+type shFileOpStruct struct {
+	hwnd				uintptr
+	wFunc				uint32
+	pFrom				*uint16
+	pTo					*uint16
+	fFlags				uint16
+	fAnyOperationsAborted	int32
+	hNameMappings		uintptr
+	lpszProgressTitle	*uint16
+}
+
+const (
+	foDelete			= 0x3
+	fofSilent			= 0x4
+	fofNoConfirmation	= 0x10
+	fofAllowUndo		= 0x40
+	fofNoErrorUI		= 0x400
+)
+
+// Moves the file to the Recycle Bin, the way Explorer does (with SHFileOperation, allowing undo), which records it in the recycle bin of
+// its drive, under the current user's SID
+func moveToTrash(path string) (*TrashResponse, error) {
+	response := new(TrashResponse)
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return response, err
+	}
+	response.destination = filepath.Join(filepath.VolumeName(absolute) + `\`, "$Recycle.Bin")
+	if user, err := windows.GetCurrentProcessToken().GetTokenUser(); err == nil {
+		response.destination = filepath.Join(response.destination, user.User.Sid.String())
+	}
+
+	// (the list of files is double-null terminated)
+	from, err := windows.UTF16FromString(absolute)
+	if err != nil {
+		return response, err
+	}
+	operation := &shFileOpStruct{
+		wFunc: foDelete,
+		pFrom: &append(from, 0)[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI,
+	}
+	result, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(operation)))
+	if result != 0 {
+		return response, &os.PathError{Op: "SHFileOperation", Path: path, Err: syscall.Errno(result)}
+	}
+	if operation.fAnyOperationsAborted != 0 {
+		return response, &os.PathError{Op: "SHFileOperation", Path: path, Err: windows.ERROR_CANCELLED}
+	}
+	return response, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Options for the update command
+type UpdateOptions struct {
+	path				string
+	contents			string
+	createIfMissing		bool		// whether to create the file (as create would), if it doesn't exist yet
+	profile				*ContentProfile		// the profile to generate the contents with, in place of the contents given (or nil)
+}
+
+// Parses update's arguments: [-create-if-missing] [-profile=(profile)] [-entropy=(bits)] (path) [contents]
+func parseUpdateOptions(args []string) (*UpdateOptions, error) {
+	flags := flag.NewFlagSet("update", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	createIfMissing := flags.Bool("create-if-missing", false, "creates the file, if it doesn't exist yet (default false)")
+	getProfile := addContentProfileFlags(flags)
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for update! Args: %v", args)
+	}
+	options := &UpdateOptions{path: flags.Arg(0), createIfMissing: *createIfMissing}
+	if flags.NArg() > 1 {
+		options.contents = flags.Arg(1)
+	}
+	options.profile, err = getProfile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid update: %v", err)
+	}
+	if options.profile != nil && flags.NArg() > 1 {
+		return nil, fmt.Errorf("invalid update: -profile and -entropy generate the contents, so can't be given contents too")
+	}
+	return options, nil
+}
+
+// Gets the arguments to update one of the files a glob matches with the same options
+func (options *UpdateOptions) getArgs(match string) []string {
+	args := options.profile.getArgs()
+	if options.profile == nil {
+		return append(args, match, options.contents)
+	}
+	return append(args, match)
+}
+
+// Gets the size to generate a file's new contents at: the size it is, so it's overwritten in place, as ransomware encrypting it would
+// (or, if it's empty or isn't there, the default)
+func getUpdatedFileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 {
+		return DefaultGeneratedFileSize
+	}
+	return info.Size()
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every activity that's logged (add new ones on the end, since their positions are also their Windows event IDs, as well as to the comment on ActivityLogEntry.activity)
+var KnownActivities = []string{"execute", "create", "modify", "update", "delete", "send", "listen", "receive", "scan", "connect", "netenum", "discover", "discovery", "credprobe", "access", "procaccess", "pipe", "useradd", "userdel", "groupadd", "groupdel", "screenshot", "stage", "exfil", "playbook", "daemon", "control", "dispatch", "collect", "migrate-log", "verify", "log", "help", "replay", "compare", "verify-signatures", "decrypt-log", "generate", "scenario", "resume", "shutdown", "cleanup", "ssh", "remote-exec", "read", "k8sprobe", "k8s-api", "containerprobe", "shred", "hosts", "browser", "dropper", "download", "lolbin", "fileless", "inject", "inputhook", "avdevice", "beacon", "dga", "traffic", "doctor", "capabilities", "action", "script", "fuzz", "run-start", "run-end", "heartbeat", "watch", "observe", "decoy", "edgenames"}
+
+// Every status that's logged (add new ones here), besides the exit status of an executed process
+var KnownStatuses = []string{"", "accessed", "added", "cancelled", "captured", "closed", "completed", "created", "decrypted", "degraded", "deleted", "disabled", "discovered", "error", "exfiltrated", "exists", "filtered", "healthy", "hooked", "injected", "injected_failure", "insufficient_privilege", "interrupted", "invalid", "invalid_address", "invalid_name", "invalid_path", "invalid_request", "migrated", "modified", "no_access", "not_found", "open", "opened", "partial", "placeholder", "queued", "read", "received", "removed", "resolved", "resumed", "running", "send_failed", "sent", "shredded", "skipped", "stage_failed", "staged", "started", "stopped", "timeout", "too_long", "trashed", "unable_to_run", "unhealthy", "unknown_protocol", "unreachable", "unsupported", "unsupported_version", "untouched", "up_to_date", "updated", "valid"}
+
+// How a signed entry's signature is recorded (see signing.go)
+var signaturePattern = regexp.MustCompile("^(hmac-sha256|ed25519):[0-9]+:[A-Za-z0-9+/]+=*$")
+
+// How the process state of an executed process is recorded, ie. "exit status 1" or "signal: killed"
+var processStatePattern = regexp.MustCompile("^(exit status -?[0-9]+|signal: .+)$")
+
+// Statuses that mean the activity failed, rather than doing what it was asked (if only partly, or finding that something's
+// closed, filtered, or invalid). Used wherever failures are counted or flagged: metrics, log stats, and the sinks' severities.
+var FailureStatuses = []string{"error", "exists", "injected_failure", "insufficient_privilege", "invalid_address", "invalid_name", "invalid_path", "invalid_request", "no_access", "not_found", "send_failed", "stage_failed", "timeout", "too_long", "unable_to_run", "unhealthy", "unknown_protocol", "unreachable", "unsupported", "unsupported_version"}
+
+// Whether the status is one of the FailureStatuses (or an executed process that exited with an error, or was killed)
+func isFailureStatus(status string) bool {
+	return containsString(FailureStatuses, status) || (processStatePattern.MatchString(status) && status != "exit status 0")
+}
+
+// How many malformed lines to list in the verify entry's details (they're all printed)
+const MaxReportedLines = 10
+
+// Response data from verify action
+type VerifyResponse struct {
+	rows				int
+	malformed			int
+	malformedLines		[]int
+	status				string
+}
+
+// Checks every row of the activity log at path (CSV, or JSON lines) against the schema, printing each problem found with its line number
+func verifyLog(path string) (*VerifyResponse, error) {
+	response := &VerifyResponse{status: "error"}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		response.status = "not_found"
+		return response, err
+	}
+	contents, err = decryptLogIfEncrypted(path, contents)
+	if err != nil {
+		return response, err
+	}
+
+	if isSQLiteLog(contents) {
+		response.status = "unsupported"
+		return response, fmt.Errorf("SQLite logs can't be verified")
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n")
+	if isJSONLLog(path, contents) {
+		verifyJSONLLines(lines, response)
+	} else {
+		verifyCSVLines(lines, response)
+	}
+
+	// (a bad version line or header makes the whole log invalid, even if every row is fine)
+	if len(response.malformedLines) == 0 {
+		response.status = "valid"
+	} else {
+		response.status = "invalid"
+	}
+	return response, nil
+}
+
+// Leaves the log being verified out of the sinks the verify entry is written to, if opening it as a sink would change it first
+// (older logs are migrated when they're opened, and newer ones can't be opened at all), so it's verified as it was. If that
+// leaves no sinks, the verify entry is printed instead.
+func getVerifySinkSpecs(sinkSpecs []string, logFilePath string, verifyPath string) []string {
+	contents, err := readLogFile(verifyPath)
+	if err != nil {
+		return sinkSpecs
+	}
+	// (a log that can't be parsed is left as-is when it's opened, too)
+	parsedLog, err := parseLog(verifyPath, contents)
+	if err != nil || (parsedLog.version == SchemaVersion && parsedLog.versioned) {
+		return sinkSpecs
+	}
+
+	if len(sinkSpecs) == 0 {
+		sinkSpecs = []string{"csv"}
+	}
+	verifyPath, _ = filepath.Abs(verifyPath)
+	remaining := []string{}
+	for _, sinkSpec := range sinkSpecs {
+		sinkType, target, _ := strings.Cut(sinkSpec, ":")
+		if sinkType == "csv" && target == "" {
+			target = logFilePath
+		}
+		target, _ = filepath.Abs(target)
+		if (sinkType == "csv" || sinkType == "jsonl") && target == verifyPath {
+			fmt.Printf("Not writing the verify entry to %s, since it isn't at the current schema version\n", verifyPath)
+			continue
+		}
+		remaining = append(remaining, sinkSpec)
+	}
+	if len(remaining) == 0 {
+		remaining = []string{"stdout"}
+	}
+	return remaining
+}
+
+// Records a problem with the given line (counting the line as malformed once, however many problems it has)
+func (response *VerifyResponse) addProblems(line int, isRow bool, problems []string) {
+	if len(problems) == 0 {
+		return
+	}
+	for _, problem := range problems {
+		fmt.Printf("Line %d: %s\n", line, problem)
+	}
+	if isRow {
+		response.malformed += 1
+	}
+	response.malformedLines = append(response.malformedLines, line)
+}
+
+// Checks the version line and header (if any), then checks each row has the header's columns, and that their values are valid
+func verifyCSVLines(lines []string, response *VerifyResponse) {
+	columns := strings.Split(HeaderStr, ",")
+	expectedFields := 0
+	versionLine := 0
+	for i, line := range lines {
+		lineNumber := i + 1
+		if line == "" {
+			continue
+		}
+
+		// The version line (if there is one) comes first, then the header
+		if isSchemaVersionStr(line) {
+			if versionLine != 0 || response.rows > 0 {
+				response.addProblems(lineNumber, false, []string{"schema version line isn't at the start of the log"})
+				continue
+			}
+			versionLine = lineNumber
+			version, err := strconv.Atoi(strings.TrimPrefix(line, SchemaVersionPrefix))
+			if err != nil || version < 1 || version > SchemaVersion {
+				response.addProblems(lineNumber, false, []string{fmt.Sprintf("invalid schema version '%s' (must be 1 to %d)", line, SchemaVersion)})
+				continue
+			}
+			expectedFields = SchemaColumnCounts[version - 1]
+			continue
+		}
+		if strings.HasPrefix(line, "timestamp,") {
+			if response.rows > 0 {
+				response.addProblems(lineNumber, false, []string{"header isn't at the start of the log"})
+				continue
+			}
+			headerFields := len(strings.Split(line, ","))
+			if !slices.Contains(SchemaColumnCounts, headerFields) || line != strings.Join(columns[:headerFields], ",") {
+				response.addProblems(lineNumber, false, []string{fmt.Sprintf("unrecognized header '%s'", line)})
+			} else if expectedFields != 0 && headerFields != expectedFields {
+				response.addProblems(lineNumber, false, []string{fmt.Sprintf("header has %d columns (schema version on line %d has %d)", headerFields, versionLine, expectedFields)})
+			} else {
+				expectedFields = headerFields
+			}
+			continue
+		}
+
+		response.rows += 1
+		row, err := splitCSVRow(line)
+		if err != nil {
+			response.addProblems(lineNumber, true, []string{fmt.Sprintf("unable to tokenize row (%v)", err)})
+			continue
+		}
+		if expectedFields != 0 && len(row) != expectedFields {
+			response.addProblems(lineNumber, true, []string{fmt.Sprintf("row has %d fields (expected %d)", len(row), expectedFields)})
+			continue
+		}
+		if expectedFields == 0 && !slices.Contains(SchemaColumnCounts, len(row)) {
+			response.addProblems(lineNumber, true, []string{fmt.Sprintf("row has %d fields (expected one of %v)", len(row), SchemaColumnCounts)})
+			continue
+		}
+		values := map[string]string{}
+		for i, value := range row {
+			values[columns[i]] = unescapeRawText(value)
+		}
+		response.addProblems(lineNumber, true, verifyValues(values))
+	}
+}
+
+// Checks each line is a JSON object of the current (or an older) schema's columns, and that their values are valid
+func verifyJSONLLines(lines []string, response *VerifyResponse) {
+	columns := strings.Split(HeaderStr, ",")
+	for i, line := range lines {
+		lineNumber := i + 1
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		response.rows += 1
+		object := map[string]any{}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		err := decoder.Decode(&object)
+		if err != nil {
+			response.addProblems(lineNumber, true, []string{fmt.Sprintf("invalid JSON (%v)", err)})
+			continue
+		}
+
+		problems := []string{}
+		values := map[string]string{}
+		keys := []string{}
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := object[key]
+			if key == "schemaVersion" {
+				version, err := strconv.Atoi(fmt.Sprintf("%v", value))
+				if err != nil || version < 1 || version > SchemaVersion {
+					problems = append(problems, fmt.Sprintf("invalid schemaVersion '%v' (must be 1 to %d)", value, SchemaVersion))
+				}
+				continue
+			}
+			if !containsString(columns, key) {
+				problems = append(problems, fmt.Sprintf("unknown column '%s'", key))
+				continue
+			}
+			switch typedValue := value.(type) {
+			case json.Number:
+				if !containsString(NumericColumns, key) {
+					problems = append(problems, fmt.Sprintf("%s should be a string (found %v)", key, typedValue))
+				}
+				values[key] = typedValue.String()
+			case string:
+				if containsString(NumericColumns, key) {
+					problems = append(problems, fmt.Sprintf("%s should be a number (found \"%s\")", key, typedValue))
+				}
+				values[key] = typedValue
+			default:
+				problems = append(problems, fmt.Sprintf("%s should be a string or number (found %v)", key, value))
+			}
+		}
+		if _, ok := object["timestamp"]; !ok {
+			problems = append(problems, "missing timestamp")
+		}
+		if len(problems) == 0 {
+			problems = verifyValues(values)
+		}
+		response.addProblems(lineNumber, true, problems)
+	}
+}
+
+// Checks the (unescaped) values of a row: the timestamp's format, the activity and status, and the ranges of numbers, addresses, and labels, and the form of the signature
+func verifyValues(values map[string]string) []string {
+	problems := []string{}
+	if timestamp, ok := values["timestamp"]; ok {
+		_, err := time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid timestamp '%s' (must be RFC3339)", timestamp))
+		}
+	}
+	if activity, ok := values["activity"]; ok && !containsString(KnownActivities, activity) {
+		problems = append(problems, fmt.Sprintf("unknown activity '%s'", activity))
+	}
+	if status, ok := values["status"]; ok && !containsString(KnownStatuses, status) && !processStatePattern.MatchString(status) {
+		problems = append(problems, fmt.Sprintf("unknown status '%s'", status))
+	}
+
+	for _, column := range NumericColumns {
+		value, ok := values[column]
+		if !ok {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			problems = append(problems, fmt.Sprintf("invalid %s '%s' (must be a whole number, 0 or more)", column, value))
+		} else if (column == "sourcePort" || column == "destPort") && number > 65535 {
+			problems = append(problems, fmt.Sprintf("invalid %s '%s' (must be 0 to 65535)", column, value))
+		}
+	}
+
+	for _, hostIP := range strings.Fields(values["hostIPs"]) {
+		if net.ParseIP(hostIP) == nil {
+			problems = append(problems, fmt.Sprintf("invalid hostIPs address '%s'", hostIP))
+		}
+	}
+	if signature := values["signature"]; signature != "" && !signaturePattern.MatchString(signature) {
+		problems = append(problems, fmt.Sprintf("invalid signature '%s' (must be <algorithm>:<schema version>:<base64>)", signature))
+	}
+	if elevated := values["elevated"]; elevated != "" && elevated != "true" && elevated != "false" {
+		problems = append(problems, fmt.Sprintf("invalid elevated '%s' (must be true or false)", elevated))
+	}
+	if values["labels"] != "" {
+		for _, label := range strings.Split(values["labels"], ";") {
+			key, _, found := strings.Cut(label, "=")
+			if !found || key == "" {
+				problems = append(problems, fmt.Sprintf("invalid label '%s' (must be key=value)", label))
+			}
+		}
+	}
+	return problems
+}
+
+// Summarizes the verification, listing the first few malformed lines
+func describeVerifyResponse(response *VerifyResponse) string {
+	details := fmt.Sprintf("%d of %d rows valid", response.rows - response.malformed, response.rows)
+	if len(response.malformedLines) == 0 {
+		return details
+	}
+	lineNumbers := []string{}
+	for i, line := range response.malformedLines {
+		if i == MaxReportedLines {
+			lineNumbers = append(lineNumbers, fmt.Sprintf("and %d more", len(response.malformedLines) - MaxReportedLines))
+			break
+		}
+		lineNumbers = append(lineNumbers, strconv.Itoa(line))
+	}
+	return details + " (problems on lines " + strings.Join(lineNumbers, ", ") + ")"
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Verify_Valid(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "-labels=phase=2", "create", dir + "/test.txt"})
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "verify"}
+	output := callMain(args)
+	assert.Contains(t, output, "Log file " + logFilePath + " is valid: 0 of 1 rows malformed")
+	assert.Equal(t, activityLogEntry.activity, "verify")
+	assert.Equal(t, activityLogEntry.status, "valid")
+	assert.Equal(t, activityLogEntry.details, "1 of 1 rows valid")
+
+	// The verify entry itself should be valid too
+	callMain(args)
+	assert.Equal(t, activityLogEntry.details, "2 of 2 rows valid")
+}
+
+func TestMain_Verify_Malformed(t *testing.T) {
+	dir := t.TempDir()
+	validRow := strings.Join(serializeToCSV(&ActivityLogEntry{timestamp: "2024-11-05T16:20:14-06:00", activity: "send", status: "sent", destPort: 443, hostIPs: "10.0.0.5 fe80::1", labels: "phase=2"}), ",")
+	rows := []string{
+		validRow,
+		"2024-11-05T16:20:14-06:00,send,linux",
+		strings.Replace(validRow, "2024-11-05T16:20:14-06:00", "11/05/2024 4:20 PM", 1),
+		strings.Replace(validRow, ",send,", ",teleport,", 1),
+		strings.Replace(validRow, ",443,", ",70000,", 1),
+		strings.Replace(validRow, ",sent,", ",sent-ish,", 1),
+	}
+	logFilePath := dir + "/old-log.csv"
+	os.WriteFile(logFilePath, []byte(getCSVFileHeader() + strings.Join(rows, "\n") + "\n"), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "verify", logFilePath}
+	output := callMain(args)
+	assert.Contains(t, output, "Line 4: row has 3 fields (expected 32)\n")
+	assert.Contains(t, output, "Line 5: invalid timestamp '11/05/2024 4:20 PM' (must be RFC3339)\n")
+	assert.Contains(t, output, "Line 6: unknown activity 'teleport'\n")
+	assert.Contains(t, output, "Line 7: invalid destPort '70000' (must be 0 to 65535)\n")
+	assert.Contains(t, output, "Line 8: unknown status 'sent-ish'\n")
+	assert.Equal(t, activityLogEntry.status, "invalid")
+	assert.Equal(t, activityLogEntry.details, "1 of 6 rows valid (problems on lines 4\\, 5\\, 6\\, 7\\, 8)")
+}
+
+func TestMain_Verify_NewerVersion(t *testing.T) {
+	// A log from a newer version can't be opened as a sink, but it's still verified (as invalid)
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	contents := SchemaVersionPrefix + strconv.Itoa(SchemaVersion + 1) + "\n" + HeaderStr + ",newColumn\n"
+	os.WriteFile(logFilePath, []byte(contents), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "verify"}
+	output := callMain(args)
+	assert.Contains(t, output, "Not writing the verify entry to " + logFilePath + ", since it isn't at the current schema version")
+	assert.Equal(t, activityLogEntry.status, "invalid")
+	assert.Contains(t, output, `"activity":"verify"`)
+	written, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, contents, written)
+}
+
+func TestMain_Verify_OldVersion(t *testing.T) {
+	// An older log is verified as it was, rather than migrated first
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	contents := TestV1HeaderStr + "\n" + TestV1Row + "\n"
+	os.WriteFile(logFilePath, []byte(contents), 0644)
+
+	args := []string{"./noisemaker", "-logfile=" + logFilePath, "verify"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "valid")
+	written, err := readTestFile(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, contents, written)
+	assert.False(t, fileExists(logFilePath + ".bak"))
+}
+
+func TestMain_Verify_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"./noisemaker", "-logfile=" + dir + "/activity-log.csv", "verify", dir + "/nonexistent-log.csv"}
+	callMain(args)
+	assert.Equal(t, activityLogEntry.status, "not_found")
+}
+
+func TestVerifyLog_OldVersion(t *testing.T) {
+	// Logs from before the schema version was recorded are checked against their header's columns
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	executed := strings.Replace(TestV1Row, ",send,", ",execute,", 1)
+	executed = strings.Replace(executed, ",sent,", ",exit status 1,", 1)
+	os.WriteFile(logFilePath, []byte(TestV1HeaderStr + "\n" + TestV1Row + "\n" + executed + "\n" + TestV1Row + ",1\n"), 0644)
+
+	response, err := verifyLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "invalid", response.status)
+	assert.Equal(t, 3, response.rows)
+	assert.Equal(t, 1, response.malformed)
+	assert.Equal(t, []int{4}, response.malformedLines)
+}
+
+func TestVerifyLog_Header(t *testing.T) {
+	logFilePath := t.TempDir() + "/activity-log.csv"
+	os.WriteFile(logFilePath, []byte("#schemaVersion=2\n" + HeaderStr + "\n"), 0644)
+
+	response, err := verifyLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2}, response.malformedLines)
+	assert.Equal(t, 0, response.rows)
+}
+
+func TestVerifyLog_JSONL(t *testing.T) {
+	validLine := string(serializeToJSON(&ActivityLogEntry{timestamp: "2024-11-05T16:20:14-06:00", activity: "send", status: "sent", destPort: 443}))
+	lines := []string{
+		validLine,
+		strings.Replace(validLine, `"destPort":443`, `"destPort":"443"`, 1),
+		strings.Replace(validLine, `"note":""`, `"notes":""`, 1),
+		`{"timestamp":"2024-11-05T16:20:14-06:00","activity":`,
+		strings.Replace(validLine, `"seq":0`, `"seq":-1`, 1),
+	}
+	logFilePath := t.TempDir() + "/activity-log.jsonl"
+	os.WriteFile(logFilePath, []byte(strings.Join(lines, "\n") + "\n"), 0644)
+
+	response, err := verifyLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "invalid", response.status)
+	assert.Equal(t, 5, response.rows)
+	assert.Equal(t, []int{2, 3, 4, 5}, response.malformedLines)
+}
+
+func TestDescribeVerifyResponse(t *testing.T) {
+	response := &VerifyResponse{rows: 20, malformed: 12}
+	for i := 1; i <= 12; i++ {
+		response.malformedLines = append(response.malformedLines, i + 2)
+	}
+	assert.Equal(t, "8 of 20 rows valid (problems on lines 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, and 2 more)", describeVerifyResponse(response))
+}
+
+func TestIsFailureStatus(t *testing.T) {
+	for _, status := range []string{"error", "unreachable", "timeout", "unsupported", "invalid_address", "invalid_request", "exit status 1", "signal: killed"} {
+		assert.True(t, isFailureStatus(status), status)
+	}
+	for _, status := range []string{"", "sent", "closed", "filtered", "partial", "invalid", "disabled", "exit status 0"} {
+		assert.False(t, isFailureStatus(status), status)
+	}
+
+	// Every failure status is one that's logged
+	for _, status := range FailureStatuses {
+		assert.Contains(t, KnownStatuses, status)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The largest file -recreate keeps the contents of, to put it back if it's deleted (bait files are small)
+const MaxWatchedFileSize = 1 << 20
+
+// Options for the watch command
+type WatchOptions struct {
+	dir					string
+	poll				bool			// whether to check the directory every interval, rather than being told of changes as they happen
+	interval			time.Duration	// how often the directory's checked for changes (with -poll)
+	duration			time.Duration	// how long to watch for (0 for until it's interrupted)
+	maxEvents			int				// how many events to observe before stopping (0 for no limit)
+	recreate			bool			// whether to put deleted files back, with the contents they had
+}
+
+// What watch knows about one of the files in the directory
+type WatchedFile struct {
+	size				int64
+	modTime				time.Time
+	mode				fs.FileMode
+	contents			[]byte			// with -recreate, what the file had in it (if it isn't too large)
+}
+
+// A change to something in a watched directory, as the OS told of it
+type WatchEvent struct {
+	path				string
+	dir					bool			// whether it's a directory (so everything under it's checked)
+	created				bool			// whether it was created, or moved in
+	overflow			bool			// whether the OS dropped events (so the whole directory's checked)
+}
+
+// Response data from watch action
+type WatchResponse struct {
+	method				string			// how it learned of changes: poll, or how the OS told it of them (ie. inotify)
+	files				int				// how many files were there when it started
+	created				int
+	modified			int
+	deleted				int
+	recreated			int
+	status				string
+}
+
+// Parses watch's arguments: [-poll] [-interval=(duration)] [-duration=(duration)] [-max-events=(n)] [-recreate] (dir)
+func parseWatchOptions(args []string) (*WatchOptions, error) {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	poll := flags.Bool("poll", false, "checks the directory every -interval, rather than being told of changes as they happen (default false)")
+	interval := flags.Duration("interval", time.Second, "how often to check the directory for changes, with -poll (default 1s)")
+	duration := flags.Duration("duration", 0, "how long to watch for (default until it's interrupted)")
+	maxEvents := flags.Int("max-events", 0, "the number of events to observe before stopping (default 0, no limit)")
+	recreate := flags.Bool("recreate", false, "puts deleted files back, with the contents they had (default false)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid watch: %v", err)
+	}
+	if flags.NArg() < 1 {
+		return nil, fmt.Errorf("not enough arguments for watch! Args: %v", args)
+	}
+	if *interval <= 0 {
+		return nil, fmt.Errorf("invalid watch: invalid -interval %v (must be more than 0)", *interval)
+	}
+	if *duration < 0 {
+		return nil, fmt.Errorf("invalid watch: invalid -duration %v (must be 0 or more)", *duration)
+	}
+	if *maxEvents < 0 {
+		return nil, fmt.Errorf("invalid watch: invalid -max-events %d (must be 0 or more)", *maxEvents)
+	}
+	return &WatchOptions{dir: flags.Arg(0), poll: *poll, interval: *interval, duration: *duration, maxEvents: *maxEvents, recreate: *recreate}, nil
+}
+
+// Gets every file under the directory as it is now (keeping the contents of each, with keepContents)
+func scanWatchedDir(dir string, keepContents bool) (map[string]*WatchedFile, error) {
+	files := map[string]*WatchedFile{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			// (a file that's gone between being listed and looked at is picked up by the next check)
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		files[path] = getWatchedFile(path, info, keepContents)
+		return nil
+	})
+	return files, err
+}
+
+// Gets the file at the path as it is now (or nil if it's gone, or a directory)
+func scanWatchedFile(path string, keepContents bool) *WatchedFile {
+	info, err := os.Lstat(path)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	return getWatchedFile(path, info, keepContents)
+}
+
+// Gets what watch knows about a file from its info (keeping its contents, with keepContents)
+func getWatchedFile(path string, info fs.FileInfo, keepContents bool) *WatchedFile {
+	file := &WatchedFile{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+	if keepContents && info.Mode().IsRegular() && info.Size() <= MaxWatchedFileSize {
+		file.contents, _ = os.ReadFile(path)
+	}
+	return file
+}
+
+// Watches the directory (and the ones under it) for changes made by anything else, as the OS tells of them (or, with -poll, or where
+// it can't, checking it every interval), logging each file that's created, modified, or deleted as an observe activity (with -recreate,
+// putting deleted files back). Stops once the duration's up, it's observed enough events, or it's interrupted (when the parent's run is
+// shut down).
+func watchDirectory(activityLog Sink, parent *ActivityLogEntry, options *WatchOptions) (*WatchResponse, error) {
+	response := &WatchResponse{method: "poll", status: "error"}
+	files, err := scanWatchedDir(options.dir, options.recreate)
+	if err != nil {
+		response.status = getFileErrorStatus(err)
+		return response, err
+	}
+	response.files = len(files)
+	var notifications <-chan WatchEvent
+	if !options.poll {
+		notifier, err := newWatchNotifier(options.dir)
+		if err != nil {
+			fmt.Printf("Couldn't be told of changes to %s (%v), polling it every %v instead\n", options.dir, err, options.interval)
+		} else {
+			defer notifier.close()
+			notifications = notifier.events
+			response.method = WatchNotifyMethod
+		}
+	}
+	fmt.Printf("Watching %s (%d files) for changes (%s)...\n", options.dir, len(files), response.method)
+
+	signals, stopSignals := notifyShutdown()
+	defer stopSignals()
+	var finished <-chan time.Time
+	if options.duration > 0 {
+		timer := time.NewTimer(options.duration)
+		defer timer.Stop()
+		finished = timer.C
+	}
+	var ticks <-chan time.Time
+	if notifications == nil {
+		ticker := time.NewTicker(options.interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	var received os.Signal
+	for received == nil {
+		var event WatchEvent
+		notified := false
+		select {
+		case <-ticks:
+		case event, notified = <-notifications:
+			if !notified {
+				// (the OS stopped telling of changes, so they're polled for from here on)
+				fmt.Printf("Stopped being told of changes to %s, polling it every %v instead\n", options.dir, options.interval)
+				notifications = nil
+				ticker := time.NewTicker(options.interval)
+				defer ticker.Stop()
+				ticks = ticker.C
+				response.method = "poll"
+				continue
+			}
+		case <-finished:
+			response.status = "stopped"
+			return response, nil
+		case received = <-signals:
+			fmt.Println("Interrupted, stopping...")
+			continue
+		case <-runContext.Done():
+			fmt.Println("Timed out, stopping...")
+			response.status = "stopped"
+			return response, nil
+		}
+
+		if notified {
+			if observeWatchEvent(activityLog, parent, options, files, event, response) {
+				response.status = "stopped"
+				return response, nil
+			}
+			continue
+		}
+		current, err := scanWatchedDir(options.dir, options.recreate)
+		if err != nil {
+			// (ie. the directory itself was deleted; it's checked again next time)
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		if observeWatchedDir(activityLog, parent, options, files, current, response) {
+			response.status = "stopped"
+			return response, nil
+		}
+		files = current
+	}
+
+	shutdown(activityLog, parent, received)
+	response.status = "stopped"
+	return response, nil
+}
+
+// Logs what's changed at the path the OS told of (or, for a directory, anywhere under it, or if it dropped events, anywhere at all),
+// updating files to match, and returning true once it's observed enough events
+func observeWatchEvent(activityLog Sink, parent *ActivityLogEntry, options *WatchOptions, files map[string]*WatchedFile, event WatchEvent, response *WatchResponse) bool {
+	root := event.path
+	if event.overflow {
+		root = options.dir
+	}
+	previous := map[string]*WatchedFile{}
+	current := map[string]*WatchedFile{}
+	if event.dir || event.overflow {
+		for path, file := range files {
+			if path == root || strings.HasPrefix(path, root + string(filepath.Separator)) {
+				previous[path] = file
+			}
+		}
+		if scanned, err := scanWatchedDir(root, options.recreate); err == nil {
+			current = scanned
+		}
+	} else {
+		if file := files[root]; file != nil {
+			previous[root] = file
+		}
+		if file := scanWatchedFile(root, options.recreate); file != nil {
+			current[root] = file
+		} else if event.created && previous[root] == nil {
+			// (created, and gone again before it could be looked at, which is still a file that was created, and then deleted)
+			current[root] = &WatchedFile{}
+		}
+	}
+	stop := observeWatchedDir(activityLog, parent, options, previous, current, response)
+	for path := range previous {
+		delete(files, path)
+	}
+	for path, file := range current {
+		files[path] = file
+	}
+	return stop
+}
+
+// Logs the differences between what was in the directory and what's there now, as observe activities (putting deleted files back, and
+// into current, with -recreate), returning true once it's observed enough events
+func observeWatchedDir(activityLog Sink, parent *ActivityLogEntry, options *WatchOptions, previous map[string]*WatchedFile, current map[string]*WatchedFile, response *WatchResponse) bool {
+	paths := []string{}
+	for path := range previous {
+		paths = append(paths, path)
+	}
+	for path := range current {
+		if previous[path] == nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		before, after := previous[path], current[path]
+		var status, details string
+		switch {
+		case before == nil:
+			status = "created"
+			details = fmt.Sprintf("created, %d bytes", after.size)
+			response.created++
+		case after == nil:
+			status = "deleted"
+			details = "deleted"
+			response.deleted++
+		case before.size != after.size || !before.modTime.Equal(after.modTime) || before.mode != after.mode:
+			status = "modified"
+			details = fmt.Sprintf("modified, %d bytes (was %d)", after.size, before.size)
+			response.modified++
+		default:
+			continue
+		}
+		fmt.Printf("Observed %s %s\n", path, status)
+		entry := newChildLogEntry(parent, "observe")
+		entry.path = escapeRawText(path)
+		entry.method = response.method
+		entry.status = status
+		entry.details = escapeRawText(details)
+		writeLogEntry(activityLog, entry)
+
+		if status == "deleted" && options.recreate && before.contents != nil {
+			if recreateWatchedFile(activityLog, parent, path, before) {
+				current[path] = before
+				response.recreated++
+			}
+		}
+		if options.maxEvents > 0 && response.created + response.modified + response.deleted >= options.maxEvents {
+			return true
+		}
+	}
+	return false
+}
+
+// Puts a deleted file back with the contents (and permissions) it had, logging it as a create activity with a reaction=recreate label,
+// returning whether it was
+func recreateWatchedFile(activityLog Sink, parent *ActivityLogEntry, path string, file *WatchedFile) bool {
+	entry := newChildLogEntry(parent, "create")
+	entry.path = escapeRawText(path)
+	entry.labels = addLabel(entry.labels, "reaction", "recreate")
+	err := os.WriteFile(path, file.contents, file.mode.Perm())
+	if err == nil {
+		var info os.FileInfo
+		info, err = os.Stat(path)
+		if err == nil {
+			// (so the next check doesn't see it as changed)
+			file.size, file.modTime, file.mode = info.Size(), info.ModTime(), info.Mode()
+		}
+	}
+	if err != nil {
+		fmt.Printf("Couldn't re-create %s: %v\n", path, err)
+		entry.status = getWriteFileStatus(err)
+		entry.details = escapeRawText(err.Error())
+	} else {
+		fmt.Printf("Re-created %s\n", path)
+		entry.status = "created"
+		entry.details = escapeRawText(fmt.Sprintf("re-created deleted file, %d bytes (-recreate)", len(file.contents)))
+	}
+	writeLogEntry(activityLog, entry)
+	return err == nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// How watch is told of changes as they happen on Linux (logged as its method)
+const WatchNotifyMethod = "inotify"
+
+// What inotify's asked to tell of for each directory being watched
+const watchNotifyMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_ATTRIB | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+
+// Tells of the changes in a directory (and the ones under it) as they happen, with inotify
+type WatchNotifier struct {
+	file				*os.File			// the inotify instance (non-blocking, so closing it stops a read)
+	dirs				map[int32]string	// each directory being watched, by its watch descriptor (only used by read, once it's started)
+	events				chan WatchEvent
+	done				chan struct{}
+}
+
+// Starts telling of the changes in the directory, and every directory under it (including the ones created later)
+func newWatchNotifier(dir string) (*WatchNotifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	notifier := &WatchNotifier{file: os.NewFile(uintptr(fd), "inotify"), dirs: map[int32]string{}, events: make(chan WatchEvent), done: make(chan struct{})}
+	if err = notifier.add(dir); err != nil {
+		notifier.file.Close()
+		return nil, err
+	}
+	go notifier.read()
+	return notifier, nil
+}
+
+// Watches the directory, and every directory under it (failing only if the directory itself can't be)
+func (notifier *WatchNotifier) add(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		wd, err := unix.InotifyAddWatch(int(notifier.file.Fd()), path, watchNotifyMask)
+		if err != nil {
+			if path == dir {
+				return &fs.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+			}
+			// (a directory that's gone already is told of by its parent)
+			return nil
+		}
+		notifier.dirs[int32(wd)] = path
+		return nil
+	})
+}
+
+// Reads what inotify tells of, sending each change as an event (until it's closed)
+func (notifier *WatchNotifier) read() {
+	defer close(notifier.events)
+	buffer := make([]byte, 64 * (unix.SizeofInotifyEvent + unix.NAME_MAX + 1))
+	for {
+		n, err := notifier.file.Read(buffer)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset + unix.SizeofInotifyEvent <= n; {
+			// (each is its watch descriptor, mask, cookie, and name's length, followed by its null-padded name)
+			wd := int32(binary.NativeEndian.Uint32(buffer[offset:]))
+			mask := binary.NativeEndian.Uint32(buffer[offset + 4:])
+			length := int(binary.NativeEndian.Uint32(buffer[offset + 12:]))
+			start := offset + unix.SizeofInotifyEvent
+			offset = start + length
+			if offset > n {
+				break
+			}
+			name := strings.TrimRight(string(buffer[start:offset]), "\x00")
+			if !notifier.handle(wd, mask, name) {
+				return
+			}
+		}
+	}
+}
+
+// Sends the change inotify told of as an event (watching a directory that's been created, or moved in), returning false once it's closed
+func (notifier *WatchNotifier) handle(wd int32, mask uint32, name string) bool {
+	var event WatchEvent
+	switch {
+	case mask & unix.IN_Q_OVERFLOW != 0:
+		event.overflow = true
+	case mask & unix.IN_IGNORED != 0:
+		// (the directory's gone, or was moved out)
+		delete(notifier.dirs, wd)
+		return true
+	default:
+		dir, ok := notifier.dirs[wd]
+		if !ok || name == "" {
+			return true
+		}
+		event.path = filepath.Join(dir, name)
+		event.dir = mask & unix.IN_ISDIR != 0
+		event.created = mask & (unix.IN_CREATE | unix.IN_MOVED_TO) != 0
+		if event.dir && event.created {
+			// (watched before it's checked, so nothing created in it after that's missed)
+			notifier.add(event.path)
+		}
+	}
+	select {
+	case notifier.events <- event:
+		return true
+	case <-notifier.done:
+		return false
+	}
+}
+
+// Stops telling of changes
+func (notifier *WatchNotifier) close() {
+	close(notifier.done)
+	notifier.file.Close()
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// How watch is told of changes as they happen (which it can't be here, so it always polls)
+const WatchNotifyMethod = "poll"
+
+// Tells of the changes in a directory as they happen (only on Linux, with inotify)
+type WatchNotifier struct {
+	events				chan WatchEvent
+}
+
+// Being told of changes as they happen is Linux-only
+func newWatchNotifier(dir string) (*WatchNotifier, error) {
+	return nil, fmt.Errorf("%w: being told of changes isn't supported on %s", errors.ErrUnsupported, runtime.GOOS)
+}
+
+// Stops telling of changes
+func (notifier *WatchNotifier) close() {}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain_Watch(t *testing.T) {
+	dir := t.TempDir()
+	watchedDir := dir + "/watched"
+	assert.Nil(t, os.MkdirAll(watchedDir + "/sub", 0755))
+	logFilePath := dir + "/activity-log.csv"
+
+	// Changes made by something else are observed as the OS tells of them (or, with -poll, at the next check), with how as the method
+	// (each file's written elsewhere and moved into place, so a check can't see it half-written)
+	for _, method := range []string{WatchNotifyMethod, "poll"} {
+		os.Remove(logFilePath)
+		assert.Nil(t, os.WriteFile(watchedDir + "/bait.txt", []byte("bait"), 0644))
+		go func() {
+			time.Sleep(150 * time.Millisecond)
+			os.WriteFile(dir + "/new.txt", []byte("new"), 0644)
+			os.Rename(dir + "/new.txt", watchedDir + "/sub/new.txt")
+			time.Sleep(150 * time.Millisecond)
+			os.WriteFile(dir + "/bait.txt", []byte("encrypted bait"), 0644)
+			os.Rename(dir + "/bait.txt", watchedDir + "/bait.txt")
+			time.Sleep(150 * time.Millisecond)
+			os.Remove(watchedDir + "/sub/new.txt")
+		}()
+		args := []string{"./noisemaker", "-logfile=" + logFilePath, "watch", "-interval=50ms", "-duration=10s", "-max-events=3", watchedDir}
+		if method == "poll" {
+			args = append(args[:3], append([]string{"-poll"}, args[3:]...)...)
+		}
+		callMain(args)
+		assert.Equal(t, "watch", activityLogEntry.activity)
+		assert.Equal(t, "stopped", activityLogEntry.status)
+		assert.Equal(t, method, activityLogEntry.method)
+		assert.Equal(t, "1 files\\, 1 created\\, 1 modified\\, 1 deleted\\, 0 re-created", activityLogEntry.details)
+		parsedLog, err := readLog(logFilePath)
+		assert.Nil(t, err)
+		assert.Len(t, parsedLog.entries, 4)
+		statuses := []string{}
+		for _, entry := range parsedLog.entries[:3] {
+			assert.Equal(t, "observe", entry.activity)
+			assert.Equal(t, method, entry.method)
+			assert.Equal(t, activityLogEntry.correlationId, entry.correlationId)
+			statuses = append(statuses, entry.status)
+		}
+		assert.Equal(t, []string{"created", "modified", "deleted"}, statuses)
+		assert.Equal(t, watchedDir + "/sub/new.txt", parsedLog.entries[0].path)
+		assert.Equal(t, "modified\\, 14 bytes (was 4)", parsedLog.entries[1].details)
+	}
+
+	// Without changes, it watches until the duration's up
+	os.Remove(logFilePath)
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "watch", "-interval=20ms", "-duration=100ms", watchedDir})
+	assert.Equal(t, "stopped", activityLogEntry.status)
+	assert.Equal(t, "1 files\\, 0 created\\, 0 modified\\, 0 deleted\\, 0 re-created", activityLogEntry.details)
+
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "watch", "-duration=100ms", dir + "/missing"})
+	assert.Equal(t, "not_found", activityLogEntry.status)
+}
+
+func TestMain_Watch_Recreate(t *testing.T) {
+	dir := t.TempDir()
+	watchedDir := dir + "/watched"
+	assert.Nil(t, os.Mkdir(watchedDir, 0755))
+	assert.Nil(t, os.WriteFile(watchedDir + "/passwords.txt", []byte("hunter2"), 0600))
+	logFilePath := dir + "/activity-log.csv"
+
+	// A deleted file is put back as it was
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		os.Remove(watchedDir + "/passwords.txt")
+	}()
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "watch", "-interval=50ms", "-duration=10s", "-max-events=1", "-recreate", watchedDir})
+	assert.Equal(t, "1 files\\, 0 created\\, 0 modified\\, 1 deleted\\, 1 re-created", activityLogEntry.details)
+	contents, err := os.ReadFile(watchedDir + "/passwords.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "hunter2", string(contents))
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	assert.Len(t, parsedLog.entries, 3)
+	assert.Equal(t, "observe", parsedLog.entries[0].activity)
+	assert.Equal(t, "deleted", parsedLog.entries[0].status)
+	recreated := parsedLog.entries[1]
+	assert.Equal(t, "create", recreated.activity)
+	assert.Equal(t, "created", recreated.status)
+	assert.Equal(t, "reaction=recreate", recreated.labels)
+	assert.Equal(t, "re-created deleted file\\, 7 bytes (-recreate)", recreated.details)
+}
+
+func TestParseWatchOptions(t *testing.T) {
+	options, err := parseWatchOptions([]string{"-interval=5s", "-recreate", "/tmp/bait"})
+	assert.Nil(t, err)
+	assert.Equal(t, &WatchOptions{dir: "/tmp/bait", interval: 5 * time.Second, recreate: true}, options)
+
+	options, err = parseWatchOptions([]string{"-poll", "/tmp/bait"})
+	assert.Nil(t, err)
+	assert.Equal(t, &WatchOptions{dir: "/tmp/bait", poll: true, interval: time.Second}, options)
+
+	_, err = parseWatchOptions([]string{"-recreate"})
+	assert.ErrorContains(t, err, "not enough arguments for watch!")
+	_, err = parseWatchOptions([]string{"-interval=0s", "/tmp/bait"})
+	assert.ErrorContains(t, err, "invalid -interval 0s (must be more than 0)")
+	_, err = parseWatchOptions([]string{"-max-events=-1", "/tmp/bait"})
+	assert.ErrorContains(t, err, "invalid -max-events -1 (must be 0 or more)")
+}
+
+func TestMain_Watch_Inotify(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("being told of changes as they happen is Linux-only")
+	}
+	dir := t.TempDir()
+	logFilePath := dir + "/activity-log.csv"
+
+	// What's too quick to be polled for is still observed: a file created and deleted again at once, and a directory created and
+	// filled (whatever's in it before it's watched, and after)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		os.WriteFile(dir + "/blink.txt", []byte("blink"), 0644)
+		os.Remove(dir + "/blink.txt")
+		os.MkdirAll(dir + "/new/deeper", 0755)
+		os.WriteFile(dir + "/new/deeper/note.txt", []byte("note"), 0644)
+	}()
+	callMain([]string{"./noisemaker", "-logfile=" + logFilePath, "watch", "-duration=10s", "-max-events=3", dir})
+	assert.Equal(t, "inotify", activityLogEntry.method)
+	assert.Equal(t, "stopped", activityLogEntry.status)
+	parsedLog, err := readLog(logFilePath)
+	assert.Nil(t, err)
+	observed := []string{}
+	for _, entry := range parsedLog.entries[:len(parsedLog.entries) - 1] {
+		observed = append(observed, entry.path + " " + entry.status)
+	}
+	assert.Equal(t, []string{dir + "/blink.txt created", dir + "/blink.txt deleted", dir + "/new/deeper/note.txt created"}, observed[:3])
+}